@@ -29,6 +29,19 @@ var (
 	Default              = mock
 )
 
+type requestIDContextKey struct{}
+
+// WithRequestID passes the request id to PostGroupConsume, so that the balance backends
+// can record which request is consumed
+func WithRequestID(ctx context.Context, requestID string) context.Context {
+	return context.WithValue(ctx, requestIDContextKey{}, requestID)
+}
+
+func RequestIDFromContext(ctx context.Context) string {
+	requestID, _ := ctx.Value(requestIDContextKey{}).(string)
+	return requestID
+}
+
 func MockGetGroupRemainBalance(
 	ctx context.Context,
 	group model.GroupCache,
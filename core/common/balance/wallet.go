@@ -0,0 +1,172 @@
+package balance
+
+import (
+	"context"
+	"math/rand/v2"
+	"time"
+
+	"github.com/labring/aiproxy/core/common"
+	"github.com/labring/aiproxy/core/common/env"
+	"github.com/labring/aiproxy/core/model"
+	gcache "github.com/patrickmn/go-cache"
+	"github.com/redis/go-redis/v9"
+)
+
+const walletRemainKey = "wallet:remain:%s"
+
+var (
+	_                       GroupBalance = (*Wallet)(nil)
+	walletRedisCacheEnable               = env.Bool("BALANCE_WALLET_REDIS_CACHE_ENABLE", true)
+	walletCacheExpire                    = 3 * time.Minute
+	walletLocalRemainCache               = gcache.New(2*time.Second, 5*time.Second)
+	walletLocalRemainLocker              = common.NewKeyedLocker()
+)
+
+// Wallet is the built-in prepaid balance backend, the balance of every group is kept
+// in the database and topped up by the admin
+type Wallet struct{}
+
+func InitWallet() {
+	Default = NewWallet()
+}
+
+func NewWallet() *Wallet {
+	return &Wallet{}
+}
+
+type walletCache struct {
+	Remain float64 `redis:"r"`
+}
+
+func cacheSetWalletRemainLocal(group string, remain float64) {
+	common.WithKeyLock(walletLocalRemainLocker, group, func() {
+		walletLocalRemainCache.Set(group, remain, time.Second)
+	})
+}
+
+func cacheGetWalletRemainLocal(group string) (float64, bool) {
+	v, ok := walletLocalRemainCache.Get(group)
+	if !ok {
+		return 0, false
+	}
+
+	remain, ok := v.(float64)
+	if !ok {
+		panic("wallet local remain cache type mismatch")
+	}
+
+	return remain, true
+}
+
+func cacheSetWalletRemain(ctx context.Context, group string, remain float64) error {
+	cacheSetWalletRemainLocal(group, remain)
+
+	if !common.RedisEnabled || !walletRedisCacheEnable {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	pipe := common.RDB.Pipeline()
+	pipe.HSet(ctx, common.RedisKeyf(walletRemainKey, group), walletCache{Remain: remain})
+
+	expireTime := walletCacheExpire + time.Duration(rand.Int64N(10)-5)*time.Second
+	pipe.Expire(ctx, common.RedisKeyf(walletRemainKey, group), expireTime)
+	_, err := pipe.Exec(ctx)
+
+	return err
+}
+
+func cacheGetWalletRemain(ctx context.Context, group string) (float64, error) {
+	if remain, ok := cacheGetWalletRemainLocal(group); ok {
+		return remain, nil
+	}
+
+	if !common.RedisEnabled || !walletRedisCacheEnable {
+		return 0, redis.Nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	cmd := common.RDB.HGetAll(ctx, common.RedisKeyf(walletRemainKey, group))
+	if err := cmd.Err(); err != nil {
+		return 0, err
+	}
+
+	if len(cmd.Val()) == 0 {
+		return 0, redis.Nil
+	}
+
+	var cache walletCache
+	if err := cmd.Scan(&cache); err != nil {
+		return 0, err
+	}
+
+	cacheSetWalletRemainLocal(group, cache.Remain)
+
+	return cache.Remain, nil
+}
+
+// UpdateWalletCache refreshes the cached remain of a wallet after it is changed by the
+// admin, so that the change takes effect without waiting for the cache to expire
+func UpdateWalletCache(ctx context.Context, wallet *model.GroupWallet) error {
+	return cacheSetWalletRemain(ctx, wallet.GroupID, wallet.Remain())
+}
+
+func (w *Wallet) GetGroupRemainBalance(
+	ctx context.Context,
+	group model.GroupCache,
+) (float64, PostGroupConsumer, error) {
+	consumer := &walletPostGroupConsumer{group: group.ID}
+
+	if remain, err := cacheGetWalletRemain(ctx, group.ID); err == nil {
+		return remain, consumer, nil
+	}
+
+	wallet, err := model.GetOrEmptyGroupWallet(group.ID)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	_ = cacheSetWalletRemain(ctx, group.ID, wallet.Remain())
+
+	return wallet.Remain(), consumer, nil
+}
+
+func (w *Wallet) GetGroupQuota(_ context.Context, group model.GroupCache) (*GroupQuota, error) {
+	wallet, err := model.GetOrEmptyGroupWallet(group.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	totalTopUp, err := model.GetGroupWalletTotalTopUp(group.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	return &GroupQuota{
+		Total:  totalTopUp + wallet.CreditLimit,
+		Remain: wallet.Remain(),
+	}, nil
+}
+
+type walletPostGroupConsumer struct {
+	group string
+}
+
+func (c *walletPostGroupConsumer) PostGroupConsume(
+	ctx context.Context,
+	tokenName string,
+	usage float64,
+) (float64, error) {
+	wallet, err := model.ConsumeGroupWallet(c.group, tokenName, RequestIDFromContext(ctx), usage)
+	if err != nil {
+		return 0, err
+	}
+
+	_ = UpdateWalletCache(ctx, wallet)
+
+	return usage, nil
+}
@@ -0,0 +1,74 @@
+package balance_test
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/labring/aiproxy/core/common"
+	"github.com/labring/aiproxy/core/common/balance"
+	"github.com/labring/aiproxy/core/model"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWalletConsumeRecordsRequestID(t *testing.T) {
+	prevDB := model.DB
+	prevUsingSQLite := common.UsingSQLite
+
+	testDB, err := model.OpenSQLite(filepath.Join(t.TempDir(), "wallet.db"))
+	require.NoError(t, err)
+
+	model.DB = testDB
+	common.UsingSQLite = true
+
+	t.Cleanup(func() {
+		model.DB = prevDB
+		common.UsingSQLite = prevUsingSQLite
+	})
+
+	require.NoError(t, testDB.AutoMigrate(
+		&model.GroupWallet{},
+		&model.GroupWalletTopUp{},
+		&model.GroupWalletLedger{},
+	))
+
+	_, err = model.TopUpGroupWallet("group", 2, "")
+	require.NoError(t, err)
+
+	wallet := balance.NewWallet()
+	group := model.GroupCache{ID: "group"}
+
+	remain, consumer, err := wallet.GetGroupRemainBalance(t.Context(), group)
+	require.NoError(t, err)
+	require.InDelta(t, 2, remain, 1e-9)
+
+	ctx := balance.WithRequestID(context.Background(), "request-id")
+	consumed, err := consumer.PostGroupConsume(ctx, "token", 0.5)
+	require.NoError(t, err)
+	require.InDelta(t, 0.5, consumed, 1e-9)
+
+	quota, err := wallet.GetGroupQuota(t.Context(), group)
+	require.NoError(t, err)
+	require.InDelta(t, 2, quota.Total, 1e-9)
+	require.InDelta(t, 1.5, quota.Remain, 1e-9)
+
+	// the remain is served from the cache that is refreshed by the consume
+	remain, _, err = wallet.GetGroupRemainBalance(t.Context(), group)
+	require.NoError(t, err)
+	require.InDelta(t, 1.5, remain, 1e-9)
+
+	// consuming the same request again is a no-op
+	_, err = consumer.PostGroupConsume(ctx, "token", 0.5)
+	require.NoError(t, err)
+
+	quota, err = wallet.GetGroupQuota(t.Context(), group)
+	require.NoError(t, err)
+	require.InDelta(t, 1.5, quota.Remain, 1e-9)
+
+	ledgers, _, err := model.GetGroupWalletLedgers("group", model.WalletLedgerTypeConsume, 1, 10)
+	require.NoError(t, err)
+	require.Len(t, ledgers, 1)
+	require.NotNil(t, ledgers[0].RequestID)
+	require.Equal(t, "request-id", *ledgers[0].RequestID)
+	require.Equal(t, "token", ledgers[0].TokenName)
+}
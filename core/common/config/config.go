@@ -11,12 +11,16 @@ import (
 
 var (
 	disableServe                 atomic.Bool
+	enableTTFBWeight             atomic.Bool
 	logStorageHours              atomic.Int64 // default 0 means no limit
 	retryLogStorageHours         atomic.Int64 // default 0 means no limit
+	mcpLogStorageHours           atomic.Int64 // default 0 means same as log storage hours
+	saveMCPLogBody               atomic.Bool
 	saveAllLogDetail             atomic.Bool
 	logDetailRequestBodyMaxSize  int64 = 8 * 1024 // 8KB
 	logDetailResponseBodyMaxSize int64 = 8 * 1024 // 8KB
 	logDetailStorageHours        int64 = 3 * 24   // 3 days
+	mcpLogBodyMaxSize            int64 = 8 * 1024 // 8KB
 	cleanLogBatchSize            int64 = 10000
 	notifyNote                   atomic.Value
 	ipGroupsThreshold            atomic.Int64
@@ -24,6 +28,7 @@ var (
 	retryTimes                   atomic.Int64
 	defaultChannelModels         atomic.Value
 	defaultChannelModelMapping   atomic.Value
+	defaultFilesModel            atomic.Value
 	groupMaxTokenNum             atomic.Int64
 	groupConsumeLevelRatio       atomic.Value
 	usageAlertThreshold          atomic.Int64 // default 0 means disabled
@@ -92,6 +97,33 @@ func SetLogDetailStorageHours(hours int64) {
 	atomic.StoreInt64(&logDetailStorageHours, hours)
 }
 
+func GetMCPLogStorageHours() int64 {
+	return mcpLogStorageHours.Load()
+}
+
+func SetMCPLogStorageHours(hours int64) {
+	hours = env.Int64("MCP_LOG_STORAGE_HOURS", hours)
+	mcpLogStorageHours.Store(hours)
+}
+
+func GetSaveMCPLogBody() bool {
+	return saveMCPLogBody.Load()
+}
+
+func SetSaveMCPLogBody(enabled bool) {
+	enabled = env.Bool("SAVE_MCP_LOG_BODY", enabled)
+	saveMCPLogBody.Store(enabled)
+}
+
+func GetMCPLogBodyMaxSize() int64 {
+	return atomic.LoadInt64(&mcpLogBodyMaxSize)
+}
+
+func SetMCPLogBodyMaxSize(size int64) {
+	size = env.Int64("MCP_LOG_BODY_MAX_SIZE", size)
+	atomic.StoreInt64(&mcpLogBodyMaxSize, size)
+}
+
 func GetCleanLogBatchSize() int64 {
 	return atomic.LoadInt64(&cleanLogBatchSize)
 }
@@ -155,6 +187,17 @@ func SetDisableServe(disabled bool) {
 	disableServe.Store(disabled)
 }
 
+// GetEnableTTFBWeight reports whether the weight of a channel is reduced once its p95
+// ttfb degrades compared to the other channels of the model
+func GetEnableTTFBWeight() bool {
+	return enableTTFBWeight.Load()
+}
+
+func SetEnableTTFBWeight(enabled bool) {
+	enabled = env.Bool("ENABLE_TTFB_WEIGHT", enabled)
+	enableTTFBWeight.Store(enabled)
+}
+
 func GetDefaultChannelModels() map[int][]string {
 	d, _ := defaultChannelModels.Load().(map[int][]string)
 	return d
@@ -221,6 +264,18 @@ func SetNotifyNote(note string) {
 	notifyNote.Store(note)
 }
 
+// GetDefaultFilesModel returns the model used to select the channel of the
+// file uploads that name no model
+func GetDefaultFilesModel() string {
+	m, _ := defaultFilesModel.Load().(string)
+	return m
+}
+
+func SetDefaultFilesModel(model string) {
+	model = env.String("DEFAULT_FILES_MODEL", model)
+	defaultFilesModel.Store(model)
+}
+
 func GetDefaultHost() string {
 	h, _ := defaultHost.Load().(string)
 	return h
@@ -3,6 +3,7 @@ package config
 import (
 	"os"
 	"strings"
+	"time"
 
 	"github.com/labring/aiproxy/core/common/env"
 )
@@ -21,6 +22,21 @@ var (
 	Redis                string
 	RedisKeyPrefix       string
 	ConfigFilePath       string
+	// ConfigApplyOnStart reconciles the groups, tokens, group model configs and
+	// public mcps of the config file to the database on start
+	ConfigApplyOnStart bool
+	ConfigApplyPrune   bool
+	// DisableMetricsAuth serves /metrics without the admin key
+	DisableMetricsAuth bool
+	// RealtimeMaxDuration closes the realtime sessions open for longer, 0
+	// means no limit
+	RealtimeMaxDuration time.Duration
+	// RealtimeAllowedOrigins are the browser origins allowed to open realtime
+	// sessions besides the origin of the server
+	RealtimeAllowedOrigins []string
+	// StdioMCPMaxProcesses limits the running stdio mcp processes, 0 means no
+	// limit
+	StdioMCPMaxProcesses int
 
 	// OnCall Lark configuration for urgent alerts
 	OnCallLarkAppID     string
@@ -42,15 +58,23 @@ func ReloadEnv() {
 	Redis = env.String("REDIS", os.Getenv("REDIS_CONN_STRING"))
 	RedisKeyPrefix = os.Getenv("REDIS_KEY_PREFIX")
 	ConfigFilePath = env.String("CONFIG_FILE_PATH", "./config.yaml")
+	ConfigApplyOnStart = env.Bool("CONFIG_APPLY_ON_START", false)
+	ConfigApplyPrune = env.Bool("CONFIG_APPLY_PRUNE", false)
+	DisableMetricsAuth = env.Bool("DISABLE_METRICS_AUTH", false)
+	RealtimeMaxDuration = time.Duration(
+		env.Int64("REALTIME_MAX_DURATION_SECONDS", 3600),
+	) * time.Second
+	RealtimeAllowedOrigins = parseList(os.Getenv("REALTIME_ALLOWED_ORIGINS"))
+	StdioMCPMaxProcesses = int(env.Int64("STDIO_MCP_MAX_PROCESSES", 64))
 
 	// OnCall Lark configuration
 	OnCallLarkAppID = os.Getenv("ON_CALL_LARK_APP_ID")
 	OnCallLarkAppSecret = os.Getenv("ON_CALL_LARK_APP_SECRET")
-	OnCallLarkOpenIDs = parseOpenIDs(os.Getenv("ON_CALL_LARK_OPEN_ID"))
+	OnCallLarkOpenIDs = parseList(os.Getenv("ON_CALL_LARK_OPEN_ID"))
 }
 
-// parseOpenIDs parses comma-separated open IDs
-func parseOpenIDs(s string) []string {
+// parseList parses a comma-separated list
+func parseList(s string) []string {
 	if s == "" {
 		return nil
 	}
@@ -203,9 +203,13 @@ func checkNeedRecordConsume(code int, meta *meta.Meta) bool {
 		mode.ResponsesDelete,
 		mode.ResponsesCancel,
 		mode.ResponsesInputItems,
-		mode.AlphaSearch:
+		mode.AlphaSearch,
+		mode.FilesGet,
+		mode.FilesContent,
+		mode.BatchesGet,
+		mode.BatchesCancel:
 		return code != http.StatusOK
-	case mode.DoubaoVideoTasksDelete:
+	case mode.DoubaoVideoTasksDelete, mode.FilesDelete:
 		return code != http.StatusOK && code != http.StatusNoContent
 	default:
 		return true
@@ -411,7 +415,11 @@ func processGroupConsume(
 	postGroupConsumer balance.PostGroupConsumer,
 	meta *meta.Meta,
 ) float64 {
-	consumedAmount, err := postGroupConsumer.PostGroupConsume(ctx, meta.Token.Name, amount)
+	consumedAmount, err := postGroupConsumer.PostGroupConsume(
+		balance.WithRequestID(ctx, meta.RequestID),
+		meta.Token.Name,
+		amount,
+	)
 	if err != nil {
 		log.Error("error consuming token remain amount: " + err.Error())
 
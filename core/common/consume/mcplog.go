@@ -0,0 +1,26 @@
+package consume
+
+import (
+	"github.com/labring/aiproxy/core/model"
+	log "github.com/sirupsen/logrus"
+)
+
+// AsyncRecordMCPLog writes the mcp log in the background, Wait waits for the
+// pending writes
+func AsyncRecordMCPLog(mcpLog *model.MCPLog) {
+	consumeWaitGroup.Add(1)
+
+	go func() {
+		defer func() {
+			consumeWaitGroup.Done()
+
+			if r := recover(); r != nil {
+				log.Errorf("panic in record mcp log: %v", r)
+			}
+		}()
+
+		if err := model.RecordMCPLog(mcpLog); err != nil {
+			log.Error("record mcp log failed: " + err.Error())
+		}
+	}()
+}
@@ -91,6 +91,7 @@ func recordSummary(
 		code,
 		meta.Channel.ID,
 		meta.OriginModel,
+		int(meta.Mode),
 		meta.Token.ID,
 		meta.Token.Name,
 		downstreamResult,
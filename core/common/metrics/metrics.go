@@ -0,0 +1,258 @@
+// Package metrics exposes the relay, channel, group and mcp traffic of the
+// proxy in the prometheus format
+package metrics
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "aiproxy"
+
+// Registry holds all the aiproxy metrics, collectors of other packages are
+// registered with MustRegister
+var Registry = prometheus.NewRegistry()
+
+var relayLabels = []string{"mode", "model", "channel", "group"}
+
+// latencyLabels leave out the group of the histograms, every bucket would be
+// repeated for every group
+var latencyLabels = []string{"mode", "model", "channel"}
+
+// latencyBuckets covers fast embeddings up to slow reasoning models, in seconds
+var latencyBuckets = []float64{0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 20, 30, 60, 120, 300}
+
+var (
+	relayRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "relay",
+		Name:      "requests_total",
+		Help:      "Relay requests answered to the client, by response status code.",
+	}, append(relayLabels, "code"))
+
+	relayRequestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "relay",
+		Name:      "request_duration_seconds",
+		Help:      "Time from receiving a relay request to its last attempt finishing.",
+		Buckets:   latencyBuckets,
+	}, latencyLabels)
+
+	relayTokens = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "relay",
+		Name:      "tokens_total",
+		Help:      "Tokens used by relay requests, by token type.",
+	}, append(relayLabels, "type"))
+
+	relayAmount = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "relay",
+		Name:      "amount_total",
+		Help:      "Amount charged for relay requests.",
+	}, relayLabels)
+
+	relayRetries = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "relay",
+		Name:      "retries_total",
+		Help:      "Retries of relay requests on another channel.",
+	}, relayLabels)
+
+	upstreamResponses = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "upstream",
+		Name:      "responses_total",
+		Help:      "Responses of every upstream attempt, by status code.",
+	}, append(relayLabels, "code"))
+
+	upstreamTTFB = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "upstream",
+		Name:      "ttfb_seconds",
+		Help:      "Time until the upstream sends the response header.",
+		Buckets:   latencyBuckets,
+	}, latencyLabels)
+
+	channelBans = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "channel",
+		Name:      "bans_total",
+		Help:      "Times a channel was auto banned for a model.",
+	}, []string{"model", "channel"})
+
+	mcpToolCalls = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "mcp",
+		Name:      "tool_calls_total",
+		Help:      "Tool calls sent to mcp servers, by result code.",
+	}, []string{"mcp_type", "mcp", "group", "code"})
+
+	mcpToolCallDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "mcp",
+		Name:      "tool_call_duration_seconds",
+		Help:      "Time mcp servers take to answer a tool call.",
+		Buckets:   latencyBuckets,
+	}, []string{"mcp_type", "mcp"})
+
+	asyncUsagePending = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: "async_usage",
+		Name:      "pending",
+		Help:      "Async usages waiting to be fetched from the upstream.",
+	})
+
+	redisEnabled = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: "redis",
+		Name:      "enabled",
+		Help:      "Whether redis is configured.",
+	})
+
+	redisUp = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: "redis",
+		Name:      "up",
+		Help:      "Whether the last redis health check succeeded.",
+	})
+)
+
+func init() {
+	Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		relayRequests,
+		relayRequestDuration,
+		relayTokens,
+		relayAmount,
+		relayRetries,
+		upstreamResponses,
+		upstreamTTFB,
+		channelBans,
+		mcpToolCalls,
+		mcpToolCallDuration,
+		asyncUsagePending,
+		redisEnabled,
+		redisUp,
+	)
+}
+
+// MustRegister registers collectors of other packages, e.g. the gauges that are
+// computed on scrape
+func MustRegister(cs ...prometheus.Collector) {
+	Registry.MustRegister(cs...)
+}
+
+// Handler serves the metrics of the registry
+func Handler() http.Handler {
+	return promhttp.HandlerFor(Registry, promhttp.HandlerOpts{})
+}
+
+// RelayLabels identifies the traffic of a relay request
+type RelayLabels struct {
+	Mode    string
+	Model   string
+	Channel int
+	Group   string
+}
+
+func (l RelayLabels) values() []string {
+	return []string{l.Mode, l.Model, strconv.Itoa(l.Channel), l.Group}
+}
+
+func (l RelayLabels) latencyValues() []string {
+	return []string{l.Mode, l.Model, strconv.Itoa(l.Channel)}
+}
+
+// RelayTokens is the token usage of a relay request by token type
+type RelayTokens struct {
+	Input      int64
+	Output     int64
+	Cached     int64
+	CacheWrite int64
+	Reasoning  int64
+}
+
+// ObserveRelayAttempt records an upstream attempt of a relay request, the
+// attempts that were retried on another channel are also counted
+func ObserveRelayAttempt(labels RelayLabels, code int, tokens RelayTokens, amount float64) {
+	values := labels.values()
+
+	upstreamResponses.WithLabelValues(append(values, strconv.Itoa(code))...).Inc()
+
+	addTokens(values, "input", tokens.Input)
+	addTokens(values, "output", tokens.Output)
+	addTokens(values, "cached", tokens.Cached)
+	addTokens(values, "cache_write", tokens.CacheWrite)
+	addTokens(values, "reasoning", tokens.Reasoning)
+
+	if amount > 0 {
+		relayAmount.WithLabelValues(values...).Add(amount)
+	}
+}
+
+func addTokens(values []string, tokenType string, n int64) {
+	if n <= 0 {
+		return
+	}
+
+	relayTokens.WithLabelValues(append(values, tokenType)...).Add(float64(n))
+}
+
+// ObserveRelayRequest records the result answered to the client, labels are
+// those of the last attempt
+func ObserveRelayRequest(labels RelayLabels, code, retries int, duration time.Duration) {
+	values := labels.values()
+
+	relayRequests.WithLabelValues(append(values, strconv.Itoa(code))...).Inc()
+	relayRequestDuration.WithLabelValues(labels.latencyValues()...).Observe(duration.Seconds())
+
+	if retries > 0 {
+		relayRetries.WithLabelValues(values...).Add(float64(retries))
+	}
+}
+
+// ObserveUpstreamTTFB records the time the upstream took to send the response header
+func ObserveUpstreamTTFB(labels RelayLabels, ttfb time.Duration) {
+	upstreamTTFB.WithLabelValues(labels.latencyValues()...).Observe(ttfb.Seconds())
+}
+
+// IncChannelBans records an auto ban of the channel for the model
+func IncChannelBans(model string, channelID int) {
+	channelBans.WithLabelValues(model, strconv.Itoa(channelID)).Inc()
+}
+
+// ObserveMCPToolCall records a tool call sent to a mcp server
+func ObserveMCPToolCall(mcpType, mcpID, group string, code int, duration time.Duration) {
+	mcpToolCalls.WithLabelValues(mcpType, mcpID, group, strconv.Itoa(code)).Inc()
+	mcpToolCallDuration.WithLabelValues(mcpType, mcpID).Observe(duration.Seconds())
+}
+
+// SetAsyncUsagePending sets the size of the async usage queue
+func SetAsyncUsagePending(n int64) {
+	asyncUsagePending.Set(float64(n))
+}
+
+// SetRedisEnabled marks redis as configured
+func SetRedisEnabled(enabled bool) {
+	redisEnabled.Set(boolToFloat(enabled))
+}
+
+// SetRedisUp sets the result of the last redis health check
+func SetRedisUp(up bool) {
+	redisUp.Set(boolToFloat(up))
+}
+
+func boolToFloat(b bool) float64 {
+	if b {
+		return 1
+	}
+
+	return 0
+}
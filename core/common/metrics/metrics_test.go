@@ -0,0 +1,99 @@
+package metrics_test
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/labring/aiproxy/core/common/metrics"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func scrape(t *testing.T) string {
+	t.Helper()
+
+	recorder := httptest.NewRecorder()
+	req := httptest.NewRequestWithContext(
+		context.Background(),
+		http.MethodGet,
+		"/metrics",
+		nil,
+	)
+
+	metrics.Handler().ServeHTTP(recorder, req)
+	require.Equal(t, http.StatusOK, recorder.Code)
+
+	body, err := io.ReadAll(recorder.Body)
+	require.NoError(t, err)
+
+	return string(body)
+}
+
+func TestRelayMetrics(t *testing.T) {
+	labels := metrics.RelayLabels{
+		Mode:    "ChatCompletions",
+		Model:   "metrics-model",
+		Channel: 7,
+		Group:   "metrics-group",
+	}
+
+	metrics.ObserveRelayAttempt(labels, http.StatusTooManyRequests, metrics.RelayTokens{}, 0)
+	metrics.ObserveRelayAttempt(labels, http.StatusOK, metrics.RelayTokens{
+		Input:  10,
+		Output: 5,
+	}, 0.5)
+	metrics.ObserveRelayRequest(labels, http.StatusOK, 1, time.Second)
+	metrics.ObserveUpstreamTTFB(labels, 200*time.Millisecond)
+	metrics.IncChannelBans("metrics-model", 7)
+	metrics.ObserveMCPToolCall("mcp_proxy_sse", "metrics-mcp", "metrics-group", 200, time.Second)
+	metrics.SetAsyncUsagePending(3)
+	metrics.SetRedisUp(true)
+
+	out := scrape(t)
+
+	const relayLabels = `channel="7",group="metrics-group",mode="ChatCompletions",model="metrics-model"`
+
+	assert.Contains(
+		t,
+		out,
+		`aiproxy_relay_requests_total{channel="7",code="200",group="metrics-group",mode="ChatCompletions",model="metrics-model"} 1`,
+	)
+	assert.Contains(t, out, `aiproxy_relay_retries_total{`+relayLabels+`} 1`)
+	assert.Contains(t, out, `aiproxy_relay_amount_total{`+relayLabels+`} 0.5`)
+	assert.Contains(t, out, `aiproxy_relay_tokens_total{`+relayLabels+`,type="input"} 10`)
+	assert.Contains(t, out, `aiproxy_relay_tokens_total{`+relayLabels+`,type="output"} 5`)
+	assert.NotContains(t, out, `type="cached"`)
+	assert.Contains(
+		t,
+		out,
+		`aiproxy_upstream_responses_total{channel="7",code="429",group="metrics-group",mode="ChatCompletions",model="metrics-model"} 1`,
+	)
+	// the histograms are not split by group
+	assert.Contains(
+		t,
+		out,
+		`aiproxy_upstream_ttfb_seconds_count{channel="7",mode="ChatCompletions",model="metrics-model"} 1`,
+	)
+	assert.Contains(
+		t,
+		out,
+		`aiproxy_relay_request_duration_seconds_count{channel="7",mode="ChatCompletions",model="metrics-model"} 1`,
+	)
+	assert.Contains(
+		t,
+		out,
+		`aiproxy_mcp_tool_call_duration_seconds_count{mcp="metrics-mcp",mcp_type="mcp_proxy_sse"} 1`,
+	)
+	assert.Contains(t, out, `aiproxy_channel_bans_total{channel="7",model="metrics-model"} 1`)
+	assert.Contains(
+		t,
+		out,
+		`aiproxy_mcp_tool_calls_total{code="200",group="metrics-group",mcp="metrics-mcp",mcp_type="mcp_proxy_sse"} 1`,
+	)
+	assert.Contains(t, out, "aiproxy_async_usage_pending 3")
+	assert.Contains(t, out, "aiproxy_redis_up 1")
+}
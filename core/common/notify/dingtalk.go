@@ -0,0 +1,121 @@
+package notify
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/bytedance/sonic"
+)
+
+// DingTalkSender posts notifications as markdown to a DingTalk robot webhook
+// The secret is the signing secret of the robot, it is optional when the
+// robot uses keywords or ip allow list
+type DingTalkSender struct {
+	wh     string
+	secret string
+}
+
+func NewDingTalkSender(wh, secret string) *DingTalkSender {
+	return &DingTalkSender{
+		wh:     wh,
+		secret: secret,
+	}
+}
+
+type DingTalkMessage struct {
+	MsgType  string           `json:"msgtype"`
+	Markdown DingTalkMarkdown `json:"markdown"`
+}
+
+type DingTalkMarkdown struct {
+	Title string `json:"title"`
+	Text  string `json:"text"`
+}
+
+// RobotResp is the response of the DingTalk and WeCom robot webhooks
+type RobotResp struct {
+	ErrCode int    `json:"errcode"`
+	ErrMsg  string `json:"errmsg"`
+}
+
+// DingTalkSign returns the sign of the robot webhook at the unix millisecond
+// timestamp
+func DingTalkSign(secret string, timestamp int64) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10) + "\n" + secret))
+
+	return base64.StdEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func (d *DingTalkSender) Name() string {
+	return "dingtalk"
+}
+
+func (d *DingTalkSender) webhookURL() (string, error) {
+	if d.secret == "" {
+		return d.wh, nil
+	}
+
+	u, err := url.Parse(d.wh)
+	if err != nil {
+		return "", err
+	}
+
+	timestamp := time.Now().UnixMilli()
+
+	query := u.Query()
+	query.Set("timestamp", strconv.FormatInt(timestamp, 10))
+	query.Set("sign", DingTalkSign(d.secret, timestamp))
+	u.RawQuery = query.Encode()
+
+	return u.String(), nil
+}
+
+func (d *DingTalkSender) Send(ctx context.Context, level Level, title, message string) error {
+	if d.wh == "" {
+		return errors.New("dingtalk webhook url is empty")
+	}
+
+	wh, err := d.webhookURL()
+	if err != nil {
+		return err
+	}
+
+	body, err := sonic.Marshal(DingTalkMessage{
+		MsgType: "markdown",
+		Markdown: DingTalkMarkdown{
+			Title: title,
+			Text:  fmt.Sprintf("### [%s] %s\n\n%s", level, title, withNote(message)),
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	respBody, err := postJSON(ctx, wh, body, nil)
+	if err != nil {
+		return err
+	}
+
+	return checkRobotResp(respBody)
+}
+
+func checkRobotResp(body []byte) error {
+	var resp RobotResp
+	if err := sonic.Unmarshal(body, &resp); err != nil {
+		return err
+	}
+
+	if resp.ErrCode != 0 {
+		return fmt.Errorf("errcode: %d, errmsg: %s", resp.ErrCode, resp.ErrMsg)
+	}
+
+	return nil
+}
@@ -0,0 +1,160 @@
+package notify
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"mime"
+	"net"
+	"net/smtp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// smtpsPort is the port of smtp over implicit tls, other ports upgrade the
+// connection with STARTTLS when the server supports it
+const smtpsPort = 465
+
+type EmailConfig struct {
+	Host     string
+	Port     int
+	Username string
+	Password string
+	From     string
+	To       []string
+}
+
+// EmailSender sends notifications as plain text mails over smtp
+type EmailSender struct {
+	config EmailConfig
+}
+
+func NewEmailSender(config EmailConfig) *EmailSender {
+	if config.Port == 0 {
+		config.Port = 587
+	}
+
+	if config.From == "" {
+		config.From = config.Username
+	}
+
+	return &EmailSender{
+		config: config,
+	}
+}
+
+func (e *EmailSender) Name() string {
+	return "email"
+}
+
+// BuildEmailMessage builds the mail with the headers and the body
+func BuildEmailMessage(from string, to []string, subject, body string, date time.Time) []byte {
+	var msg strings.Builder
+
+	msg.WriteString("From: " + from + "\r\n")
+	msg.WriteString("To: " + strings.Join(to, ", ") + "\r\n")
+	msg.WriteString("Subject: " + mime.QEncoding.Encode("utf-8", subject) + "\r\n")
+	msg.WriteString("Date: " + date.Format(time.RFC1123Z) + "\r\n")
+	msg.WriteString("MIME-Version: 1.0\r\n")
+	msg.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	msg.WriteString("Content-Transfer-Encoding: 8bit\r\n")
+	msg.WriteString("\r\n")
+	msg.WriteString(strings.ReplaceAll(body, "\n", "\r\n"))
+	msg.WriteString("\r\n")
+
+	return []byte(msg.String())
+}
+
+func (e *EmailSender) dial(ctx context.Context) (*smtp.Client, error) {
+	addr := net.JoinHostPort(e.config.Host, strconv.Itoa(e.config.Port))
+	tlsConfig := &tls.Config{ServerName: e.config.Host, MinVersion: tls.VersionTLS12}
+
+	var dialer net.Dialer
+
+	conn, err := dialer.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = conn.SetDeadline(deadline)
+	}
+
+	if e.config.Port == smtpsPort {
+		conn = tls.Client(conn, tlsConfig)
+	}
+
+	client, err := smtp.NewClient(conn, e.config.Host)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	if e.config.Port != smtpsPort {
+		if ok, _ := client.Extension("STARTTLS"); ok {
+			if err := client.StartTLS(tlsConfig); err != nil {
+				client.Close()
+				return nil, err
+			}
+		}
+	}
+
+	return client, nil
+}
+
+func (e *EmailSender) Send(ctx context.Context, level Level, title, message string) error {
+	if e.config.Host == "" {
+		return errors.New("smtp host is empty")
+	}
+
+	if len(e.config.To) == 0 {
+		return errors.New("email recipients are empty")
+	}
+
+	client, err := e.dial(ctx)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	if e.config.Username != "" {
+		auth := smtp.PlainAuth("", e.config.Username, e.config.Password, e.config.Host)
+		if err := client.Auth(auth); err != nil {
+			return err
+		}
+	}
+
+	if err := client.Mail(e.config.From); err != nil {
+		return err
+	}
+
+	for _, to := range e.config.To {
+		if err := client.Rcpt(to); err != nil {
+			return fmt.Errorf("rcpt %s: %w", to, err)
+		}
+	}
+
+	w, err := client.Data()
+	if err != nil {
+		return err
+	}
+
+	msg := BuildEmailMessage(
+		e.config.From,
+		e.config.To,
+		fmt.Sprintf("[%s] %s", level, title),
+		withNote(message),
+		time.Now(),
+	)
+	if _, err := w.Write(msg); err != nil {
+		return err
+	}
+
+	if err := w.Close(); err != nil {
+		return err
+	}
+
+	return client.Quit()
+}
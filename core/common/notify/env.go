@@ -0,0 +1,96 @@
+package notify
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/labring/aiproxy/core/common/env"
+)
+
+func splitComma(s string) []string {
+	var result []string
+
+	for part := range strings.SplitSeq(s, ",") {
+		if part = strings.TrimSpace(part); part != "" {
+			result = append(result, part)
+		}
+	}
+
+	return result
+}
+
+func routeFromEnv(sender Sender, levelsEnv string) (Route, error) {
+	levels, err := ParseLevels(os.Getenv(levelsEnv))
+	if err != nil {
+		return Route{}, fmt.Errorf("%s: %w", levelsEnv, err)
+	}
+
+	return Route{Sender: sender, Levels: levels}, nil
+}
+
+// RoutesFromEnv returns the routes of the sinks configured by the environment
+// variables, every sink receives all levels unless its NOTIFY_*_LEVELS is set
+// to a comma separated list of info, warn and error
+// An invalid NOTIFY_*_LEVELS value is an error and no route is returned:
+//   - NOTIFY_FEISHU_WEBHOOK
+//   - NOTIFY_WEBHOOK_URL, NOTIFY_WEBHOOK_SECRET
+//   - NOTIFY_SLACK_WEBHOOK
+//   - NOTIFY_DINGTALK_WEBHOOK, NOTIFY_DINGTALK_SECRET
+//   - NOTIFY_WECOM_WEBHOOK
+//   - NOTIFY_EMAIL_SMTP_HOST, NOTIFY_EMAIL_SMTP_PORT, NOTIFY_EMAIL_USERNAME,
+//     NOTIFY_EMAIL_PASSWORD, NOTIFY_EMAIL_FROM, NOTIFY_EMAIL_TO
+func RoutesFromEnv() ([]Route, error) {
+	var (
+		routes []Route
+		errs   []error
+	)
+
+	add := func(sender Sender, levelsEnv string) {
+		route, err := routeFromEnv(sender, levelsEnv)
+		if err != nil {
+			errs = append(errs, err)
+			return
+		}
+
+		routes = append(routes, route)
+	}
+
+	if wh := os.Getenv("NOTIFY_FEISHU_WEBHOOK"); wh != "" {
+		add(NewFeishuSender(wh), "NOTIFY_FEISHU_LEVELS")
+	}
+
+	if url := os.Getenv("NOTIFY_WEBHOOK_URL"); url != "" {
+		add(NewWebhookSender(url, os.Getenv("NOTIFY_WEBHOOK_SECRET")), "NOTIFY_WEBHOOK_LEVELS")
+	}
+
+	if wh := os.Getenv("NOTIFY_SLACK_WEBHOOK"); wh != "" {
+		add(NewSlackSender(wh), "NOTIFY_SLACK_LEVELS")
+	}
+
+	if wh := os.Getenv("NOTIFY_DINGTALK_WEBHOOK"); wh != "" {
+		add(NewDingTalkSender(wh, os.Getenv("NOTIFY_DINGTALK_SECRET")), "NOTIFY_DINGTALK_LEVELS")
+	}
+
+	if wh := os.Getenv("NOTIFY_WECOM_WEBHOOK"); wh != "" {
+		add(NewWeComSender(wh), "NOTIFY_WECOM_LEVELS")
+	}
+
+	if host := os.Getenv("NOTIFY_EMAIL_SMTP_HOST"); host != "" {
+		add(NewEmailSender(EmailConfig{
+			Host:     host,
+			Port:     int(env.Int64("NOTIFY_EMAIL_SMTP_PORT", 0)),
+			Username: os.Getenv("NOTIFY_EMAIL_USERNAME"),
+			Password: os.Getenv("NOTIFY_EMAIL_PASSWORD"),
+			From:     os.Getenv("NOTIFY_EMAIL_FROM"),
+			To:       splitComma(os.Getenv("NOTIFY_EMAIL_TO")),
+		}), "NOTIFY_EMAIL_LEVELS")
+	}
+
+	if len(errs) > 0 {
+		return nil, errors.Join(errs...)
+	}
+
+	return routes, nil
+}
@@ -5,17 +5,22 @@ import (
 	"context"
 	"errors"
 	"net/http"
-	"time"
 
 	"github.com/bytedance/sonic"
 	"github.com/labring/aiproxy/core/common/config"
-	"github.com/labring/aiproxy/core/common/trylock"
 )
 
-type FeishuNotifier struct {
+// FeishuSender posts notifications as cards to a Feishu bot webhook
+type FeishuSender struct {
 	wh string
 }
 
+func NewFeishuSender(wh string) *FeishuSender {
+	return &FeishuSender{
+		wh: wh,
+	}
+}
+
 func level2Color(level Level) string {
 	switch level {
 	case LevelInfo:
@@ -29,33 +34,16 @@ func level2Color(level Level) string {
 	}
 }
 
-func (f *FeishuNotifier) Notify(level Level, title, message string) {
-	stdNotifier.Notify(level, title, message)
-
-	go func() {
-		_ = PostToFeiShuv2(context.Background(), level2Color(level), title, message, f.wh)
-	}()
+func (f *FeishuSender) Name() string {
+	return "feishu"
 }
 
-func (f *FeishuNotifier) NotifyThrottle(
-	level Level,
-	key string,
-	expiration time.Duration,
-	title, message string,
-) {
-	if trylock.Lock(key, expiration) {
-		stdNotifier.Notify(level, title, message)
-
-		go func() {
-			_ = PostToFeiShuv2(context.Background(), level2Color(level), title, message, f.wh)
-		}()
-	}
+func (f *FeishuSender) Send(ctx context.Context, level Level, title, message string) error {
+	return PostToFeiShuv2(ctx, level2Color(level), title, message, f.wh)
 }
 
 func NewFeishuNotify(wh string) Notifier {
-	return &FeishuNotifier{
-		wh: wh,
-	}
+	return NewRouteNotifier(Route{Sender: NewFeishuSender(wh)})
 }
 
 type FSMessagev2 struct {
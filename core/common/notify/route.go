@@ -0,0 +1,93 @@
+package notify
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/labring/aiproxy/core/common/trylock"
+	log "github.com/sirupsen/logrus"
+)
+
+const sendTimeout = 30 * time.Second
+
+// Sender delivers a notification to a sink, such as a webhook or a mailbox
+type Sender interface {
+	Name() string
+	Send(ctx context.Context, level Level, title, message string) error
+}
+
+// Route sends the notifications at its levels to the sender, all levels are
+// sent when Levels is empty
+type Route struct {
+	Sender Sender
+	Levels []Level
+}
+
+func (r *Route) Match(level Level) bool {
+	return len(r.Levels) == 0 || slices.Contains(r.Levels, level)
+}
+
+// RouteNotifier logs every notification and sends it to the matching routes
+type RouteNotifier struct {
+	routes []Route
+}
+
+func NewRouteNotifier(routes ...Route) *RouteNotifier {
+	return &RouteNotifier{
+		routes: routes,
+	}
+}
+
+func (r *RouteNotifier) Notify(level Level, title, message string) {
+	stdNotifier.Notify(level, title, message)
+
+	for _, route := range r.routes {
+		if !route.Match(level) {
+			continue
+		}
+
+		go func() {
+			ctx, cancel := context.WithTimeout(context.Background(), sendTimeout)
+			defer cancel()
+
+			if err := route.Sender.Send(ctx, level, title, message); err != nil {
+				log.Errorf("notify %s failed: %v", route.Sender.Name(), err)
+			}
+		}()
+	}
+}
+
+// NotifyThrottle takes the lock once for all routes, so a throttled
+// notification reaches every sink or none
+func (r *RouteNotifier) NotifyThrottle(
+	level Level,
+	key string,
+	expiration time.Duration,
+	title, message string,
+) {
+	if trylock.Lock(key, expiration) {
+		r.Notify(level, title, message)
+	}
+}
+
+// ParseLevels parses a comma separated list of levels
+func ParseLevels(s string) ([]Level, error) {
+	var levels []Level
+
+	for part := range strings.SplitSeq(s, ",") {
+		level := Level(strings.ToLower(strings.TrimSpace(part)))
+		switch level {
+		case "":
+			continue
+		case LevelInfo, LevelWarn, LevelError:
+			levels = append(levels, level)
+		default:
+			return nil, fmt.Errorf("unknown notify level: %s", level)
+		}
+	}
+
+	return levels, nil
+}
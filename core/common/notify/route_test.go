@@ -0,0 +1,206 @@
+package notify_test
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bytedance/sonic"
+	"github.com/labring/aiproxy/core/common/notify"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeSender struct {
+	sent chan string
+}
+
+func (f *fakeSender) Name() string {
+	return "fake"
+}
+
+func (f *fakeSender) Send(_ context.Context, level notify.Level, title, _ string) error {
+	f.sent <- string(level) + ":" + title
+	return nil
+}
+
+func TestRouteNotifier(t *testing.T) {
+	all := &fakeSender{sent: make(chan string, 10)}
+	errorsOnly := &fakeSender{sent: make(chan string, 10)}
+
+	n := notify.NewRouteNotifier(
+		notify.Route{Sender: all},
+		notify.Route{Sender: errorsOnly, Levels: []notify.Level{notify.LevelError}},
+	)
+
+	n.Notify(notify.LevelWarn, "warn title", "message")
+	n.Notify(notify.LevelError, "error title", "message")
+
+	received := []string{<-all.sent, <-all.sent}
+	assert.ElementsMatch(t, []string{"warn:warn title", "error:error title"}, received)
+	assert.Equal(t, "error:error title", <-errorsOnly.sent)
+
+	select {
+	case got := <-errorsOnly.sent:
+		t.Fatalf("unexpected notification: %s", got)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestParseLevels(t *testing.T) {
+	levels, err := notify.ParseLevels(" Warn, error,")
+	require.NoError(t, err)
+	assert.Equal(t, []notify.Level{notify.LevelWarn, notify.LevelError}, levels)
+
+	levels, err = notify.ParseLevels("")
+	require.NoError(t, err)
+	assert.Empty(t, levels)
+
+	_, err = notify.ParseLevels("fatal")
+	require.Error(t, err)
+}
+
+func TestRoutesFromEnv(t *testing.T) {
+	t.Setenv("NOTIFY_SLACK_WEBHOOK", "https://hooks.slack.com/services/x")
+	t.Setenv("NOTIFY_SLACK_LEVELS", "error")
+	t.Setenv("NOTIFY_WECOM_WEBHOOK", "https://qyapi.weixin.qq.com/x")
+	t.Setenv("NOTIFY_DINGTALK_WEBHOOK", "https://oapi.dingtalk.com/robot/send")
+	t.Setenv("NOTIFY_DINGTALK_LEVELS", "critical")
+
+	routes, err := notify.RoutesFromEnv()
+	require.ErrorContains(t, err, "NOTIFY_DINGTALK_LEVELS")
+	assert.Empty(t, routes)
+
+	t.Setenv("NOTIFY_DINGTALK_LEVELS", "warn")
+
+	routes, err = notify.RoutesFromEnv()
+	require.NoError(t, err)
+	require.Len(t, routes, 3)
+	assert.Equal(t, "slack", routes[0].Sender.Name())
+	assert.Equal(t, []notify.Level{notify.LevelError}, routes[0].Levels)
+	assert.Equal(t, "dingtalk", routes[1].Sender.Name())
+	assert.False(t, routes[1].Match(notify.LevelInfo))
+	assert.Equal(t, "wecom", routes[2].Sender.Name())
+	assert.True(t, routes[2].Match(notify.LevelInfo))
+}
+
+func TestWebhookSender(t *testing.T) {
+	var (
+		payload notify.WebhookPayload
+		body    []byte
+		header  http.Header
+	)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ = io.ReadAll(r.Body)
+		header = r.Header.Clone()
+		_ = sonic.Unmarshal(body, &payload)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	err := notify.NewWebhookSender(server.URL, "secret").
+		Send(t.Context(), notify.LevelWarn, "title", "message")
+	require.NoError(t, err)
+
+	assert.Equal(t, notify.LevelWarn, payload.Level)
+	assert.Equal(t, "title", payload.Title)
+	assert.Equal(t, "message", payload.Message)
+
+	timestamp, err := strconv.ParseInt(header.Get(notify.WebhookTimestampHeader), 10, 64)
+	require.NoError(t, err)
+	assert.Equal(t, payload.Timestamp, timestamp)
+	assert.Equal(
+		t,
+		notify.WebhookSignature("secret", timestamp, body),
+		header.Get(notify.WebhookSignatureHeader),
+	)
+
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer failing.Close()
+
+	err = notify.NewWebhookSender(failing.URL, "").
+		Send(t.Context(), notify.LevelInfo, "title", "message")
+	require.ErrorContains(t, err, "500")
+}
+
+func TestSlackSender(t *testing.T) {
+	var message notify.SlackMessage
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = sonic.ConfigDefault.NewDecoder(r.Body).Decode(&message)
+		_, _ = w.Write([]byte("ok"))
+	}))
+	defer server.Close()
+
+	err := notify.NewSlackSender(server.URL).
+		Send(t.Context(), notify.LevelError, "title", "message")
+	require.NoError(t, err)
+	require.Len(t, message.Attachments, 1)
+	assert.Equal(t, notify.SlackColorDanger, message.Attachments[0].Color)
+	assert.Equal(t, "message", message.Attachments[0].Text)
+}
+
+func TestDingTalkSender(t *testing.T) {
+	var (
+		message notify.DingTalkMessage
+		query   map[string]string
+	)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query = map[string]string{
+			"access_token": r.URL.Query().Get("access_token"),
+			"timestamp":    r.URL.Query().Get("timestamp"),
+			"sign":         r.URL.Query().Get("sign"),
+		}
+		_ = sonic.ConfigDefault.NewDecoder(r.Body).Decode(&message)
+		_, _ = w.Write([]byte(`{"errcode":0,"errmsg":"ok"}`))
+	}))
+	defer server.Close()
+
+	err := notify.NewDingTalkSender(server.URL+"?access_token=abc", "SEC123").
+		Send(t.Context(), notify.LevelWarn, "title", "message")
+	require.NoError(t, err)
+
+	assert.Equal(t, "abc", query["access_token"])
+
+	timestamp, err := strconv.ParseInt(query["timestamp"], 10, 64)
+	require.NoError(t, err)
+	assert.Equal(t, notify.DingTalkSign("SEC123", timestamp), query["sign"])
+
+	assert.Equal(t, "markdown", message.MsgType)
+	assert.True(t, strings.HasPrefix(message.Markdown.Text, "### [warn] title"))
+}
+
+func TestWeComSender(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = w.Write([]byte(`{"errcode":93000,"errmsg":"invalid webhook url"}`))
+	}))
+	defer server.Close()
+
+	err := notify.NewWeComSender(server.URL).
+		Send(t.Context(), notify.LevelInfo, "title", "message")
+	require.ErrorContains(t, err, "93000")
+}
+
+func TestBuildEmailMessage(t *testing.T) {
+	msg := string(notify.BuildEmailMessage(
+		"aiproxy@example.com",
+		[]string{"a@example.com", "b@example.com"},
+		"[error] 数据库错误",
+		"line1\nline2",
+		time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC),
+	))
+
+	assert.Contains(t, msg, "To: a@example.com, b@example.com\r\n")
+	assert.Contains(t, msg, "Subject: =?utf-8?q?")
+	assert.Contains(t, msg, "Date: Fri, 02 Jan 2026 03:04:05 +0000\r\n")
+	assert.True(t, strings.HasSuffix(msg, "\r\n\r\nline1\r\nline2\r\n"))
+}
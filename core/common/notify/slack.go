@@ -0,0 +1,79 @@
+package notify
+
+import (
+	"context"
+	"errors"
+
+	"github.com/bytedance/sonic"
+	"github.com/labring/aiproxy/core/common/config"
+)
+
+const (
+	SlackColorGood    = "good"
+	SlackColorWarning = "warning"
+	SlackColorDanger  = "danger"
+)
+
+// SlackSender posts notifications to a Slack incoming webhook
+type SlackSender struct {
+	wh string
+}
+
+func NewSlackSender(wh string) *SlackSender {
+	return &SlackSender{
+		wh: wh,
+	}
+}
+
+type SlackMessage struct {
+	Text        string            `json:"text"`
+	Attachments []SlackAttachment `json:"attachments,omitempty"`
+}
+
+type SlackAttachment struct {
+	Color  string `json:"color"`
+	Title  string `json:"title"`
+	Text   string `json:"text"`
+	Footer string `json:"footer,omitempty"`
+}
+
+func level2SlackColor(level Level) string {
+	switch level {
+	case LevelError:
+		return SlackColorDanger
+	case LevelWarn:
+		return SlackColorWarning
+	default:
+		return SlackColorGood
+	}
+}
+
+func (s *SlackSender) Name() string {
+	return "slack"
+}
+
+func (s *SlackSender) Send(ctx context.Context, level Level, title, message string) error {
+	if s.wh == "" {
+		return errors.New("slack webhook url is empty")
+	}
+
+	body, err := sonic.Marshal(SlackMessage{
+		// text is the fallback shown in the push notification
+		Text: title,
+		Attachments: []SlackAttachment{
+			{
+				Color:  level2SlackColor(level),
+				Title:  title,
+				Text:   message,
+				Footer: config.GetNotifyNote(),
+			},
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = postJSON(ctx, s.wh, body, nil)
+
+	return err
+}
@@ -0,0 +1,133 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/bytedance/sonic"
+	"github.com/labring/aiproxy/core/common/config"
+)
+
+const (
+	WebhookTimestampHeader = "X-Aiproxy-Timestamp"
+	WebhookSignatureHeader = "X-Aiproxy-Signature"
+)
+
+// WebhookPayload is the json body posted by WebhookSender
+type WebhookPayload struct {
+	Level     Level  `json:"level"`
+	Title     string `json:"title"`
+	Message   string `json:"message"`
+	Note      string `json:"note,omitempty"`
+	Timestamp int64  `json:"timestamp"`
+}
+
+// WebhookSender posts a json payload to any http endpoint
+// When a secret is set, the request is signed with
+// hex(hmac_sha256(secret, timestamp + "." + body)) in the X-Aiproxy-Signature
+// header, the unix timestamp is in the X-Aiproxy-Timestamp header
+type WebhookSender struct {
+	url    string
+	secret string
+}
+
+func NewWebhookSender(url, secret string) *WebhookSender {
+	return &WebhookSender{
+		url:    url,
+		secret: secret,
+	}
+}
+
+func (w *WebhookSender) Name() string {
+	return "webhook"
+}
+
+// WebhookSignature returns the signature of the body at the unix timestamp
+func WebhookSignature(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10)))
+	mac.Write([]byte("."))
+	mac.Write(body)
+
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+func (w *WebhookSender) Send(ctx context.Context, level Level, title, message string) error {
+	if w.url == "" {
+		return errors.New("webhook url is empty")
+	}
+
+	timestamp := time.Now().Unix()
+
+	body, err := sonic.Marshal(WebhookPayload{
+		Level:     level,
+		Title:     title,
+		Message:   message,
+		Note:      config.GetNotifyNote(),
+		Timestamp: timestamp,
+	})
+	if err != nil {
+		return err
+	}
+
+	header := http.Header{}
+	if w.secret != "" {
+		header.Set(WebhookTimestampHeader, strconv.FormatInt(timestamp, 10))
+		header.Set(WebhookSignatureHeader, WebhookSignature(w.secret, timestamp, body))
+	}
+
+	_, err = postJSON(ctx, w.url, body, header)
+
+	return err
+}
+
+// postJSON posts the json body and returns the response body, a non 2xx
+// status is an error
+func postJSON(ctx context.Context, url string, body []byte, header http.Header) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+
+	for key, values := range header {
+		req.Header[key] = values
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode < http.StatusOK || resp.StatusCode >= http.StatusMultipleChoices {
+		return nil, fmt.Errorf("status code: %d, body: %s", resp.StatusCode, respBody)
+	}
+
+	return respBody, nil
+}
+
+// withNote appends the notify note to the message
+func withNote(message string) string {
+	note := config.GetNotifyNote()
+	if note == "" {
+		return message
+	}
+
+	return message + "\n\n" + note
+}
@@ -0,0 +1,73 @@
+package notify
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/bytedance/sonic"
+)
+
+// WeComSender posts notifications as markdown to a WeCom group robot webhook
+type WeComSender struct {
+	wh string
+}
+
+func NewWeComSender(wh string) *WeComSender {
+	return &WeComSender{
+		wh: wh,
+	}
+}
+
+type WeComMessage struct {
+	MsgType  string        `json:"msgtype"`
+	Markdown WeComMarkdown `json:"markdown"`
+}
+
+type WeComMarkdown struct {
+	Content string `json:"content"`
+}
+
+func level2WeComColor(level Level) string {
+	switch level {
+	case LevelError:
+		return "warning"
+	case LevelWarn:
+		return "comment"
+	default:
+		return "info"
+	}
+}
+
+func (w *WeComSender) Name() string {
+	return "wecom"
+}
+
+func (w *WeComSender) Send(ctx context.Context, level Level, title, message string) error {
+	if w.wh == "" {
+		return errors.New("wecom webhook url is empty")
+	}
+
+	body, err := sonic.Marshal(WeComMessage{
+		MsgType: "markdown",
+		Markdown: WeComMarkdown{
+			Content: fmt.Sprintf(
+				"**<font color=\"%s\">[%s] %s</font>**\n%s",
+				level2WeComColor(level),
+				level,
+				title,
+				withNote(message),
+			),
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	respBody, err := postJSON(ctx, w.wh, body, nil)
+	if err != nil {
+		return err
+	}
+
+	return checkRobotResp(respBody)
+}
@@ -7,6 +7,7 @@ import (
 
 	"github.com/labring/aiproxy/core/common"
 	"github.com/labring/aiproxy/core/common/config"
+	"github.com/labring/aiproxy/core/common/notify"
 	log "github.com/sirupsen/logrus"
 )
 
@@ -28,6 +29,7 @@ func dbConnectionKey(source string) string {
 // AlertDBError triggers an oncall alert for database connection errors
 // Call this when a database operation fails with a connection error
 // Each source has its own error tracking, but phone calls are globally throttled
+// The error is also sent to the notifier at error level
 func AlertDBError(source string, err error) {
 	isConnErr := common.IsDBConnectionError(err)
 	log.Debugf(
@@ -41,6 +43,13 @@ func AlertDBError(source string, err error) {
 		return
 	}
 
+	notify.ErrorThrottle(
+		dbConnectionKey(source),
+		DBErrorPersistDuration,
+		"Database Connection Error",
+		source+": "+err.Error(),
+	)
+
 	Alert(
 		dbConnectionKey(source),
 		DBErrorPersistDuration,
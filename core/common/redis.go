@@ -7,6 +7,7 @@ import (
 	"time"
 
 	"github.com/labring/aiproxy/core/common/config"
+	"github.com/labring/aiproxy/core/common/metrics"
 	"github.com/redis/go-redis/v9"
 	log "github.com/sirupsen/logrus"
 )
@@ -66,10 +67,14 @@ func InitRedisClient() (err error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
+	metrics.SetRedisEnabled(true)
+
 	_, err = RDB.Ping(ctx).Result()
 	if err != nil {
 		log.Errorf("failed to ping redis: %s", err.Error())
 	}
 
+	metrics.SetRedisUp(err == nil)
+
 	return nil
 }
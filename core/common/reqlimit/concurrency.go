@@ -0,0 +1,272 @@
+package reqlimit
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/labring/aiproxy/core/common"
+	"github.com/redis/go-redis/v9"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// concurrencyLease is how long an in-flight slot is held in redis when it is
+	// never released, e.g. the instance serving the request crashed
+	concurrencyLease = time.Minute
+	// concurrencyRenewInterval is how often the lease of a request that is still in
+	// flight is extended, so long requests keep their slot
+	concurrencyRenewInterval = concurrencyLease / 3
+)
+
+type InMemoryConcurrency struct {
+	mu       sync.Mutex
+	inflight map[string]int64
+}
+
+func NewInMemoryConcurrency() *InMemoryConcurrency {
+	return &InMemoryConcurrency{
+		inflight: make(map[string]int64),
+	}
+}
+
+// Acquire takes a slot unless max slots are already taken, max 0 means
+// unlimited, it returns the slots taken after the call
+func (m *InMemoryConcurrency) Acquire(maxInflight int64, keys ...string) (int64, bool) {
+	key := strings.Join(keys, ":")
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	count := m.inflight[key]
+	if maxInflight > 0 && count >= maxInflight {
+		return count, false
+	}
+
+	m.inflight[key] = count + 1
+
+	return count + 1, true
+}
+
+func (m *InMemoryConcurrency) Release(keys ...string) {
+	key := strings.Join(keys, ":")
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	count := m.inflight[key] - 1
+	if count <= 0 {
+		delete(m.inflight, key)
+		return
+	}
+
+	m.inflight[key] = count
+}
+
+const acquireConcurrencyLuaScript = `
+local key = KEYS[1]
+local max_inflight = tonumber(ARGV[1])
+local lease = tonumber(ARGV[2])
+local member = ARGV[3]
+local now = redis.call('TIME')
+local now_ms = tonumber(now[1]) * 1000 + math.floor(tonumber(now[2]) / 1000)
+
+redis.call('ZREMRANGEBYSCORE', key, '-inf', now_ms)
+local count = redis.call('ZCARD', key)
+if max_inflight > 0 and count >= max_inflight then
+    return string.format("%d:0", count)
+end
+
+redis.call('ZADD', key, now_ms + lease, member)
+redis.call('PEXPIRE', key, lease)
+return string.format("%d:1", count + 1)
+`
+
+var acquireConcurrencyScript = redis.NewScript(acquireConcurrencyLuaScript)
+
+const renewConcurrencyLuaScript = `
+local key = KEYS[1]
+local lease = tonumber(ARGV[1])
+local member = ARGV[2]
+
+if not redis.call('ZSCORE', key, member) then
+    return 0
+end
+
+local now = redis.call('TIME')
+local now_ms = tonumber(now[1]) * 1000 + math.floor(tonumber(now[2]) / 1000)
+
+redis.call('ZADD', key, now_ms + lease, member)
+redis.call('PEXPIRE', key, lease)
+return 1
+`
+
+var renewConcurrencyScript = redis.NewScript(renewConcurrencyLuaScript)
+
+// redisConcurrency keeps a lease of every in-flight request in a sorted set
+// scored by the lease expiration, so slots of lost requests are freed
+type redisConcurrency struct {
+	prefix string
+	getRDB func() *redis.Client
+}
+
+func newRedisConcurrency(prefix string, getRDB func() *redis.Client) *redisConcurrency {
+	return &redisConcurrency{
+		prefix: prefix,
+		getRDB: getRDB,
+	}
+}
+
+func (r *redisConcurrency) buildKey(keys ...string) string {
+	return common.RedisKey(r.prefix + ":" + strings.Join(keys, ":"))
+}
+
+func (r *redisConcurrency) Acquire(
+	ctx context.Context,
+	maxInflight int64,
+	member string,
+	keys ...string,
+) (int64, bool, error) {
+	rdb := r.getRDB()
+	if rdb == nil {
+		return 0, false, errors.New("redis client is nil")
+	}
+
+	result, err := acquireConcurrencyScript.Run(
+		ctx,
+		rdb,
+		[]string{r.buildKey(keys...)},
+		maxInflight,
+		concurrencyLease.Milliseconds(),
+		member,
+	).Text()
+	if err != nil {
+		return 0, false, err
+	}
+
+	countStr, acquired, ok := strings.Cut(result, ":")
+	if !ok {
+		return 0, false, errors.New("invalid result")
+	}
+
+	count, err := strconv.ParseInt(countStr, 10, 64)
+	if err != nil {
+		return 0, false, err
+	}
+
+	return count, acquired == "1", nil
+}
+
+// Renew extends the lease of a slot that is still held, it reports false when the
+// slot has already expired
+func (r *redisConcurrency) Renew(ctx context.Context, member string, keys ...string) (bool, error) {
+	rdb := r.getRDB()
+	if rdb == nil {
+		return false, errors.New("redis client is nil")
+	}
+
+	renewed, err := renewConcurrencyScript.Run(
+		ctx,
+		rdb,
+		[]string{r.buildKey(keys...)},
+		concurrencyLease.Milliseconds(),
+		member,
+	).Int()
+	if err != nil {
+		return false, err
+	}
+
+	return renewed == 1, nil
+}
+
+// keepAlive renews the lease of the slot until stop is closed
+func (r *redisConcurrency) keepAlive(stop <-chan struct{}, member string, keys ...string) {
+	ticker := time.NewTicker(concurrencyRenewInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			renewed, err := r.Renew(ctx, member, keys...)
+
+			cancel()
+
+			if err != nil {
+				log.Error("redis renew concurrency error: " + err.Error())
+				continue
+			}
+
+			if !renewed {
+				return
+			}
+		}
+	}
+}
+
+func (r *redisConcurrency) Release(ctx context.Context, member string, keys ...string) error {
+	rdb := r.getRDB()
+	if rdb == nil {
+		return errors.New("redis client is nil")
+	}
+
+	return rdb.ZRem(ctx, r.buildKey(keys...), member).Err()
+}
+
+var (
+	memoryTokenConcurrency = NewInMemoryConcurrency()
+	redisTokenConcurrency  = newRedisConcurrency(
+		"token-concurrency",
+		func() *redis.Client { return common.RDB },
+	)
+)
+
+// AcquireTokenConcurrency takes an in-flight slot of the token, it returns the
+// slots taken and false when the token already has maxConcurrency requests in
+// flight, the slot is kept alive until release is called once the acquired
+// request finishes
+func AcquireTokenConcurrency(
+	ctx context.Context,
+	tokenID int,
+	maxConcurrency int64,
+) (inflight int64, ok bool, release func()) {
+	id := strconv.Itoa(tokenID)
+
+	if common.RedisEnabled {
+		member := common.ShortUUID()
+
+		inflight, ok, err := redisTokenConcurrency.Acquire(ctx, maxConcurrency, member, id)
+		if err == nil {
+			if !ok {
+				return inflight, false, func() {}
+			}
+
+			stop := make(chan struct{})
+			go redisTokenConcurrency.keepAlive(stop, member, id)
+
+			return inflight, true, sync.OnceFunc(func() {
+				close(stop)
+
+				err := redisTokenConcurrency.Release(context.Background(), member, id)
+				if err != nil {
+					log.Error("redis release concurrency error: " + err.Error())
+				}
+			})
+		}
+
+		log.Error("redis acquire concurrency error: " + err.Error())
+	}
+
+	inflight, ok = memoryTokenConcurrency.Acquire(maxConcurrency, id)
+
+	return inflight, ok, func() {
+		if ok {
+			memoryTokenConcurrency.Release(id)
+		}
+	}
+}
@@ -0,0 +1,65 @@
+package reqlimit_test
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/labring/aiproxy/core/common/reqlimit"
+	"github.com/stretchr/testify/require"
+)
+
+func TestInMemoryConcurrencyAcquireRelease(t *testing.T) {
+	c := reqlimit.NewInMemoryConcurrency()
+
+	inflight, ok := c.Acquire(2, "token1")
+	require.True(t, ok)
+	require.Equal(t, int64(1), inflight)
+
+	inflight, ok = c.Acquire(2, "token1")
+	require.True(t, ok)
+	require.Equal(t, int64(2), inflight)
+
+	inflight, ok = c.Acquire(2, "token1")
+	require.False(t, ok)
+	require.Equal(t, int64(2), inflight)
+
+	_, ok = c.Acquire(2, "token2")
+	require.True(t, ok)
+
+	c.Release("token1")
+
+	inflight, ok = c.Acquire(2, "token1")
+	require.True(t, ok)
+	require.Equal(t, int64(2), inflight)
+
+	// releasing more than acquired never goes negative
+	c.Release("token2")
+	c.Release("token2")
+
+	inflight, ok = c.Acquire(0, "token2")
+	require.True(t, ok)
+	require.Equal(t, int64(1), inflight)
+}
+
+func TestInMemoryConcurrencyParallel(t *testing.T) {
+	c := reqlimit.NewInMemoryConcurrency()
+
+	var (
+		wg       sync.WaitGroup
+		mu       sync.Mutex
+		acquired int
+	)
+
+	for range 100 {
+		wg.Go(func() {
+			if _, ok := c.Acquire(10, "token"); ok {
+				mu.Lock()
+				acquired++
+				mu.Unlock()
+			}
+		})
+	}
+
+	wg.Wait()
+	require.Equal(t, 10, acquired)
+}
@@ -220,6 +220,85 @@ func GetGroupModelTokennameRequestSnapshots(
 	)
 }
 
+var (
+	memoryTokenLimiter = NewInMemoryRecord()
+	redisTokenLimiter  = newRedisTokenRecord(func() *redis.Client { return common.RDB })
+)
+
+// PushTokenRequest counts a request of the token across all models
+func PushTokenRequest(ctx context.Context, tokenID int, overed int64) (int64, int64, int64) {
+	id := strconv.Itoa(tokenID)
+
+	if common.RedisEnabled {
+		count, overLimitCount, secondCount, err := redisTokenLimiter.PushRequest(
+			ctx,
+			overed,
+			time.Minute,
+			1,
+			id,
+		)
+		if err == nil {
+			return count, overLimitCount, secondCount
+		}
+
+		log.Error("redis push request error: " + err.Error())
+	}
+
+	return memoryTokenLimiter.PushRequest(overed, time.Minute, 1, id)
+}
+
+var (
+	memoryTokenTokensLimiter = NewInMemoryRecord()
+	redisTokenTokensLimiter  = newRedisTokenTokensRecord(
+		func() *redis.Client { return common.RDB },
+	)
+)
+
+// PushTokenTokensRequest counts the tokens used by the token across all models
+func PushTokenTokensRequest(
+	ctx context.Context,
+	tokenID int,
+	maxTokens, tokens int64,
+) (int64, int64, int64) {
+	id := strconv.Itoa(tokenID)
+
+	if common.RedisEnabled {
+		count, overLimitCount, secondCount, err := redisTokenTokensLimiter.PushRequest(
+			ctx,
+			maxTokens,
+			time.Minute,
+			tokens,
+			id,
+		)
+		if err == nil {
+			return count, overLimitCount, secondCount
+		}
+
+		log.Error("redis push request error: " + err.Error())
+	}
+
+	return memoryTokenTokensLimiter.PushRequest(maxTokens, time.Minute, tokens, id)
+}
+
+func GetTokenTokensRequest(ctx context.Context, tokenID int) (int64, int64) {
+	id := strconv.Itoa(tokenID)
+
+	if common.RedisEnabled {
+		totalCount, secondCount, err := redisTokenTokensLimiter.GetRequest(
+			ctx,
+			time.Minute,
+			id,
+		)
+		if err == nil {
+			return totalCount, secondCount
+		}
+
+		log.Error("redis get request error: " + err.Error())
+	}
+
+	return memoryTokenTokensLimiter.GetRequest(time.Minute, id)
+}
+
 var (
 	memoryChannelModelRecord = NewInMemoryRecord()
 	redisChannelModelRecord  = newRedisChannelModelRecord(
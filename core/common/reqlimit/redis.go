@@ -44,6 +44,14 @@ func newRedisGroupModelTokennameTokensRecord(getRDB func() *redis.Client) *redis
 	return newRedisRateRecord("group-model-tokenname-tokens-record", getRDB)
 }
 
+func newRedisTokenRecord(getRDB func() *redis.Client) *redisRateRecord {
+	return newRedisRateRecord("token-record", getRDB)
+}
+
+func newRedisTokenTokensRecord(getRDB func() *redis.Client) *redisRateRecord {
+	return newRedisRateRecord("token-tokens-record", getRDB)
+}
+
 func newRedisChannelModelTokensRecord(getRDB func() *redis.Client) *redisRateRecord {
 	return newRedisRateRecord("channel-model-tokens-record", getRDB)
 }
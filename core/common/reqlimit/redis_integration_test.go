@@ -451,6 +451,43 @@ func TestRedisRateRecordPushRebuildsStaleMeta(t *testing.T) {
 	require.Positive(t, metaTTL)
 }
 
+func TestRedisConcurrencyRenewAndRelease(t *testing.T) {
+	ctx := context.Background()
+
+	redisClient, cleanup := setupRedisForReqLimitTest(t, ctx)
+	defer cleanup()
+
+	c := newRedisConcurrency("test-concurrency", func() *redis.Client { return redisClient })
+
+	inflight, ok, err := c.Acquire(ctx, 1, "member1", "token")
+	require.NoError(t, err)
+	require.True(t, ok)
+	require.Equal(t, int64(1), inflight)
+
+	_, ok, err = c.Acquire(ctx, 1, "member2", "token")
+	require.NoError(t, err)
+	require.False(t, ok)
+
+	renewed, err := c.Renew(ctx, "member1", "token")
+	require.NoError(t, err)
+	require.True(t, renewed)
+
+	score, err := redisClient.ZScore(ctx, c.buildKey("token"), "member1").Result()
+	require.NoError(t, err)
+	require.Greater(t, score, float64(time.Now().Add(concurrencyLease/2).UnixMilli()))
+
+	require.NoError(t, c.Release(ctx, "member1", "token"))
+
+	// a released slot is not renewed back
+	renewed, err = c.Renew(ctx, "member1", "token")
+	require.NoError(t, err)
+	require.False(t, renewed)
+
+	_, ok, err = c.Acquire(ctx, 1, "member2", "token")
+	require.NoError(t, err)
+	require.True(t, ok)
+}
+
 func setupRedisForReqLimitTest(t *testing.T, ctx context.Context) (*redis.Client, func()) {
 	t.Helper()
 
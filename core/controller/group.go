@@ -361,6 +361,8 @@ type CreateGroupRequest struct {
 
 	BalanceAlertEnabled   bool    `json:"balance_alert_enabled"`
 	BalanceAlertThreshold float64 `json:"balance_alert_threshold"`
+
+	MCPACL model.MCPACL `json:"mcp_acl"`
 }
 
 func (r *CreateGroupRequest) ToGroup() *model.Group {
@@ -371,6 +373,8 @@ func (r *CreateGroupRequest) ToGroup() *model.Group {
 
 		BalanceAlertEnabled:   r.BalanceAlertEnabled,
 		BalanceAlertThreshold: r.BalanceAlertThreshold,
+
+		MCPACL: r.MCPACL,
 	}
 }
 
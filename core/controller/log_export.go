@@ -150,8 +150,10 @@ func ExportLogs(c *gin.Context) {
 		c,
 		filename,
 		params,
-		true,
-		true,
+		buildLogExportHeader(true, true),
+		func(logItem *model.Log) []string {
+			return buildLogExportRow(logItem, params.location, true, true)
+		},
 		func(start, endExclusive time.Time, limit int) ([]*model.Log, error) {
 			return model.ExportLogsRange(
 				start,
@@ -217,8 +219,15 @@ func ExportGroupLogs(c *gin.Context) {
 		c,
 		filename,
 		params,
-		params.includeCh,
-		params.includeRetryAt,
+		buildLogExportHeader(params.includeCh, params.includeRetryAt),
+		func(logItem *model.Log) []string {
+			return buildLogExportRow(
+				logItem,
+				params.location,
+				params.includeCh,
+				params.includeRetryAt,
+			)
+		},
 		func(start, endExclusive time.Time, limit int) ([]*model.Log, error) {
 			return model.ExportGroupLogsRange(
 				group,
@@ -241,13 +250,15 @@ func ExportGroupLogs(c *gin.Context) {
 	)
 }
 
-func streamCSV(
+// streamCSV writes the rows fetched chunk by chunk over the time range of the
+// params as a CSV file
+func streamCSV[T any](
 	c *gin.Context,
 	filename string,
 	params logExportParams,
-	includeChannel bool,
-	includeRetryAt bool,
-	fetch func(start, endExclusive time.Time, limit int) ([]*model.Log, error),
+	header []string,
+	buildRow func(item T) []string,
+	fetch func(start, endExclusive time.Time, limit int) ([]T, error),
 ) {
 	flusher, ok := c.Writer.(http.Flusher)
 	if !ok {
@@ -271,7 +282,7 @@ func streamCSV(
 	}
 
 	writer := csv.NewWriter(c.Writer)
-	if err := writer.Write(buildLogExportHeader(includeChannel, includeRetryAt)); err != nil {
+	if err := writer.Write(header); err != nil {
 		return
 	}
 
@@ -305,17 +316,15 @@ func streamCSV(
 			remaining = params.maxEntries - totalWritten
 		}
 
-		logs, err := fetch(chunkStart, chunkEndExclusive, remaining)
+		items, err := fetch(chunkStart, chunkEndExclusive, remaining)
 		if err != nil {
 			_ = c.Error(err)
 			break
 		}
 
 		var writeErr error
-		for _, logItem := range logs {
-			if err := writer.Write(
-				buildLogExportRow(logItem, params.location, includeChannel, includeRetryAt),
-			); err != nil {
+		for _, item := range items {
+			if err := writer.Write(buildRow(item)); err != nil {
 				writeErr = err
 				break
 			}
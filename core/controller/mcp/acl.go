@@ -0,0 +1,129 @@
+package controller
+
+import (
+	"encoding/json"
+
+	"github.com/bytedance/sonic"
+	"github.com/labring/aiproxy/core/mcpproxy"
+	"github.com/labring/aiproxy/core/model"
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// hasACL reports whether the group or the token restricts the mcps or the
+// tools
+func (b *toolsCallBilling) hasACL() bool {
+	return b != nil && (!b.group.MCPACL.IsEmpty() || !b.token.MCPACL.IsEmpty())
+}
+
+// checkTool returns an error when the group or the token acl denies the tool,
+// the denial is logged
+func (b *toolsCallBilling) checkTool(toolName string) error {
+	if !b.hasACL() {
+		return nil
+	}
+
+	err := model.CheckMCPTool(&b.group, &b.token, b.mcpID, toolName)
+	if err != nil {
+		b.log.Warnf("mcp tool call denied: group: %s, token: %s, %s",
+			b.group.ID, b.token.Name, err.Error())
+	}
+
+	return err
+}
+
+// filterTools removes the tools denied by the group or the token acl from a
+// tools/list response or from the tools/list responses of a batch, other
+// messages are returned as they are
+func (b *toolsCallBilling) filterTools(message []byte) []byte {
+	if !b.hasACL() {
+		return message
+	}
+
+	var resp any
+	if err := sonic.Unmarshal(message, &resp); err != nil {
+		return message
+	}
+
+	filtered := false
+
+	switch resp := resp.(type) {
+	case map[string]any:
+		filtered = b.filterListedTools(resp)
+	case []any:
+		for _, v := range resp {
+			if item, ok := v.(map[string]any); ok && b.filterListedTools(item) {
+				filtered = true
+			}
+		}
+	}
+
+	if !filtered {
+		return message
+	}
+
+	data, err := sonic.Marshal(resp)
+	if err != nil {
+		return message
+	}
+
+	return data
+}
+
+// filterListedTools removes the denied tools from a tools/list response, it
+// reports whether a tool is removed
+func (b *toolsCallBilling) filterListedTools(resp map[string]any) bool {
+	result, _ := resp["result"].(map[string]any)
+
+	tools, ok := result["tools"].([]any)
+	if !ok {
+		return false
+	}
+
+	allowed := make([]any, 0, len(tools))
+	for _, v := range tools {
+		tool, _ := v.(map[string]any)
+
+		name, _ := tool["name"].(string)
+		if model.CheckMCPTool(&b.group, &b.token, b.mcpID, name) == nil {
+			allowed = append(allowed, v)
+			continue
+		}
+
+		b.log.Debugf("mcp tool hidden by acl: group: %s, token: %s, mcp: %s, tool: %s",
+			b.group.ID, b.token.Name, b.mcpID, name)
+	}
+
+	if len(allowed) == len(tools) {
+		return false
+	}
+
+	result["tools"] = allowed
+
+	return true
+}
+
+// filterToolsResponse filters a tools/list response of a mcp server
+func (b *toolsCallBilling) filterToolsResponse(resp mcp.JSONRPCMessage) mcp.JSONRPCMessage {
+	if !b.hasACL() || resp == nil {
+		return resp
+	}
+
+	message, err := sonic.Marshal(resp)
+	if err != nil {
+		return resp
+	}
+
+	return json.RawMessage(b.filterTools(message))
+}
+
+// proxyOptions returns the options filtering the tools/list responses of a raw
+// streamable proxy
+func (b *toolsCallBilling) proxyOptions() []mcpproxy.StreamableProxyOption {
+	if !b.hasACL() {
+		return nil
+	}
+
+	return []mcpproxy.StreamableProxyOption{
+		mcpproxy.WithMessageFilter(b.filterTools),
+	}
+}
@@ -0,0 +1,142 @@
+//nolint:testpackage
+package controller
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/bytedance/sonic"
+	"github.com/gin-gonic/gin"
+	"github.com/labring/aiproxy/core/mcpproxy"
+	"github.com/labring/aiproxy/core/model"
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestACLBilling() *toolsCallBilling {
+	return &toolsCallBilling{
+		mcpID: "github",
+		group: model.GroupCache{
+			ID:     "g1",
+			Status: model.GroupStatusEnabled,
+			MCPACL: model.MCPACL{DenyTools: []string{"delete_*"}},
+		},
+		token: model.TokenCache{
+			Name:   "t1",
+			MCPACL: model.MCPACL{AllowTools: []string{"github/search", "github/delete_repo"}},
+		},
+		log: logrus.NewEntry(logrus.StandardLogger()),
+	}
+}
+
+func listedToolNames(t *testing.T, resp string) []string {
+	t.Helper()
+
+	var result struct {
+		Result mcp.ListToolsResult `json:"result"`
+	}
+	require.NoError(t, sonic.UnmarshalString(resp, &result), resp)
+
+	names := make([]string, len(result.Result.Tools))
+	for i, tool := range result.Result.Tools {
+		names[i] = tool.Name
+	}
+
+	return names
+}
+
+func TestBillingServerACL(t *testing.T) {
+	inner := &toolsServer{tools: []string{"search", "create_issue", "delete_repo"}}
+	server := newTestACLBilling().wrap(inner)
+
+	resp := handleVirtualMessage(t, server, `{"jsonrpc":"2.0","id":1,"method":"tools/list"}`)
+	assert.Equal(t, []string{"search"}, listedToolNames(t, resp))
+
+	for _, tool := range []string{"create_issue", "delete_repo"} {
+		msg := server.HandleMessage(
+			t.Context(),
+			json.RawMessage(`{"jsonrpc":"2.0","id":3,"method":"tools/call","params":{"name":"`+tool+`"}}`),
+		)
+		errMsg, isErr := jsonRPCErrorMessage(msg)
+		require.True(t, isErr, tool)
+		assert.Contains(t, errMsg, "denied", tool)
+	}
+
+	// a denied tool can not be called in a batch
+	msg := server.HandleMessage(
+		t.Context(),
+		json.RawMessage(`[{"jsonrpc":"2.0","id":4,"method":"tools/call","params":{"name":"search"}},`+
+			`{"jsonrpc":"2.0","id":5,"method":"tools/call","params":{"name":"delete_repo"}}]`),
+	)
+	_, isErr := jsonRPCErrorMessage(msg)
+	assert.True(t, isErr)
+}
+
+func TestFilterToolsBatch(t *testing.T) {
+	billing := newTestACLBilling()
+
+	filtered := billing.filterTools([]byte(`[` +
+		`{"jsonrpc":"2.0","id":1,"result":{"tools":[{"name":"search"},{"name":"delete_repo"}]}},` +
+		`{"jsonrpc":"2.0","id":2,"result":{"content":[]}}]`))
+
+	var resp []json.RawMessage
+	require.NoError(t, sonic.Unmarshal(filtered, &resp), string(filtered))
+	require.Len(t, resp, 2)
+	assert.Equal(t, []string{"search"}, listedToolNames(t, string(resp[0])))
+	assert.JSONEq(t, `{"jsonrpc":"2.0","id":2,"result":{"content":[]}}`, string(resp[1]))
+
+	// a batch without denied tools is returned as it is
+	message := []byte(`[{"jsonrpc":"2.0","id":1,"result":{"tools":[{"name":"search"}]}}]`)
+	assert.Equal(t, message, billing.filterTools(message))
+}
+
+func TestBillingServeProxyACL(t *testing.T) {
+	backendCalls := 0
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		backendCalls++
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		_, _ = w.Write([]byte("event: message\n" +
+			`data: {"jsonrpc":"2.0","id":1,"result":{"tools":[{"name":"search"},{"name":"create_issue"}]}}` +
+			"\n\n"))
+	}))
+	defer backend.Close()
+
+	billing := newTestACLBilling()
+
+	serve := func(body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest(http.MethodPost, "/mcp", strings.NewReader(body))
+		c.Request.Header.Set("Content-Type", "application/json")
+
+		billing.serveProxy(c, mcpproxy.NewStreamableProxy(
+			backend.URL,
+			nil,
+			mcpproxy.NewMemStore(),
+			billing.proxyOptions()...,
+		))
+
+		return w
+	}
+
+	w := serve(`{"jsonrpc":"2.0","id":1,"method":"tools/list"}`)
+	data, ok := strings.CutPrefix(strings.Split(w.Body.String(), "\n")[1], "data: ")
+	require.True(t, ok, w.Body.String())
+	assert.Equal(t, []string{"search"}, listedToolNames(t, data))
+
+	w = serve(`{"jsonrpc":"2.0","id":2,"method":"tools/call","params":{"name":"create_issue"}}`)
+	assert.Contains(t, w.Body.String(), "denied by the token acl")
+	assert.Equal(t, 1, backendCalls)
+
+	// a denied tool in a batch is not sent to the backend
+	w = serve(`[{"jsonrpc":"2.0","id":3,"method":"tools/call","params":{"name":"search"}},` +
+		`{"jsonrpc":"2.0","id":4,"method":"tools/call","params":{"name":"create_issue"}}]`)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Equal(t, 1, backendCalls)
+}
@@ -0,0 +1,218 @@
+package controller
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/bytedance/sonic"
+	"github.com/gin-gonic/gin"
+	"github.com/labring/aiproxy/core/common/config"
+	"github.com/labring/aiproxy/core/common/consume"
+	"github.com/labring/aiproxy/core/model"
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// recordMCPLog writes the mcp logs, it is replaced in tests
+var recordMCPLog = consume.AsyncRecordMCPLog
+
+// maxCapturedResponseSize is the size of the head of a proxied response kept
+// to find the json-rpc response
+const maxCapturedResponseSize = 256 * 1024
+
+type jsonRPCResponse struct {
+	Result json.RawMessage `json:"result"`
+	Error  *struct {
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+// toolResultError returns the text of a tools/call result flagged as an error
+func toolResultError(result []byte) (string, bool) {
+	var toolResult struct {
+		IsError bool `json:"isError"`
+		Content []struct {
+			Type string `json:"type"`
+			Text string `json:"text"`
+		} `json:"content"`
+	}
+	if err := sonic.Unmarshal(result, &toolResult); err != nil || !toolResult.IsError {
+		return "", false
+	}
+
+	texts := make([]string, 0, len(toolResult.Content))
+	for _, content := range toolResult.Content {
+		if content.Type == "text" && content.Text != "" {
+			texts = append(texts, content.Text)
+		}
+	}
+
+	if len(texts) == 0 {
+		return "tool call failed", true
+	}
+
+	return strings.Join(texts, "\n"), true
+}
+
+// audit writes the mcp log of a json-rpc request, the error is taken from
+// errMsg, or else from the json-rpc response
+func (b *toolsCallBilling) audit(
+	req *toolsCallRequest,
+	requestAt time.Time,
+	code int,
+	resp []byte,
+	errMsg string,
+) {
+	var result []byte
+
+	if errMsg == "" && len(resp) > 0 {
+		var message jsonRPCResponse
+		if err := sonic.Unmarshal(resp, &message); err == nil {
+			switch {
+			case message.Error != nil:
+				errMsg = message.Error.Message
+			case req.Method == string(mcp.MethodToolsCall):
+				result = message.Result
+				errMsg, _ = toolResultError(result)
+			}
+		}
+
+		// json-rpc errors are answered with 200, tool errors are not
+		if message.Error != nil && code == http.StatusOK {
+			code = http.StatusInternalServerError
+		}
+	}
+
+	mcpLog := &model.MCPLog{
+		RequestAt:            requestAt,
+		GroupID:              b.group.ID,
+		TokenID:              b.token.ID,
+		TokenName:            b.token.Name,
+		MCPID:                b.mcpID,
+		MCPType:              b.mcpType,
+		SessionID:            model.EmptyNullString(b.session),
+		Method:               req.Method,
+		Endpoint:             model.EmptyNullString(b.endpoint),
+		IP:                   model.EmptyNullString(b.ip),
+		Code:                 code,
+		Error:                model.EmptyNullString(errMsg),
+		DurationMilliseconds: time.Since(requestAt).Milliseconds(),
+	}
+
+	if req.Method == string(mcp.MethodToolsCall) {
+		mcpLog.ToolName = model.EmptyNullString(req.Params.Name)
+
+		if config.GetSaveMCPLogBody() {
+			mcpLog.Arguments = string(req.Params.Arguments)
+			mcpLog.Result = string(result)
+			mcpLog.ApplyBodySizeLimit(config.GetMCPLogBodyMaxSize())
+		}
+	}
+
+	recordMCPLog(mcpLog)
+}
+
+// auditMessage writes the mcp log of a request handled by a mcp server
+func (b *toolsCallBilling) auditMessage(
+	req *toolsCallRequest,
+	requestAt time.Time,
+	resp mcp.JSONRPCMessage,
+) {
+	if resp == nil {
+		// notifications are not answered
+		if req.ID == nil {
+			b.audit(req, requestAt, http.StatusOK, nil, "")
+		} else {
+			b.audit(req, requestAt, http.StatusInternalServerError, nil, "no response from server")
+		}
+
+		return
+	}
+
+	data, err := sonic.Marshal(resp)
+	if err != nil {
+		b.audit(req, requestAt, http.StatusOK, nil, "")
+		return
+	}
+
+	b.audit(req, requestAt, http.StatusOK, data, "")
+}
+
+// auditProxy writes the mcp log of a request forwarded by a raw streamable
+// proxy, the json-rpc response is looked up in the captured response
+func (b *toolsCallBilling) auditProxy(
+	req *toolsCallRequest,
+	requestAt time.Time,
+	capture *responseCapture,
+) {
+	code := capture.Status()
+
+	var errMsg string
+	if code != http.StatusOK && code != http.StatusAccepted {
+		errMsg = http.StatusText(code)
+	}
+
+	b.audit(
+		req,
+		requestAt,
+		code,
+		proxyResponseMessage(capture.Header().Get("Content-Type"), capture.body.Bytes()),
+		errMsg,
+	)
+}
+
+// proxyResponseMessage returns the json-rpc response of a proxied response,
+// which is either a json body or the last message of an SSE stream
+func proxyResponseMessage(contentType string, body []byte) []byte {
+	if !strings.Contains(contentType, "text/event-stream") {
+		return bytes.TrimSpace(body)
+	}
+
+	var message []byte
+
+	for line := range bytes.SplitSeq(body, []byte("\n")) {
+		data, ok := bytes.CutPrefix(line, []byte("data:"))
+		if !ok {
+			continue
+		}
+
+		data = bytes.TrimSpace(data)
+		if len(data) > 0 {
+			message = data
+		}
+	}
+
+	return message
+}
+
+// responseCapture keeps the head of the response written to the client
+type responseCapture struct {
+	gin.ResponseWriter
+	body      bytes.Buffer
+	truncated bool
+}
+
+func (w *responseCapture) capture(data []byte) {
+	remaining := maxCapturedResponseSize - w.body.Len()
+	if len(data) > remaining {
+		w.truncated = true
+	}
+
+	if remaining <= 0 {
+		return
+	}
+
+	w.body.Write(data[:min(len(data), remaining)])
+}
+
+func (w *responseCapture) Write(data []byte) (int, error) {
+	w.capture(data)
+	return w.ResponseWriter.Write(data)
+}
+
+func (w *responseCapture) WriteString(s string) (int, error) {
+	w.capture([]byte(s))
+	return w.ResponseWriter.WriteString(s)
+}
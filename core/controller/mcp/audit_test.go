@@ -0,0 +1,171 @@
+//nolint:testpackage
+package controller
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/labring/aiproxy/core/common/config"
+	"github.com/labring/aiproxy/core/mcpproxy"
+	"github.com/labring/aiproxy/core/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func captureMCPLogs(t *testing.T) *[]*model.MCPLog {
+	t.Helper()
+
+	var logs []*model.MCPLog
+
+	oldRecordMCPLog := recordMCPLog
+	recordMCPLog = func(mcpLog *model.MCPLog) {
+		logs = append(logs, mcpLog)
+	}
+
+	t.Cleanup(func() {
+		recordMCPLog = oldRecordMCPLog
+	})
+
+	return &logs
+}
+
+func TestBillingServerAudit(t *testing.T) {
+	logs := captureMCPLogs(t)
+
+	billing := newTestACLBilling()
+	billing.setSession("s1")
+	server := billing.wrap(&toolsServer{tools: []string{"search", "delete_repo"}})
+
+	handleVirtualMessage(t, server, `{"jsonrpc":"2.0","id":1,"method":"tools/list"}`)
+	handleVirtualMessage(
+		t,
+		server,
+		`{"jsonrpc":"2.0","id":2,"method":"tools/call","params":{"name":"delete_repo"}}`,
+	)
+	server.HandleMessage(
+		t.Context(),
+		json.RawMessage(`{"jsonrpc":"2.0","method":"notifications/initialized"}`),
+	)
+
+	require.Len(t, *logs, 3)
+
+	list := (*logs)[0]
+	assert.Equal(t, "g1", list.GroupID)
+	assert.Equal(t, "t1", list.TokenName)
+	assert.Equal(t, "github", list.MCPID)
+	assert.Equal(t, model.EmptyNullString("s1"), list.SessionID)
+	assert.Equal(t, "tools/list", list.Method)
+	assert.Equal(t, http.StatusOK, list.Code)
+	assert.Empty(t, list.Error)
+
+	denied := (*logs)[1]
+	assert.Equal(t, model.EmptyNullString("delete_repo"), denied.ToolName)
+	assert.Equal(t, http.StatusInternalServerError, denied.Code)
+	assert.Contains(t, denied.Error.String(), "denied by the group acl")
+
+	notification := (*logs)[2]
+	assert.Equal(t, "notifications/initialized", notification.Method)
+	assert.Equal(t, http.StatusOK, notification.Code)
+}
+
+func TestAuditToolsCallBody(t *testing.T) {
+	logs := captureMCPLogs(t)
+
+	oldSaveBody := config.GetSaveMCPLogBody()
+	oldMaxSize := config.GetMCPLogBodyMaxSize()
+
+	t.Cleanup(func() {
+		config.SetSaveMCPLogBody(oldSaveBody)
+		config.SetMCPLogBodyMaxSize(oldMaxSize)
+	})
+
+	req, ok := parseRequest([]byte(
+		`{"jsonrpc":"2.0","id":1,"method":"tools/call","params":{"name":"search","arguments":{"query":"aiproxy"}}}`,
+	))
+	require.True(t, ok)
+
+	resp := []byte(
+		`{"jsonrpc":"2.0","id":1,"result":{"isError":true,"content":[{"type":"text","text":"rate limited"}]}}`,
+	)
+
+	billing := newTestACLBilling()
+
+	config.SetSaveMCPLogBody(false)
+	billing.audit(req, time.Now(), http.StatusOK, resp, "")
+
+	config.SetSaveMCPLogBody(true)
+	config.SetMCPLogBodyMaxSize(32)
+	billing.audit(req, time.Now(), http.StatusOK, resp, "")
+
+	require.Len(t, *logs, 2)
+
+	withoutBody := (*logs)[0]
+	assert.Equal(t, model.EmptyNullString("search"), withoutBody.ToolName)
+	assert.Equal(t, model.EmptyNullString("rate limited"), withoutBody.Error)
+	assert.Equal(t, http.StatusOK, withoutBody.Code)
+	assert.Empty(t, withoutBody.Arguments)
+	assert.Empty(t, withoutBody.Result)
+
+	withBody := (*logs)[1]
+	assert.JSONEq(t, `{"query":"aiproxy"}`, withBody.Arguments)
+	assert.False(t, withBody.ArgumentsTruncated)
+	assert.True(t, withBody.ResultTruncated)
+	assert.LessOrEqual(t, len(withBody.Result), 32)
+}
+
+func TestBillingServeProxyAudit(t *testing.T) {
+	logs := captureMCPLogs(t)
+
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		_, _ = w.Write([]byte("event: message\n" +
+			`data: {"jsonrpc":"2.0","id":1,"error":{"code":-32601,"message":"method not found"}}` +
+			"\n\n"))
+	}))
+	defer backend.Close()
+
+	billing := newTestACLBilling()
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(
+		http.MethodPost,
+		"/mcp",
+		strings.NewReader(`{"jsonrpc":"2.0","id":1,"method":"prompts/list"}`),
+	)
+	c.Request.Header.Set("Content-Type", "application/json")
+
+	billing.serveProxy(c, mcpproxy.NewStreamableProxy(
+		backend.URL,
+		nil,
+		mcpproxy.NewMemStore(),
+		billing.proxyOptions()...,
+	))
+
+	assert.Contains(t, w.Body.String(), "method not found")
+	require.Len(t, *logs, 1)
+	assert.Equal(t, "prompts/list", (*logs)[0].Method)
+	assert.Equal(t, http.StatusInternalServerError, (*logs)[0].Code)
+	assert.Equal(t, model.EmptyNullString("method not found"), (*logs)[0].Error)
+}
+
+func TestProxyResponseMessage(t *testing.T) {
+	assert.Equal(
+		t,
+		`{"id":1}`,
+		string(proxyResponseMessage("application/json", []byte(" {\"id\":1}\n"))),
+	)
+	assert.Equal(
+		t,
+		`{"id":2}`,
+		string(proxyResponseMessage(
+			"text/event-stream",
+			[]byte("event: message\ndata: {\"id\":1}\n\nevent: message\ndata: {\"id\":2}\n\n"),
+		)),
+	)
+}
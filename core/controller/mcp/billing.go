@@ -0,0 +1,432 @@
+package controller
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/bytedance/sonic"
+	"github.com/gin-gonic/gin"
+	"github.com/labring/aiproxy/core/common"
+	"github.com/labring/aiproxy/core/common/balance"
+	"github.com/labring/aiproxy/core/common/consume"
+	"github.com/labring/aiproxy/core/common/metrics"
+	"github.com/labring/aiproxy/core/common/notify"
+	"github.com/labring/aiproxy/core/middleware"
+	"github.com/labring/aiproxy/core/model"
+	"github.com/labring/aiproxy/core/relay/meta"
+	"github.com/labring/aiproxy/core/relay/mode"
+	mcpservers "github.com/labring/aiproxy/mcp-servers"
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/sirupsen/logrus"
+)
+
+// toolsCallBilling charges and records every tools/call sent to a mcp server
+type toolsCallBilling struct {
+	mcpID    string
+	mcpType  string
+	price    model.MCPPrice
+	group    model.GroupCache
+	token    model.TokenCache
+	endpoint string
+	ip       string
+	session  string
+	log      *logrus.Entry
+}
+
+// newToolsCallBilling returns nil when the request is not authenticated by
+// MCPAuth, e.g. the admin test endpoints, so that those calls are not billed
+// and not checked against the mcp acls. Every json-rpc request is written to
+// the mcp logs
+func newToolsCallBilling(
+	c *gin.Context,
+	mcpID, mcpType string,
+	price model.MCPPrice,
+) *toolsCallBilling {
+	if _, ok := c.Get(middleware.Group); !ok {
+		return nil
+	}
+
+	if _, ok := c.Get(middleware.Token); !ok {
+		return nil
+	}
+
+	return &toolsCallBilling{
+		mcpID:    mcpID,
+		mcpType:  mcpType,
+		price:    price,
+		group:    middleware.GetGroup(c),
+		token:    middleware.GetToken(c),
+		endpoint: c.Request.URL.Path,
+		ip:       c.ClientIP(),
+		session:  c.GetHeader("Mcp-Session-Id"),
+		log:      common.GetLogger(c),
+	}
+}
+
+type toolsCallRequest struct {
+	ID     any    `json:"id"`
+	Method string `json:"method"`
+	Params struct {
+		Name      string          `json:"name"`
+		Arguments json.RawMessage `json:"arguments"`
+	} `json:"params"`
+}
+
+// parseRequest returns the method and the tool name of a json-rpc request
+func parseRequest(message []byte) (*toolsCallRequest, bool) {
+	if len(message) == 0 {
+		return nil, false
+	}
+
+	var req toolsCallRequest
+	if err := sonic.Unmarshal(message, &req); err != nil {
+		return nil, false
+	}
+
+	return &req, true
+}
+
+// isBatchRequest reports whether the message is a json-rpc batch, batches are
+// rejected since every request has to be checked, billed and logged on its own
+func isBatchRequest(message []byte) bool {
+	message = bytes.TrimSpace(message)
+	return len(message) > 0 && message[0] == '['
+}
+
+func batchNotSupportedResponse() mcp.JSONRPCMessage {
+	return mcpservers.CreateMCPErrorResponse(
+		mcp.NewRequestId(nil),
+		mcp.INVALID_REQUEST,
+		"batch requests are not supported",
+	)
+}
+
+// parseToolsCall returns the request if the message is a tools/call request
+func parseToolsCall(message []byte) (*toolsCallRequest, bool) {
+	req, ok := parseRequest(message)
+	if !ok || req.Method != string(mcp.MethodToolsCall) {
+		return nil, false
+	}
+
+	return req, true
+}
+
+// setSession sets the session of the sse connection the requests are sent on
+func (b *toolsCallBilling) setSession(session string) {
+	if b != nil {
+		b.session = session
+	}
+}
+
+// wrap returns a server that bills the tools/call requests handled by s
+func (b *toolsCallBilling) wrap(s mcpservers.Server) mcpservers.Server {
+	if b == nil {
+		return s
+	}
+
+	return &billingServer{
+		Server:  s,
+		billing: b,
+	}
+}
+
+// checkBalance returns the post consumer of the group, or an error when the
+// group balance is not enough to pay for the tool call
+func (b *toolsCallBilling) checkBalance(
+	ctx context.Context,
+	price float64,
+) (balance.PostGroupConsumer, error) {
+	if b.group.Status == model.GroupStatusInternal || price <= 0 {
+		return nil, nil
+	}
+
+	groupBalance, consumer, err := balance.GetGroupRemainBalance(ctx, b.group)
+	if err != nil {
+		if errors.Is(err, balance.ErrNoRealNameUsedAmountLimit) {
+			return nil, err
+		}
+
+		notify.ErrorThrottle(
+			"getGroupBalanceError",
+			time.Minute*3,
+			fmt.Sprintf("Get group `%s` balance error", b.group.ID),
+			err.Error(),
+		)
+
+		return nil, fmt.Errorf("get group `%s` balance error", b.group.ID)
+	}
+
+	if groupBalance < middleware.GroupMinimumBalance || groupBalance < price {
+		return nil, fmt.Errorf("group `%s` balance not enough", b.group.ID)
+	}
+
+	return consumer, nil
+}
+
+// record consumes the tool call price and writes the consume log
+func (b *toolsCallBilling) record(
+	toolName string,
+	consumer balance.PostGroupConsumer,
+	requestAt time.Time,
+	code int,
+	content string,
+) {
+	metrics.ObserveMCPToolCall(b.mcpType, b.mcpID, b.group.ID, code, time.Since(requestAt))
+
+	price := b.price.GetToolsCallPrice(toolName)
+
+	m := meta.NewMeta(
+		nil,
+		mode.MCPToolsCall,
+		b.mcpID+"/"+toolName,
+		model.ModelConfig{},
+		meta.WithRequestID(middleware.GenRequestID(requestAt)),
+		meta.WithRequestAt(requestAt),
+		meta.WithGroup(b.group),
+		meta.WithToken(b.token),
+		meta.WithEndpoint(b.endpoint),
+	)
+
+	consume.AsyncConsume(
+		consumer,
+		code,
+		time.Now(),
+		m,
+		model.Usage{},
+		model.UsageContext{},
+		model.Price{
+			PerRequestPrice: model.ZeroNullFloat64(price),
+		},
+		content,
+		b.ip,
+		0,
+		nil,
+		true,
+		map[string]string{
+			"mcp_id":    b.mcpID,
+			"mcp_type":  b.mcpType,
+			"tool_name": toolName,
+		},
+		"",
+		model.AsyncUsageStatusNone,
+	)
+}
+
+// serveProxy bills the tools/call requests forwarded by a raw streamable proxy,
+// the result code is taken from the backend response status. The tools denied
+// by the acls are rejected before they are forwarded
+func (b *toolsCallBilling) serveProxy(c *gin.Context, proxy http.Handler) {
+	if b == nil || c.Request.Method != http.MethodPost {
+		proxy.ServeHTTP(c.Writer, c.Request)
+		return
+	}
+
+	body, err := common.GetRequestBodyReusable(c.Request)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, mcpservers.CreateMCPErrorResponse(
+			mcp.NewRequestId(nil),
+			mcp.PARSE_ERROR,
+			err.Error(),
+		))
+
+		return
+	}
+
+	if isBatchRequest(body) {
+		c.JSON(http.StatusBadRequest, batchNotSupportedResponse())
+		return
+	}
+
+	req, ok := parseRequest(body)
+	if !ok || req.Method == "" {
+		proxy.ServeHTTP(c.Writer, c.Request)
+		return
+	}
+
+	requestAt := time.Now()
+
+	capture := &responseCapture{ResponseWriter: c.Writer}
+	c.Writer = capture
+
+	defer func() {
+		c.Writer = capture.ResponseWriter
+	}()
+
+	if req.Method == string(mcp.MethodToolsCall) {
+		b.serveProxyToolsCall(c, proxy, req, capture)
+	} else {
+		proxy.ServeHTTP(c.Writer, c.Request)
+	}
+
+	b.auditProxy(req, requestAt, capture)
+}
+
+func (b *toolsCallBilling) serveProxyToolsCall(
+	c *gin.Context,
+	proxy http.Handler,
+	req *toolsCallRequest,
+	capture *responseCapture,
+) {
+	if err := b.checkTool(req.Params.Name); err != nil {
+		c.JSON(http.StatusOK, mcpservers.CreateMCPErrorResponse(
+			req.ID,
+			mcp.INVALID_REQUEST,
+			err.Error(),
+		))
+
+		return
+	}
+
+	consumer, err := b.checkBalance(
+		c.Request.Context(),
+		b.price.GetToolsCallPrice(req.Params.Name),
+	)
+	if err != nil {
+		c.JSON(http.StatusOK, mcpservers.CreateMCPErrorResponse(
+			req.ID,
+			mcp.INVALID_REQUEST,
+			err.Error(),
+		))
+
+		return
+	}
+
+	requestAt := time.Now()
+
+	proxy.ServeHTTP(c.Writer, c.Request)
+
+	code, content := proxyToolsCallResult(capture)
+
+	b.record(req.Params.Name, consumer, requestAt, code, content)
+}
+
+// proxyToolsCallResult returns the code and the error of a proxied tools/call,
+// a response too large to be captured is a successful call
+func proxyToolsCallResult(capture *responseCapture) (int, string) {
+	code := capture.Status()
+	if code != http.StatusOK {
+		return code, http.StatusText(code)
+	}
+
+	message := proxyResponseMessage(
+		capture.Header().Get("Content-Type"),
+		capture.body.Bytes(),
+	)
+	if capture.truncated && !json.Valid(message) {
+		return http.StatusOK, ""
+	}
+
+	return toolsCallResult(message)
+}
+
+// toolsCallResult returns the code and the error of a tools/call json-rpc
+// response, json-rpc errors and tool results flagged with isError are failed
+// calls and are not charged
+func toolsCallResult(resp []byte) (int, string) {
+	if len(resp) == 0 {
+		return http.StatusInternalServerError, "no response from server"
+	}
+
+	var message jsonRPCResponse
+	if err := sonic.Unmarshal(resp, &message); err != nil {
+		return http.StatusInternalServerError, "invalid response from server"
+	}
+
+	if message.Error != nil {
+		return http.StatusInternalServerError, message.Error.Message
+	}
+
+	if errMsg, ok := toolResultError(message.Result); ok {
+		return http.StatusInternalServerError, errMsg
+	}
+
+	return http.StatusOK, ""
+}
+
+type billingServer struct {
+	mcpservers.Server
+	billing *toolsCallBilling
+}
+
+func (s *billingServer) HandleMessage(
+	ctx context.Context,
+	message json.RawMessage,
+) mcp.JSONRPCMessage {
+	if isBatchRequest(message) {
+		return batchNotSupportedResponse()
+	}
+
+	req, ok := parseRequest(message)
+	if !ok || req.Method == "" {
+		return s.Server.HandleMessage(ctx, message)
+	}
+
+	requestAt := time.Now()
+
+	resp := s.handleRequest(ctx, req, message)
+
+	s.billing.auditMessage(req, requestAt, resp)
+
+	return resp
+}
+
+func (s *billingServer) handleRequest(
+	ctx context.Context,
+	req *toolsCallRequest,
+	message json.RawMessage,
+) mcp.JSONRPCMessage {
+	switch req.Method {
+	case string(mcp.MethodToolsList):
+		return s.billing.filterToolsResponse(s.Server.HandleMessage(ctx, message))
+	case string(mcp.MethodToolsCall):
+	default:
+		return s.Server.HandleMessage(ctx, message)
+	}
+
+	if err := s.billing.checkTool(req.Params.Name); err != nil {
+		return mcpservers.CreateMCPErrorResponse(req.ID, mcp.INVALID_REQUEST, err.Error())
+	}
+
+	consumer, err := s.billing.checkBalance(
+		ctx,
+		s.billing.price.GetToolsCallPrice(req.Params.Name),
+	)
+	if err != nil {
+		return mcpservers.CreateMCPErrorResponse(req.ID, mcp.INVALID_REQUEST, err.Error())
+	}
+
+	requestAt := time.Now()
+
+	resp := s.Server.HandleMessage(ctx, message)
+
+	code, content := http.StatusOK, ""
+	if errMsg, ok := jsonRPCErrorMessage(resp); ok {
+		code = http.StatusInternalServerError
+		content = errMsg
+	} else if data, err := sonic.Marshal(resp); err == nil {
+		code, content = toolsCallResult(data)
+	}
+
+	s.billing.record(req.Params.Name, consumer, requestAt, code, content)
+
+	return resp
+}
+
+// jsonRPCErrorMessage reports whether the response is a json-rpc error
+func jsonRPCErrorMessage(resp mcp.JSONRPCMessage) (string, bool) {
+	switch r := resp.(type) {
+	case mcp.JSONRPCError:
+		return r.Error.Message, true
+	case *mcp.JSONRPCError:
+		return r.Error.Message, true
+	case nil:
+		return "no response from server", true
+	default:
+		return "", false
+	}
+}
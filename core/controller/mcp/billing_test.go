@@ -0,0 +1,161 @@
+//nolint:testpackage
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/labring/aiproxy/core/model"
+	mcpservers "github.com/labring/aiproxy/mcp-servers"
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/stretchr/testify/require"
+)
+
+type recordServer struct {
+	messages []json.RawMessage
+}
+
+func (s *recordServer) HandleMessage(
+	_ context.Context,
+	message json.RawMessage,
+) mcp.JSONRPCMessage {
+	s.messages = append(s.messages, message)
+	return mcpservers.CreateMCPResultResponse(1, json.RawMessage(`{}`))
+}
+
+func TestParseToolsCall(t *testing.T) {
+	req, ok := parseToolsCall(
+		[]byte(`{"jsonrpc":"2.0","id":1,"method":"tools/call","params":{"name":"search"}}`),
+	)
+	require.True(t, ok)
+	require.Equal(t, "search", req.Params.Name)
+
+	_, ok = parseToolsCall([]byte(`{"jsonrpc":"2.0","id":1,"method":"tools/list"}`))
+	require.False(t, ok)
+
+	_, ok = parseToolsCall([]byte(`not json`))
+	require.False(t, ok)
+}
+
+func TestMCPPriceGetToolsCallPrice(t *testing.T) {
+	price := model.MCPPrice{
+		DefaultToolsCallPrice: 0.1,
+		ToolsCallPrices: map[string]float64{
+			"search": 0.5,
+			"free":   0,
+		},
+	}
+
+	require.InDelta(t, 0.5, price.GetToolsCallPrice("search"), 0)
+	require.InDelta(t, 0, price.GetToolsCallPrice("free"), 0)
+	require.InDelta(t, 0.1, price.GetToolsCallPrice("other"), 0)
+}
+
+func TestBillingServerRejectsWhenBalanceNotEnough(t *testing.T) {
+	inner := &recordServer{}
+	billing := &toolsCallBilling{
+		mcpID: "search",
+		price: model.MCPPrice{DefaultToolsCallPrice: 1e12},
+		group: model.GroupCache{ID: "g1", Status: model.GroupStatusEnabled},
+	}
+	server := billing.wrap(inner)
+
+	resp := server.HandleMessage(
+		t.Context(),
+		json.RawMessage(`{"jsonrpc":"2.0","id":1,"method":"tools/call","params":{"name":"q"}}`),
+	)
+	errMsg, isErr := jsonRPCErrorMessage(resp)
+	require.True(t, isErr)
+	require.Contains(t, errMsg, "balance not enough")
+	require.Empty(t, inner.messages)
+
+	resp = server.HandleMessage(
+		t.Context(),
+		json.RawMessage(`{"jsonrpc":"2.0","id":2,"method":"tools/list"}`),
+	)
+	_, isErr = jsonRPCErrorMessage(resp)
+	require.False(t, isErr)
+	require.Len(t, inner.messages, 1)
+}
+
+func TestNilBillingWrapReturnsServer(t *testing.T) {
+	inner := &recordServer{}
+
+	var billing *toolsCallBilling
+
+	require.Same(t, mcpservers.Server(inner), billing.wrap(inner))
+}
+
+func TestToolsCallResult(t *testing.T) {
+	code, content := toolsCallResult(
+		[]byte(`{"jsonrpc":"2.0","id":1,"result":{"content":[{"type":"text","text":"ok"}]}}`),
+	)
+	require.Equal(t, http.StatusOK, code)
+	require.Empty(t, content)
+
+	code, content = toolsCallResult(
+		[]byte(`{"jsonrpc":"2.0","id":1,"result":{"isError":true,"content":[{"type":"text","text":"rate limited"}]}}`),
+	)
+	require.Equal(t, http.StatusInternalServerError, code)
+	require.Equal(t, "rate limited", content)
+
+	code, content = toolsCallResult(
+		[]byte(`{"jsonrpc":"2.0","id":1,"error":{"code":-32602,"message":"unknown tool"}}`),
+	)
+	require.Equal(t, http.StatusInternalServerError, code)
+	require.Equal(t, "unknown tool", content)
+
+	code, _ = toolsCallResult(nil)
+	require.Equal(t, http.StatusInternalServerError, code)
+}
+
+func TestProxyToolsCallResultJSONRPCError(t *testing.T) {
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+
+	capture := &responseCapture{ResponseWriter: c.Writer}
+	capture.Header().Set("Content-Type", "text/event-stream")
+	_, _ = capture.Write([]byte("event: message\n" +
+		`data: {"jsonrpc":"2.0","id":1,"error":{"code":-32603,"message":"backend down"}}` +
+		"\n\n"))
+
+	code, content := proxyToolsCallResult(capture)
+	require.Equal(t, http.StatusInternalServerError, code)
+	require.Equal(t, "backend down", content)
+}
+
+func TestBillingRejectsBatch(t *testing.T) {
+	inner := &recordServer{}
+	server := (&toolsCallBilling{mcpID: "search"}).wrap(inner)
+
+	resp := server.HandleMessage(
+		t.Context(),
+		json.RawMessage(`[{"jsonrpc":"2.0","id":1,"method":"tools/call","params":{"name":"q"}}]`),
+	)
+	errMsg, isErr := jsonRPCErrorMessage(resp)
+	require.True(t, isErr)
+	require.Contains(t, errMsg, "batch")
+	require.Empty(t, inner.messages)
+
+	backendCalls := 0
+	proxy := http.HandlerFunc(func(http.ResponseWriter, *http.Request) {
+		backendCalls++
+	})
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(
+		http.MethodPost,
+		"/mcp",
+		strings.NewReader(`[{"jsonrpc":"2.0","id":1,"method":"tools/call","params":{"name":"q"}}]`),
+	)
+
+	(&toolsCallBilling{mcpID: "search"}).serveProxy(c, proxy)
+	require.Equal(t, http.StatusBadRequest, w.Code)
+	require.Zero(t, backendCalls)
+}
@@ -291,6 +291,41 @@ func GetProxyConfig(
 	return config, nil
 }
 
+// GetStdioConfig passes the init config to the process as env, the reusing
+// only params are passed by the groups
+func GetStdioConfig(
+	stdioConfig *model.MCPStdioConfig,
+	ct mcpservers.ConfigTemplates,
+	initConfig map[string]string,
+) (*model.MCPStdioConfig, error) {
+	if stdioConfig == nil || stdioConfig.Command == "" {
+		return nil, errors.New("stdio command is empty")
+	}
+
+	embedConfig, err := GetEmbedConfig(ct, initConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	config := *stdioConfig
+	config.Args = slices.Clone(stdioConfig.Args)
+
+	config.Env = maps.Clone(stdioConfig.Env)
+	if config.Env == nil {
+		config.Env = make(map[string]string)
+	}
+
+	for key, value := range embedConfig.Init {
+		if value != "" {
+			config.Env[key] = value
+		}
+	}
+
+	config.Reusing = embedConfig.Reusing
+
+	return &config, nil
+}
+
 // 辅助函数：将参数应用到配置中
 func applyParamToConfig(
 	config *model.PublicMCPProxyConfig,
@@ -328,6 +363,13 @@ func ToPublicMCP(
 		}
 
 		pmcp.ProxyConfig = proxyConfig
+	case model.PublicMCPTypeStdio:
+		stdioConfig, err := GetStdioConfig(e.StdioConfig, e.ConfigTemplates, initConfig)
+		if err != nil {
+			return nil, err
+		}
+
+		pmcp.StdioConfig = stdioConfig
 	default:
 	}
 
@@ -512,5 +554,5 @@ func TestEmbedMCPStreamable(c *gin.Context) {
 		return
 	}
 
-	handleStreamableMCPServer(c, server)
+	handleStreamableMCPServer(c, server, nil)
 }
@@ -47,6 +47,8 @@ func handleGroupSSEMCPServer(
 	groupMcp *model.GroupMCPCache,
 	endpoint EndpointProvider,
 ) {
+	billing := newToolsCallBilling(c, groupMcp.ID, string(groupMcp.Type), groupMcp.Price)
+
 	switch groupMcp.Type {
 	case model.GroupMCPTypeProxySSE:
 		client, err := transport.NewSSE(
@@ -69,6 +71,7 @@ func handleGroupSSEMCPServer(
 			mcpservers.WrapMCPClient2Server(client),
 			string(model.GroupMCPTypeProxySSE),
 			endpoint,
+			billing,
 		)
 	case model.GroupMCPTypeProxyStreamable:
 		client, err := transport.NewStreamableHTTP(
@@ -92,6 +95,7 @@ func handleGroupSSEMCPServer(
 			mcpservers.WrapMCPClient2Server(client),
 			string(model.GroupMCPTypeProxyStreamable),
 			endpoint,
+			billing,
 		)
 	case model.GroupMCPTypeOpenAPI:
 		server, err := newOpenAPIMCPServer(groupMcp.OpenAPIConfig)
@@ -100,7 +104,7 @@ func handleGroupSSEMCPServer(
 			return
 		}
 
-		handleSSEMCPServer(c, server, string(model.GroupMCPTypeOpenAPI), endpoint)
+		handleSSEMCPServer(c, server, string(model.GroupMCPTypeOpenAPI), endpoint, billing)
 	default:
 		http.Error(c.Writer, "unsupported mcp type", http.StatusBadRequest)
 	}
@@ -152,7 +156,11 @@ func GroupMCPStreamable(c *gin.Context) {
 }
 
 // handleGroupProxyStreamable processes Streamable proxy requests for group
-func handleGroupProxyStreamable(c *gin.Context, config *model.GroupMCPProxyConfig) {
+func handleGroupProxyStreamable(
+	c *gin.Context,
+	config *model.GroupMCPProxyConfig,
+	billing *toolsCallBilling,
+) {
 	if config == nil || config.URL == "" {
 		return
 	}
@@ -176,6 +184,10 @@ func handleGroupProxyStreamable(c *gin.Context, config *model.GroupMCPProxyConfi
 	}
 
 	backendURL.RawQuery = backendQuery.Encode()
-	mcpproxy.NewStreamableProxy(backendURL.String(), headers, getStore()).
-		ServeHTTP(c.Writer, c.Request)
+	billing.serveProxy(c, mcpproxy.NewStreamableProxy(
+		backendURL.String(),
+		headers,
+		getStore(),
+		billing.proxyOptions()...,
+	))
 }
@@ -58,7 +58,7 @@ func HostMCPSSEServer(c *gin.Context) {
 		group := middleware.GetGroup(c)
 		paramsFunc := newGroupParams(publicMcp.ID, group.ID)
 
-		handlePublicSSEMCP(c, publicMcp, paramsFunc, sseEndpoint)
+		handlePublicSSEMCP(c, publicMcp, group.ID, paramsFunc, sseEndpoint)
 	}, func(c *gin.Context, mcpID string) {
 		group := middleware.GetGroup(c)
 
@@ -110,7 +110,7 @@ func HostMCPStreamable(c *gin.Context) {
 		group := middleware.GetGroup(c)
 		paramsFunc := newGroupParams(publicMcp.ID, group.ID)
 
-		handlePublicStreamable(c, publicMcp, paramsFunc)
+		handlePublicStreamable(c, publicMcp, group.ID, paramsFunc)
 	}, func(c *gin.Context, mcpID string) {
 		group := middleware.GetGroup(c)
 
@@ -26,14 +26,17 @@ func handleSSEMCPServer(
 	s mcpservers.Server,
 	mcpType string,
 	endpoint EndpointProvider,
+	billing *toolsCallBilling,
 ) {
 	// Store the session
 	store := getStore()
 	newSession := store.New()
 
+	billing.setSession(newSession)
+
 	newEndpoint := endpoint.NewEndpoint(newSession)
 	server := mcpproxy.NewSSEServer(
-		s,
+		billing.wrap(s),
 		mcpproxy.WithMessageEndpoint(newEndpoint),
 	)
 
@@ -82,6 +85,7 @@ func handleEmbedSSEMCP(
 	config *model.MCPEmbeddingConfig,
 	paramsFunc ParamsFunc,
 	endpoint EndpointProvider,
+	billing *toolsCallBilling,
 ) {
 	reusingConfig, err := prepareEmbedReusingConfig(mcpID, paramsFunc, config.Reusing)
 	if err != nil {
@@ -95,7 +99,7 @@ func handleEmbedSSEMCP(
 		return
 	}
 
-	handleSSEMCPServer(c, server, string(model.PublicMCPTypeEmbed), endpoint)
+	handleSSEMCPServer(c, server, string(model.PublicMCPTypeEmbed), endpoint, billing)
 }
 
 // prepareEmbedReusingConfig 准备嵌入MCP的reusing配置
@@ -137,7 +141,11 @@ func sendMCPSSEMessage(c *gin.Context, sessionID string) {
 }
 
 // handleStreamableMCPServer handles the streamable connection for an MCP server
-func handleStreamableMCPServer(c *gin.Context, s mcpservers.Server) {
+func handleStreamableMCPServer(
+	c *gin.Context,
+	s mcpservers.Server,
+	billing *toolsCallBilling,
+) {
 	if c.Request.Method != http.MethodPost {
 		c.JSON(http.StatusMethodNotAllowed, mcpservers.CreateMCPErrorResponse(
 			mcp.NewRequestId(nil),
@@ -159,7 +167,7 @@ func handleStreamableMCPServer(c *gin.Context, s mcpservers.Server) {
 		return
 	}
 
-	respMessage := s.HandleMessage(c.Request.Context(), reqBody)
+	respMessage := billing.wrap(s).HandleMessage(c.Request.Context(), reqBody)
 	if respMessage == nil {
 		// For notifications, just send 202 Accepted with no body
 		c.Status(http.StatusAccepted)
@@ -170,9 +178,11 @@ func handleStreamableMCPServer(c *gin.Context, s mcpservers.Server) {
 }
 
 func handleGroupStreamable(c *gin.Context, groupMcp *model.GroupMCPCache) {
+	billing := newToolsCallBilling(c, groupMcp.ID, string(groupMcp.Type), groupMcp.Price)
+
 	switch groupMcp.Type {
 	case model.GroupMCPTypeProxyStreamable:
-		handleGroupProxyStreamable(c, groupMcp.ProxyConfig)
+		handleGroupProxyStreamable(c, groupMcp.ProxyConfig, billing)
 	case model.GroupMCPTypeOpenAPI:
 		server, err := newOpenAPIMCPServer(groupMcp.OpenAPIConfig)
 		if err != nil {
@@ -185,7 +195,7 @@ func handleGroupStreamable(c *gin.Context, groupMcp *model.GroupMCPCache) {
 			return
 		}
 
-		handleStreamableMCPServer(c, server)
+		handleStreamableMCPServer(c, server, billing)
 	default:
 		c.JSON(http.StatusBadRequest, mcpservers.CreateMCPErrorResponse(
 			mcp.NewRequestId(nil),
@@ -41,23 +41,32 @@ func PublicMCPSSEServer(c *gin.Context) {
 	group := middleware.GetGroup(c)
 	paramsFunc := newGroupParams(publicMcp.ID, group.ID)
 
-	handlePublicSSEMCP(c, publicMcp, paramsFunc, sseEndpoint)
+	handlePublicSSEMCP(c, publicMcp, group.ID, paramsFunc, sseEndpoint)
 }
 
 func handlePublicSSEMCP(
 	c *gin.Context,
 	publicMcp *model.PublicMCPCache,
+	groupID string,
 	paramsFunc ParamsFunc,
 	endpoint EndpointProvider,
 ) {
+	billing := newToolsCallBilling(c, publicMcp.ID, string(publicMcp.Type), publicMcp.Price)
+
 	switch publicMcp.Type {
 	case model.PublicMCPTypeProxySSE:
-		if err := handlePublicProxySSE(c, publicMcp, paramsFunc, endpoint); err != nil {
+		if err := handlePublicProxySSE(c, publicMcp, paramsFunc, endpoint, billing); err != nil {
 			http.Error(c.Writer, err.Error(), http.StatusBadRequest)
 			return
 		}
 	case model.PublicMCPTypeProxyStreamable:
-		if err := handlePublicProxyStreamableSSE(c, publicMcp, paramsFunc, endpoint); err != nil {
+		if err := handlePublicProxyStreamableSSE(
+			c,
+			publicMcp,
+			paramsFunc,
+			endpoint,
+			billing,
+		); err != nil {
 			http.Error(c.Writer, err.Error(), http.StatusBadRequest)
 			return
 		}
@@ -68,9 +77,17 @@ func handlePublicSSEMCP(
 			return
 		}
 
-		handleSSEMCPServer(c, server, string(model.PublicMCPTypeOpenAPI), endpoint)
+		handleSSEMCPServer(c, server, string(model.PublicMCPTypeOpenAPI), endpoint, billing)
 	case model.PublicMCPTypeEmbed:
-		handleEmbedSSEMCP(c, publicMcp.ID, publicMcp.EmbedConfig, paramsFunc, endpoint)
+		handleEmbedSSEMCP(c, publicMcp.ID, publicMcp.EmbedConfig, paramsFunc, endpoint, billing)
+	case model.PublicMCPTypeStdio:
+		server, err := newStdioMCPServer(publicMcp, groupID, paramsFunc)
+		if err != nil {
+			http.Error(c.Writer, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		handleSSEMCPServer(c, server, string(model.PublicMCPTypeStdio), endpoint, billing)
 	default:
 		http.Error(c.Writer, "unknown mcp type", http.StatusBadRequest)
 	}
@@ -82,6 +99,7 @@ func handlePublicProxySSE(
 	publicMcp *model.PublicMCPCache,
 	paramsFunc ParamsFunc,
 	endpoint EndpointProvider,
+	billing *toolsCallBilling,
 ) error {
 	client, err := createProxySSEClient(c, publicMcp, paramsFunc)
 	if err != nil {
@@ -94,6 +112,7 @@ func handlePublicProxySSE(
 		mcpservers.WrapMCPClient2Server(client),
 		string(model.PublicMCPTypeProxySSE),
 		endpoint,
+		billing,
 	)
 
 	return nil
@@ -105,6 +124,7 @@ func handlePublicProxyStreamableSSE(
 	publicMcp *model.PublicMCPCache,
 	paramsFunc ParamsFunc,
 	endpoint EndpointProvider,
+	billing *toolsCallBilling,
 ) error {
 	client, err := createProxyStreamableClient(c, publicMcp, paramsFunc)
 	if err != nil {
@@ -117,6 +137,7 @@ func handlePublicProxyStreamableSSE(
 		mcpservers.WrapMCPClient2Server(client),
 		string(model.PublicMCPTypeProxyStreamable),
 		endpoint,
+		billing,
 	)
 
 	return nil
@@ -274,14 +295,17 @@ func PublicMCPStreamable(c *gin.Context) {
 	group := middleware.GetGroup(c)
 	paramsFunc := newGroupParams(publicMcp.ID, group.ID)
 
-	handlePublicStreamable(c, publicMcp, paramsFunc)
+	handlePublicStreamable(c, publicMcp, group.ID, paramsFunc)
 }
 
 func handlePublicStreamable(
 	c *gin.Context,
 	publicMcp *model.PublicMCPCache,
+	groupID string,
 	paramsFunc ParamsFunc,
 ) {
+	billing := newToolsCallBilling(c, publicMcp.ID, string(publicMcp.Type), publicMcp.Price)
+
 	switch publicMcp.Type {
 	case model.PublicMCPTypeProxySSE:
 		client, err := createProxySSEClient(c, publicMcp, paramsFunc)
@@ -292,10 +316,10 @@ func handlePublicStreamable(
 		defer client.Close()
 
 		mcpproxy.NewStatelessStreamableHTTPServer(
-			mcpservers.WrapMCPClient2Server(client),
+			billing.wrap(mcpservers.WrapMCPClient2Server(client)),
 		).ServeHTTP(c.Writer, c.Request)
 	case model.PublicMCPTypeProxyStreamable:
-		handlePublicProxyStreamable(c, paramsFunc, publicMcp.ProxyConfig)
+		handlePublicProxyStreamable(c, paramsFunc, publicMcp.ProxyConfig, billing)
 	case model.PublicMCPTypeOpenAPI:
 		server, err := newOpenAPIMCPServer(publicMcp.OpenAPIConfig)
 		if err != nil {
@@ -308,9 +332,22 @@ func handlePublicStreamable(
 			return
 		}
 
-		handleStreamableMCPServer(c, server)
+		handleStreamableMCPServer(c, server, billing)
 	case model.PublicMCPTypeEmbed:
-		handlePublicEmbedStreamable(c, publicMcp.ID, paramsFunc, publicMcp.EmbedConfig)
+		handlePublicEmbedStreamable(c, publicMcp.ID, paramsFunc, publicMcp.EmbedConfig, billing)
+	case model.PublicMCPTypeStdio:
+		server, err := newStdioMCPServer(publicMcp, groupID, paramsFunc)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, mcpservers.CreateMCPErrorResponse(
+				mcp.NewRequestId(nil),
+				mcp.INVALID_REQUEST,
+				err.Error(),
+			))
+
+			return
+		}
+
+		handleStreamableMCPServer(c, server, billing)
 	default:
 		c.JSON(http.StatusBadRequest, mcpservers.CreateMCPErrorResponse(
 			mcp.NewRequestId(nil),
@@ -325,6 +362,7 @@ func handlePublicEmbedStreamable(
 	mcpID string,
 	paramsFunc ParamsFunc,
 	config *model.MCPEmbeddingConfig,
+	billing *toolsCallBilling,
 ) {
 	var reusingConfig map[string]string
 	if len(config.Reusing) != 0 {
@@ -353,7 +391,7 @@ func handlePublicEmbedStreamable(
 		return
 	}
 
-	handleStreamableMCPServer(c, server)
+	handleStreamableMCPServer(c, server, billing)
 }
 
 // handlePublicProxyStreamable processes Streamable proxy requests
@@ -361,6 +399,7 @@ func handlePublicProxyStreamable(
 	c *gin.Context,
 	paramsFunc ParamsFunc,
 	config *model.PublicMCPProxyConfig,
+	billing *toolsCallBilling,
 ) {
 	if config == nil || config.URL == "" {
 		c.JSON(http.StatusBadRequest, mcpservers.CreateMCPErrorResponse(
@@ -409,8 +448,12 @@ func handlePublicProxyStreamable(
 	}
 
 	backendURL.RawQuery = backendQuery.Encode()
-	mcpproxy.NewStreamableProxy(backendURL.String(), headers, getStore()).
-		ServeHTTP(c.Writer, c.Request)
+	billing.serveProxy(c, mcpproxy.NewStreamableProxy(
+		backendURL.String(),
+		headers,
+		getStore(),
+		billing.proxyOptions()...,
+	))
 }
 
 // TestPublicMCPSSEServer godoc
@@ -446,5 +489,5 @@ func TestPublicMCPSSEServer(c *gin.Context) {
 
 	paramsFunc := newGroupParams(publicMcp.ID, groupID)
 
-	handlePublicSSEMCP(c, publicMcp, paramsFunc, sseEndpoint)
+	handlePublicSSEMCP(c, publicMcp, groupID, paramsFunc, sseEndpoint)
 }
@@ -216,6 +216,8 @@ func getPublicMCPTools(
 		return getProxySSEMCPTools(ctx, publicMcp, testConfig, params, reusing)
 	case model.PublicMCPTypeProxyStreamable:
 		return getProxyStreamableMCPTools(ctx, publicMcp, testConfig, params, reusing)
+	case model.PublicMCPTypeStdio:
+		return getStdioMCPTools(ctx, publicMcp, testConfig, params, reusing)
 	default:
 		return nil, nil
 	}
@@ -358,3 +360,37 @@ func getProxyStreamableMCPTools(
 
 	return mcpservers.ListServerTools(ctx, mcpservers.WrapMCPClient2Server(client))
 }
+
+func getStdioMCPTools(
+	ctx context.Context,
+	publicMcp model.PublicMCP,
+	testConfig model.TestConfig,
+	params map[string]string,
+	reusing map[string]model.ReusingParam,
+) ([]mcp.Tool, error) {
+	if publicMcp.StdioConfig == nil {
+		return nil, nil
+	}
+
+	var effectiveParams map[string]string
+	switch {
+	case testConfig.Enabled && checkParamsIsFull(testConfig.Params, reusing):
+		effectiveParams = testConfig.Params
+	case checkParamsIsFull(params, reusing):
+		effectiveParams = params
+	default:
+		return nil, nil
+	}
+
+	spec, err := newStdioSpec(publicMcp.ID, publicMcp.StdioConfig, staticParams(effectiveParams))
+	if err != nil {
+		return nil, err
+	}
+
+	// the process only lists the tools, it is not kept in the pool but counts
+	// toward its limit
+	process := newStdioProcess(stdioProcesses, publicMcp.ID, spec)
+	defer process.stop()
+
+	return mcpservers.ListServerTools(ctx, mcpservers.WrapMCPClient2Server(process))
+}
@@ -52,7 +52,8 @@ func NewPublicMCPEndpoint(host string, mcp model.PublicMCP) MCPEndpoint {
 	case model.PublicMCPTypeProxySSE,
 		model.PublicMCPTypeProxyStreamable,
 		model.PublicMCPTypeEmbed,
-		model.PublicMCPTypeOpenAPI:
+		model.PublicMCPTypeOpenAPI,
+		model.PublicMCPTypeStdio:
 		publicMCPHost := config.GetPublicMCPHost()
 		if publicMCPHost == "" {
 			ep.Host = host
@@ -95,6 +96,7 @@ func getHostedMCPTypes() []model.PublicMCPType {
 		model.PublicMCPTypeProxyStreamable,
 		model.PublicMCPTypeEmbed,
 		model.PublicMCPTypeOpenAPI,
+		model.PublicMCPTypeStdio,
 	}
 }
 
@@ -0,0 +1,634 @@
+package controller
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"os"
+	"os/exec"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/labring/aiproxy/core/common/config"
+	"github.com/labring/aiproxy/core/model"
+	mcpservers "github.com/labring/aiproxy/mcp-servers"
+	"github.com/mark3labs/mcp-go/client/transport"
+	"github.com/mark3labs/mcp-go/mcp"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	defaultStdioIdleTimeout  = 5 * time.Minute
+	stdioCleanupInterval     = 30 * time.Second
+	stdioInitializeTimeout   = 30 * time.Second
+	stdioWaitTimeout         = 30 * time.Second
+	stdioInitializedMethod   = "notifications/initialized"
+	stdioInitializeMethod    = "initialize"
+	stdioClientName          = "aiproxy"
+	stdioClientVersion       = "1.0.0"
+	stdioStderrMaxLineLength = 64 * 1024
+)
+
+// errStdioProcessLimit is returned when no process slot is freed in time
+var errStdioProcessLimit = errors.New("too many stdio mcp processes")
+
+// stdioRetryMethods are the requests sent again to a new process when the
+// process exited, the other requests such as a tool call may have been
+// handled before the exit and are not repeated
+var stdioRetryMethods = map[string]struct{}{
+	stdioInitializeMethod:       {},
+	string(mcp.MethodToolsList): {},
+}
+
+// stdioInheritedEnv are the variables of the proxy passed to the stdio
+// processes so that their commands can be found, the rest of the env of the
+// proxy such as the database dsn is not passed
+var stdioInheritedEnv = []string{"PATH", "HOME"}
+
+// stdioCommand builds the process with the inherited variables and the
+// configured env instead of the whole env of the proxy
+func stdioCommand(
+	ctx context.Context,
+	command string,
+	env, args []string,
+) (*exec.Cmd, error) {
+	cmd := exec.CommandContext(ctx, command, args...)
+
+	cmd.Env = make([]string, 0, len(stdioInheritedEnv)+len(env))
+	for _, key := range stdioInheritedEnv {
+		if value, ok := os.LookupEnv(key); ok {
+			cmd.Env = append(cmd.Env, key+"="+value)
+		}
+	}
+
+	cmd.Env = append(cmd.Env, env...)
+
+	return cmd, nil
+}
+
+// stdioSpec is the command line of a stdio mcp process
+type stdioSpec struct {
+	command     string
+	args        []string
+	env         []string
+	idleTimeout time.Duration
+}
+
+func (s stdioSpec) hash() string {
+	h := sha256.New()
+	h.Write([]byte(s.command))
+
+	for _, arg := range s.args {
+		h.Write([]byte{0})
+		h.Write([]byte(arg))
+	}
+
+	for _, env := range s.env {
+		h.Write([]byte{1})
+		h.Write([]byte(env))
+	}
+
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// newStdioSpec builds the env of the process from the config and the reusing
+// params, the ${NAME} in the args are expanded with the env
+func newStdioSpec(
+	mcpID string,
+	config *model.MCPStdioConfig,
+	paramsFunc ParamsFunc,
+) (stdioSpec, error) {
+	if config == nil || config.Command == "" {
+		return stdioSpec{}, errors.New("invalid stdio configuration")
+	}
+
+	env := maps.Clone(config.Env)
+	if env == nil {
+		env = make(map[string]string)
+	}
+
+	if len(config.Reusing) > 0 {
+		reusingConfig, err := NewReusingParamProcessor(mcpID, paramsFunc).
+			ProcessEmbedReusingParams(config.Reusing)
+		if err != nil {
+			return stdioSpec{}, err
+		}
+
+		maps.Copy(env, reusingConfig)
+	}
+
+	args := make([]string, len(config.Args))
+	for i, arg := range config.Args {
+		args[i] = os.Expand(arg, func(key string) string {
+			return env[key]
+		})
+	}
+
+	envList := make([]string, 0, len(env))
+	for _, key := range slices.Sorted(maps.Keys(env)) {
+		envList = append(envList, key+"="+env[key])
+	}
+
+	idleTimeout := defaultStdioIdleTimeout
+	if config.IdleTimeout > 0 {
+		idleTimeout = time.Duration(config.IdleTimeout) * time.Second
+	}
+
+	return stdioSpec{
+		command:     config.Command,
+		args:        args,
+		env:         envList,
+		idleTimeout: idleTimeout,
+	}, nil
+}
+
+// stdioProcess is a stdio mcp process shared by the sessions of a group, it
+// is initialized once and started again after it exits
+type stdioProcess struct {
+	pool *stdioPool
+	name string
+	spec stdioSpec
+
+	mu         sync.Mutex
+	client     *transport.Stdio
+	initResult json.RawMessage
+
+	nextID   atomic.Int64
+	lastUsed atomic.Int64
+	inflight atomic.Int64
+	// running is set while the process holds a slot of the pool
+	running atomic.Bool
+}
+
+func newStdioProcess(pool *stdioPool, name string, spec stdioSpec) *stdioProcess {
+	p := &stdioProcess{
+		pool: pool,
+		name: name,
+		spec: spec,
+	}
+	p.lastUsed.Store(time.Now().UnixNano())
+
+	return p
+}
+
+// start starts the process when it is not running and returns its client, it
+// waits for a slot of the pool when the pool is full
+func (p *stdioProcess) start(ctx context.Context) (*transport.Stdio, json.RawMessage, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.client != nil {
+		return p.client, p.initResult, nil
+	}
+
+	if err := p.pool.reserve(ctx); err != nil {
+		return nil, nil, fmt.Errorf("start stdio mcp %s failed: %w", p.name, err)
+	}
+
+	client := transport.NewStdioWithOptions(
+		p.spec.command,
+		p.spec.env,
+		p.spec.args,
+		transport.WithCommandFunc(stdioCommand),
+	)
+
+	// the process outlives the request starting it
+	if err := client.Start(context.Background()); err != nil {
+		p.pool.free()
+		return nil, nil, fmt.Errorf("start stdio mcp %s failed: %w", p.name, err)
+	}
+
+	go logStdioStderr(p.name, client.Stderr())
+
+	initResult, err := p.initialize(ctx, client)
+	if err != nil {
+		_ = client.Close()
+
+		p.pool.free()
+
+		return nil, nil, fmt.Errorf("initialize stdio mcp %s failed: %w", p.name, err)
+	}
+
+	p.client = client
+	p.initResult = initResult
+	p.running.Store(true)
+
+	return client, initResult, nil
+}
+
+func (p *stdioProcess) initialize(
+	ctx context.Context,
+	client *transport.Stdio,
+) (json.RawMessage, error) {
+	ctx, cancel := context.WithTimeout(ctx, stdioInitializeTimeout)
+	defer cancel()
+
+	resp, err := client.SendRequest(ctx, transport.JSONRPCRequest{
+		JSONRPC: mcp.JSONRPC_VERSION,
+		ID:      mcp.NewRequestId(p.nextID.Add(1)),
+		Method:  stdioInitializeMethod,
+		Params: mcp.InitializeParams{
+			ProtocolVersion: mcp.LATEST_PROTOCOL_VERSION,
+			ClientInfo: mcp.Implementation{
+				Name:    stdioClientName,
+				Version: stdioClientVersion,
+			},
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.Error != nil {
+		return nil, errors.New(resp.Error.Message)
+	}
+
+	if err := client.SendNotification(ctx, mcp.JSONRPCNotification{
+		JSONRPC: mcp.JSONRPC_VERSION,
+		Notification: mcp.Notification{
+			Method: stdioInitializedMethod,
+		},
+	}); err != nil {
+		return nil, err
+	}
+
+	return resp.Result, nil
+}
+
+// reset drops the client when it is still the running one, the next request
+// starts a new process
+func (p *stdioProcess) reset(client *transport.Stdio) {
+	p.mu.Lock()
+
+	current := p.client == client
+	if current {
+		p.client = nil
+		p.initResult = nil
+		p.running.Store(false)
+	}
+	p.mu.Unlock()
+
+	_ = client.Close()
+
+	if current {
+		p.pool.free()
+	}
+}
+
+func (p *stdioProcess) stop() {
+	p.mu.Lock()
+	client := p.client
+	p.client = nil
+	p.initResult = nil
+	p.running.Store(false)
+	p.mu.Unlock()
+
+	if client != nil {
+		_ = client.Close()
+
+		p.pool.free()
+	}
+}
+
+func (p *stdioProcess) idle(now time.Time) bool {
+	return p.inflight.Load() == 0 &&
+		now.Sub(time.Unix(0, p.lastUsed.Load())) > p.spec.idleTimeout
+}
+
+// release ends a use of the process acquired from the pool
+func (p *stdioProcess) release() {
+	p.lastUsed.Store(time.Now().UnixNano())
+	p.inflight.Add(-1)
+
+	// the process may be shut down for a request waiting for a slot
+	p.pool.wake()
+}
+
+// SendRequest forwards the request with an id of the process, the sessions
+// sharing the process may use the same ids. the process is started again
+// when it exited, only the idempotent requests are sent again to it
+func (p *stdioProcess) SendRequest(
+	ctx context.Context,
+	request transport.JSONRPCRequest,
+) (*transport.JSONRPCResponse, error) {
+	for retry := 0; ; retry++ {
+		client, initResult, err := p.start(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		// the process has been initialized when it started
+		if request.Method == stdioInitializeMethod {
+			return &transport.JSONRPCResponse{
+				JSONRPC: mcp.JSONRPC_VERSION,
+				ID:      request.ID,
+				Result:  initResult,
+			}, nil
+		}
+
+		forward := request
+		forward.ID = mcp.NewRequestId(p.nextID.Add(1))
+
+		resp, err := client.SendRequest(ctx, forward)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil, err
+			}
+
+			// the transport is closed or the pipe is broken when the process
+			// exited, the next request starts a new process
+			log.Warnf("stdio mcp %s exited, restarting", p.name)
+			p.reset(client)
+
+			if _, ok := stdioRetryMethods[request.Method]; ok && retry == 0 {
+				continue
+			}
+
+			return nil, err
+		}
+
+		resp.ID = request.ID
+
+		return resp, nil
+	}
+}
+
+func (p *stdioProcess) SendNotification(
+	ctx context.Context,
+	notification mcp.JSONRPCNotification,
+) error {
+	if notification.Method == stdioInitializedMethod {
+		return nil
+	}
+
+	client, _, err := p.start(ctx)
+	if err != nil {
+		return err
+	}
+
+	return client.SendNotification(ctx, notification)
+}
+
+func (p *stdioProcess) Start(ctx context.Context) error {
+	_, _, err := p.start(ctx)
+	return err
+}
+
+func (p *stdioProcess) SetNotificationHandler(_ func(notification mcp.JSONRPCNotification)) {}
+
+func (p *stdioProcess) Close() error {
+	p.stop()
+	return nil
+}
+
+func (p *stdioProcess) GetSessionId() string {
+	return ""
+}
+
+// stdioPool keeps a stdio mcp process for each mcp, group and command line,
+// the processes are shut down after being idle. at most
+// config.StdioMCPMaxProcesses processes run, the least recently used idle
+// process is shut down for a new one and the requests wait when all are busy
+type stdioPool struct {
+	mu          sync.Mutex
+	processes   map[string]*stdioProcess
+	running     int
+	changed     chan struct{}
+	cleanerOnce sync.Once
+}
+
+var stdioProcesses = newStdioPool()
+
+func newStdioPool() *stdioPool {
+	return &stdioPool{
+		processes: make(map[string]*stdioProcess),
+		changed:   make(chan struct{}),
+	}
+}
+
+// reserve takes a slot for a new process
+func (s *stdioPool) reserve(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, stdioWaitTimeout)
+	defer cancel()
+
+	for {
+		s.mu.Lock()
+
+		limit := config.StdioMCPMaxProcesses
+		if limit <= 0 || s.running < limit {
+			s.running++
+			s.mu.Unlock()
+
+			return nil
+		}
+
+		idle := s.evictIdleLocked()
+		changed := s.changed
+
+		s.mu.Unlock()
+
+		if idle != nil {
+			idle.stop()
+			continue
+		}
+
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("%w: %d", errStdioProcessLimit, limit)
+		case <-changed:
+		}
+	}
+}
+
+// evictIdleLocked removes the least recently used running process not in use
+// from the pool, the caller stops it
+func (s *stdioPool) evictIdleLocked() *stdioProcess {
+	var (
+		key  string
+		idle *stdioProcess
+	)
+
+	for k, p := range s.processes {
+		if !p.running.Load() || p.inflight.Load() != 0 {
+			continue
+		}
+
+		if idle == nil || p.lastUsed.Load() < idle.lastUsed.Load() {
+			key, idle = k, p
+		}
+	}
+
+	if idle != nil {
+		delete(s.processes, key)
+	}
+
+	return idle
+}
+
+// free returns the slot of a stopped process
+func (s *stdioPool) free() {
+	s.mu.Lock()
+	s.running--
+	s.wakeLocked()
+	s.mu.Unlock()
+}
+
+// wake tells the waiting requests to look for a slot again
+func (s *stdioPool) wake() {
+	s.mu.Lock()
+	s.wakeLocked()
+	s.mu.Unlock()
+}
+
+func (s *stdioPool) wakeLocked() {
+	close(s.changed)
+	s.changed = make(chan struct{})
+}
+
+// acquire returns the process of the mcp, group and command line in use, it
+// is marked in use under the pool lock so that the cleanup can not shut it
+// down before the request, the caller releases it when done
+func (s *stdioPool) acquire(mcpID, groupID string, spec stdioSpec) *stdioProcess {
+	s.cleanerOnce.Do(func() {
+		go s.startCleaner(stdioCleanupInterval)
+	})
+
+	key := fmt.Sprintf("%s:%s:%s", mcpID, groupID, spec.hash())
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	p, ok := s.processes[key]
+	if !ok {
+		p = newStdioProcess(s, fmt.Sprintf("%s (%s)", mcpID, groupID), spec)
+		s.processes[key] = p
+	}
+
+	p.inflight.Add(1)
+
+	return p
+}
+
+func (s *stdioPool) startCleaner(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for now := range ticker.C {
+		s.cleanup(now)
+	}
+}
+
+func (s *stdioPool) cleanup(now time.Time) {
+	s.mu.Lock()
+
+	var idles []*stdioProcess
+	for key, p := range s.processes {
+		if p.idle(now) {
+			delete(s.processes, key)
+			idles = append(idles, p)
+		}
+	}
+
+	s.mu.Unlock()
+
+	for _, p := range idles {
+		p.stop()
+	}
+}
+
+// stdioClient is the transport of a pooled process, the process is looked up
+// on every request so that the sessions outliving an idle shutdown start it
+// again, closing the client leaves the process to the pool
+type stdioClient struct {
+	mcpID   string
+	groupID string
+	spec    stdioSpec
+}
+
+var (
+	_ transport.Interface = (*stdioProcess)(nil)
+	_ transport.Interface = (*stdioClient)(nil)
+)
+
+func (c *stdioClient) acquire() *stdioProcess {
+	return stdioProcesses.acquire(c.mcpID, c.groupID, c.spec)
+}
+
+func (c *stdioClient) Start(_ context.Context) error {
+	return nil
+}
+
+func (c *stdioClient) SendRequest(
+	ctx context.Context,
+	request transport.JSONRPCRequest,
+) (*transport.JSONRPCResponse, error) {
+	p := c.acquire()
+	defer p.release()
+
+	return p.SendRequest(ctx, request)
+}
+
+func (c *stdioClient) SendNotification(
+	ctx context.Context,
+	notification mcp.JSONRPCNotification,
+) error {
+	p := c.acquire()
+	defer p.release()
+
+	return p.SendNotification(ctx, notification)
+}
+
+func (c *stdioClient) SetNotificationHandler(_ func(notification mcp.JSONRPCNotification)) {}
+
+func (c *stdioClient) Close() error {
+	return nil
+}
+
+func (c *stdioClient) GetSessionId() string {
+	return ""
+}
+
+// newStdioMCPServer bridges the pooled process of the group to a mcp server
+func newStdioMCPServer(
+	publicMcp *model.PublicMCPCache,
+	groupID string,
+	paramsFunc ParamsFunc,
+) (mcpservers.Server, error) {
+	spec, err := newStdioSpec(publicMcp.ID, publicMcp.StdioConfig, paramsFunc)
+	if err != nil {
+		return nil, err
+	}
+
+	return mcpservers.WrapMCPClient2Server(&stdioClient{
+		mcpID:   publicMcp.ID,
+		groupID: groupID,
+		spec:    spec,
+	}), nil
+}
+
+func logStdioStderr(name string, stderr io.Reader) {
+	if stderr == nil {
+		return
+	}
+
+	scanner := bufio.NewScanner(stderr)
+	scanner.Buffer(make([]byte, 0, 4096), stdioStderrMaxLineLength)
+
+	for scanner.Scan() {
+		if line := strings.TrimSpace(scanner.Text()); line != "" {
+			log.Debugf("stdio mcp %s: %s", name, line)
+		}
+	}
+
+	// keep draining so that the process does not block on a full pipe
+	_, _ = io.Copy(io.Discard, stderr)
+}
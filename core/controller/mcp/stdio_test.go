@@ -0,0 +1,377 @@
+//nolint:testpackage
+package controller
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/labring/aiproxy/core/common/config"
+	"github.com/labring/aiproxy/core/model"
+	mcpservers "github.com/labring/aiproxy/mcp-servers"
+	"github.com/mark3labs/mcp-go/client/transport"
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const stdioHelperEnv = "AIPROXY_TEST_STDIO_MCP"
+
+// TestStdioHelperProcess is the stdio mcp server launched by the tests, the
+// echo tool answers with the pid and the text, the exit tool exits after
+// answering
+func TestStdioHelperProcess(t *testing.T) {
+	if os.Getenv(stdioHelperEnv) != "1" {
+		t.Skip("helper process")
+	}
+
+	pid := strconv.Itoa(os.Getpid())
+	out := json.NewEncoder(os.Stdout)
+
+	scanner := bufio.NewScanner(os.Stdin)
+	for scanner.Scan() {
+		var req struct {
+			ID     json.RawMessage `json:"id"`
+			Method string          `json:"method"`
+			Params struct {
+				Name      string            `json:"name"`
+				Arguments map[string]string `json:"arguments"`
+			} `json:"params"`
+		}
+		if err := json.Unmarshal(scanner.Bytes(), &req); err != nil || req.ID == nil {
+			continue
+		}
+
+		var result any
+
+		switch req.Method {
+		case "initialize":
+			result = map[string]any{
+				"protocolVersion": "2025-03-26",
+				"capabilities":    map[string]any{},
+				"serverInfo": map[string]any{
+					"name":    "fake",
+					"version": os.Getenv("FAKE_VERSION"),
+				},
+			}
+		default:
+			result = map[string]any{
+				"content": []map[string]any{{
+					"type": "text",
+					"text": pid + ":" + req.Params.Arguments["text"],
+				}},
+			}
+		}
+
+		_ = out.Encode(map[string]any{"jsonrpc": "2.0", "id": req.ID, "result": result})
+
+		if req.Params.Name == "exit" {
+			os.Exit(0)
+		}
+	}
+
+	os.Exit(0)
+}
+
+func newTestStdioConfig(t *testing.T) *model.MCPStdioConfig {
+	t.Helper()
+
+	return &model.MCPStdioConfig{
+		Command: os.Args[0],
+		Args:    []string{"-test.run=^TestStdioHelperProcess$"},
+		Env:     map[string]string{stdioHelperEnv: "1"},
+		Reusing: map[string]model.ReusingParam{
+			"FAKE_VERSION": {Name: "Version", Required: true},
+		},
+	}
+}
+
+func callStdioTool(t *testing.T, server mcpservers.Server, id int, text, tool string) string {
+	t.Helper()
+
+	message := fmt.Sprintf(
+		`{"jsonrpc":"2.0","id":%d,"method":"tools/call","params":{"name":%q,"arguments":{"text":%q}}}`,
+		id,
+		tool,
+		text,
+	)
+
+	resp := server.HandleMessage(t.Context(), json.RawMessage(message))
+	data, err := json.Marshal(resp)
+	require.NoError(t, err)
+
+	var result struct {
+		ID     int `json:"id"`
+		Result struct {
+			Content []struct {
+				Text string `json:"text"`
+			} `json:"content"`
+		} `json:"result"`
+	}
+	require.NoError(t, json.Unmarshal(data, &result), string(data))
+	require.Len(t, result.Result.Content, 1, string(data))
+	assert.Equal(t, id, result.ID)
+
+	return result.Result.Content[0].Text
+}
+
+func newTestStdioServer(t *testing.T, groupID string) (mcpservers.Server, *stdioProcess) {
+	t.Helper()
+
+	publicMcp := &model.PublicMCPCache{
+		ID:          "stdio-test",
+		Type:        model.PublicMCPTypeStdio,
+		StdioConfig: newTestStdioConfig(t),
+	}
+
+	params := staticParams{"FAKE_VERSION": groupID}
+
+	server, err := newStdioMCPServer(publicMcp, groupID, params)
+	require.NoError(t, err)
+
+	spec, err := newStdioSpec(publicMcp.ID, publicMcp.StdioConfig, params)
+	require.NoError(t, err)
+
+	process := stdioProcesses.acquire(publicMcp.ID, groupID, spec)
+	process.release()
+	t.Cleanup(process.stop)
+
+	return server, process
+}
+
+func TestStdioSpec(t *testing.T) {
+	spec, err := newStdioSpec("sqlite", &model.MCPStdioConfig{
+		Command: "uvx",
+		Args:    []string{"mcp-server-sqlite", "--db-path", "${DB_PATH}"},
+		Env:     map[string]string{"LOG_LEVEL": "debug"},
+		Reusing: map[string]model.ReusingParam{
+			"DB_PATH": {Name: "DB Path", Required: true},
+		},
+	}, staticParams{"DB_PATH": "/data/g1.db"})
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{"mcp-server-sqlite", "--db-path", "/data/g1.db"}, spec.args)
+	assert.Equal(t, []string{"DB_PATH=/data/g1.db", "LOG_LEVEL=debug"}, spec.env)
+	assert.Equal(t, defaultStdioIdleTimeout, spec.idleTimeout)
+
+	_, err = newStdioSpec("sqlite", &model.MCPStdioConfig{
+		Command: "uvx",
+		Reusing: map[string]model.ReusingParam{
+			"DB_PATH": {Name: "DB Path", Required: true},
+		},
+	}, staticParams{})
+	require.Error(t, err)
+}
+
+func TestStdioSharedProcess(t *testing.T) {
+	server, process := newTestStdioServer(t, "g1")
+
+	initialize := server.HandleMessage(
+		t.Context(),
+		json.RawMessage(`{"jsonrpc":"2.0","id":"init","method":"initialize","params":{}}`),
+	)
+	data, err := json.Marshal(initialize)
+	require.NoError(t, err)
+	assert.Contains(t, string(data), `"id":"init"`)
+	assert.Contains(t, string(data), `"version":"g1"`)
+
+	// the sessions sharing the process use the same ids
+	var wg sync.WaitGroup
+	for i := range 8 {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			text := callStdioTool(t, server, 1, strconv.Itoa(i), "echo")
+			assert.Regexp(t, `^\d+:`+strconv.Itoa(i)+`$`, text)
+		}()
+	}
+
+	wg.Wait()
+
+	assert.Equal(t, callStdioTool(t, server, 2, "", "echo"), callStdioTool(t, server, 3, "", "echo"))
+
+	// the other groups have their own process
+	other, _ := newTestStdioServer(t, "g2")
+	assert.NotEqual(
+		t,
+		callStdioTool(t, server, 4, "", "echo"),
+		callStdioTool(t, other, 4, "", "echo"),
+	)
+
+	assert.Zero(t, process.inflight.Load())
+}
+
+func TestStdioRestartOnExit(t *testing.T) {
+	server, _ := newTestStdioServer(t, "g1")
+
+	first := callStdioTool(t, server, 1, "", "exit")
+
+	// the tool call may have run before the exit, it is not sent again
+	resp := server.HandleMessage(
+		t.Context(),
+		json.RawMessage(`{"jsonrpc":"2.0","id":2,"method":"tools/call","params":{"name":"echo"}}`),
+	)
+	data, err := json.Marshal(resp)
+	require.NoError(t, err)
+	assert.Contains(t, string(data), `"error"`)
+
+	// the next request starts a new process
+	second := callStdioTool(t, server, 3, "", "echo")
+	assert.NotEqual(t, first, second)
+
+	assert.Equal(t, second, callStdioTool(t, server, 4, "", "echo"))
+
+	// listing the tools is sent again to a new process
+	callStdioTool(t, server, 5, "", "exit")
+
+	_, err = mcpservers.ListServerTools(t.Context(), server)
+	require.NoError(t, err)
+	assert.NotEqual(t, second, callStdioTool(t, server, 6, "", "echo"))
+}
+
+func TestStdioIdleShutdown(t *testing.T) {
+	server, process := newTestStdioServer(t, "g1")
+
+	first := callStdioTool(t, server, 1, "", "echo")
+
+	stdioProcesses.cleanup(time.Now())
+	assert.NotNil(t, process.client)
+
+	stdioProcesses.cleanup(time.Now().Add(defaultStdioIdleTimeout + time.Second))
+	assert.Nil(t, process.client)
+
+	// the session outliving the shutdown starts a new process
+	assert.NotEqual(t, first, callStdioTool(t, server, 2, "", "echo"))
+}
+
+func TestStdioIdleShutdownSkipsAcquired(t *testing.T) {
+	spec, err := newStdioSpec(
+		"stdio-test",
+		newTestStdioConfig(t),
+		staticParams{"FAKE_VERSION": "acquired"},
+	)
+	require.NoError(t, err)
+
+	// a process acquired before the cleanup is kept for its request
+	process := stdioProcesses.acquire("stdio-test", "acquired", spec)
+	t.Cleanup(process.stop)
+
+	process.lastUsed.Store(0)
+	stdioProcesses.cleanup(time.Now())
+	assert.Same(t, process, stdioProcesses.acquire("stdio-test", "acquired", spec))
+
+	process.release()
+	process.release()
+
+	process.lastUsed.Store(0)
+	stdioProcesses.cleanup(time.Now())
+
+	next := stdioProcesses.acquire("stdio-test", "acquired", spec)
+	next.release()
+	t.Cleanup(next.stop)
+
+	assert.NotSame(t, process, next)
+}
+
+func TestStdioCommandEnv(t *testing.T) {
+	t.Setenv("AIPROXY_TEST_SECRET", "secret")
+
+	cmd, err := stdioCommand(t.Context(), "uvx", []string{"LOG_LEVEL=debug"}, []string{"server"})
+	require.NoError(t, err)
+
+	assert.Contains(t, cmd.Env, "PATH="+os.Getenv("PATH"))
+	assert.Contains(t, cmd.Env, "LOG_LEVEL=debug")
+	assert.NotContains(t, cmd.Env, "AIPROXY_TEST_SECRET=secret")
+	assert.Equal(t, []string{"uvx", "server"}, cmd.Args)
+}
+
+func TestStdioListTools(t *testing.T) {
+	ctx, cancel := context.WithTimeout(t.Context(), 10*time.Second)
+	defer cancel()
+
+	spec, err := newStdioSpec("stdio-test", newTestStdioConfig(t), staticParams{"FAKE_VERSION": "1"})
+	require.NoError(t, err)
+
+	process := newStdioProcess(newStdioPool(), "stdio-test", spec)
+	defer process.stop()
+
+	_, err = mcpservers.ListServerTools(ctx, mcpservers.WrapMCPClient2Server(process))
+	require.NoError(t, err)
+	assert.NotNil(t, process.client)
+}
+
+func TestStdioProcessLimit(t *testing.T) {
+	prev := config.StdioMCPMaxProcesses
+	config.StdioMCPMaxProcesses = 1
+
+	t.Cleanup(func() {
+		config.StdioMCPMaxProcesses = prev
+	})
+
+	pool := newStdioPool()
+
+	acquire := func(groupID string) *stdioProcess {
+		spec, err := newStdioSpec(
+			"stdio-test",
+			newTestStdioConfig(t),
+			staticParams{"FAKE_VERSION": groupID},
+		)
+		require.NoError(t, err)
+
+		process := pool.acquire("stdio-test", groupID, spec)
+		t.Cleanup(process.stop)
+
+		return process
+	}
+
+	listTools := func(ctx context.Context, process *stdioProcess) error {
+		_, err := process.SendRequest(ctx, transport.JSONRPCRequest{
+			JSONRPC: mcp.JSONRPC_VERSION,
+			ID:      mcp.NewRequestId(1),
+			Method:  string(mcp.MethodToolsList),
+		})
+
+		return err
+	}
+
+	first := acquire("g1")
+	require.NoError(t, listTools(t.Context(), first))
+
+	// the process in use is kept, the request fails once it waited too long
+	second := acquire("g2")
+
+	ctx, cancel := context.WithTimeout(t.Context(), 100*time.Millisecond)
+	defer cancel()
+
+	require.ErrorIs(t, listTools(ctx, second), errStdioProcessLimit)
+
+	// the released process is shut down for the waiting request
+	errCh := make(chan error, 1)
+
+	go func() {
+		errCh <- listTools(t.Context(), second)
+	}()
+
+	time.Sleep(50 * time.Millisecond)
+	first.release()
+
+	require.NoError(t, <-errCh)
+	assert.Nil(t, first.client)
+	assert.NotNil(t, second.client)
+
+	second.release()
+
+	pool.mu.Lock()
+	defer pool.mu.Unlock()
+
+	assert.Equal(t, 1, pool.running)
+	assert.NotContains(t, pool.processes, "stdio-test:g1:"+first.spec.hash())
+}
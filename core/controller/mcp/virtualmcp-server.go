@@ -0,0 +1,529 @@
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/bytedance/sonic"
+	"github.com/bytedance/sonic/ast"
+	"github.com/gin-gonic/gin"
+	"github.com/labring/aiproxy/core/middleware"
+	"github.com/labring/aiproxy/core/model"
+	mcpservers "github.com/labring/aiproxy/mcp-servers"
+	"github.com/mark3labs/mcp-go/client/transport"
+	"github.com/mark3labs/mcp-go/mcp"
+	log "github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+const (
+	virtualMCPType    = "mcp_virtual"
+	virtualMCPVersion = "1.0.0"
+)
+
+// virtualConnectFunc connects to a server of a virtual mcp, the returned
+// func releases the connection
+type virtualConnectFunc func(config model.VirtualMCPServer) (mcpservers.Server, func(), error)
+
+// virtualMember is a server of a virtual mcp, it is connected on first use
+type virtualMember struct {
+	config model.VirtualMCPServer
+
+	once   sync.Once
+	server mcpservers.Server
+	close  func()
+	err    error
+}
+
+// virtualServer merges the tools of several servers into one server, the
+// tools/call requests are routed to the server owning the tool
+type virtualServer struct {
+	name    string
+	members []*virtualMember
+	connect virtualConnectFunc
+}
+
+func newVirtualServer(name string, configs []model.VirtualMCPServer, connect virtualConnectFunc) *virtualServer {
+	members := make([]*virtualMember, len(configs))
+	for i, config := range configs {
+		members[i] = &virtualMember{config: config}
+	}
+
+	return &virtualServer{
+		name:    name,
+		members: members,
+		connect: connect,
+	}
+}
+
+func (s *virtualServer) memberServer(m *virtualMember) (mcpservers.Server, error) {
+	m.once.Do(func() {
+		m.server, m.close, m.err = s.connect(m.config)
+	})
+
+	return m.server, m.err
+}
+
+// Close releases the connections of the members
+func (s *virtualServer) Close() {
+	for _, m := range s.members {
+		m.once.Do(func() {
+			m.err = errors.New("virtual mcp is closed")
+		})
+
+		if m.close != nil {
+			m.close()
+		}
+	}
+}
+
+type virtualRequest struct {
+	ID     any    `json:"id"`
+	Method string `json:"method"`
+	Params struct {
+		Name            string `json:"name"`
+		ProtocolVersion string `json:"protocolVersion"`
+	} `json:"params"`
+}
+
+func (s *virtualServer) HandleMessage(
+	ctx context.Context,
+	message json.RawMessage,
+) mcp.JSONRPCMessage {
+	var req virtualRequest
+	if err := sonic.Unmarshal(message, &req); err != nil {
+		return mcpservers.CreateMCPErrorResponse(nil, mcp.PARSE_ERROR, err.Error())
+	}
+
+	if strings.HasPrefix(req.Method, "notifications/") {
+		return nil
+	}
+
+	switch req.Method {
+	case string(mcp.MethodInitialize):
+		protocolVersion := req.Params.ProtocolVersion
+		if protocolVersion == "" {
+			protocolVersion = mcp.LATEST_PROTOCOL_VERSION
+		}
+
+		return s.result(req.ID, mcp.InitializeResult{
+			ProtocolVersion: protocolVersion,
+			Capabilities: mcp.ServerCapabilities{
+				Tools: &struct {
+					ListChanged bool `json:"listChanged,omitempty"`
+				}{},
+			},
+			ServerInfo: mcp.Implementation{
+				Name:    s.name,
+				Version: virtualMCPVersion,
+			},
+		})
+	case string(mcp.MethodPing):
+		return s.result(req.ID, struct{}{})
+	case string(mcp.MethodToolsList):
+		return s.result(req.ID, mcp.ListToolsResult{Tools: s.listTools(ctx)})
+	case string(mcp.MethodToolsCall):
+		return s.callTool(ctx, req, message)
+	default:
+		return mcpservers.CreateMCPErrorResponse(
+			req.ID,
+			mcp.METHOD_NOT_FOUND,
+			"method not found: "+req.Method,
+		)
+	}
+}
+
+func (s *virtualServer) result(id, result any) mcp.JSONRPCMessage {
+	data, err := sonic.Marshal(result)
+	if err != nil {
+		return mcpservers.CreateMCPErrorResponse(id, mcp.INTERNAL_ERROR, err.Error())
+	}
+
+	return mcpservers.CreateMCPResultResponse(id, data)
+}
+
+// listTools lists the tools of all the members, the members failing to list
+// their tools are left out so that they do not take the others down
+func (s *virtualServer) listTools(ctx context.Context) []mcp.Tool {
+	lists := make([][]mcp.Tool, len(s.members))
+
+	var wg sync.WaitGroup
+	for i, m := range s.members {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			server, err := s.memberServer(m)
+			if err != nil {
+				log.Warnf("virtual mcp %s connect %s failed: %v", s.name, m.config.ID, err)
+				return
+			}
+
+			tools, err := mcpservers.ListServerTools(ctx, server)
+			if err != nil {
+				log.Warnf("virtual mcp %s list %s tools failed: %v", s.name, m.config.ID, err)
+				return
+			}
+
+			lists[i] = tools
+		}()
+	}
+
+	wg.Wait()
+
+	seen := make(map[string]struct{})
+	tools := make([]mcp.Tool, 0)
+
+	for i, list := range lists {
+		for _, tool := range list {
+			name, ok := s.members[i].config.ToolName(tool.Name)
+			if !ok {
+				continue
+			}
+
+			if _, ok := seen[name]; ok {
+				log.Warnf("virtual mcp %s tool %s is duplicated", s.name, name)
+				continue
+			}
+
+			seen[name] = struct{}{}
+			tool.Name = name
+			tools = append(tools, tool)
+		}
+	}
+
+	return tools
+}
+
+// route returns the member owning the tool and the name of the tool in the
+// member
+func (s *virtualServer) route(name string) (*virtualMember, string, bool) {
+	configs := make([]model.VirtualMCPServer, len(s.members))
+	for i, m := range s.members {
+		configs[i] = m.config
+	}
+
+	i, tool, ok := model.RouteVirtualMCPTool(configs, name)
+	if !ok {
+		return nil, "", false
+	}
+
+	return s.members[i], tool, true
+}
+
+func (s *virtualServer) callTool(
+	ctx context.Context,
+	req virtualRequest,
+	message json.RawMessage,
+) mcp.JSONRPCMessage {
+	member, tool, ok := s.route(req.Params.Name)
+	if !ok {
+		return mcpservers.CreateMCPErrorResponse(
+			req.ID,
+			mcp.INVALID_PARAMS,
+			"tool not found: "+req.Params.Name,
+		)
+	}
+
+	server, err := s.memberServer(member)
+	if err != nil {
+		return mcpservers.CreateMCPErrorResponse(req.ID, mcp.INTERNAL_ERROR, err.Error())
+	}
+
+	node, err := sonic.Get(message)
+	if err != nil {
+		return mcpservers.CreateMCPErrorResponse(req.ID, mcp.PARSE_ERROR, err.Error())
+	}
+
+	params := node.Get("params")
+	if _, err := params.Set("name", ast.NewString(tool)); err != nil {
+		return mcpservers.CreateMCPErrorResponse(req.ID, mcp.INVALID_PARAMS, err.Error())
+	}
+
+	forward, err := node.MarshalJSON()
+	if err != nil {
+		return mcpservers.CreateMCPErrorResponse(req.ID, mcp.INTERNAL_ERROR, err.Error())
+	}
+
+	return server.HandleMessage(ctx, forward)
+}
+
+// newVirtualMCPServer connects the servers of the virtual mcp for the group,
+// each server bills its tools/call with its own price
+func newVirtualMCPServer(
+	c *gin.Context,
+	virtualMcp *model.VirtualMCP,
+	groupID string,
+) *virtualServer {
+	name := virtualMcp.Name
+	if name == "" {
+		name = virtualMcp.ID
+	}
+
+	return newVirtualServer(
+		name,
+		virtualMcp.Servers,
+		func(config model.VirtualMCPServer) (mcpservers.Server, func(), error) {
+			switch config.Type {
+			case model.VirtualMCPServerTypePublic:
+				return connectVirtualPublicMCP(c, config.ID, groupID)
+			case model.VirtualMCPServerTypeGroup:
+				return connectVirtualGroupMCP(c, config.ID, groupID)
+			case model.VirtualMCPServerTypeEmbed:
+				return connectVirtualEmbedMCP(c, config, groupID)
+			default:
+				return nil, nil, fmt.Errorf("unknown virtual mcp server type: %s", config.Type)
+			}
+		},
+	)
+}
+
+// NewToolsServer connects the servers whose tools are attached to a relay
+// request, the tools/call are billed to the group of the request
+func NewToolsServer(
+	c *gin.Context,
+	servers []model.VirtualMCPServer,
+) (mcpservers.Server, func()) {
+	server := newVirtualMCPServer(
+		c,
+		&model.VirtualMCP{ID: "mcp-tools", Servers: servers},
+		middleware.GetGroup(c).ID,
+	)
+
+	return server, server.Close
+}
+
+func connectVirtualPublicMCP(
+	c *gin.Context,
+	mcpID, groupID string,
+) (mcpservers.Server, func(), error) {
+	publicMcp, err := model.CacheGetPublicMCP(mcpID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if publicMcp.Status != model.PublicMCPStatusEnabled {
+		return nil, nil, fmt.Errorf("mcp %s is not enabled", mcpID)
+	}
+
+	paramsFunc := newGroupParams(publicMcp.ID, groupID)
+
+	var (
+		server mcpservers.Server
+		client transport.Interface
+	)
+
+	switch publicMcp.Type {
+	case model.PublicMCPTypeProxySSE:
+		client, err = createProxySSEClient(c, publicMcp, paramsFunc)
+	case model.PublicMCPTypeProxyStreamable:
+		client, err = createProxyStreamableClient(c, publicMcp, paramsFunc)
+	case model.PublicMCPTypeOpenAPI:
+		server, err = newOpenAPIMCPServer(publicMcp.OpenAPIConfig)
+	case model.PublicMCPTypeEmbed:
+		var reusingConfig map[string]string
+
+		reusingConfig, err = prepareEmbedReusingConfig(
+			publicMcp.ID,
+			paramsFunc,
+			publicMcp.EmbedConfig.Reusing,
+		)
+		if err == nil {
+			server, err = mcpservers.GetMCPServer(
+				publicMcp.ID,
+				publicMcp.EmbedConfig.Init,
+				reusingConfig,
+			)
+		}
+	case model.PublicMCPTypeStdio:
+		server, err = newStdioMCPServer(publicMcp, groupID, paramsFunc)
+	default:
+		err = fmt.Errorf("mcp %s type %s is not supported", mcpID, publicMcp.Type)
+	}
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	closeFunc := func() {}
+	if client != nil {
+		server = mcpservers.WrapMCPClient2Server(client)
+		closeFunc = func() { _ = client.Close() }
+	}
+
+	billing := newToolsCallBilling(c, publicMcp.ID, string(publicMcp.Type), publicMcp.Price)
+
+	return billing.wrap(server), closeFunc, nil
+}
+
+func connectVirtualGroupMCP(
+	c *gin.Context,
+	mcpID, groupID string,
+) (mcpservers.Server, func(), error) {
+	groupMcp, err := model.CacheGetGroupMCP(groupID, mcpID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if groupMcp.Status != model.GroupMCPStatusEnabled {
+		return nil, nil, fmt.Errorf("mcp %s is not enabled", mcpID)
+	}
+
+	var (
+		server mcpservers.Server
+		client transport.Interface
+	)
+
+	switch groupMcp.Type {
+	case model.GroupMCPTypeProxySSE:
+		client, err = transport.NewSSE(
+			groupMcp.ProxyConfig.URL,
+			transport.WithHeaders(groupMcp.ProxyConfig.Headers),
+		)
+	case model.GroupMCPTypeProxyStreamable:
+		client, err = transport.NewStreamableHTTP(
+			groupMcp.ProxyConfig.URL,
+			transport.WithHTTPHeaders(groupMcp.ProxyConfig.Headers),
+		)
+	case model.GroupMCPTypeOpenAPI:
+		server, err = newOpenAPIMCPServer(groupMcp.OpenAPIConfig)
+	default:
+		err = fmt.Errorf("mcp %s type %s is not supported", mcpID, groupMcp.Type)
+	}
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	closeFunc := func() {}
+
+	if client != nil {
+		if err := client.Start(c.Request.Context()); err != nil {
+			return nil, nil, err
+		}
+
+		server = mcpservers.WrapMCPClient2Server(client)
+		closeFunc = func() { _ = client.Close() }
+	}
+
+	billing := newToolsCallBilling(c, groupMcp.ID, string(groupMcp.Type), groupMcp.Price)
+
+	return billing.wrap(server), closeFunc, nil
+}
+
+// connectVirtualEmbedMCP creates an embed server with the init config of the
+// virtual mcp, the reusing config is the reusing params of the group. the
+// embed server must be an enabled public mcp and its calls are billed at the
+// price of the public mcp
+func connectVirtualEmbedMCP(
+	c *gin.Context,
+	config model.VirtualMCPServer,
+	groupID string,
+) (mcpservers.Server, func(), error) {
+	publicMcp, err := getEnabledEmbedPublicMCP(config.ID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	params, err := model.CacheGetPublicMCPReusingParam(publicMcp.ID, groupID)
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil, err
+	}
+
+	server, err := mcpservers.GetMCPServer(publicMcp.ID, config.Config, params.Params)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	billing := newToolsCallBilling(c, publicMcp.ID, string(publicMcp.Type), publicMcp.Price)
+
+	return billing.wrap(server), func() {}, nil
+}
+
+// getEnabledEmbedPublicMCP returns the public mcp of an embed server, the
+// embed servers are only usable through an enabled public mcp
+func getEnabledEmbedPublicMCP(mcpID string) (*model.PublicMCPCache, error) {
+	publicMcp, err := model.CacheGetPublicMCP(mcpID)
+	if err != nil {
+		return nil, err
+	}
+
+	if publicMcp.Status != model.PublicMCPStatusEnabled {
+		return nil, fmt.Errorf("mcp %s is not enabled", mcpID)
+	}
+
+	if publicMcp.Type != model.PublicMCPTypeEmbed {
+		return nil, fmt.Errorf("mcp %s is not an embed mcp", mcpID)
+	}
+
+	return publicMcp, nil
+}
+
+func getEnabledVirtualMCP(c *gin.Context) (*model.VirtualMCP, string, error) {
+	mcpID := c.Param("id")
+	if mcpID == "" {
+		return nil, "", errors.New("mcp id is required")
+	}
+
+	group := middleware.GetGroup(c)
+
+	virtualMcp, err := model.CacheGetVirtualMCP(group.ID, mcpID)
+	if err != nil {
+		return nil, "", err
+	}
+
+	if virtualMcp.Status != model.VirtualMCPStatusEnabled {
+		return nil, "", errors.New("mcp is not enabled")
+	}
+
+	return virtualMcp, group.ID, nil
+}
+
+// VirtualMCPSSEServer godoc
+//
+//	@Summary	Virtual MCP SSE Server
+//	@Security	ApiKeyAuth
+//	@Router		/mcp/virtual/{id}/sse [get]
+func VirtualMCPSSEServer(c *gin.Context) {
+	virtualMcp, groupID, err := getEnabledVirtualMCP(c)
+	if err != nil {
+		http.Error(c.Writer, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	server := newVirtualMCPServer(c, virtualMcp, groupID)
+	defer server.Close()
+
+	handleSSEMCPServer(c, server, virtualMCPType, sseEndpoint, nil)
+}
+
+// VirtualMCPStreamable godoc
+//
+//	@Summary	Virtual MCP Streamable Server
+//	@Security	ApiKeyAuth
+//	@Router		/mcp/virtual/{id} [get]
+//	@Router		/mcp/virtual/{id} [post]
+//	@Router		/mcp/virtual/{id} [delete]
+func VirtualMCPStreamable(c *gin.Context) {
+	virtualMcp, groupID, err := getEnabledVirtualMCP(c)
+	if err != nil {
+		c.JSON(http.StatusNotFound, mcpservers.CreateMCPErrorResponse(
+			mcp.NewRequestId(nil),
+			mcp.INVALID_REQUEST,
+			err.Error(),
+		))
+
+		return
+	}
+
+	server := newVirtualMCPServer(c, virtualMcp, groupID)
+	defer server.Close()
+
+	handleStreamableMCPServer(c, server, nil)
+}
@@ -0,0 +1,222 @@
+//nolint:testpackage
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"github.com/bytedance/sonic"
+	"github.com/labring/aiproxy/core/common"
+	"github.com/labring/aiproxy/core/model"
+	mcpservers "github.com/labring/aiproxy/mcp-servers"
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// toolsServer lists its tools and answers the calls with the name of the
+// called tool
+type toolsServer struct {
+	tools []string
+}
+
+func (s *toolsServer) HandleMessage(
+	_ context.Context,
+	message json.RawMessage,
+) mcp.JSONRPCMessage {
+	var req virtualRequest
+	if err := sonic.Unmarshal(message, &req); err != nil {
+		return mcpservers.CreateMCPErrorResponse(nil, mcp.PARSE_ERROR, err.Error())
+	}
+
+	var result any
+
+	switch req.Method {
+	case string(mcp.MethodInitialize):
+		result = mcp.InitializeResult{ProtocolVersion: mcp.LATEST_PROTOCOL_VERSION}
+	case string(mcp.MethodToolsList):
+		tools := make([]mcp.Tool, len(s.tools))
+		for i, name := range s.tools {
+			tools[i] = mcp.NewTool(name)
+		}
+
+		result = mcp.ListToolsResult{Tools: tools}
+	case string(mcp.MethodToolsCall):
+		result = mcp.NewToolResultText(req.Params.Name)
+	default:
+		return nil
+	}
+
+	data, _ := sonic.Marshal(result)
+
+	return mcpservers.CreateMCPResultResponse(req.ID, data)
+}
+
+func newTestVirtualServer(t *testing.T) *virtualServer {
+	t.Helper()
+
+	members := map[string]mcpservers.Server{
+		"github": &toolsServer{tools: []string{"search", "create_issue", "delete_repo"}},
+		"gitlab": &toolsServer{tools: []string{"search"}},
+		"jira":   &toolsServer{tools: []string{"search"}},
+	}
+
+	return newVirtualServer("dev", []model.VirtualMCPServer{
+		{
+			Type:   model.VirtualMCPServerTypePublic,
+			ID:     "github",
+			Tools:  []string{"search", "create_issue"},
+			Rename: map[string]string{"create_issue": "open_issue"},
+		},
+		{
+			Type:      model.VirtualMCPServerTypeGroup,
+			ID:        "gitlab",
+			Namespace: "gl",
+		},
+		{
+			Type: model.VirtualMCPServerTypeEmbed,
+			ID:   "broken",
+		},
+	}, func(config model.VirtualMCPServer) (mcpservers.Server, func(), error) {
+		server, ok := members[config.ID]
+		if !ok {
+			return nil, nil, errors.New("connect failed")
+		}
+
+		return server, func() {}, nil
+	})
+}
+
+func handleVirtualMessage(t *testing.T, server mcpservers.Server, message string) string {
+	t.Helper()
+
+	resp := server.HandleMessage(t.Context(), json.RawMessage(message))
+	data, err := sonic.Marshal(resp)
+	require.NoError(t, err)
+
+	return string(data)
+}
+
+func TestVirtualMCPListTools(t *testing.T) {
+	server := newTestVirtualServer(t)
+	defer server.Close()
+
+	resp := handleVirtualMessage(t, server, `{"jsonrpc":"2.0","id":1,"method":"tools/list"}`)
+
+	var result struct {
+		Result mcp.ListToolsResult `json:"result"`
+	}
+	require.NoError(t, sonic.UnmarshalString(resp, &result), resp)
+
+	names := make([]string, 0, len(result.Result.Tools))
+	for _, tool := range result.Result.Tools {
+		names = append(names, tool.Name)
+	}
+
+	// the broken server is left out
+	assert.Equal(t, []string{"github__search", "open_issue", "gl__search"}, names)
+}
+
+func TestVirtualMCPCallTool(t *testing.T) {
+	server := newTestVirtualServer(t)
+	defer server.Close()
+
+	call := func(name string) string {
+		return handleVirtualMessage(
+			t,
+			server,
+			`{"jsonrpc":"2.0","id":1,"method":"tools/call","params":{"name":"`+name+`","arguments":{}}}`,
+		)
+	}
+
+	assert.Contains(t, call("github__search"), `"text":"search"`)
+	assert.Contains(t, call("open_issue"), `"text":"create_issue"`)
+	assert.Contains(t, call("gl__search"), `"text":"search"`)
+
+	// the tools not allowed, renamed away or of an unknown namespace
+	for _, name := range []string{
+		"github__delete_repo",
+		"github__create_issue",
+		"gitlab__search",
+		"search",
+	} {
+		assert.Contains(t, call(name), `"code":-32602`, name)
+	}
+
+	assert.Contains(t, call("broken__search"), `"code":-32603`)
+}
+
+func TestVirtualMCPInitialize(t *testing.T) {
+	server := newTestVirtualServer(t)
+	defer server.Close()
+
+	resp := handleVirtualMessage(
+		t,
+		server,
+		`{"jsonrpc":"2.0","id":"init","method":"initialize","params":{"protocolVersion":"2025-03-26"}}`,
+	)
+	assert.Contains(t, resp, `"protocolVersion":"2025-03-26"`)
+	assert.Contains(t, resp, `"name":"dev"`)
+	assert.Contains(t, resp, `"tools":{}`)
+
+	assert.Nil(t, server.HandleMessage(
+		t.Context(),
+		json.RawMessage(`{"jsonrpc":"2.0","method":"notifications/initialized"}`),
+	))
+}
+
+func setupPublicMCPTestDB(t *testing.T, mcps ...*model.PublicMCP) {
+	t.Helper()
+
+	prevDB := model.DB
+	prevUsingSQLite := common.UsingSQLite
+
+	testDB, err := model.OpenSQLite(filepath.Join(t.TempDir(), "mcp.db"))
+	require.NoError(t, err)
+
+	model.DB = testDB
+	common.UsingSQLite = true
+
+	t.Cleanup(func() {
+		model.DB = prevDB
+		common.UsingSQLite = prevUsingSQLite
+	})
+
+	require.NoError(t, testDB.AutoMigrate(&model.PublicMCP{}))
+
+	for _, mcp := range mcps {
+		require.NoError(t, testDB.Create(mcp).Error)
+	}
+}
+
+func TestGetEnabledEmbedPublicMCP(t *testing.T) {
+	setupPublicMCPTestDB(
+		t,
+		&model.PublicMCP{
+			ID:    "embed-enabled",
+			Type:  model.PublicMCPTypeEmbed,
+			Price: model.MCPPrice{DefaultToolsCallPrice: 0.5},
+		},
+		&model.PublicMCP{
+			ID:     "embed-disabled",
+			Type:   model.PublicMCPTypeEmbed,
+			Status: model.PublicMCPStatusDisabled,
+		},
+		&model.PublicMCP{
+			ID:   "embed-proxy",
+			Type: model.PublicMCPTypeProxySSE,
+		},
+	)
+
+	publicMcp, err := getEnabledEmbedPublicMCP("embed-enabled")
+	require.NoError(t, err)
+	assert.InDelta(t, 0.5, publicMcp.Price.DefaultToolsCallPrice, 1e-9)
+
+	for _, id := range []string{"embed-disabled", "embed-proxy", "embed-missing"} {
+		_, err := getEnabledEmbedPublicMCP(id)
+		require.Error(t, err, id)
+	}
+}
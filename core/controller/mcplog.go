@@ -0,0 +1,335 @@
+package controller
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/labring/aiproxy/core/controller/utils"
+	"github.com/labring/aiproxy/core/middleware"
+	"github.com/labring/aiproxy/core/model"
+)
+
+func parseMCPLogFilter(c *gin.Context) model.MCPLogFilter {
+	tokenID, _ := strconv.Atoi(c.Query("token_id"))
+	code, _ := strconv.Atoi(c.Query("code"))
+
+	return model.MCPLogFilter{
+		Group:     c.Query("group"),
+		Keyword:   c.Query("keyword"),
+		TokenID:   tokenID,
+		TokenName: c.Query("token_name"),
+		MCPID:     c.Query("mcp_id"),
+		SessionID: c.Query("session_id"),
+		Method:    c.Query("method"),
+		ToolName:  c.Query("tool_name"),
+		IP:        c.Query("ip"),
+		CodeType:  model.CodeType(c.Query("code_type")),
+		Code:      code,
+	}
+}
+
+// SearchMCPLogs godoc
+//
+//	@Summary		Search mcp logs
+//	@Description	Search the logs of the json-rpc requests sent to the mcp servers
+//	@Tags			mcp_logs
+//	@Produce		json
+//	@Security		ApiKeyAuth
+//	@Param			keyword			query		string	false	"Keyword"
+//	@Param			page			query		int		false	"Page number"
+//	@Param			per_page		query		int		false	"Items per page"
+//	@Param			start_timestamp	query		int		false	"Start timestamp (milliseconds)"
+//	@Param			end_timestamp	query		int		false	"End timestamp (milliseconds)"
+//	@Param			group			query		string	false	"Group name"
+//	@Param			token_id		query		int		false	"Token ID"
+//	@Param			token_name		query		string	false	"Token name"
+//	@Param			mcp_id			query		string	false	"MCP ID"
+//	@Param			session_id		query		string	false	"Session ID"
+//	@Param			method			query		string	false	"JSON-RPC method"
+//	@Param			tool_name		query		string	false	"Tool name"
+//	@Param			order			query		string	false	"Order"
+//	@Param			code_type		query		string	false	"Status code type"
+//	@Param			code			query		int		false	"Status code"
+//	@Param			include_detail	query		bool	false	"Include arguments and result"
+//	@Param			ip				query		string	false	"IP"
+//	@Success		200				{object}	middleware.APIResponse{data=model.GetMCPLogsResult}
+//	@Router			/api/mcp_logs/search [get]
+func SearchMCPLogs(c *gin.Context) {
+	page, perPage := utils.ParsePageParams(c)
+	filter := parseMCPLogFilter(c)
+	filter.StartTimestamp, filter.EndTimestamp = utils.ParseTimeRange(c, 0)
+	includeDetail, _ := strconv.ParseBool(c.Query("include_detail"))
+
+	result, err := model.SearchMCPLogs(
+		filter,
+		c.Query("order"),
+		includeDetail,
+		page,
+		perPage,
+	)
+	if err != nil {
+		middleware.ErrorResponse(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	middleware.SuccessResponse(c, result)
+}
+
+// SearchGroupMCPLogs godoc
+//
+//	@Summary		Search group mcp logs
+//	@Description	Search the logs of the json-rpc requests sent to the mcp servers by a group
+//	@Tags			mcp_log
+//	@Produce		json
+//	@Security		ApiKeyAuth
+//	@Param			group			path		string	true	"Group name"
+//	@Param			keyword			query		string	false	"Keyword"
+//	@Param			page			query		int		false	"Page number"
+//	@Param			per_page		query		int		false	"Items per page"
+//	@Param			start_timestamp	query		int		false	"Start timestamp (milliseconds)"
+//	@Param			end_timestamp	query		int		false	"End timestamp (milliseconds)"
+//	@Param			token_id		query		int		false	"Token ID"
+//	@Param			token_name		query		string	false	"Token name"
+//	@Param			mcp_id			query		string	false	"MCP ID"
+//	@Param			session_id		query		string	false	"Session ID"
+//	@Param			method			query		string	false	"JSON-RPC method"
+//	@Param			tool_name		query		string	false	"Tool name"
+//	@Param			order			query		string	false	"Order"
+//	@Param			code_type		query		string	false	"Status code type"
+//	@Param			code			query		int		false	"Status code"
+//	@Param			include_detail	query		bool	false	"Include arguments and result"
+//	@Param			ip				query		string	false	"IP"
+//	@Success		200				{object}	middleware.APIResponse{data=model.GetMCPLogsResult}
+//	@Router			/api/mcp_log/{group}/search [get]
+func SearchGroupMCPLogs(c *gin.Context) {
+	group := c.Param("group")
+	if group == "" {
+		middleware.ErrorResponse(c, http.StatusBadRequest, "invalid group parameter")
+		return
+	}
+
+	page, perPage := utils.ParsePageParams(c)
+	filter := parseMCPLogFilter(c)
+	filter.StartTimestamp, filter.EndTimestamp = utils.ParseTimeRange(c, 0)
+	includeDetail, _ := strconv.ParseBool(c.Query("include_detail"))
+
+	result, err := model.SearchGroupMCPLogs(
+		group,
+		filter,
+		c.Query("order"),
+		includeDetail,
+		page,
+		perPage,
+	)
+	if err != nil {
+		middleware.ErrorResponse(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	middleware.SuccessResponse(c, result)
+}
+
+// ExportMCPLogs godoc
+//
+//	@Summary		Export mcp logs
+//	@Description	Streams filtered mcp logs as a CSV table file
+//	@Tags			mcp_logs
+//	@Produce		text/csv
+//	@Security		ApiKeyAuth
+//	@Param			start_timestamp	query	int		false	"Start timestamp, max span 30 days"
+//	@Param			end_timestamp	query	int		false	"End timestamp, max span 30 days"
+//	@Param			group			query	string	false	"Group name"
+//	@Param			token_id		query	int		false	"Token ID"
+//	@Param			token_name		query	string	false	"Token name"
+//	@Param			mcp_id			query	string	false	"MCP ID"
+//	@Param			session_id		query	string	false	"Session ID"
+//	@Param			method			query	string	false	"JSON-RPC method"
+//	@Param			tool_name		query	string	false	"Tool name"
+//	@Param			order			query	string	false	"Sort order for created_at, supports desc or asc"
+//	@Param			code_type		query	string	false	"Status code type"
+//	@Param			code			query	int		false	"Status code"
+//	@Param			include_detail	query	bool	false	"Include arguments and result, default false"
+//	@Param			ip				query	string	false	"IP"
+//	@Param			timezone		query	string	false	"Timezone, default is Local"
+//	@Param			max_entries		query	int		false	"Maximum exported rows; zero or negative means unlimited"
+//	@Param			chunk_interval	query	string	false	"Chunk interval, default 30m, min 10m, max 4h, e.g. 10m, 30m, 1h"
+//	@Router			/api/mcp_logs/export [get]
+func ExportMCPLogs(c *gin.Context) {
+	params, err := parseLogExportParams(c)
+	if err != nil {
+		middleware.ErrorResponse(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	filter := parseMCPLogFilter(c)
+	filter.Keyword = ""
+
+	filename := buildLogExportFilename("global_mcp", "", params.location)
+	streamMCPLogCSV(
+		c,
+		filename,
+		params,
+		func(start, endExclusive time.Time, limit int) ([]*model.MCPLog, error) {
+			return model.ExportMCPLogsRange(
+				filter,
+				start,
+				endExclusive,
+				normalizeLogExportModelOrder(params.order),
+				params.includeDetail,
+				limit,
+			)
+		},
+	)
+}
+
+// ExportGroupMCPLogs godoc
+//
+//	@Summary		Export group mcp logs
+//	@Description	Streams filtered group mcp logs as a CSV table file
+//	@Tags			mcp_log
+//	@Produce		text/csv
+//	@Security		ApiKeyAuth
+//	@Param			group			path	string	true	"Group name"
+//	@Param			start_timestamp	query	int		false	"Start timestamp, max span 30 days"
+//	@Param			end_timestamp	query	int		false	"End timestamp, max span 30 days"
+//	@Param			token_id		query	int		false	"Token ID"
+//	@Param			token_name		query	string	false	"Token name"
+//	@Param			mcp_id			query	string	false	"MCP ID"
+//	@Param			session_id		query	string	false	"Session ID"
+//	@Param			method			query	string	false	"JSON-RPC method"
+//	@Param			tool_name		query	string	false	"Tool name"
+//	@Param			order			query	string	false	"Sort order for created_at, supports desc or asc"
+//	@Param			code_type		query	string	false	"Status code type"
+//	@Param			code			query	int		false	"Status code"
+//	@Param			include_detail	query	bool	false	"Include arguments and result, default false"
+//	@Param			ip				query	string	false	"IP"
+//	@Param			timezone		query	string	false	"Timezone, default is Local"
+//	@Param			max_entries		query	int		false	"Maximum exported rows; zero or negative means unlimited"
+//	@Param			chunk_interval	query	string	false	"Chunk interval, default 30m, min 10m, max 4h, e.g. 10m, 30m, 1h"
+//	@Router			/api/mcp_log/{group}/export [get]
+func ExportGroupMCPLogs(c *gin.Context) {
+	group := c.Param("group")
+	if group == "" {
+		middleware.ErrorResponse(c, http.StatusBadRequest, "invalid group parameter")
+		return
+	}
+
+	params, err := parseLogExportParams(c)
+	if err != nil {
+		middleware.ErrorResponse(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	filter := parseMCPLogFilter(c)
+	filter.Keyword = ""
+
+	filename := buildLogExportFilename("group_mcp_"+group, group, params.location)
+	streamMCPLogCSV(
+		c,
+		filename,
+		params,
+		func(start, endExclusive time.Time, limit int) ([]*model.MCPLog, error) {
+			return model.ExportGroupMCPLogsRange(
+				group,
+				filter,
+				start,
+				endExclusive,
+				normalizeLogExportModelOrder(params.order),
+				params.includeDetail,
+				limit,
+			)
+		},
+	)
+}
+
+func streamMCPLogCSV(
+	c *gin.Context,
+	filename string,
+	params logExportParams,
+	fetch func(start, endExclusive time.Time, limit int) ([]*model.MCPLog, error),
+) {
+	streamCSV(
+		c,
+		filename,
+		params,
+		buildMCPLogExportHeader(),
+		func(logItem *model.MCPLog) []string {
+			return buildMCPLogExportRow(logItem, params.location)
+		},
+		fetch,
+	)
+}
+
+func buildMCPLogExportHeader() []string {
+	return []string{
+		"id",
+		"end_time",
+		"request_at",
+		"group",
+		"token_id",
+		"token_name",
+		"mcp_id",
+		"mcp_type",
+		"session_id",
+		"method",
+		"tool_name",
+		"code",
+		"duration_milliseconds",
+		"endpoint",
+		"ip",
+		"error",
+		"arguments",
+		"result",
+	}
+}
+
+func buildMCPLogExportRow(logItem *model.MCPLog, location *time.Location) []string {
+	return []string{
+		strconv.Itoa(logItem.ID),
+		formatTimeForExport(logItem.CreatedAt, location),
+		formatTimeForExport(logItem.RequestAt, location),
+		sanitizeCSVCell(logItem.GroupID),
+		strconv.Itoa(logItem.TokenID),
+		sanitizeCSVCell(logItem.TokenName),
+		sanitizeCSVCell(logItem.MCPID),
+		sanitizeCSVCell(logItem.MCPType),
+		sanitizeCSVCell(logItem.SessionID.String()),
+		sanitizeCSVCell(logItem.Method),
+		sanitizeCSVCell(logItem.ToolName.String()),
+		strconv.Itoa(logItem.Code),
+		strconv.FormatInt(logItem.DurationMilliseconds, 10),
+		sanitizeCSVCell(logItem.Endpoint.String()),
+		sanitizeCSVCell(logItem.IP.String()),
+		sanitizeCSVCell(logItem.Error.String()),
+		sanitizeCSVCell(logItem.Arguments),
+		sanitizeCSVCell(logItem.Result),
+	}
+}
+
+// DeleteHistoryMCPLogs godoc
+//
+//	@Summary		Delete historical mcp logs
+//	@Description	Deletes the mcp logs created before the timestamp
+//	@Tags			mcp_logs
+//	@Produce		json
+//	@Security		ApiKeyAuth
+//	@Param			timestamp	query		int	true	"Timestamp (milliseconds)"
+//	@Success		200			{object}	middleware.APIResponse{data=int}
+//	@Router			/api/mcp_logs/ [delete]
+func DeleteHistoryMCPLogs(c *gin.Context) {
+	timestamp, _ := strconv.ParseInt(c.Query("timestamp"), 10, 64)
+	if timestamp == 0 {
+		middleware.ErrorResponse(c, http.StatusBadRequest, "timestamp is required")
+		return
+	}
+
+	count, err := model.DeleteOldMCPLog(time.UnixMilli(timestamp))
+	if err != nil {
+		middleware.ErrorResponse(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	middleware.SuccessResponse(c, count)
+}
@@ -703,6 +703,42 @@ func GetModelsErrorRate(c *gin.Context) {
 	middleware.SuccessResponse(c, rates)
 }
 
+// GetModelChannelTTFB godoc
+//
+//	@Summary		Get model channel ttfb
+//	@Description	Returns the recent time to first byte percentiles of the channels, in milliseconds, grouped by model
+//	@Tags			monitor
+//	@Produce		json
+//	@Security		ApiKeyAuth
+//	@Param			model	query		string	false	"Model name, returns the channels of the model only"
+//	@Success		200		{object}	middleware.APIResponse{data=map[string]map[int64]monitor.LatencyPercentiles}
+//	@Router			/api/monitor/ttfb [get]
+func GetModelChannelTTFB(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	if modelName := c.Query("model"); modelName != "" {
+		latencies, err := monitor.GetModelChannelTTFB(ctx, modelName)
+		if err != nil {
+			middleware.ErrorResponse(c, http.StatusInternalServerError, err.Error())
+			return
+		}
+
+		middleware.SuccessResponse(c, map[string]map[int64]monitor.LatencyPercentiles{
+			modelName: latencies,
+		})
+
+		return
+	}
+
+	latencies, err := monitor.GetAllModelChannelTTFB(ctx)
+	if err != nil {
+		middleware.ErrorResponse(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	middleware.SuccessResponse(c, latencies)
+}
+
 // GetAllBannedModelChannels godoc
 //
 //	@Summary		Get all banned model channels
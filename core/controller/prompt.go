@@ -0,0 +1,251 @@
+package controller
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/labring/aiproxy/core/controller/utils"
+	"github.com/labring/aiproxy/core/middleware"
+	"github.com/labring/aiproxy/core/model"
+	"gorm.io/gorm"
+)
+
+// GetPrompts godoc
+//
+//	@Summary		Get prompts
+//	@Description	Get the latest version of the prompts of a group with pagination and filtering
+//	@Tags			prompt
+//	@Produce		json
+//	@Security		ApiKeyAuth
+//	@Param			group		path		string	true	"Group ID"
+//	@Param			page		query		int		false	"Page number"
+//	@Param			per_page	query		int		false	"Items per page"
+//	@Param			keyword		query		string	false	"Search keyword"
+//	@Success		200			{object}	middleware.APIResponse{data=map[string]any{prompts=[]model.Prompt,total=int}}
+//	@Router			/api/prompts/{group} [get]
+func GetPrompts(c *gin.Context) {
+	groupID := c.Param("group")
+	if groupID == "" {
+		middleware.ErrorResponse(c, http.StatusBadRequest, "Group ID is required")
+		return
+	}
+
+	page, perPage := utils.ParsePageParams(c)
+
+	prompts, total, err := model.GetPrompts(groupID, page, perPage, c.Query("keyword"))
+	if err != nil {
+		middleware.ErrorResponse(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	middleware.SuccessResponse(c, gin.H{
+		"prompts": prompts,
+		"total":   total,
+	})
+}
+
+// GetPrompt godoc
+//
+//	@Summary		Get a prompt
+//	@Description	Get a version of a prompt, the latest version when the version is not set
+//	@Tags			prompt
+//	@Produce		json
+//	@Security		ApiKeyAuth
+//	@Param			group	path		string	true	"Group ID"
+//	@Param			id		path		string	true	"Prompt ID"
+//	@Param			version	query		int		false	"Prompt version"
+//	@Success		200		{object}	middleware.APIResponse{data=model.Prompt}
+//	@Router			/api/prompts/{group}/{id} [get]
+func GetPrompt(c *gin.Context) {
+	id := c.Param("id")
+	groupID := c.Param("group")
+
+	if id == "" || groupID == "" {
+		middleware.ErrorResponse(c, http.StatusBadRequest, "Prompt ID and Group ID are required")
+		return
+	}
+
+	version, _ := strconv.Atoi(c.Query("version"))
+
+	prompt, err := model.GetPrompt(id, groupID, version)
+	if err != nil {
+		middleware.ErrorResponse(c, http.StatusNotFound, err.Error())
+		return
+	}
+
+	middleware.SuccessResponse(c, &prompt)
+}
+
+// GetPromptVersions godoc
+//
+//	@Summary		Get prompt versions
+//	@Description	Get all the versions of a prompt, the latest first
+//	@Tags			prompt
+//	@Produce		json
+//	@Security		ApiKeyAuth
+//	@Param			group	path		string	true	"Group ID"
+//	@Param			id		path		string	true	"Prompt ID"
+//	@Success		200		{object}	middleware.APIResponse{data=[]model.Prompt}
+//	@Router			/api/prompts/{group}/{id}/versions [get]
+func GetPromptVersions(c *gin.Context) {
+	id := c.Param("id")
+	groupID := c.Param("group")
+
+	if id == "" || groupID == "" {
+		middleware.ErrorResponse(c, http.StatusBadRequest, "Prompt ID and Group ID are required")
+		return
+	}
+
+	prompts, err := model.GetPromptVersions(id, groupID)
+	if err != nil {
+		middleware.ErrorResponse(c, http.StatusNotFound, err.Error())
+		return
+	}
+
+	middleware.SuccessResponse(c, prompts)
+}
+
+// CreatePrompt godoc
+//
+//	@Summary		Create a prompt
+//	@Description	Create the first version of a prompt
+//	@Tags			prompt
+//	@Accept			json
+//	@Produce		json
+//	@Security		ApiKeyAuth
+//	@Param			group	path		string			true	"Group ID"
+//	@Param			prompt	body		model.Prompt	true	"Prompt object"
+//	@Success		200		{object}	middleware.APIResponse{data=model.Prompt}
+//	@Router			/api/prompts/{group} [post]
+func CreatePrompt(c *gin.Context) {
+	groupID := c.Param("group")
+	if groupID == "" {
+		middleware.ErrorResponse(c, http.StatusBadRequest, "Group ID is required")
+		return
+	}
+
+	var prompt model.Prompt
+	if err := c.ShouldBindJSON(&prompt); err != nil {
+		middleware.ErrorResponse(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	prompt.GroupID = groupID
+
+	if err := model.CreatePrompt(&prompt); err != nil {
+		middleware.ErrorResponse(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	middleware.SuccessResponse(c, &prompt)
+}
+
+// UpdatePrompt godoc
+//
+//	@Summary		Update a prompt
+//	@Description	Save the prompt as a new version, the previous versions are kept
+//	@Tags			prompt
+//	@Accept			json
+//	@Produce		json
+//	@Security		ApiKeyAuth
+//	@Param			group	path		string			true	"Group ID"
+//	@Param			id		path		string			true	"Prompt ID"
+//	@Param			prompt	body		model.Prompt	true	"Prompt object"
+//	@Success		200		{object}	middleware.APIResponse{data=model.Prompt}
+//	@Router			/api/prompts/{group}/{id} [put]
+func UpdatePrompt(c *gin.Context) {
+	id := c.Param("id")
+	groupID := c.Param("group")
+
+	if id == "" || groupID == "" {
+		middleware.ErrorResponse(c, http.StatusBadRequest, "Prompt ID and Group ID are required")
+		return
+	}
+
+	var prompt model.Prompt
+	if err := c.ShouldBindJSON(&prompt); err != nil {
+		middleware.ErrorResponse(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	prompt.ID = id
+	prompt.GroupID = groupID
+
+	if err := model.CreatePromptVersion(&prompt); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			middleware.ErrorResponse(c, http.StatusNotFound, err.Error())
+			return
+		}
+
+		middleware.ErrorResponse(c, http.StatusBadRequest, err.Error())
+
+		return
+	}
+
+	middleware.SuccessResponse(c, &prompt)
+}
+
+// DeletePrompt godoc
+//
+//	@Summary		Delete a prompt
+//	@Description	Delete all the versions of a prompt
+//	@Tags			prompt
+//	@Produce		json
+//	@Security		ApiKeyAuth
+//	@Param			group	path		string	true	"Group ID"
+//	@Param			id		path		string	true	"Prompt ID"
+//	@Success		200		{object}	middleware.APIResponse
+//	@Router			/api/prompts/{group}/{id} [delete]
+func DeletePrompt(c *gin.Context) {
+	id := c.Param("id")
+	groupID := c.Param("group")
+
+	if id == "" || groupID == "" {
+		middleware.ErrorResponse(c, http.StatusBadRequest, "Prompt ID and Group ID are required")
+		return
+	}
+
+	if err := model.DeletePrompt(id, groupID); err != nil {
+		middleware.ErrorResponse(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	middleware.SuccessResponse(c, nil)
+}
+
+// DeletePromptVersion godoc
+//
+//	@Summary		Delete a prompt version
+//	@Description	Delete a version of a prompt
+//	@Tags			prompt
+//	@Produce		json
+//	@Security		ApiKeyAuth
+//	@Param			group	path		string	true	"Group ID"
+//	@Param			id		path		string	true	"Prompt ID"
+//	@Param			version	path		int		true	"Prompt version"
+//	@Success		200		{object}	middleware.APIResponse
+//	@Router			/api/prompts/{group}/{id}/versions/{version} [delete]
+func DeletePromptVersion(c *gin.Context) {
+	id := c.Param("id")
+	groupID := c.Param("group")
+
+	if id == "" || groupID == "" {
+		middleware.ErrorResponse(c, http.StatusBadRequest, "Prompt ID and Group ID are required")
+		return
+	}
+
+	version, err := strconv.Atoi(c.Param("version"))
+	if err != nil || version <= 0 {
+		middleware.ErrorResponse(c, http.StatusBadRequest, "invalid prompt version")
+		return
+	}
+
+	if err := model.DeletePromptVersion(id, groupID, version); err != nil {
+		middleware.ErrorResponse(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	middleware.SuccessResponse(c, nil)
+}
@@ -0,0 +1,33 @@
+package controller
+
+import (
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/labring/aiproxy/core/model"
+)
+
+const (
+	defaultListBatchesLimit = 20
+	maxListBatchesLimit     = 100
+)
+
+// ListBatches godoc
+//
+//	@Summary		List batches
+//	@Description	List the batches created by the current token
+//	@Tags			relay
+//	@Produce		json
+//	@Security		ApiKeyAuth
+//	@Param			limit	query		int		false	"Number of batches to return, default 20"
+//	@Param			after	query		string	false	"Cursor, the batch id to start after"
+//	@Success		200		{object}	ListObjectsResponse
+//	@Router			/v1/batches [get]
+func ListBatches(c *gin.Context) {
+	limit, _ := strconv.Atoi(c.Query("limit"))
+	if limit <= 0 || limit > maxListBatchesLimit {
+		limit = defaultListBatchesLimit
+	}
+
+	listStoredObjects(c, model.StorePrefixBatch, limit, false, nil)
+}
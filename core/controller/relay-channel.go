@@ -5,7 +5,6 @@ import (
 	"errors"
 	"fmt"
 	"math"
-	"math/rand/v2"
 	"strconv"
 
 	"github.com/gin-gonic/gin"
@@ -55,7 +54,20 @@ func adaptorSupportsMode(
 	modelName string,
 	m mode.Mode,
 ) bool {
-	return a.SupportMode(supportModeMeta(mc, channel, modelName, m))
+	if a.SupportMode(supportModeMeta(mc, channel, modelName, m)) {
+		return true
+	}
+
+	switch m {
+	// the channels that can't count tokens natively are estimated locally
+	case mode.AnthropicCountTokens:
+		return a.SupportMode(supportModeMeta(mc, channel, modelName, mode.Anthropic))
+	// the Responses API is emulated on chat completions
+	case mode.Responses, mode.ResponsesGet, mode.ResponsesDelete, mode.ResponsesInputItems:
+		return a.SupportMode(supportModeMeta(mc, channel, modelName, mode.ChatCompletions))
+	default:
+		return false
+	}
 }
 
 func GetChannelFromHeader(
@@ -121,7 +133,13 @@ func needPinChannel(m mode.Mode) bool {
 		mode.ResponsesGet,
 		mode.ResponsesDelete,
 		mode.ResponsesCancel,
-		mode.ResponsesInputItems:
+		mode.ResponsesInputItems,
+		mode.FilesGet,
+		mode.FilesDelete,
+		mode.FilesContent,
+		mode.Batches,
+		mode.BatchesGet,
+		mode.BatchesCancel:
 		return true
 	default:
 		return false
@@ -257,7 +275,7 @@ func getChannelErrorRate(errorRates map[int64]float64, channelID int64) float64
 
 func pickChannel(
 	channels []*model.Channel,
-	errorRates map[int64]float64,
+	policy *routingPolicy,
 ) (*model.Channel, error) {
 	if len(channels) == 0 {
 		return nil, ErrChannelsExhausted
@@ -267,28 +285,7 @@ func pickChannel(
 		return channels[0], nil
 	}
 
-	var totalWeight float64
-
-	cachedWeights := make([]float64, len(channels))
-	for i, ch := range channels {
-		weight := getPriorityWeight(ch, getChannelErrorRate(errorRates, int64(ch.ID)))
-		totalWeight += weight
-		cachedWeights[i] = weight
-	}
-
-	if totalWeight == 0 {
-		return channels[rand.IntN(len(channels))], nil
-	}
-
-	r := rand.Float64() * totalWeight
-	for i, ch := range channels {
-		r -= cachedWeights[i]
-		if r < 0 {
-			return ch, nil
-		}
-	}
-
-	return channels[rand.IntN(len(channels))], nil
+	return policy.pick(channels), nil
 }
 
 func getChannelWithFallback(
@@ -348,8 +345,10 @@ func getChannelWithFallback(
 		},
 	}
 
+	policy := newRoutingPolicy(cache, modelName, errorRates)
+
 	for _, step := range pipeline {
-		channel, err := pickChannel(step(), errorRates)
+		channel, err := pickChannel(step(), policy)
 		if err == nil {
 			return channel, migratedChannels, nil
 		}
@@ -392,6 +391,7 @@ type initialChannel struct {
 	preferChannelIDs  []int
 	ignoreChannelIDs  map[int64]struct{}
 	migratedChannels  []*model.Channel
+	modelCaches       *model.ModelCaches
 }
 
 func getInitialChannel(c *gin.Context, modelName string, m mode.Mode) (*initialChannel, error) {
@@ -484,6 +484,7 @@ func getInitialChannel(c *gin.Context, modelName string, m mode.Mode) (*initialC
 		preferChannelIDs: preferChannelIDs,
 		ignoreChannelIDs: ignoreChannelIDs,
 		migratedChannels: migratedChannels,
+		modelCaches:      mc,
 	}, nil
 }
 
@@ -601,10 +602,12 @@ func getPreferChannelIDs(c *gin.Context, modelName string, m mode.Mode) []int {
 	return preferChannelIDs
 }
 
-func getWebSearchChannel(
+// getPluginChannel selects a channel for the extra requests that plugins make
+func getPluginChannel(
 	ctx context.Context,
 	mc *model.ModelCaches,
 	modelName string,
+	m mode.Mode,
 ) (*model.Channel, error) {
 	ignoreChannelIDs, _ := monitor.GetBannedChannelsMapWithModel(ctx, modelName)
 	errorRates, _ := monitor.GetModelChannelErrorRate(ctx, modelName)
@@ -613,7 +616,7 @@ func getWebSearchChannel(
 		mc,
 		nil,
 		modelName,
-		mode.ChatCompletions,
+		m,
 		nil,
 		errorRates,
 		ignoreChannelIDs,
@@ -663,9 +666,13 @@ func getRetryChannel(
 		}
 	}
 
+	// the retry picks with the same model caches as the initial pick, so the routing
+	// strategy of the request doesn't change between the attempts
+	policy := newRoutingPolicy(state.modelCaches, state.meta.OriginModel, errorRates)
+
 	newChannel, err := pickChannel(
 		filteredChannels,
-		errorRates,
+		policy,
 	)
 	if err != nil {
 		if !errors.Is(err, ErrChannelsExhausted) || len(state.failedChannelIDs) == 0 {
@@ -678,7 +685,7 @@ func getRetryChannel(
 
 		return pickChannel(
 			getRetryCandidates(state, errorRates),
-			errorRates,
+			policy,
 		)
 	}
 
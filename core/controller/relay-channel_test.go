@@ -11,6 +11,7 @@ import (
 	"github.com/gin-gonic/gin"
 	"github.com/labring/aiproxy/core/middleware"
 	"github.com/labring/aiproxy/core/model"
+	"github.com/labring/aiproxy/core/relay/adaptors"
 	"github.com/labring/aiproxy/core/relay/meta"
 	"github.com/labring/aiproxy/core/relay/mode"
 	"github.com/stretchr/testify/assert"
@@ -231,6 +232,31 @@ func TestGetRetryChannelStartsNewRoundAfterCandidatesAreExhausted(t *testing.T)
 	assert.NotEqual(t, channel.ID, nextChannel.ID)
 }
 
+func TestGetRetryChannelUsesRoutingStrategy(t *testing.T) {
+	t.Parallel()
+
+	channels := newRoutingTestChannels()
+	state := &retryState{
+		meta:             meta.NewMeta(channels[1], mode.ChatCompletions, "gpt-5", model.ModelConfig{}),
+		migratedChannels: channels,
+		failedChannelIDs: map[int64]struct{}{2: {}},
+		modelCaches: &model.ModelCaches{
+			ModelConfig: testModelConfigCache{
+				"gpt-5": {
+					Model:           "gpt-5",
+					RoutingStrategy: model.RoutingStrategyPriority,
+				},
+			},
+		},
+	}
+
+	for range 10 {
+		channel, err := getRetryChannel(context.Background(), state)
+		require.NoError(t, err)
+		assert.Equal(t, 3, channel.ID)
+	}
+}
+
 func TestGetRetryChannelKeepsPermissionFailuresIgnoredAcrossRounds(t *testing.T) {
 	t.Parallel()
 
@@ -834,3 +860,15 @@ func withTestStoreDB(t *testing.T, fn func()) {
 
 	fn()
 }
+
+func TestAdaptorSupportsModeCountTokensFallsBackToAnthropic(t *testing.T) {
+	channel := &model.Channel{Type: model.ChannelTypeOpenAI}
+
+	a, ok := adaptors.GetAdaptor(channel.Type)
+	require.True(t, ok)
+	require.False(t, a.SupportMode(
+		supportModeMeta(nil, channel, "gpt-5", mode.AnthropicCountTokens),
+	))
+
+	assert.True(t, adaptorSupportsMode(a, nil, channel, "gpt-5", mode.AnthropicCountTokens))
+}
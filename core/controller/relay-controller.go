@@ -2,10 +2,10 @@ package controller
 
 import (
 	"bytes"
-	"context"
 	"errors"
 	"fmt"
 	"io"
+	"maps"
 	"math"
 	"math/rand/v2"
 	"net/http"
@@ -18,9 +18,12 @@ import (
 	"github.com/labring/aiproxy/core/common/config"
 	"github.com/labring/aiproxy/core/common/consume"
 	"github.com/labring/aiproxy/core/common/conv"
+	"github.com/labring/aiproxy/core/common/metrics"
+	mcp "github.com/labring/aiproxy/core/controller/mcp"
 	"github.com/labring/aiproxy/core/middleware"
 	"github.com/labring/aiproxy/core/model"
 	"github.com/labring/aiproxy/core/relay/adaptor"
+	"github.com/labring/aiproxy/core/relay/adaptor/openai"
 	"github.com/labring/aiproxy/core/relay/adaptors"
 	"github.com/labring/aiproxy/core/relay/controller"
 	"github.com/labring/aiproxy/core/relay/meta"
@@ -29,12 +32,18 @@ import (
 	"github.com/labring/aiproxy/core/relay/plugin"
 	"github.com/labring/aiproxy/core/relay/plugin/cache"
 	"github.com/labring/aiproxy/core/relay/plugin/cachefollow"
+	"github.com/labring/aiproxy/core/relay/plugin/guardrails"
+	"github.com/labring/aiproxy/core/relay/plugin/mcptools"
+	"github.com/labring/aiproxy/core/relay/plugin/moderation"
 	monitorplugin "github.com/labring/aiproxy/core/relay/plugin/monitor"
 	"github.com/labring/aiproxy/core/relay/plugin/patch"
+	"github.com/labring/aiproxy/core/relay/plugin/prompt"
+	"github.com/labring/aiproxy/core/relay/plugin/semanticcache"
 	"github.com/labring/aiproxy/core/relay/plugin/streamfake"
 	"github.com/labring/aiproxy/core/relay/plugin/thinksplit"
 	"github.com/labring/aiproxy/core/relay/plugin/timeout"
 	websearch "github.com/labring/aiproxy/core/relay/plugin/web-search"
+	mcpservers "github.com/labring/aiproxy/mcp-servers"
 	log "github.com/sirupsen/logrus"
 )
 
@@ -118,15 +127,42 @@ func (s *storeImpl) SaveIfNotExistStore(store adaptor.StoreCache) error {
 	return err
 }
 
-func wrapPlugin(ctx context.Context, mc *model.ModelCaches, a adaptor.Adaptor) adaptor.Adaptor {
+func wrapPlugin(c *gin.Context, mc *model.ModelCaches, a adaptor.Adaptor) adaptor.Adaptor {
+	ctx := c.Request.Context()
+
+	guardrailsPlugin := guardrails.NewGuardrailsPlugin()
+	moderationPlugin := moderation.NewModerationPlugin(
+		func(modelName string) (*model.Channel, error) {
+			return getPluginChannel(ctx, mc, modelName, mode.Moderations)
+		},
+	)
+
 	return plugin.WrapperAdaptor(a,
 		monitorplugin.NewGroupMonitorPlugin(),
+		prompt.NewPromptPlugin(),
+		guardrailsPlugin,
+		moderationPlugin,
 		cache.NewCachePlugin(common.RDB),
+		semanticcache.NewSemanticCachePlugin(
+			common.RDB,
+			func(modelName string) (*model.Channel, error) {
+				return getPluginChannel(ctx, mc, modelName, mode.Embeddings)
+			},
+		),
 		cachefollow.NewCacheFollowPlugin(),
+		// the tool results appended by the tool loop are checked like the
+		// prompt of the first turn
+		mcptools.NewMCPToolsPlugin(
+			func(servers []model.VirtualMCPServer) (mcpservers.Server, func()) {
+				return mcp.NewToolsServer(c, servers)
+			},
+			guardrailsPlugin,
+			moderationPlugin,
+		),
 		streamfake.NewStreamFakePlugin(),
 		timeout.NewTimeoutPlugin(),
 		websearch.NewWebSearchPlugin(func(modelName string) (*model.Channel, error) {
-			return getWebSearchChannel(ctx, mc, modelName)
+			return getPluginChannel(ctx, mc, modelName, mode.ChatCompletions)
 		}),
 		thinksplit.NewThinkPlugin(),
 		monitorplugin.NewChannelMonitorPlugin(),
@@ -149,15 +185,72 @@ func relayHandler(c *gin.Context, meta *meta.Meta, mc *model.ModelCaches) *contr
 		}
 	}
 
-	adaptor = wrapPlugin(c.Request.Context(), mc, adaptor)
+	adaptor = wrapPlugin(c, mc, adaptor)
 
 	return controller.Handle(adaptor, c, meta, AdaptorStore, buildBodyDetailOption(meta))
 }
 
+// countTokensHandler forwards count_tokens to the channels that can count the tokens
+// natively, the tokens are estimated locally for the other channels
+func countTokensHandler(
+	c *gin.Context,
+	meta *meta.Meta,
+	mc *model.ModelCaches,
+) *controller.HandleResult {
+	a, ok := adaptors.GetAdaptor(meta.Channel.Type)
+	if ok && !a.SupportMode(meta) {
+		log := common.GetLogger(c)
+		middleware.SetLogFieldsFromMeta(meta, log.Data)
+
+		return controller.HandleAnthropicCountTokens(c, meta)
+	}
+
+	return relayHandler(c, meta, mc)
+}
+
+// responsesHandler emulates the Responses API on chat completions for the channels
+// that can't serve it natively
+func responsesHandler(
+	c *gin.Context,
+	meta *meta.Meta,
+	mc *model.ModelCaches,
+) *controller.HandleResult {
+	a, ok := adaptors.GetAdaptor(meta.Channel.Type)
+	if !ok || a.SupportMode(meta) {
+		return relayHandler(c, meta, mc)
+	}
+
+	log := common.GetLogger(c)
+	middleware.SetLogFieldsFromMeta(meta, log.Data)
+
+	switch meta.Mode {
+	case mode.ResponsesGet:
+		return controller.HandleEmulatedResponseGet(c, meta, AdaptorStore)
+	case mode.ResponsesDelete:
+		return controller.HandleEmulatedResponseDelete(c, meta, AdaptorStore)
+	case mode.ResponsesInputItems:
+		return controller.HandleEmulatedResponseInputItems(c, meta, AdaptorStore)
+	default:
+		return controller.HandleResponsesEmulation(
+			wrapPlugin(c, mc, a),
+			c,
+			meta,
+			AdaptorStore,
+			buildBodyDetailOption(meta),
+		)
+	}
+}
+
 func defaultPriceFunc(_ *gin.Context, mc model.ModelConfig) (model.Price, error) {
 	return mc.Price, nil
 }
 
+// freePriceFunc is used by the endpoints that are not billed, e.g. uploading and reading
+// files or batches, and counting tokens
+func freePriceFunc(_ *gin.Context, _ model.ModelConfig) (model.Price, error) {
+	return model.Price{}, nil
+}
+
 func relayController(m mode.Mode) RelayController {
 	c := RelayController{
 		Handler: func(c *gin.Context, meta *meta.Meta) *controller.HandleResult {
@@ -213,8 +306,27 @@ func relayController(m mode.Mode) RelayController {
 		c.ValidateRequest = controller.ValidateDoubaoVideoRequest
 		c.GetRequestPrice = controller.GetDoubaoVideoRequestPrice
 		c.GetRequestUsage = controller.GetDoubaoVideoRequestUsage
-	case mode.Responses, mode.ResponsesCompact:
+	case mode.Responses:
 		c.GetRequestUsage = controller.GetResponsesRequestUsage
+		c.Handler = func(c *gin.Context, meta *meta.Meta) *controller.HandleResult {
+			return responsesHandler(c, meta, middleware.GetModelCaches(c))
+		}
+	case mode.ResponsesCompact:
+		c.GetRequestUsage = controller.GetResponsesRequestUsage
+	case mode.ResponsesGet, mode.ResponsesDelete, mode.ResponsesInputItems:
+		c.Handler = func(c *gin.Context, meta *meta.Meta) *controller.HandleResult {
+			return responsesHandler(c, meta, middleware.GetModelCaches(c))
+		}
+	case mode.Files, mode.FilesGet, mode.FilesDelete, mode.FilesContent,
+		mode.BatchesGet, mode.BatchesCancel:
+		c.GetRequestPrice = freePriceFunc
+	case mode.Batches:
+		c.GetRequestUsage = controller.GetBatchRequestUsage
+	case mode.AnthropicCountTokens:
+		c.GetRequestPrice = freePriceFunc
+		c.Handler = func(c *gin.Context, meta *meta.Meta) *controller.HandleResult {
+			return countTokensHandler(c, meta, middleware.GetModelCaches(c))
+		}
 	}
 
 	return c
@@ -338,6 +450,8 @@ func relay(c *gin.Context, mode mode.Mode, relayController RelayController) {
 		return
 	}
 
+	setRealtimeBalanceCheck(c, meta, gbc, price)
+
 	// First attempt
 	result, retry := RelayHelper(c, meta, relayController.Handler)
 
@@ -386,10 +500,16 @@ func recordResult(
 ) {
 	code := http.StatusOK
 
+	// a blocked output succeeded upstream but the client got the error
+	resultErr := result.Error
+	if resultErr == nil {
+		resultErr = moderation.BlockedOutputError(meta)
+	}
+
 	content := ""
-	if result.Error != nil {
-		code = result.Error.StatusCode()
-		respBody, _ := result.Error.MarshalJSON()
+	if resultErr != nil {
+		code = resultErr.StatusCode()
+		respBody, _ := resultErr.MarshalJSON()
 		content = conv.BytesToString(respBody)
 	}
 
@@ -410,6 +530,36 @@ func recordResult(
 		)
 	}
 
+	// responses replayed from the semantic cache are logged at zero cost
+	if semanticcache.IsCacheHit(meta) {
+		price = model.Price{}
+		metadata = maps.Clone(metadata)
+		if metadata == nil {
+			metadata = make(map[string]string, 1)
+		}
+
+		metadata["semantic_cache"] = "hit"
+	}
+
+	// the plugins record what they did to the request in the log metadata
+	for _, pluginMetadata := range []map[string]string{
+		prompt.LogMetadata(meta),
+		guardrails.LogMetadata(meta),
+		moderation.LogMetadata(meta),
+		mcptools.LogMetadata(meta),
+	} {
+		if len(pluginMetadata) == 0 {
+			continue
+		}
+
+		metadata = maps.Clone(metadata)
+		if metadata == nil {
+			metadata = make(map[string]string, len(pluginMetadata))
+		}
+
+		maps.Copy(metadata, pluginMetadata)
+	}
+
 	gbc := middleware.GetGroupBalanceConsumerFromContext(c)
 	usageContext := result.UsageContext.WithFallback(meta.RequestUsageContext)
 
@@ -428,6 +578,8 @@ func recordResult(
 		log.Data["amount"] = strconv.FormatFloat(amount, 'f', -1, 64)
 	}
 
+	observeRelayMetrics(meta, code, result.Usage, amount, retryTimes, downstreamResult)
+
 	asyncUsageStatus := model.AsyncUsageStatusNone
 	if downstreamResult && result.Error == nil && result.AsyncUsage {
 		asyncUsageStatus = model.AsyncUsageStatusPending
@@ -456,6 +608,60 @@ func recordResult(
 	}
 }
 
+// setRealtimeBalanceCheck closes the realtime sessions whose usage is more than the balance
+// of the group
+func setRealtimeBalanceCheck(
+	c *gin.Context,
+	meta *meta.Meta,
+	gbc *middleware.GroupBalanceConsumer,
+	price model.Price,
+) {
+	if meta.Mode != mode.Realtime {
+		return
+	}
+
+	openai.SetRealtimeBalanceCheck(c, func(usage model.Usage) bool {
+		return gbc.CheckBalance(consume.CalculateAmountWithOptions(
+			http.StatusOK,
+			usage,
+			meta.RequestUsageContext,
+			price,
+			model.PriceSelectionOptions{
+				DisableResolutionFuzzyMatch: meta.ModelConfig.DisableResolutionFuzzyMatch,
+				RequestAt:                   meta.RequestAt,
+			},
+		))
+	})
+}
+
+func observeRelayMetrics(
+	meta *meta.Meta,
+	code int,
+	usage model.Usage,
+	amount float64,
+	retryTimes int,
+	downstreamResult bool,
+) {
+	labels := metrics.RelayLabels{
+		Mode:    meta.Mode.String(),
+		Model:   meta.OriginModel,
+		Channel: meta.Channel.ID,
+		Group:   meta.Group.ID,
+	}
+
+	metrics.ObserveRelayAttempt(labels, code, metrics.RelayTokens{
+		Input:      int64(usage.InputTokens),
+		Output:     int64(usage.OutputTokens),
+		Cached:     int64(usage.CachedTokens),
+		CacheWrite: int64(usage.CacheCreationTokens),
+		Reasoning:  int64(usage.ReasoningTokens),
+	}, amount)
+
+	if downstreamResult {
+		metrics.ObserveRelayRequest(labels, code, retryTimes, time.Since(meta.RequestAt))
+	}
+}
+
 func saveAsyncUsageInfo(
 	meta *meta.Meta,
 	price model.Price,
@@ -558,6 +764,7 @@ type retryState struct {
 	requestUsageContext model.UsageContext
 	result              *controller.HandleResult
 	migratedChannels    []*model.Channel
+	modelCaches         *model.ModelCaches
 	channelRetryInfo    map[int]channelRetryInfo
 }
 
@@ -610,6 +817,7 @@ func initRetryState(
 		requestUsage:        meta.RequestUsage,
 		requestUsageContext: meta.RequestUsageContext,
 		migratedChannels:    channel.migratedChannels,
+		modelCaches:         channel.modelCaches,
 		failedChannelIDs:    make(map[int64]struct{}),
 		channelRetryInfo:    make(map[int]channelRetryInfo),
 	}
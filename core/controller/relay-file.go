@@ -0,0 +1,140 @@
+package controller
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/bytedance/sonic"
+	"github.com/gin-gonic/gin"
+	"github.com/labring/aiproxy/core/middleware"
+	"github.com/labring/aiproxy/core/model"
+	relaymodel "github.com/labring/aiproxy/core/relay/model"
+)
+
+const (
+	defaultListFilesLimit = 10000
+	maxListFilesLimit     = 10000
+)
+
+// ListObjectsResponse is the list object of the files and batches that are kept in the store
+type ListObjectsResponse struct {
+	Object  string            `json:"object"`
+	Data    []json.RawMessage `json:"data"`
+	FirstID string            `json:"first_id,omitempty"`
+	LastID  string            `json:"last_id,omitempty"`
+	HasMore bool              `json:"has_more"`
+}
+
+// ListFiles godoc
+//
+//	@Summary		List files
+//	@Description	List the files uploaded by the current token
+//	@Tags			relay
+//	@Produce		json
+//	@Security		ApiKeyAuth
+//	@Param			purpose	query		string	false	"Only return files with the given purpose"
+//	@Param			limit	query		int		false	"Number of files to return, default 10000"
+//	@Param			order	query		string	false	"Sort order by created_at, asc or desc"
+//	@Param			after	query		string	false	"Cursor, the file id to start after"
+//	@Success		200		{object}	ListObjectsResponse
+//	@Router			/v1/files [get]
+func ListFiles(c *gin.Context) {
+	limit, _ := strconv.Atoi(c.Query("limit"))
+	if limit <= 0 || limit > maxListFilesLimit {
+		limit = defaultListFilesLimit
+	}
+
+	var filter func(metadata string) bool
+	if purpose := c.Query("purpose"); purpose != "" {
+		filter = func(metadata string) bool {
+			node, err := sonic.GetFromString(metadata, "purpose")
+			if err != nil {
+				return false
+			}
+
+			p, _ := node.String()
+
+			return p == purpose
+		}
+	}
+
+	listStoredObjects(c, model.StorePrefixFile, limit, c.Query("order") == "asc", filter)
+}
+
+// listStoredObjects lists the objects of the current token whose store id has the prefix,
+// the object is the store metadata
+func listStoredObjects(
+	c *gin.Context,
+	prefix string,
+	limit int,
+	asc bool,
+	filter func(metadata string) bool,
+) {
+	group := middleware.GetGroup(c)
+	token := middleware.GetToken(c)
+
+	objects := make([]json.RawMessage, 0, limit+1)
+	ids := make([]string, 0, limit+1)
+
+	// the filter is applied after loading, the stores are read in pages
+	// until there are enough objects
+	after := c.Query("after")
+	for len(objects) <= limit {
+		stores, err := model.GetStoresByPrefix(
+			group.ID,
+			token.ID,
+			prefix,
+			after,
+			limit+1,
+			asc,
+		)
+		if err != nil {
+			ErrorWithRequestID(c, relaymodel.WrapperOpenAIErrorWithMessage(
+				err.Error(),
+				"list_objects_failed",
+				http.StatusInternalServerError,
+			))
+
+			return
+		}
+
+		for _, store := range stores {
+			if store.Metadata == "" {
+				continue
+			}
+
+			if filter != nil && !filter(store.Metadata) {
+				continue
+			}
+
+			objects = append(objects, json.RawMessage(store.Metadata))
+			ids = append(ids, strings.TrimPrefix(store.ID, prefix+":"))
+		}
+
+		if len(stores) <= limit {
+			break
+		}
+
+		after = stores[len(stores)-1].ID
+	}
+
+	resp := ListObjectsResponse{
+		Object: "list",
+	}
+
+	if len(objects) > limit {
+		objects = objects[:limit]
+		ids = ids[:limit]
+		resp.HasMore = true
+	}
+
+	resp.Data = objects
+	if len(ids) > 0 {
+		resp.FirstID = ids[0]
+		resp.LastID = ids[len(ids)-1]
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
@@ -0,0 +1,66 @@
+//nolint:testpackage
+package controller
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/bytedance/sonic"
+	"github.com/gin-gonic/gin"
+	"github.com/labring/aiproxy/core/middleware"
+	"github.com/labring/aiproxy/core/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestListFilesPurposePages(t *testing.T) {
+	withTestStoreDB(t, func() {
+		now := time.Now()
+
+		purposes := []string{"assistants", "batch", "batch", "batch", "assistants", "batch"}
+		for i, purpose := range purposes {
+			id := "file-" + string(rune('a'+i))
+			require.NoError(t, model.LogDB.Create(&model.StoreV2{
+				ID:        model.StoreID(model.StorePrefixFile, id),
+				GroupID:   "g1",
+				TokenID:   1,
+				ChannelID: 1,
+				CreatedAt: now.Add(time.Duration(i) * time.Second),
+				ExpiresAt: now.Add(time.Hour),
+				Metadata:  `{"id":"` + id + `","purpose":"` + purpose + `"}`,
+			}).Error)
+		}
+
+		list := func(query string) ListObjectsResponse {
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			c.Request = httptest.NewRequest(http.MethodGet, "/v1/files?"+query, nil)
+			c.Set(middleware.Group, model.GroupCache{ID: "g1"})
+			c.Set(middleware.Token, model.TokenCache{ID: 1})
+
+			ListFiles(c)
+			require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+			var resp ListObjectsResponse
+			require.NoError(t, sonic.Unmarshal(w.Body.Bytes(), &resp))
+
+			return resp
+		}
+
+		// the matches are spread over several pages of the store
+		resp := list("purpose=assistants&limit=1")
+		assert.Equal(t, "file-e", resp.FirstID)
+		assert.True(t, resp.HasMore)
+
+		resp = list("purpose=assistants&limit=1&after=" + resp.LastID)
+		assert.Equal(t, "file-a", resp.FirstID)
+		assert.False(t, resp.HasMore)
+
+		resp = list("purpose=batch&limit=2")
+		assert.Equal(t, "file-f", resp.FirstID)
+		assert.Equal(t, "file-d", resp.LastID)
+		assert.True(t, resp.HasMore)
+	})
+}
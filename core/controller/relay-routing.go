@@ -0,0 +1,300 @@
+package controller
+
+import (
+	"cmp"
+	"context"
+	"math"
+	"math/rand/v2"
+	"slices"
+	"sync"
+	"sync/atomic"
+
+	"github.com/labring/aiproxy/core/common/config"
+	"github.com/labring/aiproxy/core/model"
+	"github.com/labring/aiproxy/core/monitor"
+)
+
+// routingPolicy picks a channel of a model with the routing strategy of the model config
+type routingPolicy struct {
+	strategy   model.RoutingStrategy
+	modelName  string
+	mc         *model.ModelCaches
+	errorRates map[int64]float64
+	latencies  map[int64]monitor.LatencyPercentiles
+	// ttfbWeight reduces the weight of the channels whose p95 ttfb degrades
+	ttfbWeight bool
+	// dryRun doesn't advance the round robin counter
+	dryRun bool
+	// offset is added to the round robin counter on dry run to simulate the next picks
+	offset uint64
+}
+
+func newRoutingPolicy(
+	mc *model.ModelCaches,
+	modelName string,
+	errorRates map[int64]float64,
+) *routingPolicy {
+	if mc == nil {
+		mc = model.LoadModelCaches()
+	}
+
+	var strategy model.RoutingStrategy
+	if mc.ModelConfig != nil {
+		if config, ok := mc.ModelConfig.GetModelConfig(modelName); ok {
+			strategy = config.RoutingStrategy
+		}
+	}
+
+	return &routingPolicy{
+		strategy:   strategy,
+		modelName:  modelName,
+		mc:         mc,
+		errorRates: errorRates,
+		ttfbWeight: config.GetEnableTTFBWeight(),
+	}
+}
+
+func (p *routingPolicy) getStrategy() model.RoutingStrategy {
+	if p == nil || p.strategy == "" {
+		return model.RoutingStrategyWeightedRandom
+	}
+
+	return p.strategy
+}
+
+func (p *routingPolicy) getErrorRates() map[int64]float64 {
+	if p == nil {
+		return nil
+	}
+
+	return p.errorRates
+}
+
+const (
+	// minTTFBSamples is the samples a channel needs before its ttfb affects the weight
+	minTTFBSamples = 5
+	// ttfbDegradeRatio is how many times slower than the fastest channel the p95
+	// ttfb of a channel can be before it's down-weighted
+	ttfbDegradeRatio = 2.0
+	// ttfbPenalty controls how fast the weight drops once the p95 ttfb degrades
+	ttfbPenalty = 2.0
+)
+
+func (p *routingPolicy) getLatencies() map[int64]monitor.LatencyPercentiles {
+	if p == nil {
+		return nil
+	}
+
+	if p.latencies == nil {
+		latencies, err := monitor.GetModelChannelTTFB(context.Background(), p.modelName)
+		if err != nil || latencies == nil {
+			latencies = map[int64]monitor.LatencyPercentiles{}
+		}
+
+		p.latencies = latencies
+	}
+
+	return p.latencies
+}
+
+// getLatencyScore returns the recent p50 ttfb of the channels, the channels without
+// recent requests get the median of the measured candidates as a neutral prior, so
+// they are neither always preferred nor starved
+func (p *routingPolicy) getLatencyScore(channels []*model.Channel) func(*model.Channel) float64 {
+	latencies := p.getLatencies()
+
+	measured := make([]float64, 0, len(channels))
+	for _, ch := range channels {
+		if l, ok := latencies[int64(ch.ID)]; ok && l.Samples > 0 {
+			measured = append(measured, l.P50)
+		}
+	}
+
+	var prior float64
+	if len(measured) > 0 {
+		slices.Sort(measured)
+		prior = measured[len(measured)/2]
+	}
+
+	return func(ch *model.Channel) float64 {
+		if l, ok := latencies[int64(ch.ID)]; ok && l.Samples > 0 {
+			return l.P50
+		}
+
+		return prior
+	}
+}
+
+// getTTFBFactors returns the weight factor of the channels whose p95 ttfb degrades,
+// compared to the fastest channel among the candidates
+func (p *routingPolicy) getTTFBFactors(channels []*model.Channel) map[int64]float64 {
+	if p == nil || !p.ttfbWeight {
+		return nil
+	}
+
+	latencies := p.getLatencies()
+	if len(latencies) == 0 {
+		return nil
+	}
+
+	var best float64
+
+	for _, ch := range channels {
+		l, ok := latencies[int64(ch.ID)]
+		if !ok || l.Samples < minTTFBSamples || l.P95 <= 0 {
+			continue
+		}
+
+		if best == 0 || l.P95 < best {
+			best = l.P95
+		}
+	}
+
+	if best == 0 {
+		return nil
+	}
+
+	threshold := best * ttfbDegradeRatio
+	factors := make(map[int64]float64)
+
+	for _, ch := range channels {
+		l, ok := latencies[int64(ch.ID)]
+		if !ok || l.Samples < minTTFBSamples || l.P95 <= threshold {
+			continue
+		}
+
+		factors[int64(ch.ID)] = math.Pow(threshold/l.P95, ttfbPenalty)
+	}
+
+	return factors
+}
+
+// getCost returns the reference cost of the model that the channel maps the
+// requested model to
+func (p *routingPolicy) getCost(channel *model.Channel) float64 {
+	if p.mc == nil || p.mc.ModelConfig == nil {
+		return 0
+	}
+
+	actualModel := p.modelName
+	if mapped, ok := channel.ModelMapping[p.modelName]; ok && mapped != "" {
+		actualModel = mapped
+	}
+
+	config, ok := p.mc.ModelConfig.GetModelConfig(actualModel)
+	if !ok {
+		config, ok = p.mc.ModelConfig.GetModelConfig(p.modelName)
+		if !ok {
+			return 0
+		}
+	}
+
+	return config.Price.ReferenceCost()
+}
+
+// pick picks a channel from the candidates, the channels that tie on the
+// strategy score are picked by weighted random
+func (p *routingPolicy) pick(channels []*model.Channel) *model.Channel {
+	switch p.getStrategy() {
+	case model.RoutingStrategyPriority:
+		channels = bestChannels(channels, func(ch *model.Channel) float64 {
+			return -float64(ch.GetPriority())
+		})
+	case model.RoutingStrategyLeastLatency:
+		channels = bestChannels(channels, p.getLatencyScore(channels))
+	case model.RoutingStrategyLeastCost:
+		channels = bestChannels(channels, p.getCost)
+	case model.RoutingStrategyRoundRobin:
+		return p.pickRoundRobin(channels)
+	}
+
+	return pickWeightedChannel(channels, p.getErrorRates(), p.getTTFBFactors(channels))
+}
+
+// bestChannels returns the channels with the lowest score
+func bestChannels(
+	channels []*model.Channel,
+	score func(ch *model.Channel) float64,
+) []*model.Channel {
+	best := make([]*model.Channel, 0, len(channels))
+
+	var bestScore float64
+
+	for _, ch := range channels {
+		s := score(ch)
+
+		switch {
+		case len(best) == 0 || s < bestScore:
+			best = append(best[:0], ch)
+			bestScore = s
+		case s == bestScore:
+			best = append(best, ch)
+		}
+	}
+
+	return best
+}
+
+// roundRobinCounters keeps the next position of every model, it's local to the instance
+var roundRobinCounters sync.Map
+
+func (p *routingPolicy) pickRoundRobin(channels []*model.Channel) *model.Channel {
+	sorted := slices.SortedFunc(slices.Values(channels), func(a, b *model.Channel) int {
+		return cmp.Compare(a.ID, b.ID)
+	})
+
+	v, _ := roundRobinCounters.LoadOrStore(p.modelName, new(atomic.Uint64))
+
+	counter, ok := v.(*atomic.Uint64)
+	if !ok {
+		return sorted[0]
+	}
+
+	var n uint64
+	if p.dryRun {
+		n = counter.Load() + p.offset
+	} else {
+		n = counter.Add(1) - 1
+	}
+
+	return sorted[n%uint64(len(sorted))]
+}
+
+// pickWeightedChannel picks by the priority weight, which is reduced by the error
+// rate and the ttfb factor of the channel
+func pickWeightedChannel(
+	channels []*model.Channel,
+	errorRates map[int64]float64,
+	ttfbFactors map[int64]float64,
+) *model.Channel {
+	if len(channels) == 1 {
+		return channels[0]
+	}
+
+	var totalWeight float64
+
+	cachedWeights := make([]float64, len(channels))
+	for i, ch := range channels {
+		weight := getPriorityWeight(ch, getChannelErrorRate(errorRates, int64(ch.ID)))
+		if factor, ok := ttfbFactors[int64(ch.ID)]; ok {
+			weight *= factor
+		}
+
+		totalWeight += weight
+		cachedWeights[i] = weight
+	}
+
+	if totalWeight == 0 {
+		return channels[rand.IntN(len(channels))]
+	}
+
+	r := rand.Float64() * totalWeight
+	for i, ch := range channels {
+		r -= cachedWeights[i]
+		if r < 0 {
+			return ch
+		}
+	}
+
+	return channels[rand.IntN(len(channels))]
+}
@@ -0,0 +1,216 @@
+//nolint:testpackage
+package controller
+
+import (
+	"testing"
+	"time"
+
+	"github.com/labring/aiproxy/core/model"
+	"github.com/labring/aiproxy/core/monitor"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type testModelConfigCache map[string]model.ModelConfig
+
+func (c testModelConfigCache) GetModelConfig(modelName string) (model.ModelConfig, bool) {
+	config, ok := c[modelName]
+	return config, ok
+}
+
+func newRoutingTestChannels() []*model.Channel {
+	return []*model.Channel{
+		{
+			ID:       1,
+			Type:     model.ChannelTypeOpenAI,
+			Status:   model.ChannelStatusEnabled,
+			Priority: 10,
+		},
+		{
+			ID:           2,
+			Type:         model.ChannelTypeOpenAI,
+			Status:       model.ChannelStatusEnabled,
+			Priority:     100,
+			ModelMapping: map[string]string{"routing-model": "routing-model-expensive"},
+		},
+		{
+			ID:           3,
+			Type:         model.ChannelTypeOpenAI,
+			Status:       model.ChannelStatusEnabled,
+			Priority:     50,
+			ModelMapping: map[string]string{"routing-model": "routing-model-cheap"},
+		},
+	}
+}
+
+func newRoutingTestModelCaches(strategy model.RoutingStrategy) *model.ModelCaches {
+	return &model.ModelCaches{
+		ModelConfig: testModelConfigCache{
+			"routing-model": {
+				Model:           "routing-model",
+				RoutingStrategy: strategy,
+				Price:           model.Price{InputPrice: 2, OutputPrice: 4},
+			},
+			"routing-model-expensive": {
+				Model: "routing-model-expensive",
+				Price: model.Price{InputPrice: 10, OutputPrice: 20},
+			},
+			"routing-model-cheap": {
+				Model: "routing-model-cheap",
+				Price: model.Price{InputPrice: 1, OutputPrice: 1},
+			},
+		},
+	}
+}
+
+func TestRoutingPolicyPriorityFailover(t *testing.T) {
+	t.Parallel()
+
+	policy := newRoutingPolicy(
+		newRoutingTestModelCaches(model.RoutingStrategyPriority),
+		"routing-model",
+		nil,
+	)
+
+	assert.Equal(t, []int{2, 3, 1}, dryRunPicks(policy, newRoutingTestChannels()))
+}
+
+func TestRoutingPolicyLeastCost(t *testing.T) {
+	t.Parallel()
+
+	policy := newRoutingPolicy(
+		newRoutingTestModelCaches(model.RoutingStrategyLeastCost),
+		"routing-model",
+		nil,
+	)
+
+	channels := newRoutingTestChannels()
+	assert.InDelta(t, 6, policy.getCost(channels[0]), 1e-9)
+	assert.InDelta(t, 30, policy.getCost(channels[1]), 1e-9)
+	assert.InDelta(t, 2, policy.getCost(channels[2]), 1e-9)
+
+	assert.Equal(t, []int{3, 1, 2}, dryRunPicks(policy, channels))
+}
+
+func TestRoutingPolicyLeastLatency(t *testing.T) {
+	t.Parallel()
+
+	const modelName = "routing-latency-model"
+
+	monitor.AddChannelModelTTFB(modelName, 1, 300*time.Millisecond)
+	monitor.AddChannelModelTTFB(modelName, 2, 100*time.Millisecond)
+	monitor.AddChannelModelTTFB(modelName, 3, 200*time.Millisecond)
+
+	policy := newRoutingPolicy(&model.ModelCaches{
+		ModelConfig: testModelConfigCache{
+			modelName: {
+				Model:           modelName,
+				RoutingStrategy: model.RoutingStrategyLeastLatency,
+			},
+		},
+	}, modelName, nil)
+
+	assert.Equal(t, []int{2, 3, 1}, dryRunPicks(policy, newRoutingTestChannels()))
+}
+
+func TestRoutingPolicyLeastLatencyUnmeasured(t *testing.T) {
+	t.Parallel()
+
+	const modelName = "routing-latency-unmeasured-model"
+
+	monitor.AddChannelModelTTFB(modelName, 1, 300*time.Millisecond)
+	monitor.AddChannelModelTTFB(modelName, 2, 100*time.Millisecond)
+
+	policy := newRoutingPolicy(&model.ModelCaches{}, modelName, nil)
+	score := policy.getLatencyScore(newRoutingTestChannels())
+
+	// channel 3 is not measured, it gets the median instead of winning with zero
+	assert.InDelta(t, 100, score(&model.Channel{ID: 2}), 1e-9)
+	assert.InDelta(t, 300, score(&model.Channel{ID: 3}), 1e-9)
+}
+
+func TestRoutingPolicyTTFBDegrade(t *testing.T) {
+	t.Parallel()
+
+	const modelName = "routing-ttfb-model"
+
+	for range minTTFBSamples {
+		monitor.AddChannelModelTTFB(modelName, 1, 100*time.Millisecond)
+		monitor.AddChannelModelTTFB(modelName, 2, 150*time.Millisecond)
+		monitor.AddChannelModelTTFB(modelName, 3, 800*time.Millisecond)
+	}
+
+	// channel 4 has too few samples to be judged
+	monitor.AddChannelModelTTFB(modelName, 4, 5*time.Second)
+
+	channels := append(newRoutingTestChannels(), &model.Channel{
+		ID:     4,
+		Type:   model.ChannelTypeOpenAI,
+		Status: model.ChannelStatusEnabled,
+	})
+
+	policy := newRoutingPolicy(&model.ModelCaches{}, modelName, nil)
+	assert.Empty(t, policy.getTTFBFactors(channels))
+
+	policy.ttfbWeight = true
+	factors := policy.getTTFBFactors(channels)
+
+	assert.NotContains(t, factors, int64(1))
+	assert.NotContains(t, factors, int64(2))
+	assert.InDelta(t, 0.0625, factors[3], 1e-9)
+	assert.NotContains(t, factors, int64(4))
+}
+
+func TestRoutingPolicyRoundRobin(t *testing.T) {
+	t.Parallel()
+
+	const modelName = "routing-round-robin-model"
+
+	policy := newRoutingPolicy(&model.ModelCaches{
+		ModelConfig: testModelConfigCache{
+			modelName: {
+				Model:           modelName,
+				RoutingStrategy: model.RoutingStrategyRoundRobin,
+			},
+		},
+	}, modelName, nil)
+
+	channels := newRoutingTestChannels()
+
+	picks := make([]int, 0, 4)
+	for range 4 {
+		channel, err := pickChannel(channels, policy)
+		require.NoError(t, err)
+
+		picks = append(picks, channel.ID)
+	}
+
+	assert.Equal(t, []int{1, 2, 3, 1}, picks)
+
+	policy.dryRun = true
+	assert.Equal(t, []int{2, 3, 1}, dryRunPicks(policy, channels))
+
+	// dry run doesn't move the counter
+	policy.dryRun = false
+	channel, err := pickChannel(channels, policy)
+	require.NoError(t, err)
+	assert.Equal(t, 2, channel.ID)
+}
+
+func TestRoutingPolicyDefaultsToWeightedRandom(t *testing.T) {
+	t.Parallel()
+
+	policy := newRoutingPolicy(&model.ModelCaches{}, "routing-unknown-model", nil)
+	assert.Equal(t, model.RoutingStrategyWeightedRandom, policy.getStrategy())
+
+	picks := dryRunPicks(policy, newRoutingTestChannels())
+	assert.ElementsMatch(t, []int{1, 2, 3}, picks)
+}
+
+func TestRoutingStrategyIsValid(t *testing.T) {
+	t.Parallel()
+
+	assert.True(t, model.RoutingStrategy("").IsValid())
+	assert.True(t, model.RoutingStrategyLeastCost.IsValid())
+	assert.False(t, model.RoutingStrategy("fastest").IsValid())
+}
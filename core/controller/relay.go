@@ -58,6 +58,24 @@ func Anthropic() []gin.HandlerFunc {
 	}
 }
 
+// AnthropicCountTokens godoc
+//
+//	@Summary		AnthropicCountTokens
+//	@Description	Count the input tokens of an Anthropic messages request, the request is not billed
+//	@Tags			relay
+//	@Produce		json
+//	@Security		ApiKeyAuth
+//	@Param			request			body		model.AnthropicMessageRequest	true	"Request"
+//	@Param			Aiproxy-Channel	header		string							false	"Optional Aiproxy-Channel header"
+//	@Success		200				{object}	model.ClaudeCountTokensResponse
+//	@Router			/v1/messages/count_tokens [post]
+func AnthropicCountTokens() []gin.HandlerFunc {
+	return []gin.HandlerFunc{
+		middleware.NewDistribute(mode.AnthropicCountTokens),
+		NewRelay(mode.AnthropicCountTokens),
+	}
+}
+
 // ChatCompletions godoc
 //
 //	@Summary		ChatCompletions
@@ -724,6 +742,153 @@ func GetResponseInputItems() []gin.HandlerFunc {
 	}
 }
 
+// CreateFile godoc
+//
+//	@Summary		Upload file
+//	@Description	Upload a file, the file is pinned to the channel it was uploaded to
+//	@Tags			relay
+//	@Accept			multipart/form-data
+//	@Produce		json
+//	@Security		ApiKeyAuth
+//	@Param			file			formData	file	true	"File"
+//	@Param			purpose			formData	string	true	"Purpose"
+//	@Param			model			formData	string	false	"Model used to select the channel"
+//	@Param			Aiproxy-Channel	header		string	false	"Optional Aiproxy-Channel header"
+//	@Success		200				{object}	object
+//	@Router			/v1/files [post]
+func CreateFile() []gin.HandlerFunc {
+	return []gin.HandlerFunc{
+		middleware.NewDistribute(mode.Files),
+		NewRelay(mode.Files),
+	}
+}
+
+// GetFile godoc
+//
+//	@Summary		Get file
+//	@Description	Get a file by ID
+//	@Tags			relay
+//	@Produce		json
+//	@Security		ApiKeyAuth
+//	@Param			id				path		string	true	"File ID"
+//	@Param			Aiproxy-Channel	header		string	false	"Optional Aiproxy-Channel header"
+//	@Success		200				{object}	object
+//	@Router			/v1/files/{id} [get]
+func GetFile() []gin.HandlerFunc {
+	return []gin.HandlerFunc{
+		middleware.NewDistribute(mode.FilesGet),
+		NewRelay(mode.FilesGet),
+	}
+}
+
+// DeleteFile godoc
+//
+//	@Summary		Delete file
+//	@Description	Delete a file by ID
+//	@Tags			relay
+//	@Produce		json
+//	@Security		ApiKeyAuth
+//	@Param			id				path		string	true	"File ID"
+//	@Param			Aiproxy-Channel	header		string	false	"Optional Aiproxy-Channel header"
+//	@Success		200				{object}	object
+//	@Router			/v1/files/{id} [delete]
+func DeleteFile() []gin.HandlerFunc {
+	return []gin.HandlerFunc{
+		middleware.NewDistribute(mode.FilesDelete),
+		NewRelay(mode.FilesDelete),
+	}
+}
+
+// GetFileContent godoc
+//
+//	@Summary		Get file content
+//	@Description	Get the content of a file by ID
+//	@Tags			relay
+//	@Produce		octet-stream
+//	@Security		ApiKeyAuth
+//	@Param			id				path	string	true	"File ID"
+//	@Param			Aiproxy-Channel	header	string	false	"Optional Aiproxy-Channel header"
+//	@Success		200
+//	@Router			/v1/files/{id}/content [get]
+func GetFileContent() []gin.HandlerFunc {
+	return []gin.HandlerFunc{
+		middleware.NewDistribute(mode.FilesContent),
+		NewRelay(mode.FilesContent),
+	}
+}
+
+// CreateBatch godoc
+//
+//	@Summary		Create batch
+//	@Description	Create a batch, the batch is pinned to the channel that holds its input file
+//	@Tags			relay
+//	@Accept			json
+//	@Produce		json
+//	@Security		ApiKeyAuth
+//	@Param			request			body		object	true	"Request"
+//	@Param			Aiproxy-Channel	header		string	false	"Optional Aiproxy-Channel header"
+//	@Success		200				{object}	model.Batch
+//	@Router			/v1/batches [post]
+func CreateBatch() []gin.HandlerFunc {
+	return []gin.HandlerFunc{
+		middleware.NewDistribute(mode.Batches),
+		NewRelay(mode.Batches),
+	}
+}
+
+// GetBatch godoc
+//
+//	@Summary		Get batch
+//	@Description	Get a batch by ID
+//	@Tags			relay
+//	@Produce		json
+//	@Security		ApiKeyAuth
+//	@Param			id				path		string	true	"Batch ID"
+//	@Param			Aiproxy-Channel	header		string	false	"Optional Aiproxy-Channel header"
+//	@Success		200				{object}	model.Batch
+//	@Router			/v1/batches/{id} [get]
+func GetBatch() []gin.HandlerFunc {
+	return []gin.HandlerFunc{
+		middleware.NewDistribute(mode.BatchesGet),
+		NewRelay(mode.BatchesGet),
+	}
+}
+
+// CancelBatch godoc
+//
+//	@Summary		Cancel batch
+//	@Description	Cancel a batch by ID
+//	@Tags			relay
+//	@Produce		json
+//	@Security		ApiKeyAuth
+//	@Param			id				path		string	true	"Batch ID"
+//	@Param			Aiproxy-Channel	header		string	false	"Optional Aiproxy-Channel header"
+//	@Success		200				{object}	model.Batch
+//	@Router			/v1/batches/{id}/cancel [post]
+func CancelBatch() []gin.HandlerFunc {
+	return []gin.HandlerFunc{
+		middleware.NewDistribute(mode.BatchesCancel),
+		NewRelay(mode.BatchesCancel),
+	}
+}
+
+// Realtime godoc
+//
+//	@Summary		Realtime
+//	@Description	Proxy an OpenAI Realtime API websocket session, the usage is billed when the session is closed, the session is closed early when the balance runs out or it reaches REALTIME_MAX_DURATION_SECONDS
+//	@Tags			relay
+//	@Security		ApiKeyAuth
+//	@Param			model			query	string	true	"Model name"
+//	@Param			Aiproxy-Channel	header	string	false	"Optional Aiproxy-Channel header"
+//	@Success		101
+//	@Router			/v1/realtime [get]
+func Realtime() []gin.HandlerFunc {
+	return []gin.HandlerFunc{
+		middleware.NewDistribute(mode.Realtime),
+		NewRelay(mode.Realtime),
+	}
+}
+
 // Gemini godoc
 //
 //	@Summary		Gemini Native API
@@ -0,0 +1,176 @@
+package controller
+
+import (
+	"errors"
+	"net/http"
+	"slices"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/labring/aiproxy/core/middleware"
+	"github.com/labring/aiproxy/core/model"
+	"github.com/labring/aiproxy/core/monitor"
+	"github.com/labring/aiproxy/core/relay/mode"
+)
+
+type RoutingDryRunChannel struct {
+	ID        int               `json:"id"`
+	Name      string            `json:"name"`
+	Type      model.ChannelType `json:"type"`
+	Priority  int32             `json:"priority"`
+	ErrorRate float64           `json:"error_rate"`
+	// TTFB is the recent time to first byte of the channel, in milliseconds
+	TTFB       monitor.LatencyPercentiles `json:"ttfb"`
+	Cost       float64                    `json:"cost"`
+	Banned     bool                       `json:"banned"`
+	Selectable bool                       `json:"selectable"`
+}
+
+type RoutingDryRunResponse struct {
+	Model    string                 `json:"model"`
+	Mode     mode.Mode              `json:"mode"`
+	Strategy model.RoutingStrategy  `json:"strategy"`
+	Sets     []string               `json:"sets"`
+	Channels []RoutingDryRunChannel `json:"channels"`
+	// Picks is the order the channels would be tried in, the first one is picked
+	// for the request and the others are the failover on retry
+	Picks []int `json:"picks"`
+}
+
+// RoutingDryRun godoc
+//
+//	@Summary		Routing dry run
+//	@Description	Shows which channels would be picked for a model with its routing strategy, without sending any request
+//	@Tags			modelconfig
+//	@Produce		json
+//	@Security		ApiKeyAuth
+//	@Param			model		query		string	true	"Model name"
+//	@Param			group		query		string	false	"Group name, the available sets of the group are used"
+//	@Param			set			query		string	false	"Channel set, overrides the sets of the group"
+//	@Param			mode		query		int		false	"Relay mode, defaults to the model type"
+//	@Param			strategy	query		string	false	"Routing strategy, defaults to the strategy of the model config"
+//	@Success		200			{object}	middleware.APIResponse{data=RoutingDryRunResponse}
+//	@Router			/api/routing/dry_run [get]
+func RoutingDryRun(c *gin.Context) {
+	modelName := c.Query("model")
+	if modelName == "" {
+		middleware.ErrorResponse(c, http.StatusBadRequest, "model is required")
+		return
+	}
+
+	mc := model.LoadModelCaches()
+
+	modelConfig, ok := mc.ModelConfig.GetModelConfig(modelName)
+	if !ok {
+		middleware.ErrorResponse(c, http.StatusNotFound, "model config not found")
+		return
+	}
+
+	sets := c.QueryArray("set")
+	if len(sets) == 0 {
+		if group := c.Query("group"); group != "" {
+			groupCache, err := model.CacheGetGroup(group)
+			if err != nil {
+				middleware.ErrorResponse(c, http.StatusNotFound, err.Error())
+				return
+			}
+
+			sets = groupCache.GetAvailableSets()
+		}
+	}
+
+	m := modelConfig.Type
+	if modeStr := c.Query("mode"); modeStr != "" {
+		modeInt, err := strconv.Atoi(modeStr)
+		if err != nil {
+			middleware.ErrorResponse(c, http.StatusBadRequest, "invalid mode")
+			return
+		}
+
+		m = mode.Mode(modeInt)
+	}
+
+	ctx := c.Request.Context()
+	errorRates, _ := monitor.GetModelChannelErrorRate(ctx, modelName)
+	banned, _ := monitor.GetBannedChannelsMapWithModel(ctx, modelName)
+
+	policy := newRoutingPolicy(mc, modelName, errorRates)
+	policy.dryRun = true
+
+	if strategy := model.RoutingStrategy(c.Query("strategy")); strategy != "" {
+		if !strategy.IsValid() {
+			middleware.ErrorResponse(c, http.StatusBadRequest, "invalid strategy")
+			return
+		}
+
+		policy.strategy = strategy
+	}
+
+	channels, err := getAvailableChannels(mc, sets, modelName, m)
+	if err != nil {
+		if errors.Is(err, ErrChannelsNotFound) {
+			middleware.ErrorResponse(c, http.StatusNotFound, err.Error())
+			return
+		}
+
+		middleware.ErrorResponse(c, http.StatusInternalServerError, err.Error())
+
+		return
+	}
+
+	slices.SortFunc(channels, func(a, b *model.Channel) int {
+		return a.ID - b.ID
+	})
+
+	candidates := filterChannels(channels, errorRates, maxRetryErrorRate, banned)
+
+	resp := RoutingDryRunResponse{
+		Model:    modelName,
+		Mode:     m,
+		Strategy: policy.getStrategy(),
+		Sets:     sets,
+		Channels: make([]RoutingDryRunChannel, 0, len(channels)),
+		Picks:    dryRunPicks(policy, candidates),
+	}
+
+	latencies := policy.getLatencies()
+
+	for _, channel := range channels {
+		_, isBanned := banned[int64(channel.ID)]
+		resp.Channels = append(resp.Channels, RoutingDryRunChannel{
+			ID:         channel.ID,
+			Name:       channel.Name,
+			Type:       channel.Type,
+			Priority:   channel.GetPriority(),
+			ErrorRate:  getChannelErrorRate(errorRates, int64(channel.ID)),
+			TTFB:       latencies[int64(channel.ID)],
+			Cost:       policy.getCost(channel),
+			Banned:     isBanned,
+			Selectable: slices.Contains(candidates, channel),
+		})
+	}
+
+	middleware.SuccessResponse(c, resp)
+}
+
+// dryRunPicks simulates the first pick and the failover picks of the retries
+func dryRunPicks(policy *routingPolicy, candidates []*model.Channel) []int {
+	remaining := slices.Clone(candidates)
+	picks := make([]int, 0, len(remaining))
+
+	for len(remaining) > 0 {
+		policy.offset = uint64(len(picks))
+
+		channel, err := pickChannel(remaining, policy)
+		if err != nil {
+			break
+		}
+
+		picks = append(picks, channel.ID)
+		remaining = slices.DeleteFunc(remaining, func(ch *model.Channel) bool {
+			return ch.ID == channel.ID
+		})
+	}
+
+	return picks
+}
@@ -0,0 +1,278 @@
+package controller
+
+import (
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"html/template"
+	"mime"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/labring/aiproxy/core/controller/utils"
+	"github.com/labring/aiproxy/core/middleware"
+	"github.com/labring/aiproxy/core/model"
+	"github.com/labring/aiproxy/core/public"
+)
+
+const (
+	statementMaxSpan      = 366 * 24 * time.Hour
+	statementPeriodLayout = "2006-01"
+	statementTimeLayout   = "2006-01-02 15:04 MST"
+
+	statementFormatJSON = "json"
+	statementFormatCSV  = "csv"
+	statementFormatHTML = "html"
+)
+
+var statementTemplate = template.Must(
+	template.ParseFS(public.Templates, "templates/statement.tmpl"),
+)
+
+type statementParams struct {
+	format   string
+	location *time.Location
+	start    time.Time
+	end      time.Time
+}
+
+// parseStatementParams parses the billing period, a period=YYYY-MM selects a
+// calendar month in the timezone, otherwise the start and end timestamps are
+// used
+func parseStatementParams(c *gin.Context) (statementParams, error) {
+	format := c.DefaultQuery("format", statementFormatJSON)
+	switch format {
+	case statementFormatJSON, statementFormatCSV, statementFormatHTML:
+	default:
+		return statementParams{}, errors.New("format must be json, csv or html")
+	}
+
+	location, err := time.LoadLocation(c.DefaultQuery("timezone", "Local"))
+	if err != nil {
+		return statementParams{}, fmt.Errorf("invalid timezone: %w", err)
+	}
+
+	if period := c.Query("period"); period != "" {
+		start, err := time.ParseInLocation(statementPeriodLayout, period, location)
+		if err != nil {
+			return statementParams{}, errors.New("period must be in the format YYYY-MM")
+		}
+
+		return statementParams{
+			format:   format,
+			location: location,
+			start:    start,
+			end:      start.AddDate(0, 1, 0),
+		}, nil
+	}
+
+	start, end := utils.ParseTimeRange(c, statementMaxSpan)
+	if !start.Before(end) {
+		return statementParams{}, errors.New(
+			"start_timestamp must be less than end_timestamp",
+		)
+	}
+
+	return statementParams{
+		format:   format,
+		location: location,
+		start:    start.In(location),
+		end:      end.In(location),
+	}, nil
+}
+
+// GetGroupStatement godoc
+//
+//	@Summary		Get group statement
+//	@Description	Returns the usage statement of a group for a billing period, totalled by model, token and mode from the hourly summaries. The html format is a printable page, print it to PDF from the browser
+//	@Tags			group
+//	@Produce		json
+//	@Produce		text/csv
+//	@Produce		text/html
+//	@Security		ApiKeyAuth
+//	@Param			group			path		string	true	"Group name"
+//	@Param			period			query		string	false	"Billing month in the format YYYY-MM, overrides the timestamps"
+//	@Param			start_timestamp	query		int		false	"Start timestamp, max span 366 days"
+//	@Param			end_timestamp	query		int		false	"End timestamp, max span 366 days"
+//	@Param			timezone		query		string	false	"Timezone, default is Local"
+//	@Param			format			query		string	false	"Output format, json, csv or html, default is json"
+//	@Success		200				{object}	middleware.APIResponse{data=model.Statement}
+//	@Router			/api/group/{group}/statement [get]
+func GetGroupStatement(c *gin.Context) {
+	group := c.Param("group")
+	if group == "" {
+		middleware.ErrorResponse(c, http.StatusBadRequest, "invalid group parameter")
+		return
+	}
+
+	params, err := parseStatementParams(c)
+	if err != nil {
+		middleware.ErrorResponse(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	statement, err := model.GetGroupStatement(group, params.start, params.end)
+	if err != nil {
+		middleware.ErrorResponse(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	statement.Start = statement.Start.In(params.location)
+	statement.End = statement.End.In(params.location)
+	statement.GeneratedAt = statement.GeneratedAt.In(params.location)
+
+	switch params.format {
+	case statementFormatCSV:
+		content, err := buildStatementCSV(statement)
+		if err != nil {
+			middleware.ErrorResponse(c, http.StatusInternalServerError, err.Error())
+			return
+		}
+
+		c.Header("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{
+			"filename": buildStatementFilename(statement, "csv"),
+		}))
+		c.Data(http.StatusOK, "text/csv; charset=utf-8", content)
+	case statementFormatHTML:
+		var buffer bytes.Buffer
+		if err := statementTemplate.Execute(&buffer, statement); err != nil {
+			middleware.ErrorResponse(c, http.StatusInternalServerError, err.Error())
+			return
+		}
+
+		c.Header("Content-Disposition", mime.FormatMediaType("inline", map[string]string{
+			"filename": buildStatementFilename(statement, "html"),
+		}))
+		c.Data(http.StatusOK, "text/html; charset=utf-8", buffer.Bytes())
+	default:
+		middleware.SuccessResponse(c, statement)
+	}
+}
+
+func buildStatementFilename(statement *model.Statement, ext string) string {
+	return sanitizeFilename(fmt.Sprintf(
+		"%s_statement_%s_%s.%s",
+		statement.GroupID,
+		statement.Start.Format("20060102"),
+		statement.End.Format("20060102"),
+		ext,
+	))
+}
+
+var statementCSVHeader = []string{
+	"section",
+	"name",
+	"token_name",
+	"model",
+	"mode",
+	"request_count",
+	"exception_count",
+	"input_tokens",
+	"image_input_tokens",
+	"audio_input_tokens",
+	"video_input_tokens",
+	"output_tokens",
+	"image_output_tokens",
+	"audio_output_tokens",
+	"cached_tokens",
+	"cache_creation_tokens",
+	"reasoning_tokens",
+	"total_tokens",
+	"web_search_count",
+	"input_amount",
+	"image_input_amount",
+	"audio_input_amount",
+	"video_input_amount",
+	"output_amount",
+	"image_output_amount",
+	"audio_output_amount",
+	"cached_amount",
+	"cache_creation_amount",
+	"web_search_amount",
+	"used_amount",
+}
+
+// buildStatementCSV writes the statement as one table, the section column
+// tells the token/model lines apart from the model, token, mode and total
+// subtotals
+func buildStatementCSV(statement *model.Statement) ([]byte, error) {
+	var buffer bytes.Buffer
+
+	buffer.WriteString("\xEF\xBB\xBF")
+
+	writer := csv.NewWriter(&buffer)
+	if err := writer.Write(statementCSVHeader); err != nil {
+		return nil, err
+	}
+
+	rows := make([][]string, 0, len(statement.Lines)+
+		len(statement.Models)+len(statement.Tokens)+len(statement.Modes)+1)
+
+	for _, line := range statement.Lines {
+		rows = append(rows, buildStatementCSVRow(
+			"line", line.StatementItem, line.TokenName, line.Model, line.Mode,
+		))
+	}
+
+	for _, item := range statement.Models {
+		rows = append(rows, buildStatementCSVRow("model", item, "", item.Name, ""))
+	}
+
+	for _, item := range statement.Tokens {
+		rows = append(rows, buildStatementCSVRow("token", item, item.Name, "", ""))
+	}
+
+	for _, item := range statement.Modes {
+		rows = append(rows, buildStatementCSVRow("mode", item, "", "", item.Name))
+	}
+
+	rows = append(rows, buildStatementCSVRow("total", statement.Total, "", "", ""))
+
+	if err := writer.WriteAll(rows); err != nil {
+		return nil, err
+	}
+
+	return buffer.Bytes(), nil
+}
+
+func buildStatementCSVRow(
+	section string,
+	item model.StatementItem,
+	tokenName, modelName, mode string,
+) []string {
+	return []string{
+		section,
+		sanitizeCSVCell(item.Name),
+		sanitizeCSVCell(tokenName),
+		sanitizeCSVCell(modelName),
+		mode,
+		strconv.FormatInt(item.RequestCount, 10),
+		strconv.FormatInt(item.ExceptionCount, 10),
+		strconv.FormatInt(int64(item.InputTokens), 10),
+		strconv.FormatInt(int64(item.ImageInputTokens), 10),
+		strconv.FormatInt(int64(item.AudioInputTokens), 10),
+		strconv.FormatInt(int64(item.VideoInputTokens), 10),
+		strconv.FormatInt(int64(item.OutputTokens), 10),
+		strconv.FormatInt(int64(item.ImageOutputTokens), 10),
+		strconv.FormatInt(int64(item.AudioOutputTokens), 10),
+		strconv.FormatInt(int64(item.CachedTokens), 10),
+		strconv.FormatInt(int64(item.CacheCreationTokens), 10),
+		strconv.FormatInt(int64(item.ReasoningTokens), 10),
+		strconv.FormatInt(int64(item.TotalTokens), 10),
+		strconv.FormatInt(int64(item.WebSearchCount), 10),
+		formatFloatForExport(item.InputAmount),
+		formatFloatForExport(item.ImageInputAmount),
+		formatFloatForExport(item.AudioInputAmount),
+		formatFloatForExport(item.VideoInputAmount),
+		formatFloatForExport(item.OutputAmount),
+		formatFloatForExport(item.ImageOutputAmount),
+		formatFloatForExport(item.AudioOutputAmount),
+		formatFloatForExport(item.CachedAmount),
+		formatFloatForExport(item.CacheCreationAmount),
+		formatFloatForExport(item.WebSearchAmount),
+		formatFloatForExport(item.UsedAmount),
+	}
+}
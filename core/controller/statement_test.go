@@ -0,0 +1,126 @@
+package controller
+
+import (
+	"bytes"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/labring/aiproxy/core/model"
+)
+
+func newTestStatement() *model.Statement {
+	item := model.StatementItem{Name: "=token", RequestCount: 2}
+	item.InputTokens = 20
+	item.InputAmount = 0.1
+	item.ImageInputAmount = 0.2
+	item.OutputAmount = 0.3
+	item.CachedAmount = 0.05
+	item.UsedAmount = 0.65
+
+	return &model.Statement{
+		GroupID: "demo",
+		Start:   time.Date(2026, time.March, 1, 0, 0, 0, 0, time.UTC),
+		End:     time.Date(2026, time.April, 1, 0, 0, 0, 0, time.UTC),
+		Total:   model.StatementItem{Name: "total", RequestCount: 2, Amount: item.Amount},
+		Tokens:  []model.StatementItem{item},
+		Lines: []model.StatementLine{
+			{TokenName: "=token", Model: "gpt-4o", Mode: "ChatCompletions", StatementItem: item},
+		},
+	}
+}
+
+func TestBuildStatementCSV(t *testing.T) {
+	content, err := buildStatementCSV(newTestStatement())
+	if err != nil {
+		t.Fatalf("build csv: %v", err)
+	}
+
+	records := parseLogExportCSV(t, content)
+	if len(records) != 4 {
+		t.Fatalf("expected header, line, token and total rows, got %d", len(records))
+	}
+
+	values := csvRecordMap(t, records)
+	if values["section"] != "line" || values["token_name"] != "'=token" {
+		t.Fatalf("unexpected line row: %v", values)
+	}
+
+	if values["image_input_amount"] != "0.2" || values["used_amount"] != "0.65" {
+		t.Fatalf("unexpected amounts: %v", values)
+	}
+
+	if records[2][0] != "token" || records[3][0] != "total" {
+		t.Fatalf("unexpected sections: %v, %v", records[2][0], records[3][0])
+	}
+}
+
+func TestParseStatementParamsPeriod(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	newContext := func(target string) *gin.Context {
+		c, _ := gin.CreateTestContext(httptest.NewRecorder())
+		c.Request = httptest.NewRequest("GET", target, nil)
+
+		return c
+	}
+
+	params, err := parseStatementParams(newContext(
+		"/api/group/demo/statement?period=2026-02&timezone=Asia/Shanghai&format=html",
+	))
+	if err != nil {
+		t.Fatalf("parse params: %v", err)
+	}
+
+	if params.format != statementFormatHTML {
+		t.Fatalf("unexpected format: %s", params.format)
+	}
+
+	if got := params.start.UTC(); !got.Equal(time.Date(2026, time.January, 31, 16, 0, 0, 0, time.UTC)) {
+		t.Fatalf("unexpected start: %v", got)
+	}
+
+	if got := params.end.Sub(params.start); got != 28*24*time.Hour {
+		t.Fatalf("unexpected span: %v", got)
+	}
+
+	if _, err := parseStatementParams(
+		newContext("/api/group/demo/statement?period=2026"),
+	); err == nil {
+		t.Fatal("expected invalid period error")
+	}
+
+	if _, err := parseStatementParams(
+		newContext("/api/group/demo/statement?format=pdf"),
+	); err == nil {
+		t.Fatal("expected invalid format error")
+	}
+
+	if _, err := parseStatementParams(
+		newContext("/api/group/demo/statement?period=2026-02&timezone=Mars/Olympus"),
+	); err == nil {
+		t.Fatal("expected invalid timezone error")
+	}
+}
+
+func TestStatementTemplate(t *testing.T) {
+	var buffer bytes.Buffer
+	if err := statementTemplate.Execute(&buffer, newTestStatement()); err != nil {
+		t.Fatalf("execute template: %v", err)
+	}
+
+	html := buffer.String()
+	for _, want := range []string{
+		"Group: demo",
+		"0.300000",
+		"0.650000",
+		"=token",
+		"No usage",
+	} {
+		if !strings.Contains(html, want) {
+			t.Fatalf("expected %q in statement html", want)
+		}
+	}
+}
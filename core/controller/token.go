@@ -1,6 +1,7 @@
 package controller
 
 import (
+	"errors"
 	"fmt"
 	"net/http"
 	"strconv"
@@ -33,14 +34,28 @@ func (t *TokenResponse) MarshalJSON() ([]byte, error) {
 		CreatedAt            int64 `json:"created_at"`
 		PeriodLastUpdateTime int64 `json:"period_last_update_time"`
 		AccessedAt           int64 `json:"accessed_at"`
+		ActivateAt           int64 `json:"activate_at"`
+		ExpiredAt            int64 `json:"expired_at"`
+		PreviousKeyExpiredAt int64 `json:"previous_key_expired_at"`
 	}{
 		Alias:                (*Alias)(t),
 		CreatedAt:            t.CreatedAt.UnixMilli(),
 		PeriodLastUpdateTime: t.PeriodLastUpdateTime.UnixMilli(),
 		AccessedAt:           accessedAt,
+		ActivateAt:           timeToUnixMilli(t.ActivateAt),
+		ExpiredAt:            timeToUnixMilli(t.ExpiredAt),
+		PreviousKeyExpiredAt: timeToUnixMilli(t.PreviousKeyExpiredAt),
 	})
 }
 
+func timeToUnixMilli(t time.Time) int64 {
+	if t.IsZero() {
+		return 0
+	}
+
+	return t.UnixMilli()
+}
+
 type (
 	AddTokenRequest struct {
 		Name                 string   `json:"name"`
@@ -50,6 +65,15 @@ type (
 		PeriodQuota          float64  `json:"period_quota"`
 		PeriodType           string   `json:"period_type"`
 		PeriodLastUpdateTime int64    `json:"period_last_update_time"`
+		// ActivateAt and ExpiredAt are unix milliseconds, 0 means not set
+		ActivateAt int64 `json:"activate_at"`
+		ExpiredAt  int64 `json:"expired_at"`
+		// RPM, TPM and MaxConcurrency limit the token across all models, 0 means unlimited
+		RPM            int64 `json:"rpm"`
+		TPM            int64 `json:"tpm"`
+		MaxConcurrency int64 `json:"max_concurrency"`
+		// MCPACL restricts the mcps and the tools the token can use
+		MCPACL model.MCPACL `json:"mcp_acl"`
 	}
 
 	UpdateTokenStatusRequest struct {
@@ -59,22 +83,39 @@ type (
 	UpdateTokenNameRequest struct {
 		Name string `json:"name"`
 	}
+
+	RotateTokenRequest struct {
+		// GracePeriod is how many seconds the current key keeps working, 0 revokes it at once
+		GracePeriod int64 `json:"grace_period"`
+	}
 )
 
 func (at *AddTokenRequest) ToToken() *model.Token {
 	token := &model.Token{
-		Name:        model.EmptyNullString(at.Name),
-		Subnets:     at.Subnets,
-		Models:      at.Models,
-		Quota:       at.Quota,
-		PeriodQuota: at.PeriodQuota,
-		PeriodType:  model.EmptyNullString(at.PeriodType),
+		Name:           model.EmptyNullString(at.Name),
+		Subnets:        at.Subnets,
+		Models:         at.Models,
+		Quota:          at.Quota,
+		PeriodQuota:    at.PeriodQuota,
+		PeriodType:     model.EmptyNullString(at.PeriodType),
+		RPM:            at.RPM,
+		TPM:            at.TPM,
+		MaxConcurrency: at.MaxConcurrency,
+		MCPACL:         at.MCPACL,
 	}
 
 	if at.PeriodLastUpdateTime > 0 {
 		token.PeriodLastUpdateTime = time.UnixMilli(at.PeriodLastUpdateTime)
 	}
 
+	if at.ActivateAt > 0 {
+		token.ActivateAt = time.UnixMilli(at.ActivateAt)
+	}
+
+	if at.ExpiredAt > 0 {
+		token.ExpiredAt = time.UnixMilli(at.ExpiredAt)
+	}
+
 	return token
 }
 
@@ -83,6 +124,10 @@ func validateToken(token AddTokenRequest) error {
 		return fmt.Errorf("invalid subnet: %w", err)
 	}
 
+	if err := token.MCPACL.Validate(); err != nil {
+		return fmt.Errorf("invalid mcp acl: %w", err)
+	}
+
 	return nil
 }
 
@@ -710,3 +755,90 @@ func UpdateGroupTokenName(c *gin.Context) {
 
 	middleware.SuccessResponse(c, nil)
 }
+
+// RotateToken godoc
+//
+//	@Summary		Rotate token key
+//	@Description	Issues a new key for a token and keeps its usage, the current key keeps working during the grace period
+//	@Tags			tokens
+//	@Accept			json
+//	@Produce		json
+//	@Security		ApiKeyAuth
+//	@Param			id		path		int					true	"Token ID"
+//	@Param			rotate	body		RotateTokenRequest	false	"Rotate options"
+//	@Success		200		{object}	middleware.APIResponse{data=TokenResponse}
+//	@Router			/api/tokens/{id}/rotate [post]
+func RotateToken(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		middleware.ErrorResponse(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	gracePeriod, err := getRotateGracePeriod(c)
+	if err != nil {
+		middleware.ErrorResponse(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	token, err := model.RotateToken(id, gracePeriod)
+	if err != nil {
+		middleware.ErrorResponse(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	middleware.SuccessResponse(c, &TokenResponse{Token: token})
+}
+
+// RotateGroupToken godoc
+//
+//	@Summary		Rotate group token key
+//	@Description	Issues a new key for a token in a specific group and keeps its usage, the current key keeps working during the grace period
+//	@Tags			token
+//	@Accept			json
+//	@Produce		json
+//	@Security		ApiKeyAuth
+//	@Param			group	path		string				true	"Group name"
+//	@Param			id		path		int					true	"Token ID"
+//	@Param			rotate	body		RotateTokenRequest	false	"Rotate options"
+//	@Success		200		{object}	middleware.APIResponse{data=TokenResponse}
+//	@Router			/api/token/{group}/{id}/rotate [post]
+func RotateGroupToken(c *gin.Context) {
+	group := c.Param("group")
+
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		middleware.ErrorResponse(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	gracePeriod, err := getRotateGracePeriod(c)
+	if err != nil {
+		middleware.ErrorResponse(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	token, err := model.RotateGroupToken(group, id, gracePeriod)
+	if err != nil {
+		middleware.ErrorResponse(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	middleware.SuccessResponse(c, &TokenResponse{Token: token})
+}
+
+// getRotateGracePeriod reads the optional rotate request body
+func getRotateGracePeriod(c *gin.Context) (time.Duration, error) {
+	var req RotateTokenRequest
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			return 0, err
+		}
+	}
+
+	if req.GracePeriod < 0 {
+		return 0, errors.New("grace_period must not be negative")
+	}
+
+	return time.Duration(req.GracePeriod) * time.Second, nil
+}
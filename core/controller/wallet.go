@@ -0,0 +1,267 @@
+package controller
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/labring/aiproxy/core/common/balance"
+	"github.com/labring/aiproxy/core/controller/utils"
+	"github.com/labring/aiproxy/core/middleware"
+	"github.com/labring/aiproxy/core/model"
+	log "github.com/sirupsen/logrus"
+)
+
+type GroupWalletResponse struct {
+	*model.GroupWallet
+	Remain     float64 `json:"remain"`
+	TotalTopUp float64 `json:"total_top_up"`
+}
+
+// GetGroupWallet godoc
+//
+//	@Summary		Get group wallet
+//	@Description	Returns the prepaid wallet of a group
+//	@Tags			wallet
+//	@Produce		json
+//	@Security		ApiKeyAuth
+//	@Param			group	path		string	true	"Group name"
+//	@Success		200		{object}	middleware.APIResponse{data=GroupWalletResponse}
+//	@Router			/api/group/{group}/wallet [get]
+func GetGroupWallet(c *gin.Context) {
+	group := c.Param("group")
+	if group == "" {
+		middleware.ErrorResponse(c, http.StatusBadRequest, "group id is empty")
+		return
+	}
+
+	wallet, err := model.GetOrEmptyGroupWallet(group)
+	if err != nil {
+		middleware.ErrorResponse(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	totalTopUp, err := model.GetGroupWalletTotalTopUp(group)
+	if err != nil {
+		middleware.ErrorResponse(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	middleware.SuccessResponse(c, &GroupWalletResponse{
+		GroupWallet: wallet,
+		Remain:      wallet.Remain(),
+		TotalTopUp:  totalTopUp,
+	})
+}
+
+type GroupWalletChangeRequest struct {
+	Amount float64 `json:"amount"`
+	Remark string  `json:"remark"`
+}
+
+// CreditGroupWallet godoc
+//
+//	@Summary		Credit group wallet
+//	@Description	Tops up the prepaid wallet of a group
+//	@Tags			wallet
+//	@Accept			json
+//	@Produce		json
+//	@Security		ApiKeyAuth
+//	@Param			group	path		string						true	"Group name"
+//	@Param			data	body		GroupWalletChangeRequest	true	"Top up information"
+//	@Success		200		{object}	middleware.APIResponse{data=model.GroupWallet}
+//	@Router			/api/group/{group}/wallet/credit [post]
+func CreditGroupWallet(c *gin.Context) {
+	group, req, ok := bindGroupWalletChangeRequest(c)
+	if !ok {
+		return
+	}
+
+	wallet, err := model.TopUpGroupWallet(group, req.Amount, req.Remark)
+	if err != nil {
+		middleware.ErrorResponse(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	if err := balance.UpdateWalletCache(c.Request.Context(), wallet); err != nil {
+		log.Errorf("failed to update wallet cache: %s", err.Error())
+	}
+
+	middleware.SuccessResponse(c, wallet)
+}
+
+// DebitGroupWallet godoc
+//
+//	@Summary		Debit group wallet
+//	@Description	Deducts an amount from the prepaid wallet of a group, the balance can't go below the credit limit
+//	@Tags			wallet
+//	@Accept			json
+//	@Produce		json
+//	@Security		ApiKeyAuth
+//	@Param			group	path		string						true	"Group name"
+//	@Param			data	body		GroupWalletChangeRequest	true	"Debit information"
+//	@Success		200		{object}	middleware.APIResponse{data=model.GroupWallet}
+//	@Router			/api/group/{group}/wallet/debit [post]
+func DebitGroupWallet(c *gin.Context) {
+	group, req, ok := bindGroupWalletChangeRequest(c)
+	if !ok {
+		return
+	}
+
+	wallet, err := model.DebitGroupWallet(group, req.Amount, req.Remark)
+	if err != nil {
+		if errors.Is(err, model.ErrWalletInsufficientBalance) {
+			middleware.ErrorResponse(c, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		middleware.ErrorResponse(c, http.StatusInternalServerError, err.Error())
+
+		return
+	}
+
+	if err := balance.UpdateWalletCache(c.Request.Context(), wallet); err != nil {
+		log.Errorf("failed to update wallet cache: %s", err.Error())
+	}
+
+	middleware.SuccessResponse(c, wallet)
+}
+
+func bindGroupWalletChangeRequest(c *gin.Context) (string, GroupWalletChangeRequest, bool) {
+	req := GroupWalletChangeRequest{}
+
+	group := c.Param("group")
+	if group == "" {
+		middleware.ErrorResponse(c, http.StatusBadRequest, "invalid parameter")
+		return "", req, false
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil || req.Amount <= 0 {
+		middleware.ErrorResponse(c, http.StatusBadRequest, "invalid parameter")
+		return "", req, false
+	}
+
+	if _, err := model.GetGroupByID(group, false); err != nil {
+		middleware.ErrorResponse(c, http.StatusNotFound, err.Error())
+		return "", req, false
+	}
+
+	return group, req, true
+}
+
+type UpdateGroupWalletCreditLimitRequest struct {
+	CreditLimit float64 `json:"credit_limit"`
+}
+
+// UpdateGroupWalletCreditLimit godoc
+//
+//	@Summary		Update group wallet credit limit
+//	@Description	Updates how far the wallet balance of a group can go below zero
+//	@Tags			wallet
+//	@Accept			json
+//	@Produce		json
+//	@Security		ApiKeyAuth
+//	@Param			group	path		string								true	"Group name"
+//	@Param			data	body		UpdateGroupWalletCreditLimitRequest	true	"Credit limit information"
+//	@Success		200		{object}	middleware.APIResponse{data=model.GroupWallet}
+//	@Router			/api/group/{group}/wallet/credit_limit [post]
+func UpdateGroupWalletCreditLimit(c *gin.Context) {
+	group := c.Param("group")
+	if group == "" {
+		middleware.ErrorResponse(c, http.StatusBadRequest, "invalid parameter")
+		return
+	}
+
+	req := UpdateGroupWalletCreditLimitRequest{}
+
+	err := c.ShouldBindJSON(&req)
+	if err != nil || req.CreditLimit < 0 {
+		middleware.ErrorResponse(c, http.StatusBadRequest, "invalid parameter")
+		return
+	}
+
+	if _, err := model.GetGroupByID(group, false); err != nil {
+		middleware.ErrorResponse(c, http.StatusNotFound, err.Error())
+		return
+	}
+
+	wallet, err := model.SetGroupWalletCreditLimit(group, req.CreditLimit)
+	if err != nil {
+		middleware.ErrorResponse(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	if err := balance.UpdateWalletCache(c.Request.Context(), wallet); err != nil {
+		log.Errorf("failed to update wallet cache: %s", err.Error())
+	}
+
+	middleware.SuccessResponse(c, wallet)
+}
+
+// GetGroupWalletLedgers godoc
+//
+//	@Summary		Get group wallet ledgers
+//	@Description	Returns the balance changes of a group wallet with pagination
+//	@Tags			wallet
+//	@Produce		json
+//	@Security		ApiKeyAuth
+//	@Param			group		path		string	true	"Group name"
+//	@Param			type		query		string	false	"Ledger type, topup, debit or consume"
+//	@Param			page		query		int		false	"Page number"
+//	@Param			per_page	query		int		false	"Items per page"
+//	@Success		200			{object}	middleware.APIResponse{data=map[string]any{ledgers=[]model.GroupWalletLedger,total=int}}
+//	@Router			/api/group/{group}/wallet/ledgers [get]
+func GetGroupWalletLedgers(c *gin.Context) {
+	group := c.Param("group")
+	if group == "" {
+		middleware.ErrorResponse(c, http.StatusBadRequest, "invalid parameter")
+		return
+	}
+
+	page, perPage := utils.ParsePageParams(c)
+	ledgerType := model.WalletLedgerType(c.Query("type"))
+
+	ledgers, total, err := model.GetGroupWalletLedgers(group, ledgerType, page, perPage)
+	if err != nil {
+		middleware.ErrorResponse(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	middleware.SuccessResponse(c, gin.H{
+		"ledgers": ledgers,
+		"total":   total,
+	})
+}
+
+// GetGroupWalletTopUps godoc
+//
+//	@Summary		Get group wallet top ups
+//	@Description	Returns the top ups of a group wallet with pagination
+//	@Tags			wallet
+//	@Produce		json
+//	@Security		ApiKeyAuth
+//	@Param			group		path		string	true	"Group name"
+//	@Param			page		query		int		false	"Page number"
+//	@Param			per_page	query		int		false	"Items per page"
+//	@Success		200			{object}	middleware.APIResponse{data=map[string]any{top_ups=[]model.GroupWalletTopUp,total=int}}
+//	@Router			/api/group/{group}/wallet/topups [get]
+func GetGroupWalletTopUps(c *gin.Context) {
+	group := c.Param("group")
+	if group == "" {
+		middleware.ErrorResponse(c, http.StatusBadRequest, "invalid parameter")
+		return
+	}
+
+	page, perPage := utils.ParsePageParams(c)
+
+	topUps, total, err := model.GetGroupWalletTopUps(group, page, perPage)
+	if err != nil {
+		middleware.ErrorResponse(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	middleware.SuccessResponse(c, gin.H{
+		"top_ups": topUps,
+		"total":   total,
+	})
+}
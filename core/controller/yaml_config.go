@@ -0,0 +1,96 @@
+package controller
+
+import (
+	"errors"
+	"net/http"
+	"os"
+
+	"github.com/gin-gonic/gin"
+	"github.com/labring/aiproxy/core/common"
+	"github.com/labring/aiproxy/core/common/config"
+	"github.com/labring/aiproxy/core/middleware"
+	"github.com/labring/aiproxy/core/model"
+)
+
+// loadRequestYAMLConfig parses the yaml config in the request body, or the
+// config file when the body is empty
+func loadRequestYAMLConfig(c *gin.Context) (*model.YAMLConfig, int, error) {
+	body, err := common.GetRequestBody(c.Request)
+	if err != nil {
+		return nil, http.StatusBadRequest, err
+	}
+
+	if len(body) == 0 {
+		body, err = config.LoadYAMLConfigData()
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil, http.StatusNotFound, errors.New("config file not found")
+			}
+
+			return nil, http.StatusInternalServerError, err
+		}
+	}
+
+	yamlConfig, err := model.ParseYAMLConfig(body)
+	if err != nil {
+		return nil, http.StatusBadRequest, err
+	}
+
+	return yamlConfig, http.StatusOK, nil
+}
+
+// PlanYAMLConfig godoc
+//
+//	@Summary		Plan yaml config
+//	@Description	Shows the changes applying the yaml config would make to the groups, tokens, group model configs and public mcps
+//	@Tags			option
+//	@Accept			plain
+//	@Produce		json
+//	@Security		ApiKeyAuth
+//	@Param			prune	query		bool	false	"Delete the tokens and group model configs of the declared groups and the public mcps not in the config"
+//	@Param			config	body		string	false	"YAML config, defaults to the config file"
+//	@Success		200		{object}	middleware.APIResponse{data=model.YAMLConfigPlan}
+//	@Router			/api/config/plan [post]
+func PlanYAMLConfig(c *gin.Context) {
+	yamlConfig, status, err := loadRequestYAMLConfig(c)
+	if err != nil {
+		middleware.ErrorResponse(c, status, err.Error())
+		return
+	}
+
+	plan, err := model.PlanYAMLConfig(yamlConfig, c.Query("prune") == "true")
+	if err != nil {
+		middleware.ErrorResponse(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	middleware.SuccessResponse(c, plan)
+}
+
+// ApplyYAMLConfig godoc
+//
+//	@Summary		Apply yaml config
+//	@Description	Reconciles the groups, tokens, group model configs and public mcps to the yaml config
+//	@Tags			option
+//	@Accept			plain
+//	@Produce		json
+//	@Security		ApiKeyAuth
+//	@Param			prune	query		bool	false	"Delete the tokens and group model configs of the declared groups and the public mcps not in the config"
+//	@Param			config	body		string	false	"YAML config, defaults to the config file"
+//	@Success		200		{object}	middleware.APIResponse{data=model.YAMLConfigPlan}
+//	@Router			/api/config/apply [post]
+func ApplyYAMLConfig(c *gin.Context) {
+	yamlConfig, status, err := loadRequestYAMLConfig(c)
+	if err != nil {
+		middleware.ErrorResponse(c, status, err.Error())
+		return
+	}
+
+	plan, err := model.ApplyYAMLConfig(yamlConfig, c.Query("prune") == "true")
+	if err != nil {
+		middleware.ErrorResponse(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	middleware.SuccessResponse(c, plan)
+}
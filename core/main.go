@@ -84,6 +84,10 @@ func main() {
 
 	go task.UsageAlertTask(ctx)
 
+	log.Info("disable expired tokens task started")
+
+	go task.DisableExpiredTokensTask(ctx)
+
 	log.Info("async usage poll task started")
 
 	go task.AsyncUsagePollTask(ctx)
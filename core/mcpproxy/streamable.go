@@ -16,9 +16,21 @@ const (
 
 // StreamableProxy represents a proxy for the MCP Streamable HTTP transport
 type StreamableProxy struct {
-	store   SessionManager
-	backend string
-	headers map[string]string
+	store         SessionManager
+	backend       string
+	headers       map[string]string
+	messageFilter func(message []byte) []byte
+}
+
+// StreamableProxyOption defines a function type for configuring StreamableProxy
+type StreamableProxyOption func(*StreamableProxy)
+
+// WithMessageFilter sets a function rewriting the JSON-RPC messages the
+// backend answers to the POST requests
+func WithMessageFilter(filter func(message []byte) []byte) StreamableProxyOption {
+	return func(p *StreamableProxy) {
+		p.messageFilter = filter
+	}
 }
 
 // NewStreamableProxy creates a new proxy for the Streamable HTTP transport
@@ -26,12 +38,62 @@ func NewStreamableProxy(
 	backend string,
 	headers map[string]string,
 	store SessionManager,
+	opts ...StreamableProxyOption,
 ) *StreamableProxy {
-	return &StreamableProxy{
+	p := &StreamableProxy{
 		store:   store,
 		backend: backend,
 		headers: headers,
 	}
+
+	for _, opt := range opts {
+		opt(p)
+	}
+
+	return p
+}
+
+// writeEventLine writes a line of an SSE stream answering a POST request,
+// the data lines are rewritten by the message filter
+func (p *StreamableProxy) writeEventLine(w io.Writer, line string) {
+	if p.messageFilter == nil {
+		_, _ = fmt.Fprint(w, line)
+		return
+	}
+
+	data, ok := strings.CutPrefix(line, "data:")
+	if !ok {
+		_, _ = fmt.Fprint(w, line)
+		return
+	}
+
+	data = strings.TrimSpace(data)
+	if data == "" {
+		_, _ = fmt.Fprint(w, line)
+		return
+	}
+
+	_, _ = fmt.Fprintf(w, "data: %s\n", p.messageFilter([]byte(data)))
+}
+
+// copyBody copies a JSON body answering a POST request, the body is rewritten
+// by the message filter
+func (p *StreamableProxy) copyBody(w io.Writer, body io.Reader) {
+	if p.messageFilter == nil {
+		_, _ = io.Copy(w, body)
+		return
+	}
+
+	message, err := io.ReadAll(body)
+	if err != nil {
+		return
+	}
+
+	if len(message) > 0 {
+		message = p.messageFilter(message)
+	}
+
+	_, _ = w.Write(message)
 }
 
 // ServeHTTP handles both GET and POST requests for the Streamable HTTP transport
@@ -265,13 +327,12 @@ func (p *StreamableProxy) handlePostRequest(w http.ResponseWriter, r *http.Reque
 			}
 
 			// Write the line to the client
-			_, _ = fmt.Fprint(w, line)
-
+			p.writeEventLine(w, line)
 			flusher.Flush()
 		}
 	} else {
 		// Copy regular response body
-		_, _ = io.Copy(w, resp.Body)
+		p.copyBody(w, resp.Body)
 	}
 }
 
@@ -418,11 +479,11 @@ func (p *StreamableProxy) proxyInitialOrNoSessionRequest(w http.ResponseWriter,
 			}
 
 			// Write the line to the client
-			fmt.Fprint(w, line)
+			p.writeEventLine(w, line)
 			flusher.Flush()
 		}
 	} else {
 		// Copy regular response body
-		_, _ = io.Copy(w, resp.Body)
+		p.copyBody(w, resp.Body)
 	}
 }
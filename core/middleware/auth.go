@@ -8,6 +8,7 @@ import (
 	"strings"
 
 	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
 	"github.com/labring/aiproxy/core/common"
 	"github.com/labring/aiproxy/core/common/config"
 	"github.com/labring/aiproxy/core/common/network"
@@ -15,6 +16,7 @@ import (
 	"github.com/labring/aiproxy/core/model"
 	"github.com/labring/aiproxy/core/relay/meta"
 	"github.com/labring/aiproxy/core/relay/mode"
+	relaymodel "github.com/labring/aiproxy/core/relay/model"
 	"github.com/sirupsen/logrus"
 )
 
@@ -84,6 +86,12 @@ func TokenAuth(c *gin.Context) {
 		key = c.Request.Header.Get("X-Goog-Api-Key")
 	}
 
+	// browsers can't set headers on websocket connections, the realtime api key is
+	// passed by the subprotocols instead
+	if key == "" && websocket.IsWebSocketUpgrade(c.Request) {
+		key = relaymodel.RealtimeAPIKeyFromProtocols(websocket.Subprotocols(c.Request))
+	}
+
 	key = strings.TrimPrefix(
 		strings.TrimPrefix(key, "Bearer "),
 		"sk-",
@@ -21,6 +21,7 @@ const (
 	ResponseID         = "response_id"
 	VideoID            = "video_id"
 	FileID             = "file_id"
+	BatchID            = "batch_id"
 
 	requestBodyNode = "request_body_node"
 )
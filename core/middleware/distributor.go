@@ -1,8 +1,10 @@
 package middleware
 
 import (
+	"bufio"
 	"errors"
 	"fmt"
+	"io"
 	"net/http"
 	"slices"
 	"strconv"
@@ -19,6 +21,7 @@ import (
 	"github.com/labring/aiproxy/core/common/notify"
 	"github.com/labring/aiproxy/core/common/reqlimit"
 	"github.com/labring/aiproxy/core/model"
+	"github.com/labring/aiproxy/core/relay/adaptors"
 	"github.com/labring/aiproxy/core/relay/meta"
 	"github.com/labring/aiproxy/core/relay/mode"
 	relaymodel "github.com/labring/aiproxy/core/relay/model"
@@ -85,6 +88,16 @@ func GetGroupAdjustedModelConfig(group model.GroupCache, mc model.ModelConfig) m
 var (
 	ErrRequestRateLimitExceeded = errors.New("request rate limit exceeded, please try again later")
 	ErrRequestTpmLimitExceeded  = errors.New("request tpm limit exceeded, please try again later")
+
+	ErrTokenRequestRateLimitExceeded = errors.New(
+		"token request rate limit exceeded, please try again later",
+	)
+	ErrTokenTpmLimitExceeded = errors.New(
+		"token tpm limit exceeded, please try again later",
+	)
+	ErrTokenConcurrencyLimitExceeded = errors.New(
+		"token concurrent requests limit exceeded, please try again later",
+	)
 )
 
 const (
@@ -97,6 +110,9 @@ const (
 	XRateLimitResetRequests   = "X-RateLimit-Reset-Requests"
 	//nolint:gosec
 	XRateLimitResetTokens = "X-RateLimit-Reset-Tokens"
+
+	XRateLimitLimitConcurrency     = "X-RateLimit-Limit-Concurrency"
+	XRateLimitRemainingConcurrency = "X-RateLimit-Remaining-Concurrency"
 )
 
 func setRpmHeaders(c *gin.Context, rpm, remainingRequests int64) {
@@ -111,6 +127,73 @@ func setTpmHeaders(c *gin.Context, tpm, remainingRequests int64) {
 	c.Header(XRateLimitResetTokens, "1m0s")
 }
 
+// keepLowerRemaining reports whether the remaining header already set by another
+// limit is not higher, so the client sees the limit closest to be exceeded
+func keepLowerRemaining(c *gin.Context, header string, remaining int64) bool {
+	current, err := strconv.ParseInt(c.Writer.Header().Get(header), 10, 64)
+	return err == nil && current <= remaining
+}
+
+func setConcurrencyHeaders(c *gin.Context, limit, remaining int64) {
+	c.Header(XRateLimitLimitConcurrency, strconv.FormatInt(limit, 10))
+	c.Header(XRateLimitRemainingConcurrency, strconv.FormatInt(remaining, 10))
+}
+
+// checkTokenLimits enforces the rpm, tpm and concurrency limits of the token
+// across all models, the returned release frees the in-flight slot once the
+// request finishes
+func checkTokenLimits(c *gin.Context, token model.TokenCache) (func(), error) {
+	log := common.GetLogger(c)
+
+	if token.RPM > 0 {
+		count, _, _ := reqlimit.PushTokenRequest(c.Request.Context(), token.ID, token.RPM)
+
+		log.Data["token_rpm_limit"] = strconv.FormatInt(token.RPM, 10)
+		if count > token.RPM {
+			setRpmHeaders(c, token.RPM, 0)
+			return nil, ErrTokenRequestRateLimitExceeded
+		}
+
+		if !keepLowerRemaining(c, XRateLimitRemainingRequests, token.RPM-count) {
+			setRpmHeaders(c, token.RPM, token.RPM-count)
+		}
+	}
+
+	if token.TPM > 0 {
+		tpm, _ := reqlimit.GetTokenTokensRequest(c.Request.Context(), token.ID)
+
+		log.Data["token_tpm_limit"] = strconv.FormatInt(token.TPM, 10)
+		if tpm >= token.TPM {
+			setTpmHeaders(c, token.TPM, 0)
+			return nil, ErrTokenTpmLimitExceeded
+		}
+
+		if !keepLowerRemaining(c, XRateLimitRemainingTokens, token.TPM-tpm) {
+			setTpmHeaders(c, token.TPM, token.TPM-tpm)
+		}
+	}
+
+	if token.MaxConcurrency <= 0 {
+		return func() {}, nil
+	}
+
+	inflight, ok, release := reqlimit.AcquireTokenConcurrency(
+		c.Request.Context(),
+		token.ID,
+		token.MaxConcurrency,
+	)
+
+	log.Data["token_concurrency_limit"] = strconv.FormatInt(token.MaxConcurrency, 10)
+	if !ok {
+		setConcurrencyHeaders(c, token.MaxConcurrency, 0)
+		return nil, ErrTokenConcurrencyLimitExceeded
+	}
+
+	setConcurrencyHeaders(c, token.MaxConcurrency, token.MaxConcurrency-inflight)
+
+	return release, nil
+}
+
 func checkGroupModelRPMAndTPM(
 	c *gin.Context,
 	group model.GroupCache,
@@ -152,7 +235,9 @@ func checkGroupModelRPMAndTPM(
 			return ErrRequestRateLimitExceeded
 		}
 
-		setRpmHeaders(c, mc.RPM, mc.RPM-groupModelCount)
+		if !keepLowerRemaining(c, XRateLimitRemainingRequests, mc.RPM-groupModelCount) {
+			setRpmHeaders(c, mc.RPM, mc.RPM-groupModelCount)
+		}
 	}
 
 	groupModelCountTPM, groupModelCountTPS := reqlimit.GetGroupModelTokensRequest(
@@ -182,7 +267,9 @@ func checkGroupModelRPMAndTPM(
 			return ErrRequestTpmLimitExceeded
 		}
 
-		setTpmHeaders(c, mc.TPM, mc.TPM-groupModelCountTPM)
+		if !keepLowerRemaining(c, XRateLimitRemainingTokens, mc.TPM-groupModelCountTPM) {
+			setTpmHeaders(c, mc.TPM, mc.TPM-groupModelCountTPM)
+		}
 	}
 
 	return nil
@@ -345,7 +432,7 @@ func CheckRelayMode(requestMode, modelMode mode.Mode) bool {
 		return containsMode(mode.DoubaoVideo, mode.DoubaoVideoTasks, mode.DoubaoVideoTasksDelete)
 	case mode.AudioSpeech:
 		return containsMode(mode.AudioSpeech, mode.GeminiTTS)
-	case mode.ChatCompletions, mode.Anthropic, mode.Gemini:
+	case mode.ChatCompletions, mode.Anthropic, mode.Gemini, mode.AnthropicCountTokens:
 		return containsMode(
 			mode.ChatCompletions,
 			mode.Completions,
@@ -377,6 +464,16 @@ func CheckRelayMode(requestMode, modelMode mode.Mode) bool {
 		return containsMode(mode.ChatCompletions, mode.Responses, mode.ResponsesCompact)
 	case mode.AlphaSearch:
 		return containsMode(mode.ChatCompletions, mode.Responses, mode.AlphaSearch)
+	case mode.Files, mode.FilesGet, mode.FilesDelete, mode.FilesContent,
+		mode.Batches, mode.BatchesGet, mode.BatchesCancel:
+		return containsMode(
+			mode.ChatCompletions,
+			mode.Completions,
+			mode.Embeddings,
+			mode.Responses,
+		)
+	case mode.Realtime:
+		return containsMode(mode.ChatCompletions, mode.Realtime)
 	case mode.ResponsesGet, mode.ResponsesDelete, mode.ResponsesCancel, mode.ResponsesInputItems:
 		return containsMode(
 			mode.ChatCompletions,
@@ -579,20 +676,17 @@ func distribute(c *gin.Context, mode mode.Mode) {
 
 	c.Set(RequestMetadata, metadata)
 
-	if err := checkGroupModelRPMAndTPM(c, group, mc, token.Name); err != nil {
-		errMsg := err.Error()
-
-		consume.Summary(
-			http.StatusTooManyRequests,
-			time.Time{},
-			NewMetaByContext(c, nil, mode),
-			model.Usage{},
-			model.UsageContext{ServiceTier: requestServiceTier},
-			model.Price{},
-			true,
-		)
-		AbortLogWithMessage(c, http.StatusTooManyRequests, errMsg)
+	// the token limits are checked first, a request denied by its token doesn't
+	// count towards the group limits
+	release, err := checkTokenLimits(c, token)
+	if err != nil {
+		abortRateLimited(c, mode, requestServiceTier, err)
+		return
+	}
+	defer release()
 
+	if err := checkGroupModelRPMAndTPM(c, group, mc, token.Name); err != nil {
+		abortRateLimited(c, mode, requestServiceTier, err)
 		return
 	}
 
@@ -600,6 +694,19 @@ func distribute(c *gin.Context, mode mode.Mode) {
 	c.Next()
 }
 
+func abortRateLimited(c *gin.Context, mode mode.Mode, requestServiceTier string, err error) {
+	consume.Summary(
+		http.StatusTooManyRequests,
+		time.Time{},
+		NewMetaByContext(c, nil, mode),
+		model.Usage{},
+		model.UsageContext{ServiceTier: requestServiceTier},
+		model.Price{},
+		true,
+	)
+	AbortLogWithMessage(c, http.StatusTooManyRequests, err.Error())
+}
+
 func GetRequestModel(c *gin.Context) string {
 	return c.GetString(RequestModel)
 }
@@ -640,6 +747,10 @@ func GetFileID(c *gin.Context) string {
 	return c.GetString(FileID)
 }
 
+func GetBatchID(c *gin.Context) string {
+	return c.GetString(BatchID)
+}
+
 func GetRequestMetadata(c *gin.Context) map[string]string {
 	return c.GetStringMapString(RequestMetadata)
 }
@@ -670,6 +781,7 @@ func NewMetaByContext(c *gin.Context,
 	responseID := GetResponseID(c)
 	videoID := GetVideoID(c)
 	fileID := GetFileID(c)
+	batchID := GetBatchID(c)
 	promptCacheKey := GetPromptCacheKey(c)
 	user := GetRequestUser(c)
 	requestServiceTier := GetRequestServiceTier(c)
@@ -687,6 +799,7 @@ func NewMetaByContext(c *gin.Context,
 		meta.WithResponseID(responseID),
 		meta.WithVideoID(videoID),
 		meta.WithFileID(fileID),
+		meta.WithBatchID(batchID),
 		meta.WithPromptCacheKey(promptCacheKey),
 		meta.WithUser(user),
 		meta.WithRequestServiceTier(requestServiceTier),
@@ -784,6 +897,21 @@ func getRequestModel(c *gin.Context, m mode.Mode, group string, tokenID int) (st
 		return getLimitedMultipartFormValue(c.Request, "model")
 	case isVideosCreateMode(m):
 		return getVideosCreateRequestModel(c, group, tokenID)
+	case m == mode.Files:
+		return getFilesCreateRequestModel(c)
+	case isFilesStoredMode(m):
+		return getStoredFileRequestModel(c, group, tokenID)
+	case m == mode.Batches:
+		return getBatchesCreateRequestModel(c, group, tokenID)
+	case m == mode.BatchesGet, m == mode.BatchesCancel:
+		return getStoredBatchRequestModel(c, group, tokenID)
+	case m == mode.Realtime:
+		// /realtime?model=xxx, azure clients use the deployment name instead
+		if model := c.Query("model"); model != "" {
+			return model, nil
+		}
+
+		return c.Query("deployment"), nil
 
 	case strings.HasPrefix(path, "/v1/engines") && strings.HasSuffix(path, "/embeddings"):
 		// /engines/:model/embeddings
@@ -1126,6 +1254,158 @@ func getLimitedMultipartFormValue(req *http.Request, key string) (string, error)
 	return values[0], nil
 }
 
+func isFilesStoredMode(m mode.Mode) bool {
+	return m == mode.FilesGet || m == mode.FilesDelete || m == mode.FilesContent
+}
+
+// getFilesCreateRequestModel returns the model used to select the upload channel,
+// the `model` form field is preferred, a batch input file falls back to the model
+// of its first request line, and the other uploads fall back to the
+// DefaultFilesModel option or the first model of the token served by a channel
+// supporting the files api
+func getFilesCreateRequestModel(c *gin.Context) (string, error) {
+	modelName, err := getLimitedMultipartFormValue(c.Request, "model")
+	if err != nil || modelName != "" {
+		return modelName, err
+	}
+
+	modelName, err = getBatchInputFileModel(c)
+	if err != nil || modelName != "" {
+		return modelName, err
+	}
+
+	if modelName := config.GetDefaultFilesModel(); modelName != "" {
+		return modelName, nil
+	}
+
+	return defaultFilesModel(c), nil
+}
+
+func defaultFilesModel(c *gin.Context) string {
+	group := GetGroup(c)
+	token := GetToken(c)
+	mc := GetModelCaches(c)
+	sets := group.GetAvailableSets()
+
+	var found string
+
+	token.Range(func(modelName string) bool {
+		modelConfig, _ := mc.ModelConfig.GetModelConfig(modelName)
+
+		for _, set := range sets {
+			for _, channel := range mc.EnabledModel2ChannelsBySet[set][modelName] {
+				a, ok := adaptors.GetAdaptor(channel.Type)
+				if ok && a.SupportMode(meta.NewMeta(channel, mode.Files, modelName, modelConfig)) {
+					found = modelName
+					return false
+				}
+			}
+		}
+
+		return true
+	})
+
+	return found
+}
+
+// getBatchInputFileModel returns the model of the first request line of a
+// batch input file
+func getBatchInputFileModel(c *gin.Context) (string, error) {
+	form := c.Request.MultipartForm
+	if form == nil || len(form.Value["purpose"]) == 0 || form.Value["purpose"][0] != "batch" {
+		return "", nil
+	}
+
+	files := form.File["file"]
+	if len(files) == 0 {
+		return "", nil
+	}
+
+	f, err := files[0].Open()
+	if err != nil {
+		return "", fmt.Errorf("open batch input file failed: %w", err)
+	}
+	defer f.Close()
+
+	line, err := bufio.NewReader(f).ReadBytes('\n')
+	if err != nil && !errors.Is(err, io.EOF) {
+		return "", fmt.Errorf("read batch input file failed: %w", err)
+	}
+
+	modelNode, err := sonic.Get(line, "body", "model")
+	if err != nil {
+		return "", nil
+	}
+
+	modelName, err := modelNode.String()
+	if err != nil {
+		return "", fmt.Errorf("get batch input model failed: %w", err)
+	}
+
+	return modelName, nil
+}
+
+func getStoredFileRequestModel(c *gin.Context, group string, tokenID int) (string, error) {
+	fileID := c.Param("id")
+	if fileID == "" {
+		return "", errors.New("get request model failed: file id is empty")
+	}
+
+	store, err := model.CacheGetStore(group, tokenID, model.FileStoreID(fileID))
+	if err != nil {
+		return "", fmt.Errorf("get request model failed: %w", err)
+	}
+
+	c.Set(FileID, fileID)
+	c.Set(ChannelID, store.ChannelID)
+
+	return store.Model, nil
+}
+
+// getBatchesCreateRequestModel pins the batch to the channel that holds its input file
+func getBatchesCreateRequestModel(c *gin.Context, group string, tokenID int) (string, error) {
+	node, err := getRequestBodyNode(c)
+	if err != nil {
+		return "", fmt.Errorf("get request model failed: %w", err)
+	}
+
+	inputFileID, err := node.Get("input_file_id").String()
+	if err != nil {
+		return "", fmt.Errorf("get request model failed: %w", err)
+	}
+
+	if inputFileID == "" {
+		return "", errors.New("get request model failed: input_file_id is empty")
+	}
+
+	store, err := model.CacheGetStore(group, tokenID, model.FileStoreID(inputFileID))
+	if err != nil {
+		return "", fmt.Errorf("get request model failed: %w", err)
+	}
+
+	c.Set(FileID, inputFileID)
+	c.Set(ChannelID, store.ChannelID)
+
+	return store.Model, nil
+}
+
+func getStoredBatchRequestModel(c *gin.Context, group string, tokenID int) (string, error) {
+	batchID := c.Param("id")
+	if batchID == "" {
+		return "", errors.New("get request model failed: batch id is empty")
+	}
+
+	store, err := model.CacheGetStore(group, tokenID, model.BatchStoreID(batchID))
+	if err != nil {
+		return "", fmt.Errorf("get request model failed: %w", err)
+	}
+
+	c.Set(BatchID, batchID)
+	c.Set(ChannelID, store.ChannelID)
+
+	return store.Model, nil
+}
+
 func getStoredVideoRequestModel(c *gin.Context, group string, tokenID int) (string, error) {
 	videoID := c.Param("video_id")
 
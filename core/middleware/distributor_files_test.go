@@ -0,0 +1,141 @@
+//nolint:testpackage
+package middleware
+
+import (
+	"bytes"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/labring/aiproxy/core/common/config"
+	"github.com/labring/aiproxy/core/model"
+	"github.com/labring/aiproxy/core/relay/mode"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newFilesUploadContext(t *testing.T, fields map[string]string, content string) *gin.Context {
+	t.Helper()
+
+	var body bytes.Buffer
+
+	writer := multipart.NewWriter(&body)
+	for k, v := range fields {
+		require.NoError(t, writer.WriteField(k, v))
+	}
+
+	part, err := writer.CreateFormFile("file", "input.jsonl")
+	require.NoError(t, err)
+
+	_, err = part.Write([]byte(content))
+	require.NoError(t, err)
+	require.NoError(t, writer.Close())
+
+	req := httptest.NewRequestWithContext(t.Context(), http.MethodPost, "/v1/files", &body)
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+
+	ctx, _ := gin.CreateTestContext(httptest.NewRecorder())
+	ctx.Request = req
+
+	return ctx
+}
+
+func TestGetRequestModelFilesModelField(t *testing.T) {
+	t.Parallel()
+
+	gin.SetMode(gin.TestMode)
+
+	ctx := newFilesUploadContext(t, map[string]string{
+		"model":   "gpt-4o-mini",
+		"purpose": "assistants",
+	}, "hello")
+
+	modelName, err := getRequestModel(ctx, mode.Files, "group-1", 7)
+	require.NoError(t, err)
+	assert.Equal(t, "gpt-4o-mini", modelName)
+}
+
+func TestGetRequestModelFilesBatchInput(t *testing.T) {
+	t.Parallel()
+
+	gin.SetMode(gin.TestMode)
+
+	ctx := newFilesUploadContext(t, map[string]string{
+		"purpose": "batch",
+	}, `{"custom_id":"1","method":"POST","url":"/v1/chat/completions","body":{"model":"gpt-4o"}}
+{"custom_id":"2","method":"POST","url":"/v1/chat/completions","body":{"model":"gpt-4o"}}
+`)
+
+	modelName, err := getRequestModel(ctx, mode.Files, "group-1", 7)
+	require.NoError(t, err)
+	assert.Equal(t, "gpt-4o", modelName)
+}
+
+func TestCheckRelayModeFiles(t *testing.T) {
+	t.Parallel()
+
+	assert.True(t, CheckRelayMode(mode.Files, mode.ChatCompletions))
+	assert.True(t, CheckRelayMode(mode.FilesContent, mode.Responses))
+	assert.False(t, CheckRelayMode(mode.Files, mode.ImagesGenerations))
+	assert.True(t, CheckRelayMode(mode.Batches, mode.Embeddings))
+	assert.True(t, CheckRelayMode(mode.BatchesCancel, mode.ChatCompletions))
+	assert.False(t, CheckRelayMode(mode.BatchesGet, mode.AudioSpeech))
+}
+
+type filesTestModelConfigCache map[string]model.ModelConfig
+
+func (c filesTestModelConfigCache) GetModelConfig(modelName string) (model.ModelConfig, bool) {
+	mc, ok := c[modelName]
+	return mc, ok
+}
+
+func TestGetRequestModelFilesDefaultModel(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	modelsBySet := map[string][]string{
+		model.ChannelDefaultSet: {"claude-sonnet", "gpt-4o"},
+	}
+
+	token := model.TokenCache{ID: 7}
+	token.SetAvailableSets([]string{model.ChannelDefaultSet})
+	token.SetModelsBySet(modelsBySet)
+
+	newContext := func() *gin.Context {
+		ctx := newFilesUploadContext(t, map[string]string{"purpose": "fine-tune"}, "hello")
+		ctx.Set(Group, model.GroupCache{ID: "group-1"})
+		ctx.Set(Token, token)
+		ctx.Set(ModelCaches, &model.ModelCaches{
+			ModelConfig: filesTestModelConfigCache{
+				"claude-sonnet": {Model: "claude-sonnet", Type: mode.ChatCompletions},
+				"gpt-4o":        {Model: "gpt-4o", Type: mode.ChatCompletions},
+			},
+			EnabledModelsBySet: modelsBySet,
+			EnabledModel2ChannelsBySet: map[string]map[string][]*model.Channel{
+				model.ChannelDefaultSet: {
+					"claude-sonnet": {{ID: 1, Type: model.ChannelTypeAnthropic}},
+					"gpt-4o":        {{ID: 2, Type: model.ChannelTypeOpenAI}},
+				},
+			},
+		})
+
+		return ctx
+	}
+
+	modelName, err := getRequestModel(newContext(), mode.Files, "group-1", 7)
+	require.NoError(t, err)
+	assert.Equal(t, "gpt-4o", modelName)
+
+	oldDefaultFilesModel := config.GetDefaultFilesModel()
+
+	t.Cleanup(func() {
+		config.SetDefaultFilesModel(oldDefaultFilesModel)
+	})
+
+	config.SetDefaultFilesModel("gpt-4o-mini")
+
+	modelName, err = getRequestModel(newContext(), mode.Files, "group-1", 7)
+	require.NoError(t, err)
+	assert.Equal(t, "gpt-4o-mini", modelName)
+}
@@ -0,0 +1,126 @@
+//nolint:testpackage
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/labring/aiproxy/core/common/reqlimit"
+	"github.com/labring/aiproxy/core/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTokenLimitContext() (*gin.Context, *httptest.ResponseRecorder) {
+	recorder := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(recorder)
+	c.Request = httptest.NewRequestWithContext(
+		context.Background(),
+		http.MethodPost,
+		"/v1/chat/completions",
+		nil,
+	)
+
+	return c, recorder
+}
+
+func TestCheckTokenLimitsRPM(t *testing.T) {
+	token := model.TokenCache{ID: 1201, RPM: 2}
+
+	for i := range 2 {
+		c, recorder := newTokenLimitContext()
+
+		release, err := checkTokenLimits(c, token)
+		require.NoError(t, err)
+		release()
+
+		assert.Equal(t, "2", recorder.Header().Get(XRateLimitLimitRequests))
+		assert.Equal(
+			t,
+			[]string{"1", "0"}[i],
+			recorder.Header().Get(XRateLimitRemainingRequests),
+		)
+	}
+
+	c, recorder := newTokenLimitContext()
+
+	_, err := checkTokenLimits(c, token)
+	require.ErrorIs(t, err, ErrTokenRequestRateLimitExceeded)
+	assert.Equal(t, "0", recorder.Header().Get(XRateLimitRemainingRequests))
+}
+
+func TestCheckTokenLimitsKeepsLowerRemaining(t *testing.T) {
+	c, recorder := newTokenLimitContext()
+	setRpmHeaders(c, 10, 1)
+
+	release, err := checkTokenLimits(c, model.TokenCache{ID: 1202, RPM: 100})
+	require.NoError(t, err)
+	release()
+
+	assert.Equal(t, "10", recorder.Header().Get(XRateLimitLimitRequests))
+	assert.Equal(t, "1", recorder.Header().Get(XRateLimitRemainingRequests))
+}
+
+func TestCheckTokenLimitsTPM(t *testing.T) {
+	token := model.TokenCache{ID: 1203, TPM: 100}
+
+	c, recorder := newTokenLimitContext()
+
+	release, err := checkTokenLimits(c, token)
+	require.NoError(t, err)
+	release()
+	assert.Equal(t, "100", recorder.Header().Get(XRateLimitRemainingTokens))
+
+	reqlimit.PushTokenTokensRequest(context.Background(), token.ID, token.TPM, 100)
+
+	c, recorder = newTokenLimitContext()
+
+	_, err = checkTokenLimits(c, token)
+	require.ErrorIs(t, err, ErrTokenTpmLimitExceeded)
+	assert.Equal(t, "0", recorder.Header().Get(XRateLimitRemainingTokens))
+}
+
+func TestCheckTokenLimitsConcurrency(t *testing.T) {
+	token := model.TokenCache{ID: 1204, MaxConcurrency: 1}
+
+	c, recorder := newTokenLimitContext()
+
+	release, err := checkTokenLimits(c, token)
+	require.NoError(t, err)
+	assert.Equal(t, "0", recorder.Header().Get(XRateLimitRemainingConcurrency))
+
+	c, _ = newTokenLimitContext()
+
+	_, err = checkTokenLimits(c, token)
+	require.ErrorIs(t, err, ErrTokenConcurrencyLimitExceeded)
+
+	release()
+
+	c, _ = newTokenLimitContext()
+
+	release, err = checkTokenLimits(c, token)
+	require.NoError(t, err)
+	release()
+}
+
+func TestCheckGroupModelRPMKeepsLowerTokenRemaining(t *testing.T) {
+	c, recorder := newTokenLimitContext()
+
+	release, err := checkTokenLimits(c, model.TokenCache{ID: 1205, RPM: 2})
+	require.NoError(t, err)
+	release()
+
+	err = checkGroupModelRPMAndTPM(
+		c,
+		model.GroupCache{ID: "token-limit-group"},
+		model.ModelConfig{Model: "token-limit-model", RPM: 100},
+		"token",
+	)
+	require.NoError(t, err)
+
+	assert.Equal(t, "2", recorder.Header().Get(XRateLimitLimitRequests))
+	assert.Equal(t, "1", recorder.Header().Get(XRateLimitRemainingRequests))
+}
@@ -91,6 +91,17 @@ func GetPendingAsyncUsagesDue(
 	return infos, err
 }
 
+func CountPendingAsyncUsages() (int64, error) {
+	var count int64
+
+	err := LogDB.
+		Model(&AsyncUsageInfo{}).
+		Where("status = ?", int(AsyncUsageStatusPending)).
+		Count(&count).Error
+
+	return count, err
+}
+
 func TryClaimAsyncUsageInfo(
 	info *AsyncUsageInfo,
 	token string,
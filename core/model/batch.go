@@ -9,8 +9,10 @@ import (
 
 	"github.com/labring/aiproxy/core/common"
 	"github.com/labring/aiproxy/core/common/config"
+	"github.com/labring/aiproxy/core/common/metrics"
 	"github.com/labring/aiproxy/core/common/notify"
 	"github.com/labring/aiproxy/core/common/oncall"
+	"github.com/prometheus/client_golang/prometheus"
 	"github.com/shopspring/decimal"
 	"golang.org/x/sync/errgroup"
 )
@@ -81,7 +83,46 @@ type GroupSummaryMinuteUpdate struct {
 
 var batchData batchUpdateData
 
+var batchBacklogDesc = prometheus.NewDesc(
+	"aiproxy_batch_update_backlog",
+	"Pending updates of the batch updater waiting to be written to the database.",
+	[]string{"kind"},
+	nil,
+)
+
+// batchBacklogCollector reports the pending batch updates on scrape
+type batchBacklogCollector struct{}
+
+func (batchBacklogCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- batchBacklogDesc
+}
+
+func (batchBacklogCollector) Collect(ch chan<- prometheus.Metric) {
+	batchData.Lock()
+	backlog := map[string]int{
+		"group":                len(batchData.Groups),
+		"token":                len(batchData.Tokens),
+		"channel":              len(batchData.Channels),
+		"summary":              len(batchData.Summaries),
+		"group_summary":        len(batchData.GroupSummaries),
+		"summary_minute":       len(batchData.SummariesMinute),
+		"group_summary_minute": len(batchData.GroupSummariesMinute),
+	}
+	batchData.Unlock()
+
+	for kind, n := range backlog {
+		ch <- prometheus.MustNewConstMetric(
+			batchBacklogDesc,
+			prometheus.GaugeValue,
+			float64(n),
+			kind,
+		)
+	}
+}
+
 func init() {
+	metrics.MustRegister(batchBacklogCollector{})
+
 	batchData = batchUpdateData{
 		Groups:               make(map[string]*GroupUpdate),
 		Tokens:               make(map[int]*TokenUpdate),
@@ -438,6 +479,7 @@ func BatchRecordLogs(
 		code,
 		channelID,
 		modelName,
+		mode,
 		tokenID,
 		tokenName,
 		downstreamResult,
@@ -458,6 +500,7 @@ func BatchUpdateSummary(
 	code int,
 	channelID int,
 	modelName string,
+	mode int,
 	tokenID int,
 	tokenName string,
 	downstreamResult bool,
@@ -521,6 +564,7 @@ func BatchUpdateSummary(
 			group,
 			tokenName,
 			modelName,
+			mode,
 			now,
 			requestAt,
 			firstByteAt,
@@ -553,6 +597,7 @@ func BatchUpdateSummaryOnlyUsage(
 	group string,
 	channelID int,
 	modelName string,
+	mode int,
 	tokenID int,
 	tokenName string,
 	usage Usage,
@@ -600,6 +645,7 @@ func BatchUpdateSummaryOnlyUsage(
 		group,
 		tokenName,
 		modelName,
+		mode,
 		summaryAt,
 		usage,
 		amount,
@@ -718,6 +764,7 @@ func updateTokenAmountData(tokenID int, amount float64, amountDecimal decimal.De
 
 func updateGroupSummaryData(
 	group, tokenName, modelName string,
+	mode int,
 	createAt time.Time,
 	requestAt time.Time,
 	firstByteAt time.Time,
@@ -749,6 +796,7 @@ func updateGroupSummaryData(
 		GroupID:       group,
 		TokenName:     tokenName,
 		Model:         modelName,
+		Mode:          mode,
 		HourTimestamp: createAt.Truncate(time.Hour).Unix(),
 	}
 
@@ -862,6 +910,7 @@ func updateSummaryUsageDataMinute(
 
 func updateGroupSummaryUsageData(
 	group, tokenName, modelName string,
+	mode int,
 	createAt time.Time,
 	usage Usage,
 	amount Amount,
@@ -880,6 +929,7 @@ func updateGroupSummaryUsageData(
 		GroupID:       group,
 		TokenName:     tokenName,
 		Model:         modelName,
+		Mode:          mode,
 		HourTimestamp: createAt.Truncate(time.Hour).Unix(),
 	}
 
@@ -86,6 +86,8 @@ func withTestModelCacheDB(t *testing.T, fn func()) {
 			&PublicMCP{},
 			&PublicMCPReusingParam{},
 			&GroupMCP{},
+			&Prompt{},
+			&VirtualMCP{},
 		),
 	)
 
@@ -4,4 +4,6 @@ package model
 var (
 	ToLimitOffset              = toLimitOffset
 	AggregateDataToSpanForTest = aggregateDataToSpan
+
+	DropLegacyGroupSummaryUniqueIndex = dropLegacyGroupSummaryUniqueIndex
 )
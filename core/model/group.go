@@ -2,6 +2,7 @@ package model
 
 import (
 	"errors"
+	"fmt"
 	"strings"
 	"time"
 
@@ -28,6 +29,8 @@ type Group struct {
 	GroupModelConfigs      []GroupModelConfig      `json:"-"                        gorm:"foreignKey:GroupID"`
 	PublicMCPReusingParams []PublicMCPReusingParam `json:"-"                        gorm:"foreignKey:GroupID"`
 	GroupMCPs              []GroupMCP              `json:"-"                        gorm:"foreignKey:GroupID"`
+	Prompts                []Prompt                `json:"-"                        gorm:"foreignKey:GroupID"`
+	VirtualMCPs            []VirtualMCP            `json:"-"                        gorm:"foreignKey:GroupID"`
 	Status                 int                     `json:"status"                   gorm:"default:1;index"`
 	RPMRatio               float64                 `json:"rpm_ratio,omitempty"      gorm:"index"`
 	TPMRatio               float64                 `json:"tpm_ratio,omitempty"      gorm:"index"`
@@ -37,12 +40,20 @@ type Group struct {
 
 	BalanceAlertEnabled   bool    `gorm:"default:false" json:"balance_alert_enabled"`
 	BalanceAlertThreshold float64 `gorm:"default:0"     json:"balance_alert_threshold"`
+
+	// MCPACL restricts the mcps and the tools the tokens of the group can use
+	MCPACL MCPACL `gorm:"column:mcp_acl;serializer:fastjson;type:text" json:"mcp_acl"`
 }
 
 func (g *Group) BeforeSave(_ *gorm.DB) error {
 	if len(g.ID) > 64 {
 		return errors.New("group id length too long")
 	}
+
+	if err := g.MCPACL.Validate(); err != nil {
+		return fmt.Errorf("group %w", err)
+	}
+
 	return nil
 }
 
@@ -65,6 +76,16 @@ func (g *Group) BeforeDelete(tx *gorm.DB) (err error) {
 		return err
 	}
 
+	err = tx.Model(&Prompt{}).Where("group_id = ?", g.ID).Delete(&Prompt{}).Error
+	if err != nil {
+		return err
+	}
+
+	err = tx.Model(&VirtualMCP{}).Where("group_id = ?", g.ID).Delete(&VirtualMCP{}).Error
+	if err != nil {
+		return err
+	}
+
 	return tx.Model(&GroupModelConfig{}).
 		Where("group_id = ?", g.ID).
 		Delete(&GroupModelConfig{}).
@@ -146,6 +167,10 @@ func DeleteGroupByID(id string) (err error) {
 			if _, err := DeleteGroupLogs(id); err != nil {
 				log.Error("delete group logs failed: " + err.Error())
 			}
+
+			if _, err := DeleteGroupMCPLogs(id); err != nil {
+				log.Error("delete group mcp logs failed: " + err.Error())
+			}
 		}
 	}()
 
@@ -170,6 +195,10 @@ func DeleteGroupsByIDs(ids []string) (err error) {
 				if _, err := DeleteGroupLogs(group.ID); err != nil {
 					log.Error("delete group logs failed: " + err.Error())
 				}
+
+				if _, err := DeleteGroupMCPLogs(group.ID); err != nil {
+					log.Error("delete group mcp logs failed: " + err.Error())
+				}
 			}
 		}
 	}()
@@ -194,6 +223,7 @@ type UpdateGroupRequest struct {
 	AvailableSets         *[]string `json:"available_sets,omitempty"`
 	BalanceAlertEnabled   *bool     `json:"balance_alert_enabled"`
 	BalanceAlertThreshold *float64  `json:"balance_alert_threshold"`
+	MCPACL                *MCPACL   `json:"mcp_acl"`
 }
 
 func UpdateGroup(id string, update UpdateGroupRequest) (group *Group, err error) {
@@ -245,6 +275,12 @@ func UpdateGroup(id string, update UpdateGroupRequest) (group *Group, err error)
 		selects = append(selects, "balance_alert_threshold")
 	}
 
+	if update.MCPACL != nil {
+		group.MCPACL = *update.MCPACL
+
+		selects = append(selects, "mcp_acl")
+	}
+
 	if group.Status != 0 {
 		selects = append(selects, "status")
 	}
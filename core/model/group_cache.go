@@ -35,6 +35,8 @@ type GroupCache struct {
 
 	BalanceAlertEnabled   bool    `json:"balance_alert_enabled"   redis:"bae"`
 	BalanceAlertThreshold float64 `json:"balance_alert_threshold" redis:"bat"`
+
+	MCPACL MCPACL `json:"mcp_acl" redis:"acl"`
 }
 
 func (g *GroupCache) GetAvailableSets() []string {
@@ -61,6 +63,8 @@ func (g *Group) ToGroupCache() *GroupCache {
 
 		BalanceAlertEnabled:   g.BalanceAlertEnabled,
 		BalanceAlertThreshold: g.BalanceAlertThreshold,
+
+		MCPACL: g.MCPACL,
 	}
 }
 
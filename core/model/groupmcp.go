@@ -48,6 +48,7 @@ type GroupMCP struct {
 	Description   string               `                                     json:"description"`
 	ProxyConfig   *GroupMCPProxyConfig `gorm:"serializer:fastjson;type:text" json:"proxy_config,omitempty"`
 	OpenAPIConfig *MCPOpenAPIConfig    `gorm:"serializer:fastjson;type:text" json:"openapi_config,omitempty"`
+	Price         MCPPrice             `gorm:"embedded"                      json:"price"`
 }
 
 func (g *GroupMCP) BeforeSave(_ *gorm.DB) (err error) {
@@ -113,6 +114,8 @@ func UpdateGroupMCP(mcp *GroupMCP) (err error) {
 		"proxy_config",
 		"openapi_config",
 		"description",
+		"default_tools_call_price",
+		"tools_call_prices",
 	}
 	if mcp.Type != "" {
 		selects = append(selects, "type")
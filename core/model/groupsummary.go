@@ -16,11 +16,30 @@ type GroupSummary struct {
 	Data   SummaryData        `gorm:"embedded"`
 }
 
+// GroupSummaryUnique is the key of a group summary, the mode is the relay mode
+// the requests used so the statements do not depend on the current model config
 type GroupSummaryUnique struct {
-	GroupID       string `gorm:"size:64;not null;uniqueIndex:idx_groupsummary_unique,priority:1"`
-	TokenName     string `gorm:"size:32;not null;uniqueIndex:idx_groupsummary_unique,priority:2"`
-	Model         string `gorm:"size:128;not null;uniqueIndex:idx_groupsummary_unique,priority:3"`
-	HourTimestamp int64  `gorm:"not null;uniqueIndex:idx_groupsummary_unique,priority:4,sort:desc"`
+	GroupID       string `gorm:"size:64;not null;uniqueIndex:idx_groupsummary_mode_unique,priority:1"`
+	TokenName     string `gorm:"size:32;not null;uniqueIndex:idx_groupsummary_mode_unique,priority:2"`
+	Model         string `gorm:"size:128;not null;uniqueIndex:idx_groupsummary_mode_unique,priority:3"`
+	Mode          int    `gorm:"not null;default:0;uniqueIndex:idx_groupsummary_mode_unique,priority:4"`
+	HourTimestamp int64  `gorm:"not null;uniqueIndex:idx_groupsummary_mode_unique,priority:5,sort:desc"`
+}
+
+// dropLegacyGroupSummaryUniqueIndex drops the unique index without the mode,
+// it would reject the summaries of the same model in different modes that the
+// statements total separately. It runs after AutoMigrate has created the index
+// with the mode, so the key stays unique, and only drops an index, the rows are
+// kept and the ones summarized before have the unknown mode
+func dropLegacyGroupSummaryUniqueIndex(db *gorm.DB) error {
+	const legacyIndex = "idx_groupsummary_unique"
+
+	migrator := db.Migrator()
+	if !migrator.HasIndex(&GroupSummary{}, legacyIndex) {
+		return nil
+	}
+
+	return migrator.DropIndex(&GroupSummary{}, legacyIndex)
 }
 
 func (l *GroupSummary) BeforeCreate(_ *gorm.DB) (err error) {
@@ -65,10 +84,11 @@ func UpsertGroupSummary(unique GroupSummaryUnique, data SummaryData) error {
 		result := LogDB.
 			Model(&GroupSummary{}).
 			Where(
-				"group_id = ? AND token_name = ? AND model = ? AND hour_timestamp = ?",
+				"group_id = ? AND token_name = ? AND model = ? AND mode = ? AND hour_timestamp = ?",
 				unique.GroupID,
 				unique.TokenName,
 				unique.Model,
+				unique.Mode,
 				unique.HourTimestamp,
 			).
 			Updates(data.buildUpdateData("group_summaries"))
@@ -102,6 +122,7 @@ func createGroupSummary(unique GroupSummaryUnique, data SummaryData) error {
 				{Name: "group_id"},
 				{Name: "token_name"},
 				{Name: "model"},
+				{Name: "mode"},
 				{Name: "hour_timestamp"},
 			},
 			DoUpdates: clause.Assignments(data.buildUpdateData("group_summaries")),
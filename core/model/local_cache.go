@@ -207,6 +207,8 @@ func cloneGroupCache(group *GroupCache) *GroupCache {
 		}
 	}
 
+	cloned.MCPACL = group.MCPACL.clone()
+
 	return &cloned
 }
 
@@ -220,6 +222,7 @@ func cloneTokenCache(token *TokenCache) *TokenCache {
 	cloned.Models = redisStringSlice(cloneStringSlice([]string(token.Models)))
 	cloned.availableSets = cloneStringSlice(token.availableSets)
 	cloned.modelsBySet = cloneStringSliceMap(token.modelsBySet)
+	cloned.MCPACL = token.MCPACL.clone()
 
 	return &cloned
 }
@@ -254,6 +257,7 @@ func cloneGroupMCPCache(groupMCP *GroupMCPCache) *GroupMCPCache {
 	cloned := *groupMCP
 	cloned.ProxyConfig = cloneGroupMCPProxyConfig(groupMCP.ProxyConfig)
 	cloned.OpenAPIConfig = cloneOpenAPIConfig(groupMCP.OpenAPIConfig)
+	cloned.Price = cloneMCPPrice(groupMCP.Price)
 
 	return &cloned
 }
@@ -296,6 +300,22 @@ func cloneEmbeddingConfig(config *MCPEmbeddingConfig) *MCPEmbeddingConfig {
 	return &cloned
 }
 
+func cloneStdioConfig(config *MCPStdioConfig) *MCPStdioConfig {
+	if config == nil {
+		return nil
+	}
+
+	cloned := *config
+	cloned.Args = slices.Clone(config.Args)
+
+	cloned.Env = cloneStringStringMap(config.Env)
+	if config.Reusing != nil {
+		cloned.Reusing = maps.Clone(config.Reusing)
+	}
+
+	return &cloned
+}
+
 func clonePublicMCPCache(publicMCP *PublicMCPCache) *PublicMCPCache {
 	if publicMCP == nil {
 		return nil
@@ -306,6 +326,7 @@ func clonePublicMCPCache(publicMCP *PublicMCPCache) *PublicMCPCache {
 	cloned.ProxyConfig = clonePublicMCPProxyConfig(publicMCP.ProxyConfig)
 	cloned.OpenAPIConfig = cloneOpenAPIConfig(publicMCP.OpenAPIConfig)
 	cloned.EmbedConfig = cloneEmbeddingConfig(publicMCP.EmbedConfig)
+	cloned.StdioConfig = cloneStdioConfig(publicMCP.StdioConfig)
 
 	return &cloned
 }
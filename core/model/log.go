@@ -228,6 +228,11 @@ func CleanLog(batchSize int, optimize bool) (err error) {
 		return err
 	}
 
+	err = cleanMCPLog(batchSize)
+	if err != nil {
+		return err
+	}
+
 	err = cleanAsyncUsageInfo(batchSize)
 	if err != nil {
 		return err
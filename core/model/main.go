@@ -147,9 +147,14 @@ func migrateDB() error {
 		&GroupModelConfig{},
 		&PublicMCPReusingParam{},
 		&GroupMCP{},
+		&Prompt{},
+		&VirtualMCP{},
 		&Group{},
 		&Option{},
 		&ModelConfig{},
+		&GroupWallet{},
+		&GroupWalletTopUp{},
+		&GroupWalletLedger{},
 	)
 	if err != nil {
 		return err
@@ -224,6 +229,7 @@ func migrateLogDB(batchSize int) error {
 		&Log{},
 		&RequestDetail{},
 		&RetryLog{},
+		&MCPLog{},
 		&GroupSummary{},
 		&Summary{},
 		&ConsumeError{},
@@ -236,6 +242,11 @@ func migrateLogDB(batchSize int) error {
 		return err
 	}
 
+	err = dropLegacyGroupSummaryUniqueIndex(LogDB)
+	if err != nil {
+		return err
+	}
+
 	go func() {
 		err := CreateLogIndexes(LogDB)
 		if err != nil {
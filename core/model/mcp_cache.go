@@ -19,6 +19,7 @@ type GroupMCPCache struct {
 	Type          GroupMCPType         `json:"type"           redis:"t"`
 	ProxyConfig   *GroupMCPProxyConfig `json:"proxy_config"   redis:"pc"`
 	OpenAPIConfig *MCPOpenAPIConfig    `json:"openapi_config" redis:"oc"`
+	Price         MCPPrice             `json:"price"          redis:"p"`
 }
 
 func (g *GroupMCP) ToGroupMCPCache() *GroupMCPCache {
@@ -29,6 +30,7 @@ func (g *GroupMCP) ToGroupMCPCache() *GroupMCPCache {
 		Type:          g.Type,
 		ProxyConfig:   g.ProxyConfig,
 		OpenAPIConfig: g.OpenAPIConfig,
+		Price:         g.Price,
 	}
 }
 
@@ -182,6 +184,7 @@ type PublicMCPCache struct {
 	ProxyConfig   *PublicMCPProxyConfig `json:"proxy_config"   redis:"pc"`
 	OpenAPIConfig *MCPOpenAPIConfig     `json:"openapi_config" redis:"oc"`
 	EmbedConfig   *MCPEmbeddingConfig   `json:"embed_config"   redis:"ec"`
+	StdioConfig   *MCPStdioConfig       `json:"stdio_config"   redis:"sc"`
 }
 
 func (p *PublicMCP) ToPublicMCPCache() *PublicMCPCache {
@@ -193,6 +196,7 @@ func (p *PublicMCP) ToPublicMCPCache() *PublicMCPCache {
 		ProxyConfig:   p.ProxyConfig,
 		OpenAPIConfig: p.OpenAPIConfig,
 		EmbedConfig:   p.EmbedConfig,
+		StdioConfig:   p.StdioConfig,
 	}
 }
 
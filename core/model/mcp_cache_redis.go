@@ -28,6 +28,8 @@ var (
 	_ redis.Scanner            = (*MCPOpenAPIConfig)(nil)
 	_ encoding.BinaryMarshaler = (*MCPEmbeddingConfig)(nil)
 	_ redis.Scanner            = (*MCPEmbeddingConfig)(nil)
+	_ encoding.BinaryMarshaler = (*MCPStdioConfig)(nil)
+	_ redis.Scanner            = (*MCPStdioConfig)(nil)
 )
 
 func (s *GroupMCPStatus) ScanRedis(value string) error {
@@ -133,3 +135,15 @@ func (c *MCPEmbeddingConfig) MarshalBinary() ([]byte, error) {
 
 	return sonic.Marshal(c)
 }
+
+func (c *MCPStdioConfig) ScanRedis(value string) error {
+	return sonic.UnmarshalString(value, c)
+}
+
+func (c *MCPStdioConfig) MarshalBinary() ([]byte, error) {
+	if c == nil {
+		return conv.StringToBytes("null"), nil
+	}
+
+	return sonic.Marshal(c)
+}
@@ -0,0 +1,132 @@
+package model
+
+import (
+	"encoding"
+	"fmt"
+	"path"
+	"slices"
+	"strings"
+
+	"github.com/bytedance/sonic"
+	"github.com/labring/aiproxy/core/common/conv"
+	"github.com/redis/go-redis/v9"
+)
+
+var (
+	_ encoding.BinaryMarshaler = (*MCPACL)(nil)
+	_ redis.Scanner            = (*MCPACL)(nil)
+)
+
+// MCPACL restricts the mcps and the tools a group or a token can use. The
+// patterns are globs, a tool pattern is either a tool name pattern or
+// `<mcp id pattern>/<tool name pattern>`. Empty allow lists allow everything
+// and the deny lists win over the allow lists.
+type MCPACL struct {
+	AllowMCPs  []string `json:"allow_mcps,omitempty"`
+	DenyMCPs   []string `json:"deny_mcps,omitempty"`
+	AllowTools []string `json:"allow_tools,omitempty"`
+	DenyTools  []string `json:"deny_tools,omitempty"`
+}
+
+func (a *MCPACL) ScanRedis(value string) error {
+	return sonic.Unmarshal(conv.StringToBytes(value), a)
+}
+
+func (a MCPACL) MarshalBinary() ([]byte, error) {
+	return sonic.Marshal(a)
+}
+
+func (a MCPACL) IsEmpty() bool {
+	return len(a.AllowMCPs) == 0 &&
+		len(a.DenyMCPs) == 0 &&
+		len(a.AllowTools) == 0 &&
+		len(a.DenyTools) == 0
+}
+
+func (a MCPACL) clone() MCPACL {
+	return MCPACL{
+		AllowMCPs:  slices.Clone(a.AllowMCPs),
+		DenyMCPs:   slices.Clone(a.DenyMCPs),
+		AllowTools: slices.Clone(a.AllowTools),
+		DenyTools:  slices.Clone(a.DenyTools),
+	}
+}
+
+func (a MCPACL) Validate() error {
+	for _, patterns := range [][]string{a.AllowMCPs, a.DenyMCPs, a.AllowTools, a.DenyTools} {
+		for _, pattern := range patterns {
+			if pattern == "" {
+				return fmt.Errorf("mcp acl pattern is empty")
+			}
+
+			mcpPattern, toolPattern, _ := strings.Cut(pattern, "/")
+			if _, err := path.Match(mcpPattern, ""); err != nil {
+				return fmt.Errorf("mcp acl pattern %s is invalid: %w", pattern, err)
+			}
+
+			if _, err := path.Match(toolPattern, ""); err != nil {
+				return fmt.Errorf("mcp acl pattern %s is invalid: %w", pattern, err)
+			}
+		}
+	}
+
+	return nil
+}
+
+func matchPattern(pattern, name string) bool {
+	ok, _ := path.Match(pattern, name)
+	return ok
+}
+
+func matchToolPattern(pattern, mcpID, tool string) bool {
+	mcpPattern, toolPattern, scoped := strings.Cut(pattern, "/")
+	if !scoped {
+		return matchPattern(pattern, tool)
+	}
+
+	return matchPattern(mcpPattern, mcpID) && matchPattern(toolPattern, tool)
+}
+
+// AllowMCP reports whether the mcp can be used
+func (a MCPACL) AllowMCP(mcpID string) bool {
+	if slices.ContainsFunc(a.DenyMCPs, func(pattern string) bool {
+		return matchPattern(pattern, mcpID)
+	}) {
+		return false
+	}
+
+	return len(a.AllowMCPs) == 0 || slices.ContainsFunc(a.AllowMCPs, func(pattern string) bool {
+		return matchPattern(pattern, mcpID)
+	})
+}
+
+// AllowTool reports whether the tool of the mcp can be used
+func (a MCPACL) AllowTool(mcpID, tool string) bool {
+	if !a.AllowMCP(mcpID) {
+		return false
+	}
+
+	if slices.ContainsFunc(a.DenyTools, func(pattern string) bool {
+		return matchToolPattern(pattern, mcpID, tool)
+	}) {
+		return false
+	}
+
+	return len(a.AllowTools) == 0 || slices.ContainsFunc(a.AllowTools, func(pattern string) bool {
+		return matchToolPattern(pattern, mcpID, tool)
+	})
+}
+
+// CheckMCPTool returns an error naming the acl that denies the tool of the
+// mcp to the group or the token
+func CheckMCPTool(group *GroupCache, token *TokenCache, mcpID, tool string) error {
+	if group != nil && !group.MCPACL.AllowTool(mcpID, tool) {
+		return fmt.Errorf("tool %s of mcp %s is denied by the group acl", tool, mcpID)
+	}
+
+	if token != nil && !token.MCPACL.AllowTool(mcpID, tool) {
+		return fmt.Errorf("tool %s of mcp %s is denied by the token acl", tool, mcpID)
+	}
+
+	return nil
+}
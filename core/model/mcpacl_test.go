@@ -0,0 +1,47 @@
+package model
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMCPACLAllowTool(t *testing.T) {
+	acl := MCPACL{
+		AllowMCPs:  []string{"github", "jira-*"},
+		DenyMCPs:   []string{"jira-prod"},
+		AllowTools: []string{"search*", "github/create_issue"},
+		DenyTools:  []string{"*/search_secrets"},
+	}
+
+	assert.True(t, acl.AllowTool("github", "search"))
+	assert.True(t, acl.AllowTool("github", "create_issue"))
+	assert.False(t, acl.AllowTool("github", "delete_repo"))
+	assert.False(t, acl.AllowTool("github", "search_secrets"))
+	assert.True(t, acl.AllowTool("jira-dev", "search_issues"))
+	assert.False(t, acl.AllowTool("jira-dev", "create_issue"))
+	assert.False(t, acl.AllowTool("jira-prod", "search"))
+	assert.False(t, acl.AllowTool("gitlab", "search"))
+
+	assert.True(t, MCPACL{}.AllowTool("gitlab", "delete_repo"))
+}
+
+func TestMCPACLValidate(t *testing.T) {
+	require.NoError(t, MCPACL{AllowTools: []string{"github/*", "search?"}}.Validate())
+	require.Error(t, MCPACL{DenyMCPs: []string{""}}.Validate())
+	require.Error(t, MCPACL{AllowTools: []string{"github/[a"}}.Validate())
+}
+
+func TestCheckMCPTool(t *testing.T) {
+	group := &GroupCache{MCPACL: MCPACL{DenyTools: []string{"delete_*"}}}
+	token := &TokenCache{MCPACL: MCPACL{AllowMCPs: []string{"github"}}}
+
+	require.NoError(t, CheckMCPTool(group, token, "github", "search"))
+
+	err := CheckMCPTool(group, token, "github", "delete_repo")
+	require.ErrorContains(t, err, "group acl")
+
+	err = CheckMCPTool(group, token, "gitlab", "search")
+	require.ErrorContains(t, err, "token acl")
+}
@@ -0,0 +1,356 @@
+package model
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/bytedance/sonic"
+	"github.com/labring/aiproxy/core/common"
+	"github.com/labring/aiproxy/core/common/config"
+	"golang.org/x/sync/errgroup"
+	"gorm.io/gorm"
+)
+
+// MCPLog records a json-rpc message sent to a mcp server
+type MCPLog struct {
+	RequestAt            time.Time       `                                                   json:"request_at"`
+	CreatedAt            time.Time       `gorm:"autoCreateTime;index"                        json:"created_at"`
+	GroupID              string          `gorm:"size:64;index"                               json:"group,omitempty"`
+	TokenName            string          `gorm:"size:32"                                     json:"token_name,omitempty"`
+	MCPID                string          `gorm:"size:64;index"                               json:"mcp_id"`
+	MCPType              string          `gorm:"size:32"                                     json:"mcp_type,omitempty"`
+	SessionID            EmptyNullString `gorm:"size:64;index:,where:session_id is not null" json:"session_id,omitempty"`
+	Method               string          `gorm:"size:64"                                     json:"method"`
+	ToolName             EmptyNullString `gorm:"size:128"                                    json:"tool_name,omitempty"`
+	Endpoint             EmptyNullString `gorm:"size:64"                                     json:"endpoint,omitempty"`
+	IP                   EmptyNullString `gorm:"size:45"                                     json:"ip,omitempty"`
+	Error                EmptyNullString `gorm:"type:text"                                   json:"error,omitempty"`
+	Arguments            string          `gorm:"type:text"                                   json:"arguments,omitempty"`
+	Result               string          `gorm:"type:text"                                   json:"result,omitempty"`
+	ArgumentsTruncated   bool            `                                                   json:"arguments_truncated,omitempty"`
+	ResultTruncated      bool            `                                                   json:"result_truncated,omitempty"`
+	DurationMilliseconds int64           `                                                   json:"duration_milliseconds"`
+	ID                   int             `gorm:"primaryKey"                                  json:"id"`
+	TokenID              int             `gorm:"index"                                       json:"token_id,omitempty"`
+	Code                 int             `gorm:"index"                                       json:"code,omitempty"`
+}
+
+func (l *MCPLog) BeforeCreate(_ *gorm.DB) (err error) {
+	if len(l.Error) > contentMaxSize {
+		l.Error = common.TruncateByRune(l.Error, contentMaxSize) + "..."
+	}
+
+	if l.CreatedAt.IsZero() {
+		l.CreatedAt = time.Now()
+	}
+
+	if l.RequestAt.IsZero() {
+		l.RequestAt = l.CreatedAt
+	}
+
+	return err
+}
+
+func (l *MCPLog) MarshalJSON() ([]byte, error) {
+	type Alias MCPLog
+
+	a := &struct {
+		*Alias
+		CreatedAt int64 `json:"created_at"`
+		RequestAt int64 `json:"request_at"`
+	}{
+		Alias:     (*Alias)(l),
+		CreatedAt: l.CreatedAt.UnixMilli(),
+		RequestAt: l.RequestAt.UnixMilli(),
+	}
+
+	return sonic.Marshal(a)
+}
+
+// ApplyBodySizeLimit truncates the arguments and the result to maxSize bytes,
+// zero means no limit and a negative size drops them
+func (l *MCPLog) ApplyBodySizeLimit(maxSize int64) {
+	l.Arguments, l.ArgumentsTruncated = truncateDetailBody(l.Arguments, maxSize)
+	l.Result, l.ResultTruncated = truncateDetailBody(l.Result, maxSize)
+}
+
+func RecordMCPLog(log *MCPLog) error {
+	return LogDB.Create(log).Error
+}
+
+// MCPLogFilter filters the mcp logs, the zero fields are not filtered
+type MCPLogFilter struct {
+	Group          string
+	Keyword        string
+	TokenID        int
+	TokenName      string
+	MCPID          string
+	SessionID      string
+	Method         string
+	ToolName       string
+	IP             string
+	CodeType       CodeType
+	Code           int
+	StartTimestamp time.Time
+	EndTimestamp   time.Time
+}
+
+func buildMCPLogsQuery(filter MCPLogFilter) *gorm.DB {
+	tx := LogDB.Model(&MCPLog{})
+
+	if filter.Group != "" {
+		tx = tx.Where("group_id = ?", filter.Group)
+	}
+
+	if filter.TokenID != 0 {
+		tx = tx.Where("token_id = ?", filter.TokenID)
+	}
+
+	if filter.TokenName != "" {
+		tx = tx.Where("token_name = ?", filter.TokenName)
+	}
+
+	if filter.MCPID != "" {
+		tx = tx.Where("mcp_id = ?", filter.MCPID)
+	}
+
+	if filter.SessionID != "" {
+		tx = tx.Where("session_id = ?", filter.SessionID)
+	}
+
+	if filter.Method != "" {
+		tx = tx.Where("method = ?", filter.Method)
+	}
+
+	if filter.ToolName != "" {
+		tx = tx.Where("tool_name = ?", filter.ToolName)
+	}
+
+	if filter.IP != "" {
+		tx = tx.Where("ip = ?", filter.IP)
+	}
+
+	switch {
+	case !filter.StartTimestamp.IsZero() && !filter.EndTimestamp.IsZero():
+		tx = tx.Where("created_at BETWEEN ? AND ?", filter.StartTimestamp, filter.EndTimestamp)
+	case !filter.StartTimestamp.IsZero():
+		tx = tx.Where("created_at >= ?", filter.StartTimestamp)
+	case !filter.EndTimestamp.IsZero():
+		tx = tx.Where("created_at <= ?", filter.EndTimestamp)
+	}
+
+	switch filter.CodeType {
+	case CodeTypeSuccess:
+		tx = tx.Where("code = 200")
+	case CodeTypeError:
+		tx = tx.Where("code != 200")
+	default:
+		if filter.Code != 0 {
+			tx = tx.Where("code = ?", filter.Code)
+		}
+	}
+
+	// Handle keyword search for zero value fields
+	if filter.Keyword != "" {
+		var (
+			conditions []string
+			values     []any
+		)
+
+		if filter.Group == "" {
+			conditions = append(conditions, "group_id = ?")
+			values = append(values, filter.Keyword)
+		}
+
+		if filter.TokenName == "" {
+			conditions = append(conditions, "token_name = ?")
+			values = append(values, filter.Keyword)
+		}
+
+		if filter.MCPID == "" {
+			conditions = append(conditions, "mcp_id = ?")
+			values = append(values, filter.Keyword)
+		}
+
+		if filter.SessionID == "" {
+			conditions = append(conditions, "session_id = ?")
+			values = append(values, filter.Keyword)
+		}
+
+		if filter.ToolName == "" {
+			conditions = append(conditions, "tool_name = ?")
+			values = append(values, filter.Keyword)
+		}
+
+		if len(conditions) > 0 {
+			tx = tx.Where(fmt.Sprintf("(%s)", strings.Join(conditions, " OR ")), values...)
+		}
+	}
+
+	return tx
+}
+
+func withMCPLogBody(tx *gorm.DB, withBody bool) *gorm.DB {
+	if withBody {
+		return tx
+	}
+
+	return tx.Omit("arguments", "result")
+}
+
+type GetMCPLogsResult struct {
+	Logs  []*MCPLog `json:"logs"`
+	Total int64     `json:"total"`
+}
+
+func SearchMCPLogs(
+	filter MCPLogFilter,
+	order string,
+	withBody bool,
+	page int,
+	perPage int,
+) (*GetMCPLogsResult, error) {
+	var (
+		total int64
+		logs  []*MCPLog
+	)
+
+	g := new(errgroup.Group)
+
+	g.Go(func() error {
+		return buildMCPLogsQuery(filter).Count(&total).Error
+	})
+
+	g.Go(func() error {
+		limit, offset := toLimitOffset(page, perPage)
+
+		return withMCPLogBody(buildMCPLogsQuery(filter), withBody).
+			Order(getLogOrder(order)).
+			Limit(limit).
+			Offset(offset).
+			Find(&logs).Error
+	})
+
+	if err := g.Wait(); err != nil {
+		return nil, err
+	}
+
+	return &GetMCPLogsResult{
+		Logs:  logs,
+		Total: total,
+	}, nil
+}
+
+func SearchGroupMCPLogs(
+	group string,
+	filter MCPLogFilter,
+	order string,
+	withBody bool,
+	page int,
+	perPage int,
+) (*GetMCPLogsResult, error) {
+	if group == "" {
+		return nil, errors.New("group is required")
+	}
+
+	filter.Group = group
+
+	return SearchMCPLogs(filter, order, withBody, page, perPage)
+}
+
+// ExportMCPLogsRange returns the mcp logs created in [startTimestamp,
+// endExclusive), the time range of the filter is ignored
+func ExportMCPLogsRange(
+	filter MCPLogFilter,
+	startTimestamp time.Time,
+	endExclusive time.Time,
+	order string,
+	withBody bool,
+	maxEntries int,
+) ([]*MCPLog, error) {
+	var logs []*MCPLog
+
+	filter.StartTimestamp = time.Time{}
+	filter.EndTimestamp = time.Time{}
+
+	query := withMCPLogBody(buildMCPLogsQuery(filter), withBody)
+
+	if !startTimestamp.IsZero() {
+		query = query.Where("created_at >= ?", startTimestamp)
+	}
+
+	if !endExclusive.IsZero() {
+		query = query.Where("created_at < ?", endExclusive)
+	}
+
+	query = query.Order(getLogOrder(order))
+	if maxEntries > 0 {
+		query = query.Limit(maxEntries)
+	}
+
+	return logs, query.Find(&logs).Error
+}
+
+func ExportGroupMCPLogsRange(
+	group string,
+	filter MCPLogFilter,
+	startTimestamp time.Time,
+	endExclusive time.Time,
+	order string,
+	withBody bool,
+	maxEntries int,
+) ([]*MCPLog, error) {
+	if group == "" {
+		return nil, errors.New("group is required")
+	}
+
+	filter.Group = group
+
+	return ExportMCPLogsRange(filter, startTimestamp, endExclusive, order, withBody, maxEntries)
+}
+
+func DeleteOldMCPLog(timestamp time.Time) (int64, error) {
+	result := LogDB.Where("created_at < ?", timestamp).Delete(&MCPLog{})
+	return result.RowsAffected, result.Error
+}
+
+func DeleteGroupMCPLogs(groupID string) (int64, error) {
+	if groupID == "" {
+		return 0, errors.New("group is required")
+	}
+
+	result := LogDB.Where("group_id = ?", groupID).Delete(&MCPLog{})
+
+	return result.RowsAffected, result.Error
+}
+
+func cleanMCPLog(batchSize int) error {
+	mcpLogStorageHours := config.GetMCPLogStorageHours()
+	if mcpLogStorageHours == 0 {
+		mcpLogStorageHours = config.GetLogStorageHours()
+	}
+
+	if mcpLogStorageHours == 0 {
+		return nil
+	}
+
+	if batchSize <= 0 {
+		batchSize = defaultCleanLogBatchSize
+	}
+
+	subQuery := LogDB.
+		Model(&MCPLog{}).
+		Where(
+			"created_at < ?",
+			time.Now().Add(-time.Duration(mcpLogStorageHours)*time.Hour),
+		).
+		Limit(batchSize).
+		Select("id")
+
+	return LogDB.
+		Session(&gorm.Session{SkipDefaultTransaction: true}).
+		Where("id IN (?)", subQuery).
+		Delete(&MCPLog{}).Error
+}
@@ -0,0 +1,149 @@
+package model
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/labring/aiproxy/core/common/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMCPLogApplyBodySizeLimit(t *testing.T) {
+	mcpLog := &MCPLog{
+		Arguments: `{"query":"aiproxy"}`,
+		Result:    strings.Repeat("a", 16),
+	}
+
+	mcpLog.ApplyBodySizeLimit(32)
+	assert.Equal(t, `{"query":"aiproxy"}`, mcpLog.Arguments)
+	assert.False(t, mcpLog.ArgumentsTruncated)
+	assert.False(t, mcpLog.ResultTruncated)
+
+	mcpLog.ApplyBodySizeLimit(8)
+	assert.True(t, mcpLog.ArgumentsTruncated)
+	assert.True(t, mcpLog.ResultTruncated)
+	assert.LessOrEqual(t, len(mcpLog.Result), 8)
+
+	mcpLog.ApplyBodySizeLimit(-1)
+	assert.Empty(t, mcpLog.Arguments)
+	assert.Empty(t, mcpLog.Result)
+}
+
+func TestSearchMCPLogs(t *testing.T) {
+	withTestModelCacheDB(t, func() {
+		require.NoError(t, LogDB.AutoMigrate(&MCPLog{}))
+
+		now := time.Now()
+		logs := []*MCPLog{
+			{
+				CreatedAt: now.Add(-2 * time.Minute),
+				GroupID:   "g1",
+				TokenName: "t1",
+				MCPID:     "github",
+				SessionID: "s1",
+				Method:    "tools/call",
+				ToolName:  "search",
+				Arguments: `{"query":"aiproxy"}`,
+				Result:    `{"content":[]}`,
+				Code:      200,
+			},
+			{
+				CreatedAt: now.Add(-time.Minute),
+				GroupID:   "g1",
+				TokenName: "t1",
+				MCPID:     "github",
+				SessionID: "s1",
+				Method:    "tools/list",
+				Code:      200,
+			},
+			{
+				CreatedAt: now,
+				GroupID:   "g2",
+				TokenName: "t2",
+				MCPID:     "fetch",
+				Method:    "tools/call",
+				ToolName:  "fetch",
+				Error:     "denied by the group acl",
+				Code:      403,
+			},
+		}
+		for _, mcpLog := range logs {
+			require.NoError(t, RecordMCPLog(mcpLog))
+		}
+
+		result, err := SearchMCPLogs(MCPLogFilter{}, "", false, 1, 10)
+		require.NoError(t, err)
+		assert.Equal(t, int64(3), result.Total)
+		require.Len(t, result.Logs, 3)
+		assert.Equal(t, "fetch", result.Logs[0].MCPID)
+		assert.Empty(t, result.Logs[2].Arguments)
+
+		result, err = SearchMCPLogs(MCPLogFilter{MCPID: "github"}, "created_at-asc", true, 1, 10)
+		require.NoError(t, err)
+		require.Len(t, result.Logs, 2)
+		assert.Equal(t, `{"query":"aiproxy"}`, result.Logs[0].Arguments)
+
+		result, err = SearchMCPLogs(MCPLogFilter{Keyword: "search"}, "", false, 1, 10)
+		require.NoError(t, err)
+		require.Len(t, result.Logs, 1)
+		assert.Equal(t, "tools/call", result.Logs[0].Method)
+
+		result, err = SearchMCPLogs(MCPLogFilter{CodeType: CodeTypeError}, "", false, 1, 10)
+		require.NoError(t, err)
+		require.Len(t, result.Logs, 1)
+		assert.Equal(t, "g2", result.Logs[0].GroupID)
+
+		result, err = SearchGroupMCPLogs("g1", MCPLogFilter{SessionID: "s1"}, "", false, 1, 10)
+		require.NoError(t, err)
+		assert.Equal(t, int64(2), result.Total)
+
+		exported, err := ExportGroupMCPLogsRange(
+			"g1",
+			MCPLogFilter{},
+			now.Add(-90*time.Second),
+			now.Add(time.Second),
+			"",
+			false,
+			0,
+		)
+		require.NoError(t, err)
+		require.Len(t, exported, 1)
+		assert.Equal(t, "tools/list", exported[0].Method)
+
+		deleted, err := DeleteGroupMCPLogs("g2")
+		require.NoError(t, err)
+		assert.Equal(t, int64(1), deleted)
+	})
+}
+
+func TestCleanMCPLog(t *testing.T) {
+	withTestModelCacheDB(t, func() {
+		require.NoError(t, LogDB.AutoMigrate(&MCPLog{}))
+
+		oldStorageHours := config.GetMCPLogStorageHours()
+
+		t.Cleanup(func() {
+			config.SetMCPLogStorageHours(oldStorageHours)
+		})
+
+		config.SetMCPLogStorageHours(1)
+
+		require.NoError(t, RecordMCPLog(&MCPLog{
+			CreatedAt: time.Now().Add(-2 * time.Hour),
+			MCPID:     "github",
+			Method:    "tools/list",
+		}))
+		require.NoError(t, RecordMCPLog(&MCPLog{
+			MCPID:  "github",
+			Method: "tools/list",
+		}))
+
+		require.NoError(t, cleanMCPLog(10))
+
+		var count int64
+		require.NoError(t, LogDB.Model(&MCPLog{}).Count(&count).Error)
+		assert.Equal(t, int64(1), count)
+	})
+}
@@ -25,6 +25,38 @@ type TimeoutConfig struct {
 	StreamRequestTimeout int64 `json:"stream_request_timeout,omitempty" yaml:"stream_request_timeout,omitempty"`
 }
 
+// RoutingStrategy decides how a channel is picked among the channels of a model
+type RoutingStrategy string
+
+const (
+	// RoutingStrategyWeightedRandom picks channels randomly weighted by priority and
+	// penalised by error rate, it's the default strategy
+	RoutingStrategyWeightedRandom RoutingStrategy = "weighted_random"
+	// RoutingStrategyPriority always picks the channel with the highest priority and
+	// fails over to the next priority
+	RoutingStrategyPriority RoutingStrategy = "priority"
+	// RoutingStrategyLeastLatency picks the channel with the lowest recent latency
+	RoutingStrategyLeastLatency RoutingStrategy = "least_latency"
+	// RoutingStrategyLeastCost picks the channel whose mapped model has the lowest price
+	RoutingStrategyLeastCost RoutingStrategy = "least_cost"
+	// RoutingStrategyRoundRobin picks the channels in turn
+	RoutingStrategyRoundRobin RoutingStrategy = "round_robin"
+)
+
+func (s RoutingStrategy) IsValid() bool {
+	switch s {
+	case "",
+		RoutingStrategyWeightedRandom,
+		RoutingStrategyPriority,
+		RoutingStrategyLeastLatency,
+		RoutingStrategyLeastCost,
+		RoutingStrategyRoundRobin:
+		return true
+	default:
+		return false
+	}
+}
+
 type ModelConfig struct {
 	CreatedAt                   time.Time                 `gorm:"index;autoCreateTime"          json:"created_at"                               yaml:"-"`
 	UpdatedAt                   time.Time                 `gorm:"index;autoUpdateTime"          json:"updated_at"                               yaml:"-"`
@@ -49,6 +81,7 @@ type ModelConfig struct {
 	SummaryServiceTier          bool                      `                                     json:"summary_service_tier,omitempty"           yaml:"summary_service_tier,omitempty"`
 	SummaryClaudeLongContext    bool                      `                                     json:"summary_claude_long_context,omitempty"    yaml:"summary_claude_long_context,omitempty"`
 	DisableResolutionFuzzyMatch bool                      `                                     json:"disable_resolution_fuzzy_match,omitempty" yaml:"disable_resolution_fuzzy_match,omitempty"`
+	RoutingStrategy             RoutingStrategy           `gorm:"size:32"                       json:"routing_strategy,omitempty"               yaml:"routing_strategy,omitempty"`
 }
 
 func (c *ModelConfig) BeforeSave(_ *gorm.DB) (err error) {
@@ -60,6 +93,10 @@ func (c *ModelConfig) BeforeSave(_ *gorm.DB) (err error) {
 		return err
 	}
 
+	if !c.RoutingStrategy.IsValid() {
+		return fmt.Errorf("invalid routing strategy: %s", c.RoutingStrategy)
+	}
+
 	if !c.SupportStreamTimeout() {
 		c.TimeoutConfig.StreamRequestTimeout = 0
 	}
@@ -107,6 +144,8 @@ func jsonRawMessageDecodeHook(from, to reflect.Type, data any) (any, error) {
 	return sonic.Marshal(data)
 }
 
+// LoadPluginConfig decodes the config of the plugin, the fields of the embedded structs are
+// at the top level as they are in json
 func (c *ModelConfig) LoadPluginConfig(pluginName string, config any) error {
 	if len(c.Plugin) == 0 {
 		return nil
@@ -122,6 +161,7 @@ func (c *ModelConfig) LoadPluginConfig(pluginName string, config any) error {
 		Result:           config,
 		DecodeHook:       jsonRawMessageDecodeHook,
 		WeaklyTypedInput: true,
+		Squash:           true,
 	})
 	if err != nil {
 		return err
@@ -66,6 +66,9 @@ func initOptionMap() error {
 	optionMap["LogStorageHours"] = strconv.FormatInt(config.GetLogStorageHours(), 10)
 	optionMap["RetryLogStorageHours"] = strconv.FormatInt(config.GetRetryLogStorageHours(), 10)
 	optionMap["LogDetailStorageHours"] = strconv.FormatInt(config.GetLogDetailStorageHours(), 10)
+	optionMap["MCPLogStorageHours"] = strconv.FormatInt(config.GetMCPLogStorageHours(), 10)
+	optionMap["SaveMCPLogBody"] = strconv.FormatBool(config.GetSaveMCPLogBody())
+	optionMap["MCPLogBodyMaxSize"] = strconv.FormatInt(config.GetMCPLogBodyMaxSize(), 10)
 	optionMap["CleanLogBatchSize"] = strconv.FormatInt(config.GetCleanLogBatchSize(), 10)
 	optionMap["IPGroupsThreshold"] = strconv.FormatInt(config.GetIPGroupsThreshold(), 10)
 	optionMap["IPGroupsBanThreshold"] = strconv.FormatInt(config.GetIPGroupsBanThreshold(), 10)
@@ -79,6 +82,7 @@ func initOptionMap() error {
 		10,
 	)
 	optionMap["DisableServe"] = strconv.FormatBool(config.GetDisableServe())
+	optionMap["EnableTTFBWeight"] = strconv.FormatBool(config.GetEnableTTFBWeight())
 	optionMap["RetryTimes"] = strconv.FormatInt(config.GetRetryTimes(), 10)
 
 	defaultChannelModelsJSON, err := sonic.Marshal(config.GetDefaultChannelModels())
@@ -103,6 +107,7 @@ func initOptionMap() error {
 
 	optionMap["GroupConsumeLevelRatio"] = conv.BytesToString(groupConsumeLevelRatioJSON)
 	optionMap["NotifyNote"] = config.GetNotifyNote()
+	optionMap["DefaultFilesModel"] = config.GetDefaultFilesModel()
 	optionMap["DefaultHost"] = config.GetDefaultHost()
 	optionMap["DefaultMCPHost"] = config.GetConfiguredDefaultMCPHost()
 	optionMap["PublicMCPHost"] = config.GetPublicMCPHost()
@@ -286,6 +291,22 @@ func updateOption(key, value string, isInit bool) (err error) {
 		}
 
 		config.SetLogDetailStorageHours(logDetailStorageHours)
+	case "MCPLogStorageHours":
+		mcpLogStorageHours, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return err
+		}
+
+		config.SetMCPLogStorageHours(mcpLogStorageHours)
+	case "SaveMCPLogBody":
+		config.SetSaveMCPLogBody(toBool(value))
+	case "MCPLogBodyMaxSize":
+		mcpLogBodyMaxSize, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return err
+		}
+
+		config.SetMCPLogBodyMaxSize(mcpLogBodyMaxSize)
 	case "IPGroupsThreshold":
 		ipGroupsThreshold, err := strconv.ParseInt(value, 10, 64)
 		if err != nil {
@@ -325,6 +346,8 @@ func updateOption(key, value string, isInit bool) (err error) {
 		config.SetCleanLogBatchSize(cleanLogBatchSize)
 	case "DisableServe":
 		config.SetDisableServe(toBool(value))
+	case "EnableTTFBWeight":
+		config.SetEnableTTFBWeight(toBool(value))
 	case "GroupMaxTokenNum":
 		groupMaxTokenNum, err := strconv.ParseInt(value, 10, 32)
 		if err != nil {
@@ -430,6 +453,8 @@ func updateOption(key, value string, isInit bool) (err error) {
 		config.SetGroupConsumeLevelRatio(newGroupRpmRatioMap)
 	case "NotifyNote":
 		config.SetNotifyNote(value)
+	case "DefaultFilesModel":
+		config.SetDefaultFilesModel(value)
 	case "DefaultHost":
 		config.SetDefaultHost(value)
 	case "DefaultMCPHost":
@@ -0,0 +1,375 @@
+package model
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/bytedance/sonic"
+	"github.com/labring/aiproxy/core/common"
+	log "github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+const (
+	ErrPromptNotFound = "prompt"
+)
+
+// promptVariableRegex matches the {{name}} placeholders of the prompt content
+var promptVariableRegex = regexp.MustCompile(`\{\{\s*([a-zA-Z_][a-zA-Z0-9_]*)\s*\}\}`)
+
+type PromptVariable struct {
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	Default     string `json:"default,omitempty"`
+	Required    bool   `json:"required,omitempty"`
+}
+
+// Prompt is a version of a prompt template of a group, the versions are
+// immutable, an update creates a new version
+type Prompt struct {
+	ID          string           `gorm:"primaryKey"                         json:"id"`
+	GroupID     string           `gorm:"primaryKey"                         json:"group_id"`
+	Version     int              `gorm:"primaryKey;autoIncrement:false"     json:"version"`
+	Group       *Group           `gorm:"foreignKey:GroupID"                 json:"-"`
+	CreatedAt   time.Time        `gorm:"index,autoCreateTime"               json:"created_at"`
+	Name        string           `                                          json:"name"`
+	Description string           `                                          json:"description"`
+	Content     string           `gorm:"type:text"                          json:"content"`
+	Variables   []PromptVariable `gorm:"serializer:fastjson;type:text"      json:"variables,omitempty"`
+}
+
+func (p *Prompt) BeforeSave(_ *gorm.DB) error {
+	if p.GroupID == "" {
+		return errors.New("group id is empty")
+	}
+
+	if err := validateMCPID(p.ID); err != nil {
+		return fmt.Errorf("prompt id is invalid: %w", err)
+	}
+
+	if p.Version <= 0 {
+		return errors.New("prompt version must be positive")
+	}
+
+	if strings.TrimSpace(p.Content) == "" {
+		return errors.New("prompt content is empty")
+	}
+
+	return validatePromptVariables(p.Content, p.Variables)
+}
+
+func (p *Prompt) MarshalJSON() ([]byte, error) {
+	type Alias Prompt
+
+	a := &struct {
+		*Alias
+		CreatedAt int64 `json:"created_at"`
+	}{
+		Alias:     (*Alias)(p),
+		CreatedAt: p.CreatedAt.UnixMilli(),
+	}
+
+	return sonic.Marshal(a)
+}
+
+// validatePromptVariables checks the variables are unique and every
+// placeholder of the content is declared
+func validatePromptVariables(content string, variables []PromptVariable) error {
+	names := make([]string, 0, len(variables))
+	for _, v := range variables {
+		if !promptVariableRegex.MatchString("{{" + v.Name + "}}") {
+			return fmt.Errorf("prompt variable %q is invalid", v.Name)
+		}
+
+		if slices.Contains(names, v.Name) {
+			return fmt.Errorf("prompt variable %q is duplicated", v.Name)
+		}
+
+		names = append(names, v.Name)
+	}
+
+	for _, match := range promptVariableRegex.FindAllStringSubmatch(content, -1) {
+		if !slices.Contains(names, match[1]) {
+			return fmt.Errorf("prompt variable %q is not declared", match[1])
+		}
+	}
+
+	return nil
+}
+
+// Render replaces the placeholders with the values, the defaults are used for
+// the missing values
+func (p *Prompt) Render(values map[string]string) (string, error) {
+	resolved := make(map[string]string, len(p.Variables))
+	for _, v := range p.Variables {
+		value, ok := values[v.Name]
+		if !ok {
+			if v.Required {
+				return "", fmt.Errorf("prompt variable %q is required", v.Name)
+			}
+
+			value = v.Default
+		}
+
+		resolved[v.Name] = value
+	}
+
+	return promptVariableRegex.ReplaceAllStringFunc(p.Content, func(placeholder string) string {
+		name := promptVariableRegex.FindStringSubmatch(placeholder)[1]
+		return resolved[name]
+	}), nil
+}
+
+// CreatePrompt creates the first version of a prompt
+func CreatePrompt(prompt *Prompt) error {
+	prompt.Version = 1
+
+	err := DB.Create(prompt).Error
+	if err != nil && errors.Is(err, gorm.ErrDuplicatedKey) {
+		return errors.New("prompt already exists")
+	}
+
+	return err
+}
+
+// CreatePromptVersion saves the prompt as the next version of an existing prompt
+func CreatePromptVersion(prompt *Prompt) (err error) {
+	defer func() {
+		if err == nil {
+			CacheDeletePrompt(prompt.GroupID, prompt.ID)
+		}
+	}()
+
+	err = DB.Transaction(func(tx *gorm.DB) error {
+		var latest int
+
+		err := tx.Model(&Prompt{}).
+			Select("COALESCE(MAX(version), 0)").
+			Where("group_id = ? AND id = ?", prompt.GroupID, prompt.ID).
+			Scan(&latest).
+			Error
+		if err != nil {
+			return err
+		}
+
+		if latest == 0 {
+			return NotFoundError(ErrPromptNotFound)
+		}
+
+		prompt.Version = latest + 1
+
+		return tx.Create(prompt).Error
+	})
+	if err != nil && errors.Is(err, gorm.ErrDuplicatedKey) {
+		return errors.New("prompt version already exists, please retry")
+	}
+
+	return err
+}
+
+// DeletePrompt deletes all the versions of a prompt
+func DeletePrompt(id, groupID string) (err error) {
+	defer func() {
+		if err == nil {
+			CacheDeletePrompt(groupID, id)
+		}
+	}()
+
+	if id == "" || groupID == "" {
+		return errors.New("prompt id or group id is empty")
+	}
+
+	result := DB.Where("id = ? AND group_id = ?", id, groupID).Delete(&Prompt{})
+
+	return HandleUpdateResult(result, ErrPromptNotFound)
+}
+
+// DeletePromptVersion deletes a version of a prompt
+func DeletePromptVersion(id, groupID string, version int) (err error) {
+	defer func() {
+		if err == nil {
+			CacheDeletePrompt(groupID, id)
+		}
+	}()
+
+	if id == "" || groupID == "" {
+		return errors.New("prompt id or group id is empty")
+	}
+
+	result := DB.
+		Where("id = ? AND group_id = ? AND version = ?", id, groupID, version).
+		Delete(&Prompt{})
+
+	return HandleUpdateResult(result, ErrPromptNotFound)
+}
+
+// GetPrompt returns a version of a prompt, the latest version is returned
+// when the version is 0
+func GetPrompt(id, groupID string, version int) (Prompt, error) {
+	var prompt Prompt
+	if id == "" || groupID == "" {
+		return prompt, errors.New("prompt id or group id is empty")
+	}
+
+	tx := DB.Where("id = ? AND group_id = ?", id, groupID)
+	if version > 0 {
+		tx = tx.Where("version = ?", version)
+	} else {
+		tx = tx.Order("version desc")
+	}
+
+	err := tx.First(&prompt).Error
+
+	return prompt, HandleNotFound(err, ErrPromptNotFound)
+}
+
+// GetPromptVersions returns all the versions of a prompt, the latest first
+func GetPromptVersions(id, groupID string) ([]Prompt, error) {
+	if id == "" || groupID == "" {
+		return nil, errors.New("prompt id or group id is empty")
+	}
+
+	var prompts []Prompt
+
+	err := DB.
+		Where("id = ? AND group_id = ?", id, groupID).
+		Order("version desc").
+		Find(&prompts).
+		Error
+	if err != nil {
+		return nil, err
+	}
+
+	if len(prompts) == 0 {
+		return nil, NotFoundError(ErrPromptNotFound)
+	}
+
+	return prompts, nil
+}
+
+// GetPrompts returns the latest version of the prompts of a group with
+// pagination and filtering
+func GetPrompts(
+	groupID string,
+	page, perPage int,
+	keyword string,
+) (prompts []Prompt, total int64, err error) {
+	if groupID == "" {
+		return nil, 0, errors.New("group id is empty")
+	}
+
+	tx := DB.Model(&Prompt{}).
+		Where("group_id = ?", groupID).
+		Where("version = (?)", DB.
+			Table("prompts AS p").
+			Select("MAX(p.version)").
+			Where("p.group_id = prompts.group_id AND p.id = prompts.id"))
+
+	if keyword != "" {
+		like := "LIKE"
+		if !common.UsingSQLite {
+			like = "ILIKE"
+		}
+
+		tx = tx.Where(
+			fmt.Sprintf("(id %[1]s ? OR name %[1]s ? OR description %[1]s ?)", like),
+			"%"+keyword+"%",
+			"%"+keyword+"%",
+			"%"+keyword+"%",
+		)
+	}
+
+	err = tx.Count(&total).Error
+	if err != nil {
+		return nil, 0, err
+	}
+
+	if total <= 0 {
+		return nil, 0, nil
+	}
+
+	limit, offset := toLimitOffset(page, perPage)
+	err = tx.
+		Order("id asc").
+		Limit(limit).
+		Offset(offset).
+		Find(&prompts).
+		Error
+
+	return prompts, total, err
+}
+
+const (
+	PromptCacheKey = "prompt:%s:%s:%d"
+)
+
+func getPromptCacheKey(groupID, id string, version int) string {
+	return common.RedisKeyf(PromptCacheKey, groupID, id, version)
+}
+
+func clonePrompt(prompt *Prompt) *Prompt {
+	if prompt == nil {
+		return nil
+	}
+
+	cloned := *prompt
+	cloned.Variables = slices.Clone(prompt.Variables)
+
+	return &cloned
+}
+
+// CacheDeletePrompt drops the latest version of the prompt from the local
+// cache, the versions are immutable so the other keys expire by themselves
+func CacheDeletePrompt(groupID, id string) {
+	cacheDeleteModelLocal(getPromptCacheKey(groupID, id, 0))
+}
+
+// CacheGetPrompt returns a version of a prompt through the local cache, the
+// latest version is returned when the version is 0
+func CacheGetPrompt(groupID, id string, version int) (*Prompt, error) {
+	cacheKey := getPromptCacheKey(groupID, id, version)
+	if prompt, notFound, ok := cacheGetModelLocal(cacheKey, clonePrompt); ok {
+		if notFound {
+			return nil, NotFoundError(ErrPromptNotFound)
+		}
+
+		return prompt, nil
+	}
+
+	prompt, notFound, _, err := loadWithLocalKeyLock(
+		modelCacheLoadLocker,
+		cacheKey,
+		func() (*Prompt, bool, bool) {
+			return cacheGetModelLocal(cacheKey, clonePrompt)
+		},
+		func() (*Prompt, error) {
+			prompt, err := GetPrompt(id, groupID, version)
+			if err != nil {
+				if errors.Is(err, gorm.ErrRecordNotFound) {
+					cacheSetModelNotFoundLocalUnlocked(cacheKey)
+				} else {
+					log.Errorf("get prompt (%s:%s:%d) error: %s", groupID, id, version, err.Error())
+				}
+
+				return nil, err
+			}
+
+			cacheSetModelLocalUnlocked(cacheKey, &prompt, clonePrompt)
+
+			return &prompt, nil
+		},
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	if notFound {
+		return nil, NotFoundError(ErrPromptNotFound)
+	}
+
+	return clonePrompt(prompt), nil
+}
@@ -0,0 +1,152 @@
+package model
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+func TestPromptVersions(t *testing.T) {
+	withTestModelCacheDB(t, func() {
+		require.NoError(t, DB.Create(&Group{ID: "g1"}).Error)
+
+		prompt := &Prompt{
+			ID:      "support",
+			GroupID: "g1",
+			Name:    "Support",
+			Content: "You are the support agent of {{product}}.",
+			Variables: []PromptVariable{
+				{Name: "product", Required: true},
+			},
+		}
+		require.NoError(t, CreatePrompt(prompt))
+		assert.Equal(t, 1, prompt.Version)
+
+		require.Error(t, CreatePrompt(&Prompt{
+			ID:      "support",
+			GroupID: "g1",
+			Content: "again",
+		}))
+
+		v2 := &Prompt{
+			ID:      "support",
+			GroupID: "g1",
+			Name:    "Support",
+			Content: "You are the {{tone}} support agent of {{product}}.",
+			Variables: []PromptVariable{
+				{Name: "product", Required: true},
+				{Name: "tone", Default: "friendly"},
+			},
+		}
+		require.NoError(t, CreatePromptVersion(v2))
+		assert.Equal(t, 2, v2.Version)
+
+		require.NoError(t, CreatePrompt(&Prompt{
+			ID:      "translator",
+			GroupID: "g1",
+			Name:    "Translator",
+			Content: "Translate the text.",
+		}))
+
+		err := CreatePromptVersion(&Prompt{ID: "missing", GroupID: "g1", Content: "x"})
+		require.True(t, errors.Is(err, gorm.ErrRecordNotFound))
+
+		latest, err := CacheGetPrompt("g1", "support", 0)
+		require.NoError(t, err)
+		assert.Equal(t, 2, latest.Version)
+
+		first, err := CacheGetPrompt("g1", "support", 1)
+		require.NoError(t, err)
+		assert.Equal(t, "You are the support agent of {{product}}.", first.Content)
+
+		prompts, total, err := GetPrompts("g1", 1, 10, "")
+		require.NoError(t, err)
+		assert.Equal(t, int64(2), total)
+		require.Len(t, prompts, 2)
+		assert.Equal(t, "support", prompts[0].ID)
+		assert.Equal(t, 2, prompts[0].Version)
+
+		prompts, total, err = GetPrompts("g1", 1, 10, "transl")
+		require.NoError(t, err)
+		assert.Equal(t, int64(1), total)
+		assert.Equal(t, "translator", prompts[0].ID)
+
+		versions, err := GetPromptVersions("support", "g1")
+		require.NoError(t, err)
+		require.Len(t, versions, 2)
+		assert.Equal(t, 2, versions[0].Version)
+
+		require.NoError(t, DeletePromptVersion("support", "g1", 2))
+
+		latest, err = CacheGetPrompt("g1", "support", 0)
+		require.NoError(t, err)
+		assert.Equal(t, 1, latest.Version)
+
+		require.NoError(t, DeletePrompt("support", "g1"))
+
+		_, err = CacheGetPrompt("g1", "support", 0)
+		require.True(t, errors.Is(err, gorm.ErrRecordNotFound))
+	})
+}
+
+func TestPromptValidation(t *testing.T) {
+	withTestModelCacheDB(t, func() {
+		tests := []struct {
+			name   string
+			prompt Prompt
+		}{
+			{
+				name:   "invalid id",
+				prompt: Prompt{ID: "bad id", GroupID: "g1", Content: "x"},
+			},
+			{
+				name:   "empty content",
+				prompt: Prompt{ID: "p", GroupID: "g1", Content: " "},
+			},
+			{
+				name:   "undeclared variable",
+				prompt: Prompt{ID: "p", GroupID: "g1", Content: "{{name}}"},
+			},
+			{
+				name: "duplicated variable",
+				prompt: Prompt{
+					ID:        "p",
+					GroupID:   "g1",
+					Content:   "{{name}}",
+					Variables: []PromptVariable{{Name: "name"}, {Name: "name"}},
+				},
+			},
+		}
+
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				prompt := tt.prompt
+				assert.Error(t, CreatePrompt(&prompt))
+			})
+		}
+	})
+}
+
+func TestPromptRender(t *testing.T) {
+	prompt := Prompt{
+		Content: "You are the {{ tone }} agent of {{product}}. {{product}} rocks.",
+		Variables: []PromptVariable{
+			{Name: "product", Required: true},
+			{Name: "tone", Default: "friendly"},
+		},
+	}
+
+	text, err := prompt.Render(map[string]string{"product": "AI Proxy"})
+	require.NoError(t, err)
+	assert.Equal(t, "You are the friendly agent of AI Proxy. AI Proxy rocks.", text)
+
+	text, err = prompt.Render(map[string]string{"product": "AI Proxy", "tone": "formal"})
+	require.NoError(t, err)
+	assert.Equal(t, "You are the formal agent of AI Proxy. AI Proxy rocks.", text)
+
+	_, err = prompt.Render(nil)
+	require.Error(t, err)
+}
@@ -34,6 +34,7 @@ const (
 	PublicMCPTypeDocs            PublicMCPType = "mcp_docs" // read only
 	PublicMCPTypeOpenAPI         PublicMCPType = "mcp_openapi"
 	PublicMCPTypeEmbed           PublicMCPType = "mcp_embed"
+	PublicMCPTypeStdio           PublicMCPType = "mcp_stdio"
 )
 
 type ProxyParamType string
@@ -55,6 +56,16 @@ type MCPPrice struct {
 	ToolsCallPrices       map[string]float64 `json:"tools_call_prices"        gorm:"serializer:fastjson;type:text"`
 }
 
+// GetToolsCallPrice returns the price of a single tools/call, falling back to
+// DefaultToolsCallPrice when the tool has no dedicated price
+func (p MCPPrice) GetToolsCallPrice(toolName string) float64 {
+	if price, ok := p.ToolsCallPrices[toolName]; ok {
+		return price
+	}
+
+	return p.DefaultToolsCallPrice
+}
+
 type PublicMCPProxyReusingParam struct {
 	ReusingParam
 	Type ProxyParamType `json:"type"`
@@ -119,6 +130,18 @@ type MCPEmbeddingConfig struct {
 	Reusing map[string]ReusingParam `json:"reusing"`
 }
 
+// MCPStdioConfig launches a local mcp server talking over stdio, the args can
+// reference the env with ${NAME}
+type MCPStdioConfig struct {
+	Command string            `json:"command"`
+	Args    []string          `json:"args,omitempty"`
+	Env     map[string]string `json:"env,omitempty"`
+	// the reusing params of the group are passed to the process as env
+	Reusing map[string]ReusingParam `json:"reusing,omitempty"`
+	// seconds before an idle process is shut down, 0 means the default
+	IdleTimeout int64 `json:"idle_timeout,omitempty"`
+}
+
 var validateMCPIDRegex = regexp.MustCompile(`^[a-zA-Z0-9_-]+$`)
 
 func validateMCPID(id string) error {
@@ -162,6 +185,7 @@ type PublicMCP struct {
 	ProxyConfig   *PublicMCPProxyConfig `gorm:"serializer:fastjson;type:text" json:"proxy_config,omitempty"`
 	OpenAPIConfig *MCPOpenAPIConfig     `gorm:"serializer:fastjson;type:text" json:"openapi_config,omitempty"`
 	EmbedConfig   *MCPEmbeddingConfig   `gorm:"serializer:fastjson;type:text" json:"embed_config,omitempty"`
+	StdioConfig   *MCPStdioConfig       `gorm:"serializer:fastjson;type:text" json:"stdio_config,omitempty"`
 	// only used by list tools
 	TestConfig *TestConfig `gorm:"serializer:fastjson;type:text" json:"test_config,omitempty"`
 }
@@ -197,6 +221,17 @@ func (p *PublicMCP) BeforeSave(_ *gorm.DB) error {
 		return validateHTTPURL(config.URL)
 	}
 
+	if p.StdioConfig != nil {
+		config := p.StdioConfig
+		if config.Command == "" {
+			return errors.New("stdio command is empty")
+		}
+
+		if config.IdleTimeout < 0 {
+			return errors.New("stdio idle timeout is negative")
+		}
+	}
+
 	return nil
 }
 
@@ -0,0 +1,258 @@
+package model
+
+import (
+	"cmp"
+	"errors"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/labring/aiproxy/core/relay/mode"
+	"github.com/shopspring/decimal"
+)
+
+// StatementUnknownMode is the mode of the models without a model config
+const StatementUnknownMode = "unknown"
+
+// StatementItem is the totals of a statement line
+type StatementItem struct {
+	Name           string `json:"name"`
+	RequestCount   int64  `json:"request_count"`
+	ExceptionCount int64  `json:"exception_count"`
+	Usage          `json:",inline"`
+	Amount         `json:",inline"`
+}
+
+// TotalInputAmount is the amount of the text, image, audio and video inputs
+func (s StatementItem) TotalInputAmount() float64 {
+	return sumAmounts(
+		s.InputAmount,
+		s.ImageInputAmount,
+		s.AudioInputAmount,
+		s.VideoInputAmount,
+	)
+}
+
+// TotalOutputAmount is the amount of the text, image and audio outputs
+func (s StatementItem) TotalOutputAmount() float64 {
+	return sumAmounts(s.OutputAmount, s.ImageOutputAmount, s.AudioOutputAmount)
+}
+
+// TotalCacheAmount is the amount of the cache reads and writes
+func (s StatementItem) TotalCacheAmount() float64 {
+	return sumAmounts(s.CachedAmount, s.CacheCreationAmount)
+}
+
+func sumAmounts(amounts ...float64) float64 {
+	sum := decimal.Zero
+	for _, amount := range amounts {
+		sum = sum.Add(decimal.NewFromFloat(amount))
+	}
+
+	return sum.InexactFloat64()
+}
+
+func (s *StatementItem) add(data SummaryDataSet) {
+	s.RequestCount += data.RequestCount
+	s.ExceptionCount += int64(data.ExceptionCount)
+	s.Usage.Add(data.Usage)
+	s.Amount.Add(data.Amount)
+}
+
+// StatementLine is the totals of a token, a model and a mode
+type StatementLine struct {
+	TokenName string `json:"token_name"`
+	Model     string `json:"model"`
+	Mode      string `json:"mode"`
+	StatementItem
+}
+
+// Statement is the usage statement of a group in the billing period, the
+// period is [Start, End) aligned to hours as the summaries are hourly
+type Statement struct {
+	GroupID     string          `json:"group_id"`
+	Start       time.Time       `json:"start"`
+	End         time.Time       `json:"end"`
+	GeneratedAt time.Time       `json:"generated_at"`
+	Total       StatementItem   `json:"total"`
+	Models      []StatementItem `json:"models"`
+	Tokens      []StatementItem `json:"tokens"`
+	Modes       []StatementItem `json:"modes"`
+	Lines       []StatementLine `json:"lines"`
+}
+
+type statementRow struct {
+	TokenName      string
+	Model          string
+	Mode           int
+	SummaryDataSet `gorm:"embedded"`
+}
+
+var statementSelectFields = func() string {
+	fields := concatSummaryFields(
+		baseCountSummaryFields,
+		baseUsageSummaryFields,
+		baseAmountSummaryFields,
+	)
+
+	var sb strings.Builder
+
+	sb.WriteString("token_name, model, mode")
+
+	for _, field := range fields {
+		sb.WriteString(", sum(")
+		sb.WriteString(field)
+		sb.WriteString(") as ")
+		sb.WriteString(field)
+	}
+
+	return sb.String()
+}()
+
+// statementMode returns the mode the requests of the row used, the rows
+// summarized before the mode was recorded fall back to the configured type of
+// the model
+func statementMode(row statementRow) string {
+	if m := mode.Mode(row.Mode); m != mode.Unknown {
+		return m.String()
+	}
+
+	caches := LoadModelCaches()
+	if caches == nil || caches.ModelConfig == nil {
+		return StatementUnknownMode
+	}
+
+	config, ok := caches.ModelConfig.GetModelConfig(row.Model)
+	if !ok {
+		return StatementUnknownMode
+	}
+
+	return config.Type.String()
+}
+
+// alignStatementPeriod widens the period to whole hours, the summaries are
+// hourly so a partial hour can not be split
+func alignStatementPeriod(start, end time.Time) (time.Time, time.Time) {
+	start = truncateStatementHour(start)
+	if aligned := truncateStatementHour(end); !aligned.Equal(end) {
+		end = aligned.Add(time.Hour)
+	}
+
+	return start, end
+}
+
+// truncateStatementHour truncates to the hour on the clock of the location of
+// the time, time.Truncate works on the absolute time and would move the
+// calendar boundaries of the zones with a half hour offset such as Asia/Kolkata
+func truncateStatementHour(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), 0, 0, 0, t.Location())
+}
+
+// GetGroupStatement builds the usage statement of the group from the hourly
+// group summaries, the period is widened to whole hours
+func GetGroupStatement(group string, start, end time.Time) (*Statement, error) {
+	if group == "" {
+		return nil, errors.New("group is required")
+	}
+
+	start, end = alignStatementPeriod(start, end)
+
+	if !start.Before(end) {
+		return nil, errors.New("start must be before end")
+	}
+
+	var rows []statementRow
+
+	err := LogDB.
+		Model(&GroupSummary{}).
+		Select(statementSelectFields).
+		Where("group_id = ?", group).
+		Where("hour_timestamp >= ? AND hour_timestamp < ?", start.Unix(), end.Unix()).
+		Group("token_name, model, mode").
+		Find(&rows).
+		Error
+	if err != nil {
+		return nil, err
+	}
+
+	return buildStatement(group, start, end, rows, statementMode), nil
+}
+
+func buildStatement(
+	group string,
+	start, end time.Time,
+	rows []statementRow,
+	modeOf func(row statementRow) string,
+) *Statement {
+	statement := &Statement{
+		GroupID:     group,
+		Start:       start,
+		End:         end,
+		GeneratedAt: time.Now(),
+		Total:       StatementItem{Name: "total"},
+		Lines:       make([]StatementLine, 0, len(rows)),
+	}
+
+	models := map[string]*StatementItem{}
+	tokens := map[string]*StatementItem{}
+	modes := map[string]*StatementItem{}
+
+	addTo := func(items map[string]*StatementItem, name string, data SummaryDataSet) {
+		item, ok := items[name]
+		if !ok {
+			item = &StatementItem{Name: name}
+			items[name] = item
+		}
+
+		item.add(data)
+	}
+
+	for _, row := range rows {
+		rowMode := modeOf(row)
+
+		line := StatementLine{
+			TokenName:     row.TokenName,
+			Model:         row.Model,
+			Mode:          rowMode,
+			StatementItem: StatementItem{Name: row.TokenName + "/" + row.Model},
+		}
+		line.add(row.SummaryDataSet)
+		statement.Lines = append(statement.Lines, line)
+
+		statement.Total.add(row.SummaryDataSet)
+		addTo(models, row.Model, row.SummaryDataSet)
+		addTo(tokens, row.TokenName, row.SummaryDataSet)
+		addTo(modes, rowMode, row.SummaryDataSet)
+	}
+
+	statement.Models = sortedStatementItems(models)
+	statement.Tokens = sortedStatementItems(tokens)
+	statement.Modes = sortedStatementItems(modes)
+
+	slices.SortFunc(statement.Lines, func(a, b StatementLine) int {
+		return cmp.Or(
+			cmp.Compare(a.TokenName, b.TokenName),
+			cmp.Compare(a.Model, b.Model),
+			cmp.Compare(a.Mode, b.Mode),
+		)
+	})
+
+	return statement
+}
+
+// sortedStatementItems sorts the items by the used amount desc and the name
+func sortedStatementItems(items map[string]*StatementItem) []StatementItem {
+	result := make([]StatementItem, 0, len(items))
+	for _, item := range items {
+		result = append(result, *item)
+	}
+
+	slices.SortFunc(result, func(a, b StatementItem) int {
+		return cmp.Or(
+			cmp.Compare(b.UsedAmount, a.UsedAmount),
+			cmp.Compare(a.Name, b.Name),
+		)
+	})
+
+	return result
+}
@@ -0,0 +1,251 @@
+package model_test
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/labring/aiproxy/core/model"
+	"github.com/labring/aiproxy/core/relay/mode"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func setupStatementTestDB(t *testing.T) {
+	t.Helper()
+
+	prevLogDB := model.LogDB
+
+	testDB, err := model.OpenSQLite(filepath.Join(t.TempDir(), "statement.db"))
+	require.NoError(t, err)
+
+	model.LogDB = testDB
+
+	t.Cleanup(func() {
+		model.LogDB = prevLogDB
+	})
+
+	require.NoError(t, testDB.AutoMigrate(&model.GroupSummary{}))
+}
+
+func upsertStatementSummary(
+	t *testing.T,
+	group, tokenName, modelName string,
+	hour time.Time,
+	requests int64,
+	input, output, cached, web float64,
+) {
+	t.Helper()
+
+	data := model.SummaryData{}
+	data.RequestCount = requests
+	data.InputTokens = model.ZeroNullInt64(requests * 10)
+	data.OutputTokens = model.ZeroNullInt64(requests * 5)
+	data.InputAmount = input
+	data.OutputAmount = output
+	data.CachedAmount = cached
+	data.WebSearchAmount = web
+	data.UsedAmount = input + output + cached + web
+
+	require.NoError(t, model.UpsertGroupSummary(model.GroupSummaryUnique{
+		GroupID:       group,
+		TokenName:     tokenName,
+		Model:         modelName,
+		HourTimestamp: hour.Unix(),
+	}, data))
+}
+
+func TestGetGroupStatement(t *testing.T) {
+	setupStatementTestDB(t)
+
+	start := time.Date(2026, time.March, 1, 0, 0, 0, 0, time.UTC)
+	end := start.AddDate(0, 1, 0)
+
+	upsertStatementSummary(t, "g", "alpha", "gpt-4o", start, 2, 1, 2, 0.5, 0)
+	upsertStatementSummary(t, "g", "alpha", "gpt-4o", start.Add(time.Hour), 1, 1, 1, 0, 0.25)
+	upsertStatementSummary(t, "g", "beta", "gpt-4o", start.Add(2*time.Hour), 1, 2, 2, 0, 0)
+	upsertStatementSummary(t, "g", "beta", "embed", start.Add(3*time.Hour), 4, 0.5, 0, 0, 0)
+	// out of the period and of other groups
+	upsertStatementSummary(t, "g", "alpha", "gpt-4o", end, 9, 9, 9, 9, 9)
+	upsertStatementSummary(t, "other", "alpha", "gpt-4o", start, 9, 9, 9, 9, 9)
+
+	statement, err := model.GetGroupStatement("g", start, end)
+	require.NoError(t, err)
+
+	assert.Equal(t, "g", statement.GroupID)
+	assert.Equal(t, int64(8), statement.Total.RequestCount)
+	assert.Equal(t, model.ZeroNullInt64(80), statement.Total.InputTokens)
+	assert.InDelta(t, 10.25, statement.Total.UsedAmount, 1e-9)
+	assert.InDelta(t, 4.5, statement.Total.TotalInputAmount(), 1e-9)
+	assert.InDelta(t, 5, statement.Total.TotalOutputAmount(), 1e-9)
+	assert.InDelta(t, 0.5, statement.Total.TotalCacheAmount(), 1e-9)
+	assert.InDelta(t, 0.25, statement.Total.WebSearchAmount, 1e-9)
+
+	require.Len(t, statement.Lines, 3)
+	assert.Equal(t, "alpha", statement.Lines[0].TokenName)
+	assert.Equal(t, "gpt-4o", statement.Lines[0].Model)
+	assert.Equal(t, model.StatementUnknownMode, statement.Lines[0].Mode)
+	assert.Equal(t, int64(3), statement.Lines[0].RequestCount)
+	assert.Equal(t, "embed", statement.Lines[1].Model)
+
+	require.Len(t, statement.Models, 2)
+	assert.Equal(t, "gpt-4o", statement.Models[0].Name)
+	assert.InDelta(t, 9.75, statement.Models[0].UsedAmount, 1e-9)
+
+	require.Len(t, statement.Tokens, 2)
+	assert.Equal(t, "alpha", statement.Tokens[0].Name)
+	assert.InDelta(t, 5.75, statement.Tokens[0].UsedAmount, 1e-9)
+
+	require.Len(t, statement.Modes, 1)
+	assert.Equal(t, int64(8), statement.Modes[0].RequestCount)
+
+	_, err = model.GetGroupStatement("g", end, start)
+	require.Error(t, err)
+}
+
+func TestGetGroupStatementSplitsModes(t *testing.T) {
+	setupStatementTestDB(t)
+
+	start := time.Date(2026, time.March, 1, 0, 0, 0, 0, time.UTC)
+
+	for _, m := range []mode.Mode{mode.ChatCompletions, mode.Responses} {
+		data := model.SummaryData{}
+		data.RequestCount = 1
+		data.UsedAmount = 1
+
+		require.NoError(t, model.UpsertGroupSummary(model.GroupSummaryUnique{
+			GroupID:       "g",
+			TokenName:     "alpha",
+			Model:         "gpt-4o",
+			Mode:          int(m),
+			HourTimestamp: start.Unix(),
+		}, data))
+	}
+
+	statement, err := model.GetGroupStatement("g", start, start.Add(time.Hour))
+	require.NoError(t, err)
+
+	require.Len(t, statement.Lines, 2)
+	assert.Equal(t, mode.ChatCompletions.String(), statement.Lines[0].Mode)
+	assert.Equal(t, mode.Responses.String(), statement.Lines[1].Mode)
+
+	require.Len(t, statement.Modes, 2)
+	assert.Equal(t, int64(2), statement.Total.RequestCount)
+}
+
+type legacyGroupSummary struct {
+	ID            int    `gorm:"primaryKey"`
+	GroupID       string `gorm:"size:64;not null;uniqueIndex:idx_groupsummary_unique,priority:1"`
+	TokenName     string `gorm:"size:32;not null;uniqueIndex:idx_groupsummary_unique,priority:2"`
+	Model         string `gorm:"size:128;not null;uniqueIndex:idx_groupsummary_unique,priority:3"`
+	HourTimestamp int64  `gorm:"not null;uniqueIndex:idx_groupsummary_unique,priority:4,sort:desc"`
+	RequestCount  int64
+}
+
+func (legacyGroupSummary) TableName() string {
+	return "group_summaries"
+}
+
+func TestDropLegacyGroupSummaryUniqueIndex(t *testing.T) {
+	testDB, err := model.OpenSQLite(filepath.Join(t.TempDir(), "legacy.db"))
+	require.NoError(t, err)
+
+	prevLogDB := model.LogDB
+	model.LogDB = testDB
+
+	t.Cleanup(func() {
+		model.LogDB = prevLogDB
+	})
+
+	start := time.Date(2026, time.March, 1, 0, 0, 0, 0, time.UTC)
+
+	require.NoError(t, testDB.AutoMigrate(&legacyGroupSummary{}))
+	require.NoError(t, testDB.Create(&legacyGroupSummary{
+		GroupID:       "g",
+		TokenName:     "alpha",
+		Model:         "gpt-4o",
+		HourTimestamp: start.Unix(),
+		RequestCount:  3,
+	}).Error)
+
+	require.NoError(t, testDB.AutoMigrate(&model.GroupSummary{}))
+	require.NoError(t, model.DropLegacyGroupSummaryUniqueIndex(testDB))
+	// dropping again is a no-op on the next start
+	require.NoError(t, model.DropLegacyGroupSummaryUniqueIndex(testDB))
+
+	migrator := testDB.Migrator()
+	assert.False(t, migrator.HasIndex(&model.GroupSummary{}, "idx_groupsummary_unique"))
+	assert.True(t, migrator.HasIndex(&model.GroupSummary{}, "idx_groupsummary_mode_unique"))
+
+	for _, m := range []mode.Mode{mode.ChatCompletions, mode.Responses} {
+		data := model.SummaryData{}
+		data.RequestCount = 1
+
+		require.NoError(t, model.UpsertGroupSummary(model.GroupSummaryUnique{
+			GroupID:       "g",
+			TokenName:     "alpha",
+			Model:         "gpt-4o",
+			Mode:          int(m),
+			HourTimestamp: start.Unix(),
+		}, data))
+	}
+
+	statement, err := model.GetGroupStatement("g", start, start.Add(time.Hour))
+	require.NoError(t, err)
+
+	// the legacy row is kept with the unknown mode
+	require.Len(t, statement.Lines, 3)
+	assert.Equal(t, int64(5), statement.Total.RequestCount)
+}
+
+func TestGetGroupStatementAlignsHours(t *testing.T) {
+	setupStatementTestDB(t)
+
+	hour := time.Date(2026, time.March, 1, 10, 0, 0, 0, time.UTC)
+
+	upsertStatementSummary(t, "g", "alpha", "gpt-4o", hour, 1, 1, 0, 0, 0)
+	upsertStatementSummary(t, "g", "alpha", "gpt-4o", hour.Add(time.Hour), 2, 1, 0, 0, 0)
+
+	statement, err := model.GetGroupStatement(
+		"g",
+		hour.Add(30*time.Minute),
+		hour.Add(90*time.Minute),
+	)
+	require.NoError(t, err)
+
+	assert.Equal(t, hour, statement.Start)
+	assert.Equal(t, hour.Add(2*time.Hour), statement.End)
+	assert.Equal(t, int64(3), statement.Total.RequestCount)
+}
+
+func TestGetGroupStatementAlignsHoursInLocation(t *testing.T) {
+	setupStatementTestDB(t)
+
+	kolkata, err := time.LoadLocation("Asia/Kolkata")
+	require.NoError(t, err)
+
+	// the month starts at 18:30 UTC, between two hourly summaries
+	start := time.Date(2026, time.March, 1, 0, 0, 0, 0, kolkata)
+	before := time.Date(2026, time.February, 28, 18, 0, 0, 0, time.UTC)
+
+	upsertStatementSummary(t, "g", "alpha", "gpt-4o", before, 1, 1, 0, 0, 0)
+	upsertStatementSummary(t, "g", "alpha", "gpt-4o", before.Add(time.Hour), 2, 1, 0, 0, 0)
+
+	statement, err := model.GetGroupStatement("g", start, start.AddDate(0, 1, 0))
+	require.NoError(t, err)
+
+	assert.True(t, start.Equal(statement.Start), statement.Start)
+	assert.True(t, start.AddDate(0, 1, 0).Equal(statement.End), statement.End)
+	assert.Equal(t, int64(2), statement.Total.RequestCount)
+
+	statement, err = model.GetGroupStatement(
+		"g",
+		start.Add(-time.Hour),
+		start.Add(10*time.Minute),
+	)
+	require.NoError(t, err)
+
+	assert.True(t, start.Add(-time.Hour).Equal(statement.Start), statement.Start)
+	assert.True(t, start.Add(time.Hour).Equal(statement.End), statement.End)
+	assert.Equal(t, int64(3), statement.Total.RequestCount)
+}
@@ -22,6 +22,8 @@ const (
 	StorePrefixVideoJob        = "video_job"
 	StorePrefixVideoGeneration = "video_generation"
 	StorePrefixGeminiFile      = "gemini_file"
+	StorePrefixFile            = "file"
+	StorePrefixBatch           = "batch"
 	StorePrefixPromptCacheKey  = "prompt_cache_key"
 	StorePrefixCacheFollow     = "cachefollow"
 	StorePrefixCacheFollowUser = "cachefollow_user"
@@ -341,6 +343,66 @@ func GeminiFileStoreID(fileID string) string {
 	return StoreID(StorePrefixGeminiFile, fileID)
 }
 
+func FileStoreID(fileID string) string {
+	return StoreID(StorePrefixFile, fileID)
+}
+
+func BatchStoreID(batchID string) string {
+	return StoreID(StorePrefixBatch, batchID)
+}
+
+// GetStoresByPrefix returns the unexpired stores of a group token whose id starts with prefix,
+// ordered by created time. If after is not empty, only the stores after that store id are returned.
+func GetStoresByPrefix(
+	group string,
+	tokenID int,
+	prefix string,
+	after string,
+	limit int,
+	asc bool,
+) ([]*StoreV2, error) {
+	tx := LogDB.
+		Where("group_id = ? and token_id = ? and expires_at > ?", group, tokenID, time.Now()).
+		Where("id LIKE ?", StoreID(prefix, "%"))
+
+	if after != "" {
+		afterStore, err := GetStore(group, tokenID, StoreID(prefix, after))
+		if err != nil {
+			return nil, err
+		}
+
+		if asc {
+			tx = tx.Where(
+				"(created_at > ? or (created_at = ? and id > ?))",
+				afterStore.CreatedAt,
+				afterStore.CreatedAt,
+				afterStore.ID,
+			)
+		} else {
+			tx = tx.Where(
+				"(created_at < ? or (created_at = ? and id < ?))",
+				afterStore.CreatedAt,
+				afterStore.CreatedAt,
+				afterStore.ID,
+			)
+		}
+	}
+
+	if asc {
+		tx = tx.Order("created_at asc, id asc")
+	} else {
+		tx = tx.Order("created_at desc, id desc")
+	}
+
+	if limit > 0 {
+		tx = tx.Limit(limit)
+	}
+
+	var stores []*StoreV2
+
+	return stores, tx.Find(&stores).Error
+}
+
 func PromptCacheStoreID(modelName, promptCacheKey string, keyType CacheKeyType) string {
 	return HashedStoreID(StorePrefixPromptCacheKey, string(keyType), modelName, promptCacheKey)
 }
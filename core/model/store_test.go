@@ -72,6 +72,62 @@ func TestGetStoreIgnoresExpired(t *testing.T) {
 	})
 }
 
+func TestGetStoresByPrefix(t *testing.T) {
+	withTestStoreDB(t, func() {
+		now := time.Now()
+
+		for i, id := range []string{"file-a", "file-b", "file-c"} {
+			_, err := SaveStore(&StoreV2{
+				ID:        FileStoreID(id),
+				GroupID:   "group-1",
+				TokenID:   1,
+				ChannelID: 10,
+				CreatedAt: now.Add(time.Duration(i) * time.Second),
+				ExpiresAt: now.Add(time.Hour),
+			})
+			require.NoError(t, err)
+		}
+
+		_, err := SaveStore(&StoreV2{
+			ID:        FileStoreID("file-expired"),
+			GroupID:   "group-1",
+			TokenID:   1,
+			ChannelID: 10,
+			ExpiresAt: now.Add(-time.Minute),
+		})
+		require.NoError(t, err)
+
+		_, err = SaveStore(&StoreV2{
+			ID:        ResponseStoreID("resp_1"),
+			GroupID:   "group-1",
+			TokenID:   1,
+			ChannelID: 10,
+			ExpiresAt: now.Add(time.Hour),
+		})
+		require.NoError(t, err)
+
+		_, err = SaveStore(&StoreV2{
+			ID:        FileStoreID("file-other-token"),
+			GroupID:   "group-1",
+			TokenID:   2,
+			ChannelID: 10,
+			ExpiresAt: now.Add(time.Hour),
+		})
+		require.NoError(t, err)
+
+		stores, err := GetStoresByPrefix("group-1", 1, StorePrefixFile, "", 0, false)
+		require.NoError(t, err)
+		require.Len(t, stores, 3)
+		assert.Equal(t, FileStoreID("file-c"), stores[0].ID)
+		assert.Equal(t, FileStoreID("file-a"), stores[2].ID)
+
+		stores, err = GetStoresByPrefix("group-1", 1, StorePrefixFile, "file-a", 1, true)
+		require.NoError(t, err)
+		require.Len(t, stores, 1)
+		assert.Equal(t, FileStoreID("file-b"), stores[0].ID)
+	})
+}
+
 func TestSaveIfNotExistStoreReplacesExpiredStore(t *testing.T) {
 	withTestStoreDB(t, func() {
 		storeID := PromptCacheStoreID("gpt-5", "cache-key", CacheKeyTypeStable)
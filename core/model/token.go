@@ -49,6 +49,24 @@ type Token struct {
 	PeriodType             EmptyNullString `json:"period_type"               gorm:"size:20"` // daily, weekly, monthly, default is monthly
 	PeriodLastUpdateTime   time.Time       `json:"period_last_update_time"`                  // Last time period was reset
 	PeriodLastUpdateAmount float64         `json:"period_last_update_amount"`                // Total usage at last period reset
+
+	// ActivateAt is the time the token starts to work, zero means immediately
+	ActivateAt time.Time `json:"activate_at"`
+	// ExpiredAt is the time the token stops working, zero means never
+	ExpiredAt time.Time `json:"expired_at"  gorm:"index"`
+
+	// PreviousKey keeps working until PreviousKeyExpiredAt after the key is rotated
+	PreviousKey          string    `json:"previous_key,omitempty" gorm:"size:48;index"`
+	PreviousKeyExpiredAt time.Time `json:"previous_key_expired_at"`
+
+	// RPM, TPM and MaxConcurrency limit the token across all models on top of
+	// the group limits, 0 means unlimited
+	RPM            int64 `json:"rpm"`
+	TPM            int64 `json:"tpm"`
+	MaxConcurrency int64 `json:"max_concurrency"`
+
+	// MCPACL restricts the mcps and the tools the token can use
+	MCPACL MCPACL `json:"mcp_acl" gorm:"column:mcp_acl;serializer:fastjson;type:text"`
 }
 
 func (t *Token) BeforeCreate(_ *gorm.DB) error {
@@ -67,9 +85,41 @@ func (t *Token) BeforeSave(_ *gorm.DB) error {
 	if len(t.Name) > 32 {
 		return errors.New("token name is too long")
 	}
+
+	if t.RPM < 0 || t.TPM < 0 || t.MaxConcurrency < 0 {
+		return errors.New("token rpm, tpm and max_concurrency must not be negative")
+	}
+
+	if !t.ActivateAt.IsZero() && !t.ExpiredAt.IsZero() && !t.ExpiredAt.After(t.ActivateAt) {
+		return errors.New("token expired_at must be after activate_at")
+	}
+
+	if err := t.MCPACL.Validate(); err != nil {
+		return fmt.Errorf("token %w", err)
+	}
+
 	return nil
 }
 
+// cachedKeys returns the keys the token may be cached by
+func (t *Token) cachedKeys() []string {
+	if t.PreviousKey == "" {
+		return []string{t.Key}
+	}
+
+	return []string{t.Key, t.PreviousKey}
+}
+
+func cacheDeleteTokenKeys(tokens ...Token) {
+	for _, token := range tokens {
+		for _, key := range token.cachedKeys() {
+			if err := CacheDeleteToken(key); err != nil {
+				log.Error("delete token from cache failed: " + err.Error())
+			}
+		}
+	}
+}
+
 // GetEffectiveQuotaStatus returns the effective quota status for token
 func (t *Token) GetEffectiveQuotaStatus() (totalExceeded, periodExceeded bool, err error) {
 	// Check total quota (if set)
@@ -174,6 +224,27 @@ func getTokenOrder(order string) string {
 	}
 }
 
+// checkGroupMaxTokenNum returns an error when the group can't have another token
+func checkGroupMaxTokenNum(tx *gorm.DB, groupID string) error {
+	maxTokenNum := config.GetGroupMaxTokenNum()
+	if maxTokenNum <= 0 {
+		return nil
+	}
+
+	var count int64
+
+	err := tx.Model(&Token{}).Where("group_id = ?", groupID).Count(&count).Error
+	if err != nil {
+		return err
+	}
+
+	if count >= maxTokenNum {
+		return errors.New("group max token num reached")
+	}
+
+	return nil
+}
+
 func InsertToken(token *Token, autoCreateGroup, ignoreExist bool) error {
 	if autoCreateGroup {
 		group := &Group{
@@ -184,20 +255,9 @@ func InsertToken(token *Token, autoCreateGroup, ignoreExist bool) error {
 		}
 	}
 
-	maxTokenNum := config.GetGroupMaxTokenNum()
-
 	err := DB.Transaction(func(tx *gorm.DB) error {
-		if maxTokenNum > 0 {
-			var count int64
-
-			err := tx.Model(&Token{}).Where("group_id = ?", token.GroupID).Count(&count).Error
-			if err != nil {
-				return err
-			}
-
-			if count >= maxTokenNum {
-				return errors.New("group max token num reached")
-			}
+		if err := checkGroupMaxTokenNum(tx, token.GroupID); err != nil {
+			return err
 		}
 
 		if ignoreExist {
@@ -431,6 +491,21 @@ func GetTokenByKey(key string) (*Token, error) {
 	return &token, HandleNotFound(err, ErrTokenNotFound)
 }
 
+// GetTokenByPreviousKey returns the token whose rotated key is still in its grace period
+func GetTokenByPreviousKey(key string) (*Token, error) {
+	if key == "" {
+		return nil, errors.New("key is empty")
+	}
+
+	var token Token
+
+	err := DB.
+		Where("previous_key = ? and previous_key_expired_at > ?", key, time.Now()).
+		First(&token).Error
+
+	return &token, HandleNotFound(err, ErrTokenNotFound)
+}
+
 // GetAndValidateToken validates a token and checks quota limits
 // This function is safe for concurrent use and handles period resets atomically
 func GetAndValidateToken(key string) (token *TokenCache, err error) {
@@ -453,6 +528,21 @@ func GetAndValidateToken(key string) (token *TokenCache, err error) {
 		return nil, fmt.Errorf("token (%s[%d]) is disabled", token.Name, token.ID)
 	}
 
+	now := time.Now()
+
+	if keyExpiredAt := time.Time(token.KeyExpiredAt); !keyExpiredAt.IsZero() &&
+		!now.Before(keyExpiredAt) {
+		return nil, fmt.Errorf("token (%s[%d]) key has been rotated", token.Name, token.ID)
+	}
+
+	if activateAt := time.Time(token.ActivateAt); !activateAt.IsZero() && now.Before(activateAt) {
+		return nil, fmt.Errorf("token (%s[%d]) is not active yet", token.Name, token.ID)
+	}
+
+	if expiredAt := time.Time(token.ExpiredAt); !expiredAt.IsZero() && !now.Before(expiredAt) {
+		return nil, fmt.Errorf("token (%s[%d]) has expired", token.Name, token.ID)
+	}
+
 	// Convert TokenCache to Token for quota checking
 	tokenModel := Token{
 		ID:                     token.ID,
@@ -508,9 +598,7 @@ func UpdateTokenStatus(id, status int) (err error) {
 	token := Token{ID: id}
 	defer func() {
 		if err == nil {
-			if err := CacheUpdateTokenStatus(token.Key, status); err != nil {
-				log.Error("update token status in cache failed: " + err.Error())
-			}
+			cacheUpdateTokenStatus(&token, status)
 		}
 	}()
 
@@ -519,6 +607,7 @@ func UpdateTokenStatus(id, status int) (err error) {
 		Clauses(clause.Returning{
 			Columns: []clause.Column{
 				{Name: "key"},
+				{Name: "previous_key"},
 			},
 		}).
 		Where("id = ?", id).
@@ -539,9 +628,7 @@ func UpdateGroupTokenStatus(group string, id, status int) (err error) {
 	token := Token{}
 	defer func() {
 		if err == nil {
-			if err := CacheUpdateTokenStatus(token.Key, status); err != nil {
-				log.Error("update token status in cache failed: " + err.Error())
-			}
+			cacheUpdateTokenStatus(&token, status)
 		}
 	}()
 
@@ -550,6 +637,7 @@ func UpdateGroupTokenStatus(group string, id, status int) (err error) {
 		Clauses(clause.Returning{
 			Columns: []clause.Column{
 				{Name: "key"},
+				{Name: "previous_key"},
 			},
 		}).
 		Where("id = ? and group_id = ?", id, group).
@@ -562,6 +650,14 @@ func UpdateGroupTokenStatus(group string, id, status int) (err error) {
 	return HandleUpdateResult(result, ErrTokenNotFound)
 }
 
+func cacheUpdateTokenStatus(token *Token, status int) {
+	for _, key := range token.cachedKeys() {
+		if err := CacheUpdateTokenStatus(key, status); err != nil {
+			log.Error("update token status in cache failed: " + err.Error())
+		}
+	}
+}
+
 func DeleteGroupTokenByID(groupID string, id int) (err error) {
 	if id == 0 || groupID == "" {
 		return errors.New("id or group is empty")
@@ -570,9 +666,7 @@ func DeleteGroupTokenByID(groupID string, id int) (err error) {
 	token := Token{ID: id, GroupID: groupID}
 	defer func() {
 		if err == nil {
-			if err := CacheDeleteToken(token.Key); err != nil {
-				log.Error("delete token from cache failed: " + err.Error())
-			}
+			cacheDeleteTokenKeys(token)
 		}
 	}()
 
@@ -580,6 +674,7 @@ func DeleteGroupTokenByID(groupID string, id int) (err error) {
 		Clauses(clause.Returning{
 			Columns: []clause.Column{
 				{Name: "key"},
+				{Name: "previous_key"},
 			},
 		}).
 		Where(token).
@@ -600,11 +695,7 @@ func DeleteGroupTokensByIDs(group string, ids []int) (err error) {
 	tokens := make([]Token, len(ids))
 	defer func() {
 		if err == nil {
-			for _, token := range tokens {
-				if err := CacheDeleteToken(token.Key); err != nil {
-					log.Error("delete token from cache failed: " + err.Error())
-				}
-			}
+			cacheDeleteTokenKeys(tokens...)
 		}
 	}()
 
@@ -613,6 +704,7 @@ func DeleteGroupTokensByIDs(group string, ids []int) (err error) {
 			Clauses(clause.Returning{
 				Columns: []clause.Column{
 					{Name: "key"},
+					{Name: "previous_key"},
 				},
 			}).
 			Where("group_id = ?", group).
@@ -630,9 +722,7 @@ func DeleteTokenByID(id int) (err error) {
 	token := Token{ID: id}
 	defer func() {
 		if err == nil {
-			if err := CacheDeleteToken(token.Key); err != nil {
-				log.Error("delete token from cache failed: " + err.Error())
-			}
+			cacheDeleteTokenKeys(token)
 		}
 	}()
 
@@ -640,6 +730,7 @@ func DeleteTokenByID(id int) (err error) {
 		Clauses(clause.Returning{
 			Columns: []clause.Column{
 				{Name: "key"},
+				{Name: "previous_key"},
 			},
 		}).
 		Where(token).
@@ -656,11 +747,7 @@ func DeleteTokensByIDs(ids []int) (err error) {
 	tokens := make([]Token, len(ids))
 	defer func() {
 		if err == nil {
-			for _, token := range tokens {
-				if err := CacheDeleteToken(token.Key); err != nil {
-					log.Error("delete token from cache failed: " + err.Error())
-				}
-			}
+			cacheDeleteTokenKeys(tokens...)
 		}
 	}()
 
@@ -669,6 +756,7 @@ func DeleteTokensByIDs(ids []int) (err error) {
 			Clauses(clause.Returning{
 				Columns: []clause.Column{
 					{Name: "key"},
+					{Name: "previous_key"},
 				},
 			}).
 			Where("id IN (?)", ids).
@@ -687,6 +775,81 @@ type UpdateTokenRequest struct {
 	PeriodQuota          *float64 `json:"period_quota"`
 	PeriodType           *string  `json:"period_type"`
 	PeriodLastUpdateTime *int64   `json:"period_last_update_time"`
+	// ActivateAt and ExpiredAt are unix milliseconds, 0 clears them
+	ActivateAt *int64 `json:"activate_at"`
+	ExpiredAt  *int64 `json:"expired_at"`
+	// RPM, TPM and MaxConcurrency are the token limits, 0 removes them
+	RPM            *int64 `json:"rpm"`
+	TPM            *int64 `json:"tpm"`
+	MaxConcurrency *int64 `json:"max_concurrency"`
+	// MCPACL replaces the mcp acl of the token
+	MCPACL *MCPACL `json:"mcp_acl"`
+}
+
+func unixMilliTime(ms int64) time.Time {
+	if ms <= 0 {
+		return time.Time{}
+	}
+
+	return time.UnixMilli(ms)
+}
+
+// applyValidity sets the activation and expiration of the update on the token,
+// they are validated together with the ones already saved
+func (u *UpdateTokenRequest) applyValidity(
+	current, token *Token,
+	selects []string,
+) ([]string, error) {
+	activateAt := current.ActivateAt
+	expiredAt := current.ExpiredAt
+
+	if u.ActivateAt != nil {
+		activateAt = unixMilliTime(*u.ActivateAt)
+		token.ActivateAt = activateAt
+
+		selects = append(selects, "activate_at")
+	}
+
+	if u.ExpiredAt != nil {
+		expiredAt = unixMilliTime(*u.ExpiredAt)
+		token.ExpiredAt = expiredAt
+
+		selects = append(selects, "expired_at")
+	}
+
+	if !activateAt.IsZero() && !expiredAt.IsZero() && !expiredAt.After(activateAt) {
+		return nil, errors.New("token expired_at must be after activate_at")
+	}
+
+	return selects, nil
+}
+
+func (u *UpdateTokenRequest) applyLimits(token *Token, selects []string) []string {
+	if u.RPM != nil {
+		token.RPM = *u.RPM
+
+		selects = append(selects, "rpm")
+	}
+
+	if u.TPM != nil {
+		token.TPM = *u.TPM
+
+		selects = append(selects, "tpm")
+	}
+
+	if u.MaxConcurrency != nil {
+		token.MaxConcurrency = *u.MaxConcurrency
+
+		selects = append(selects, "max_concurrency")
+	}
+
+	if u.MCPACL != nil {
+		token.MCPACL = *u.MCPACL
+
+		selects = append(selects, "mcp_acl")
+	}
+
+	return selects
 }
 
 func UpdateToken(id int, update UpdateTokenRequest) (token *Token, err error) {
@@ -707,9 +870,7 @@ func UpdateToken(id int, update UpdateTokenRequest) (token *Token, err error) {
 
 	defer func() {
 		if err == nil {
-			if err := CacheDeleteToken(token.Key); err != nil {
-				log.Error("delete token from cache failed: " + err.Error())
-			}
+			cacheDeleteTokenKeys(*token)
 		}
 	}()
 
@@ -769,6 +930,13 @@ func UpdateToken(id int, update UpdateTokenRequest) (token *Token, err error) {
 		selects = append(selects, "status")
 	}
 
+	selects, err = update.applyValidity(currentToken, token, selects)
+	if err != nil {
+		return nil, err
+	}
+
+	selects = update.applyLimits(token, selects)
+
 	if len(selects) == 0 {
 		return nil, errors.New("empty update request")
 	}
@@ -810,9 +978,7 @@ func UpdateGroupToken(
 
 	defer func() {
 		if err == nil {
-			if err := CacheDeleteToken(token.Key); err != nil {
-				log.Error("delete token from cache failed: " + err.Error())
-			}
+			cacheDeleteTokenKeys(*token)
 		}
 	}()
 
@@ -872,6 +1038,13 @@ func UpdateGroupToken(
 		selects = append(selects, "status")
 	}
 
+	selects, err = update.applyValidity(currentToken, token, selects)
+	if err != nil {
+		return nil, err
+	}
+
+	selects = update.applyLimits(token, selects)
+
 	if len(selects) == 0 {
 		return nil, errors.New("empty update request")
 	}
@@ -890,15 +1063,104 @@ func UpdateGroupToken(
 	return token, HandleUpdateResult(result, ErrTokenNotFound)
 }
 
+// RotateToken issues a new key for the token without losing its usage, the
+// current key keeps working during the grace period so clients can switch over
+func RotateToken(id int, gracePeriod time.Duration) (*Token, error) {
+	if id == 0 {
+		return nil, errors.New("id is empty")
+	}
+
+	return rotateToken(func(tx *gorm.DB) *gorm.DB {
+		return tx.Where("id = ?", id)
+	}, gracePeriod)
+}
+
+func RotateGroupToken(group string, id int, gracePeriod time.Duration) (*Token, error) {
+	if id == 0 || group == "" {
+		return nil, errors.New("id or group is empty")
+	}
+
+	return rotateToken(func(tx *gorm.DB) *gorm.DB {
+		return tx.Where("id = ? and group_id = ?", id, group)
+	}, gracePeriod)
+}
+
+func rotateToken(where func(tx *gorm.DB) *gorm.DB, gracePeriod time.Duration) (*Token, error) {
+	token := &Token{}
+
+	var oldKeys []string
+
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		if err := where(tx).
+			Clauses(clause.Locking{Strength: "UPDATE"}).
+			First(token).Error; err != nil {
+			return HandleNotFound(err, ErrTokenNotFound)
+		}
+
+		oldKeys = token.cachedKeys()
+
+		// a key rotated earlier stops working as soon as the token is rotated again
+		token.PreviousKey = ""
+		token.PreviousKeyExpiredAt = time.Time{}
+
+		if gracePeriod > 0 {
+			token.PreviousKey = token.Key
+			token.PreviousKeyExpiredAt = time.Now().Add(gracePeriod)
+		}
+
+		token.Key = generateKey()
+
+		return tx.
+			Model(token).
+			Select("key", "previous_key", "previous_key_expired_at").
+			Updates(token).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for _, key := range oldKeys {
+		if err := CacheDeleteToken(key); err != nil {
+			log.Error("delete token from cache failed: " + err.Error())
+		}
+	}
+
+	return token, nil
+}
+
+// DisableExpiredTokens disables the enabled tokens whose expiration has passed
+// and returns them
+func DisableExpiredTokens() (tokens []Token, err error) {
+	defer func() {
+		if err == nil {
+			for i := range tokens {
+				cacheUpdateTokenStatus(&tokens[i], TokenStatusDisabled)
+			}
+		}
+	}()
+
+	err = DB.
+		Model(&tokens).
+		Clauses(clause.Returning{}).
+		Where("status = ?", TokenStatusEnabled).
+		Where("expired_at > ? and expired_at <= ?", time.Time{}, time.Now()).
+		Update("status", TokenStatusDisabled).
+		Error
+
+	return tokens, err
+}
+
 func UpdateTokenUsedAmount(id int, amount float64, requestCount int) (err error) {
 	token := &Token{}
 	defer func() {
 		if amount > 0 && err == nil && (token.Quota > 0 || token.PeriodQuota > 0) {
-			if err := CacheUpdateTokenUsedAmountOnlyIncrease(
-				token.Key,
-				token.UsedAmount,
-			); err != nil {
-				log.Error("update token used amount in cache failed: " + err.Error())
+			for _, key := range token.cachedKeys() {
+				if err := CacheUpdateTokenUsedAmountOnlyIncrease(
+					key,
+					token.UsedAmount,
+				); err != nil {
+					log.Error("update token used amount in cache failed: " + err.Error())
+				}
 			}
 		}
 	}()
@@ -908,6 +1170,7 @@ func UpdateTokenUsedAmount(id int, amount float64, requestCount int) (err error)
 		Clauses(clause.Returning{
 			Columns: []clause.Column{
 				{Name: "key"},
+				{Name: "previous_key"},
 				{Name: "quota"},
 				{Name: "used_amount"},
 				{Name: "period_quota"},
@@ -1058,12 +1321,14 @@ func ResetTokenPeriodUsage(id int) error {
 
 	// Update cache only if database update succeeded
 	if err == nil && token.Key != "" && !newPeriodStartTime.IsZero() {
-		if cacheErr := CacheResetTokenPeriodUsage(
-			token.Key,
-			newPeriodStartTime,
-			token.UsedAmount,
-		); cacheErr != nil {
-			log.Error("reset token period usage in cache failed: " + cacheErr.Error())
+		for _, key := range token.cachedKeys() {
+			if cacheErr := CacheResetTokenPeriodUsage(
+				key,
+				newPeriodStartTime,
+				token.UsedAmount,
+			); cacheErr != nil {
+				log.Error("reset token period usage in cache failed: " + cacheErr.Error())
+			}
 		}
 	}
 
@@ -1074,8 +1339,10 @@ func UpdateTokenName(id int, name string) (err error) {
 	token := &Token{ID: id}
 	defer func() {
 		if err == nil {
-			if err := CacheUpdateTokenName(token.Key, name); err != nil {
-				log.Error("update token name in cache failed: " + err.Error())
+			for _, key := range token.cachedKeys() {
+				if err := CacheUpdateTokenName(key, name); err != nil {
+					log.Error("update token name in cache failed: " + err.Error())
+				}
 			}
 		}
 	}()
@@ -1085,6 +1352,7 @@ func UpdateTokenName(id int, name string) (err error) {
 		Clauses(clause.Returning{
 			Columns: []clause.Column{
 				{Name: "key"},
+				{Name: "previous_key"},
 			},
 		}).
 		Where("id = ?", id).
@@ -1100,8 +1368,10 @@ func UpdateGroupTokenName(group string, id int, name string) (err error) {
 	token := &Token{ID: id, GroupID: group}
 	defer func() {
 		if err == nil {
-			if err := CacheUpdateTokenName(token.Key, name); err != nil {
-				log.Error("update token name in cache failed: " + err.Error())
+			for _, key := range token.cachedKeys() {
+				if err := CacheUpdateTokenName(key, name); err != nil {
+					log.Error("update token name in cache failed: " + err.Error())
+				}
 			}
 		}
 	}()
@@ -1111,6 +1381,7 @@ func UpdateGroupTokenName(group string, id int, name string) (err error) {
 		Clauses(clause.Returning{
 			Columns: []clause.Column{
 				{Name: "key"},
+				{Name: "previous_key"},
 			},
 		}).
 		Where("id = ? and group_id = ?", id, group).
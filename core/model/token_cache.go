@@ -42,6 +42,18 @@ type TokenCache struct {
 	PeriodLastUpdateTime   redisTime `json:"period_last_update_time"   redis:"plut"`
 	PeriodLastUpdateAmount float64   `json:"period_last_update_amount" redis:"plua"`
 
+	ActivateAt redisTime `json:"activate_at" redis:"aa"`
+	ExpiredAt  redisTime `json:"expired_at"  redis:"ea"`
+	// KeyExpiredAt is set when the cache is loaded by a rotated key, the key
+	// stops working at that time
+	KeyExpiredAt redisTime `json:"-" redis:"kea"`
+
+	RPM            int64 `json:"rpm"             redis:"rpm"`
+	TPM            int64 `json:"tpm"             redis:"tpm"`
+	MaxConcurrency int64 `json:"max_concurrency" redis:"mc"`
+
+	MCPACL MCPACL `json:"mcp_acl" redis:"acl"`
+
 	availableSets []string
 	modelsBySet   map[string][]string
 }
@@ -141,7 +153,40 @@ func (t *Token) ToTokenCache() *TokenCache {
 		PeriodType:             string(t.PeriodType),
 		PeriodLastUpdateTime:   redisTime(t.PeriodLastUpdateTime),
 		PeriodLastUpdateAmount: t.PeriodLastUpdateAmount,
+
+		ActivateAt: redisTime(t.ActivateAt),
+		ExpiredAt:  redisTime(t.ExpiredAt),
+
+		RPM:            t.RPM,
+		TPM:            t.TPM,
+		MaxConcurrency: t.MaxConcurrency,
+
+		MCPACL: t.MCPACL,
+	}
+}
+
+// getTokenCacheByKey loads the token by its key, or by its rotated key during
+// the grace period
+func getTokenCacheByKey(key string) (*TokenCache, error) {
+	token, err := GetTokenByKey(key)
+	if err == nil {
+		return token.ToTokenCache(), nil
 	}
+
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+
+	token, err = GetTokenByPreviousKey(key)
+	if err != nil {
+		return nil, err
+	}
+
+	tc := token.ToTokenCache()
+	tc.Key = key
+	tc.KeyExpiredAt = redisTime(token.PreviousKeyExpiredAt)
+
+	return tc, nil
 }
 
 func CacheDeleteToken(key string) error {
@@ -196,7 +241,7 @@ func CacheGetTokenByKey(key string) (*TokenCache, error) {
 			return cacheGetModelLocal(cacheKey, cloneTokenCache)
 		},
 		func() (*TokenCache, error) {
-			token, err := GetTokenByKey(key)
+			tc, err := getTokenCacheByKey(key)
 			if err != nil {
 				if errors.Is(err, gorm.ErrRecordNotFound) {
 					cacheSetModelNotFoundLocalUnlocked(cacheKey)
@@ -205,7 +250,6 @@ func CacheGetTokenByKey(key string) (*TokenCache, error) {
 				return nil, err
 			}
 
-			tc := token.ToTokenCache()
 			cacheSetModelLocalUnlocked(cacheKey, tc, cloneTokenCache)
 
 			return tc, nil
@@ -0,0 +1,201 @@
+package model_test
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/labring/aiproxy/core/common"
+	"github.com/labring/aiproxy/core/model"
+	"github.com/stretchr/testify/require"
+)
+
+func setupTokenTestDB(t *testing.T) {
+	t.Helper()
+
+	prevDB := model.DB
+	prevUsingSQLite := common.UsingSQLite
+
+	testDB, err := model.OpenSQLite(filepath.Join(t.TempDir(), "token.db"))
+	require.NoError(t, err)
+
+	model.DB = testDB
+	common.UsingSQLite = true
+
+	t.Cleanup(func() {
+		model.DB = prevDB
+		common.UsingSQLite = prevUsingSQLite
+	})
+
+	require.NoError(t, testDB.AutoMigrate(&model.Group{}, &model.Token{}))
+}
+
+func TestGetAndValidateTokenValidity(t *testing.T) {
+	setupTokenTestDB(t)
+
+	now := time.Now()
+
+	pending := &model.Token{
+		GroupID:    "group",
+		Name:       "pending",
+		ActivateAt: now.Add(time.Hour),
+	}
+	require.NoError(t, model.InsertToken(pending, true, false))
+
+	expired := &model.Token{
+		GroupID:   "group",
+		Name:      "expired",
+		ExpiredAt: now.Add(-time.Minute),
+	}
+	require.NoError(t, model.InsertToken(expired, true, false))
+
+	valid := &model.Token{
+		GroupID:    "group",
+		Name:       "valid",
+		ActivateAt: now.Add(-time.Hour),
+		ExpiredAt:  now.Add(time.Hour),
+	}
+	require.NoError(t, model.InsertToken(valid, true, false))
+
+	_, err := model.GetAndValidateToken(pending.Key)
+	require.ErrorContains(t, err, "not active yet")
+
+	_, err = model.GetAndValidateToken(expired.Key)
+	require.ErrorContains(t, err, "has expired")
+
+	token, err := model.GetAndValidateToken(valid.Key)
+	require.NoError(t, err)
+	require.Equal(t, valid.ID, token.ID)
+
+	invalid := &model.Token{
+		GroupID:    "group",
+		Name:       "invalid",
+		ActivateAt: now.Add(time.Hour),
+		ExpiredAt:  now,
+	}
+	require.Error(t, model.InsertToken(invalid, true, false))
+}
+
+func TestRotateTokenWithGracePeriod(t *testing.T) {
+	setupTokenTestDB(t)
+
+	token := &model.Token{GroupID: "group", Name: "rotate"}
+	require.NoError(t, model.InsertToken(token, true, false))
+	require.NoError(t, model.UpdateTokenUsedAmount(token.ID, 1.5, 3))
+
+	oldKey := token.Key
+
+	// load the old key into the cache before rotating
+	_, err := model.GetAndValidateToken(oldKey)
+	require.NoError(t, err)
+
+	rotated, err := model.RotateGroupToken("group", token.ID, time.Hour)
+	require.NoError(t, err)
+	require.NotEqual(t, oldKey, rotated.Key)
+	require.Equal(t, oldKey, rotated.PreviousKey)
+	require.InDelta(t, 1.5, rotated.UsedAmount, 1e-9)
+	require.Equal(t, 3, rotated.RequestCount)
+
+	byNew, err := model.GetAndValidateToken(rotated.Key)
+	require.NoError(t, err)
+	require.Equal(t, token.ID, byNew.ID)
+
+	byOld, err := model.GetAndValidateToken(oldKey)
+	require.NoError(t, err)
+	require.Equal(t, token.ID, byOld.ID)
+
+	// disabling the token also disables the key in its grace period
+	require.NoError(t, model.UpdateTokenStatus(token.ID, model.TokenStatusDisabled))
+
+	_, err = model.GetAndValidateToken(oldKey)
+	require.ErrorContains(t, err, "disabled")
+
+	require.NoError(t, model.UpdateTokenStatus(token.ID, model.TokenStatusEnabled))
+
+	// rotating again without grace period revokes both previous keys
+	again, err := model.RotateToken(token.ID, 0)
+	require.NoError(t, err)
+	require.Empty(t, again.PreviousKey)
+
+	_, err = model.GetAndValidateToken(oldKey)
+	require.ErrorContains(t, err, "invalid token")
+
+	_, err = model.GetAndValidateToken(rotated.Key)
+	require.ErrorContains(t, err, "invalid token")
+
+	_, err = model.GetAndValidateToken(again.Key)
+	require.NoError(t, err)
+}
+
+func TestDisableExpiredTokens(t *testing.T) {
+	setupTokenTestDB(t)
+
+	now := time.Now()
+
+	expired := &model.Token{
+		GroupID:   "group",
+		Name:      "expired",
+		ExpiredAt: now.Add(-time.Minute),
+	}
+	require.NoError(t, model.InsertToken(expired, true, false))
+
+	active := &model.Token{
+		GroupID:   "group",
+		Name:      "active",
+		ExpiredAt: now.Add(time.Hour),
+	}
+	require.NoError(t, model.InsertToken(active, true, false))
+
+	never := &model.Token{GroupID: "group", Name: "never"}
+	require.NoError(t, model.InsertToken(never, true, false))
+
+	tokens, err := model.DisableExpiredTokens()
+	require.NoError(t, err)
+	require.Len(t, tokens, 1)
+	require.Equal(t, expired.ID, tokens[0].ID)
+
+	got, err := model.GetTokenByID(expired.ID)
+	require.NoError(t, err)
+	require.Equal(t, model.TokenStatusDisabled, got.Status)
+
+	got, err = model.GetTokenByID(never.ID)
+	require.NoError(t, err)
+	require.Equal(t, model.TokenStatusEnabled, got.Status)
+
+	tokens, err = model.DisableExpiredTokens()
+	require.NoError(t, err)
+	require.Empty(t, tokens)
+}
+
+func TestUpdateTokenLimits(t *testing.T) {
+	setupTokenTestDB(t)
+
+	token := &model.Token{GroupID: "group", Name: "limited", RPM: 10}
+	require.NoError(t, model.InsertToken(token, true, false))
+
+	cache, err := model.GetAndValidateToken(token.Key)
+	require.NoError(t, err)
+	require.Equal(t, int64(10), cache.RPM)
+
+	tpm := int64(1000)
+	maxConcurrency := int64(2)
+	rpm := int64(0)
+
+	_, err = model.UpdateGroupToken(token.ID, "group", model.UpdateTokenRequest{
+		RPM:            &rpm,
+		TPM:            &tpm,
+		MaxConcurrency: &maxConcurrency,
+	})
+	require.NoError(t, err)
+
+	cache, err = model.GetAndValidateToken(token.Key)
+	require.NoError(t, err)
+	require.Zero(t, cache.RPM)
+	require.Equal(t, int64(1000), cache.TPM)
+	require.Equal(t, int64(2), cache.MaxConcurrency)
+
+	negative := int64(-1)
+
+	_, err = model.UpdateToken(token.ID, model.UpdateTokenRequest{RPM: &negative})
+	require.Error(t, err)
+}
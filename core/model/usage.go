@@ -29,6 +29,7 @@ type PriceCondition struct {
 	InputMedia     *bool    `json:"input_media,omitempty"`
 	InputVideo     *bool    `json:"input_video,omitempty"`
 	OutputAudio    *bool    `json:"output_audio,omitempty"`
+	Batch          *bool    `json:"batch,omitempty"`
 }
 
 type ConditionalPrice struct {
@@ -290,6 +291,10 @@ func priceConditionSpecificity(condition PriceCondition) int {
 		specificity++
 	}
 
+	if condition.Batch != nil {
+		specificity++
+	}
+
 	if condition.InputTokenMin > 0 {
 		specificity++
 	}
@@ -592,7 +597,8 @@ func (p *Price) ValidateConditionalPrices() error {
 
 			if !boolConditionOverlap(condition.InputMedia, otherCondition.InputMedia) ||
 				!boolConditionOverlap(condition.InputVideo, otherCondition.InputVideo) ||
-				!boolConditionOverlap(condition.OutputAudio, otherCondition.OutputAudio) {
+				!boolConditionOverlap(condition.OutputAudio, otherCondition.OutputAudio) ||
+				!boolConditionOverlap(condition.Batch, otherCondition.Batch) {
 				continue
 			}
 
@@ -797,6 +803,14 @@ func (p *Price) selectConditionalPrice(
 	return *p
 }
 
+// ReferenceCost is the cost of a request with PriceUnit input and output tokens,
+// it's used to compare the prices of different models
+func (p *Price) ReferenceCost() float64 {
+	return float64(p.PerRequestPrice) +
+		float64(p.InputPrice)*PriceUnit/float64(p.GetInputPriceUnit()) +
+		float64(p.OutputPrice)*PriceUnit/float64(p.GetOutputPriceUnit())
+}
+
 func (p *Price) GetInputPriceUnit() int64 {
 	if p.InputPriceUnit > 0 {
 		return int64(p.InputPriceUnit)
@@ -905,6 +919,7 @@ type UsageContext struct {
 	InputMedia       *bool  `               json:"input_media,omitempty"`
 	InputVideo       *bool  `               json:"input_video,omitempty"`
 	OutputAudio      *bool  `               json:"output_audio,omitempty"`
+	Batch            *bool  `               json:"batch,omitempty"`
 }
 
 func (c UsageContext) PriceConditionMatches(condition PriceCondition) bool {
@@ -958,6 +973,12 @@ func (c UsageContext) priceConditionMatches(
 		}
 	}
 
+	if condition.Batch != nil {
+		if c.Batch == nil || *c.Batch != *condition.Batch {
+			return false
+		}
+	}
+
 	return true
 }
 
@@ -990,6 +1011,10 @@ func (c UsageContext) WithFallback(fallback UsageContext) UsageContext {
 		c.OutputAudio = fallback.OutputAudio
 	}
 
+	if c.Batch == nil {
+		c.Batch = fallback.Batch
+	}
+
 	return c
 }
 
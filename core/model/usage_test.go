@@ -806,6 +806,43 @@ func TestPrice_SelectConditionalPrice_WithServiceTier(t *testing.T) {
 	}
 }
 
+func TestPrice_SelectConditionalPrice_WithBatch(t *testing.T) {
+	price := model.Price{
+		InputPrice:  0.002,
+		OutputPrice: 0.008,
+		ConditionalPrices: []model.ConditionalPrice{
+			{
+				Condition: model.PriceCondition{Batch: new(true)},
+				Price: model.Price{
+					InputPrice:  0.001,
+					OutputPrice: 0.004,
+				},
+			},
+		},
+	}
+
+	if err := price.ValidateConditionalPrices(); err != nil {
+		t.Fatalf("expected batch condition to be valid, got %v", err)
+	}
+
+	usage := model.Usage{InputTokens: 1000, OutputTokens: 1000}
+
+	selectedPrice := price.SelectConditionalPrice(usage, model.UsageContext{Batch: new(true)})
+	if float64(selectedPrice.InputPrice) != 0.001 || float64(selectedPrice.OutputPrice) != 0.004 {
+		t.Fatalf("expected batch price, got %#v", selectedPrice)
+	}
+
+	selectedPrice = price.SelectConditionalPrice(usage, model.UsageContext{})
+	if float64(selectedPrice.InputPrice) != 0.002 || float64(selectedPrice.OutputPrice) != 0.008 {
+		t.Fatalf("expected base price for non batch request, got %#v", selectedPrice)
+	}
+
+	got := model.UsageContext{}.WithFallback(model.UsageContext{Batch: new(true)})
+	if got.Batch == nil || !*got.Batch {
+		t.Fatalf("expected batch flag from fallback, got %#v", got.Batch)
+	}
+}
+
 func TestPrice_SelectConditionalPrice_UsesMostSpecificMatchingCondition(t *testing.T) {
 	price := model.Price{
 		InputPrice: 0.001,
@@ -0,0 +1,426 @@
+package model
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/bytedance/sonic"
+	"github.com/labring/aiproxy/core/common"
+	log "github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+const (
+	ErrVirtualMCPNotFound = "virtual mcp"
+)
+
+type VirtualMCPStatus int
+
+const (
+	VirtualMCPStatusEnabled VirtualMCPStatus = iota + 1
+	VirtualMCPStatusDisabled
+)
+
+// VirtualMCPServerType is where the server of a virtual mcp is registered
+type VirtualMCPServerType string
+
+const (
+	VirtualMCPServerTypePublic VirtualMCPServerType = "public"
+	VirtualMCPServerTypeGroup  VirtualMCPServerType = "group"
+	VirtualMCPServerTypeEmbed  VirtualMCPServerType = "embed"
+)
+
+// VirtualMCPToolSeparator separates the namespace and the name of the tools
+const VirtualMCPToolSeparator = "__"
+
+// VirtualMCPServer is a server whose tools are merged into a virtual mcp
+type VirtualMCPServer struct {
+	Type VirtualMCPServerType `json:"type"`
+	ID   string               `json:"id"`
+	// the prefix of the tool names, the id is used when it is empty
+	Namespace string `json:"namespace,omitempty"`
+	// only the listed tools are exposed when it is not empty
+	Tools []string `json:"tools,omitempty"`
+	// the exposed names of the tools, they are not prefixed by the namespace
+	Rename map[string]string `json:"rename,omitempty"`
+	// the init config of the embed servers
+	Config map[string]string `json:"config,omitempty"`
+}
+
+func (s *VirtualMCPServer) GetNamespace() string {
+	if s.Namespace != "" {
+		return s.Namespace
+	}
+
+	return s.ID
+}
+
+// ToolName returns the exposed name of a tool of the server, false when the
+// tool is not allowed
+func (s *VirtualMCPServer) ToolName(tool string) (string, bool) {
+	if len(s.Tools) > 0 && !slices.Contains(s.Tools, tool) {
+		return "", false
+	}
+
+	if name, ok := s.Rename[tool]; ok && name != "" {
+		return name, true
+	}
+
+	return s.GetNamespace() + VirtualMCPToolSeparator + tool, true
+}
+
+func (s *VirtualMCPServer) validate() error {
+	switch s.Type {
+	case VirtualMCPServerTypePublic, VirtualMCPServerTypeGroup, VirtualMCPServerTypeEmbed:
+	default:
+		return fmt.Errorf("unknown virtual mcp server type: %s", s.Type)
+	}
+
+	if err := validateMCPID(s.ID); err != nil {
+		return err
+	}
+
+	if s.Namespace != "" {
+		if err := validateMCPID(s.Namespace); err != nil {
+			return fmt.Errorf("namespace %s is invalid: %w", s.Namespace, err)
+		}
+	}
+
+	for tool, name := range s.Rename {
+		if err := validateMCPID(name); err != nil {
+			return fmt.Errorf("tool %s rename %s is invalid: %w", tool, name, err)
+		}
+	}
+
+	return nil
+}
+
+type VirtualMCP struct {
+	ID          string             `gorm:"primaryKey"                    json:"id"`
+	GroupID     string             `gorm:"primaryKey"                    json:"group_id"`
+	Group       *Group             `gorm:"foreignKey:GroupID"            json:"-"`
+	Status      VirtualMCPStatus   `gorm:"index;default:1"               json:"status"`
+	CreatedAt   time.Time          `gorm:"index,autoCreateTime"          json:"created_at"`
+	UpdateAt    time.Time          `gorm:"index,autoUpdateTime"          json:"update_at"`
+	Name        string             `                                     json:"name"`
+	Description string             `                                     json:"description"`
+	Servers     []VirtualMCPServer `gorm:"serializer:fastjson;type:text" json:"servers"`
+}
+
+func (v *VirtualMCP) BeforeSave(_ *gorm.DB) error {
+	if v.GroupID == "" {
+		return errors.New("group id is empty")
+	}
+
+	if err := validateMCPID(v.ID); err != nil {
+		return err
+	}
+
+	if v.Status == 0 {
+		v.Status = VirtualMCPStatusEnabled
+	}
+
+	if len(v.Servers) == 0 {
+		return errors.New("virtual mcp servers is empty")
+	}
+
+	return ValidateVirtualMCPServers(v.Servers)
+}
+
+// ValidateVirtualMCPServers validates the servers merged into one tool list,
+// the namespaces and the renamed tools must be unique
+func ValidateVirtualMCPServers(servers []VirtualMCPServer) error {
+	namespaces := make(map[string]struct{}, len(servers))
+	renames := make(map[string]struct{})
+
+	for i := range servers {
+		server := &servers[i]
+		if err := server.validate(); err != nil {
+			return err
+		}
+
+		namespace := server.GetNamespace()
+		if _, ok := namespaces[namespace]; ok {
+			return fmt.Errorf("namespace %s is duplicated", namespace)
+		}
+
+		namespaces[namespace] = struct{}{}
+
+		for _, name := range server.Rename {
+			if _, ok := renames[name]; ok {
+				return fmt.Errorf("tool rename %s is duplicated", name)
+			}
+
+			renames[name] = struct{}{}
+		}
+	}
+
+	return nil
+}
+
+// RouteVirtualMCPTool returns the index of the server exposing the tool and
+// the name of the tool in the server
+func RouteVirtualMCPTool(servers []VirtualMCPServer, name string) (int, string, bool) {
+	for i := range servers {
+		for tool, renamed := range servers[i].Rename {
+			if renamed != name {
+				continue
+			}
+
+			if _, ok := servers[i].ToolName(tool); !ok {
+				return 0, "", false
+			}
+
+			return i, tool, true
+		}
+	}
+
+	owner := -1
+	owned := ""
+
+	// the longest namespace wins when a namespace is the prefix of another
+	for i := range servers {
+		prefix := servers[i].GetNamespace() + VirtualMCPToolSeparator
+
+		tool, ok := strings.CutPrefix(name, prefix)
+		if !ok || tool == "" {
+			continue
+		}
+
+		if exposed, ok := servers[i].ToolName(tool); !ok || exposed != name {
+			continue
+		}
+
+		if owner == -1 || len(tool) < len(owned) {
+			owner = i
+			owned = tool
+		}
+	}
+
+	return owner, owned, owner != -1
+}
+
+func (v *VirtualMCP) MarshalJSON() ([]byte, error) {
+	type Alias VirtualMCP
+
+	a := &struct {
+		*Alias
+		CreatedAt int64 `json:"created_at"`
+		UpdateAt  int64 `json:"update_at"`
+	}{
+		Alias:     (*Alias)(v),
+		CreatedAt: v.CreatedAt.UnixMilli(),
+		UpdateAt:  v.UpdateAt.UnixMilli(),
+	}
+
+	return sonic.Marshal(a)
+}
+
+// CreateVirtualMCP creates a new virtual mcp
+func CreateVirtualMCP(mcp *VirtualMCP) error {
+	err := DB.Create(mcp).Error
+	if err != nil && errors.Is(err, gorm.ErrDuplicatedKey) {
+		return errors.New("virtual mcp already exists")
+	}
+
+	return err
+}
+
+// UpdateVirtualMCP updates an existing virtual mcp
+func UpdateVirtualMCP(mcp *VirtualMCP) (err error) {
+	defer func() {
+		if err == nil {
+			CacheDeleteVirtualMCP(mcp.GroupID, mcp.ID)
+		}
+	}()
+
+	selects := []string{
+		"name",
+		"description",
+		"servers",
+	}
+	if mcp.Status != 0 {
+		selects = append(selects, "status")
+	}
+
+	result := DB.
+		Select(selects).
+		Where("id = ? AND group_id = ?", mcp.ID, mcp.GroupID).
+		Updates(mcp)
+
+	return HandleUpdateResult(result, ErrVirtualMCPNotFound)
+}
+
+func UpdateVirtualMCPStatus(id, groupID string, status VirtualMCPStatus) (err error) {
+	defer func() {
+		if err == nil {
+			CacheDeleteVirtualMCP(groupID, id)
+		}
+	}()
+
+	result := DB.Model(&VirtualMCP{}).
+		Where("id = ? AND group_id = ?", id, groupID).
+		Update("status", status)
+
+	return HandleUpdateResult(result, ErrVirtualMCPNotFound)
+}
+
+// DeleteVirtualMCP deletes a virtual mcp by id and group id
+func DeleteVirtualMCP(id, groupID string) (err error) {
+	defer func() {
+		if err == nil {
+			CacheDeleteVirtualMCP(groupID, id)
+		}
+	}()
+
+	if id == "" || groupID == "" {
+		return errors.New("virtual mcp id or group id is empty")
+	}
+
+	result := DB.Where("id = ? AND group_id = ?", id, groupID).Delete(&VirtualMCP{})
+
+	return HandleUpdateResult(result, ErrVirtualMCPNotFound)
+}
+
+// GetVirtualMCPByID retrieves a virtual mcp by id and group id
+func GetVirtualMCPByID(id, groupID string) (VirtualMCP, error) {
+	var mcp VirtualMCP
+	if id == "" || groupID == "" {
+		return mcp, errors.New("virtual mcp id or group id is empty")
+	}
+
+	err := DB.Where("id = ? AND group_id = ?", id, groupID).First(&mcp).Error
+
+	return mcp, HandleNotFound(err, ErrVirtualMCPNotFound)
+}
+
+// GetVirtualMCPs retrieves the virtual mcps of a group with pagination and
+// filtering
+func GetVirtualMCPs(
+	groupID string,
+	page, perPage int,
+	keyword string,
+	status VirtualMCPStatus,
+) (mcps []VirtualMCP, total int64, err error) {
+	if groupID == "" {
+		return nil, 0, errors.New("group id is empty")
+	}
+
+	tx := DB.Model(&VirtualMCP{}).Where("group_id = ?", groupID)
+
+	if status != 0 {
+		tx = tx.Where("status = ?", status)
+	}
+
+	if keyword != "" {
+		like := "LIKE"
+		if !common.UsingSQLite {
+			like = "ILIKE"
+		}
+
+		tx = tx.Where(
+			fmt.Sprintf("(id %[1]s ? OR name %[1]s ? OR description %[1]s ?)", like),
+			"%"+keyword+"%",
+			"%"+keyword+"%",
+			"%"+keyword+"%",
+		)
+	}
+
+	err = tx.Count(&total).Error
+	if err != nil {
+		return nil, 0, err
+	}
+
+	if total <= 0 {
+		return nil, 0, nil
+	}
+
+	limit, offset := toLimitOffset(page, perPage)
+	err = tx.
+		Order("id asc").
+		Limit(limit).
+		Offset(offset).
+		Find(&mcps).
+		Error
+
+	return mcps, total, err
+}
+
+const (
+	VirtualMCPCacheKey = "virtual_mcp:%s:%s"
+)
+
+func getVirtualMCPCacheKey(groupID, id string) string {
+	return common.RedisKeyf(VirtualMCPCacheKey, groupID, id)
+}
+
+func cloneVirtualMCP(mcp *VirtualMCP) *VirtualMCP {
+	if mcp == nil {
+		return nil
+	}
+
+	cloned := *mcp
+
+	cloned.Servers = make([]VirtualMCPServer, len(mcp.Servers))
+	for i, server := range mcp.Servers {
+		server.Tools = slices.Clone(server.Tools)
+		server.Rename = maps.Clone(server.Rename)
+		server.Config = maps.Clone(server.Config)
+		cloned.Servers[i] = server
+	}
+
+	return &cloned
+}
+
+func CacheDeleteVirtualMCP(groupID, id string) {
+	cacheDeleteModelLocal(getVirtualMCPCacheKey(groupID, id))
+}
+
+// CacheGetVirtualMCP returns a virtual mcp through the local cache
+func CacheGetVirtualMCP(groupID, id string) (*VirtualMCP, error) {
+	cacheKey := getVirtualMCPCacheKey(groupID, id)
+	if mcp, notFound, ok := cacheGetModelLocal(cacheKey, cloneVirtualMCP); ok {
+		if notFound {
+			return nil, NotFoundError(ErrVirtualMCPNotFound)
+		}
+
+		return mcp, nil
+	}
+
+	mcp, notFound, _, err := loadWithLocalKeyLock(
+		modelCacheLoadLocker,
+		cacheKey,
+		func() (*VirtualMCP, bool, bool) {
+			return cacheGetModelLocal(cacheKey, cloneVirtualMCP)
+		},
+		func() (*VirtualMCP, error) {
+			mcp, err := GetVirtualMCPByID(id, groupID)
+			if err != nil {
+				if errors.Is(err, gorm.ErrRecordNotFound) {
+					cacheSetModelNotFoundLocalUnlocked(cacheKey)
+				} else {
+					log.Errorf("get virtual mcp (%s:%s) error: %s", groupID, id, err.Error())
+				}
+
+				return nil, err
+			}
+
+			cacheSetModelLocalUnlocked(cacheKey, &mcp, cloneVirtualMCP)
+
+			return &mcp, nil
+		},
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	if notFound {
+		return nil, NotFoundError(ErrVirtualMCPNotFound)
+	}
+
+	return cloneVirtualMCP(mcp), nil
+}
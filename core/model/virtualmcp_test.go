@@ -0,0 +1,103 @@
+package model
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestVirtualMCPServerToolName(t *testing.T) {
+	server := VirtualMCPServer{
+		Type:   VirtualMCPServerTypePublic,
+		ID:     "github",
+		Tools:  []string{"search", "create_issue"},
+		Rename: map[string]string{"create_issue": "open_issue"},
+	}
+
+	name, ok := server.ToolName("search")
+	require.True(t, ok)
+	assert.Equal(t, "github__search", name)
+
+	name, ok = server.ToolName("create_issue")
+	require.True(t, ok)
+	assert.Equal(t, "open_issue", name)
+
+	_, ok = server.ToolName("delete_repo")
+	assert.False(t, ok)
+
+	server.Namespace = "gh"
+	server.Tools = nil
+
+	name, ok = server.ToolName("delete_repo")
+	require.True(t, ok)
+	assert.Equal(t, "gh__delete_repo", name)
+}
+
+func TestVirtualMCPValidate(t *testing.T) {
+	withTestModelCacheDB(t, func() {
+		require.NoError(t, DB.Create(&Group{ID: "g1"}).Error)
+
+		vmcp := &VirtualMCP{
+			ID:      "tools",
+			GroupID: "g1",
+			Servers: []VirtualMCPServer{
+				{Type: VirtualMCPServerTypePublic, ID: "github"},
+				{Type: VirtualMCPServerTypeGroup, ID: "github", Namespace: "internal"},
+			},
+		}
+		require.NoError(t, CreateVirtualMCP(vmcp))
+		assert.Equal(t, VirtualMCPStatusEnabled, vmcp.Status)
+
+		cached, err := CacheGetVirtualMCP("g1", "tools")
+		require.NoError(t, err)
+		assert.Len(t, cached.Servers, 2)
+
+		// the namespaces are the ids by default
+		require.Error(t, CreateVirtualMCP(&VirtualMCP{
+			ID:      "duplicated",
+			GroupID: "g1",
+			Servers: []VirtualMCPServer{
+				{Type: VirtualMCPServerTypePublic, ID: "github"},
+				{Type: VirtualMCPServerTypeGroup, ID: "github"},
+			},
+		}))
+
+		require.Error(t, CreateVirtualMCP(&VirtualMCP{
+			ID:      "renamed",
+			GroupID: "g1",
+			Servers: []VirtualMCPServer{
+				{
+					Type:   VirtualMCPServerTypePublic,
+					ID:     "github",
+					Rename: map[string]string{"search": "search"},
+				},
+				{
+					Type:   VirtualMCPServerTypePublic,
+					ID:     "gitlab",
+					Rename: map[string]string{"search": "search"},
+				},
+			},
+		}))
+
+		require.Error(t, CreateVirtualMCP(&VirtualMCP{
+			ID:      "unknown",
+			GroupID: "g1",
+			Servers: []VirtualMCPServer{{Type: "remote", ID: "github"}},
+		}))
+
+		require.Error(t, CreateVirtualMCP(&VirtualMCP{ID: "empty", GroupID: "g1"}))
+
+		vmcp.Servers = vmcp.Servers[:1]
+		require.NoError(t, UpdateVirtualMCP(vmcp))
+
+		cached, err = CacheGetVirtualMCP("g1", "tools")
+		require.NoError(t, err)
+		assert.Len(t, cached.Servers, 1)
+
+		require.NoError(t, DeleteVirtualMCP("tools", "g1"))
+
+		_, err = CacheGetVirtualMCP("g1", "tools")
+		require.Error(t, err)
+	})
+}
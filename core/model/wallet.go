@@ -0,0 +1,316 @@
+package model
+
+import (
+	"errors"
+	"time"
+
+	"github.com/shopspring/decimal"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	ErrGroupWalletNotFound = "group wallet"
+)
+
+type WalletLedgerType string
+
+const (
+	WalletLedgerTypeTopUp   WalletLedgerType = "topup"
+	WalletLedgerTypeDebit   WalletLedgerType = "debit"
+	WalletLedgerTypeConsume WalletLedgerType = "consume"
+)
+
+var ErrWalletInsufficientBalance = errors.New("wallet balance is insufficient")
+
+// GroupWallet is the prepaid balance of a group, the group can keep consuming until
+// the balance is below the negative credit limit
+type GroupWallet struct {
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+	GroupID     string    `json:"group_id"     gorm:"size:64;primaryKey"`
+	Balance     float64   `json:"balance"`
+	CreditLimit float64   `json:"credit_limit"`
+}
+
+// Remain is the amount that the group can still consume
+func (w *GroupWallet) Remain() float64 {
+	return decimal.NewFromFloat(w.Balance).
+		Add(decimal.NewFromFloat(w.CreditLimit)).
+		InexactFloat64()
+}
+
+// GroupWalletTopUp records every top up of a group wallet
+type GroupWalletTopUp struct {
+	ID        int       `json:"id"         gorm:"primaryKey"`
+	CreatedAt time.Time `json:"created_at" gorm:"index"`
+	GroupID   string    `json:"group_id"   gorm:"size:64;index"`
+	Amount    float64   `json:"amount"`
+	Remark    string    `json:"remark"     gorm:"type:text"`
+}
+
+// GroupWalletLedger records every change of a group wallet balance, the amount of
+// debit and consume entries is negative. The request id is only set on the consume
+// entries and is unique, so that a request is never consumed twice
+type GroupWalletLedger struct {
+	ID           int              `json:"id"                   gorm:"primaryKey"`
+	CreatedAt    time.Time        `json:"created_at"           gorm:"index"`
+	GroupID      string           `json:"group_id"             gorm:"size:64;index"`
+	Type         WalletLedgerType `json:"type"                 gorm:"size:16;index"`
+	Amount       float64          `json:"amount"`
+	BalanceAfter float64          `json:"balance_after"`
+	TokenName    string           `json:"token_name,omitempty" gorm:"size:32"`
+	RequestID    *string          `json:"request_id,omitempty" gorm:"size:64;uniqueIndex"`
+	Remark       string           `json:"remark,omitempty"     gorm:"type:text"`
+}
+
+func GetGroupWallet(groupID string) (*GroupWallet, error) {
+	if groupID == "" {
+		return nil, errors.New("group id is empty")
+	}
+
+	wallet := GroupWallet{}
+	err := DB.Where("group_id = ?", groupID).First(&wallet).Error
+
+	return &wallet, HandleNotFound(err, ErrGroupWalletNotFound)
+}
+
+// GetOrEmptyGroupWallet returns an empty wallet if the group has never been topped up
+func GetOrEmptyGroupWallet(groupID string) (*GroupWallet, error) {
+	wallet, err := GetGroupWallet(groupID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return &GroupWallet{GroupID: groupID}, nil
+		}
+
+		return nil, err
+	}
+
+	return wallet, nil
+}
+
+func SetGroupWalletCreditLimit(groupID string, creditLimit float64) (*GroupWallet, error) {
+	if creditLimit < 0 {
+		return nil, errors.New("credit limit must not be negative")
+	}
+
+	wallet := &GroupWallet{
+		GroupID:     groupID,
+		CreditLimit: creditLimit,
+	}
+
+	err := DB.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "group_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"credit_limit", "updated_at"}),
+	}).Create(wallet).Error
+	if err != nil {
+		return nil, err
+	}
+
+	return GetGroupWallet(groupID)
+}
+
+type WalletChange struct {
+	Type      WalletLedgerType
+	Amount    float64
+	TokenName string
+	RequestID string
+	Remark    string
+	// Force allows the balance to go below the credit limit, the consume of a finished
+	// request must always be recorded
+	Force bool
+}
+
+// TopUpGroupWallet adds the amount to the wallet and records the top up
+func TopUpGroupWallet(groupID string, amount float64, remark string) (*GroupWallet, error) {
+	if amount <= 0 {
+		return nil, errors.New("top up amount must be positive")
+	}
+
+	return changeGroupWallet(groupID, WalletChange{
+		Type:   WalletLedgerTypeTopUp,
+		Amount: amount,
+		Remark: remark,
+	})
+}
+
+// DebitGroupWallet deducts the amount from the wallet by an admin
+func DebitGroupWallet(groupID string, amount float64, remark string) (*GroupWallet, error) {
+	if amount <= 0 {
+		return nil, errors.New("debit amount must be positive")
+	}
+
+	return changeGroupWallet(groupID, WalletChange{
+		Type:   WalletLedgerTypeDebit,
+		Amount: -amount,
+		Remark: remark,
+	})
+}
+
+// ConsumeGroupWallet deducts the used amount of a request from the wallet, consuming
+// the same request again leaves the wallet unchanged
+func ConsumeGroupWallet(
+	groupID, tokenName, requestID string,
+	amount float64,
+) (*GroupWallet, error) {
+	if amount <= 0 {
+		return nil, errors.New("consume amount must be positive")
+	}
+
+	return changeGroupWallet(groupID, WalletChange{
+		Type:      WalletLedgerTypeConsume,
+		Amount:    -amount,
+		TokenName: tokenName,
+		RequestID: requestID,
+		Force:     true,
+	})
+}
+
+// changeGroupWallet updates the balance and writes the ledger in one transaction
+func changeGroupWallet(groupID string, change WalletChange) (*GroupWallet, error) {
+	if groupID == "" {
+		return nil, errors.New("group id is empty")
+	}
+
+	wallet := &GroupWallet{}
+
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.OnConflict{DoNothing: true}).
+			Create(&GroupWallet{GroupID: groupID}).Error; err != nil {
+			return err
+		}
+
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("group_id = ?", groupID).
+			First(wallet).Error; err != nil {
+			return HandleNotFound(err, ErrGroupWalletNotFound)
+		}
+
+		balance := decimal.NewFromFloat(wallet.Balance).
+			Add(decimal.NewFromFloat(change.Amount))
+
+		if !change.Force &&
+			change.Amount < 0 &&
+			balance.Add(decimal.NewFromFloat(wallet.CreditLimit)).IsNegative() {
+			return ErrWalletInsufficientBalance
+		}
+
+		ledger := &GroupWalletLedger{
+			GroupID:      groupID,
+			Type:         change.Type,
+			Amount:       change.Amount,
+			BalanceAfter: balance.InexactFloat64(),
+			TokenName:    change.TokenName,
+			Remark:       change.Remark,
+		}
+		if change.RequestID != "" {
+			ledger.RequestID = &change.RequestID
+		}
+
+		// the ledger is written first, a request that has already been consumed
+		// conflicts on the request id and leaves the balance unchanged
+		result := tx.Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "request_id"}},
+			DoNothing: true,
+		}).Create(ledger)
+		if result.Error != nil {
+			return result.Error
+		}
+
+		if result.RowsAffected == 0 {
+			return nil
+		}
+
+		wallet.Balance = ledger.BalanceAfter
+
+		result = tx.Model(wallet).
+			Where("group_id = ?", groupID).
+			Update("balance", wallet.Balance)
+		if err := HandleUpdateResult(result, ErrGroupWalletNotFound); err != nil {
+			return err
+		}
+
+		if change.Type == WalletLedgerTypeTopUp {
+			return tx.Create(&GroupWalletTopUp{
+				GroupID: groupID,
+				Amount:  change.Amount,
+				Remark:  change.Remark,
+			}).Error
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return wallet, nil
+}
+
+// GetGroupWalletTotalTopUp returns the sum of all the top ups of a group
+func GetGroupWalletTotalTopUp(groupID string) (float64, error) {
+	var total float64
+
+	err := DB.Model(&GroupWalletTopUp{}).
+		Where("group_id = ?", groupID).
+		Select("COALESCE(SUM(amount), 0)").
+		Scan(&total).Error
+
+	return total, err
+}
+
+func GetGroupWalletLedgers(
+	groupID string,
+	ledgerType WalletLedgerType,
+	page, perPage int,
+) (ledgers []*GroupWalletLedger, total int64, err error) {
+	tx := DB.Model(&GroupWalletLedger{}).Where("group_id = ?", groupID)
+	if ledgerType != "" {
+		tx = tx.Where("type = ?", ledgerType)
+	}
+
+	err = tx.Count(&total).Error
+	if err != nil {
+		return nil, 0, err
+	}
+
+	if total <= 0 {
+		return nil, 0, nil
+	}
+
+	limit, offset := toLimitOffset(page, perPage)
+	err = tx.
+		Order("id desc").
+		Limit(limit).
+		Offset(offset).
+		Find(&ledgers).
+		Error
+
+	return ledgers, total, err
+}
+
+func GetGroupWalletTopUps(
+	groupID string,
+	page, perPage int,
+) (topUps []*GroupWalletTopUp, total int64, err error) {
+	tx := DB.Model(&GroupWalletTopUp{}).Where("group_id = ?", groupID)
+
+	err = tx.Count(&total).Error
+	if err != nil {
+		return nil, 0, err
+	}
+
+	if total <= 0 {
+		return nil, 0, nil
+	}
+
+	limit, offset := toLimitOffset(page, perPage)
+	err = tx.
+		Order("id desc").
+		Limit(limit).
+		Offset(offset).
+		Find(&topUps).
+		Error
+
+	return topUps, total, err
+}
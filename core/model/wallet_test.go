@@ -0,0 +1,115 @@
+package model_test
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/labring/aiproxy/core/common"
+	"github.com/labring/aiproxy/core/model"
+	"github.com/stretchr/testify/require"
+)
+
+func setupWalletTestDB(t *testing.T) {
+	t.Helper()
+
+	prevDB := model.DB
+	prevUsingSQLite := common.UsingSQLite
+
+	testDB, err := model.OpenSQLite(filepath.Join(t.TempDir(), "wallet.db"))
+	require.NoError(t, err)
+
+	model.DB = testDB
+	common.UsingSQLite = true
+
+	t.Cleanup(func() {
+		model.DB = prevDB
+		common.UsingSQLite = prevUsingSQLite
+	})
+
+	require.NoError(t, testDB.AutoMigrate(
+		&model.GroupWallet{},
+		&model.GroupWalletTopUp{},
+		&model.GroupWalletLedger{},
+	))
+}
+
+func TestGroupWalletTopUpAndConsume(t *testing.T) {
+	setupWalletTestDB(t)
+
+	wallet, err := model.GetOrEmptyGroupWallet("group")
+	require.NoError(t, err)
+	require.Zero(t, wallet.Remain())
+
+	wallet, err = model.TopUpGroupWallet("group", 10, "first top up")
+	require.NoError(t, err)
+	require.InDelta(t, 10, wallet.Balance, 1e-9)
+
+	_, err = model.SetGroupWalletCreditLimit("group", 5)
+	require.NoError(t, err)
+
+	wallet, err = model.ConsumeGroupWallet("group", "token", "req1", 0.3)
+	require.NoError(t, err)
+	require.InDelta(t, 9.7, wallet.Balance, 1e-9)
+	require.InDelta(t, 5, wallet.CreditLimit, 1e-9)
+	require.InDelta(t, 14.7, wallet.Remain(), 1e-9)
+
+	// the debit by admin can't go below the credit limit
+	_, err = model.DebitGroupWallet("group", 20, "too much")
+	require.ErrorIs(t, err, model.ErrWalletInsufficientBalance)
+
+	wallet, err = model.DebitGroupWallet("group", 12, "refund")
+	require.NoError(t, err)
+	require.InDelta(t, -2.3, wallet.Balance, 1e-9)
+
+	// the consume of a finished request is always recorded
+	wallet, err = model.ConsumeGroupWallet("group", "token", "req2", 4)
+	require.NoError(t, err)
+	require.InDelta(t, -6.3, wallet.Balance, 1e-9)
+	require.Negative(t, wallet.Remain())
+
+	totalTopUp, err := model.GetGroupWalletTotalTopUp("group")
+	require.NoError(t, err)
+	require.InDelta(t, 10, totalTopUp, 1e-9)
+
+	ledgers, total, err := model.GetGroupWalletLedgers("group", "", 1, 10)
+	require.NoError(t, err)
+	require.EqualValues(t, 4, total)
+	require.Equal(t, model.WalletLedgerTypeConsume, ledgers[0].Type)
+	require.NotNil(t, ledgers[0].RequestID)
+	require.Equal(t, "req2", *ledgers[0].RequestID)
+	require.InDelta(t, -4, ledgers[0].Amount, 1e-9)
+	require.InDelta(t, -6.3, ledgers[0].BalanceAfter, 1e-9)
+
+	_, total, err = model.GetGroupWalletLedgers("group", model.WalletLedgerTypeConsume, 1, 10)
+	require.NoError(t, err)
+	require.EqualValues(t, 2, total)
+
+	topUps, total, err := model.GetGroupWalletTopUps("group", 1, 10)
+	require.NoError(t, err)
+	require.EqualValues(t, 1, total)
+	require.Equal(t, "first top up", topUps[0].Remark)
+	require.Nil(t, ledgers[len(ledgers)-1].RequestID)
+}
+
+func TestGroupWalletConsumeIsIdempotent(t *testing.T) {
+	setupWalletTestDB(t)
+
+	_, err := model.TopUpGroupWallet("group", 10, "")
+	require.NoError(t, err)
+
+	wallet, err := model.ConsumeGroupWallet("group", "token", "req1", 1)
+	require.NoError(t, err)
+	require.InDelta(t, 9, wallet.Balance, 1e-9)
+
+	wallet, err = model.ConsumeGroupWallet("group", "token", "req1", 1)
+	require.NoError(t, err)
+	require.InDelta(t, 9, wallet.Balance, 1e-9)
+
+	wallet, err = model.ConsumeGroupWallet("group", "token", "req2", 1)
+	require.NoError(t, err)
+	require.InDelta(t, 8, wallet.Balance, 1e-9)
+
+	_, total, err := model.GetGroupWalletLedgers("group", model.WalletLedgerTypeConsume, 1, 10)
+	require.NoError(t, err)
+	require.EqualValues(t, 2, total)
+}
@@ -209,10 +209,13 @@ func ModelTypeNameToType(typeName string) mode.Mode {
 }
 
 // YAMLConfig represents the complete configuration with proper types
+// Groups and PublicMCPs are persisted to the database by ApplyYAMLConfig
 type YAMLConfig struct {
 	Channels     []ChannelItem     `yaml:"channels,omitempty"`
 	ModelConfigs []ModelConfigItem `yaml:"modelconfigs,omitempty"`
 	Options      map[string]string `yaml:"options,omitempty"`
+	Groups       []GroupItem       `yaml:"groups,omitempty"`
+	PublicMCPs   []PublicMCPItem   `yaml:"publicmcps,omitempty"`
 }
 
 var (
@@ -263,9 +266,8 @@ func LoadYAMLConfig() *YAMLConfig {
 	}
 
 	// Parse YAML directly into our types
-	var yamlConfig YAMLConfig
-	//nolint:musttag
-	if err := yaml.Unmarshal(data, &yamlConfig); err != nil {
+	yamlConfig, err := ParseYAMLConfig(data)
+	if err != nil {
 		log.Errorf("unmarshal config: %v", err)
 
 		yamlConfigCache = nil
@@ -275,12 +277,23 @@ func LoadYAMLConfig() *YAMLConfig {
 	}
 
 	// Update cache
-	yamlConfigCache = &yamlConfig
+	yamlConfigCache = yamlConfig
 	yamlConfigCacheTime = time.Now()
 
 	return yamlConfigCache
 }
 
+// ParseYAMLConfig parses a YAML configuration document
+func ParseYAMLConfig(data []byte) (*YAMLConfig, error) {
+	var yamlConfig YAMLConfig
+	//nolint:musttag
+	if err := yaml.Unmarshal(data, &yamlConfig); err != nil {
+		return nil, err
+	}
+
+	return &yamlConfig, nil
+}
+
 // applyYAMLConfigToModelConfigCache applies YAML model configs to the model config cache
 // Creates a wrapper cache that checks YAML first, then falls back to database cache
 func applyYAMLConfigToModelConfigCache(
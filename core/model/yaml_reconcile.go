@@ -0,0 +1,683 @@
+package model
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"reflect"
+	"slices"
+	"time"
+
+	"github.com/bytedance/sonic"
+	log "github.com/sirupsen/logrus"
+	"gopkg.in/yaml.v3"
+	"gorm.io/gorm"
+)
+
+// GroupItem declares a group with its tokens and model config overrides
+// The fields use the same names as the admin API
+type GroupItem struct {
+	Group
+	Tokens       []Token            `json:"tokens,omitempty"`
+	ModelConfigs []GroupModelConfig `json:"model_configs,omitempty"`
+}
+
+func (g *GroupItem) UnmarshalYAML(value *yaml.Node) error {
+	return unmarshalYAMLByJSON(value, g)
+}
+
+// PublicMCPItem declares a public mcp
+// The fields use the same names as the admin API
+type PublicMCPItem struct {
+	PublicMCP
+}
+
+func (p *PublicMCPItem) UnmarshalYAML(value *yaml.Node) error {
+	return unmarshalYAMLByJSON(value, &p.PublicMCP)
+}
+
+// unmarshalYAMLByJSON decodes the node with the json tags of v, so the database
+// models do not need yaml tags
+func unmarshalYAMLByJSON(value *yaml.Node, v any) error {
+	var raw any
+	if err := value.Decode(&raw); err != nil {
+		return err
+	}
+
+	data, err := sonic.Marshal(raw)
+	if err != nil {
+		return err
+	}
+
+	return sonic.Unmarshal(data, v)
+}
+
+type YAMLConfigChangeKind string
+
+const (
+	YAMLConfigChangeKindGroup            YAMLConfigChangeKind = "group"
+	YAMLConfigChangeKindToken            YAMLConfigChangeKind = "token"
+	YAMLConfigChangeKindGroupModelConfig YAMLConfigChangeKind = "group_model_config"
+	YAMLConfigChangeKindPublicMCP        YAMLConfigChangeKind = "public_mcp"
+)
+
+type YAMLConfigChangeAction string
+
+const (
+	YAMLConfigChangeActionCreate YAMLConfigChangeAction = "create"
+	YAMLConfigChangeActionUpdate YAMLConfigChangeAction = "update"
+	YAMLConfigChangeActionDelete YAMLConfigChangeAction = "delete"
+)
+
+type YAMLConfigChange struct {
+	Kind YAMLConfigChangeKind `json:"kind"`
+	// ID is the group id, group/token name, group/model or the mcp id
+	ID     string                 `json:"id"`
+	Action YAMLConfigChangeAction `json:"action"`
+	// Fields are the changed fields of an update
+	Fields []string `json:"fields,omitempty"`
+
+	apply func(tx *gorm.DB) error
+	// applied runs after the transaction is committed, to refresh the caches
+	applied func()
+}
+
+type YAMLConfigPlan struct {
+	Changes []YAMLConfigChange `json:"changes"`
+}
+
+func (p *YAMLConfigPlan) add(change YAMLConfigChange) {
+	p.Changes = append(p.Changes, change)
+}
+
+var groupYAMLFields = []string{
+	"status",
+	"rpm_ratio",
+	"tpm_ratio",
+	"available_sets",
+	"balance_alert_enabled",
+	"balance_alert_threshold",
+	"mcp_acl",
+}
+
+// tokenYAMLFields are the token fields owned by the config, usage and the
+// rotation state are left to the database
+var tokenYAMLFields = []string{
+	"name",
+	"subnets",
+	"models",
+	"status",
+	"quota",
+	"period_quota",
+	"period_type",
+	"activate_at",
+	"expired_at",
+	"rpm",
+	"tpm",
+	"max_concurrency",
+	"mcp_acl",
+}
+
+// PlanYAMLConfig compares the groups, tokens, group model configs and public
+// mcps of the config with the database
+// With prune, the tokens and model configs of the declared groups and the
+// public mcps that are not declared are deleted, groups are never deleted
+func PlanYAMLConfig(yamlConfig *YAMLConfig, prune bool) (*YAMLConfigPlan, error) {
+	if yamlConfig == nil {
+		yamlConfig = &YAMLConfig{}
+	}
+
+	if err := validateYAMLConfig(yamlConfig); err != nil {
+		return nil, err
+	}
+
+	plan := &YAMLConfigPlan{Changes: []YAMLConfigChange{}}
+
+	for i := range yamlConfig.Groups {
+		if err := planGroup(plan, &yamlConfig.Groups[i], prune); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := planPublicMCPs(plan, yamlConfig.PublicMCPs, prune); err != nil {
+		return nil, err
+	}
+
+	return plan, nil
+}
+
+// ApplyYAMLConfig reconciles the database to the config in one transaction and
+// returns the applied changes
+func ApplyYAMLConfig(yamlConfig *YAMLConfig, prune bool) (*YAMLConfigPlan, error) {
+	plan, err := PlanYAMLConfig(yamlConfig, prune)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(plan.Changes) == 0 {
+		return plan, nil
+	}
+
+	err = DB.Transaction(func(tx *gorm.DB) error {
+		for _, change := range plan.Changes {
+			if err := change.apply(tx); err != nil {
+				return fmt.Errorf("%s %s %s: %w", change.Action, change.Kind, change.ID, err)
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for _, change := range plan.Changes {
+		if change.applied != nil {
+			change.applied()
+		}
+	}
+
+	return plan, nil
+}
+
+func validateYAMLConfig(yamlConfig *YAMLConfig) error {
+	groups := make(map[string]struct{}, len(yamlConfig.Groups))
+
+	for _, group := range yamlConfig.Groups {
+		if group.ID == "" {
+			return errors.New("group id is required")
+		}
+
+		if _, ok := groups[group.ID]; ok {
+			return fmt.Errorf("duplicate group: %s", group.ID)
+		}
+
+		groups[group.ID] = struct{}{}
+
+		tokens := make(map[EmptyNullString]struct{}, len(group.Tokens))
+		for _, token := range group.Tokens {
+			if token.Name == "" {
+				return fmt.Errorf("token name is required in group: %s", group.ID)
+			}
+
+			if token.Key != "" && len(token.Key) != 48 {
+				return fmt.Errorf("token key must be 48 characters: %s/%s", group.ID, token.Name)
+			}
+
+			if _, ok := tokens[token.Name]; ok {
+				return fmt.Errorf("duplicate token: %s/%s", group.ID, token.Name)
+			}
+
+			tokens[token.Name] = struct{}{}
+		}
+
+		models := make(map[string]struct{}, len(group.ModelConfigs))
+		for _, modelConfig := range group.ModelConfigs {
+			if modelConfig.Model == "" {
+				return fmt.Errorf("model is required in group model config: %s", group.ID)
+			}
+
+			if _, ok := models[modelConfig.Model]; ok {
+				return fmt.Errorf("duplicate group model config: %s/%s", group.ID, modelConfig.Model)
+			}
+
+			models[modelConfig.Model] = struct{}{}
+		}
+	}
+
+	mcps := make(map[string]struct{}, len(yamlConfig.PublicMCPs))
+	for _, mcp := range yamlConfig.PublicMCPs {
+		if err := validateMCPID(mcp.ID); err != nil {
+			return fmt.Errorf("public mcp %q: %w", mcp.ID, err)
+		}
+
+		if _, ok := mcps[mcp.ID]; ok {
+			return fmt.Errorf("duplicate public mcp: %s", mcp.ID)
+		}
+
+		mcps[mcp.ID] = struct{}{}
+	}
+
+	return nil
+}
+
+func cacheDeleteGroupLogError(id string) {
+	if err := CacheDeleteGroup(id); err != nil {
+		log.Error("cache delete group failed: " + err.Error())
+	}
+}
+
+func planGroup(plan *YAMLConfigPlan, item *GroupItem, prune bool) error {
+	desired := Group{
+		ID:                    item.ID,
+		Status:                item.Status,
+		RPMRatio:              item.RPMRatio,
+		TPMRatio:              item.TPMRatio,
+		AvailableSets:         item.AvailableSets,
+		BalanceAlertEnabled:   item.BalanceAlertEnabled,
+		BalanceAlertThreshold: item.BalanceAlertThreshold,
+		MCPACL:                item.MCPACL,
+	}
+	if desired.Status == 0 {
+		desired.Status = GroupStatusEnabled
+	}
+
+	var (
+		current           Group
+		currentTokens     []Token
+		currentModelConfs []GroupModelConfig
+	)
+
+	err := DB.Where("id = ?", item.ID).First(&current).Error
+
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		plan.add(YAMLConfigChange{
+			Kind:   YAMLConfigChangeKindGroup,
+			ID:     item.ID,
+			Action: YAMLConfigChangeActionCreate,
+			apply: func(tx *gorm.DB) error {
+				return tx.Create(&desired).Error
+			},
+			applied: func() { cacheDeleteGroupLogError(desired.ID) },
+		})
+	case err != nil:
+		return err
+	default:
+		fields, err := diffJSONFields(current, desired, groupYAMLFields...)
+		if err != nil {
+			return err
+		}
+
+		if len(fields) > 0 {
+			plan.add(YAMLConfigChange{
+				Kind:   YAMLConfigChangeKindGroup,
+				ID:     item.ID,
+				Action: YAMLConfigChangeActionUpdate,
+				Fields: fields,
+				apply: func(tx *gorm.DB) error {
+					return tx.Model(&Group{}).
+						Where("id = ?", desired.ID).
+						Select(fields).
+						Updates(&desired).
+						Error
+				},
+				applied: func() { cacheDeleteGroupLogError(desired.ID) },
+			})
+		}
+
+		if err := DB.Where("group_id = ?", item.ID).Find(&currentTokens).Error; err != nil {
+			return err
+		}
+
+		if err := DB.Where("group_id = ?", item.ID).Find(&currentModelConfs).Error; err != nil {
+			return err
+		}
+	}
+
+	if err := planTokens(plan, item, currentTokens, prune); err != nil {
+		return err
+	}
+
+	return planGroupModelConfigs(plan, item, currentModelConfs, prune)
+}
+
+// normalizeTokenTimes drops the location and the sub second part of the token
+// times, the database may not keep them
+func normalizeTokenTimes(token *Token) {
+	normalize := func(t time.Time) time.Time {
+		if t.IsZero() {
+			return time.Time{}
+		}
+		return t.UTC().Truncate(time.Second)
+	}
+
+	token.ActivateAt = normalize(token.ActivateAt)
+	token.ExpiredAt = normalize(token.ExpiredAt)
+}
+
+// planTokens deletes the pruned tokens before creating the new ones, the new tokens
+// count toward the max token num of the group
+func planTokens(plan *YAMLConfigPlan, item *GroupItem, currentTokens []Token, prune bool) error {
+	currentByName := make(map[EmptyNullString]Token, len(currentTokens))
+	for _, token := range currentTokens {
+		currentByName[token.Name] = token
+	}
+
+	if prune {
+		declared := make(map[EmptyNullString]struct{}, len(item.Tokens))
+		for _, token := range item.Tokens {
+			declared[token.Name] = struct{}{}
+		}
+
+		for _, name := range slices.Sorted(maps.Keys(currentByName)) {
+			if _, ok := declared[name]; ok {
+				continue
+			}
+
+			current := currentByName[name]
+
+			plan.add(YAMLConfigChange{
+				Kind:   YAMLConfigChangeKindToken,
+				ID:     item.ID + "/" + string(name),
+				Action: YAMLConfigChangeActionDelete,
+				apply: func(tx *gorm.DB) error {
+					return tx.Delete(&Token{}, current.ID).Error
+				},
+				applied: func() { cacheDeleteTokenKeys(current) },
+			})
+		}
+	}
+
+	for _, token := range item.Tokens {
+		desired := token
+		desired.ID = 0
+		desired.GroupID = item.ID
+
+		if desired.Status == 0 {
+			desired.Status = TokenStatusEnabled
+		}
+
+		id := item.ID + "/" + string(desired.Name)
+
+		current, ok := currentByName[desired.Name]
+		if !ok {
+			plan.add(YAMLConfigChange{
+				Kind:   YAMLConfigChangeKindToken,
+				ID:     id,
+				Action: YAMLConfigChangeActionCreate,
+				apply: func(tx *gorm.DB) error {
+					if err := checkGroupMaxTokenNum(tx, desired.GroupID); err != nil {
+						return err
+					}
+
+					return tx.Create(&desired).Error
+				},
+			})
+
+			continue
+		}
+
+		normalizeTokenTimes(&current)
+		normalizeTokenTimes(&desired)
+
+		fields, err := diffJSONFields(current, desired, tokenYAMLFields...)
+		if err != nil {
+			return err
+		}
+
+		if desired.Key != "" && desired.Key != current.Key {
+			fields = append(fields, "key")
+		}
+
+		if len(fields) == 0 {
+			continue
+		}
+
+		desired.ID = current.ID
+
+		selects := fields
+		if slices.Contains(fields, "period_quota") &&
+			desired.PeriodQuota > 0 &&
+			current.PeriodLastUpdateTime.IsZero() {
+			desired.PeriodLastUpdateTime = time.Now()
+			selects = append(slices.Clone(fields), "period_last_update_time")
+		}
+
+		plan.add(YAMLConfigChange{
+			Kind:   YAMLConfigChangeKindToken,
+			ID:     id,
+			Action: YAMLConfigChangeActionUpdate,
+			Fields: fields,
+			apply: func(tx *gorm.DB) error {
+				return tx.Model(&Token{}).
+					Where("id = ?", desired.ID).
+					Select(selects).
+					Updates(&desired).
+					Error
+			},
+			applied: func() { cacheDeleteTokenKeys(current) },
+		})
+	}
+
+	return nil
+}
+
+func planGroupModelConfigs(
+	plan *YAMLConfigPlan,
+	item *GroupItem,
+	currentModelConfigs []GroupModelConfig,
+	prune bool,
+) error {
+	currentByModel := make(map[string]GroupModelConfig, len(currentModelConfigs))
+	for _, modelConfig := range currentModelConfigs {
+		currentByModel[modelConfig.Model] = modelConfig
+	}
+
+	for _, modelConfig := range item.ModelConfigs {
+		desired := modelConfig
+		desired.GroupID = item.ID
+		desired.Group = nil
+
+		id := item.ID + "/" + desired.Model
+		applied := func() { cacheDeleteGroupLogError(item.ID) }
+
+		current, ok := currentByModel[desired.Model]
+		if !ok {
+			plan.add(YAMLConfigChange{
+				Kind:   YAMLConfigChangeKindGroupModelConfig,
+				ID:     id,
+				Action: YAMLConfigChangeActionCreate,
+				apply: func(tx *gorm.DB) error {
+					return tx.Create(&desired).Error
+				},
+				applied: applied,
+			})
+
+			continue
+		}
+
+		delete(currentByModel, desired.Model)
+
+		fields, err := diffJSONFields(current, desired)
+		if err != nil {
+			return err
+		}
+
+		if len(fields) == 0 {
+			continue
+		}
+
+		plan.add(YAMLConfigChange{
+			Kind:   YAMLConfigChangeKindGroupModelConfig,
+			ID:     id,
+			Action: YAMLConfigChangeActionUpdate,
+			Fields: fields,
+			apply: func(tx *gorm.DB) error {
+				return tx.Save(&desired).Error
+			},
+			applied: applied,
+		})
+	}
+
+	if !prune {
+		return nil
+	}
+
+	groupID := item.ID
+
+	for _, modelName := range slices.Sorted(maps.Keys(currentByModel)) {
+		plan.add(YAMLConfigChange{
+			Kind:   YAMLConfigChangeKindGroupModelConfig,
+			ID:     groupID + "/" + modelName,
+			Action: YAMLConfigChangeActionDelete,
+			apply: func(tx *gorm.DB) error {
+				return tx.
+					Where("group_id = ? AND model = ?", groupID, modelName).
+					Delete(&GroupModelConfig{}).
+					Error
+			},
+			applied: func() { cacheDeleteGroupLogError(groupID) },
+		})
+	}
+
+	return nil
+}
+
+func planPublicMCPs(plan *YAMLConfigPlan, items []PublicMCPItem, prune bool) error {
+	var currentMCPs []PublicMCP
+	if err := DB.Find(&currentMCPs).Error; err != nil {
+		return err
+	}
+
+	currentByID := make(map[string]PublicMCP, len(currentMCPs))
+	for _, mcp := range currentMCPs {
+		currentByID[mcp.ID] = mcp
+	}
+
+	for _, item := range items {
+		desired := item.PublicMCP
+		if desired.Status == 0 {
+			desired.Status = PublicMCPStatusEnabled
+		}
+
+		applied := func() {
+			if err := CacheDeletePublicMCP(desired.ID); err != nil {
+				log.Error("cache delete public mcp error: " + err.Error())
+			}
+		}
+
+		current, ok := currentByID[desired.ID]
+		if !ok {
+			plan.add(YAMLConfigChange{
+				Kind:   YAMLConfigChangeKindPublicMCP,
+				ID:     desired.ID,
+				Action: YAMLConfigChangeActionCreate,
+				apply: func(tx *gorm.DB) error {
+					return tx.Create(&desired).Error
+				},
+				applied: applied,
+			})
+
+			continue
+		}
+
+		delete(currentByID, desired.ID)
+
+		desired.CreatedAt = current.CreatedAt
+		desired.UpdateAt = current.UpdateAt
+
+		fields, err := diffJSONFields(current, desired)
+		if err != nil {
+			return err
+		}
+
+		if len(fields) == 0 {
+			continue
+		}
+
+		plan.add(YAMLConfigChange{
+			Kind:   YAMLConfigChangeKindPublicMCP,
+			ID:     desired.ID,
+			Action: YAMLConfigChangeActionUpdate,
+			Fields: fields,
+			apply: func(tx *gorm.DB) error {
+				return tx.
+					Omit(
+						"created_at",
+						"update_at",
+					).
+					Save(&desired).Error
+			},
+			applied: applied,
+		})
+	}
+
+	if !prune {
+		return nil
+	}
+
+	for _, id := range slices.Sorted(maps.Keys(currentByID)) {
+		plan.add(YAMLConfigChange{
+			Kind:   YAMLConfigChangeKindPublicMCP,
+			ID:     id,
+			Action: YAMLConfigChangeActionDelete,
+			apply: func(tx *gorm.DB) error {
+				return tx.Delete(&PublicMCP{ID: id}).Error
+			},
+			applied: func() {
+				if err := CacheDeletePublicMCP(id); err != nil {
+					log.Error("cache delete public mcp error: " + err.Error())
+				}
+			},
+		})
+	}
+
+	return nil
+}
+
+func toJSONMap(v any) (map[string]any, error) {
+	data, err := sonic.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+
+	m := make(map[string]any)
+
+	return m, sonic.Unmarshal(data, &m)
+}
+
+func isEmptyJSONValue(v any) bool {
+	switch v := v.(type) {
+	case nil:
+		return true
+	case []any:
+		return len(v) == 0
+	case map[string]any:
+		return len(v) == 0
+	default:
+		return false
+	}
+}
+
+// diffJSONFields returns the sorted json fields that differ between current
+// and desired, all fields are compared when no fields are given
+func diffJSONFields(current, desired any, fields ...string) ([]string, error) {
+	currentMap, err := toJSONMap(current)
+	if err != nil {
+		return nil, err
+	}
+
+	desiredMap, err := toJSONMap(desired)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(fields) == 0 {
+		keys := make(map[string]struct{}, len(currentMap)+len(desiredMap))
+		for key := range currentMap {
+			keys[key] = struct{}{}
+		}
+
+		for key := range desiredMap {
+			keys[key] = struct{}{}
+		}
+
+		fields = slices.Sorted(maps.Keys(keys))
+	}
+
+	changed := []string{}
+
+	for _, field := range fields {
+		currentValue, desiredValue := currentMap[field], desiredMap[field]
+		if isEmptyJSONValue(currentValue) && isEmptyJSONValue(desiredValue) {
+			continue
+		}
+
+		if !reflect.DeepEqual(currentValue, desiredValue) {
+			changed = append(changed, field)
+		}
+	}
+
+	return changed, nil
+}
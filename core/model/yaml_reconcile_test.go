@@ -0,0 +1,200 @@
+package model_test
+
+import (
+	"testing"
+
+	"github.com/labring/aiproxy/core/common/config"
+	"github.com/labring/aiproxy/core/model"
+	"github.com/stretchr/testify/require"
+)
+
+const reconcileYAML = `
+groups:
+  - id: team-a
+    rpm_ratio: 2
+    available_sets: [default]
+    mcp_acl:
+      allow_mcps: [weather]
+    tokens:
+      - name: ci
+        models: [gpt-4o]
+        rpm: 10
+        mcp_acl:
+          deny_tools: [weather/delete_*]
+        expired_at: 2099-01-01T00:00:00Z
+      - name: fixed
+        key: "000000000000000000000000000000000000000000000000"
+    model_configs:
+      - model: gpt-4o
+        override_limit: true
+        rpm: 100
+publicmcps:
+  - id: weather
+    name: Weather
+    type: mcp_proxy_sse
+    proxy_config:
+      url: https://weather.example.com/sse
+`
+
+func planSummary(plan *model.YAMLConfigPlan) []string {
+	summary := make([]string, 0, len(plan.Changes))
+	for _, change := range plan.Changes {
+		summary = append(
+			summary,
+			string(change.Action)+" "+string(change.Kind)+" "+change.ID,
+		)
+	}
+
+	return summary
+}
+
+func TestApplyYAMLConfig(t *testing.T) {
+	setupTokenTestDB(t)
+	require.NoError(t, model.DB.AutoMigrate(
+		&model.GroupModelConfig{},
+		&model.PublicMCP{},
+		&model.PublicMCPReusingParam{},
+	))
+
+	yamlConfig, err := model.ParseYAMLConfig([]byte(reconcileYAML))
+	require.NoError(t, err)
+
+	plan, err := model.PlanYAMLConfig(yamlConfig, false)
+	require.NoError(t, err)
+	require.Equal(t, []string{
+		"create group team-a",
+		"create token team-a/ci",
+		"create token team-a/fixed",
+		"create group_model_config team-a/gpt-4o",
+		"create public_mcp weather",
+	}, planSummary(plan))
+
+	// plan does not touch the database
+	_, err = model.GetGroupByID("team-a", false)
+	require.Error(t, err)
+
+	_, err = model.ApplyYAMLConfig(yamlConfig, false)
+	require.NoError(t, err)
+
+	group, err := model.GetGroupByID("team-a", true)
+	require.NoError(t, err)
+	require.InDelta(t, 2, group.RPMRatio, 1e-9)
+	require.Equal(t, []string{"default"}, group.AvailableSets)
+	require.Equal(t, []string{"weather"}, group.MCPACL.AllowMCPs)
+	require.Len(t, group.GroupModelConfigs, 1)
+	require.Equal(t, int64(100), group.GroupModelConfigs[0].RPM)
+
+	fixed, err := model.GetAndValidateToken("000000000000000000000000000000000000000000000000")
+	require.NoError(t, err)
+	require.Equal(t, "fixed", fixed.Name)
+
+	mcp, err := model.GetPublicMCPByID("weather")
+	require.NoError(t, err)
+	require.Equal(t, model.PublicMCPStatusEnabled, mcp.Status)
+
+	// applying the same config again is a no-op
+	plan, err = model.PlanYAMLConfig(yamlConfig, true)
+	require.NoError(t, err)
+	require.Empty(t, plan.Changes)
+
+	extra := &model.Token{GroupID: "team-a", Name: "manual"}
+	require.NoError(t, model.InsertToken(extra, false, false))
+
+	yamlConfig.Groups[0].RPMRatio = 3
+	yamlConfig.Groups[0].MCPACL = model.MCPACL{}
+	yamlConfig.Groups[0].Tokens[0].RPM = 20
+	yamlConfig.Groups[0].Tokens[0].MCPACL.DenyTools = []string{"weather/*"}
+	yamlConfig.Groups[0].ModelConfigs = nil
+	yamlConfig.PublicMCPs = nil
+
+	plan, err = model.PlanYAMLConfig(yamlConfig, false)
+	require.NoError(t, err)
+	require.Equal(t, []string{
+		"update group team-a",
+		"update token team-a/ci",
+	}, planSummary(plan))
+	require.Equal(t, []string{"rpm_ratio", "mcp_acl"}, plan.Changes[0].Fields)
+	require.Equal(t, []string{"rpm", "mcp_acl"}, plan.Changes[1].Fields)
+
+	plan, err = model.ApplyYAMLConfig(yamlConfig, true)
+	require.NoError(t, err)
+	require.Equal(t, []string{
+		"update group team-a",
+		"delete token team-a/manual",
+		"update token team-a/ci",
+		"delete group_model_config team-a/gpt-4o",
+		"delete public_mcp weather",
+	}, planSummary(plan))
+
+	_, err = model.GetTokenByID(extra.ID)
+	require.Error(t, err)
+
+	group, err = model.GetGroupByID("team-a", false)
+	require.NoError(t, err)
+	require.True(t, group.MCPACL.IsEmpty())
+
+	configs, err := model.GetGroupModelConfigs("team-a")
+	require.NoError(t, err)
+	require.Empty(t, configs)
+
+	_, err = model.GetPublicMCPByID("weather")
+	require.Error(t, err)
+
+	var ci model.Token
+	require.NoError(t, model.DB.Where("group_id = ? AND name = ?", "team-a", "ci").First(&ci).Error)
+	require.Equal(t, int64(20), ci.RPM)
+	require.Equal(t, []string{"gpt-4o"}, ci.Models)
+	require.Equal(t, []string{"weather/*"}, ci.MCPACL.DenyTools)
+}
+
+func TestApplyYAMLConfigGroupMaxTokenNum(t *testing.T) {
+	setupTokenTestDB(t)
+	require.NoError(t, model.DB.AutoMigrate(
+		&model.GroupModelConfig{},
+		&model.PublicMCP{},
+		&model.PublicMCPReusingParam{},
+	))
+
+	maxTokenNum := config.GetGroupMaxTokenNum()
+	config.SetGroupMaxTokenNum(1)
+	t.Cleanup(func() { config.SetGroupMaxTokenNum(maxTokenNum) })
+
+	yamlConfig, err := model.ParseYAMLConfig([]byte(
+		"groups:\n  - id: team-b\n    tokens:\n      - name: a\n      - name: b\n",
+	))
+	require.NoError(t, err)
+
+	_, err = model.ApplyYAMLConfig(yamlConfig, false)
+	require.ErrorContains(t, err, "group max token num reached")
+
+	_, err = model.GetGroupByID("team-b", false)
+	require.Error(t, err)
+
+	// the pruned tokens make room for the new ones
+	yamlConfig.Groups[0].Tokens = yamlConfig.Groups[0].Tokens[:1]
+	_, err = model.ApplyYAMLConfig(yamlConfig, false)
+	require.NoError(t, err)
+
+	yamlConfig.Groups[0].Tokens[0].Name = "c"
+	plan, err := model.ApplyYAMLConfig(yamlConfig, true)
+	require.NoError(t, err)
+	require.Equal(t, []string{
+		"delete token team-b/a",
+		"create token team-b/c",
+	}, planSummary(plan))
+}
+
+func TestPlanYAMLConfigValidation(t *testing.T) {
+	for _, doc := range []string{
+		"groups:\n  - id: a\n  - id: a\n",
+		"groups:\n  - id: a\n    tokens:\n      - name: t\n      - name: t\n",
+		"groups:\n  - id: a\n    tokens:\n      - name: t\n        key: short\n",
+		"publicmcps:\n  - id: Bad ID\n",
+	} {
+		yamlConfig, err := model.ParseYAMLConfig([]byte(doc))
+		require.NoError(t, err)
+
+		_, err = model.PlanYAMLConfig(yamlConfig, false)
+		require.Error(t, err, doc)
+	}
+}
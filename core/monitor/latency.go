@@ -0,0 +1,440 @@
+package monitor
+
+import (
+	"context"
+	"errors"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/labring/aiproxy/core/common"
+	gcache "github.com/patrickmn/go-cache"
+	"github.com/redis/go-redis/v9"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// latencyWindow is how long a ttfb sample is kept for the percentiles
+	latencyWindow = 5 * time.Minute
+	// maxChannelLatencySamples caps the samples of a channel and model, so a busy
+	// channel can't push out the samples of the other channels of the model
+	maxChannelLatencySamples = 256
+	latencyKeyPrefix         = "latency:"
+	// latencyChannelsKeyPrefix is the set of the channels with samples of a model
+	latencyChannelsKeyPrefix = "latency_channels:"
+	// latencyQueueSize is the samples waiting to be written to redis, the samples are
+	// dropped once the queue is full
+	latencyQueueSize = 4096
+	// latencyFlushSize and latencyFlushInterval bound how long a sample waits before
+	// it's written to redis in a batch
+	latencyFlushSize     = 256
+	latencyFlushInterval = time.Second
+)
+
+// LatencyPercentiles is the time to first byte of a channel and model in the
+// latency window, in milliseconds
+type LatencyPercentiles struct {
+	Samples int     `json:"samples"`
+	P50     float64 `json:"p50"`
+	P90     float64 `json:"p90"`
+	P95     float64 `json:"p95"`
+	P99     float64 `json:"p99"`
+}
+
+func newLatencyPercentiles(samples []float64) LatencyPercentiles {
+	if len(samples) == 0 {
+		return LatencyPercentiles{}
+	}
+
+	sorted := slices.Clone(samples)
+	slices.Sort(sorted)
+
+	return LatencyPercentiles{
+		Samples: len(sorted),
+		P50:     percentile(sorted, 0.50),
+		P90:     percentile(sorted, 0.90),
+		P95:     percentile(sorted, 0.95),
+		P99:     percentile(sorted, 0.99),
+	}
+}
+
+// percentile uses the nearest rank of the sorted samples
+func percentile(sorted []float64, p float64) float64 {
+	rank := int(math.Ceil(p*float64(len(sorted)))) - 1
+	return sorted[max(rank, 0)]
+}
+
+var latencyLocalCache = gcache.New(2*time.Second, 5*time.Second)
+
+type latencyEntry struct {
+	model     string
+	channelID int64
+	ttfb      time.Duration
+	at        time.Time
+}
+
+var (
+	latencyQueue     = make(chan latencyEntry, latencyQueueSize)
+	latencyFlushOnce sync.Once
+)
+
+// AddChannelModelTTFB records the time the channel took to send the first byte of the
+// response to a request of the model, it never blocks the request, the samples are
+// written to redis in batches by a background goroutine
+func AddChannelModelTTFB(model string, channelID int64, ttfb time.Duration) {
+	entry := latencyEntry{
+		model:     model,
+		channelID: channelID,
+		ttfb:      ttfb,
+		at:        time.Now(),
+	}
+
+	if !common.RedisEnabled {
+		memLatencyMonitor.add(entry.model, entry.channelID, entry.ttfb, entry.at)
+		return
+	}
+
+	latencyFlushOnce.Do(func() {
+		go flushLatencyLoop()
+	})
+
+	select {
+	case latencyQueue <- entry:
+	default:
+		// the percentiles don't need every sample, drop it rather than wait for redis
+	}
+}
+
+func flushLatencyLoop() {
+	ticker := time.NewTicker(latencyFlushInterval)
+	defer ticker.Stop()
+
+	batch := make([]latencyEntry, 0, latencyFlushSize)
+
+	for {
+		select {
+		case entry := <-latencyQueue:
+			batch = append(batch, entry)
+			if len(batch) < latencyFlushSize {
+				continue
+			}
+		case <-ticker.C:
+			if len(batch) == 0 {
+				continue
+			}
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		if err := redisLatencyMonitor.add(ctx, batch); err != nil {
+			log.Errorf("add channel model ttfb failed: %+v", err)
+		}
+
+		cancel()
+
+		batch = batch[:0]
+	}
+}
+
+// GetModelChannelTTFB returns the ttfb percentiles of the channels that recently
+// served the model
+func GetModelChannelTTFB(
+	ctx context.Context,
+	model string,
+) (map[int64]LatencyPercentiles, error) {
+	if !common.RedisEnabled {
+		return memLatencyMonitor.get(model, time.Now()), nil
+	}
+
+	if v, ok := latencyLocalCache.Get(model); ok {
+		if result, ok := v.(map[int64]LatencyPercentiles); ok {
+			return result, nil
+		}
+	}
+
+	result, err := redisLatencyMonitor.get(ctx, model, time.Now())
+	if err != nil {
+		return nil, err
+	}
+
+	latencyLocalCache.Set(model, result, monitorLocalTTL)
+
+	return result, nil
+}
+
+// GetAllModelChannelTTFB returns the ttfb percentiles of all models and channels
+func GetAllModelChannelTTFB(ctx context.Context) (map[string]map[int64]LatencyPercentiles, error) {
+	if !common.RedisEnabled {
+		return memLatencyMonitor.getAll(time.Now()), nil
+	}
+
+	return redisLatencyMonitor.getAll(ctx, time.Now())
+}
+
+type latencySample struct {
+	at time.Time
+	ms float64
+}
+
+type memLatency struct {
+	mu     sync.RWMutex
+	models map[string]map[int64][]latencySample
+}
+
+var memLatencyMonitor = &memLatency{
+	models: make(map[string]map[int64][]latencySample),
+}
+
+func (m *memLatency) add(model string, channelID int64, ttfb time.Duration, now time.Time) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	channels, ok := m.models[model]
+	if !ok {
+		channels = make(map[int64][]latencySample)
+		m.models[model] = channels
+	}
+
+	samples := append(channels[channelID], latencySample{
+		at: now,
+		ms: float64(ttfb.Milliseconds()),
+	})
+
+	cutoff := now.Add(-latencyWindow)
+
+	start := 0
+	for start < len(samples) && samples[start].at.Before(cutoff) {
+		start++
+	}
+
+	start = max(start, len(samples)-maxChannelLatencySamples)
+	if start > 0 {
+		// the samples are moved in place, the slice is reused by the next samples
+		samples = samples[:copy(samples, samples[start:])]
+	}
+
+	channels[channelID] = samples
+}
+
+func (m *memLatency) get(model string, now time.Time) map[int64]LatencyPercentiles {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	return memChannelPercentiles(m.models[model], now)
+}
+
+func (m *memLatency) getAll(now time.Time) map[string]map[int64]LatencyPercentiles {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	result := make(map[string]map[int64]LatencyPercentiles, len(m.models))
+	for model, channels := range m.models {
+		percentiles := memChannelPercentiles(channels, now)
+		if len(percentiles) == 0 {
+			continue
+		}
+
+		result[model] = percentiles
+	}
+
+	return result
+}
+
+func memChannelPercentiles(
+	channels map[int64][]latencySample,
+	now time.Time,
+) map[int64]LatencyPercentiles {
+	cutoff := now.Add(-latencyWindow)
+	result := make(map[int64]LatencyPercentiles, len(channels))
+
+	for channelID, samples := range channels {
+		values := make([]float64, 0, len(samples))
+		for _, sample := range samples {
+			if sample.at.Before(cutoff) {
+				continue
+			}
+
+			values = append(values, sample.ms)
+		}
+
+		if len(values) == 0 {
+			continue
+		}
+
+		result[channelID] = newLatencyPercentiles(values)
+	}
+
+	return result
+}
+
+// redisLatency keeps the samples of a channel and model in a sorted set scored by
+// the request time, the member is `ttfb_ms:unix_nano` so samples never collide, the
+// channels with samples of a model are kept in a set
+type redisLatency struct {
+	getRDB func() *redis.Client
+}
+
+var redisLatencyMonitor = &redisLatency{
+	getRDB: func() *redis.Client { return common.RDB },
+}
+
+func latencyKey(model string, channelID int64) string {
+	return common.RedisKey(latencyKeyPrefix + model + ":" + strconv.FormatInt(channelID, 10))
+}
+
+func latencyChannelsKey(model string) string {
+	return common.RedisKey(latencyChannelsKeyPrefix + model)
+}
+
+type latencyChannel struct {
+	model     string
+	channelID int64
+}
+
+// add writes a batch of samples in one pipeline, the samples of every channel and
+// model are trimmed to the latency window once per batch
+func (m *redisLatency) add(ctx context.Context, entries []latencyEntry) error {
+	pipe := m.getRDB().TxPipeline()
+
+	channels := make(map[latencyChannel]time.Time)
+
+	for _, entry := range entries {
+		member := strconv.FormatInt(entry.ttfb.Milliseconds(), 10) + ":" +
+			strconv.FormatInt(entry.at.UnixNano(), 10)
+
+		pipe.ZAdd(ctx, latencyKey(entry.model, entry.channelID), redis.Z{
+			Score:  float64(entry.at.UnixMilli()),
+			Member: member,
+		})
+
+		channel := latencyChannel{model: entry.model, channelID: entry.channelID}
+		if entry.at.After(channels[channel]) {
+			channels[channel] = entry.at
+		}
+	}
+
+	for channel, now := range channels {
+		key := latencyKey(channel.model, channel.channelID)
+
+		pipe.ZRemRangeByScore(
+			ctx,
+			key,
+			"-inf",
+			strconv.FormatInt(now.Add(-latencyWindow).UnixMilli(), 10),
+		)
+		pipe.ZRemRangeByRank(ctx, key, 0, -maxChannelLatencySamples-1)
+		pipe.PExpire(ctx, key, latencyWindow)
+
+		channelsKey := latencyChannelsKey(channel.model)
+		pipe.SAdd(ctx, channelsKey, channel.channelID)
+		pipe.PExpire(ctx, channelsKey, latencyWindow)
+	}
+
+	_, err := pipe.Exec(ctx)
+
+	return err
+}
+
+func (m *redisLatency) get(
+	ctx context.Context,
+	model string,
+	now time.Time,
+) (map[int64]LatencyPercentiles, error) {
+	rdb := m.getRDB()
+
+	channelIDs, err := rdb.SMembers(ctx, latencyChannelsKey(model)).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	result := make(map[int64]LatencyPercentiles, len(channelIDs))
+	if len(channelIDs) == 0 {
+		return result, nil
+	}
+
+	rangeBy := &redis.ZRangeBy{
+		Min: strconv.FormatInt(now.Add(-latencyWindow).UnixMilli(), 10),
+		Max: "+inf",
+	}
+
+	pipe := rdb.Pipeline()
+
+	cmds := make(map[int64]*redis.StringSliceCmd, len(channelIDs))
+	for _, v := range channelIDs {
+		channelID, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			continue
+		}
+
+		cmds[channelID] = pipe.ZRangeByScore(ctx, latencyKey(model, channelID), rangeBy)
+	}
+
+	if _, err := pipe.Exec(ctx); err != nil && !errors.Is(err, redis.Nil) {
+		return nil, err
+	}
+
+	for channelID, cmd := range cmds {
+		samples := parseLatencyMembers(cmd.Val())
+		if len(samples) == 0 {
+			continue
+		}
+
+		result[channelID] = newLatencyPercentiles(samples)
+	}
+
+	return result, nil
+}
+
+func (m *redisLatency) getAll(
+	ctx context.Context,
+	now time.Time,
+) (map[string]map[int64]LatencyPercentiles, error) {
+	rdb := m.getRDB()
+	prefix := common.RedisKey(latencyChannelsKeyPrefix)
+	result := make(map[string]map[int64]LatencyPercentiles)
+
+	iter := rdb.Scan(ctx, 0, prefix+"*", 0).Iterator()
+	for iter.Next(ctx) {
+		model := strings.TrimPrefix(iter.Val(), prefix)
+
+		percentiles, err := m.get(ctx, model, now)
+		if err != nil {
+			return nil, err
+		}
+
+		if len(percentiles) == 0 {
+			continue
+		}
+
+		result[model] = percentiles
+	}
+
+	if err := iter.Err(); err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// parseLatencyMembers returns the ttfb of the samples of a channel, in milliseconds
+func parseLatencyMembers(members []string) []float64 {
+	samples := make([]float64, 0, len(members))
+
+	for _, member := range members {
+		msStr, _, ok := strings.Cut(member, ":")
+		if !ok {
+			continue
+		}
+
+		ms, err := strconv.ParseFloat(msStr, 64)
+		if err != nil {
+			continue
+		}
+
+		samples = append(samples, ms)
+	}
+
+	return samples
+}
@@ -0,0 +1,70 @@
+//nolint:testpackage
+package monitor
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewLatencyPercentilesUsesNearestRank(t *testing.T) {
+	samples := make([]float64, 0, 100)
+	for i := 100; i > 0; i-- {
+		samples = append(samples, float64(i))
+	}
+
+	p := newLatencyPercentiles(samples)
+	require.Equal(t, 100, p.Samples)
+	require.InDelta(t, 50, p.P50, 0)
+	require.InDelta(t, 90, p.P90, 0)
+	require.InDelta(t, 95, p.P95, 0)
+	require.InDelta(t, 99, p.P99, 0)
+
+	require.Equal(t, LatencyPercentiles{}, newLatencyPercentiles(nil))
+}
+
+func TestMemLatencyDropsExpiredSamples(t *testing.T) {
+	m := &memLatency{models: make(map[string]map[int64][]latencySample)}
+	now := time.Now()
+
+	m.add("model", 1, 5*time.Second, now.Add(-latencyWindow-time.Second))
+	m.add("model", 1, 100*time.Millisecond, now)
+	m.add("model", 2, 300*time.Millisecond, now)
+
+	result := m.get("model", now)
+	require.Len(t, result, 2)
+	require.Equal(t, 1, result[1].Samples)
+	require.InDelta(t, 100, result[1].P95, 0)
+	require.InDelta(t, 300, result[2].P50, 0)
+
+	require.Empty(t, m.get("model", now.Add(latencyWindow+time.Second)))
+	require.Empty(t, m.getAll(now.Add(latencyWindow+time.Second)))
+}
+
+func TestMemLatencyCapsSamples(t *testing.T) {
+	m := &memLatency{models: make(map[string]map[int64][]latencySample)}
+	now := time.Now()
+
+	for i := range maxChannelLatencySamples + 10 {
+		m.add("model", 1, time.Duration(i)*time.Millisecond, now)
+	}
+
+	samples := m.models["model"][1]
+	require.Len(t, samples, maxChannelLatencySamples)
+	// the oldest samples are dropped in place
+	require.InDelta(t, 10, samples[0].ms, 0)
+	require.LessOrEqual(t, cap(samples), 2*maxChannelLatencySamples)
+	require.Equal(t, maxChannelLatencySamples, m.getAll(now)["model"][1].Samples)
+}
+
+func TestParseLatencyMembers(t *testing.T) {
+	result := parseLatencyMembers([]string{
+		"100:1",
+		"200:2",
+		"invalid",
+		"x:4",
+	})
+
+	require.Equal(t, []float64{100, 200}, result)
+}
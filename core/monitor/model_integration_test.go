@@ -429,6 +429,46 @@ func TestRedisMonitorGetBannedChannelsMapWithModelKeepsLocalCacheUntilTTL(t *tes
 	require.NotContains(t, banned, int64(909))
 }
 
+func TestRedisLatencyCapsSamplesPerChannel(t *testing.T) {
+	ctx := context.Background()
+
+	redisClient, cleanup := setupRedisForMonitorTest(t, ctx)
+	defer cleanup()
+
+	latency := &redisLatency{getRDB: func() *redis.Client { return redisClient }}
+	now := time.Now()
+
+	entries := make([]latencyEntry, 0, maxChannelLatencySamples+11)
+	for i := range maxChannelLatencySamples + 10 {
+		entries = append(entries, latencyEntry{
+			model:     "model-latency",
+			channelID: 1,
+			ttfb:      time.Duration(i) * time.Millisecond,
+			at:        now.Add(time.Duration(i) * time.Microsecond),
+		})
+	}
+
+	entries = append(entries, latencyEntry{
+		model:     "model-latency",
+		channelID: 2,
+		ttfb:      300 * time.Millisecond,
+		at:        now,
+	})
+	require.NoError(t, latency.add(ctx, entries))
+
+	result, err := latency.get(ctx, "model-latency", now)
+	require.NoError(t, err)
+	require.Len(t, result, 2)
+	// the busy channel doesn't push out the samples of the quiet one
+	require.Equal(t, maxChannelLatencySamples, result[1].Samples)
+	require.Equal(t, 1, result[2].Samples)
+	require.InDelta(t, 300, result[2].P50, 0)
+
+	all, err := latency.getAll(ctx, now)
+	require.NoError(t, err)
+	require.Equal(t, result, all["model-latency"])
+}
+
 func newTestRedisModelMonitor(client *redis.Client) *redisModelMonitor {
 	return newRedisModelMonitor(func() *redis.Client {
 		return client
@@ -39,6 +39,7 @@ func (a *Adaptor) SupportMode(mt *meta.Meta) bool {
 
 	return m == mode.ChatCompletions ||
 		m == mode.Anthropic ||
+		m == mode.AnthropicCountTokens ||
 		m == mode.Gemini
 }
 
@@ -55,6 +56,9 @@ func (a *Adaptor) GetRequestURL(
 	}
 
 	result := pu.JoinPath("/messages")
+	if meta.Mode == mode.AnthropicCountTokens {
+		result = pu.JoinPath("/messages/count_tokens")
+	}
 
 	beta := c.Query("beta")
 
@@ -199,6 +203,8 @@ func (a *Adaptor) ConvertRequest(
 		}, nil
 	case mode.Anthropic:
 		return convertRequest(meta, req, cfg)
+	case mode.AnthropicCountTokens:
+		return convertCountTokensRequest(meta, req, cfg)
 	case mode.Gemini:
 		return ConvertGeminiRequest(meta, req)
 	default:
@@ -232,6 +238,8 @@ func (a *Adaptor) DoResponse(
 			return StreamHandler(meta, c, resp)
 		}
 		return Handler(meta, c, resp)
+	case mode.AnthropicCountTokens:
+		return CountTokensHandler(meta, c, resp)
 	case mode.Gemini:
 		if utils.IsStreamResponse(resp) {
 			return GeminiStreamHandler(meta, c, resp)
@@ -248,7 +256,7 @@ func (a *Adaptor) DoResponse(
 
 func (a *Adaptor) Metadata() adaptor.Metadata {
 	return adaptor.Metadata{
-		Readme: "Support native Endpoint: /v1/messages",
+		Readme: "Support native Endpoint: /v1/messages, /v1/messages/count_tokens",
 		Models: ModelList,
 		ConfigSchema: map[string]any{
 			"type": "object",
@@ -0,0 +1,73 @@
+package anthropic
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/bytedance/sonic/ast"
+	"github.com/gin-gonic/gin"
+	"github.com/labring/aiproxy/core/common"
+	"github.com/labring/aiproxy/core/relay/adaptor"
+	"github.com/labring/aiproxy/core/relay/meta"
+	relaymodel "github.com/labring/aiproxy/core/relay/model"
+)
+
+// countTokensUnsupportedFields are the generation params of a messages request,
+// count_tokens rejects them
+var countTokensUnsupportedFields = []string{
+	"max_tokens",
+	"stream",
+	"temperature",
+	"top_p",
+	"top_k",
+	"stop_sequences",
+	"metadata",
+	"service_tier",
+}
+
+// RemoveCountTokensUnsupportedFields removes the fields that count_tokens doesn't accept
+func RemoveCountTokensUnsupportedFields(node *ast.Node) error {
+	for _, field := range countTokensUnsupportedFields {
+		if _, err := node.Unset(field); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func convertCountTokensRequest(
+	meta *meta.Meta,
+	req *http.Request,
+	cfg Config,
+) (adaptor.ConvertResult, error) {
+	return convertRequest(meta, req, cfg, RemoveCountTokensUnsupportedFields)
+}
+
+// CountTokensHandler replies the count_tokens response as is, counting tokens is not billed
+func CountTokensHandler(
+	_ *meta.Meta,
+	c *gin.Context,
+	resp *http.Response,
+) (adaptor.DoResponseResult, adaptor.Error) {
+	if resp.StatusCode != http.StatusOK {
+		return adaptor.DoResponseResult{}, ErrorHandler(resp)
+	}
+
+	defer resp.Body.Close()
+
+	respBody, err := common.GetResponseBody(resp)
+	if err != nil {
+		return adaptor.DoResponseResult{}, relaymodel.WrapperAnthropicError(
+			err,
+			"read_response_failed",
+			http.StatusInternalServerError,
+		)
+	}
+
+	c.Writer.Header().Set("Content-Type", "application/json")
+	c.Writer.Header().Set("Content-Length", strconv.Itoa(len(respBody)))
+	_, _ = c.Writer.Write(respBody)
+
+	return adaptor.DoResponseResult{}, nil
+}
@@ -0,0 +1,75 @@
+package anthropic_test
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/bytedance/sonic"
+	"github.com/gin-gonic/gin"
+	"github.com/labring/aiproxy/core/model"
+	"github.com/labring/aiproxy/core/relay/adaptor/anthropic"
+	"github.com/labring/aiproxy/core/relay/meta"
+	"github.com/labring/aiproxy/core/relay/mode"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCountTokensRequest(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	a := &anthropic.Adaptor{}
+	m := meta.NewMeta(
+		&model.Channel{BaseURL: "https://api.anthropic.com/v1"},
+		mode.AnthropicCountTokens,
+		"claude-sonnet-4-5",
+		model.ModelConfig{},
+	)
+	m.ActualModel = "claude-sonnet-4-5-20250929"
+
+	require.True(t, a.SupportMode(m))
+
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequestWithContext(
+		t.Context(),
+		http.MethodPost,
+		"/v1/messages/count_tokens",
+		nil,
+	)
+
+	requestURL, err := a.GetRequestURL(m, nil, c)
+	require.NoError(t, err)
+	assert.Equal(t, http.MethodPost, requestURL.Method)
+	assert.Equal(t, "https://api.anthropic.com/v1/messages/count_tokens", requestURL.URL)
+
+	req := httptest.NewRequestWithContext(
+		t.Context(),
+		http.MethodPost,
+		"/v1/messages/count_tokens",
+		bytes.NewBufferString(`{
+			"model":"claude-sonnet-4-5",
+			"max_tokens":1024,
+			"stream":true,
+			"temperature":0.5,
+			"system":"You are a helpful assistant.",
+			"messages":[{"role":"user","content":"Hello"}]
+		}`),
+	)
+	req.Header.Set("Content-Type", "application/json")
+
+	result, err := a.ConvertRequest(m, nil, req)
+	require.NoError(t, err)
+
+	body, err := io.ReadAll(result.Body)
+	require.NoError(t, err)
+
+	var converted map[string]any
+	require.NoError(t, sonic.Unmarshal(body, &converted))
+	assert.Equal(t, "claude-sonnet-4-5-20250929", converted["model"])
+	assert.Equal(t, "You are a helpful assistant.", converted["system"])
+	assert.NotContains(t, converted, "max_tokens")
+	assert.NotContains(t, converted, "stream")
+	assert.NotContains(t, converted, "temperature")
+}
@@ -7,6 +7,8 @@ import (
 	"github.com/gin-gonic/gin"
 	"github.com/labring/aiproxy/core/model"
 	"github.com/labring/aiproxy/core/relay/adaptor"
+	claude "github.com/labring/aiproxy/core/relay/adaptor/aws/claude"
+	"github.com/labring/aiproxy/core/relay/adaptor/aws/embedding"
 	"github.com/labring/aiproxy/core/relay/adaptor/aws/utils"
 	"github.com/labring/aiproxy/core/relay/adaptor/registry"
 	"github.com/labring/aiproxy/core/relay/meta"
@@ -26,19 +28,37 @@ func (a *Adaptor) DefaultBaseURL() string {
 }
 
 func (a *Adaptor) SupportMode(mt *meta.Meta) bool {
-	m := adaptor.ModeFromMeta(mt)
+	aa := getModelAdaptor(mt)
+	if aa == nil {
+		return false
+	}
 
-	return m == mode.ChatCompletions ||
-		m == mode.Completions ||
-		m == mode.Anthropic ||
-		m == mode.Gemini
+	switch adaptor.ModeFromMeta(mt) {
+	// only the claude models count tokens natively, the others are estimated locally
+	case mode.AnthropicCountTokens:
+		_, ok := aa.(*claude.Adaptor)
+		return ok
+	case mode.Embeddings:
+		_, ok := aa.(*embedding.Adaptor)
+		return ok
+	// neither InvokeModel nor Converse models convert the legacy completions
+	case mode.ChatCompletions,
+		mode.Anthropic,
+		mode.Gemini:
+		_, ok := aa.(*embedding.Adaptor)
+		return !ok
+	default:
+		return false
+	}
 }
 
-func (a *Adaptor) ConvertRequest(
-	meta *meta.Meta,
-	store adaptor.Store,
-	req *http.Request,
-) (adaptor.ConvertResult, error) {
+// getModelAdaptor returns the adaptor of the model of the request, the origin model
+// is preferred and the actual model is tried when the origin model is unknown
+func getModelAdaptor(meta *meta.Meta) utils.AwsAdapter {
+	if meta == nil {
+		return nil
+	}
+
 	aa := GetAdaptor(
 		relayutils.PreferredModelName(meta.OriginModel, meta.ActualModel),
 	)
@@ -46,12 +66,17 @@ func (a *Adaptor) ConvertRequest(
 		aa = GetAdaptor(meta.ActualModel)
 	}
 
+	return aa
+}
+
+func (a *Adaptor) ConvertRequest(
+	meta *meta.Meta,
+	store adaptor.Store,
+	req *http.Request,
+) (adaptor.ConvertResult, error) {
+	aa := getModelAdaptor(meta)
 	if aa == nil {
-		return adaptor.ConvertResult{}, relaymodel.WrapperErrorWithMessage(
-			meta.Mode,
-			http.StatusInternalServerError,
-			"adaptor not found",
-		)
+		return adaptor.ConvertResult{}, fmt.Errorf("unsupported aws model: %s", meta.ActualModel)
 	}
 
 	meta.Set("awsAdapter", aa)
@@ -120,7 +145,7 @@ func (a *Adaptor) Metadata() adaptor.Metadata {
 	}
 
 	return adaptor.Metadata{
-		Readme:  "AWS Bedrock unified adaptor\nRoutes requests to provider-specific Bedrock adaptors by model name\nSupports OpenAI-compatible chat/completions plus Anthropic-compatible and Gemini-compatible request conversion\nKey format: `region|ak|sk` or `region|apikey`",
+		Readme:  "AWS Bedrock unified adaptor\nRoutes requests to provider-specific Bedrock adaptors by model name\nClaude models use InvokeModel, other chat models such as Llama, Mistral, Nova, Titan and Cohere use the Converse API, unknown models are rejected\nTitan and Cohere embedding models use InvokeModel and only serve embeddings\nSupports OpenAI-compatible chat/completions and embeddings plus Anthropic-compatible and Gemini-compatible request conversion\nKey format: `region|ak|sk` or `region|apikey`",
 		Models:  models,
 		KeyHelp: "region|ak|sk or region|apikey",
 	}
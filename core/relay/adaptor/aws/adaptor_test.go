@@ -0,0 +1,82 @@
+package aws_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	coremodel "github.com/labring/aiproxy/core/model"
+	"github.com/labring/aiproxy/core/relay/adaptor/aws"
+	"github.com/labring/aiproxy/core/relay/meta"
+	"github.com/labring/aiproxy/core/relay/mode"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSupportModeCountTokens(t *testing.T) {
+	t.Parallel()
+
+	a := &aws.Adaptor{}
+
+	supports := func(modelName string) bool {
+		return a.SupportMode(meta.NewMeta(
+			&coremodel.Channel{},
+			mode.AnthropicCountTokens,
+			modelName,
+			coremodel.ModelConfig{},
+		))
+	}
+
+	assert.True(t, supports("claude-3-haiku-20240307"))
+	assert.False(t, supports("nova-lite"))
+}
+
+func TestSupportModeByModelFamily(t *testing.T) {
+	t.Parallel()
+
+	a := &aws.Adaptor{}
+
+	supports := func(m mode.Mode, modelName string) bool {
+		return a.SupportMode(meta.NewMeta(
+			&coremodel.Channel{},
+			m,
+			modelName,
+			coremodel.ModelConfig{},
+		))
+	}
+
+	assert.True(t, supports(mode.Embeddings, "titan-embed-text-v2"))
+	assert.True(t, supports(mode.Embeddings, "cohere.embed-english-v3"))
+	assert.False(t, supports(mode.Embeddings, "claude-3-haiku-20240307"))
+	assert.False(t, supports(mode.Embeddings, "nova-lite"))
+
+	assert.True(t, supports(mode.ChatCompletions, "nova-lite"))
+	assert.True(t, supports(mode.Anthropic, "claude-3-haiku-20240307"))
+	assert.False(t, supports(mode.ChatCompletions, "titan-embed-text-v2"))
+	assert.False(t, supports(mode.Completions, "nova-lite"))
+	assert.False(t, supports(mode.Completions, "claude-3-haiku-20240307"))
+
+	assert.False(t, supports(mode.ChatCompletions, "unknown-model"))
+	assert.False(t, supports(mode.Embeddings, "unknown-model"))
+}
+
+func TestConvertRequestRejectsUnknownModel(t *testing.T) {
+	t.Parallel()
+
+	m := meta.NewMeta(
+		&coremodel.Channel{},
+		mode.ChatCompletions,
+		"unknown-model",
+		coremodel.ModelConfig{},
+	)
+	req := httptest.NewRequestWithContext(
+		t.Context(),
+		http.MethodPost,
+		"/v1/chat/completions",
+		strings.NewReader(`{"model":"unknown-model","messages":[]}`),
+	)
+
+	_, err := (&aws.Adaptor{}).ConvertRequest(m, nil, req)
+	require.ErrorContains(t, err, "unsupported aws model")
+}
@@ -7,6 +7,7 @@ import (
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/service/bedrockruntime"
+	"github.com/aws/aws-sdk-go-v2/service/bedrockruntime/types"
 	"github.com/bytedance/sonic"
 	"github.com/bytedance/sonic/ast"
 	"github.com/gin-gonic/gin"
@@ -45,7 +46,7 @@ func (a *Adaptor) ConvertRequest(
 	switch meta.Mode {
 	case mode.ChatCompletions:
 		data, err = handleChatCompletionsRequest(meta, request)
-	case mode.Anthropic:
+	case mode.Anthropic, mode.AnthropicCountTokens:
 		data, err = handleAnthropicRequest(meta, request)
 	case mode.Gemini:
 		data, err = handleGeminiRequest(meta, request)
@@ -197,7 +198,31 @@ func (a *Adaptor) DoRequest(
 		)
 	}
 
-	if meta.GetBool("stream") {
+	switch {
+	case meta.Mode == mode.AnthropicCountTokens:
+		// count tokens only accepts the foundation model id, not the inference profile
+		awsReq := &bedrockruntime.CountTokensInput{
+			ModelId: aws.String(awsFoundationModelID(meta.ActualModel)),
+			Input: &types.CountTokensInputMemberInvokeModel{
+				Value: types.InvokeModelTokensRequest{
+					Body: body,
+				},
+			},
+		}
+
+		awsResp, err := awsClient.CountTokens(c.Request.Context(), awsReq)
+		if err != nil {
+			code, errmessage := utils.UnwrapInvokeError(err)
+
+			return nil, relaymodel.WrapperErrorWithMessage(
+				meta.Mode,
+				code,
+				errmessage,
+			)
+		}
+
+		meta.Set(ResponseOutput, awsResp)
+	case meta.GetBool("stream"):
 		awsReq := &bedrockruntime.InvokeModelWithResponseStreamInput{
 			ModelId:     aws.String(awsModelID),
 			ContentType: aws.String("application/json"),
@@ -206,7 +231,7 @@ func (a *Adaptor) DoRequest(
 
 		awsResp, err := awsClient.InvokeModelWithResponseStream(c.Request.Context(), awsReq)
 		if err != nil {
-			code, errmessage := UnwrapInvokeError(err)
+			code, errmessage := utils.UnwrapInvokeError(err)
 
 			return nil, relaymodel.WrapperErrorWithMessage(
 				meta.Mode,
@@ -216,7 +241,7 @@ func (a *Adaptor) DoRequest(
 		}
 
 		meta.Set(ResponseOutput, awsResp)
-	} else {
+	default:
 		awsReq := &bedrockruntime.InvokeModelInput{
 			ModelId:     aws.String(awsModelID),
 			ContentType: aws.String("application/json"),
@@ -225,7 +250,7 @@ func (a *Adaptor) DoRequest(
 
 		awsResp, err := awsClient.InvokeModel(c.Request.Context(), awsReq)
 		if err != nil {
-			code, errmessage := UnwrapInvokeError(err)
+			code, errmessage := utils.UnwrapInvokeError(err)
 
 			return nil, relaymodel.WrapperErrorWithMessage(
 				meta.Mode,
@@ -257,6 +282,8 @@ func (a *Adaptor) DoResponse(
 			return StreamHandler(meta, c)
 		}
 		return Handler(meta, c)
+	case mode.AnthropicCountTokens:
+		return CountTokensHandler(meta, c)
 	case mode.Gemini:
 		if meta.GetBool("stream") {
 			return GeminiStreamHandler(meta, c)
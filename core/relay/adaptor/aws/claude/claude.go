@@ -6,6 +6,7 @@ import (
 	"strconv"
 	"strings"
 
+	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/service/bedrockruntime"
 	"github.com/aws/aws-sdk-go-v2/service/bedrockruntime/types"
 	"github.com/gin-gonic/gin"
@@ -52,6 +53,33 @@ func Handler(meta *meta.Meta, c *gin.Context) (adaptor.DoResponseResult, adaptor
 	}, nil
 }
 
+// CountTokensHandler replies the bedrock count tokens result in the anthropic format
+func CountTokensHandler(meta *meta.Meta, c *gin.Context) (adaptor.DoResponseResult, adaptor.Error) {
+	resp, ok := meta.Get(ResponseOutput)
+	if !ok {
+		return adaptor.DoResponseResult{}, relaymodel.WrapperOpenAIErrorWithMessage(
+			"missing response",
+			nil,
+			http.StatusInternalServerError,
+		)
+	}
+
+	awsResp, ok := resp.(*bedrockruntime.CountTokensOutput)
+	if !ok {
+		return adaptor.DoResponseResult{}, relaymodel.WrapperOpenAIErrorWithMessage(
+			"unknow response type",
+			nil,
+			http.StatusInternalServerError,
+		)
+	}
+
+	c.JSON(http.StatusOK, relaymodel.ClaudeCountTokensResponse{
+		InputTokens: int64(aws.ToInt32(awsResp.InputTokens)),
+	})
+
+	return adaptor.DoResponseResult{}, nil
+}
+
 func StreamHandler(meta *meta.Meta, c *gin.Context) (adaptor.DoResponseResult, adaptor.Error) {
 	resp, ok := meta.Get(ResponseOutput)
 	if !ok {
@@ -259,18 +259,28 @@ func awsModelCrossRegion(awsModelID, awsRegionPrefix string) string {
 	return fmt.Sprintf("%s.%s", modelPrefix, awsModelID)
 }
 
-func awsModelID(requestModel, region string) string {
+// awsFoundationModelID maps the model name to the foundation model id without the
+// cross region inference profile prefix
+func awsFoundationModelID(requestModel string) string {
 	if strings.HasPrefix(requestModel, "arn:aws:bedrock:") {
 		return requestModel
 	}
 
 	item, ok := AwsModelIDMap[requestModel]
 	if ok {
-		requestModel = item.ID
-	} else if strings.HasPrefix(requestModel, "claude-") {
-		requestModel = "anthropic." + requestModel
+		return item.ID
+	}
+
+	if strings.HasPrefix(requestModel, "claude-") {
+		return "anthropic." + requestModel
 	}
 
+	return requestModel
+}
+
+func awsModelID(requestModel, region string) string {
+	requestModel = awsFoundationModelID(requestModel)
+
 	regionPrefix := awsRegionPrefix(region)
 
 	if awsModelCanCrossRegion(requestModel, regionPrefix) {
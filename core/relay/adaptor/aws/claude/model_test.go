@@ -31,3 +31,16 @@ func TestAWSModelIDFromMetaPreservesActualARN(t *testing.T) {
 
 	assert.Equal(t, arn, awsModelIDFromMeta(m, "us-east-1"))
 }
+
+func TestAWSFoundationModelIDHasNoCrossRegionPrefix(t *testing.T) {
+	assert.Equal(
+		t,
+		"anthropic.claude-sonnet-4-5-20250929-v1:0",
+		awsFoundationModelID("claude-sonnet-4-5-20250929"),
+	)
+	assert.Equal(
+		t,
+		"anthropic.claude-unknown",
+		awsFoundationModelID("claude-unknown"),
+	)
+}
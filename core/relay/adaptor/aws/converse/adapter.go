@@ -0,0 +1,259 @@
+// Package converse provides the AWS Bedrock adaptor of the models served by
+// the Converse API, such as Llama, Mistral, Nova, Titan and Cohere.
+// The requests of all the modes are converted to openai chat requests and then
+// to Converse inputs, the Converse outputs are converted back to openai chat
+// responses and rendered by the openai handlers of the requested mode.
+package converse
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/bedrockruntime"
+	"github.com/aws/aws-sdk-go-v2/service/bedrockruntime/types"
+	"github.com/bytedance/sonic"
+	"github.com/gin-gonic/gin"
+	"github.com/labring/aiproxy/core/relay/adaptor"
+	"github.com/labring/aiproxy/core/relay/adaptor/aws/utils"
+	"github.com/labring/aiproxy/core/relay/adaptor/openai"
+	"github.com/labring/aiproxy/core/relay/meta"
+	"github.com/labring/aiproxy/core/relay/mode"
+	relaymodel "github.com/labring/aiproxy/core/relay/model"
+	"github.com/labring/aiproxy/core/relay/render"
+)
+
+const (
+	ConvertedRequest = "convertedRequest"
+	ResponseOutput   = "responseOutput"
+)
+
+type Adaptor struct{}
+
+func (a *Adaptor) ConvertRequest(
+	meta *meta.Meta,
+	_ adaptor.Store,
+	req *http.Request,
+) (adaptor.ConvertResult, error) {
+	openAIRequest, err := openAIRequestFromMode(meta, req)
+	if err != nil {
+		return adaptor.ConvertResult{}, err
+	}
+
+	input, err := ConvertOpenAIRequest(req.Context(), openAIRequest)
+	if err != nil {
+		return adaptor.ConvertResult{}, err
+	}
+
+	meta.Set("stream", openAIRequest.Stream)
+	meta.Set(ConvertedRequest, input)
+
+	return adaptor.ConvertResult{}, nil
+}
+
+func (a *Adaptor) DoRequest(
+	meta *meta.Meta,
+	_ adaptor.Store,
+	c *gin.Context,
+	_ *http.Request,
+) (*http.Response, error) {
+	convReq, ok := meta.Get(ConvertedRequest)
+	if !ok {
+		return nil, relaymodel.WrapperErrorWithMessage(
+			meta.Mode,
+			http.StatusInternalServerError,
+			"request not found",
+		)
+	}
+
+	input, ok := convReq.(*bedrockruntime.ConverseInput)
+	if !ok {
+		return nil, relaymodel.WrapperErrorWithMessage(
+			meta.Mode,
+			http.StatusInternalServerError,
+			fmt.Sprintf("converse request type error: %T", convReq),
+		)
+	}
+
+	region, err := utils.AwsRegionFromMeta(meta)
+	if err != nil {
+		return nil, relaymodel.WrapperErrorWithMessage(
+			meta.Mode,
+			http.StatusInternalServerError,
+			err.Error(),
+		)
+	}
+
+	input.ModelId = aws.String(awsModelID(meta.ActualModel, region))
+
+	awsClient, err := utils.AwsClientFromMeta(meta)
+	if err != nil {
+		return nil, relaymodel.WrapperErrorWithMessage(
+			meta.Mode,
+			http.StatusInternalServerError,
+			err.Error(),
+		)
+	}
+
+	if meta.GetBool("stream") {
+		awsResp, err := awsClient.ConverseStream(
+			c.Request.Context(),
+			&bedrockruntime.ConverseStreamInput{
+				ModelId:         input.ModelId,
+				Messages:        input.Messages,
+				System:          input.System,
+				InferenceConfig: input.InferenceConfig,
+				ToolConfig:      input.ToolConfig,
+			},
+		)
+		if err != nil {
+			code, errmessage := utils.UnwrapInvokeError(err)
+			return nil, relaymodel.WrapperErrorWithMessage(meta.Mode, code, errmessage)
+		}
+
+		meta.Set(ResponseOutput, awsResp)
+	} else {
+		awsResp, err := awsClient.Converse(c.Request.Context(), input)
+		if err != nil {
+			code, errmessage := utils.UnwrapInvokeError(err)
+			return nil, relaymodel.WrapperErrorWithMessage(meta.Mode, code, errmessage)
+		}
+
+		meta.Set(ResponseOutput, awsResp)
+	}
+
+	return &http.Response{
+		StatusCode: http.StatusOK,
+	}, nil
+}
+
+func (a *Adaptor) DoResponse(
+	meta *meta.Meta,
+	_ adaptor.Store,
+	c *gin.Context,
+) (adaptor.DoResponseResult, adaptor.Error) {
+	resp, err := openAIResponse(meta)
+	if err != nil {
+		return adaptor.DoResponseResult{}, relaymodel.WrapperErrorWithMessage(
+			meta.Mode,
+			http.StatusInternalServerError,
+			err.Error(),
+		)
+	}
+
+	stream := meta.GetBool("stream")
+
+	switch meta.Mode {
+	case mode.Anthropic:
+		if stream {
+			return openai.ClaudeStreamHandler(meta, c, resp)
+		}
+		return openai.ClaudeHandler(meta, c, resp)
+	case mode.Gemini:
+		if stream {
+			return openai.GeminiStreamHandler(meta, c, resp)
+		}
+		return openai.GeminiHandler(meta, c, resp)
+	default:
+		if stream {
+			return openai.StreamHandler(meta, c, resp, nil)
+		}
+		return openai.Handler(meta, c, resp, nil)
+	}
+}
+
+// openAIResponse converts the Converse output saved by DoRequest to the openai
+// chat response, the stream events are converted to the sse body on the fly
+func openAIResponse(meta *meta.Meta) (*http.Response, error) {
+	output, ok := meta.Get(ResponseOutput)
+	if !ok {
+		return nil, errors.New("missing response")
+	}
+
+	header := http.Header{}
+
+	switch v := output.(type) {
+	case *bedrockruntime.ConverseOutput:
+		data, err := sonic.Marshal(ConvertResponse(meta.OriginModel, v))
+		if err != nil {
+			return nil, err
+		}
+
+		header.Set("Content-Type", "application/json")
+
+		return &http.Response{
+			StatusCode: http.StatusOK,
+			Header:     header,
+			Body:       io.NopCloser(bytes.NewReader(data)),
+		}, nil
+	case *bedrockruntime.ConverseStreamOutput:
+		header.Set("Content-Type", "text/event-stream")
+
+		return &http.Response{
+			StatusCode: http.StatusOK,
+			Header:     header,
+			Body:       StreamBody(v.GetStream(), NewStreamState(meta.OriginModel)),
+		}, nil
+	default:
+		return nil, fmt.Errorf("unknown response type: %T", output)
+	}
+}
+
+// EventStream is the Converse event stream
+type EventStream interface {
+	Events() <-chan types.ConverseStreamOutput
+	Close() error
+	Err() error
+}
+
+// StreamBody returns the openai sse body of the Converse event stream, the
+// event stream is closed when the body is closed or drained
+func StreamBody(stream EventStream, state *StreamState) io.ReadCloser {
+	pr, pw := io.Pipe()
+
+	go func() {
+		defer stream.Close()
+
+		for event := range stream.Events() {
+			chunk := state.ConvertEvent(event)
+			if chunk == nil {
+				continue
+			}
+
+			data, err := sonic.Marshal(chunk)
+			if err != nil {
+				pw.CloseWithError(err)
+				return
+			}
+
+			if err := writeSSEData(pw, data); err != nil {
+				return
+			}
+		}
+
+		if err := stream.Err(); err != nil {
+			pw.CloseWithError(err)
+			return
+		}
+
+		_ = writeSSEData(pw, render.DoneBytes)
+		pw.Close()
+	}()
+
+	return pr
+}
+
+func writeSSEData(w io.Writer, data []byte) error {
+	buf := make([]byte, 0, len(render.DataPrefixBytes)+len(data)+3)
+	buf = append(buf, render.DataPrefixBytes...)
+	buf = append(buf, ' ')
+	buf = append(buf, data...)
+	buf = append(buf, '\n', '\n')
+
+	_, err := w.Write(buf)
+
+	return err
+}
@@ -0,0 +1,290 @@
+package converse_test
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/bedrockruntime"
+	"github.com/aws/aws-sdk-go-v2/service/bedrockruntime/document"
+	"github.com/aws/aws-sdk-go-v2/service/bedrockruntime/types"
+	"github.com/bytedance/sonic"
+	coremodel "github.com/labring/aiproxy/core/model"
+	"github.com/labring/aiproxy/core/relay/adaptor/aws/converse"
+	"github.com/labring/aiproxy/core/relay/meta"
+	"github.com/labring/aiproxy/core/relay/mode"
+	relaymodel "github.com/labring/aiproxy/core/relay/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func convertRequest(t *testing.T, m *meta.Meta, body any) *bedrockruntime.ConverseInput {
+	t.Helper()
+
+	data, err := sonic.Marshal(body)
+	require.NoError(t, err)
+
+	req, err := http.NewRequestWithContext(
+		t.Context(),
+		http.MethodPost,
+		"http://localhost/v1/chat/completions",
+		bytes.NewBuffer(data),
+	)
+	require.NoError(t, err)
+
+	_, err = (&converse.Adaptor{}).ConvertRequest(m, nil, req)
+	require.NoError(t, err)
+
+	converted, ok := m.Get(converse.ConvertedRequest)
+	require.True(t, ok)
+
+	input, ok := converted.(*bedrockruntime.ConverseInput)
+	require.True(t, ok)
+
+	return input
+}
+
+func TestConvertRequestChatCompletions(t *testing.T) {
+	m := meta.NewMeta(nil, mode.ChatCompletions, "nova-pro", coremodel.ModelConfig{})
+
+	input := convertRequest(t, m, map[string]any{
+		"model":       "nova-pro",
+		"stream":      true,
+		"max_tokens":  512,
+		"temperature": 0.5,
+		"stop":        []string{"END"},
+		"messages": []map[string]any{
+			{"role": "system", "content": "be brief"},
+			{"role": "user", "content": []map[string]any{
+				{"type": "text", "text": "what is this"},
+				{"type": "image_url", "image_url": map[string]any{
+					"url": "data:image/png;base64,iVBORw0KGgo=",
+				}},
+			}},
+			{"role": "assistant", "tool_calls": []map[string]any{
+				{"id": "call_1", "type": "function", "function": map[string]any{
+					"name": "lookup", "arguments": `{"q":"png"}`,
+				}},
+			}},
+			{"role": "tool", "tool_call_id": "call_1", "content": "an image"},
+			{"role": "user", "content": "thanks"},
+		},
+		"tools": []map[string]any{
+			{"type": "function", "function": map[string]any{
+				"name":        "lookup",
+				"description": "look up a word",
+				"parameters": map[string]any{
+					"type":       "object",
+					"properties": map[string]any{"q": map[string]any{"type": "string"}},
+				},
+			}},
+		},
+		"tool_choice": "required",
+	})
+
+	assert.True(t, m.GetBool("stream"))
+
+	require.Len(t, input.System, 1)
+	assert.Equal(t, "be brief", input.System[0].(*types.SystemContentBlockMemberText).Value)
+
+	assert.Equal(t, int32(512), aws.ToInt32(input.InferenceConfig.MaxTokens))
+	assert.InDelta(t, 0.5, aws.ToFloat32(input.InferenceConfig.Temperature), 0.001)
+	assert.Equal(t, []string{"END"}, input.InferenceConfig.StopSequences)
+
+	// the tool result and the following user message are merged into one
+	// user message
+	require.Len(t, input.Messages, 3)
+	assert.Equal(t, types.ConversationRoleUser, input.Messages[0].Role)
+	assert.Equal(t, types.ConversationRoleAssistant, input.Messages[1].Role)
+	assert.Equal(t, types.ConversationRoleUser, input.Messages[2].Role)
+
+	require.Len(t, input.Messages[0].Content, 2)
+	img, ok := input.Messages[0].Content[1].(*types.ContentBlockMemberImage)
+	require.True(t, ok)
+	assert.Equal(t, types.ImageFormatPng, img.Value.Format)
+	assert.NotEmpty(t, img.Value.Source.(*types.ImageSourceMemberBytes).Value)
+
+	toolUse, ok := input.Messages[1].Content[0].(*types.ContentBlockMemberToolUse)
+	require.True(t, ok)
+	assert.Equal(t, "call_1", aws.ToString(toolUse.Value.ToolUseId))
+	assert.Equal(t, "lookup", aws.ToString(toolUse.Value.Name))
+
+	require.Len(t, input.Messages[2].Content, 2)
+	toolResult, ok := input.Messages[2].Content[0].(*types.ContentBlockMemberToolResult)
+	require.True(t, ok)
+	assert.Equal(t, "call_1", aws.ToString(toolResult.Value.ToolUseId))
+
+	require.NotNil(t, input.ToolConfig)
+	require.Len(t, input.ToolConfig.Tools, 1)
+	spec := input.ToolConfig.Tools[0].(*types.ToolMemberToolSpec).Value
+	assert.Equal(t, "lookup", aws.ToString(spec.Name))
+	assert.IsType(t, &types.ToolChoiceMemberAny{}, input.ToolConfig.ToolChoice)
+}
+
+func TestConvertRequestAnthropic(t *testing.T) {
+	m := meta.NewMeta(nil, mode.Anthropic, "llama3-3-70b-instruct", coremodel.ModelConfig{})
+
+	input := convertRequest(t, m, map[string]any{
+		"model":      "llama3-3-70b-instruct",
+		"max_tokens": 100,
+		"system": []map[string]any{
+			{"type": "text", "text": "you are a bot"},
+		},
+		"messages": []map[string]any{
+			{"role": "user", "content": "hello"},
+		},
+	})
+
+	assert.False(t, m.GetBool("stream"))
+	require.Len(t, input.System, 1)
+	assert.Equal(t, "you are a bot", input.System[0].(*types.SystemContentBlockMemberText).Value)
+	require.Len(t, input.Messages, 1)
+	assert.Equal(
+		t,
+		"hello",
+		input.Messages[0].Content[0].(*types.ContentBlockMemberText).Value,
+	)
+	assert.Equal(t, int32(100), aws.ToInt32(input.InferenceConfig.MaxTokens))
+}
+
+func TestConvertResponse(t *testing.T) {
+	resp := converse.ConvertResponse("nova-pro", &bedrockruntime.ConverseOutput{
+		Output: &types.ConverseOutputMemberMessage{
+			Value: types.Message{
+				Role: types.ConversationRoleAssistant,
+				Content: []types.ContentBlock{
+					&types.ContentBlockMemberText{Value: "let me check"},
+					&types.ContentBlockMemberToolUse{Value: types.ToolUseBlock{
+						ToolUseId: aws.String("tooluse_1"),
+						Name:      aws.String("lookup"),
+						Input:     document.NewLazyDocument(map[string]any{"q": "png"}),
+					}},
+				},
+			},
+		},
+		StopReason: types.StopReasonToolUse,
+		Usage: &types.TokenUsage{
+			InputTokens:          aws.Int32(10),
+			OutputTokens:         aws.Int32(5),
+			CacheReadInputTokens: aws.Int32(4),
+		},
+	})
+
+	require.Len(t, resp.Choices, 1)
+	choice := resp.Choices[0]
+	assert.Equal(t, relaymodel.FinishReasonToolCalls, choice.FinishReason)
+	assert.Equal(t, "let me check", choice.Message.Content)
+	require.Len(t, choice.Message.ToolCalls, 1)
+	assert.Equal(t, "tooluse_1", choice.Message.ToolCalls[0].ID)
+	assert.JSONEq(t, `{"q":"png"}`, choice.Message.ToolCalls[0].Function.Arguments)
+
+	assert.Equal(t, int64(14), resp.Usage.PromptTokens)
+	assert.Equal(t, int64(5), resp.Usage.CompletionTokens)
+	assert.Equal(t, int64(19), resp.Usage.TotalTokens)
+	require.NotNil(t, resp.Usage.PromptTokensDetails)
+	assert.Equal(t, int64(4), resp.Usage.PromptTokensDetails.CachedTokens)
+}
+
+type fakeEventStream struct {
+	events chan types.ConverseStreamOutput
+}
+
+func (f *fakeEventStream) Events() <-chan types.ConverseStreamOutput {
+	return f.events
+}
+
+func (f *fakeEventStream) Close() error {
+	return nil
+}
+
+func (f *fakeEventStream) Err() error {
+	return nil
+}
+
+func TestStreamBody(t *testing.T) {
+	events := []types.ConverseStreamOutput{
+		&types.ConverseStreamOutputMemberMessageStart{
+			Value: types.MessageStartEvent{Role: types.ConversationRoleAssistant},
+		},
+		&types.ConverseStreamOutputMemberContentBlockDelta{
+			Value: types.ContentBlockDeltaEvent{
+				ContentBlockIndex: aws.Int32(0),
+				Delta:             &types.ContentBlockDeltaMemberText{Value: "hi"},
+			},
+		},
+		&types.ConverseStreamOutputMemberContentBlockStart{
+			Value: types.ContentBlockStartEvent{
+				ContentBlockIndex: aws.Int32(1),
+				Start: &types.ContentBlockStartMemberToolUse{
+					Value: types.ToolUseBlockStart{
+						ToolUseId: aws.String("tooluse_1"),
+						Name:      aws.String("lookup"),
+					},
+				},
+			},
+		},
+		&types.ConverseStreamOutputMemberContentBlockDelta{
+			Value: types.ContentBlockDeltaEvent{
+				ContentBlockIndex: aws.Int32(1),
+				Delta: &types.ContentBlockDeltaMemberToolUse{
+					Value: types.ToolUseBlockDelta{Input: aws.String(`{"q":1}`)},
+				},
+			},
+		},
+		&types.ConverseStreamOutputMemberMessageStop{
+			Value: types.MessageStopEvent{StopReason: types.StopReasonToolUse},
+		},
+		&types.ConverseStreamOutputMemberMetadata{
+			Value: types.ConverseStreamMetadataEvent{
+				Usage: &types.TokenUsage{
+					InputTokens:  aws.Int32(3),
+					OutputTokens: aws.Int32(2),
+				},
+			},
+		},
+	}
+
+	stream := &fakeEventStream{events: make(chan types.ConverseStreamOutput, len(events))}
+	for _, event := range events {
+		stream.events <- event
+	}
+
+	close(stream.events)
+
+	body := converse.StreamBody(stream, converse.NewStreamState("nova-pro"))
+	defer body.Close()
+
+	data, err := io.ReadAll(body)
+	require.NoError(t, err)
+
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n\n")
+	require.Len(t, lines, len(events)+1)
+	assert.Equal(t, "data: [DONE]", lines[len(lines)-1])
+
+	chunks := make([]relaymodel.ChatCompletionsStreamResponse, len(events))
+	for i := range events {
+		require.NoError(t, sonic.UnmarshalString(
+			strings.TrimPrefix(lines[i], "data: "),
+			&chunks[i],
+		))
+		assert.Equal(t, relaymodel.ChatCompletionChunkObject, chunks[i].Object)
+		assert.Equal(t, chunks[0].ID, chunks[i].ID)
+	}
+
+	assert.Equal(t, "hi", chunks[1].Choices[0].Delta.Content)
+
+	toolCall := chunks[2].Choices[0].Delta.ToolCalls[0]
+	assert.Equal(t, 0, toolCall.Index)
+	assert.Equal(t, "tooluse_1", toolCall.ID)
+	assert.Equal(t, "lookup", toolCall.Function.Name)
+	assert.JSONEq(t, `{"q":1}`, chunks[3].Choices[0].Delta.ToolCalls[0].Function.Arguments)
+
+	assert.Equal(t, relaymodel.FinishReasonToolCalls, chunks[4].Choices[0].FinishReason)
+
+	assert.Empty(t, chunks[5].Choices)
+	require.NotNil(t, chunks[5].Usage)
+	assert.Equal(t, int64(5), chunks[5].Usage.TotalTokens)
+}
@@ -0,0 +1,292 @@
+package converse
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/labring/aiproxy/core/model"
+	"github.com/labring/aiproxy/core/relay/mode"
+)
+
+type awsModelItem struct {
+	ID string
+	// CrossRegion is the region prefixes that serve the model through the
+	// cross region inference profile
+	CrossRegion map[string]bool
+	model.ModelConfig
+}
+
+var (
+	usCrossRegion  = map[string]bool{"us": true}
+	allCrossRegion = map[string]bool{"us": true, "eu": true, "ap": true}
+)
+
+// AwsModelIDMap maps the model names to the Bedrock model ids served by the
+// Converse API.
+// For more details, see: https://docs.aws.amazon.com/bedrock/latest/userguide/conversation-inference-supported-models-features.html
+var AwsModelIDMap = map[string]awsModelItem{
+	"nova-micro": {
+		ModelConfig: model.ModelConfig{
+			Type:  mode.ChatCompletions,
+			Owner: model.ModelOwnerAmazon,
+			Config: model.NewModelConfig(
+				model.WithModelConfigMaxContextTokens(128000),
+				model.WithModelConfigMaxOutputTokens(10000),
+				model.WithModelConfigToolChoice(true),
+			),
+		},
+		ID:          "amazon.nova-micro-v1:0",
+		CrossRegion: allCrossRegion,
+	},
+	"nova-lite": {
+		ModelConfig: model.ModelConfig{
+			Type:  mode.ChatCompletions,
+			Owner: model.ModelOwnerAmazon,
+			Config: model.NewModelConfig(
+				model.WithModelConfigMaxContextTokens(300000),
+				model.WithModelConfigMaxOutputTokens(10000),
+				model.WithModelConfigToolChoice(true),
+				model.WithModelConfigVision(true),
+			),
+		},
+		ID:          "amazon.nova-lite-v1:0",
+		CrossRegion: allCrossRegion,
+	},
+	"nova-pro": {
+		ModelConfig: model.ModelConfig{
+			Type:  mode.ChatCompletions,
+			Owner: model.ModelOwnerAmazon,
+			Config: model.NewModelConfig(
+				model.WithModelConfigMaxContextTokens(300000),
+				model.WithModelConfigMaxOutputTokens(10000),
+				model.WithModelConfigToolChoice(true),
+				model.WithModelConfigVision(true),
+			),
+		},
+		ID:          "amazon.nova-pro-v1:0",
+		CrossRegion: allCrossRegion,
+	},
+	"nova-premier": {
+		ModelConfig: model.ModelConfig{
+			Type:  mode.ChatCompletions,
+			Owner: model.ModelOwnerAmazon,
+			Config: model.NewModelConfig(
+				model.WithModelConfigMaxContextTokens(1000000),
+				model.WithModelConfigMaxOutputTokens(32000),
+				model.WithModelConfigToolChoice(true),
+				model.WithModelConfigVision(true),
+			),
+		},
+		ID:          "amazon.nova-premier-v1:0",
+		CrossRegion: usCrossRegion,
+	},
+	"titan-text-premier": {
+		ModelConfig: model.ModelConfig{
+			Type:  mode.ChatCompletions,
+			Owner: model.ModelOwnerAmazon,
+			Config: model.NewModelConfig(
+				model.WithModelConfigMaxContextTokens(32000),
+				model.WithModelConfigMaxOutputTokens(3072),
+			),
+		},
+		ID: "amazon.titan-text-premier-v1:0",
+	},
+	"titan-text-express": {
+		ModelConfig: model.ModelConfig{
+			Type:  mode.ChatCompletions,
+			Owner: model.ModelOwnerAmazon,
+			Config: model.NewModelConfig(
+				model.WithModelConfigMaxContextTokens(8192),
+				model.WithModelConfigMaxOutputTokens(8192),
+			),
+		},
+		ID: "amazon.titan-text-express-v1",
+	},
+	"llama3-1-8b-instruct": {
+		ModelConfig: model.ModelConfig{
+			Type:  mode.ChatCompletions,
+			Owner: model.ModelOwnerMeta,
+			Config: model.NewModelConfig(
+				model.WithModelConfigMaxContextTokens(128000),
+				model.WithModelConfigMaxOutputTokens(2048),
+				model.WithModelConfigToolChoice(true),
+			),
+		},
+		ID:          "meta.llama3-1-8b-instruct-v1:0",
+		CrossRegion: usCrossRegion,
+	},
+	"llama3-1-70b-instruct": {
+		ModelConfig: model.ModelConfig{
+			Type:  mode.ChatCompletions,
+			Owner: model.ModelOwnerMeta,
+			Config: model.NewModelConfig(
+				model.WithModelConfigMaxContextTokens(128000),
+				model.WithModelConfigMaxOutputTokens(2048),
+				model.WithModelConfigToolChoice(true),
+			),
+		},
+		ID:          "meta.llama3-1-70b-instruct-v1:0",
+		CrossRegion: usCrossRegion,
+	},
+	"llama3-2-11b-instruct": {
+		ModelConfig: model.ModelConfig{
+			Type:  mode.ChatCompletions,
+			Owner: model.ModelOwnerMeta,
+			Config: model.NewModelConfig(
+				model.WithModelConfigMaxContextTokens(128000),
+				model.WithModelConfigMaxOutputTokens(2048),
+				model.WithModelConfigVision(true),
+			),
+		},
+		ID:          "meta.llama3-2-11b-instruct-v1:0",
+		CrossRegion: usCrossRegion,
+	},
+	"llama3-2-90b-instruct": {
+		ModelConfig: model.ModelConfig{
+			Type:  mode.ChatCompletions,
+			Owner: model.ModelOwnerMeta,
+			Config: model.NewModelConfig(
+				model.WithModelConfigMaxContextTokens(128000),
+				model.WithModelConfigMaxOutputTokens(2048),
+				model.WithModelConfigVision(true),
+			),
+		},
+		ID:          "meta.llama3-2-90b-instruct-v1:0",
+		CrossRegion: usCrossRegion,
+	},
+	"llama3-3-70b-instruct": {
+		ModelConfig: model.ModelConfig{
+			Type:  mode.ChatCompletions,
+			Owner: model.ModelOwnerMeta,
+			Config: model.NewModelConfig(
+				model.WithModelConfigMaxContextTokens(128000),
+				model.WithModelConfigMaxOutputTokens(8192),
+				model.WithModelConfigToolChoice(true),
+			),
+		},
+		ID:          "meta.llama3-3-70b-instruct-v1:0",
+		CrossRegion: usCrossRegion,
+	},
+	"llama4-scout-17b-instruct": {
+		ModelConfig: model.ModelConfig{
+			Type:  mode.ChatCompletions,
+			Owner: model.ModelOwnerMeta,
+			Config: model.NewModelConfig(
+				model.WithModelConfigMaxContextTokens(3500000),
+				model.WithModelConfigMaxOutputTokens(8192),
+				model.WithModelConfigToolChoice(true),
+				model.WithModelConfigVision(true),
+			),
+		},
+		ID:          "meta.llama4-scout-17b-instruct-v1:0",
+		CrossRegion: usCrossRegion,
+	},
+	"llama4-maverick-17b-instruct": {
+		ModelConfig: model.ModelConfig{
+			Type:  mode.ChatCompletions,
+			Owner: model.ModelOwnerMeta,
+			Config: model.NewModelConfig(
+				model.WithModelConfigMaxContextTokens(1000000),
+				model.WithModelConfigMaxOutputTokens(8192),
+				model.WithModelConfigToolChoice(true),
+				model.WithModelConfigVision(true),
+			),
+		},
+		ID:          "meta.llama4-maverick-17b-instruct-v1:0",
+		CrossRegion: usCrossRegion,
+	},
+	"mistral-large-2407": {
+		ModelConfig: model.ModelConfig{
+			Type:  mode.ChatCompletions,
+			Owner: model.ModelOwnerMistral,
+			Config: model.NewModelConfig(
+				model.WithModelConfigMaxContextTokens(128000),
+				model.WithModelConfigMaxOutputTokens(8192),
+				model.WithModelConfigToolChoice(true),
+			),
+		},
+		ID: "mistral.mistral-large-2407-v1:0",
+	},
+	"mistral-small-2402": {
+		ModelConfig: model.ModelConfig{
+			Type:  mode.ChatCompletions,
+			Owner: model.ModelOwnerMistral,
+			Config: model.NewModelConfig(
+				model.WithModelConfigMaxContextTokens(32000),
+				model.WithModelConfigMaxOutputTokens(8192),
+				model.WithModelConfigToolChoice(true),
+			),
+		},
+		ID: "mistral.mistral-small-2402-v1:0",
+	},
+	"pixtral-large-2502": {
+		ModelConfig: model.ModelConfig{
+			Type:  mode.ChatCompletions,
+			Owner: model.ModelOwnerMistral,
+			Config: model.NewModelConfig(
+				model.WithModelConfigMaxContextTokens(128000),
+				model.WithModelConfigMaxOutputTokens(8192),
+				model.WithModelConfigToolChoice(true),
+				model.WithModelConfigVision(true),
+			),
+		},
+		ID:          "mistral.pixtral-large-2502-v1:0",
+		CrossRegion: map[string]bool{"us": true, "eu": true},
+	},
+	"command-r": {
+		ModelConfig: model.ModelConfig{
+			Type:  mode.ChatCompletions,
+			Owner: model.ModelOwnerCohere,
+			Config: model.NewModelConfig(
+				model.WithModelConfigMaxContextTokens(128000),
+				model.WithModelConfigMaxOutputTokens(4096),
+				model.WithModelConfigToolChoice(true),
+			),
+		},
+		ID: "cohere.command-r-v1:0",
+	},
+	"command-r-plus": {
+		ModelConfig: model.ModelConfig{
+			Type:  mode.ChatCompletions,
+			Owner: model.ModelOwnerCohere,
+			Config: model.NewModelConfig(
+				model.WithModelConfigMaxContextTokens(128000),
+				model.WithModelConfigMaxOutputTokens(4096),
+				model.WithModelConfigToolChoice(true),
+			),
+		},
+		ID: "cohere.command-r-plus-v1:0",
+	},
+}
+
+var awsRegionCrossModelPrefixMap = map[string]string{
+	"us": "us",
+	"eu": "eu",
+	"ap": "apac",
+}
+
+func awsRegionPrefix(awsRegionID string) string {
+	prefix, _, _ := strings.Cut(awsRegionID, "-")
+	return prefix
+}
+
+// awsModelID maps the model name to the Bedrock model id, the unknown names
+// such as the raw model ids and the arns are passed through
+func awsModelID(requestModel, region string) string {
+	item, ok := AwsModelIDMap[requestModel]
+	if !ok {
+		return requestModel
+	}
+
+	regionPrefix := awsRegionPrefix(region)
+	if !item.CrossRegion[regionPrefix] {
+		return item.ID
+	}
+
+	modelPrefix, ok := awsRegionCrossModelPrefixMap[regionPrefix]
+	if !ok {
+		return item.ID
+	}
+
+	return fmt.Sprintf("%s.%s", modelPrefix, item.ID)
+}
@@ -0,0 +1,350 @@
+package converse
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/bedrockruntime"
+	"github.com/aws/aws-sdk-go-v2/service/bedrockruntime/document"
+	"github.com/aws/aws-sdk-go-v2/service/bedrockruntime/types"
+	"github.com/bytedance/sonic"
+	"github.com/labring/aiproxy/core/common/image"
+	"github.com/labring/aiproxy/core/relay/adaptor/openai"
+	"github.com/labring/aiproxy/core/relay/meta"
+	"github.com/labring/aiproxy/core/relay/mode"
+	relaymodel "github.com/labring/aiproxy/core/relay/model"
+	"github.com/labring/aiproxy/core/relay/utils"
+)
+
+// openAIRequestFromMode parses the request of the chat, anthropic and gemini
+// modes into the openai chat request
+func openAIRequestFromMode(
+	meta *meta.Meta,
+	req *http.Request,
+) (*relaymodel.GeneralOpenAIRequest, error) {
+	switch meta.Mode {
+	case mode.ChatCompletions:
+		return utils.UnmarshalGeneralOpenAIRequest(req)
+	case mode.Anthropic:
+		return openai.ConvertClaudeRequestModel(meta, req)
+	case mode.Gemini:
+		result, err := openai.ConvertGeminiRequest(meta, req)
+		if err != nil {
+			return nil, err
+		}
+
+		var openAIRequest relaymodel.GeneralOpenAIRequest
+		if err := sonic.ConfigDefault.NewDecoder(result.Body).Decode(&openAIRequest); err != nil {
+			return nil, err
+		}
+
+		return &openAIRequest, nil
+	default:
+		return nil, errors.New("unsupported mode: " + meta.Mode.String())
+	}
+}
+
+// ConvertOpenAIRequest converts the openai chat request to the Converse input,
+// the model id is filled in when sending the request
+func ConvertOpenAIRequest(
+	ctx context.Context,
+	request *relaymodel.GeneralOpenAIRequest,
+) (*bedrockruntime.ConverseInput, error) {
+	input := &bedrockruntime.ConverseInput{
+		InferenceConfig: convertInferenceConfig(request),
+	}
+
+	for _, msg := range request.Messages {
+		switch msg.Role {
+		case relaymodel.RoleSystem, relaymodel.RoleDeveloper:
+			if text := msg.StringContent(); text != "" {
+				input.System = append(input.System, &types.SystemContentBlockMemberText{
+					Value: text,
+				})
+			}
+		case relaymodel.RoleTool:
+			input.Messages = appendMessage(
+				input.Messages,
+				types.ConversationRoleUser,
+				convertToolResult(&msg),
+			)
+		case relaymodel.RoleAssistant:
+			content, err := convertAssistantContent(&msg)
+			if err != nil {
+				return nil, err
+			}
+
+			input.Messages = appendMessage(
+				input.Messages,
+				types.ConversationRoleAssistant,
+				content...,
+			)
+		default:
+			content, err := convertUserContent(ctx, &msg)
+			if err != nil {
+				return nil, err
+			}
+
+			input.Messages = appendMessage(
+				input.Messages,
+				types.ConversationRoleUser,
+				content...,
+			)
+		}
+	}
+
+	toolConfig, err := convertToolConfig(request.Tools, request.ToolChoice)
+	if err != nil {
+		return nil, err
+	}
+
+	input.ToolConfig = toolConfig
+
+	return input, nil
+}
+
+// appendMessage merges the content into the last message of the same role,
+// Converse requires the roles of the messages to alternate
+func appendMessage(
+	messages []types.Message,
+	role types.ConversationRole,
+	content ...types.ContentBlock,
+) []types.Message {
+	if len(content) == 0 {
+		return messages
+	}
+
+	if len(messages) > 0 && messages[len(messages)-1].Role == role {
+		last := &messages[len(messages)-1]
+		last.Content = append(last.Content, content...)
+
+		return messages
+	}
+
+	return append(messages, types.Message{
+		Role:    role,
+		Content: content,
+	})
+}
+
+func convertInferenceConfig(
+	request *relaymodel.GeneralOpenAIRequest,
+) *types.InferenceConfiguration {
+	config := &types.InferenceConfiguration{
+		StopSequences: convertStop(request.Stop),
+	}
+
+	maxTokens := request.MaxCompletionTokens
+	if maxTokens == 0 {
+		maxTokens = request.MaxTokens
+	}
+
+	if maxTokens > 0 {
+		config.MaxTokens = aws.Int32(int32(maxTokens))
+	}
+
+	if request.Temperature != nil {
+		config.Temperature = aws.Float32(float32(*request.Temperature))
+	}
+
+	if request.TopP != nil {
+		config.TopP = aws.Float32(float32(*request.TopP))
+	}
+
+	return config
+}
+
+func convertStop(stop any) []string {
+	switch v := stop.(type) {
+	case string:
+		if v == "" {
+			return nil
+		}
+
+		return []string{v}
+	case []any:
+		stops := make([]string, 0, len(v))
+		for _, s := range v {
+			if s, ok := s.(string); ok && s != "" {
+				stops = append(stops, s)
+			}
+		}
+
+		return stops
+	case []string:
+		return v
+	default:
+		return nil
+	}
+}
+
+func convertUserContent(
+	ctx context.Context,
+	msg *relaymodel.Message,
+) ([]types.ContentBlock, error) {
+	if msg.IsStringContent() {
+		text := msg.StringContent()
+		if text == "" {
+			return nil, nil
+		}
+
+		return []types.ContentBlock{&types.ContentBlockMemberText{Value: text}}, nil
+	}
+
+	parts := msg.ParseContent()
+	content := make([]types.ContentBlock, 0, len(parts))
+
+	for _, part := range parts {
+		switch part.Type {
+		case relaymodel.ContentTypeText:
+			if part.Text != "" {
+				content = append(content, &types.ContentBlockMemberText{Value: part.Text})
+			}
+		case relaymodel.ContentTypeImageURL:
+			if part.ImageURL == nil {
+				continue
+			}
+
+			block, err := convertImage(ctx, part.ImageURL.URL)
+			if err != nil {
+				return nil, err
+			}
+
+			content = append(content, block)
+		}
+	}
+
+	return content, nil
+}
+
+func convertImage(ctx context.Context, url string) (types.ContentBlock, error) {
+	mimeType, data, err := image.GetImageFromURL(ctx, url)
+	if err != nil {
+		return nil, err
+	}
+
+	raw, err := base64.StdEncoding.DecodeString(data)
+	if err != nil {
+		return nil, err
+	}
+
+	format := strings.TrimPrefix(mimeType, "image/")
+	if format == "jpg" {
+		format = string(types.ImageFormatJpeg)
+	}
+
+	return &types.ContentBlockMemberImage{
+		Value: types.ImageBlock{
+			Format: types.ImageFormat(format),
+			Source: &types.ImageSourceMemberBytes{Value: raw},
+		},
+	}, nil
+}
+
+func convertAssistantContent(msg *relaymodel.Message) ([]types.ContentBlock, error) {
+	content := make([]types.ContentBlock, 0, 1+len(msg.ToolCalls))
+
+	if text := msg.StringContent(); text != "" {
+		content = append(content, &types.ContentBlockMemberText{Value: text})
+	}
+
+	for _, toolCall := range msg.ToolCalls {
+		var args any = map[string]any{}
+		if toolCall.Function.Arguments != "" {
+			if err := sonic.UnmarshalString(toolCall.Function.Arguments, &args); err != nil {
+				return nil, err
+			}
+		}
+
+		content = append(content, &types.ContentBlockMemberToolUse{
+			Value: types.ToolUseBlock{
+				ToolUseId: aws.String(toolCall.ID),
+				Name:      aws.String(toolCall.Function.Name),
+				Input:     document.NewLazyDocument(args),
+			},
+		})
+	}
+
+	return content, nil
+}
+
+func convertToolResult(msg *relaymodel.Message) types.ContentBlock {
+	return &types.ContentBlockMemberToolResult{
+		Value: types.ToolResultBlock{
+			ToolUseId: aws.String(msg.ToolCallID),
+			Content: []types.ToolResultContentBlock{
+				&types.ToolResultContentBlockMemberText{Value: msg.StringContent()},
+			},
+		},
+	}
+}
+
+func convertToolConfig(tools []relaymodel.Tool, toolChoice any) (*types.ToolConfiguration, error) {
+	if len(tools) == 0 {
+		return nil, nil
+	}
+
+	config := &types.ToolConfiguration{
+		Tools: make([]types.Tool, 0, len(tools)),
+	}
+
+	for _, tool := range tools {
+		parameters := tool.Function.Parameters
+		if parameters == nil {
+			parameters = map[string]any{"type": "object", "properties": map[string]any{}}
+		}
+
+		spec := types.ToolSpecification{
+			Name:        aws.String(tool.Function.Name),
+			InputSchema: &types.ToolInputSchemaMemberJson{Value: document.NewLazyDocument(parameters)},
+		}
+		if tool.Function.Description != "" {
+			spec.Description = aws.String(tool.Function.Description)
+		}
+
+		config.Tools = append(config.Tools, &types.ToolMemberToolSpec{Value: spec})
+	}
+
+	switch choice := toolChoice.(type) {
+	case string:
+		switch choice {
+		case "none":
+			// Converse has no way to disable the tools but omitting them
+			return nil, nil
+		case "required", "any":
+			config.ToolChoice = &types.ToolChoiceMemberAny{}
+		}
+	case map[string]any:
+		if function, ok := choice["function"].(map[string]any); ok {
+			name, _ := function["name"].(string)
+			if name == "" {
+				return nil, errors.New("tool choice function name is empty")
+			}
+
+			config.ToolChoice = &types.ToolChoiceMemberTool{
+				Value: types.SpecificToolChoice{Name: aws.String(name)},
+			}
+		}
+	}
+
+	return config, nil
+}
+
+// marshalDocument marshals the document such as the tool use input to json
+func marshalDocument(doc document.Interface) string {
+	if doc == nil {
+		return "{}"
+	}
+
+	data, err := doc.MarshalSmithyDocument()
+	if err != nil || len(bytes.TrimSpace(data)) == 0 {
+		return "{}"
+	}
+
+	return string(data)
+}
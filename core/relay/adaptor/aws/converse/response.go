@@ -0,0 +1,217 @@
+package converse
+
+import (
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/bedrockruntime"
+	"github.com/aws/aws-sdk-go-v2/service/bedrockruntime/types"
+	"github.com/labring/aiproxy/core/relay/adaptor/openai"
+	relaymodel "github.com/labring/aiproxy/core/relay/model"
+)
+
+func convertStopReason(reason types.StopReason) relaymodel.FinishReason {
+	switch reason {
+	case types.StopReasonToolUse:
+		return relaymodel.FinishReasonToolCalls
+	case types.StopReasonMaxTokens, types.StopReasonModelContextWindowExceeded:
+		return relaymodel.FinishReasonLength
+	case types.StopReasonGuardrailIntervened, types.StopReasonContentFiltered:
+		return relaymodel.FinishReasonContentFilter
+	default:
+		return relaymodel.FinishReasonStop
+	}
+}
+
+// ConvertUsage converts the Converse token usage, the input tokens of Converse
+// do not include the cache read and write tokens
+func ConvertUsage(usage *types.TokenUsage) *relaymodel.ChatUsage {
+	if usage == nil {
+		return nil
+	}
+
+	cacheRead := int64(aws.ToInt32(usage.CacheReadInputTokens))
+	cacheWrite := int64(aws.ToInt32(usage.CacheWriteInputTokens))
+
+	chatUsage := &relaymodel.ChatUsage{
+		PromptTokens:     int64(aws.ToInt32(usage.InputTokens)) + cacheRead + cacheWrite,
+		CompletionTokens: int64(aws.ToInt32(usage.OutputTokens)),
+	}
+	chatUsage.TotalTokens = chatUsage.PromptTokens + chatUsage.CompletionTokens
+
+	if cacheRead > 0 || cacheWrite > 0 {
+		chatUsage.PromptTokensDetails = &relaymodel.PromptTokensDetails{
+			CachedTokens:        cacheRead,
+			CacheCreationTokens: cacheWrite,
+		}
+	}
+
+	return chatUsage
+}
+
+// ConvertResponse converts the Converse output to the openai chat response
+func ConvertResponse(model string, output *bedrockruntime.ConverseOutput) *relaymodel.TextResponse {
+	message := relaymodel.Message{
+		Role: relaymodel.RoleAssistant,
+	}
+
+	var content strings.Builder
+
+	if msg, ok := output.Output.(*types.ConverseOutputMemberMessage); ok {
+		for _, block := range msg.Value.Content {
+			switch v := block.(type) {
+			case *types.ContentBlockMemberText:
+				content.WriteString(v.Value)
+			case *types.ContentBlockMemberReasoningContent:
+				if text, ok := v.Value.(*types.ReasoningContentBlockMemberReasoningText); ok {
+					message.ReasoningContent += aws.ToString(text.Value.Text)
+					message.Signature = aws.ToString(text.Value.Signature)
+				}
+			case *types.ContentBlockMemberToolUse:
+				message.ToolCalls = append(message.ToolCalls, relaymodel.ToolCall{
+					Index: len(message.ToolCalls),
+					ID:    aws.ToString(v.Value.ToolUseId),
+					Type:  "function",
+					Function: relaymodel.Function{
+						Name:      aws.ToString(v.Value.Name),
+						Arguments: marshalDocument(v.Value.Input),
+					},
+				})
+			}
+		}
+	}
+
+	message.Content = content.String()
+
+	response := &relaymodel.TextResponse{
+		ID:      openai.ChatCompletionID(),
+		Model:   model,
+		Object:  relaymodel.ChatCompletionObject,
+		Created: time.Now().Unix(),
+		Choices: []*relaymodel.TextResponseChoice{
+			{
+				Message:      message,
+				FinishReason: convertStopReason(output.StopReason),
+			},
+		},
+	}
+
+	if usage := ConvertUsage(output.Usage); usage != nil {
+		response.Usage = *usage
+	}
+
+	return response
+}
+
+// StreamState converts the Converse stream events to the openai chat stream
+// chunks, the content block indexes of the tool uses are mapped to the tool
+// call indexes
+type StreamState struct {
+	id        string
+	model     string
+	created   int64
+	toolIndex map[int32]int
+}
+
+func NewStreamState(model string) *StreamState {
+	return &StreamState{
+		id:        openai.ChatCompletionID(),
+		model:     model,
+		created:   time.Now().Unix(),
+		toolIndex: make(map[int32]int),
+	}
+}
+
+func (s *StreamState) chunk(
+	choices ...*relaymodel.ChatCompletionsStreamResponseChoice,
+) *relaymodel.ChatCompletionsStreamResponse {
+	if choices == nil {
+		choices = []*relaymodel.ChatCompletionsStreamResponseChoice{}
+	}
+
+	return &relaymodel.ChatCompletionsStreamResponse{
+		ID:      s.id,
+		Model:   s.model,
+		Object:  relaymodel.ChatCompletionChunkObject,
+		Created: s.created,
+		Choices: choices,
+	}
+}
+
+func (s *StreamState) delta(delta relaymodel.Message) *relaymodel.ChatCompletionsStreamResponse {
+	return s.chunk(&relaymodel.ChatCompletionsStreamResponseChoice{Delta: delta})
+}
+
+// ConvertEvent converts the stream event to the chunk, nil is returned for the
+// events without output
+func (s *StreamState) ConvertEvent(
+	event types.ConverseStreamOutput,
+) *relaymodel.ChatCompletionsStreamResponse {
+	switch v := event.(type) {
+	case *types.ConverseStreamOutputMemberMessageStart:
+		return s.delta(relaymodel.Message{Role: relaymodel.RoleAssistant})
+	case *types.ConverseStreamOutputMemberContentBlockStart:
+		start, ok := v.Value.Start.(*types.ContentBlockStartMemberToolUse)
+		if !ok {
+			return nil
+		}
+
+		index := len(s.toolIndex)
+		s.toolIndex[aws.ToInt32(v.Value.ContentBlockIndex)] = index
+
+		return s.delta(relaymodel.Message{
+			ToolCalls: []relaymodel.ToolCall{
+				{
+					Index: index,
+					ID:    aws.ToString(start.Value.ToolUseId),
+					Type:  "function",
+					Function: relaymodel.Function{
+						Name: aws.ToString(start.Value.Name),
+					},
+				},
+			},
+		})
+	case *types.ConverseStreamOutputMemberContentBlockDelta:
+		switch delta := v.Value.Delta.(type) {
+		case *types.ContentBlockDeltaMemberText:
+			return s.delta(relaymodel.Message{Content: delta.Value})
+		case *types.ContentBlockDeltaMemberToolUse:
+			return s.delta(relaymodel.Message{
+				ToolCalls: []relaymodel.ToolCall{
+					{
+						Index: s.toolIndex[aws.ToInt32(v.Value.ContentBlockIndex)],
+						Function: relaymodel.Function{
+							Arguments: aws.ToString(delta.Value.Input),
+						},
+					},
+				},
+			})
+		case *types.ContentBlockDeltaMemberReasoningContent:
+			switch reasoning := delta.Value.(type) {
+			case *types.ReasoningContentBlockDeltaMemberText:
+				return s.delta(relaymodel.Message{ReasoningContent: reasoning.Value})
+			case *types.ReasoningContentBlockDeltaMemberSignature:
+				return s.delta(relaymodel.Message{Signature: reasoning.Value})
+			}
+		}
+
+		return nil
+	case *types.ConverseStreamOutputMemberMessageStop:
+		return s.chunk(&relaymodel.ChatCompletionsStreamResponseChoice{
+			FinishReason: convertStopReason(v.Value.StopReason),
+		})
+	case *types.ConverseStreamOutputMemberMetadata:
+		usage := ConvertUsage(v.Value.Usage)
+		if usage == nil {
+			return nil
+		}
+
+		chunk := s.chunk()
+		chunk.Usage = usage
+
+		return chunk
+	default:
+		return nil
+	}
+}
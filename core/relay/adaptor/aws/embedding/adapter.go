@@ -0,0 +1,276 @@
+// Package embedding provides the AWS Bedrock adaptor of the Titan and Cohere
+// embedding models, which are invoked through the InvokeModel API
+package embedding
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/bedrockruntime"
+	"github.com/bytedance/sonic"
+	"github.com/gin-gonic/gin"
+	"github.com/labring/aiproxy/core/relay/adaptor"
+	"github.com/labring/aiproxy/core/relay/adaptor/aws/utils"
+	"github.com/labring/aiproxy/core/relay/meta"
+	"github.com/labring/aiproxy/core/relay/mode"
+	relaymodel "github.com/labring/aiproxy/core/relay/model"
+	relayutils "github.com/labring/aiproxy/core/relay/utils"
+)
+
+const (
+	ConvertedRequest = "convertedRequest"
+	ResponseOutput   = "responseOutput"
+)
+
+// cohereDefaultInputType is the input type of the Cohere requests, openai
+// embedding requests do not distinguish the documents and the queries
+const cohereDefaultInputType = "search_document"
+
+type TitanRequest struct {
+	InputText string `json:"inputText"`
+}
+
+type TitanResponse struct {
+	Embedding           []float64 `json:"embedding"`
+	InputTextTokenCount int64     `json:"inputTextTokenCount"`
+}
+
+type CohereRequest struct {
+	Texts     []string `json:"texts"`
+	InputType string   `json:"input_type"`
+}
+
+type CohereResponse struct {
+	ID         string      `json:"id"`
+	Embeddings [][]float64 `json:"embeddings"`
+}
+
+type Adaptor struct{}
+
+// ConvertRequestBodies converts the openai embedding request to the request
+// bodies of the model, Titan embeds one text per request while Cohere embeds
+// all the texts in one request
+func ConvertRequestBodies(
+	awsModelID string,
+	request *relaymodel.GeneralOpenAIRequest,
+) ([][]byte, error) {
+	inputs := request.ParseInput()
+	if len(inputs) == 0 {
+		return nil, errors.New("input is empty")
+	}
+
+	if isCohereModel(awsModelID) {
+		body, err := sonic.Marshal(CohereRequest{
+			Texts:     inputs,
+			InputType: cohereDefaultInputType,
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		return [][]byte{body}, nil
+	}
+
+	bodies := make([][]byte, 0, len(inputs))
+	for _, input := range inputs {
+		body, err := sonic.Marshal(TitanRequest{
+			InputText: input,
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		bodies = append(bodies, body)
+	}
+
+	return bodies, nil
+}
+
+func (a *Adaptor) ConvertRequest(
+	meta *meta.Meta,
+	_ adaptor.Store,
+	req *http.Request,
+) (adaptor.ConvertResult, error) {
+	if meta.Mode != mode.Embeddings {
+		return adaptor.ConvertResult{}, fmt.Errorf("unsupported mode: %s", meta.Mode)
+	}
+
+	request, err := relayutils.UnmarshalGeneralOpenAIRequest(req)
+	if err != nil {
+		return adaptor.ConvertResult{}, err
+	}
+
+	bodies, err := ConvertRequestBodies(awsModelID(meta.ActualModel), request)
+	if err != nil {
+		return adaptor.ConvertResult{}, err
+	}
+
+	meta.Set(ConvertedRequest, bodies)
+
+	return adaptor.ConvertResult{}, nil
+}
+
+func (a *Adaptor) DoRequest(
+	meta *meta.Meta,
+	_ adaptor.Store,
+	c *gin.Context,
+	_ *http.Request,
+) (*http.Response, error) {
+	convReq, ok := meta.Get(ConvertedRequest)
+	if !ok {
+		return nil, relaymodel.WrapperOpenAIErrorWithMessage(
+			"request not found",
+			nil,
+			http.StatusInternalServerError,
+		)
+	}
+
+	bodies, ok := convReq.([][]byte)
+	if !ok {
+		return nil, relaymodel.WrapperOpenAIErrorWithMessage(
+			fmt.Sprintf("embedding request type error: %T", convReq),
+			nil,
+			http.StatusInternalServerError,
+		)
+	}
+
+	awsClient, err := utils.AwsClientFromMeta(meta)
+	if err != nil {
+		return nil, relaymodel.WrapperOpenAIErrorWithMessage(
+			err.Error(),
+			nil,
+			http.StatusInternalServerError,
+		)
+	}
+
+	modelID := awsModelID(meta.ActualModel)
+	outputs := make([][]byte, 0, len(bodies))
+
+	for _, body := range bodies {
+		awsResp, err := awsClient.InvokeModel(c.Request.Context(), &bedrockruntime.InvokeModelInput{
+			ModelId:     aws.String(modelID),
+			ContentType: aws.String("application/json"),
+			Accept:      aws.String("application/json"),
+			Body:        body,
+		})
+		if err != nil {
+			code, errmessage := utils.UnwrapInvokeError(err)
+			return nil, relaymodel.WrapperOpenAIErrorWithMessage(errmessage, nil, code)
+		}
+
+		outputs = append(outputs, awsResp.Body)
+	}
+
+	meta.Set(ResponseOutput, outputs)
+
+	return &http.Response{
+		StatusCode: http.StatusOK,
+	}, nil
+}
+
+// ConvertResponse converts the response bodies of the model to the openai
+// embedding response, Cohere does not return the token count so the counted
+// input tokens are used
+func ConvertResponse(meta *meta.Meta, outputs [][]byte) (*relaymodel.EmbeddingResponse, error) {
+	response := &relaymodel.EmbeddingResponse{
+		Object: "list",
+		Model:  meta.OriginModel,
+		Data:   make([]*relaymodel.EmbeddingResponseItem, 0, len(outputs)),
+	}
+
+	appendEmbedding := func(embedding []float64) {
+		response.Data = append(response.Data, &relaymodel.EmbeddingResponseItem{
+			Object:    "embedding",
+			Index:     len(response.Data),
+			Embedding: embedding,
+		})
+	}
+
+	if isCohereModel(awsModelID(meta.ActualModel)) {
+		for _, output := range outputs {
+			var cohereResp CohereResponse
+			if err := sonic.Unmarshal(output, &cohereResp); err != nil {
+				return nil, err
+			}
+
+			for _, embedding := range cohereResp.Embeddings {
+				appendEmbedding(embedding)
+			}
+		}
+
+		response.Usage.PromptTokens = int64(meta.RequestUsage.InputTokens)
+		response.Usage.TotalTokens = int64(meta.RequestUsage.InputTokens)
+
+		return response, nil
+	}
+
+	for _, output := range outputs {
+		var titanResp TitanResponse
+		if err := sonic.Unmarshal(output, &titanResp); err != nil {
+			return nil, err
+		}
+
+		appendEmbedding(titanResp.Embedding)
+
+		response.Usage.PromptTokens += titanResp.InputTextTokenCount
+	}
+
+	response.Usage.TotalTokens = response.Usage.PromptTokens
+
+	return response, nil
+}
+
+func (a *Adaptor) DoResponse(
+	meta *meta.Meta,
+	_ adaptor.Store,
+	c *gin.Context,
+) (adaptor.DoResponseResult, adaptor.Error) {
+	output, ok := meta.Get(ResponseOutput)
+	if !ok {
+		return adaptor.DoResponseResult{}, relaymodel.WrapperOpenAIErrorWithMessage(
+			"missing response",
+			nil,
+			http.StatusInternalServerError,
+		)
+	}
+
+	outputs, ok := output.([][]byte)
+	if !ok {
+		return adaptor.DoResponseResult{}, relaymodel.WrapperOpenAIErrorWithMessage(
+			"unknow response type",
+			nil,
+			http.StatusInternalServerError,
+		)
+	}
+
+	response, err := ConvertResponse(meta, outputs)
+	if err != nil {
+		return adaptor.DoResponseResult{}, relaymodel.WrapperOpenAIError(
+			err,
+			"unmarshal_response_body_failed",
+			http.StatusInternalServerError,
+		)
+	}
+
+	jsonResponse, err := sonic.Marshal(response)
+	if err != nil {
+		responseErr := relaymodel.WrapperOpenAIError(
+			err,
+			"marshal_response_body_failed",
+			http.StatusInternalServerError,
+		)
+
+		return adaptor.DoResponseResult{
+			Usage: response.Usage.ToModelUsage(),
+		}, responseErr
+	}
+
+	c.Writer.Header().Set("Content-Type", "application/json")
+	c.Writer.Header().Set("Content-Length", strconv.Itoa(len(jsonResponse)))
+	_, _ = c.Writer.Write(jsonResponse)
+
+	return adaptor.DoResponseResult{Usage: response.Usage.ToModelUsage()}, nil
+}
@@ -0,0 +1,78 @@
+package embedding_test
+
+import (
+	"testing"
+
+	"github.com/bytedance/sonic"
+	coremodel "github.com/labring/aiproxy/core/model"
+	"github.com/labring/aiproxy/core/relay/adaptor/aws/embedding"
+	"github.com/labring/aiproxy/core/relay/meta"
+	"github.com/labring/aiproxy/core/relay/mode"
+	relaymodel "github.com/labring/aiproxy/core/relay/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConvertRequestBodies(t *testing.T) {
+	request := &relaymodel.GeneralOpenAIRequest{
+		Input: []any{"first", "second"},
+	}
+
+	bodies, err := embedding.ConvertRequestBodies("amazon.titan-embed-text-v2:0", request)
+	require.NoError(t, err)
+	require.Len(t, bodies, 2)
+	assert.JSONEq(t, `{"inputText":"first"}`, string(bodies[0]))
+	assert.JSONEq(t, `{"inputText":"second"}`, string(bodies[1]))
+
+	bodies, err = embedding.ConvertRequestBodies("cohere.embed-english-v3", request)
+	require.NoError(t, err)
+	require.Len(t, bodies, 1)
+	assert.JSONEq(
+		t,
+		`{"texts":["first","second"],"input_type":"search_document"}`,
+		string(bodies[0]),
+	)
+
+	_, err = embedding.ConvertRequestBodies("cohere.embed-english-v3", &relaymodel.GeneralOpenAIRequest{})
+	require.Error(t, err)
+}
+
+func TestConvertResponse(t *testing.T) {
+	m := meta.NewMeta(nil, mode.Embeddings, "titan-embed-text-v2", coremodel.ModelConfig{})
+
+	outputs := make([][]byte, 0, 2)
+	for _, resp := range []embedding.TitanResponse{
+		{Embedding: []float64{0.1, 0.2}, InputTextTokenCount: 3},
+		{Embedding: []float64{0.3, 0.4}, InputTextTokenCount: 4},
+	} {
+		data, err := sonic.Marshal(resp)
+		require.NoError(t, err)
+
+		outputs = append(outputs, data)
+	}
+
+	resp, err := embedding.ConvertResponse(m, outputs)
+	require.NoError(t, err)
+	require.Len(t, resp.Data, 2)
+	assert.Equal(t, 1, resp.Data[1].Index)
+	assert.Equal(t, []float64{0.3, 0.4}, resp.Data[1].Embedding)
+	assert.Equal(t, int64(7), resp.Usage.PromptTokens)
+	assert.Equal(t, int64(7), resp.Usage.TotalTokens)
+
+	m = meta.NewMeta(nil, mode.Embeddings, "embed-english-v3", coremodel.ModelConfig{})
+	m.RequestUsage.InputTokens = 9
+
+	resp, err = embedding.ConvertResponse(m, [][]byte{
+		[]byte(`{"id":"x","embeddings":[[0.1],[0.2]],"response_type":"embeddings_floats"}`),
+	})
+	require.NoError(t, err)
+	require.Len(t, resp.Data, 2)
+	assert.Equal(t, []float64{0.2}, resp.Data[1].Embedding)
+	assert.Equal(t, int64(9), resp.Usage.TotalTokens)
+}
+
+func TestIsEmbeddingModel(t *testing.T) {
+	assert.True(t, embedding.IsEmbeddingModel("titan-embed-text-v2"))
+	assert.True(t, embedding.IsEmbeddingModel("cohere.embed-multilingual-v3"))
+	assert.False(t, embedding.IsEmbeddingModel("nova-pro"))
+}
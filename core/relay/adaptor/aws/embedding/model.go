@@ -0,0 +1,81 @@
+package embedding
+
+import (
+	"strings"
+
+	"github.com/labring/aiproxy/core/model"
+	"github.com/labring/aiproxy/core/relay/mode"
+)
+
+type awsModelItem struct {
+	ID string
+	model.ModelConfig
+}
+
+// AwsModelIDMap maps the model names to the Bedrock embedding model ids.
+// For more details, see: https://docs.aws.amazon.com/bedrock/latest/userguide/model-ids.html
+var AwsModelIDMap = map[string]awsModelItem{
+	"titan-embed-text-v1": {
+		ModelConfig: model.ModelConfig{
+			Type:  mode.Embeddings,
+			Owner: model.ModelOwnerAmazon,
+			Config: model.NewModelConfig(
+				model.WithModelConfigMaxInputTokens(8192),
+			),
+		},
+		ID: "amazon.titan-embed-text-v1",
+	},
+	"titan-embed-text-v2": {
+		ModelConfig: model.ModelConfig{
+			Type:  mode.Embeddings,
+			Owner: model.ModelOwnerAmazon,
+			Config: model.NewModelConfig(
+				model.WithModelConfigMaxInputTokens(8192),
+			),
+		},
+		ID: "amazon.titan-embed-text-v2:0",
+	},
+	"embed-english-v3": {
+		ModelConfig: model.ModelConfig{
+			Type:  mode.Embeddings,
+			Owner: model.ModelOwnerCohere,
+			Config: model.NewModelConfig(
+				model.WithModelConfigMaxInputTokens(512),
+			),
+		},
+		ID: "cohere.embed-english-v3",
+	},
+	"embed-multilingual-v3": {
+		ModelConfig: model.ModelConfig{
+			Type:  mode.Embeddings,
+			Owner: model.ModelOwnerCohere,
+			Config: model.NewModelConfig(
+				model.WithModelConfigMaxInputTokens(512),
+			),
+		},
+		ID: "cohere.embed-multilingual-v3",
+	},
+}
+
+func awsModelID(requestModel string) string {
+	if item, ok := AwsModelIDMap[requestModel]; ok {
+		return item.ID
+	}
+
+	return requestModel
+}
+
+func isCohereModel(awsModelID string) bool {
+	return strings.HasPrefix(awsModelID, "cohere.")
+}
+
+// IsEmbeddingModel reports whether the model is served by the embedding
+// adaptor, the raw Titan and Cohere embedding model ids are also accepted
+func IsEmbeddingModel(requestModel string) bool {
+	if _, ok := AwsModelIDMap[requestModel]; ok {
+		return true
+	}
+
+	return strings.HasPrefix(requestModel, "amazon.titan-embed") ||
+		strings.HasPrefix(requestModel, "cohere.embed")
+}
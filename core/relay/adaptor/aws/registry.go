@@ -5,6 +5,8 @@ import (
 
 	"github.com/labring/aiproxy/core/model"
 	claude "github.com/labring/aiproxy/core/relay/adaptor/aws/claude"
+	"github.com/labring/aiproxy/core/relay/adaptor/aws/converse"
+	"github.com/labring/aiproxy/core/relay/adaptor/aws/embedding"
 	"github.com/labring/aiproxy/core/relay/adaptor/aws/utils"
 )
 
@@ -12,6 +14,8 @@ type ModelType int
 
 const (
 	AwsClaude ModelType = iota + 1
+	AwsConverse
+	AwsEmbedding
 )
 
 type Model struct {
@@ -26,6 +30,16 @@ func init() {
 		model.Model = name
 		adaptors[model.Model] = Model{config: model.ModelConfig, modelType: AwsClaude}
 	}
+
+	for name, model := range converse.AwsModelIDMap {
+		model.Model = name
+		adaptors[model.Model] = Model{config: model.ModelConfig, modelType: AwsConverse}
+	}
+
+	for name, model := range embedding.AwsModelIDMap {
+		model.Model = name
+		adaptors[model.Model] = Model{config: model.ModelConfig, modelType: AwsEmbedding}
+	}
 }
 
 func GetAdaptor(model string) utils.AwsAdapter {
@@ -34,6 +48,11 @@ func GetAdaptor(model string) utils.AwsAdapter {
 	case adaptorType.modelType == AwsClaude,
 		strings.Contains(model, "claude-"):
 		return &claude.Adaptor{}
+	case adaptorType.modelType == AwsEmbedding,
+		embedding.IsEmbeddingModel(model):
+		return &embedding.Adaptor{}
+	case adaptorType.modelType == AwsConverse:
+		return &converse.Adaptor{}
 	default:
 		return nil
 	}
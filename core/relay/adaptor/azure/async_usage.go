@@ -4,19 +4,24 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"io"
 	"net/http"
 	"net/url"
 
 	"github.com/bytedance/sonic"
 	"github.com/labring/aiproxy/core/model"
 	"github.com/labring/aiproxy/core/relay/adaptor"
+	"github.com/labring/aiproxy/core/relay/adaptor/openai"
 	"github.com/labring/aiproxy/core/relay/mode"
 	relaymodel "github.com/labring/aiproxy/core/relay/model"
 	relayutils "github.com/labring/aiproxy/core/relay/utils"
 	log "github.com/sirupsen/logrus"
 )
 
-var _ adaptor.AsyncUsageFetcher = (*Adaptor)(nil)
+var (
+	_ adaptor.AsyncUsageFetcher      = (*Adaptor)(nil)
+	_ adaptor.AsyncModelUsageFetcher = (*Adaptor)(nil)
+)
 
 func (a *Adaptor) FetchAsyncUsage(
 	ctx context.Context,
@@ -34,6 +39,9 @@ func (a *Adaptor) FetchAsyncUsage(
 		return a.fetchVideoJobUsage(ctx, channel, info)
 	case mode.Responses, mode.ChatCompletions, mode.Anthropic, mode.Gemini:
 		return a.fetchResponseUsage(ctx, channel, info)
+	case mode.Batches:
+		usages, completed, err := a.fetchBatchUsage(ctx, channel, info, request.Store)
+		return openai.SumModelUsages(usages), model.UsageContext{}, completed, err
 	default:
 		return model.Usage{}, model.UsageContext{}, false, fmt.Errorf(
 			"unsupported async usage mode: %d",
@@ -42,6 +50,18 @@ func (a *Adaptor) FetchAsyncUsage(
 	}
 }
 
+// FetchAsyncModelUsage returns the usage of a batch by the model of its requests
+func (a *Adaptor) FetchAsyncModelUsage(
+	ctx context.Context,
+	request adaptor.AsyncUsageRequest,
+) (map[string]model.Usage, bool, error) {
+	if mode.Mode(request.Info.Mode) != mode.Batches {
+		return nil, false, fmt.Errorf("unsupported async model usage mode: %d", request.Info.Mode)
+	}
+
+	return a.fetchBatchUsage(ctx, request.Channel, request.Info, request.Store)
+}
+
 func (a *Adaptor) fetchVideoJobUsage(
 	ctx context.Context,
 	channel *model.Channel,
@@ -183,6 +203,93 @@ func (a *Adaptor) fetchResponseUsage(
 	}
 }
 
+func (a *Adaptor) fetchBatchUsage(
+	ctx context.Context,
+	channel *model.Channel,
+	info *model.AsyncUsageInfo,
+	store adaptor.Store,
+) (map[string]model.Usage, bool, error) {
+	resp, err := a.fetchAsyncUsageObject(ctx, channel, info, "/openai/batches", false)
+	if err != nil {
+		return nil, false, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, false, fmt.Errorf(
+			"unexpected status code: %d",
+			resp.StatusCode,
+		)
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, false, fmt.Errorf("read batch: %w", err)
+	}
+
+	var batch relaymodel.Batch
+	if err := sonic.Unmarshal(body, &batch); err != nil {
+		return nil, false, fmt.Errorf("decode batch: %w", err)
+	}
+
+	if err := openai.UpdateBatchStore(
+		store,
+		info.GroupID,
+		info.TokenID,
+		batch.ID,
+		body,
+	); err != nil {
+		log.Warnf("async usage update batch store failed: id=%d batch_id=%s err=%v",
+			info.ID,
+			batch.ID,
+			err,
+		)
+	}
+
+	if !batch.IsFinished() {
+		return nil, false, nil
+	}
+
+	if batch.OutputFileID == "" {
+		if batch.Status == relaymodel.BatchStatusFailed {
+			return nil, true, fmt.Errorf(
+				"batch ended with status %q",
+				batch.Status,
+			)
+		}
+
+		return nil, true, nil
+	}
+
+	outputResp, err := a.fetchAsyncUsageURL(
+		ctx,
+		channel,
+		info,
+		false,
+		"/openai/files",
+		batch.OutputFileID,
+		"content",
+	)
+	if err != nil {
+		return nil, false, err
+	}
+	defer outputResp.Body.Close()
+
+	if outputResp.StatusCode != http.StatusOK {
+		return nil, false, fmt.Errorf(
+			"unexpected batch output status code: %d",
+			outputResp.StatusCode,
+		)
+	}
+
+	usages, err := openai.BatchOutputModelUsages(outputResp.Body)
+	if err != nil {
+		return nil, false, err
+	}
+
+	return usages, true, nil
+}
+
 func (a *Adaptor) fetchAsyncUsageObject(
 	ctx context.Context,
 	channel *model.Channel,
@@ -194,6 +301,17 @@ func (a *Adaptor) fetchAsyncUsageObject(
 		return nil, errors.New("upstream id is empty")
 	}
 
+	return a.fetchAsyncUsageURL(ctx, channel, info, responsesPreview, path, info.UpstreamID)
+}
+
+func (a *Adaptor) fetchAsyncUsageURL(
+	ctx context.Context,
+	channel *model.Channel,
+	info *model.AsyncUsageInfo,
+	responsesPreview bool,
+	path string,
+	elem ...string,
+) (*http.Response, error) {
 	token, apiVersion, err := GetTokenAndAPIVersion(channel.Key)
 	if err != nil {
 		return nil, fmt.Errorf("parse azure key: %w", err)
@@ -212,7 +330,7 @@ func (a *Adaptor) fetchAsyncUsageObject(
 		baseURL = a.DefaultBaseURL()
 	}
 
-	requestURL, err := url.JoinPath(baseURL, path, info.UpstreamID)
+	requestURL, err := url.JoinPath(baseURL, append([]string{path}, elem...)...)
 	if err != nil {
 		return nil, fmt.Errorf("build async usage url: %w", err)
 	}
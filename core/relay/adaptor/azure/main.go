@@ -330,6 +330,97 @@ func GetRequestURL(meta *meta.Meta, replaceDot bool) (adaptor.RequestURL, error)
 			URL:    fmt.Sprintf("%s?api-version=%s", url, "preview"),
 		}, nil
 
+	case mode.Files:
+		// https://learn.microsoft.com/en-us/azure/ai-services/openai/reference#files---upload
+		url, err := url.JoinPath(meta.Channel.BaseURL, "/openai/files")
+		if err != nil {
+			return adaptor.RequestURL{}, err
+		}
+
+		return adaptor.RequestURL{
+			Method: http.MethodPost,
+			URL:    fmt.Sprintf("%s?api-version=%s", url, apiVersion),
+		}, nil
+	case mode.FilesGet:
+		url, err := url.JoinPath(meta.Channel.BaseURL, "/openai/files", meta.FileID)
+		if err != nil {
+			return adaptor.RequestURL{}, err
+		}
+
+		return adaptor.RequestURL{
+			Method: http.MethodGet,
+			URL:    fmt.Sprintf("%s?api-version=%s", url, apiVersion),
+		}, nil
+	case mode.FilesDelete:
+		url, err := url.JoinPath(meta.Channel.BaseURL, "/openai/files", meta.FileID)
+		if err != nil {
+			return adaptor.RequestURL{}, err
+		}
+
+		return adaptor.RequestURL{
+			Method: http.MethodDelete,
+			URL:    fmt.Sprintf("%s?api-version=%s", url, apiVersion),
+		}, nil
+	case mode.FilesContent:
+		url, err := url.JoinPath(meta.Channel.BaseURL, "/openai/files", meta.FileID, "content")
+		if err != nil {
+			return adaptor.RequestURL{}, err
+		}
+
+		return adaptor.RequestURL{
+			Method: http.MethodGet,
+			URL:    fmt.Sprintf("%s?api-version=%s", url, apiVersion),
+		}, nil
+
+	case mode.Batches:
+		// https://learn.microsoft.com/en-us/azure/ai-services/openai/how-to/batch
+		url, err := url.JoinPath(meta.Channel.BaseURL, "/openai/batches")
+		if err != nil {
+			return adaptor.RequestURL{}, err
+		}
+
+		return adaptor.RequestURL{
+			Method: http.MethodPost,
+			URL:    fmt.Sprintf("%s?api-version=%s", url, apiVersion),
+		}, nil
+	case mode.BatchesGet:
+		url, err := url.JoinPath(meta.Channel.BaseURL, "/openai/batches", meta.BatchID)
+		if err != nil {
+			return adaptor.RequestURL{}, err
+		}
+
+		return adaptor.RequestURL{
+			Method: http.MethodGet,
+			URL:    fmt.Sprintf("%s?api-version=%s", url, apiVersion),
+		}, nil
+	case mode.BatchesCancel:
+		url, err := url.JoinPath(meta.Channel.BaseURL, "/openai/batches", meta.BatchID, "cancel")
+		if err != nil {
+			return adaptor.RequestURL{}, err
+		}
+
+		return adaptor.RequestURL{
+			Method: http.MethodPost,
+			URL:    fmt.Sprintf("%s?api-version=%s", url, apiVersion),
+		}, nil
+
+	case mode.Realtime:
+		// https://learn.microsoft.com/en-us/azure/ai-foundry/openai/how-to/realtime-audio-websockets
+		url, err := url.JoinPath(meta.Channel.BaseURL, "/openai/realtime")
+		if err != nil {
+			return adaptor.RequestURL{}, err
+		}
+
+		return adaptor.RequestURL{
+			Method: http.MethodGet,
+			URL: fmt.Sprintf(
+				"%s?api-version=%s&deployment=%s",
+				url,
+				apiVersion,
+				model,
+			),
+		}, nil
+
 	// Add support for Responses API endpoints
 	case mode.Responses:
 		// POST https://YOUR-RESOURCE-NAME.openai.azure.com/openai/v1/responses?api-version=preview
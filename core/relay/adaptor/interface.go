@@ -99,6 +99,16 @@ type AsyncUsageFetcher interface {
 	) (usage model.Usage, usageContext model.UsageContext, completed bool, err error)
 }
 
+// AsyncModelUsageFetcher is implemented by the fetchers of the batches, whose
+// requests may use several models, the usage is returned by model so that every
+// model is billed at its own price
+type AsyncModelUsageFetcher interface {
+	FetchAsyncModelUsage(
+		ctx context.Context,
+		request AsyncUsageRequest,
+	) (usages map[string]model.Usage, completed bool, err error)
+}
+
 type Adaptor interface {
 	Metadata() Metadata
 	SupportMode(meta *meta.Meta) bool
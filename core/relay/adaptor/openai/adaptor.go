@@ -64,7 +64,15 @@ func (a *Adaptor) SupportMode(mt *meta.Meta) bool {
 		m == mode.ResponsesDelete ||
 		m == mode.ResponsesCancel ||
 		m == mode.ResponsesInputItems ||
-		m == mode.AlphaSearch
+		m == mode.AlphaSearch ||
+		m == mode.Files ||
+		m == mode.FilesGet ||
+		m == mode.FilesDelete ||
+		m == mode.FilesContent ||
+		m == mode.Batches ||
+		m == mode.BatchesGet ||
+		m == mode.BatchesCancel ||
+		m == mode.Realtime
 }
 
 //nolint:gocyclo
@@ -146,6 +154,86 @@ func (a *Adaptor) GetRequestURL(
 			Method: http.MethodGet,
 			URL:    url,
 		}, nil
+	case mode.Files:
+		url, err := url.JoinPath(u, "/files")
+		if err != nil {
+			return adaptor.RequestURL{}, err
+		}
+
+		return adaptor.RequestURL{
+			Method: http.MethodPost,
+			URL:    url,
+		}, nil
+	case mode.FilesGet:
+		url, err := url.JoinPath(u, "/files", meta.FileID)
+		if err != nil {
+			return adaptor.RequestURL{}, err
+		}
+
+		return adaptor.RequestURL{
+			Method: http.MethodGet,
+			URL:    url,
+		}, nil
+	case mode.FilesDelete:
+		url, err := url.JoinPath(u, "/files", meta.FileID)
+		if err != nil {
+			return adaptor.RequestURL{}, err
+		}
+
+		return adaptor.RequestURL{
+			Method: http.MethodDelete,
+			URL:    url,
+		}, nil
+	case mode.FilesContent:
+		url, err := url.JoinPath(u, "/files", meta.FileID, "content")
+		if err != nil {
+			return adaptor.RequestURL{}, err
+		}
+
+		return adaptor.RequestURL{
+			Method: http.MethodGet,
+			URL:    url,
+		}, nil
+	case mode.Batches:
+		url, err := url.JoinPath(u, "/batches")
+		if err != nil {
+			return adaptor.RequestURL{}, err
+		}
+
+		return adaptor.RequestURL{
+			Method: http.MethodPost,
+			URL:    url,
+		}, nil
+	case mode.BatchesGet:
+		url, err := url.JoinPath(u, "/batches", meta.BatchID)
+		if err != nil {
+			return adaptor.RequestURL{}, err
+		}
+
+		return adaptor.RequestURL{
+			Method: http.MethodGet,
+			URL:    url,
+		}, nil
+	case mode.BatchesCancel:
+		url, err := url.JoinPath(u, "/batches", meta.BatchID, "cancel")
+		if err != nil {
+			return adaptor.RequestURL{}, err
+		}
+
+		return adaptor.RequestURL{
+			Method: http.MethodPost,
+			URL:    url,
+		}, nil
+	case mode.Realtime:
+		realtimeURL, err := url.JoinPath(u, "/realtime")
+		if err != nil {
+			return adaptor.RequestURL{}, err
+		}
+
+		return adaptor.RequestURL{
+			Method: http.MethodGet,
+			URL:    realtimeURL + "?model=" + url.QueryEscape(meta.ActualModel),
+		}, nil
 	case mode.ChatCompletions, mode.Anthropic, mode.Gemini:
 		// Check if model requires Responses API
 		if IsResponsesOnlyModelAny(&meta.ModelConfig, meta.OriginModel, meta.ActualModel) {
@@ -430,6 +518,17 @@ func ConvertRequest(
 	case mode.ResponsesGet, mode.ResponsesDelete, mode.ResponsesCancel, mode.ResponsesInputItems:
 		// These endpoints don't need request conversion
 		return adaptor.ConvertResult{}, nil
+	case mode.Files:
+		return ConvertFilesRequest(meta, req)
+	case mode.FilesGet, mode.FilesDelete, mode.FilesContent:
+		return ConvertFileNoBodyRequest(meta, req)
+	case mode.Batches:
+		return ConvertBatchesRequest(meta, req)
+	case mode.Realtime:
+		return adaptor.ConvertResult{}, nil
+	case mode.BatchesGet, mode.BatchesCancel:
+		// These endpoints don't need request conversion
+		return adaptor.ConvertResult{}, nil
 	case mode.Moderations:
 		return ConvertModerationsRequest(meta, req)
 	case mode.Embeddings:
@@ -537,6 +636,20 @@ func doResponse(
 		result, err = CancelResponseHandler(meta, c, resp)
 	case mode.ResponsesInputItems:
 		result, err = GetInputItemsHandler(meta, c, resp)
+	case mode.Files:
+		result, err = FilesHandler(meta, store, c, resp)
+	case mode.FilesGet:
+		result, err = FileGetHandler(meta, c, resp)
+	case mode.FilesDelete:
+		result, err = FileDeleteHandler(meta, store, c, resp)
+	case mode.FilesContent:
+		result, err = FileContentHandler(meta, c, resp)
+	case mode.Batches:
+		result, err = BatchesHandler(meta, store, c, resp)
+	case mode.Realtime:
+		result, err = RealtimeHandler(meta, c, resp)
+	case mode.BatchesGet, mode.BatchesCancel:
+		result, err = BatchGetHandler(meta, store, c, resp)
 	case mode.ImagesGenerations, mode.ImagesEdits:
 		if utils.IsStreamResponse(resp) {
 			result, err = ImagesStreamHandler(meta, c, resp)
@@ -657,9 +770,13 @@ const MetaResponseFormat = "response_format"
 func (a *Adaptor) DoRequest(
 	meta *meta.Meta,
 	_ adaptor.Store,
-	_ *gin.Context,
+	c *gin.Context,
 	req *http.Request,
 ) (*http.Response, error) {
+	if meta.Mode == mode.Realtime {
+		return RealtimeDoRequest(meta, c, req)
+	}
+
 	return utils.DoRequestWithMeta(req, meta)
 }
 
@@ -690,7 +807,7 @@ func (a *Adaptor) DoResponse(
 
 func (a *Adaptor) Metadata() adaptor.Metadata {
 	return adaptor.Metadata{
-		Readme:       "OpenAI native API\nSupports chat, completions, embeddings, moderations, image, audio, rerank, PDF parsing, video generation, and Responses API\nAlso supports Anthropic-compatible and Gemini-compatible request conversion on top of the OpenAI endpoint\nChannel config `responses_first_event_timeout` sets the maximum seconds to wait for the first effective Responses stream event\nChannel config `map_reasoning_to_reasoning_content` rewrites upstream `reasoning` fields to `reasoning_content` in chat completion responses",
+		Readme:       "OpenAI native API\nSupports chat, completions, embeddings, moderations, image, audio, rerank, PDF parsing, video generation, Responses API, Files API, Batch API and Realtime API\nAlso supports Anthropic-compatible and Gemini-compatible request conversion on top of the OpenAI endpoint\nChannel config `responses_first_event_timeout` sets the maximum seconds to wait for the first effective Responses stream event\nChannel config `map_reasoning_to_reasoning_content` rewrites upstream `reasoning` fields to `reasoning_content` in chat completion responses",
 		ConfigSchema: ConfigSchema(),
 		Models:       ModelList,
 	}
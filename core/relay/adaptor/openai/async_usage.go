@@ -4,6 +4,7 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"io"
 	"net/http"
 	"net/url"
 
@@ -16,7 +17,10 @@ import (
 	log "github.com/sirupsen/logrus"
 )
 
-var _ adaptor.AsyncUsageFetcher = (*Adaptor)(nil)
+var (
+	_ adaptor.AsyncUsageFetcher      = (*Adaptor)(nil)
+	_ adaptor.AsyncModelUsageFetcher = (*Adaptor)(nil)
+)
 
 func (a *Adaptor) FetchAsyncUsage(
 	ctx context.Context,
@@ -34,6 +38,9 @@ func (a *Adaptor) FetchAsyncUsage(
 		return a.fetchVideoUsage(ctx, channel, info)
 	case mode.Responses, mode.ChatCompletions, mode.Anthropic, mode.Gemini:
 		return a.fetchResponseUsage(ctx, channel, info)
+	case mode.Batches:
+		usages, completed, err := a.fetchBatchUsage(ctx, channel, info, request.Store)
+		return SumModelUsages(usages), model.UsageContext{}, completed, err
 	default:
 		return model.Usage{}, model.UsageContext{}, false, fmt.Errorf(
 			"unsupported async usage mode: %d",
@@ -42,6 +49,18 @@ func (a *Adaptor) FetchAsyncUsage(
 	}
 }
 
+// FetchAsyncModelUsage returns the usage of a batch by the model of its requests
+func (a *Adaptor) FetchAsyncModelUsage(
+	ctx context.Context,
+	request adaptor.AsyncUsageRequest,
+) (map[string]model.Usage, bool, error) {
+	if mode.Mode(request.Info.Mode) != mode.Batches {
+		return nil, false, fmt.Errorf("unsupported async model usage mode: %d", request.Info.Mode)
+	}
+
+	return a.fetchBatchUsage(ctx, request.Channel, request.Info, request.Store)
+}
+
 func (a *Adaptor) fetchVideoUsage(
 	ctx context.Context,
 	channel *model.Channel,
@@ -175,15 +194,112 @@ func (a *Adaptor) fetchResponseUsage(
 	}
 }
 
+// fetchBatchUsage settles the batch once it is finished, the usage is summed by model
+// from the output file, so the requests that were completed before a batch expired or
+// was cancelled are billed as well
+func (a *Adaptor) fetchBatchUsage(
+	ctx context.Context,
+	channel *model.Channel,
+	info *model.AsyncUsageInfo,
+	store adaptor.Store,
+) (map[string]model.Usage, bool, error) {
+	if info.UpstreamID == "" {
+		return nil, false, errors.New("upstream id is empty")
+	}
+
+	resp, err := a.fetchAsyncUsageObject(ctx, channel, info, "/batches")
+	if err != nil {
+		return nil, false, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, false, fmt.Errorf(
+			"unexpected status code: %d",
+			resp.StatusCode,
+		)
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, false, fmt.Errorf("read batch: %w", err)
+	}
+
+	var batch relaymodel.Batch
+	if err := sonic.Unmarshal(body, &batch); err != nil {
+		return nil, false, fmt.Errorf("decode batch: %w", err)
+	}
+
+	if err := UpdateBatchStore(store, info.GroupID, info.TokenID, batch.ID, body); err != nil {
+		log.Warnf("async usage update batch store failed: id=%d batch_id=%s err=%v",
+			info.ID,
+			batch.ID,
+			err,
+		)
+	}
+
+	if !batch.IsFinished() {
+		return nil, false, nil
+	}
+
+	if batch.OutputFileID == "" {
+		if batch.Status == relaymodel.BatchStatusFailed {
+			return nil, true, fmt.Errorf(
+				"batch ended with status %q",
+				batch.Status,
+			)
+		}
+
+		return nil, true, nil
+	}
+
+	outputResp, err := a.fetchAsyncUsageURL(
+		ctx,
+		channel,
+		info,
+		"/files",
+		batch.OutputFileID,
+		"content",
+	)
+	if err != nil {
+		return nil, false, err
+	}
+	defer outputResp.Body.Close()
+
+	if outputResp.StatusCode != http.StatusOK {
+		return nil, false, fmt.Errorf(
+			"unexpected batch output status code: %d",
+			outputResp.StatusCode,
+		)
+	}
+
+	usages, err := BatchOutputModelUsages(outputResp.Body)
+	if err != nil {
+		return nil, false, err
+	}
+
+	return usages, true, nil
+}
+
 func (a *Adaptor) fetchAsyncUsageObject(
 	ctx context.Context,
 	channel *model.Channel,
 	info *model.AsyncUsageInfo,
 	path string,
+) (*http.Response, error) {
+	return a.fetchAsyncUsageURL(ctx, channel, info, path, info.UpstreamID)
+}
+
+func (a *Adaptor) fetchAsyncUsageURL(
+	ctx context.Context,
+	channel *model.Channel,
+	info *model.AsyncUsageInfo,
+	path string,
+	elem ...string,
 ) (*http.Response, error) {
 	baseURL := asyncUsageBaseURL(channel, info, a.DefaultBaseURL())
 
-	requestURL, err := url.JoinPath(baseURL, path, info.UpstreamID)
+	requestURL, err := url.JoinPath(baseURL, append([]string{path}, elem...)...)
 	if err != nil {
 		return nil, fmt.Errorf("build async usage url: %w", err)
 	}
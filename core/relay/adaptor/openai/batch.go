@@ -0,0 +1,218 @@
+package openai
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/bytedance/sonic"
+	"github.com/gin-gonic/gin"
+	"github.com/labring/aiproxy/core/common"
+	"github.com/labring/aiproxy/core/model"
+	"github.com/labring/aiproxy/core/relay/adaptor"
+	"github.com/labring/aiproxy/core/relay/meta"
+	relaymodel "github.com/labring/aiproxy/core/relay/model"
+)
+
+func ConvertBatchesRequest(
+	_ *meta.Meta,
+	req *http.Request,
+) (adaptor.ConvertResult, error) {
+	body, err := common.GetRequestBodyReusable(req)
+	if err != nil {
+		return adaptor.ConvertResult{}, err
+	}
+
+	return adaptor.ConvertResult{
+		Header: http.Header{
+			"Content-Type":   {"application/json"},
+			"Content-Length": {strconv.Itoa(len(body))},
+		},
+		Body: bytes.NewReader(body),
+	}, nil
+}
+
+// BatchesHandler pins the created batch to the channel, and returns the batch id as the
+// upstream id so that the batch usage is settled asynchronously once the batch is finished
+func BatchesHandler(
+	meta *meta.Meta,
+	store adaptor.Store,
+	c *gin.Context,
+	resp *http.Response,
+) (adaptor.DoResponseResult, adaptor.Error) {
+	if resp.StatusCode != http.StatusOK {
+		return adaptor.DoResponseResult{}, ErrorHanlder(resp)
+	}
+
+	defer resp.Body.Close()
+
+	responseBody, err := common.GetResponseBody(resp)
+	if err != nil {
+		return adaptor.DoResponseResult{}, relaymodel.WrapperOpenAIError(
+			err,
+			"read_response_body_failed",
+			http.StatusInternalServerError,
+		)
+	}
+
+	var batch relaymodel.Batch
+	if err := sonic.Unmarshal(responseBody, &batch); err != nil {
+		return adaptor.DoResponseResult{}, relaymodel.WrapperOpenAIError(
+			err,
+			"unmarshal_response_body_failed",
+			http.StatusInternalServerError,
+		)
+	}
+
+	if batch.ID == "" {
+		return adaptor.DoResponseResult{}, relaymodel.WrapperOpenAIErrorWithMessage(
+			"batch id is empty",
+			"get_batch_id_failed",
+			http.StatusInternalServerError,
+		)
+	}
+
+	if store != nil {
+		err := store.SaveStore(adaptor.StoreCache{
+			ID:        model.BatchStoreID(batch.ID),
+			GroupID:   meta.Group.ID,
+			TokenID:   meta.Token.ID,
+			ChannelID: meta.Channel.ID,
+			Model:     meta.OriginModel,
+			Metadata:  string(responseBody),
+		})
+		if err != nil {
+			log := common.GetLogger(c)
+			log.Errorf("save batch store failed: %v", err)
+		}
+	}
+
+	c.Writer.Header().Set("Content-Type", "application/json")
+	c.Writer.Header().Set("Content-Length", strconv.Itoa(len(responseBody)))
+	_, _ = c.Writer.Write(responseBody)
+
+	return adaptor.DoResponseResult{
+		UpstreamID: batch.ID,
+		AsyncUsage: true,
+	}, nil
+}
+
+// BatchGetHandler refreshes the batch object kept in the store, it's also used by cancel
+func BatchGetHandler(
+	meta *meta.Meta,
+	store adaptor.Store,
+	c *gin.Context,
+	resp *http.Response,
+) (adaptor.DoResponseResult, adaptor.Error) {
+	if resp.StatusCode != http.StatusOK {
+		return adaptor.DoResponseResult{}, ErrorHanlder(resp)
+	}
+
+	defer resp.Body.Close()
+
+	responseBody, err := common.GetResponseBody(resp)
+	if err != nil {
+		return adaptor.DoResponseResult{}, relaymodel.WrapperOpenAIError(
+			err,
+			"read_response_body_failed",
+			http.StatusInternalServerError,
+		)
+	}
+
+	if err := UpdateBatchStore(
+		store,
+		meta.Group.ID,
+		meta.Token.ID,
+		meta.BatchID,
+		responseBody,
+	); err != nil {
+		log := common.GetLogger(c)
+		log.Errorf("update batch store failed: %v", err)
+	}
+
+	c.Writer.Header().Set("Content-Type", "application/json")
+	c.Writer.Header().Set("Content-Length", strconv.Itoa(len(responseBody)))
+	_, _ = c.Writer.Write(responseBody)
+
+	return adaptor.DoResponseResult{}, nil
+}
+
+// UpdateBatchStore replaces the batch object kept in the store, so that the batch list
+// reflects the latest status of the batch
+func UpdateBatchStore(
+	store adaptor.Store,
+	groupID string,
+	tokenID int,
+	batchID string,
+	batch []byte,
+) error {
+	if store == nil || batchID == "" || len(batch) == 0 {
+		return nil
+	}
+
+	cache, err := store.GetStore(groupID, tokenID, model.BatchStoreID(batchID))
+	if err != nil {
+		return err
+	}
+
+	cache.Metadata = string(batch)
+	cache.UpdatedAt = time.Now()
+
+	return store.SaveStore(cache)
+}
+
+// BatchOutputUsage sums the usage of every successful request in a batch output file
+func BatchOutputUsage(r io.Reader) (model.Usage, error) {
+	usages, err := BatchOutputModelUsages(r)
+	if err != nil {
+		return model.Usage{}, err
+	}
+
+	return SumModelUsages(usages), nil
+}
+
+// BatchOutputModelUsages sums the usage of every successful request in a batch output
+// file by the model that served the request, a batch may mix several models
+func BatchOutputModelUsages(r io.Reader) (map[string]model.Usage, error) {
+	usages := make(map[string]model.Usage)
+
+	reader := bufio.NewReader(r)
+	for {
+		line, err := reader.ReadBytes('\n')
+		if len(bytes.TrimSpace(line)) > 0 {
+			var outputLine relaymodel.BatchOutputLine
+			if err := sonic.Unmarshal(line, &outputLine); err != nil {
+				return nil, fmt.Errorf("decode batch output line: %w", err)
+			}
+
+			if usage := outputLine.ToModelUsage(); usage != (model.Usage{}) {
+				modelUsage := usages[outputLine.Model()]
+				modelUsage.Add(usage)
+				usages[outputLine.Model()] = modelUsage
+			}
+		}
+
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				return usages, nil
+			}
+
+			return nil, fmt.Errorf("read batch output: %w", err)
+		}
+	}
+}
+
+// SumModelUsages returns the total usage of every model
+func SumModelUsages(usages map[string]model.Usage) model.Usage {
+	var total model.Usage
+	for _, usage := range usages {
+		total.Add(usage)
+	}
+
+	return total
+}
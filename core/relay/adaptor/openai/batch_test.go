@@ -0,0 +1,88 @@
+//nolint:testpackage
+package openai
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	coremodel "github.com/labring/aiproxy/core/model"
+	"github.com/labring/aiproxy/core/relay/adaptor"
+	"github.com/labring/aiproxy/core/relay/mode"
+	"github.com/stretchr/testify/require"
+)
+
+const testBatchOutput = `{"id":"req_1","custom_id":"1","response":{"status_code":200,"body":{"model":"gpt-4o-mini","usage":{"prompt_tokens":10,"completion_tokens":5,"total_tokens":15,"prompt_tokens_details":{"cached_tokens":4}}}}}
+{"id":"req_2","custom_id":"2","response":{"status_code":200,"body":{"model":"o4-mini","usage":{"input_tokens":20,"output_tokens":8,"total_tokens":28,"output_tokens_details":{"reasoning_tokens":3}}}}}
+{"id":"req_3","custom_id":"3","response":{"status_code":400,"body":{"error":{"message":"bad request"}}}}
+{"id":"req_4","custom_id":"4","response":null,"error":{"code":"batch_expired"}}
+`
+
+func TestBatchOutputUsage(t *testing.T) {
+	t.Parallel()
+
+	usage, err := BatchOutputUsage(strings.NewReader(testBatchOutput))
+	require.NoError(t, err)
+	require.EqualValues(t, 30, usage.InputTokens)
+	require.EqualValues(t, 13, usage.OutputTokens)
+	require.EqualValues(t, 43, usage.TotalTokens)
+	require.EqualValues(t, 4, usage.CachedTokens)
+	require.EqualValues(t, 3, usage.ReasoningTokens)
+
+	_, err = BatchOutputUsage(strings.NewReader("not json\n"))
+	require.Error(t, err)
+}
+
+func TestBatchOutputModelUsages(t *testing.T) {
+	t.Parallel()
+
+	usages, err := BatchOutputModelUsages(strings.NewReader(testBatchOutput))
+	require.NoError(t, err)
+	require.Len(t, usages, 2)
+	require.EqualValues(t, 15, usages["gpt-4o-mini"].TotalTokens)
+	require.EqualValues(t, 28, usages["o4-mini"].TotalTokens)
+	require.EqualValues(t, 3, usages["o4-mini"].ReasoningTokens)
+}
+
+func TestFetchBatchUsage(t *testing.T) {
+	t.Parallel()
+
+	status := "in_progress"
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/batches/batch_1":
+			w.Header().Set("Content-Type", "application/json")
+			_, _ = w.Write([]byte(
+				`{"id":"batch_1","object":"batch","status":"` + status + `","output_file_id":"file_out"}`,
+			))
+		case "/files/file_out/content":
+			_, _ = w.Write([]byte(testBatchOutput))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	a := &Adaptor{}
+	request := adaptor.AsyncUsageRequest{
+		Channel: &coremodel.Channel{BaseURL: server.URL, Key: "sk-test"},
+		Info: &coremodel.AsyncUsageInfo{
+			Mode:       int(mode.Batches),
+			UpstreamID: "batch_1",
+		},
+	}
+
+	_, _, completed, err := a.FetchAsyncUsage(t.Context(), request)
+	require.NoError(t, err)
+	require.False(t, completed)
+
+	status = "completed"
+
+	usage, _, completed, err := a.FetchAsyncUsage(t.Context(), request)
+	require.NoError(t, err)
+	require.True(t, completed)
+	require.EqualValues(t, 30, usage.InputTokens)
+	require.EqualValues(t, 13, usage.OutputTokens)
+}
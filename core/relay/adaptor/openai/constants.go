@@ -1352,6 +1352,38 @@ var ModelList = []model.ModelConfig{
 		Type:  mode.AudioSpeech,
 		Owner: model.ModelOwnerOpenAI,
 	},
+	{
+		Model: "gpt-realtime",
+		Type:  mode.Realtime,
+		Owner: model.ModelOwnerOpenAI,
+		Price: model.Price{
+			InputPrice:       0.004,
+			OutputPrice:      0.016,
+			CachedPrice:      0.0004,
+			AudioInputPrice:  0.032,
+			AudioOutputPrice: 0.064,
+		},
+		Config: model.NewModelConfig(
+			model.WithModelConfigMaxContextTokens(32000),
+			model.WithModelConfigToolChoice(true),
+		),
+	},
+	{
+		Model: "gpt-realtime-mini",
+		Type:  mode.Realtime,
+		Owner: model.ModelOwnerOpenAI,
+		Price: model.Price{
+			InputPrice:       0.0006,
+			OutputPrice:      0.0024,
+			CachedPrice:      0.00006,
+			AudioInputPrice:  0.01,
+			AudioOutputPrice: 0.02,
+		},
+		Config: model.NewModelConfig(
+			model.WithModelConfigMaxContextTokens(32000),
+			model.WithModelConfigToolChoice(true),
+		),
+	},
 }
 
 // no dot
@@ -0,0 +1,209 @@
+package openai
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/labring/aiproxy/core/common"
+	"github.com/labring/aiproxy/core/model"
+	"github.com/labring/aiproxy/core/relay/adaptor"
+	"github.com/labring/aiproxy/core/relay/meta"
+	relaymodel "github.com/labring/aiproxy/core/relay/model"
+)
+
+// ConvertFilesRequest rebuilds the upload form, the `model` field is only used by
+// aiproxy to select the channel and is not sent upstream
+func ConvertFilesRequest(
+	meta *meta.Meta,
+	request *http.Request,
+) (adaptor.ConvertResult, error) {
+	if err := common.ParseMultipartFormWithLimit(request); err != nil {
+		return adaptor.ConvertResult{}, convertRequestError(
+			meta,
+			fmt.Sprintf("parse multipart form: %s", err),
+		)
+	}
+
+	multipartBody := &bytes.Buffer{}
+	multipartWriter := multipart.NewWriter(multipartBody)
+
+	for key, values := range request.MultipartForm.Value {
+		if len(values) == 0 || key == "model" {
+			continue
+		}
+
+		if err := multipartWriter.WriteField(key, values[0]); err != nil {
+			return adaptor.ConvertResult{}, fmt.Errorf("write field %s: %w", key, err)
+		}
+	}
+
+	if err := processFormFiles(multipartWriter, request.MultipartForm.File); err != nil {
+		return adaptor.ConvertResult{}, fmt.Errorf("process form files: %w", err)
+	}
+
+	if err := multipartWriter.Close(); err != nil {
+		return adaptor.ConvertResult{}, err
+	}
+
+	return adaptor.ConvertResult{
+		Header: http.Header{
+			"Content-Type": {multipartWriter.FormDataContentType()},
+		},
+		Body: multipartBody,
+	}, nil
+}
+
+func ConvertFileNoBodyRequest(
+	_ *meta.Meta,
+	_ *http.Request,
+) (adaptor.ConvertResult, error) {
+	return adaptor.ConvertResult{}, nil
+}
+
+// FilesHandler pins the uploaded file to the channel, the file object is kept in the
+// store metadata so that files can be listed per group and token
+func FilesHandler(
+	meta *meta.Meta,
+	store adaptor.Store,
+	c *gin.Context,
+	resp *http.Response,
+) (adaptor.DoResponseResult, adaptor.Error) {
+	if resp.StatusCode != http.StatusOK {
+		return adaptor.DoResponseResult{}, ErrorHanlder(resp)
+	}
+
+	defer resp.Body.Close()
+
+	responseBody, err := common.GetResponseBody(resp)
+	if err != nil {
+		return adaptor.DoResponseResult{}, relaymodel.WrapperOpenAIError(
+			err,
+			"read_response_body_failed",
+			http.StatusInternalServerError,
+		)
+	}
+
+	node, err := common.GetJSONNodeNoCopy(responseBody)
+	if err != nil {
+		return adaptor.DoResponseResult{}, relaymodel.WrapperOpenAIError(
+			err,
+			"unmarshal_response_body_failed",
+			http.StatusInternalServerError,
+		)
+	}
+
+	id, err := node.Get("id").String()
+	if err != nil {
+		return adaptor.DoResponseResult{}, relaymodel.WrapperOpenAIError(
+			err,
+			"get_file_id_failed",
+			http.StatusInternalServerError,
+		)
+	}
+
+	var expiresAt time.Time
+	if expiresAtUnix, err := node.Get("expires_at").Int64(); err == nil && expiresAtUnix > 0 {
+		expiresAt = time.Unix(expiresAtUnix, 0)
+	}
+
+	if store != nil && id != "" {
+		err := store.SaveStore(adaptor.StoreCache{
+			ID:        model.FileStoreID(id),
+			GroupID:   meta.Group.ID,
+			TokenID:   meta.Token.ID,
+			ChannelID: meta.Channel.ID,
+			Model:     meta.OriginModel,
+			Metadata:  string(responseBody),
+			ExpiresAt: expiresAt,
+		})
+		if err != nil {
+			log := common.GetLogger(c)
+			log.Errorf("save file store failed: %v", err)
+		}
+	}
+
+	c.Writer.Header().Set("Content-Type", "application/json")
+	c.Writer.Header().Set("Content-Length", strconv.Itoa(len(responseBody)))
+	_, _ = c.Writer.Write(responseBody)
+
+	return adaptor.DoResponseResult{
+		UpstreamID: id,
+	}, nil
+}
+
+func FileGetHandler(
+	_ *meta.Meta,
+	c *gin.Context,
+	resp *http.Response,
+) (adaptor.DoResponseResult, adaptor.Error) {
+	return fileProxyHandler(c, resp)
+}
+
+func FileContentHandler(
+	_ *meta.Meta,
+	c *gin.Context,
+	resp *http.Response,
+) (adaptor.DoResponseResult, adaptor.Error) {
+	return fileProxyHandler(c, resp)
+}
+
+// FileDeleteHandler expires the file store after the upstream file is deleted
+func FileDeleteHandler(
+	meta *meta.Meta,
+	store adaptor.Store,
+	c *gin.Context,
+	resp *http.Response,
+) (adaptor.DoResponseResult, adaptor.Error) {
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusNoContent {
+		return adaptor.DoResponseResult{}, ErrorHanlder(resp)
+	}
+
+	if store != nil && meta.FileID != "" {
+		err := store.SaveStore(adaptor.StoreCache{
+			ID:        model.FileStoreID(meta.FileID),
+			GroupID:   meta.Group.ID,
+			TokenID:   meta.Token.ID,
+			ChannelID: meta.Channel.ID,
+			Model:     meta.OriginModel,
+			ExpiresAt: time.Now(),
+		})
+		if err != nil {
+			log := common.GetLogger(c)
+			log.Errorf("expire file store failed: %v", err)
+		}
+	}
+
+	return fileProxyHandler(c, resp)
+}
+
+func fileProxyHandler(
+	c *gin.Context,
+	resp *http.Response,
+) (adaptor.DoResponseResult, adaptor.Error) {
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusNoContent {
+		return adaptor.DoResponseResult{}, ErrorHanlder(resp)
+	}
+
+	defer resp.Body.Close()
+
+	c.Writer.Header().Set("Content-Type", resp.Header.Get("Content-Type"))
+
+	if contentLength := resp.Header.Get("Content-Length"); contentLength != "" {
+		c.Writer.Header().Set("Content-Length", contentLength)
+	}
+
+	if contentDisposition := resp.Header.Get("Content-Disposition"); contentDisposition != "" {
+		c.Writer.Header().Set("Content-Disposition", contentDisposition)
+	}
+
+	c.Status(resp.StatusCode)
+	_, _ = io.Copy(c.Writer, resp.Body)
+
+	return adaptor.DoResponseResult{}, nil
+}
@@ -0,0 +1,336 @@
+package openai
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/bytedance/sonic"
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+	"github.com/labring/aiproxy/core/common"
+	"github.com/labring/aiproxy/core/common/config"
+	"github.com/labring/aiproxy/core/model"
+	"github.com/labring/aiproxy/core/relay/adaptor"
+	"github.com/labring/aiproxy/core/relay/meta"
+	relaymodel "github.com/labring/aiproxy/core/relay/model"
+	"github.com/labring/aiproxy/core/relay/utils"
+)
+
+const (
+	metaRealtimeConn     = "realtime_conn"
+	realtimeCloseTimeout = time.Second * 5
+	// ctxRealtimeBalanceCheck is the gin context key of the balance check of
+	// the realtime sessions
+	ctxRealtimeBalanceCheck = "realtime_balance_check"
+)
+
+var (
+	errRealtimeBalanceNotEnough = errors.New("group balance not enough")
+	errRealtimeMaxDuration      = errors.New("realtime session max duration reached")
+)
+
+// RealtimeBalanceCheck reports whether the balance of the group covers the
+// usage of the realtime session so far
+type RealtimeBalanceCheck func(usage model.Usage) bool
+
+// SetRealtimeBalanceCheck sets the balance check run on every response.done
+// event, the session is closed once it fails
+func SetRealtimeBalanceCheck(c *gin.Context, check RealtimeBalanceCheck) {
+	c.Set(ctxRealtimeBalanceCheck, check)
+}
+
+func getRealtimeBalanceCheck(c *gin.Context) RealtimeBalanceCheck {
+	check, _ := c.Value(ctxRealtimeBalanceCheck).(RealtimeBalanceCheck)
+	return check
+}
+
+// RealtimeDoRequest dials the upstream realtime websocket, the client connection is only
+// upgraded in RealtimeHandler after the upstream accepted the session, so that a failed
+// handshake can still be retried on another channel
+func RealtimeDoRequest(meta *meta.Meta, c *gin.Context, req *http.Request) (*http.Response, error) {
+	wsURL := *req.URL
+
+	switch wsURL.Scheme {
+	case "https":
+		wsURL.Scheme = "wss"
+	case "http":
+		wsURL.Scheme = "ws"
+	}
+
+	dialer, err := utils.LoadWebSocketDialer(meta.Channel.ProxyURL, meta.Channel.SkipTLSVerify)
+	if err != nil {
+		return nil, err
+	}
+
+	if c != nil && c.Request != nil {
+		dialer.Subprotocols = realtimeProtocols(websocket.Subprotocols(c.Request))
+	}
+
+	conn, resp, err := dialer.DialContext(req.Context(), wsURL.String(), req.Header)
+	if err != nil {
+		// the handshake response carries the upstream error
+		if errors.Is(err, websocket.ErrBadHandshake) && resp != nil {
+			return resp, nil
+		}
+
+		return nil, err
+	}
+
+	meta.Set(metaRealtimeConn, conn)
+
+	return resp, nil
+}
+
+// realtimeProtocols drops the aiproxy key from the client subprotocols
+func realtimeProtocols(protocols []string) []string {
+	result := make([]string, 0, len(protocols))
+	for _, protocol := range protocols {
+		if strings.HasPrefix(protocol, relaymodel.RealtimeAPIKeyProtocolPrefix) {
+			continue
+		}
+
+		result = append(result, protocol)
+	}
+
+	return result
+}
+
+// realtimeCheckOrigin allows the clients without an origin, the origin of the server and the
+// configured origins
+func realtimeCheckOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+
+	if slices.Contains(config.RealtimeAllowedOrigins, origin) {
+		return true
+	}
+
+	u, err := url.Parse(origin)
+	if err != nil {
+		return false
+	}
+
+	return strings.EqualFold(u.Host, r.Host)
+}
+
+// RealtimeHandler upgrades the client connection and proxies the messages in both directions,
+// the usage of every response.done event is summed and billed once the session is closed, the
+// session is closed early when the balance can't cover the usage or it reaches the max duration
+func RealtimeHandler(
+	meta *meta.Meta,
+	c *gin.Context,
+	resp *http.Response,
+) (adaptor.DoResponseResult, adaptor.Error) {
+	if resp.StatusCode != http.StatusSwitchingProtocols {
+		return adaptor.DoResponseResult{}, ErrorHanlder(resp)
+	}
+
+	upstream, ok := meta.MustGet(metaRealtimeConn).(*websocket.Conn)
+	if !ok {
+		panic(fmt.Sprintf("realtime conn type error: %T, %v", upstream, upstream))
+	}
+	defer upstream.Close()
+
+	protocols := realtimeProtocols(websocket.Subprotocols(c.Request))
+	if selected := upstream.Subprotocol(); selected != "" {
+		protocols = append([]string{selected}, protocols...)
+	}
+
+	upgrader := websocket.Upgrader{
+		Subprotocols: protocols,
+		CheckOrigin:  realtimeCheckOrigin,
+	}
+
+	client, err := upgrader.Upgrade(c.Writer, c.Request, nil)
+	if err != nil {
+		return adaptor.DoResponseResult{}, relaymodel.WrapperOpenAIError(
+			err,
+			"upgrade_websocket_failed",
+			http.StatusBadRequest,
+		)
+	}
+	defer client.Close()
+
+	recorder := &realtimeUsageRecorder{check: getRealtimeBalanceCheck(c)}
+
+	errCh := make(chan error, 2)
+
+	go func() {
+		errCh <- proxyRealtimeMessages(upstream, client, nil)
+	}()
+	go func() {
+		errCh <- proxyRealtimeMessages(client, upstream, recorder.record)
+	}()
+
+	var maxDuration <-chan time.Time
+	if config.RealtimeMaxDuration > 0 {
+		timer := time.NewTimer(config.RealtimeMaxDuration)
+		defer timer.Stop()
+
+		maxDuration = timer.C
+	}
+
+	pending := 2
+
+	select {
+	case err = <-errCh:
+		pending--
+	case <-maxDuration:
+		err = errRealtimeMaxDuration
+		deadline := time.Now().Add(realtimeCloseTimeout)
+		_ = client.WriteControl(websocket.CloseMessage, realtimeCloseMessage(err), deadline)
+		_ = upstream.WriteControl(websocket.CloseMessage, realtimeCloseMessage(err), deadline)
+	}
+
+	// closing both connections stops the other direction
+	_ = client.Close()
+	_ = upstream.Close()
+
+	for range pending {
+		<-errCh
+	}
+
+	log := common.GetLogger(c)
+	if isRealtimeNormalClosure(err) {
+		log.Debugf("realtime session closed: %v", err)
+	} else {
+		log.Warnf("realtime session closed: %v", err)
+	}
+
+	// the connection is hijacked, errors after the upgrade can't be replied to the client
+	return adaptor.DoResponseResult{
+		Usage:      recorder.usage,
+		UpstreamID: recorder.sessionID,
+	}, nil
+}
+
+// proxyRealtimeMessages copies the messages from src to dst until one of them is closed,
+// the close frame of src is forwarded to dst, an error of onTextMessage closes dst after the
+// message is forwarded
+func proxyRealtimeMessages(
+	dst, src *websocket.Conn,
+	onTextMessage func(data []byte) error,
+) error {
+	for {
+		messageType, data, err := src.ReadMessage()
+		if err != nil {
+			_ = dst.WriteControl(
+				websocket.CloseMessage,
+				realtimeCloseMessage(err),
+				time.Now().Add(realtimeCloseTimeout),
+			)
+
+			return err
+		}
+
+		var stopErr error
+		if messageType == websocket.TextMessage && onTextMessage != nil {
+			stopErr = onTextMessage(data)
+		}
+
+		if err := dst.WriteMessage(messageType, data); err != nil {
+			return err
+		}
+
+		if stopErr != nil {
+			_ = dst.WriteControl(
+				websocket.CloseMessage,
+				realtimeCloseMessage(stopErr),
+				time.Now().Add(realtimeCloseTimeout),
+			)
+
+			return stopErr
+		}
+	}
+}
+
+func realtimeCloseMessage(err error) []byte {
+	if errors.Is(err, errRealtimeBalanceNotEnough) || errors.Is(err, errRealtimeMaxDuration) {
+		return websocket.FormatCloseMessage(websocket.ClosePolicyViolation, err.Error())
+	}
+
+	closeErr, ok := errors.AsType[*websocket.CloseError](err)
+	if !ok {
+		return websocket.FormatCloseMessage(websocket.CloseGoingAway, "")
+	}
+
+	switch closeErr.Code {
+	// these codes are reserved and must not be sent in a close frame
+	case websocket.CloseNoStatusReceived,
+		websocket.CloseAbnormalClosure,
+		websocket.CloseTLSHandshake:
+		return websocket.FormatCloseMessage(websocket.CloseNormalClosure, "")
+	default:
+		return websocket.FormatCloseMessage(closeErr.Code, closeErr.Text)
+	}
+}
+
+func isRealtimeNormalClosure(err error) bool {
+	return websocket.IsCloseError(
+		err,
+		websocket.CloseNormalClosure,
+		websocket.CloseGoingAway,
+		websocket.CloseNoStatusReceived,
+	) || errors.Is(err, net.ErrClosed) ||
+		errors.Is(err, errRealtimeBalanceNotEnough) ||
+		errors.Is(err, errRealtimeMaxDuration)
+}
+
+// realtimeUsageRecorder sums the usage of the responses in a realtime session, it's only
+// used by the goroutine that reads the upstream messages
+type realtimeUsageRecorder struct {
+	sessionID string
+	usage     model.Usage
+	check     RealtimeBalanceCheck
+}
+
+// record sums the usage of the event, it returns an error when the balance can't cover the
+// usage of the session
+func (r *realtimeUsageRecorder) record(data []byte) error {
+	node, err := sonic.Get(data, "type")
+	if err != nil {
+		return nil
+	}
+
+	eventType, err := node.String()
+	if err != nil {
+		return nil
+	}
+
+	// only decode the events with usage, the audio delta events are large
+	switch eventType {
+	case relaymodel.RealtimeEventSessionCreated, relaymodel.RealtimeEventResponseDone:
+	default:
+		return nil
+	}
+
+	var event relaymodel.RealtimeServerEvent
+	if err := sonic.Unmarshal(data, &event); err != nil {
+		return nil
+	}
+
+	switch event.Type {
+	case relaymodel.RealtimeEventSessionCreated:
+		if event.Session != nil {
+			r.sessionID = event.Session.ID
+		}
+	case relaymodel.RealtimeEventResponseDone:
+		if event.Response != nil && event.Response.Usage != nil {
+			r.usage.Add(event.Response.Usage.ToModelUsage())
+		}
+
+		if r.check != nil && !r.check(r.usage) {
+			return errRealtimeBalanceNotEnough
+		}
+	}
+
+	return nil
+}
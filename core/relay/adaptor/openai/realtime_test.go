@@ -0,0 +1,348 @@
+//nolint:testpackage
+package openai
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+	coremodel "github.com/labring/aiproxy/core/model"
+	"github.com/labring/aiproxy/core/common/config"
+	"github.com/labring/aiproxy/core/relay/adaptor"
+	"github.com/labring/aiproxy/core/relay/meta"
+	"github.com/labring/aiproxy/core/relay/mode"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testRealtimeResponseDone = `{"type":"response.done","response":{"id":"resp_1","status":"completed","usage":{"total_tokens":150,"input_tokens":100,"output_tokens":50,"input_token_details":{"cached_tokens":20,"text_tokens":40,"audio_tokens":60},"output_token_details":{"text_tokens":10,"audio_tokens":40}}}}`
+
+type realtimeProxyResult struct {
+	result adaptor.DoResponseResult
+	err    error
+}
+
+// newRealtimeTestProxy serves the realtime sessions proxied to the upstream, setup prepares
+// the context of the session
+func newRealtimeTestProxy(
+	upstreamURL string,
+	setup func(c *gin.Context),
+) (*httptest.Server, chan realtimeProxyResult) {
+	resultCh := make(chan realtimeProxyResult, 1)
+
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		c, _ := gin.CreateTestContext(w)
+		c.Request = r
+
+		if setup != nil {
+			setup(c)
+		}
+
+		m := meta.NewMeta(
+			&coremodel.Channel{BaseURL: upstreamURL, Key: "sk-upstream"},
+			mode.Realtime,
+			"gpt-realtime",
+			coremodel.ModelConfig{},
+		)
+		a := &Adaptor{}
+
+		requestURL, err := a.GetRequestURL(m, nil, c)
+		if err != nil {
+			resultCh <- realtimeProxyResult{err: err}
+			return
+		}
+
+		req, err := http.NewRequestWithContext(
+			context.Background(),
+			requestURL.Method,
+			requestURL.URL,
+			nil,
+		)
+		if err != nil {
+			resultCh <- realtimeProxyResult{err: err}
+			return
+		}
+
+		if err := a.SetupRequestHeader(m, nil, c, req); err != nil {
+			resultCh <- realtimeProxyResult{err: err}
+			return
+		}
+
+		resp, err := a.DoRequest(m, nil, c, req)
+		if err != nil {
+			resultCh <- realtimeProxyResult{err: err}
+			return
+		}
+
+		result, relayErr := a.DoResponse(m, nil, c, resp)
+		if relayErr != nil {
+			resultCh <- realtimeProxyResult{err: relayErr}
+			return
+		}
+
+		resultCh <- realtimeProxyResult{result: result}
+	}))
+
+	return proxy, resultCh
+}
+
+func TestRealtimeProxy(t *testing.T) {
+	t.Parallel()
+
+	requestCh := make(chan *http.Request, 1)
+
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requestCh <- r.Clone(context.Background())
+
+		upgrader := websocket.Upgrader{Subprotocols: []string{"realtime"}}
+
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		_ = conn.WriteMessage(
+			websocket.TextMessage,
+			[]byte(`{"type":"session.created","session":{"id":"sess_1","model":"gpt-realtime"}}`),
+		)
+
+		for range 2 {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				return
+			}
+
+			_ = conn.WriteMessage(
+				websocket.TextMessage,
+				[]byte(`{"type":"response.output_audio.delta","delta":"AAAA"}`),
+			)
+			_ = conn.WriteMessage(websocket.TextMessage, []byte(testRealtimeResponseDone))
+		}
+
+		_ = conn.WriteMessage(
+			websocket.CloseMessage,
+			websocket.FormatCloseMessage(websocket.CloseNormalClosure, "bye"),
+		)
+		_, _, _ = conn.ReadMessage()
+	}))
+	defer upstream.Close()
+
+	proxy, resultCh := newRealtimeTestProxy(upstream.URL, nil)
+	defer proxy.Close()
+
+	dialer := websocket.Dialer{
+		Subprotocols: []string{"realtime", "openai-insecure-api-key.sk-aiproxy"},
+	}
+
+	client, _, err := dialer.Dial("ws"+strings.TrimPrefix(proxy.URL, "http"), nil)
+	require.NoError(t, err)
+
+	defer client.Close()
+
+	require.Equal(t, "realtime", client.Subprotocol())
+
+	_, data, err := client.ReadMessage()
+	require.NoError(t, err)
+	require.Contains(t, string(data), "session.created")
+
+	for range 2 {
+		require.NoError(t, client.WriteMessage(
+			websocket.TextMessage,
+			[]byte(`{"type":"response.create"}`),
+		))
+
+		_, data, err = client.ReadMessage()
+		require.NoError(t, err)
+		require.Contains(t, string(data), "response.output_audio.delta")
+
+		_, data, err = client.ReadMessage()
+		require.NoError(t, err)
+		require.JSONEq(t, testRealtimeResponseDone, string(data))
+	}
+
+	_, _, err = client.ReadMessage()
+	require.True(t, websocket.IsCloseError(err, websocket.CloseNormalClosure))
+
+	proxyResult := <-resultCh
+	require.NoError(t, proxyResult.err)
+	require.Equal(t, "sess_1", proxyResult.result.UpstreamID)
+
+	usage := proxyResult.result.Usage
+	require.EqualValues(t, 200, usage.InputTokens)
+	require.EqualValues(t, 100, usage.OutputTokens)
+	require.EqualValues(t, 300, usage.TotalTokens)
+	require.EqualValues(t, 40, usage.CachedTokens)
+	require.EqualValues(t, 120, usage.AudioInputTokens)
+	require.EqualValues(t, 80, usage.AudioOutputTokens)
+
+	upstreamRequest := <-requestCh
+	require.Equal(t, "/realtime", upstreamRequest.URL.Path)
+	require.Equal(t, "gpt-realtime", upstreamRequest.URL.Query().Get("model"))
+	require.Equal(t, "Bearer sk-upstream", upstreamRequest.Header.Get("Authorization"))
+	require.Equal(t, []string{"realtime"}, websocket.Subprotocols(upstreamRequest))
+}
+
+func TestRealtimeProxyHandshakeError(t *testing.T) {
+	t.Parallel()
+
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusUnauthorized)
+		_, _ = w.Write([]byte(`{"error":{"message":"invalid api key","type":"invalid_request_error"}}`))
+	}))
+	defer upstream.Close()
+
+	m := meta.NewMeta(
+		&coremodel.Channel{BaseURL: upstream.URL, Key: "sk-upstream"},
+		mode.Realtime,
+		"gpt-realtime",
+		coremodel.ModelConfig{},
+	)
+	a := &Adaptor{}
+
+	requestURL, err := a.GetRequestURL(m, nil, nil)
+	require.NoError(t, err)
+
+	req, err := http.NewRequestWithContext(
+		context.Background(),
+		requestURL.Method,
+		requestURL.URL,
+		nil,
+	)
+	require.NoError(t, err)
+
+	resp, err := a.DoRequest(m, nil, nil, req)
+	require.NoError(t, err)
+
+	defer resp.Body.Close()
+
+	_, relayErr := a.DoResponse(m, nil, nil, resp)
+	require.NotNil(t, relayErr)
+	require.Equal(t, http.StatusUnauthorized, relayErr.StatusCode())
+}
+
+// newRealtimeTestUpstream answers every client message with a response.done event
+func newRealtimeTestUpstream() *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		upgrader := websocket.Upgrader{}
+
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				return
+			}
+
+			_ = conn.WriteMessage(websocket.TextMessage, []byte(testRealtimeResponseDone))
+		}
+	}))
+}
+
+func dialRealtimeTestProxy(t *testing.T, proxy *httptest.Server) *websocket.Conn {
+	t.Helper()
+
+	client, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(proxy.URL, "http"), nil)
+	require.NoError(t, err)
+
+	t.Cleanup(func() {
+		_ = client.Close()
+	})
+
+	return client
+}
+
+func TestRealtimeBalanceCheck(t *testing.T) {
+	t.Parallel()
+
+	upstream := newRealtimeTestUpstream()
+	defer upstream.Close()
+
+	proxy, resultCh := newRealtimeTestProxy(upstream.URL, func(c *gin.Context) {
+		SetRealtimeBalanceCheck(c, func(usage coremodel.Usage) bool {
+			return usage.TotalTokens <= 150
+		})
+	})
+	defer proxy.Close()
+
+	client := dialRealtimeTestProxy(t, proxy)
+
+	for range 2 {
+		require.NoError(t, client.WriteMessage(
+			websocket.TextMessage,
+			[]byte(`{"type":"response.create"}`),
+		))
+
+		// the response is sent before the session is closed
+		_, data, err := client.ReadMessage()
+		require.NoError(t, err)
+		require.JSONEq(t, testRealtimeResponseDone, string(data))
+	}
+
+	_, _, err := client.ReadMessage()
+	require.True(t, websocket.IsCloseError(err, websocket.ClosePolicyViolation), err)
+
+	proxyResult := <-resultCh
+	require.NoError(t, proxyResult.err)
+	require.EqualValues(t, 300, proxyResult.result.Usage.TotalTokens)
+}
+
+//nolint:paralleltest
+func TestRealtimeMaxDuration(t *testing.T) {
+	maxDuration := config.RealtimeMaxDuration
+	config.RealtimeMaxDuration = 100 * time.Millisecond
+
+	t.Cleanup(func() {
+		config.RealtimeMaxDuration = maxDuration
+	})
+
+	upstream := newRealtimeTestUpstream()
+	defer upstream.Close()
+
+	proxy, resultCh := newRealtimeTestProxy(upstream.URL, nil)
+	defer proxy.Close()
+
+	client := dialRealtimeTestProxy(t, proxy)
+
+	_, _, err := client.ReadMessage()
+	require.True(t, websocket.IsCloseError(err, websocket.ClosePolicyViolation), err)
+
+	proxyResult := <-resultCh
+	require.NoError(t, proxyResult.err)
+}
+
+func TestRealtimeCheckOrigin(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name   string
+		origin string
+		want   bool
+	}{
+		{name: "no origin", want: true},
+		{name: "same origin", origin: "https://aiproxy.example.com", want: true},
+		{name: "other origin", origin: "https://evil.example.com", want: false},
+		{name: "invalid origin", origin: "://", want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			r := httptest.NewRequest(http.MethodGet, "https://aiproxy.example.com/v1/realtime", nil)
+			if tt.origin != "" {
+				r.Header.Set("Origin", tt.origin)
+			}
+
+			assert.Equal(t, tt.want, realtimeCheckOrigin(r))
+		})
+	}
+}
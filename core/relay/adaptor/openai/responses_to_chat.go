@@ -0,0 +1,981 @@
+package openai
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/bytedance/sonic"
+	"github.com/labring/aiproxy/core/common"
+	relaymodel "github.com/labring/aiproxy/core/relay/model"
+)
+
+const (
+	responseObject        = "response"
+	inputContentTypeImage = "input_image"
+	contentTypeRefusal    = "refusal"
+	summaryTypeText       = "summary_text"
+)
+
+// responsesInputItem is an input item of the Responses API before it is normalized,
+// the content of a message and the output of a function call may be plain strings
+type responsesInputItem struct {
+	ID        string `json:"id,omitempty"`
+	Type      string `json:"type,omitempty"`
+	Role      string `json:"role,omitempty"`
+	Content   any    `json:"content,omitempty"`
+	Name      string `json:"name,omitempty"`
+	Arguments string `json:"arguments,omitempty"`
+	CallID    string `json:"call_id,omitempty"`
+	Output    any    `json:"output,omitempty"`
+}
+
+// ParseResponsesInput normalizes the input of a Responses API request,
+// a string input is a single user message
+func ParseResponsesInput(input any) ([]relaymodel.InputItem, error) {
+	switch input := input.(type) {
+	case nil:
+		return nil, nil
+	case string:
+		return []relaymodel.InputItem{{
+			Type: relaymodel.InputItemTypeMessage,
+			Role: relaymodel.RoleUser,
+			Content: []relaymodel.InputContent{{
+				Type: relaymodel.InputContentTypeInputText,
+				Text: input,
+			}},
+		}}, nil
+	}
+
+	data, err := sonic.Marshal(input)
+	if err != nil {
+		return nil, err
+	}
+
+	var rawItems []responsesInputItem
+	if err := sonic.Unmarshal(data, &rawItems); err != nil {
+		return nil, fmt.Errorf("invalid input: %w", err)
+	}
+
+	items := make([]relaymodel.InputItem, 0, len(rawItems))
+	for _, raw := range rawItems {
+		item := relaymodel.InputItem{
+			ID:        raw.ID,
+			Type:      raw.Type,
+			Role:      raw.Role,
+			Name:      raw.Name,
+			Arguments: raw.Arguments,
+			CallID:    raw.CallID,
+		}
+
+		if item.Type == "" && item.Role != "" {
+			item.Type = relaymodel.InputItemTypeMessage
+		}
+
+		switch item.Type {
+		case relaymodel.InputItemTypeMessage:
+			item.Content, err = parseResponsesInputContent(item.Role, raw.Content)
+			if err != nil {
+				return nil, err
+			}
+		case relaymodel.InputItemTypeFunctionCallOutput:
+			item.Output, err = stringifyResponsesOutput(raw.Output)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		items = append(items, item)
+	}
+
+	return items, nil
+}
+
+func parseResponsesInputContent(role string, content any) ([]relaymodel.InputContent, error) {
+	switch content := content.(type) {
+	case nil:
+		return nil, nil
+	case string:
+		contentType := relaymodel.InputContentTypeInputText
+		if role == relaymodel.RoleAssistant {
+			contentType = relaymodel.InputContentTypeOutputText
+		}
+
+		return []relaymodel.InputContent{{Type: contentType, Text: content}}, nil
+	case []any:
+		data, err := sonic.Marshal(content)
+		if err != nil {
+			return nil, err
+		}
+
+		var parts []relaymodel.InputContent
+		if err := sonic.Unmarshal(data, &parts); err != nil {
+			return nil, fmt.Errorf("invalid message content: %w", err)
+		}
+
+		return parts, nil
+	default:
+		return nil, fmt.Errorf("invalid message content type: %T", content)
+	}
+}
+
+func stringifyResponsesOutput(output any) (string, error) {
+	switch output := output.(type) {
+	case nil:
+		return "", nil
+	case string:
+		return output, nil
+	default:
+		return sonic.MarshalString(output)
+	}
+}
+
+// ConvertInputItemsToMessages converts InputItem array to Message array for Chat Completions,
+// the function calls following an assistant message are merged into its tool calls
+func ConvertInputItemsToMessages(items []relaymodel.InputItem) ([]relaymodel.Message, error) {
+	messages := make([]relaymodel.Message, 0, len(items))
+
+	for _, item := range items {
+		switch item.Type {
+		case relaymodel.InputItemTypeMessage:
+			message, err := convertInputItemToMessage(item)
+			if err != nil {
+				return nil, err
+			}
+
+			messages = append(messages, message)
+		case relaymodel.InputItemTypeFunctionCall:
+			toolCall := relaymodel.ToolCall{
+				ID:   item.CallID,
+				Type: relaymodel.ToolChoiceTypeFunction,
+				Function: relaymodel.Function{
+					Name:      item.Name,
+					Arguments: item.Arguments,
+				},
+			}
+
+			if n := len(messages); n > 0 && messages[n-1].Role == relaymodel.RoleAssistant {
+				last := &messages[n-1]
+				toolCall.Index = len(last.ToolCalls)
+				last.ToolCalls = append(last.ToolCalls, toolCall)
+
+				continue
+			}
+
+			messages = append(messages, relaymodel.Message{
+				Role:      relaymodel.RoleAssistant,
+				ToolCalls: []relaymodel.ToolCall{toolCall},
+			})
+		case relaymodel.InputItemTypeFunctionCallOutput:
+			messages = append(messages, relaymodel.Message{
+				Role:       relaymodel.RoleTool,
+				ToolCallID: item.CallID,
+				Content:    item.Output,
+			})
+		case relaymodel.InputItemTypeReasoning:
+			// the reasoning of the previous turns is not replayed to chat models
+		default:
+			return nil, fmt.Errorf("input item type %s is not supported", item.Type)
+		}
+	}
+
+	return messages, nil
+}
+
+func convertInputItemToMessage(item relaymodel.InputItem) (relaymodel.Message, error) {
+	role := item.Role
+	if role == relaymodel.RoleDeveloper {
+		role = relaymodel.RoleSystem
+	}
+
+	message := relaymodel.Message{Role: role}
+	parts := make([]relaymodel.MessageContent, 0, len(item.Content))
+
+	for _, content := range item.Content {
+		switch content.Type {
+		case relaymodel.InputContentTypeInputText,
+			relaymodel.InputContentTypeOutputText,
+			relaymodel.ContentTypeText:
+			parts = append(parts, relaymodel.MessageContent{
+				Type:                  relaymodel.ContentTypeText,
+				Text:                  content.Text,
+				PromptCacheBreakpoint: content.PromptCacheBreakpoint,
+			})
+		case inputContentTypeImage:
+			if content.ImageURL == "" {
+				return relaymodel.Message{}, errors.New("input_image requires image_url")
+			}
+
+			parts = append(parts, relaymodel.MessageContent{
+				Type: relaymodel.ContentTypeImageURL,
+				ImageURL: &relaymodel.ImageURL{
+					URL:    content.ImageURL,
+					Detail: content.Detail,
+				},
+				PromptCacheBreakpoint: content.PromptCacheBreakpoint,
+			})
+		case contentTypeRefusal:
+			message.Refusal = content.Refusal
+		default:
+			return relaymodel.Message{}, fmt.Errorf(
+				"input content type %s is not supported",
+				content.Type,
+			)
+		}
+	}
+
+	switch {
+	case len(parts) == 1 &&
+		parts[0].Type == relaymodel.ContentTypeText &&
+		parts[0].PromptCacheBreakpoint == nil:
+		message.Content = parts[0].Text
+	case len(parts) > 0:
+		message.Content = parts
+	}
+
+	return message, nil
+}
+
+// ConvertOutputItemsToInputItems converts the output of a response to input items,
+// so the response can be replayed as the history of the next turn
+func ConvertOutputItemsToInputItems(outputs []relaymodel.OutputItem) []relaymodel.InputItem {
+	items := make([]relaymodel.InputItem, 0, len(outputs))
+
+	for _, output := range outputs {
+		switch output.Type {
+		case relaymodel.InputItemTypeMessage:
+			item := relaymodel.InputItem{
+				ID:   output.ID,
+				Type: relaymodel.InputItemTypeMessage,
+				Role: relaymodel.RoleAssistant,
+			}
+
+			for _, content := range output.Content {
+				switch content.Type {
+				case relaymodel.OutputContentTypeOutputText, relaymodel.OutputContentTypeText:
+					item.Content = append(item.Content, relaymodel.InputContent{
+						Type: relaymodel.InputContentTypeOutputText,
+						Text: content.Text,
+					})
+				case contentTypeRefusal:
+					item.Content = append(item.Content, relaymodel.InputContent{
+						Type:    contentTypeRefusal,
+						Refusal: content.Refusal,
+					})
+				}
+			}
+
+			items = append(items, item)
+		case relaymodel.InputItemTypeFunctionCall:
+			items = append(items, relaymodel.InputItem{
+				ID:        output.ID,
+				Type:      relaymodel.InputItemTypeFunctionCall,
+				CallID:    output.CallID,
+				Name:      output.Name,
+				Arguments: output.Arguments.String(),
+			})
+		}
+	}
+
+	return items
+}
+
+func convertResponseToolsToChatTools(tools []relaymodel.ResponseTool) ([]relaymodel.Tool, error) {
+	if len(tools) == 0 {
+		return nil, nil
+	}
+
+	chatTools := make([]relaymodel.Tool, 0, len(tools))
+	for _, tool := range tools {
+		if tool.Type != relaymodel.ToolChoiceTypeFunction {
+			return nil, fmt.Errorf("tool type %s is not supported by chat completions", tool.Type)
+		}
+
+		chatTools = append(chatTools, relaymodel.Tool{
+			Type: relaymodel.ToolChoiceTypeFunction,
+			Function: relaymodel.Function{
+				Name:        tool.Name,
+				Description: tool.Description,
+				Parameters:  tool.Parameters,
+				Strict:      tool.Strict,
+			},
+		})
+	}
+
+	return chatTools, nil
+}
+
+func convertResponseToolChoiceToChatToolChoice(toolChoice any) any {
+	switch toolChoice := toolChoice.(type) {
+	case string:
+		return toolChoice
+	case map[string]any:
+		toolType, _ := toolChoice["type"].(string)
+		name, _ := toolChoice["name"].(string)
+
+		if toolType != relaymodel.ToolChoiceTypeFunction || name == "" {
+			return nil
+		}
+
+		return map[string]any{
+			"type": relaymodel.ToolChoiceTypeFunction,
+			"function": map[string]any{
+				"name": name,
+			},
+		}
+	default:
+		return nil
+	}
+}
+
+func convertResponseTextToChatResponseFormat(
+	text *relaymodel.ResponseText,
+) *relaymodel.ResponseFormat {
+	if text == nil || text.Format.Type == "" || text.Format.Type == "text" {
+		return nil
+	}
+
+	responseFormat := &relaymodel.ResponseFormat{Type: text.Format.Type}
+	if text.Format.Type == "json_schema" {
+		responseFormat.JSONSchema = &relaymodel.JSONSchema{
+			Name:        text.Format.Name,
+			Schema:      text.Format.Schema,
+			Strict:      text.Format.Strict,
+			Description: text.Format.Description,
+		}
+	}
+
+	return responseFormat
+}
+
+// ConvertResponsesRequestToChatRequest converts a Responses API request to a ChatCompletion
+// request, items holds the whole conversation including the previous responses
+func ConvertResponsesRequestToChatRequest(
+	req *relaymodel.CreateResponseRequest,
+	items []relaymodel.InputItem,
+) (*relaymodel.GeneralOpenAIRequest, error) {
+	messages, err := ConvertInputItemsToMessages(items)
+	if err != nil {
+		return nil, err
+	}
+
+	if req.Instructions != nil && *req.Instructions != "" {
+		messages = append([]relaymodel.Message{{
+			Role:    relaymodel.RoleSystem,
+			Content: *req.Instructions,
+		}}, messages...)
+	}
+
+	tools, err := convertResponseToolsToChatTools(req.Tools)
+	if err != nil {
+		return nil, err
+	}
+
+	chatReq := &relaymodel.GeneralOpenAIRequest{
+		Model:              req.Model,
+		Messages:           messages,
+		Tools:              tools,
+		ToolChoice:         convertResponseToolChoiceToChatToolChoice(req.ToolChoice),
+		ParallelToolCalls:  req.ParallelToolCalls,
+		Stream:             req.Stream,
+		Temperature:        req.Temperature,
+		TopP:               req.TopP,
+		TopLogprobs:        req.TopLogprobs,
+		ResponseFormat:     convertResponseTextToChatResponseFormat(req.Text),
+		PromptCacheOptions: req.PromptCacheOptions,
+		Moderation:         req.Moderation,
+	}
+
+	if req.Stream {
+		chatReq.StreamOptions = &relaymodel.StreamOptions{IncludeUsage: true}
+	}
+
+	if req.MaxOutputTokens != nil {
+		chatReq.MaxTokens = *req.MaxOutputTokens
+	}
+
+	if req.Text != nil {
+		chatReq.Verbosity = req.Text.Verbosity
+	}
+
+	if req.Reasoning != nil && req.Reasoning.Effort != nil {
+		chatReq.ReasoningEffort = req.Reasoning.Effort
+	}
+
+	for _, include := range req.Include {
+		if include == "message.output_text.logprobs" {
+			logprobs := true
+			chatReq.Logprobs = &logprobs
+		}
+	}
+
+	if req.ServiceTier != nil {
+		chatReq.ServiceTier = *req.ServiceTier
+	}
+
+	if req.PromptCacheKey != nil {
+		chatReq.PromptCacheKey = *req.PromptCacheKey
+	}
+
+	if req.PromptCacheRetention != nil {
+		chatReq.PromptCacheRetention = *req.PromptCacheRetention
+	}
+
+	if req.SafetyIdentifier != nil {
+		chatReq.SafetyIdentifier = *req.SafetyIdentifier
+	}
+
+	if req.User != nil {
+		chatReq.User = *req.User
+	}
+
+	return chatReq, nil
+}
+
+// NewResponseFromRequest creates an in progress response echoing the parameters of the request,
+// as the Responses API does
+func NewResponseFromRequest(
+	id string,
+	createdAt int64,
+	modelName string,
+	req *relaymodel.CreateResponseRequest,
+) *relaymodel.Response {
+	response := &relaymodel.Response{
+		ID:                 id,
+		Object:             responseObject,
+		CreatedAt:          createdAt,
+		Status:             relaymodel.ResponseStatusInProgress,
+		Instructions:       req.Instructions,
+		MaxOutputTokens:    req.MaxOutputTokens,
+		Model:              modelName,
+		Output:             []relaymodel.OutputItem{},
+		ParallelToolCalls:  req.ParallelToolCalls == nil || *req.ParallelToolCalls,
+		PreviousResponseID: req.PreviousResponseID,
+		Store:              req.Store == nil || *req.Store,
+		Temperature:        1,
+		Text: relaymodel.ResponseText{
+			Format: relaymodel.ResponseTextFormat{Type: "text"},
+		},
+		ToolChoice:  relaymodel.ToolChoiceAuto,
+		Tools:       req.Tools,
+		TopP:        1,
+		Truncation:  "disabled",
+		ServiceTier: req.ServiceTier,
+		User:        req.User,
+		Metadata:    req.Metadata,
+	}
+
+	if req.Reasoning != nil {
+		response.Reasoning = *req.Reasoning
+	}
+
+	if req.Temperature != nil {
+		response.Temperature = *req.Temperature
+	}
+
+	if req.TopP != nil {
+		response.TopP = *req.TopP
+	}
+
+	if req.Text != nil {
+		response.Text = *req.Text
+	}
+
+	if req.ToolChoice != nil {
+		response.ToolChoice = req.ToolChoice
+	}
+
+	if response.Tools == nil {
+		response.Tools = []relaymodel.ResponseTool{}
+	}
+
+	if response.Metadata == nil {
+		response.Metadata = map[string]any{}
+	}
+
+	return response
+}
+
+func newOutputItemID(prefix string) string {
+	return prefix + "_" + common.ShortUUID()
+}
+
+func messageOutputContent(text, refusal string) []relaymodel.OutputContent {
+	content := make([]relaymodel.OutputContent, 0, 2)
+
+	if text != "" || refusal == "" {
+		content = append(content, relaymodel.OutputContent{
+			Type:        relaymodel.OutputContentTypeOutputText,
+			Text:        text,
+			Annotations: []any{},
+		})
+	}
+
+	if refusal != "" {
+		content = append(content, relaymodel.OutputContent{
+			Type:    contentTypeRefusal,
+			Refusal: refusal,
+		})
+	}
+
+	return content
+}
+
+// chatContentText joins the text parts of a chat message content,
+// unlike Message.StringContent the reasoning content is not included
+func chatContentText(content any) string {
+	switch content := content.(type) {
+	case string:
+		return content
+	case []any:
+		var builder strings.Builder
+
+		for _, part := range content {
+			partMap, ok := part.(map[string]any)
+			if !ok || partMap["type"] != relaymodel.ContentTypeText {
+				continue
+			}
+
+			text, _ := partMap["text"].(string)
+			builder.WriteString(text)
+		}
+
+		return builder.String()
+	default:
+		return ""
+	}
+}
+
+func applyChatFinishReason(response *relaymodel.Response, finishReason relaymodel.FinishReason) {
+	switch finishReason {
+	case relaymodel.FinishReasonLength:
+		response.Status = relaymodel.ResponseStatusIncomplete
+		response.IncompleteDetails = &relaymodel.IncompleteDetails{Reason: "max_output_tokens"}
+	case relaymodel.FinishReasonContentFilter:
+		response.Status = relaymodel.ResponseStatusIncomplete
+		response.IncompleteDetails = &relaymodel.IncompleteDetails{Reason: "content_filter"}
+	default:
+		response.Status = relaymodel.ResponseStatusCompleted
+	}
+}
+
+// ChatCompletionToStreamChunk converts a ChatCompletion response to a single stream chunk,
+// so the responses answered in one piece are converted by ChatToResponsesStream as well
+func ChatCompletionToStreamChunk(
+	chatResp *relaymodel.TextResponse,
+) *relaymodel.ChatCompletionsStreamResponse {
+	usage := chatResp.Usage
+	chunk := &relaymodel.ChatCompletionsStreamResponse{
+		ID:      chatResp.ID,
+		Object:  relaymodel.ChatCompletionChunkObject,
+		Model:   chatResp.Model,
+		Created: chatResp.Created,
+		Usage:   &usage,
+		Choices: make([]*relaymodel.ChatCompletionsStreamResponseChoice, 0, len(chatResp.Choices)),
+	}
+
+	for _, choice := range chatResp.Choices {
+		if choice == nil {
+			continue
+		}
+
+		delta := choice.Message
+
+		delta.ToolCalls = slices.Clone(delta.ToolCalls)
+		for i := range delta.ToolCalls {
+			delta.ToolCalls[i].Index = i
+		}
+
+		chunk.Choices = append(chunk.Choices, &relaymodel.ChatCompletionsStreamResponseChoice{
+			Index:        choice.Index,
+			Delta:        delta,
+			FinishReason: choice.FinishReason,
+		})
+	}
+
+	return chunk
+}
+
+type chatStreamOutput struct {
+	index int
+	item  relaymodel.OutputItem
+	text  strings.Builder
+	done  bool
+}
+
+// ChatToResponsesStream converts the chunks of a ChatCompletion stream to
+// the events of a Responses API stream
+type ChatToResponsesStream struct {
+	response     *relaymodel.Response
+	sequence     int
+	outputs      []*chatStreamOutput
+	reasoning    *chatStreamOutput
+	message      *chatStreamOutput
+	refusal      strings.Builder
+	toolCalls    map[int]*chatStreamOutput
+	toolCall     *chatStreamOutput
+	finishReason relaymodel.FinishReason
+	usage        *relaymodel.ChatUsage
+}
+
+func NewChatToResponsesStream(response *relaymodel.Response) *ChatToResponsesStream {
+	return &ChatToResponsesStream{
+		response:  response,
+		toolCalls: make(map[int]*chatStreamOutput),
+	}
+}
+
+// Response returns the response, it is complete after Finish
+func (s *ChatToResponsesStream) Response() *relaymodel.Response {
+	return s.response
+}
+
+func (s *ChatToResponsesStream) event(event relaymodel.ResponseStreamEvent) relaymodel.ResponseStreamEvent {
+	event.SequenceNumber = s.sequence
+	s.sequence++
+
+	return event
+}
+
+func (s *ChatToResponsesStream) responseSnapshot() *relaymodel.Response {
+	snapshot := *s.response
+	return &snapshot
+}
+
+// Start returns the events announcing the response
+func (s *ChatToResponsesStream) Start() []relaymodel.ResponseStreamEvent {
+	return []relaymodel.ResponseStreamEvent{
+		s.event(relaymodel.ResponseStreamEvent{
+			Type:     relaymodel.EventResponseCreated,
+			Response: s.responseSnapshot(),
+		}),
+		s.event(relaymodel.ResponseStreamEvent{
+			Type:     relaymodel.EventResponseInProgress,
+			Response: s.responseSnapshot(),
+		}),
+	}
+}
+
+func (s *ChatToResponsesStream) addOutput(item relaymodel.OutputItem) (*chatStreamOutput, relaymodel.ResponseStreamEvent) {
+	output := &chatStreamOutput{
+		index: len(s.outputs),
+		item:  item,
+	}
+	s.outputs = append(s.outputs, output)
+
+	added := item
+
+	return output, s.event(relaymodel.ResponseStreamEvent{
+		Type:        relaymodel.EventOutputItemAdded,
+		OutputIndex: new(output.index),
+		Item:        &added,
+	})
+}
+
+func (s *ChatToResponsesStream) outputDone(output *chatStreamOutput) relaymodel.ResponseStreamEvent {
+	output.done = true
+	done := output.item
+
+	return s.event(relaymodel.ResponseStreamEvent{
+		Type:        relaymodel.EventOutputItemDone,
+		OutputIndex: new(output.index),
+		Item:        &done,
+	})
+}
+
+func (s *ChatToResponsesStream) reasoningDelta(delta string) []relaymodel.ResponseStreamEvent {
+	var events []relaymodel.ResponseStreamEvent
+
+	if s.reasoning == nil {
+		s.reasoning, events = s.openReasoning()
+	}
+
+	s.reasoning.text.WriteString(delta)
+
+	return append(events, s.event(relaymodel.ResponseStreamEvent{
+		Type:        relaymodel.EventReasoningSummaryTextDelta,
+		ItemID:      s.reasoning.item.ID,
+		OutputIndex: new(s.reasoning.index),
+		Delta:       delta,
+	}))
+}
+
+func (s *ChatToResponsesStream) openReasoning() (*chatStreamOutput, []relaymodel.ResponseStreamEvent) {
+	output, added := s.addOutput(relaymodel.OutputItem{
+		ID:      newOutputItemID("rs"),
+		Type:    relaymodel.InputItemTypeReasoning,
+		Summary: []relaymodel.SummaryPart{},
+	})
+
+	return output, []relaymodel.ResponseStreamEvent{
+		added,
+		s.event(relaymodel.ResponseStreamEvent{
+			Type:        relaymodel.EventReasoningSummaryPartAdded,
+			ItemID:      output.item.ID,
+			OutputIndex: new(output.index),
+			Part:        &relaymodel.OutputContent{Type: summaryTypeText},
+		}),
+	}
+}
+
+func (s *ChatToResponsesStream) closeReasoning() []relaymodel.ResponseStreamEvent {
+	if s.reasoning == nil || s.reasoning.done {
+		return nil
+	}
+
+	output := s.reasoning
+	text := output.text.String()
+	output.item.Summary = []relaymodel.SummaryPart{{Type: summaryTypeText, Text: text}}
+
+	return []relaymodel.ResponseStreamEvent{
+		s.event(relaymodel.ResponseStreamEvent{
+			Type:        relaymodel.EventReasoningSummaryTextDone,
+			ItemID:      output.item.ID,
+			OutputIndex: new(output.index),
+			Text:        text,
+		}),
+		s.event(relaymodel.ResponseStreamEvent{
+			Type:        relaymodel.EventReasoningSummaryPartDone,
+			ItemID:      output.item.ID,
+			OutputIndex: new(output.index),
+			Part:        &relaymodel.OutputContent{Type: summaryTypeText, Text: text},
+		}),
+		s.outputDone(output),
+	}
+}
+
+func (s *ChatToResponsesStream) textDelta(delta string) []relaymodel.ResponseStreamEvent {
+	events := s.closeReasoning()
+
+	if s.message == nil {
+		output, added := s.addOutput(relaymodel.OutputItem{
+			ID:      newOutputItemID("msg"),
+			Type:    relaymodel.InputItemTypeMessage,
+			Status:  relaymodel.ResponseStatusInProgress,
+			Role:    relaymodel.RoleAssistant,
+			Content: []relaymodel.OutputContent{},
+		})
+		s.message = output
+
+		events = append(events,
+			added,
+			s.event(relaymodel.ResponseStreamEvent{
+				Type:         relaymodel.EventContentPartAdded,
+				ItemID:       output.item.ID,
+				OutputIndex:  new(output.index),
+				ContentIndex: new(0),
+				Part: &relaymodel.OutputContent{
+					Type:        relaymodel.OutputContentTypeOutputText,
+					Annotations: []any{},
+				},
+			}),
+		)
+	}
+
+	if delta == "" {
+		return events
+	}
+
+	s.message.text.WriteString(delta)
+
+	return append(events, s.event(relaymodel.ResponseStreamEvent{
+		Type:         relaymodel.EventOutputTextDelta,
+		ItemID:       s.message.item.ID,
+		OutputIndex:  new(s.message.index),
+		ContentIndex: new(0),
+		Delta:        delta,
+	}))
+}
+
+func (s *ChatToResponsesStream) closeMessage() []relaymodel.ResponseStreamEvent {
+	if s.message == nil || s.message.done {
+		return nil
+	}
+
+	output := s.message
+	text := output.text.String()
+	output.item.Status = relaymodel.ResponseStatusCompleted
+	output.item.Content = messageOutputContent(text, s.refusal.String())
+
+	return []relaymodel.ResponseStreamEvent{
+		s.event(relaymodel.ResponseStreamEvent{
+			Type:         relaymodel.EventOutputTextDone,
+			ItemID:       output.item.ID,
+			OutputIndex:  new(output.index),
+			ContentIndex: new(0),
+			Text:         text,
+		}),
+		s.event(relaymodel.ResponseStreamEvent{
+			Type:         relaymodel.EventContentPartDone,
+			ItemID:       output.item.ID,
+			OutputIndex:  new(output.index),
+			ContentIndex: new(0),
+			Part: &relaymodel.OutputContent{
+				Type:        relaymodel.OutputContentTypeOutputText,
+				Text:        text,
+				Annotations: []any{},
+			},
+		}),
+		s.outputDone(output),
+	}
+}
+
+func (s *ChatToResponsesStream) toolCallDelta(toolCall relaymodel.ToolCall) []relaymodel.ResponseStreamEvent {
+	var events []relaymodel.ResponseStreamEvent
+
+	output, ok := s.toolCalls[toolCall.Index]
+	if !ok {
+		events = append(events, s.closeReasoning()...)
+		events = append(events, s.closeMessage()...)
+		events = append(events, s.closeToolCall()...)
+
+		var added relaymodel.ResponseStreamEvent
+
+		output, added = s.addOutput(relaymodel.OutputItem{
+			ID:     newOutputItemID("fc"),
+			Type:   relaymodel.InputItemTypeFunctionCall,
+			Status: relaymodel.ResponseStatusInProgress,
+			CallID: toolCall.ID,
+			Name:   toolCall.Function.Name,
+		})
+		s.toolCalls[toolCall.Index] = output
+		s.toolCall = output
+
+		events = append(events, added)
+	}
+
+	if output.item.CallID == "" {
+		output.item.CallID = toolCall.ID
+	}
+
+	if output.item.Name == "" {
+		output.item.Name = toolCall.Function.Name
+	}
+
+	if toolCall.Function.Arguments == "" {
+		return events
+	}
+
+	output.text.WriteString(toolCall.Function.Arguments)
+
+	return append(events, s.event(relaymodel.ResponseStreamEvent{
+		Type:        relaymodel.EventFunctionCallArgumentsDelta,
+		ItemID:      output.item.ID,
+		OutputIndex: new(output.index),
+		Delta:       toolCall.Function.Arguments,
+	}))
+}
+
+func (s *ChatToResponsesStream) closeToolCall() []relaymodel.ResponseStreamEvent {
+	if s.toolCall == nil || s.toolCall.done {
+		return nil
+	}
+
+	output := s.toolCall
+	output.item.Status = relaymodel.ResponseStatusCompleted
+	output.item.Arguments = relaymodel.ResponseArguments(output.text.String())
+
+	return []relaymodel.ResponseStreamEvent{
+		s.event(relaymodel.ResponseStreamEvent{
+			Type:        relaymodel.EventFunctionCallArgumentsDone,
+			ItemID:      output.item.ID,
+			OutputIndex: new(output.index),
+			Arguments:   output.item.Arguments,
+		}),
+		s.outputDone(output),
+	}
+}
+
+// Chunk converts a ChatCompletion stream chunk to the Responses API events
+func (s *ChatToResponsesStream) Chunk(
+	chunk *relaymodel.ChatCompletionsStreamResponse,
+) []relaymodel.ResponseStreamEvent {
+	if chunk.Usage != nil {
+		s.usage = chunk.Usage
+	}
+
+	var events []relaymodel.ResponseStreamEvent
+
+	for _, choice := range chunk.Choices {
+		if choice == nil || choice.Index != 0 {
+			continue
+		}
+
+		if choice.Delta.ReasoningContent != "" {
+			events = append(events, s.reasoningDelta(choice.Delta.ReasoningContent)...)
+		}
+
+		if text := chatContentText(choice.Delta.Content); text != "" {
+			events = append(events, s.textDelta(text)...)
+		}
+
+		if choice.Delta.Refusal != "" {
+			events = append(events, s.textDelta("")...)
+			s.refusal.WriteString(choice.Delta.Refusal)
+		}
+
+		for _, toolCall := range choice.Delta.ToolCalls {
+			events = append(events, s.toolCallDelta(toolCall)...)
+		}
+
+		if choice.FinishReason != "" {
+			s.finishReason = choice.FinishReason
+		}
+	}
+
+	return events
+}
+
+// Finish closes the pending output items and returns the terminal event of the response
+func (s *ChatToResponsesStream) Finish() []relaymodel.ResponseStreamEvent {
+	events := s.closeReasoning()
+	events = append(events, s.closeMessage()...)
+	events = append(events, s.closeToolCall()...)
+
+	for _, output := range s.outputs {
+		if !output.done && output.item.Type == relaymodel.InputItemTypeFunctionCall {
+			s.toolCall = output
+			events = append(events, s.closeToolCall()...)
+		}
+	}
+
+	output := make([]relaymodel.OutputItem, 0, len(s.outputs))
+	for _, o := range s.outputs {
+		output = append(output, o.item)
+	}
+
+	s.response.Output = output
+	applyChatFinishReason(s.response, s.finishReason)
+
+	if s.usage != nil {
+		usage := s.usage.ToResponseUsage()
+		s.response.Usage = &usage
+	}
+
+	eventType := relaymodel.EventResponseCompleted
+	if s.response.Status == relaymodel.ResponseStatusIncomplete {
+		eventType = relaymodel.EventResponseIncomplete
+	}
+
+	return append(events, s.event(relaymodel.ResponseStreamEvent{
+		Type:     eventType,
+		Response: s.responseSnapshot(),
+	}))
+}
+
+// Fail returns the event failing the response after the stream is started
+func (s *ChatToResponsesStream) Fail(code, message string) []relaymodel.ResponseStreamEvent {
+	s.response.Status = relaymodel.ResponseStatusFailed
+	s.response.Error = &relaymodel.ResponseError{
+		Code:    code,
+		Message: message,
+	}
+
+	return []relaymodel.ResponseStreamEvent{
+		s.event(relaymodel.ResponseStreamEvent{
+			Type:     relaymodel.EventResponseFailed,
+			Response: s.responseSnapshot(),
+		}),
+	}
+}
@@ -0,0 +1,277 @@
+package openai_test
+
+import (
+	"testing"
+
+	"github.com/labring/aiproxy/core/relay/adaptor/openai"
+	relaymodel "github.com/labring/aiproxy/core/relay/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseResponsesInput(t *testing.T) {
+	items, err := openai.ParseResponsesInput("hello")
+	require.NoError(t, err)
+	require.Len(t, items, 1)
+	assert.Equal(t, relaymodel.InputItemTypeMessage, items[0].Type)
+	assert.Equal(t, relaymodel.RoleUser, items[0].Role)
+	assert.Equal(t, "hello", items[0].Content[0].Text)
+
+	items, err = openai.ParseResponsesInput([]any{
+		map[string]any{"role": "assistant", "content": "earlier answer"},
+		map[string]any{
+			"type":    "function_call_output",
+			"call_id": "call_1",
+			"output":  []any{map[string]any{"type": "input_text", "text": "sunny"}},
+		},
+		map[string]any{
+			"type": "message",
+			"role": "user",
+			"content": []any{
+				map[string]any{"type": "input_text", "text": "look"},
+				map[string]any{"type": "input_image", "image_url": "https://example.com/a.png"},
+			},
+		},
+	})
+	require.NoError(t, err)
+	require.Len(t, items, 3)
+
+	assert.Equal(t, relaymodel.InputItemTypeMessage, items[0].Type)
+	assert.Equal(t, relaymodel.InputContentTypeOutputText, items[0].Content[0].Type)
+	assert.JSONEq(t, `[{"type":"input_text","text":"sunny"}]`, items[1].Output)
+	assert.Equal(t, "https://example.com/a.png", items[2].Content[1].ImageURL)
+
+	_, err = openai.ParseResponsesInput(42)
+	require.Error(t, err)
+}
+
+func TestConvertResponsesRequestToChatRequest(t *testing.T) {
+	instructions := "be brief"
+	maxOutputTokens := 64
+	effort := "low"
+
+	req := &relaymodel.CreateResponseRequest{
+		Model:           "claude-sonnet-4-5",
+		Instructions:    &instructions,
+		MaxOutputTokens: &maxOutputTokens,
+		Stream:          true,
+		Reasoning:       &relaymodel.ResponseReasoning{Effort: &effort},
+		Tools: []relaymodel.ResponseTool{{
+			Type:       "function",
+			Name:       "get_weather",
+			Parameters: map[string]any{"type": "object"},
+		}},
+		ToolChoice: map[string]any{"type": "function", "name": "get_weather"},
+		Text: &relaymodel.ResponseText{
+			Format: relaymodel.ResponseTextFormat{
+				Type:   "json_schema",
+				Name:   "weather",
+				Schema: map[string]any{"type": "object"},
+			},
+		},
+	}
+
+	items := []relaymodel.InputItem{
+		{
+			Type: relaymodel.InputItemTypeMessage,
+			Role: relaymodel.RoleDeveloper,
+			Content: []relaymodel.InputContent{
+				{Type: relaymodel.InputContentTypeInputText, Text: "use celsius"},
+			},
+		},
+		{
+			Type: relaymodel.InputItemTypeMessage,
+			Role: relaymodel.RoleUser,
+			Content: []relaymodel.InputContent{
+				{Type: relaymodel.InputContentTypeInputText, Text: "weather?"},
+			},
+		},
+		{Type: relaymodel.InputItemTypeReasoning},
+		{
+			Type: relaymodel.InputItemTypeMessage,
+			Role: relaymodel.RoleAssistant,
+			Content: []relaymodel.InputContent{
+				{Type: relaymodel.InputContentTypeOutputText, Text: "checking"},
+			},
+		},
+		{
+			Type:      relaymodel.InputItemTypeFunctionCall,
+			CallID:    "call_1",
+			Name:      "get_weather",
+			Arguments: `{"city":"Paris"}`,
+		},
+		{
+			Type:      relaymodel.InputItemTypeFunctionCall,
+			CallID:    "call_2",
+			Name:      "get_weather",
+			Arguments: `{"city":"Rome"}`,
+		},
+		{Type: relaymodel.InputItemTypeFunctionCallOutput, CallID: "call_1", Output: "sunny"},
+	}
+
+	chatReq, err := openai.ConvertResponsesRequestToChatRequest(req, items)
+	require.NoError(t, err)
+
+	require.Len(t, chatReq.Messages, 5)
+	assert.Equal(t, relaymodel.RoleSystem, chatReq.Messages[0].Role)
+	assert.Equal(t, "be brief", chatReq.Messages[0].Content)
+	assert.Equal(t, relaymodel.RoleSystem, chatReq.Messages[1].Role)
+	assert.Equal(t, "use celsius", chatReq.Messages[1].Content)
+	assert.Equal(t, "weather?", chatReq.Messages[2].Content)
+
+	assistant := chatReq.Messages[3]
+	assert.Equal(t, "checking", assistant.Content)
+	require.Len(t, assistant.ToolCalls, 2)
+	assert.Equal(t, "call_2", assistant.ToolCalls[1].ID)
+	assert.Equal(t, 1, assistant.ToolCalls[1].Index)
+
+	assert.Equal(t, relaymodel.RoleTool, chatReq.Messages[4].Role)
+	assert.Equal(t, "call_1", chatReq.Messages[4].ToolCallID)
+
+	assert.Equal(t, 64, chatReq.MaxTokens)
+	require.NotNil(t, chatReq.StreamOptions)
+	assert.True(t, chatReq.StreamOptions.IncludeUsage)
+	assert.Equal(t, "low", *chatReq.ReasoningEffort)
+	require.Len(t, chatReq.Tools, 1)
+	assert.Equal(t, "get_weather", chatReq.Tools[0].Function.Name)
+	assert.Equal(t, map[string]any{
+		"type":     "function",
+		"function": map[string]any{"name": "get_weather"},
+	}, chatReq.ToolChoice)
+	require.NotNil(t, chatReq.ResponseFormat)
+	assert.Equal(t, "weather", chatReq.ResponseFormat.JSONSchema.Name)
+
+	req.Tools = []relaymodel.ResponseTool{{Type: "web_search"}}
+	_, err = openai.ConvertResponsesRequestToChatRequest(req, items)
+	require.Error(t, err)
+}
+
+func eventTypes(events []relaymodel.ResponseStreamEvent) []string {
+	types := make([]string, 0, len(events))
+	for _, event := range events {
+		types = append(types, event.Type)
+	}
+
+	return types
+}
+
+func TestChatToResponsesStream(t *testing.T) {
+	response := openai.NewResponseFromRequest(
+		"resp_1",
+		1,
+		"claude-sonnet-4-5",
+		&relaymodel.CreateResponseRequest{},
+	)
+	stream := openai.NewChatToResponsesStream(response)
+
+	events := stream.Start()
+	events = append(events, stream.Chunk(&relaymodel.ChatCompletionsStreamResponse{
+		Choices: []*relaymodel.ChatCompletionsStreamResponseChoice{{
+			Delta: relaymodel.Message{ReasoningContent: "thinking"},
+		}},
+	})...)
+	events = append(events, stream.Chunk(&relaymodel.ChatCompletionsStreamResponse{
+		Choices: []*relaymodel.ChatCompletionsStreamResponseChoice{{
+			Delta: relaymodel.Message{Content: "Hel"},
+		}},
+	})...)
+	events = append(events, stream.Chunk(&relaymodel.ChatCompletionsStreamResponse{
+		Choices: []*relaymodel.ChatCompletionsStreamResponseChoice{{
+			Delta: relaymodel.Message{Content: "lo"},
+		}},
+	})...)
+	events = append(events, stream.Chunk(&relaymodel.ChatCompletionsStreamResponse{
+		Choices: []*relaymodel.ChatCompletionsStreamResponseChoice{{
+			Delta: relaymodel.Message{ToolCalls: []relaymodel.ToolCall{{
+				ID:       "call_1",
+				Function: relaymodel.Function{Name: "get_weather", Arguments: `{"city":`},
+			}}},
+		}},
+	})...)
+	events = append(events, stream.Chunk(&relaymodel.ChatCompletionsStreamResponse{
+		Choices: []*relaymodel.ChatCompletionsStreamResponseChoice{{
+			Delta: relaymodel.Message{ToolCalls: []relaymodel.ToolCall{{
+				Function: relaymodel.Function{Arguments: `"Paris"}`},
+			}}},
+			FinishReason: relaymodel.FinishReasonLength,
+		}},
+	})...)
+	events = append(events, stream.Chunk(&relaymodel.ChatCompletionsStreamResponse{
+		Usage: &relaymodel.ChatUsage{PromptTokens: 10, CompletionTokens: 5, TotalTokens: 15},
+	})...)
+	events = append(events, stream.Finish()...)
+
+	assert.Equal(t, []string{
+		relaymodel.EventResponseCreated,
+		relaymodel.EventResponseInProgress,
+		relaymodel.EventOutputItemAdded,
+		relaymodel.EventReasoningSummaryPartAdded,
+		relaymodel.EventReasoningSummaryTextDelta,
+		relaymodel.EventReasoningSummaryTextDone,
+		relaymodel.EventReasoningSummaryPartDone,
+		relaymodel.EventOutputItemDone,
+		relaymodel.EventOutputItemAdded,
+		relaymodel.EventContentPartAdded,
+		relaymodel.EventOutputTextDelta,
+		relaymodel.EventOutputTextDelta,
+		relaymodel.EventOutputTextDone,
+		relaymodel.EventContentPartDone,
+		relaymodel.EventOutputItemDone,
+		relaymodel.EventOutputItemAdded,
+		relaymodel.EventFunctionCallArgumentsDelta,
+		relaymodel.EventFunctionCallArgumentsDelta,
+		relaymodel.EventFunctionCallArgumentsDone,
+		relaymodel.EventOutputItemDone,
+		relaymodel.EventResponseIncomplete,
+	}, eventTypes(events))
+
+	for i, event := range events {
+		assert.Equal(t, i, event.SequenceNumber)
+	}
+
+	final := stream.Response()
+	assert.Equal(t, relaymodel.ResponseStatusIncomplete, final.Status)
+	assert.Equal(t, "max_output_tokens", final.IncompleteDetails.Reason)
+	require.Len(t, final.Output, 3)
+	assert.Equal(t, "Hello", final.Output[1].Content[0].Text)
+	assert.Equal(t, `{"city":"Paris"}`, final.Output[2].Arguments.String())
+	assert.Equal(t, "call_1", final.Output[2].CallID)
+	require.NotNil(t, final.Usage)
+	assert.Equal(t, int64(15), final.Usage.TotalTokens)
+
+	items := openai.ConvertOutputItemsToInputItems(final.Output)
+	require.Len(t, items, 2)
+	assert.Equal(t, relaymodel.RoleAssistant, items[0].Role)
+	assert.Equal(t, relaymodel.InputItemTypeFunctionCall, items[1].Type)
+}
+
+func TestChatCompletionToStreamChunk(t *testing.T) {
+	chunk := openai.ChatCompletionToStreamChunk(&relaymodel.TextResponse{
+		Choices: []*relaymodel.TextResponseChoice{{
+			Message: relaymodel.Message{
+				Content: "done",
+				ToolCalls: []relaymodel.ToolCall{
+					{ID: "call_1", Function: relaymodel.Function{Name: "a"}},
+					{ID: "call_2", Function: relaymodel.Function{Name: "b"}},
+				},
+			},
+			FinishReason: relaymodel.FinishReasonToolCalls,
+		}},
+		Usage: relaymodel.ChatUsage{TotalTokens: 3},
+	})
+
+	stream := openai.NewChatToResponsesStream(openai.NewResponseFromRequest(
+		"resp_2",
+		1,
+		"gemini-2.5-pro",
+		&relaymodel.CreateResponseRequest{},
+	))
+	stream.Chunk(chunk)
+	stream.Finish()
+
+	final := stream.Response()
+	assert.Equal(t, relaymodel.ResponseStatusCompleted, final.Status)
+	require.Len(t, final.Output, 3)
+	assert.Equal(t, "call_2", final.Output[2].CallID)
+	assert.Equal(t, int64(3), final.Usage.TotalTokens)
+}
@@ -42,6 +42,11 @@ func (a *Adaptor) SupportMode(mt *meta.Meta) bool {
 		return gemini.IsImageMetaForAdaptor(mt)
 	}
 
+	// only the claude models can count tokens through rawPredict
+	if m == mode.AnthropicCountTokens {
+		return strings.Contains(strings.ToLower(resolveFeatureModel(mt)), "claude")
+	}
+
 	return m == mode.ChatCompletions ||
 		m == mode.Anthropic ||
 		m == mode.Gemini ||
@@ -177,7 +182,13 @@ func (a *Adaptor) GetRequestURL(
 
 	suffix := vertexRequestSuffix(meta, c, featureModel)
 
-	return a.getModelActionRequestURL(meta, config, publisher, suffix), nil
+	modelName := meta.ActualModel
+	if meta.Mode == mode.AnthropicCountTokens {
+		// https://cloud.google.com/vertex-ai/generative-ai/docs/partner-models/claude/count-tokens
+		modelName = "count-tokens"
+	}
+
+	return a.getModelActionRequestURL(meta, config, publisher, modelName, suffix), nil
 }
 
 func (a *Adaptor) getOperationRequestURL(
@@ -290,6 +301,7 @@ func (a *Adaptor) getModelActionRequestURL(
 	meta *meta.Meta,
 	config Config,
 	publisher string,
+	modelName string,
 	suffix string,
 ) adaptor.RequestURL {
 	if meta.Channel.BaseURL != "" {
@@ -300,7 +312,7 @@ func (a *Adaptor) getModelActionRequestURL(
 					"%s/v1/publishers/%s/models/%s:%s",
 					meta.Channel.BaseURL,
 					publisher,
-					meta.ActualModel,
+					modelName,
 					suffix,
 				),
 			}
@@ -314,7 +326,7 @@ func (a *Adaptor) getModelActionRequestURL(
 				config.ProjectID,
 				config.Region,
 				publisher,
-				meta.ActualModel,
+				modelName,
 				suffix,
 			),
 		}
@@ -334,7 +346,7 @@ func (a *Adaptor) getModelActionRequestURL(
 				"https://%s/v1/publishers/%s/models/%s:%s",
 				requestDoamin,
 				publisher,
-				meta.ActualModel,
+				modelName,
 				suffix,
 			),
 		}
@@ -348,7 +360,7 @@ func (a *Adaptor) getModelActionRequestURL(
 			config.ProjectID,
 			config.Region,
 			publisher,
-			meta.ActualModel,
+			modelName,
 			suffix,
 		),
 	}
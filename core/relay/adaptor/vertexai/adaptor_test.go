@@ -97,6 +97,32 @@ func TestGetRequestURL_UsesOriginModelNameForRouting(t *testing.T) {
 	})
 }
 
+func TestAnthropicCountTokensUsesCountTokensModel(t *testing.T) {
+	adaptor := &vertexai.Adaptor{}
+
+	m := meta.NewMeta(
+		nil,
+		mode.AnthropicCountTokens,
+		"claude-sonnet-4-5@20250929",
+		coremodel.ModelConfig{},
+	)
+	m.Channel.Key = "us-east5|project-1|apikey"
+
+	require.True(t, adaptor.SupportMode(m))
+
+	reqURL, err := adaptor.GetRequestURL(m, nil, nil)
+	require.NoError(t, err)
+	assert.Equal(t, http.MethodPost, reqURL.Method)
+	assert.Contains(
+		t,
+		reqURL.URL,
+		"/projects/project-1/locations/us-east5/publishers/anthropic/models/count-tokens:rawPredict",
+	)
+
+	gm := meta.NewMeta(nil, mode.AnthropicCountTokens, "gemini-2.5-pro", coremodel.ModelConfig{})
+	assert.False(t, adaptor.SupportMode(gm))
+}
+
 func TestGetRequestURLGeminiVideoUsesPredictLongRunning(t *testing.T) {
 	adaptor := &vertexai.Adaptor{}
 	m := meta.NewMeta(nil, mode.GeminiVideo, "veo-3.1-generate-preview", coremodel.ModelConfig{})
@@ -42,6 +42,8 @@ func (a *Adaptor) ConvertRequest(
 		data, err = handleChatCompletionsRequest(meta, request)
 	case mode.Anthropic:
 		data, err = handleAnthropicRequest(meta, request)
+	case mode.AnthropicCountTokens:
+		data, err = handleCountTokensRequest(meta, request)
 	case mode.Gemini:
 		data, err = handleGeminiRequest(meta, request)
 	default:
@@ -136,6 +138,26 @@ func handleAnthropicRequest(meta *meta.Meta, request *http.Request) ([]byte, err
 	})
 }
 
+// handleCountTokensRequest keeps the model in the body, the count-tokens endpoint is shared
+// by all the claude models
+func handleCountTokensRequest(meta *meta.Meta, request *http.Request) ([]byte, error) {
+	return anthropic.ConvertRequestToBytes(meta, request, func(node *ast.Node) error {
+		_, _ = node.Unset("context_management")
+		anthropic.RemoveToolsExamples(node)
+		anthropic.RemoveToolsCustomDeferLoading(node)
+
+		if err := anthropic.RemoveCountTokensUnsupportedFields(node); err != nil {
+			return err
+		}
+
+		if _, err := node.Set("anthropic_version", ast.NewString(anthropicVersion)); err != nil {
+			return err
+		}
+
+		return nil
+	})
+}
+
 func handleGeminiRequest(meta *meta.Meta, request *http.Request) ([]byte, error) {
 	// Convert Gemini format to Claude format
 	claudeReq, err := anthropic.ConvertGeminiRequestToStruct(meta, request)
@@ -171,6 +193,8 @@ func (a *Adaptor) DoResponse(
 			return anthropic.StreamHandler(meta, c, resp)
 		}
 		return anthropic.Handler(meta, c, resp)
+	case mode.AnthropicCountTokens:
+		return anthropic.CountTokensHandler(meta, c, resp)
 	case mode.Gemini:
 		if utils.IsStreamResponse(resp) {
 			return anthropic.GeminiStreamHandler(meta, c, resp)
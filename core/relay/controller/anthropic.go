@@ -1,12 +1,40 @@
 package controller
 
 import (
+	"net/http"
+
 	"github.com/gin-gonic/gin"
 	"github.com/labring/aiproxy/core/model"
 	"github.com/labring/aiproxy/core/relay/adaptor/openai"
+	"github.com/labring/aiproxy/core/relay/meta"
+	relaymodel "github.com/labring/aiproxy/core/relay/model"
 	"github.com/labring/aiproxy/core/relay/utils"
 )
 
+// CountAnthropicRequestTokens estimates the input tokens of a count_tokens request,
+// the system prompt is counted as a system message and the tool definitions as text
+func CountAnthropicRequestTokens(req *http.Request) (int64, error) {
+	textRequest, err := utils.UnmarshalAnthropicMessageRequest(req)
+	if err != nil {
+		return 0, err
+	}
+
+	messages := textRequest.Messages
+	if textRequest.System != nil {
+		messages = append([]relaymodel.Message{{
+			Role:    relaymodel.RoleSystem,
+			Content: textRequest.System,
+		}}, messages...)
+	}
+
+	inputTokens := openai.CountTokenMessages(messages, textRequest.Model, false)
+	for _, tool := range textRequest.Tools {
+		inputTokens += openai.CountTokenText(string(tool), textRequest.Model)
+	}
+
+	return inputTokens, nil
+}
+
 func GetAnthropicRequestUsage(c *gin.Context, _ model.ModelConfig) (RequestUsage, error) {
 	textRequest, err := utils.UnmarshalAnthropicMessageRequest(c.Request)
 	if err != nil {
@@ -21,3 +49,24 @@ func GetAnthropicRequestUsage(c *gin.Context, _ model.ModelConfig) (RequestUsage
 		)),
 	}), nil
 }
+
+// HandleAnthropicCountTokens replies the local estimate of count_tokens for the channels
+// that can't count the tokens natively
+func HandleAnthropicCountTokens(c *gin.Context, _ *meta.Meta) *HandleResult {
+	inputTokens, err := CountAnthropicRequestTokens(c.Request)
+	if err != nil {
+		return &HandleResult{
+			Error: relaymodel.WrapperAnthropicError(
+				err,
+				"invalid_request_error",
+				http.StatusBadRequest,
+			),
+		}
+	}
+
+	c.JSON(http.StatusOK, relaymodel.ClaudeCountTokensResponse{
+		InputTokens: inputTokens,
+	})
+
+	return &HandleResult{}
+}
@@ -0,0 +1,102 @@
+//nolint:testpackage
+package controller
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/bytedance/sonic"
+	"github.com/gin-gonic/gin"
+	"github.com/labring/aiproxy/core/model"
+	relaymodel "github.com/labring/aiproxy/core/relay/model"
+	"github.com/stretchr/testify/require"
+)
+
+func newAnthropicCountTokensContext(t *testing.T, body string) (*gin.Context, *httptest.ResponseRecorder) {
+	t.Helper()
+
+	gin.SetMode(gin.TestMode)
+
+	recorder := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(recorder)
+	c.Request = httptest.NewRequestWithContext(
+		t.Context(),
+		http.MethodPost,
+		"/v1/messages/count_tokens",
+		bytes.NewBufferString(body),
+	)
+	c.Request.Header.Set("Content-Type", "application/json")
+
+	return c, recorder
+}
+
+func TestHandleAnthropicCountTokens(t *testing.T) {
+	t.Parallel()
+
+	c, recorder := newAnthropicCountTokensContext(t, `{
+		"model":"claude-sonnet-4-5",
+		"messages":[{"role":"user","content":"Hello, world"}]
+	}`)
+
+	result := HandleAnthropicCountTokens(c, nil)
+	require.Nil(t, result.Error)
+	require.Zero(t, result.Usage.InputTokens)
+	require.Equal(t, http.StatusOK, recorder.Code)
+
+	var resp relaymodel.ClaudeCountTokensResponse
+	require.NoError(t, sonic.Unmarshal(recorder.Body.Bytes(), &resp))
+	require.Positive(t, resp.InputTokens)
+
+	withSystem, _ := newAnthropicCountTokensContext(t, `{
+		"model":"claude-sonnet-4-5",
+		"system":[{"type":"text","text":"You are a helpful assistant."}],
+		"messages":[{"role":"user","content":[{"type":"text","text":"Hello, world"}]}]
+	}`)
+
+	systemTokens, err := CountAnthropicRequestTokens(withSystem.Request)
+	require.NoError(t, err)
+	require.Greater(t, systemTokens, resp.InputTokens)
+
+	withTools, _ := newAnthropicCountTokensContext(t, `{
+		"model":"claude-sonnet-4-5",
+		"tools":[{"name":"get_weather","description":"Get the weather of a city","input_schema":{"type":"object","properties":{"city":{"type":"string"}}}}],
+		"messages":[{"role":"user","content":"Hello, world"}]
+	}`)
+
+	toolsTokens, err := CountAnthropicRequestTokens(withTools.Request)
+	require.NoError(t, err)
+	require.Greater(t, toolsTokens, resp.InputTokens)
+}
+
+func TestGetAnthropicRequestUsageIgnoresSystem(t *testing.T) {
+	t.Parallel()
+
+	withoutSystem, _ := newAnthropicCountTokensContext(t, `{
+		"model":"claude-sonnet-4-5",
+		"messages":[{"role":"user","content":"Hello, world"}]
+	}`)
+	withSystem, _ := newAnthropicCountTokensContext(t, `{
+		"model":"claude-sonnet-4-5",
+		"system":"You are a helpful assistant.",
+		"messages":[{"role":"user","content":"Hello, world"}]
+	}`)
+
+	usage, err := GetAnthropicRequestUsage(withoutSystem, model.ModelConfig{})
+	require.NoError(t, err)
+
+	systemUsage, err := GetAnthropicRequestUsage(withSystem, model.ModelConfig{})
+	require.NoError(t, err)
+	require.Equal(t, usage.Usage.InputTokens, systemUsage.Usage.InputTokens)
+}
+
+func TestHandleAnthropicCountTokensInvalidRequest(t *testing.T) {
+	t.Parallel()
+
+	c, _ := newAnthropicCountTokensContext(t, `{"model":`)
+
+	result := HandleAnthropicCountTokens(c, nil)
+	require.NotNil(t, result.Error)
+	require.Equal(t, http.StatusBadRequest, result.Error.StatusCode())
+}
@@ -0,0 +1,16 @@
+package controller
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/labring/aiproxy/core/model"
+)
+
+// GetBatchRequestUsage marks the request as a batch, so that the conditional prices
+// with the batch condition are selected when the batch usage is settled
+func GetBatchRequestUsage(_ *gin.Context, _ model.ModelConfig) (RequestUsage, error) {
+	return RequestUsage{
+		Context: model.UsageContext{
+			Batch: new(true),
+		},
+	}, nil
+}
@@ -1,10 +1,561 @@
 package controller
 
 import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/bytedance/sonic"
 	"github.com/gin-gonic/gin"
+	"github.com/labring/aiproxy/core/common"
+	"github.com/labring/aiproxy/core/common/conv"
 	"github.com/labring/aiproxy/core/model"
+	"github.com/labring/aiproxy/core/relay/adaptor"
+	"github.com/labring/aiproxy/core/relay/adaptor/openai"
+	"github.com/labring/aiproxy/core/relay/meta"
+	"github.com/labring/aiproxy/core/relay/mode"
+	relaymodel "github.com/labring/aiproxy/core/relay/model"
+	"github.com/labring/aiproxy/core/relay/plugin/prompt"
+	"github.com/labring/aiproxy/core/relay/render"
+)
+
+const (
+	emulatedResponseStoreTTL       = time.Hour * 24 * 7
+	defaultResponseInputItemsLimit = 20
+	maxResponseInputItemsLimit     = 100
 )
 
 func GetResponsesRequestUsage(c *gin.Context, _ model.ModelConfig) (RequestUsage, error) {
 	return NewRequestUsage(model.Usage{}), nil
 }
+
+// emulatedResponse is the store metadata of a response emulated on chat completions,
+// the input items and the output are replayed when the response is continued
+type emulatedResponse struct {
+	Response   relaymodel.Response    `json:"response"`
+	InputItems []relaymodel.InputItem `json:"input_items"`
+}
+
+var errResponseNotFound = errors.New("response not found")
+
+func responsesBadRequest(err error) *HandleResult {
+	return &HandleResult{
+		Error: relaymodel.WrapperOpenAIErrorWithMessage(
+			err.Error(),
+			"invalid_request_error",
+			http.StatusBadRequest,
+		),
+	}
+}
+
+func responseNotFound(responseID string) *HandleResult {
+	return &HandleResult{
+		Error: relaymodel.WrapperOpenAIErrorWithMessage(
+			"response "+responseID+" not found",
+			"not_found",
+			http.StatusNotFound,
+		),
+	}
+}
+
+func loadEmulatedResponse(
+	store adaptor.Store,
+	meta *meta.Meta,
+	responseID string,
+) (*emulatedResponse, error) {
+	cache, err := store.GetStore(meta.Group.ID, meta.Token.ID, model.ResponseStoreID(responseID))
+	if err != nil {
+		return nil, err
+	}
+
+	// deleted responses are expired in place, the cache may still hold them
+	if cache.Metadata == "" ||
+		(!cache.ExpiresAt.IsZero() && !cache.ExpiresAt.After(time.Now())) {
+		return nil, errResponseNotFound
+	}
+
+	var stored emulatedResponse
+	if err := sonic.UnmarshalString(cache.Metadata, &stored); err != nil {
+		return nil, err
+	}
+
+	return &stored, nil
+}
+
+// loadEmulatedResponseHistory replays the conversation ending with the previous response
+func loadEmulatedResponseHistory(
+	store adaptor.Store,
+	meta *meta.Meta,
+	previousResponseID string,
+) ([]relaymodel.InputItem, error) {
+	var turns [][]relaymodel.InputItem
+
+	for responseID := previousResponseID; responseID != ""; {
+		stored, err := loadEmulatedResponse(store, meta, responseID)
+		if err != nil {
+			return nil, errors.New("previous response " + responseID + " not found")
+		}
+
+		turn := slices.Clone(stored.InputItems)
+		turn = append(turn, openai.ConvertOutputItemsToInputItems(stored.Response.Output)...)
+		turns = append(turns, turn)
+
+		responseID = ""
+		if stored.Response.PreviousResponseID != nil {
+			responseID = *stored.Response.PreviousResponseID
+		}
+	}
+
+	slices.Reverse(turns)
+
+	return slices.Concat(turns...), nil
+}
+
+func saveEmulatedResponse(
+	store adaptor.Store,
+	meta *meta.Meta,
+	response *relaymodel.Response,
+	inputItems []relaymodel.InputItem,
+) error {
+	metadata, err := sonic.MarshalString(emulatedResponse{
+		Response:   *response,
+		InputItems: inputItems,
+	})
+	if err != nil {
+		return err
+	}
+
+	return store.SaveStore(adaptor.StoreCache{
+		ID:        model.ResponseStoreID(response.ID),
+		GroupID:   meta.Group.ID,
+		TokenID:   meta.Token.ID,
+		ChannelID: meta.Channel.ID,
+		Model:     meta.OriginModel,
+		Metadata:  metadata,
+		ExpiresAt: time.Now().Add(emulatedResponseStoreTTL),
+	})
+}
+
+// responsesEmulationWriter converts the chat completion written by the adaptor to a response,
+// the events are written as the chunks arrive when the client streams
+type responsesEmulationWriter struct {
+	gin.ResponseWriter
+
+	stream  bool
+	state   *openai.ChatToResponsesStream
+	started bool
+	sse     *bool
+	pending []byte
+	body    bytes.Buffer
+}
+
+// ignore flush, the events are flushed once written
+func (w *responsesEmulationWriter) Flush() {}
+
+// ignore WriteHeaderNow
+func (w *responsesEmulationWriter) WriteHeaderNow() {}
+
+func (w *responsesEmulationWriter) WriteString(s string) (int, error) {
+	return w.Write(conv.StringToBytes(s))
+}
+
+func (w *responsesEmulationWriter) Write(b []byte) (int, error) {
+	if w.sse == nil {
+		sse := w.Header().Get("Content-Type") == "text/event-stream"
+		w.sse = &sse
+	}
+
+	if !*w.sse {
+		return w.body.Write(b)
+	}
+
+	w.pending = append(w.pending, b...)
+	for {
+		i := bytes.IndexByte(w.pending, '\n')
+		if i < 0 {
+			break
+		}
+
+		line := bytes.TrimSpace(w.pending[:i])
+		w.pending = w.pending[i+1:]
+
+		if err := w.handleLine(line); err != nil {
+			return 0, err
+		}
+	}
+
+	return len(b), nil
+}
+
+func (w *responsesEmulationWriter) handleLine(line []byte) error {
+	if !render.IsValidSSEData(line) {
+		return nil
+	}
+
+	data := render.ExtractSSEData(line)
+	if len(data) == 0 || render.IsSSEDone(data) {
+		return nil
+	}
+
+	var chunk relaymodel.ChatCompletionsStreamResponse
+	if err := sonic.Unmarshal(data, &chunk); err != nil {
+		return nil
+	}
+
+	return w.writeChunk(&chunk)
+}
+
+func (w *responsesEmulationWriter) writeChunk(chunk *relaymodel.ChatCompletionsStreamResponse) error {
+	if w.stream {
+		if err := w.start(); err != nil {
+			return err
+		}
+	}
+
+	return w.writeEvents(w.state.Chunk(chunk))
+}
+
+func (w *responsesEmulationWriter) start() error {
+	if w.started {
+		return nil
+	}
+
+	w.started = true
+
+	return w.writeEvents(w.state.Start())
+}
+
+func (w *responsesEmulationWriter) writeEvents(events []relaymodel.ResponseStreamEvent) error {
+	if !w.stream || len(events) == 0 {
+		return nil
+	}
+
+	for _, event := range events {
+		data, err := sonic.Marshal(event)
+		if err != nil {
+			return err
+		}
+
+		if err := (&render.Responses{Event: event.Type, Data: data}).Render(w.ResponseWriter); err != nil {
+			return err
+		}
+	}
+
+	w.ResponseWriter.Flush()
+
+	return nil
+}
+
+// finish completes the response once the adaptor succeeded
+func (w *responsesEmulationWriter) finish() error {
+	switch {
+	case w.sse != nil && !*w.sse:
+		var chatResp relaymodel.TextResponse
+		if err := sonic.Unmarshal(w.body.Bytes(), &chatResp); err != nil {
+			return err
+		}
+
+		// the adaptor answered in one piece, it is converted as a single chunk
+		if err := w.writeChunk(openai.ChatCompletionToStreamChunk(&chatResp)); err != nil {
+			return err
+		}
+	case len(w.pending) > 0:
+		if err := w.handleLine(bytes.TrimSpace(w.pending)); err != nil {
+			return err
+		}
+	}
+
+	if w.stream {
+		if err := w.start(); err != nil {
+			return err
+		}
+
+		return w.writeEvents(w.state.Finish())
+	}
+
+	w.state.Finish()
+
+	data, err := sonic.Marshal(w.state.Response())
+	if err != nil {
+		return err
+	}
+
+	header := w.Header()
+	header.Set("Content-Type", "application/json")
+	header.Set("Content-Length", strconv.Itoa(len(data)))
+	header.Del("Cache-Control")
+	header.Del("Connection")
+	header.Del("Transfer-Encoding")
+	header.Del("X-Accel-Buffering")
+
+	_, err = w.ResponseWriter.Write(data)
+
+	return err
+}
+
+// fail ends a started stream with a failed response, it returns false when nothing
+// has been written so the error can still be returned to the client or retried
+func (w *responsesEmulationWriter) fail(respErr adaptor.Error) bool {
+	if !w.started {
+		return false
+	}
+
+	_ = w.writeEvents(w.state.Fail(strconv.Itoa(respErr.StatusCode()), respErr.Error()))
+
+	return true
+}
+
+// HandleResponsesEmulation serves the Responses API on the channels that only support
+// chat completions, the request is converted to a chat completion and the answer back
+// to a response, the conversation is kept in the store to continue it by previous_response_id
+func HandleResponsesEmulation(
+	a adaptor.Adaptor,
+	c *gin.Context,
+	meta *meta.Meta,
+	store adaptor.Store,
+	opts ...BodyDetailOption,
+) *HandleResult {
+	log := common.GetLogger(c)
+
+	body, err := common.GetRequestBodyReusable(c.Request)
+	if err != nil {
+		return responsesBadRequest(err)
+	}
+
+	// the prompt reference does not survive the conversion to chat
+	expanded, err := prompt.ExpandEmulatedResponses(meta, body)
+	if err != nil {
+		if relayErr, ok := errors.AsType[adaptor.Error](err); ok {
+			return &HandleResult{Error: relayErr}
+		}
+
+		return responsesBadRequest(err)
+	}
+
+	var req relaymodel.CreateResponseRequest
+	if err := sonic.Unmarshal(expanded, &req); err != nil {
+		return responsesBadRequest(err)
+	}
+
+	if req.Background != nil && *req.Background {
+		return responsesBadRequest(errors.New("background responses are not supported by the channel"))
+	}
+
+	inputItems, err := openai.ParseResponsesInput(req.Input)
+	if err != nil {
+		return responsesBadRequest(err)
+	}
+
+	var history []relaymodel.InputItem
+	if req.PreviousResponseID != nil && *req.PreviousResponseID != "" {
+		history, err = loadEmulatedResponseHistory(store, meta, *req.PreviousResponseID)
+		if err != nil {
+			return responsesBadRequest(err)
+		}
+	}
+
+	chatReq, err := openai.ConvertResponsesRequestToChatRequest(
+		&req,
+		slices.Concat(history, inputItems),
+	)
+	if err != nil {
+		return responsesBadRequest(err)
+	}
+
+	chatBody, err := sonic.Marshal(chatReq)
+	if err != nil {
+		return responsesBadRequest(err)
+	}
+
+	common.SetRequestBody(c.Request, chatBody)
+	defer common.SetRequestBody(c.Request, body)
+
+	meta.Mode = mode.ChatCompletions
+	defer func() {
+		meta.Mode = mode.Responses
+	}()
+
+	response := openai.NewResponseFromRequest(
+		"resp_"+common.ShortUUID(),
+		time.Now().Unix(),
+		meta.OriginModel,
+		&req,
+	)
+
+	rw := &responsesEmulationWriter{
+		ResponseWriter: c.Writer,
+		stream:         req.Stream,
+		state:          openai.NewChatToResponsesStream(response),
+	}
+
+	c.Writer = rw
+	defer func() {
+		c.Writer = rw.ResponseWriter
+	}()
+
+	result := Handle(a, c, meta, store, opts...)
+	if result.Error != nil {
+		if rw.fail(result.Error) {
+			result.Error = nil
+		}
+
+		return result
+	}
+
+	if err := rw.finish(); err != nil {
+		log.Errorf("convert chat completion to response failed: %v", err)
+
+		if !rw.fail(relaymodel.WrapperOpenAIError(
+			err,
+			"convert_response_failed",
+			http.StatusInternalServerError,
+		)) {
+			result.Error = relaymodel.WrapperOpenAIError(
+				err,
+				"convert_response_failed",
+				http.StatusInternalServerError,
+			)
+		}
+
+		return result
+	}
+
+	if response.Store {
+		for i := range inputItems {
+			if inputItems[i].ID == "" {
+				inputItems[i].ID = "item_" + common.ShortUUID()
+			}
+		}
+
+		if err := saveEmulatedResponse(store, meta, response, inputItems); err != nil {
+			log.Errorf("save response store failed: %v", err)
+		}
+	}
+
+	return result
+}
+
+func getEmulatedResponse(
+	meta *meta.Meta,
+	store adaptor.Store,
+) (*emulatedResponse, *HandleResult) {
+	stored, err := loadEmulatedResponse(store, meta, meta.ResponseID)
+	if err != nil {
+		return nil, responseNotFound(meta.ResponseID)
+	}
+
+	return stored, nil
+}
+
+// HandleEmulatedResponseGet replies a response emulated on chat completions from the store
+func HandleEmulatedResponseGet(
+	c *gin.Context,
+	meta *meta.Meta,
+	store adaptor.Store,
+) *HandleResult {
+	stored, errResult := getEmulatedResponse(meta, store)
+	if errResult != nil {
+		return errResult
+	}
+
+	c.JSON(http.StatusOK, stored.Response)
+
+	return &HandleResult{}
+}
+
+// HandleEmulatedResponseDelete deletes a response emulated on chat completions,
+// the store is expired as it can't be removed
+func HandleEmulatedResponseDelete(
+	c *gin.Context,
+	meta *meta.Meta,
+	store adaptor.Store,
+) *HandleResult {
+	if _, errResult := getEmulatedResponse(meta, store); errResult != nil {
+		return errResult
+	}
+
+	err := store.SaveStore(adaptor.StoreCache{
+		ID:        model.ResponseStoreID(meta.ResponseID),
+		GroupID:   meta.Group.ID,
+		TokenID:   meta.Token.ID,
+		ChannelID: meta.Channel.ID,
+		Model:     meta.OriginModel,
+		ExpiresAt: time.Now(),
+	})
+	if err != nil {
+		return &HandleResult{
+			Error: relaymodel.WrapperOpenAIError(
+				err,
+				"delete_response_failed",
+				http.StatusInternalServerError,
+			),
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"id":      meta.ResponseID,
+		"object":  "response.deleted",
+		"deleted": true,
+	})
+
+	return &HandleResult{}
+}
+
+// HandleEmulatedResponseInputItems lists the input items of a response emulated on
+// chat completions, supporting the limit, order and after query of the Responses API
+func HandleEmulatedResponseInputItems(
+	c *gin.Context,
+	meta *meta.Meta,
+	store adaptor.Store,
+) *HandleResult {
+	stored, errResult := getEmulatedResponse(meta, store)
+	if errResult != nil {
+		return errResult
+	}
+
+	limit, _ := strconv.Atoi(c.Query("limit"))
+	if limit <= 0 {
+		limit = defaultResponseInputItemsLimit
+	}
+
+	limit = min(limit, maxResponseInputItemsLimit)
+
+	items := slices.Clone(stored.InputItems)
+	if c.Query("order") != "asc" {
+		slices.Reverse(items)
+	}
+
+	if after := c.Query("after"); after != "" {
+		index := slices.IndexFunc(items, func(item relaymodel.InputItem) bool {
+			return item.ID == after
+		})
+		if index < 0 {
+			return responsesBadRequest(fmt.Errorf("input item %s not found", after))
+		}
+
+		items = items[index+1:]
+	}
+
+	list := relaymodel.InputItemList{
+		Object:  "list",
+		Data:    items,
+		HasMore: len(items) > limit,
+	}
+
+	if list.HasMore {
+		list.Data = items[:limit]
+	}
+
+	if len(list.Data) > 0 {
+		list.FirstID = list.Data[0].ID
+		list.LastID = list.Data[len(list.Data)-1].ID
+	}
+
+	c.JSON(http.StatusOK, list)
+
+	return &HandleResult{}
+}
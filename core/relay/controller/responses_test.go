@@ -0,0 +1,379 @@
+//nolint:testpackage
+package controller
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/bytedance/sonic"
+	"github.com/gin-gonic/gin"
+	"github.com/labring/aiproxy/core/common"
+	"github.com/labring/aiproxy/core/model"
+	"github.com/labring/aiproxy/core/relay/adaptor"
+	"github.com/labring/aiproxy/core/relay/meta"
+	"github.com/labring/aiproxy/core/relay/mode"
+	relaymodel "github.com/labring/aiproxy/core/relay/model"
+	"github.com/labring/aiproxy/core/relay/render"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type memoryStore map[string]adaptor.StoreCache
+
+func (s memoryStore) GetStore(_ string, _ int, id string) (adaptor.StoreCache, error) {
+	store, ok := s[id]
+	if !ok {
+		return adaptor.StoreCache{}, model.NotFoundError(model.ErrStoreNotFound)
+	}
+
+	return store, nil
+}
+
+func (s memoryStore) SaveStore(store adaptor.StoreCache) error {
+	s[store.ID] = store
+	return nil
+}
+
+func (s memoryStore) SaveStoreWithOption(store adaptor.StoreCache, _ adaptor.SaveStoreOption) error {
+	return s.SaveStore(store)
+}
+
+func (s memoryStore) SaveIfNotExistStore(store adaptor.StoreCache) error {
+	if _, ok := s[store.ID]; !ok {
+		s[store.ID] = store
+	}
+
+	return nil
+}
+
+func newResponsesEmulationContext(
+	method, path, body string,
+	m mode.Mode,
+) (*gin.Context, *httptest.ResponseRecorder, *meta.Meta) {
+	gin.SetMode(gin.TestMode)
+
+	recorder := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(recorder)
+	c.Request = httptest.NewRequestWithContext(
+		context.Background(),
+		method,
+		path,
+		strings.NewReader(body),
+	)
+	c.Request.Header.Set("Content-Type", "application/json")
+
+	relayMeta := meta.NewMeta(
+		&model.Channel{ID: 1},
+		m,
+		"claude-sonnet-4-5",
+		model.ModelConfig{},
+	)
+	relayMeta.Group.ID = "group"
+	relayMeta.Token.ID = 1
+
+	return c, recorder, relayMeta
+}
+
+// chatAdaptor answers every chat completion with the content, it records the
+// messages of the last request
+func chatAdaptor(content string, stream bool, messages *[]relaymodel.Message) testAdaptor {
+	return testAdaptor{
+		convertRequest: func(
+			meta *meta.Meta,
+			_ adaptor.Store,
+			req *http.Request,
+		) (adaptor.ConvertResult, error) {
+			if meta.Mode != mode.ChatCompletions {
+				return adaptor.ConvertResult{}, io.ErrUnexpectedEOF
+			}
+
+			var chatReq relaymodel.GeneralOpenAIRequest
+			if err := sonic.ConfigDefault.NewDecoder(req.Body).Decode(&chatReq); err != nil {
+				return adaptor.ConvertResult{}, err
+			}
+
+			*messages = chatReq.Messages
+
+			return adaptor.ConvertResult{Body: http.NoBody}, nil
+		},
+		doRequest: func(
+			_ *meta.Meta,
+			_ adaptor.Store,
+			_ *gin.Context,
+			_ *http.Request,
+		) (*http.Response, error) {
+			return &http.Response{
+				StatusCode: http.StatusOK,
+				Body:       http.NoBody,
+				Header:     make(http.Header),
+			}, nil
+		},
+		doResponse: func(
+			_ *meta.Meta,
+			_ adaptor.Store,
+			c *gin.Context,
+			_ *http.Response,
+		) (adaptor.DoResponseResult, adaptor.Error) {
+			usage := relaymodel.ChatUsage{PromptTokens: 3, CompletionTokens: 2, TotalTokens: 5}
+
+			if !stream {
+				c.JSON(http.StatusOK, relaymodel.TextResponse{
+					ID:     "chatcmpl-1",
+					Object: relaymodel.ChatCompletionObject,
+					Choices: []*relaymodel.TextResponseChoice{{
+						Message: relaymodel.Message{
+							Role:    relaymodel.RoleAssistant,
+							Content: content,
+						},
+						FinishReason: relaymodel.FinishReasonStop,
+					}},
+					Usage: usage,
+				})
+
+				return adaptor.DoResponseResult{Usage: usage.ToModelUsage()}, nil
+			}
+
+			for _, chunk := range []relaymodel.ChatCompletionsStreamResponse{
+				{Choices: []*relaymodel.ChatCompletionsStreamResponseChoice{{
+					Delta: relaymodel.Message{Content: content[:2]},
+				}}},
+				{Choices: []*relaymodel.ChatCompletionsStreamResponseChoice{{
+					Delta:        relaymodel.Message{Content: content[2:]},
+					FinishReason: relaymodel.FinishReasonStop,
+				}}},
+				{
+					Choices: []*relaymodel.ChatCompletionsStreamResponseChoice{},
+					Usage:   &usage,
+				},
+			} {
+				_ = render.OpenaiObjectData(c, chunk)
+			}
+
+			render.OpenaiDone(c)
+
+			return adaptor.DoResponseResult{Usage: usage.ToModelUsage()}, nil
+		},
+	}
+}
+
+func TestHandleResponsesEmulation(t *testing.T) {
+	store := memoryStore{}
+
+	var messages []relaymodel.Message
+
+	c, recorder, relayMeta := newResponsesEmulationContext(
+		http.MethodPost,
+		"/v1/responses",
+		`{"model":"claude-sonnet-4-5","instructions":"be brief","input":"hi"}`,
+		mode.Responses,
+	)
+
+	result := HandleResponsesEmulation(chatAdaptor("hello", false, &messages), c, relayMeta, store)
+	require.NoError(t, result.Error)
+	assert.Equal(t, mode.Responses, relayMeta.Mode)
+	require.Len(t, messages, 2)
+	assert.Equal(t, relaymodel.RoleSystem, messages[0].Role)
+
+	var first relaymodel.Response
+	require.NoError(t, sonic.Unmarshal(recorder.Body.Bytes(), &first))
+	assert.Equal(t, "response", first.Object)
+	assert.Equal(t, relaymodel.ResponseStatusCompleted, first.Status)
+	require.Len(t, first.Output, 1)
+	assert.Equal(t, "hello", first.Output[0].Content[0].Text)
+	assert.Equal(t, int64(5), first.Usage.TotalTokens)
+	assert.Contains(t, store, model.ResponseStoreID(first.ID))
+
+	// the instructions are not carried over, the conversation is
+	c, recorder, relayMeta = newResponsesEmulationContext(
+		http.MethodPost,
+		"/v1/responses",
+		`{"model":"claude-sonnet-4-5","stream":true,"previous_response_id":"`+first.ID+`","input":"again"}`,
+		mode.Responses,
+	)
+
+	result = HandleResponsesEmulation(chatAdaptor("hello again", true, &messages), c, relayMeta, store)
+	require.NoError(t, result.Error)
+	require.Len(t, messages, 3)
+	assert.Equal(t, "hi", messages[0].Content)
+	assert.Equal(t, "hello", messages[1].Content)
+	assert.Equal(t, "again", messages[2].Content)
+
+	body := recorder.Body.String()
+	assert.True(t, strings.HasPrefix(body, "event: response.created\n"))
+	assert.Contains(t, body, "event: response.output_text.delta\n")
+	assert.Contains(t, body, "event: response.completed\n")
+	assert.NotContains(t, body, "[DONE]")
+	assert.NotContains(t, body, "chat.completion")
+}
+
+func TestHandleResponsesEmulationExpandsPrompt(t *testing.T) {
+	prevDB := model.DB
+	prevUsingSQLite := common.UsingSQLite
+
+	testDB, err := model.OpenSQLite(filepath.Join(t.TempDir(), "prompt.db"))
+	require.NoError(t, err)
+
+	model.DB = testDB
+	common.UsingSQLite = true
+
+	t.Cleanup(func() {
+		model.DB = prevDB
+		common.UsingSQLite = prevUsingSQLite
+	})
+
+	require.NoError(t, testDB.AutoMigrate(&model.Group{}, &model.Prompt{}))
+	require.NoError(t, testDB.Create(&model.Group{ID: "group"}).Error)
+	require.NoError(t, model.CreatePrompt(&model.Prompt{
+		ID:      "support",
+		GroupID: "group",
+		Content: "You are the support agent of {{product}}.",
+		Variables: []model.PromptVariable{
+			{Name: "product", Required: true},
+		},
+	}))
+
+	store := memoryStore{}
+
+	var messages []relaymodel.Message
+
+	c, _, relayMeta := newResponsesEmulationContext(
+		http.MethodPost,
+		"/v1/responses",
+		`{"model":"claude-sonnet-4-5","instructions":"be brief","input":"hi",`+
+			`"prompt":{"id":"support","variables":{"product":"AI Proxy"}}}`,
+		mode.Responses,
+	)
+
+	result := HandleResponsesEmulation(chatAdaptor("hello", false, &messages), c, relayMeta, store)
+	require.NoError(t, result.Error)
+	require.Len(t, messages, 2)
+	assert.Equal(t, relaymodel.RoleSystem, messages[0].Role)
+	assert.Equal(t, "You are the support agent of AI Proxy.\n\nbe brief", messages[0].Content)
+
+	// the chat upstream can not resolve the prompts that are not in the registry
+	c, _, relayMeta = newResponsesEmulationContext(
+		http.MethodPost,
+		"/v1/responses",
+		`{"model":"claude-sonnet-4-5","input":"hi","prompt":{"id":"pmpt_unknown"}}`,
+		mode.Responses,
+	)
+
+	result = HandleResponsesEmulation(chatAdaptor("hello", false, &messages), c, relayMeta, store)
+	require.Error(t, result.Error)
+	assert.Equal(t, http.StatusBadRequest, result.Error.StatusCode())
+}
+
+func TestEmulatedResponseGetInputItemsDelete(t *testing.T) {
+	store := memoryStore{}
+
+	var messages []relaymodel.Message
+
+	c, recorder, relayMeta := newResponsesEmulationContext(
+		http.MethodPost,
+		"/v1/responses",
+		`{"model":"claude-sonnet-4-5","input":[
+			{"role":"user","content":"one"},
+			{"role":"user","content":"two"},
+			{"role":"user","content":"three"}
+		]}`,
+		mode.Responses,
+	)
+
+	result := HandleResponsesEmulation(chatAdaptor("ok", false, &messages), c, relayMeta, store)
+	require.NoError(t, result.Error)
+
+	var created relaymodel.Response
+	require.NoError(t, sonic.Unmarshal(recorder.Body.Bytes(), &created))
+
+	c, recorder, relayMeta = newResponsesEmulationContext(
+		http.MethodGet,
+		"/v1/responses/"+created.ID,
+		"",
+		mode.ResponsesGet,
+	)
+	relayMeta.ResponseID = created.ID
+
+	result = HandleEmulatedResponseGet(c, relayMeta, store)
+	require.NoError(t, result.Error)
+
+	var got relaymodel.Response
+	require.NoError(t, sonic.Unmarshal(recorder.Body.Bytes(), &got))
+	assert.Equal(t, created.ID, got.ID)
+	assert.Equal(t, "ok", got.Output[0].Content[0].Text)
+
+	c, recorder, relayMeta = newResponsesEmulationContext(
+		http.MethodGet,
+		"/v1/responses/"+created.ID+"/input_items?limit=2",
+		"",
+		mode.ResponsesInputItems,
+	)
+	relayMeta.ResponseID = created.ID
+
+	result = HandleEmulatedResponseInputItems(c, relayMeta, store)
+	require.NoError(t, result.Error)
+
+	var list relaymodel.InputItemList
+	require.NoError(t, sonic.Unmarshal(recorder.Body.Bytes(), &list))
+	require.Len(t, list.Data, 2)
+	assert.True(t, list.HasMore)
+	assert.Equal(t, "three", list.Data[0].Content[0].Text)
+	assert.NotEmpty(t, list.LastID)
+
+	c, recorder, relayMeta = newResponsesEmulationContext(
+		http.MethodGet,
+		"/v1/responses/"+created.ID+"/input_items?order=asc&after="+list.Data[0].ID,
+		"",
+		mode.ResponsesInputItems,
+	)
+	relayMeta.ResponseID = created.ID
+
+	result = HandleEmulatedResponseInputItems(c, relayMeta, store)
+	require.NoError(t, result.Error)
+	require.NoError(t, sonic.Unmarshal(recorder.Body.Bytes(), &list))
+	assert.Empty(t, list.Data)
+
+	c, _, relayMeta = newResponsesEmulationContext(
+		http.MethodGet,
+		"/v1/responses/"+created.ID+"/input_items?after=msg_unknown",
+		"",
+		mode.ResponsesInputItems,
+	)
+	relayMeta.ResponseID = created.ID
+
+	result = HandleEmulatedResponseInputItems(c, relayMeta, store)
+	require.Error(t, result.Error)
+	assert.Equal(t, http.StatusBadRequest, result.Error.StatusCode())
+
+	c, recorder, relayMeta = newResponsesEmulationContext(
+		http.MethodDelete,
+		"/v1/responses/"+created.ID,
+		"",
+		mode.ResponsesDelete,
+	)
+	relayMeta.ResponseID = created.ID
+
+	result = HandleEmulatedResponseDelete(c, relayMeta, store)
+	require.NoError(t, result.Error)
+	assert.JSONEq(
+		t,
+		`{"id":"`+created.ID+`","object":"response.deleted","deleted":true}`,
+		recorder.Body.String(),
+	)
+
+	c, _, relayMeta = newResponsesEmulationContext(
+		http.MethodGet,
+		"/v1/responses/"+created.ID,
+		"",
+		mode.ResponsesGet,
+	)
+	relayMeta.ResponseID = created.ID
+
+	result = HandleEmulatedResponseGet(c, relayMeta, store)
+	require.Error(t, result.Error)
+	assert.Equal(t, http.StatusNotFound, result.Error.StatusCode())
+}
@@ -53,6 +53,7 @@ type Meta struct {
 	ResponseID   string
 	VideoID      string
 	FileID       string
+	BatchID      string
 }
 
 type Option func(meta *Meta)
@@ -147,6 +148,12 @@ func WithFileID(fileID string) Option {
 	}
 }
 
+func WithBatchID(batchID string) Option {
+	return func(meta *Meta) {
+		meta.BatchID = batchID
+	}
+}
+
 func WithPromptCacheKey(promptCacheKey string) Option {
 	return func(meta *Meta) {
 		meta.PromptCacheKey = promptCacheKey
@@ -53,6 +53,16 @@ var modeNames = map[Mode]string{
 	ResponsesInputItems:     "ResponsesInputItems",
 	ResponsesCompact:        "ResponsesCompact",
 	AlphaSearch:             "AlphaSearch",
+	MCPToolsCall:            "MCPToolsCall",
+	Files:                   "Files",
+	FilesGet:                "FilesGet",
+	FilesDelete:             "FilesDelete",
+	FilesContent:            "FilesContent",
+	Batches:                 "Batches",
+	BatchesGet:              "BatchesGet",
+	BatchesCancel:           "BatchesCancel",
+	Realtime:                "Realtime",
+	AnthropicCountTokens:    "AnthropicCountTokens",
 	Gemini:                  "Gemini",
 }
 
@@ -98,4 +108,14 @@ const (
 	DoubaoVideoTasksDelete
 	ResponsesCompact
 	AlphaSearch
+	MCPToolsCall
+	Files
+	FilesGet
+	FilesDelete
+	FilesContent
+	Batches
+	BatchesGet
+	BatchesCancel
+	Realtime
+	AnthropicCountTokens
 )
@@ -49,6 +49,16 @@ func TestPersistedModeIDsStayStable(t *testing.T) {
 		mode.DoubaoVideoTasksDelete:  38,
 		mode.ResponsesCompact:        39,
 		mode.AlphaSearch:             40,
+		mode.MCPToolsCall:            41,
+		mode.Files:                   42,
+		mode.FilesGet:                43,
+		mode.FilesDelete:             44,
+		mode.FilesContent:            45,
+		mode.Batches:                 46,
+		mode.BatchesGet:              47,
+		mode.BatchesCancel:           48,
+		mode.Realtime:                49,
+		mode.AnthropicCountTokens:    50,
 	}
 
 	for relayMode, want := range tests {
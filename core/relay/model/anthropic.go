@@ -1,10 +1,16 @@
 package model
 
-import "github.com/labring/aiproxy/core/relay/adaptor"
+import (
+	"encoding/json"
+
+	"github.com/labring/aiproxy/core/relay/adaptor"
+)
 
 type AnthropicMessageRequest struct {
-	Model    string    `json:"model,omitempty"`
-	Messages []Message `json:"messages,omitempty"`
+	Model    string            `json:"model,omitempty"`
+	System   any               `json:"system,omitempty"`
+	Messages []Message         `json:"messages,omitempty"`
+	Tools    []json.RawMessage `json:"tools,omitempty"`
 }
 
 type AnthropicError struct {
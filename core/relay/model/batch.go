@@ -0,0 +1,118 @@
+package model
+
+import (
+	"net/http"
+
+	"github.com/labring/aiproxy/core/model"
+)
+
+type BatchStatus = string
+
+const (
+	BatchStatusValidating BatchStatus = "validating"
+	BatchStatusFailed     BatchStatus = "failed"
+	BatchStatusInProgress BatchStatus = "in_progress"
+	BatchStatusFinalizing BatchStatus = "finalizing"
+	BatchStatusCompleted  BatchStatus = "completed"
+	BatchStatusExpired    BatchStatus = "expired"
+	BatchStatusCancelling BatchStatus = "cancelling"
+	BatchStatusCancelled  BatchStatus = "cancelled"
+)
+
+type BatchRequestCounts struct {
+	Total     int64 `json:"total"`
+	Completed int64 `json:"completed"`
+	Failed    int64 `json:"failed"`
+}
+
+type Batch struct {
+	ID               string             `json:"id"`
+	Object           string             `json:"object"`
+	Endpoint         string             `json:"endpoint"`
+	InputFileID      string             `json:"input_file_id"`
+	CompletionWindow string             `json:"completion_window"`
+	Status           BatchStatus        `json:"status"`
+	OutputFileID     string             `json:"output_file_id,omitempty"`
+	ErrorFileID      string             `json:"error_file_id,omitempty"`
+	CreatedAt        int64              `json:"created_at"`
+	ExpiresAt        int64              `json:"expires_at,omitempty"`
+	RequestCounts    BatchRequestCounts `json:"request_counts"`
+}
+
+// IsFinished reports whether the batch will not make any more progress
+func (b *Batch) IsFinished() bool {
+	switch b.Status {
+	case BatchStatusFailed,
+		BatchStatusCompleted,
+		BatchStatusExpired,
+		BatchStatusCancelled:
+		return true
+	default:
+		return false
+	}
+}
+
+// BatchOutputLine is a line of the batch output file
+type BatchOutputLine struct {
+	ID       string               `json:"id"`
+	CustomID string               `json:"custom_id"`
+	Response *BatchOutputResponse `json:"response"`
+}
+
+type BatchOutputResponse struct {
+	StatusCode int                      `json:"status_code"`
+	RequestID  string                   `json:"request_id"`
+	Body       *BatchOutputResponseBody `json:"body"`
+}
+
+type BatchOutputResponseBody struct {
+	Model string            `json:"model,omitempty"`
+	Usage *BatchOutputUsage `json:"usage,omitempty"`
+}
+
+// BatchOutputUsage covers the chat completion, completion and embedding usage, and the
+// usage of the responses api which uses input_tokens and output_tokens instead
+type BatchOutputUsage struct {
+	ChatUsage
+	InputTokens         int64                 `json:"input_tokens,omitempty"`
+	OutputTokens        int64                 `json:"output_tokens,omitempty"`
+	InputTokensDetails  *ResponseUsageDetails `json:"input_tokens_details,omitempty"`
+	OutputTokensDetails *ResponseUsageDetails `json:"output_tokens_details,omitempty"`
+}
+
+func (u *BatchOutputUsage) ToModelUsage() model.Usage {
+	if u.InputTokens == 0 && u.OutputTokens == 0 {
+		return u.ChatUsage.ToModelUsage()
+	}
+
+	usage := ResponseUsage{
+		InputTokens:         u.InputTokens,
+		OutputTokens:        u.OutputTokens,
+		TotalTokens:         u.TotalTokens,
+		InputTokensDetails:  u.InputTokensDetails,
+		OutputTokensDetails: u.OutputTokensDetails,
+	}
+
+	return usage.ToModelUsage()
+}
+
+// ToModelUsage returns the usage of the batch request, failed requests are not billed
+func (l *BatchOutputLine) ToModelUsage() model.Usage {
+	if l.Response == nil ||
+		l.Response.StatusCode != http.StatusOK ||
+		l.Response.Body == nil ||
+		l.Response.Body.Usage == nil {
+		return model.Usage{}
+	}
+
+	return l.Response.Body.Usage.ToModelUsage()
+}
+
+// Model returns the model that served the batch request
+func (l *BatchOutputLine) Model() string {
+	if l.Response == nil || l.Response.Body == nil {
+		return ""
+	}
+
+	return l.Response.Body.Model
+}
@@ -174,6 +174,11 @@ type ClaudeAnyContentRequest struct {
 	OutputConfig        *ClaudeOutputConfig       `json:"output_config,omitempty"`
 }
 
+// ClaudeCountTokensResponse is the response of /v1/messages/count_tokens
+type ClaudeCountTokensResponse struct {
+	InputTokens int64 `json:"input_tokens"`
+}
+
 type ClaudeUsage struct {
 	InputTokens  int64 `json:"input_tokens"`
 	OutputTokens int64 `json:"output_tokens"`
@@ -61,7 +61,7 @@ func WrapperErrorWithMessage(
 	}
 
 	switch m {
-	case mode.Anthropic:
+	case mode.Anthropic, mode.AnthropicCountTokens:
 		return NewAnthropicError(statusCode, AnthropicError{
 			Message: message,
 			Type:    opt.Type,
@@ -0,0 +1,103 @@
+package model
+
+import (
+	"strings"
+
+	"github.com/labring/aiproxy/core/model"
+)
+
+const (
+	RealtimeEventSessionCreated = "session.created"
+	RealtimeEventResponseDone   = "response.done"
+)
+
+// RealtimeAPIKeyProtocolPrefix is the websocket subprotocol used by browsers to pass the api key,
+// e.g. `Sec-WebSocket-Protocol: realtime, openai-insecure-api-key.sk-xxx`
+const RealtimeAPIKeyProtocolPrefix = "openai-insecure-api-key."
+
+// RealtimeAPIKeyFromProtocols returns the api key carried by the websocket subprotocols
+func RealtimeAPIKeyFromProtocols(protocols []string) string {
+	for _, protocol := range protocols {
+		if key, ok := strings.CutPrefix(protocol, RealtimeAPIKeyProtocolPrefix); ok {
+			return key
+		}
+	}
+
+	return ""
+}
+
+// RealtimeServerEvent only contains the fields of the server events that aiproxy cares about
+type RealtimeServerEvent struct {
+	Type     string            `json:"type"`
+	EventID  string            `json:"event_id,omitempty"`
+	Session  *RealtimeSession  `json:"session,omitempty"`
+	Response *RealtimeResponse `json:"response,omitempty"`
+}
+
+type RealtimeSession struct {
+	ID    string `json:"id"`
+	Model string `json:"model,omitempty"`
+}
+
+type RealtimeResponse struct {
+	ID     string         `json:"id"`
+	Status string         `json:"status,omitempty"`
+	Usage  *RealtimeUsage `json:"usage,omitempty"`
+}
+
+type RealtimeCachedTokensDetails struct {
+	TextTokens  int64 `json:"text_tokens,omitempty"`
+	AudioTokens int64 `json:"audio_tokens,omitempty"`
+	ImageTokens int64 `json:"image_tokens,omitempty"`
+}
+
+type RealtimeInputTokenDetails struct {
+	CachedTokens        int64                        `json:"cached_tokens,omitempty"`
+	TextTokens          int64                        `json:"text_tokens,omitempty"`
+	AudioTokens         int64                        `json:"audio_tokens,omitempty"`
+	ImageTokens         int64                        `json:"image_tokens,omitempty"`
+	CachedTokensDetails *RealtimeCachedTokensDetails `json:"cached_tokens_details,omitempty"`
+}
+
+type RealtimeOutputTokenDetails struct {
+	TextTokens  int64 `json:"text_tokens,omitempty"`
+	AudioTokens int64 `json:"audio_tokens,omitempty"`
+}
+
+// RealtimeUsage is the usage of a single response in a realtime session
+type RealtimeUsage struct {
+	TotalTokens        int64                       `json:"total_tokens"`
+	InputTokens        int64                       `json:"input_tokens"`
+	OutputTokens       int64                       `json:"output_tokens"`
+	InputTokenDetails  *RealtimeInputTokenDetails  `json:"input_token_details,omitempty"`
+	OutputTokenDetails *RealtimeOutputTokenDetails `json:"output_token_details,omitempty"`
+}
+
+func (u *RealtimeUsage) ToModelUsage() model.Usage {
+	usage := model.Usage{
+		InputTokens:  model.ZeroNullInt64(u.InputTokens),
+		OutputTokens: model.ZeroNullInt64(u.OutputTokens),
+		TotalTokens:  model.ZeroNullInt64(u.TotalTokens),
+	}
+
+	if details := u.InputTokenDetails; details != nil {
+		audioTokens := details.AudioTokens
+		imageTokens := details.ImageTokens
+
+		// the cached audio and image tokens are billed as cached tokens
+		if details.CachedTokensDetails != nil {
+			audioTokens -= details.CachedTokensDetails.AudioTokens
+			imageTokens -= details.CachedTokensDetails.ImageTokens
+		}
+
+		usage.CachedTokens = model.ZeroNullInt64(details.CachedTokens)
+		usage.AudioInputTokens = model.ZeroNullInt64(max(audioTokens, 0))
+		usage.ImageInputTokens = model.ZeroNullInt64(max(imageTokens, 0))
+	}
+
+	if u.OutputTokenDetails != nil {
+		usage.AudioOutputTokens = model.ZeroNullInt64(u.OutputTokenDetails.AudioTokens)
+	}
+
+	return usage
+}
@@ -400,3 +400,44 @@ func TestImageUsageToModelUsage(t *testing.T) {
 		assert.Equal(t, coremodel.ZeroNullInt64(0), usage.TotalTokens)
 	})
 }
+
+func TestRealtimeUsageToModelUsage(t *testing.T) {
+	var usage model.RealtimeUsage
+
+	err := json.Unmarshal([]byte(`{
+		"total_tokens": 1300,
+		"input_tokens": 1000,
+		"output_tokens": 300,
+		"input_token_details": {
+			"cached_tokens": 600,
+			"text_tokens": 200,
+			"audio_tokens": 800,
+			"cached_tokens_details": {
+				"text_tokens": 100,
+				"audio_tokens": 500
+			}
+		},
+		"output_token_details": {
+			"text_tokens": 60,
+			"audio_tokens": 240
+		}
+	}`), &usage)
+	assert.NoError(t, err)
+
+	modelUsage := usage.ToModelUsage()
+	assert.Equal(t, coremodel.ZeroNullInt64(1000), modelUsage.InputTokens)
+	assert.Equal(t, coremodel.ZeroNullInt64(300), modelUsage.OutputTokens)
+	assert.Equal(t, coremodel.ZeroNullInt64(1300), modelUsage.TotalTokens)
+	assert.Equal(t, coremodel.ZeroNullInt64(600), modelUsage.CachedTokens)
+	assert.Equal(t, coremodel.ZeroNullInt64(300), modelUsage.AudioInputTokens)
+	assert.Equal(t, coremodel.ZeroNullInt64(240), modelUsage.AudioOutputTokens)
+}
+
+func TestRealtimeAPIKeyFromProtocols(t *testing.T) {
+	assert.Equal(t, "sk-test", model.RealtimeAPIKeyFromProtocols([]string{
+		"realtime",
+		"openai-insecure-api-key.sk-test",
+		"openai-beta.realtime-v1",
+	}))
+	assert.Empty(t, model.RealtimeAPIKeyFromProtocols([]string{"realtime"}))
+}
@@ -88,6 +88,11 @@ func jitterCacheTTL(ttl time.Duration) time.Duration {
 
 // NewCachePlugin creates a new cache plugin
 func NewCachePlugin(rdb *redis.Client) plugin.Plugin {
+	return NewCache(rdb)
+}
+
+// NewCache creates a cache that other plugins can store items in
+func NewCache(rdb *redis.Client) *Cache {
 	return &Cache{rdb: rdb}
 }
 
@@ -202,8 +207,8 @@ func (c *Cache) setToRedis(ctx context.Context, key string, item *Item, ttl time
 	return c.rdb.Set(ctx, common.RedisKey(redisCachePrefix, key), data, ttl).Err()
 }
 
-// getFromCache retrieves item from cache (Redis or memory)
-func (c *Cache) getFromCache(ctx context.Context, key string) (*Item, bool) {
+// GetItem retrieves item from cache (Redis or memory)
+func (c *Cache) GetItem(ctx context.Context, key string) (*Item, bool) {
 	// Try Redis first if available
 	if c.rdb != nil {
 		item, err := c.getFromRedis(ctx, key)
@@ -223,8 +228,8 @@ func (c *Cache) getFromCache(ctx context.Context, key string) (*Item, bool) {
 	return nil, false
 }
 
-// setToCache stores item in cache (Redis and/or memory)
-func (c *Cache) setToCache(ctx context.Context, key string, item Item, ttl time.Duration) {
+// SetItem stores item in cache (Redis and/or memory)
+func (c *Cache) SetItem(ctx context.Context, key string, item Item, ttl time.Duration) {
 	ttl = jitterCacheTTL(ttl)
 
 	// Set to Redis if available
@@ -273,7 +278,7 @@ func (c *Cache) ConvertRequest(
 
 	// Check cache
 	ctx := req.Context()
-	if item, ok := c.getFromCache(ctx, cacheKey); ok {
+	if item, ok := c.GetItem(ctx, cacheKey); ok {
 		setCacheHit(meta, item)
 		return adaptor.ConvertResult{}, nil
 	}
@@ -336,7 +341,8 @@ func (rw *responseWriter) WriteString(s string) (int, error) {
 	return rw.ResponseWriter.WriteString(s)
 }
 
-func (c *Cache) writeCacheHeader(ctx *gin.Context, pluginConfig *Config, value string) {
+// WriteCacheHeader sets the cache status header when the config asks for it
+func WriteCacheHeader(ctx *gin.Context, pluginConfig *Config, value string) {
 	if pluginConfig.AddCacheHitHeader {
 		header := pluginConfig.CacheHitHeader
 		if header == "" {
@@ -347,6 +353,54 @@ func (c *Cache) writeCacheHeader(ctx *gin.Context, pluginConfig *Config, value s
 	}
 }
 
+// WriteItem replays a cached response to the client with the hit header
+func WriteItem(ctx *gin.Context, pluginConfig *Config, item *Item) {
+	// Restore headers from cache
+	for k, v := range item.Header {
+		for _, val := range v {
+			ctx.Header(k, val)
+		}
+	}
+
+	// Override specific headers
+	ctx.Header("Content-Type", item.Header["Content-Type"][0])
+	ctx.Header("Content-Length", strconv.Itoa(len(item.Body)))
+	WriteCacheHeader(ctx, pluginConfig, "hit")
+	_, _ = ctx.Writer.Write(item.Body)
+}
+
+// CaptureResponse records the response written to ctx, the returned function restores
+// the writer and returns the recorded item, or nil when the response can't be cached
+func CaptureResponse(ctx *gin.Context, maxSize int) func(failed bool, usage model.Usage) *Item {
+	buf := getBuffer()
+
+	rw := &responseWriter{
+		ResponseWriter: ctx.Writer,
+		maxSize:        maxSize,
+		cacheBody:      buf,
+	}
+
+	ctx.Writer = rw
+
+	return func(failed bool, usage model.Usage) *Item {
+		defer putBuffer(buf)
+
+		ctx.Writer = rw.ResponseWriter
+		if failed ||
+			rw.overflow ||
+			rw.cacheBody.Len() == 0 {
+			return nil
+		}
+
+		// Convert http.Header to map[string][]string for JSON serialization
+		return &Item{
+			Body:   bytes.Clone(rw.cacheBody.Bytes()),
+			Header: maps.Clone(rw.Header()),
+			Usage:  usage,
+		}
+	}
+}
+
 // DoResponse handles the response processing phase
 func (c *Cache) DoResponse(
 	meta *meta.Meta,
@@ -367,18 +421,7 @@ func (c *Cache) DoResponse(
 			return do.DoResponse(meta, store, ctx, resp)
 		}
 
-		// Restore headers from cache
-		for k, v := range item.Header {
-			for _, val := range v {
-				ctx.Header(k, val)
-			}
-		}
-
-		// Override specific headers
-		ctx.Header("Content-Type", item.Header["Content-Type"][0])
-		ctx.Header("Content-Length", strconv.Itoa(len(item.Body)))
-		c.writeCacheHeader(ctx, pluginConfig, "hit")
-		_, _ = ctx.Writer.Write(item.Body)
+		WriteItem(ctx, pluginConfig, item)
 
 		return adaptor.DoResponseResult{Usage: item.Usage}, nil
 	}
@@ -387,39 +430,18 @@ func (c *Cache) DoResponse(
 		return do.DoResponse(meta, store, ctx, resp)
 	}
 
-	c.writeCacheHeader(ctx, pluginConfig, "miss")
+	WriteCacheHeader(ctx, pluginConfig, "miss")
 
 	// Set up response capture for caching
-	buf := getBuffer()
-	defer putBuffer(buf)
-
-	rw := &responseWriter{
-		ResponseWriter: ctx.Writer,
-		maxSize:        pluginConfig.ItemMaxSize,
-		cacheBody:      buf,
-	}
-
-	ctx.Writer = rw
+	finish := CaptureResponse(ctx, pluginConfig.ItemMaxSize)
 	defer func() {
-		ctx.Writer = rw.ResponseWriter
-		if adapterErr != nil ||
-			rw.overflow ||
-			rw.cacheBody.Len() == 0 {
+		item := finish(adapterErr != nil, result.Usage)
+		if item == nil {
 			return
 		}
 
-		// Convert http.Header to map[string][]string for JSON serialization
-		headerMap := maps.Clone(rw.Header())
-
-		// Store in cache
-		item := Item{
-			Body:   bytes.Clone(rw.cacheBody.Bytes()),
-			Header: headerMap,
-			Usage:  result.Usage,
-		}
-
 		ttl := time.Duration(pluginConfig.TTL) * time.Second
-		c.setToCache(ctx.Request.Context(), getCacheKey(meta), item, ttl)
+		c.SetItem(ctx.Request.Context(), getCacheKey(meta), *item, ttl)
 	}()
 
 	return do.DoResponse(meta, store, ctx, resp)
@@ -0,0 +1,49 @@
+package guardrails
+
+const PluginName = "guardrails"
+
+// Action is what the plugin does with a match
+type Action string
+
+const (
+	// ActionRedact replaces the match with the replacement before the request is sent
+	ActionRedact Action = "redact"
+	// ActionReject rejects the request
+	ActionReject Action = "reject"
+	// ActionAudit only records the match in the log metadata
+	ActionAudit Action = "audit"
+)
+
+// Built-in detectors
+const (
+	DetectorEmail  = "email"
+	DetectorPhone  = "phone"
+	DetectorIDCard = "id_card"
+	DetectorAPIKey = "api_key"
+)
+
+// BlocklistRuleName is the name of the blocklist in the violations
+const BlocklistRuleName = "blocklist"
+
+type Config struct {
+	Enable bool `json:"enable"`
+	// Action is the action of the built-in detectors and the rules without an
+	// action, default is redact
+	Action Action `json:"action,omitempty"`
+	// Detectors are the enabled built-in detectors, default is all of them
+	Detectors []string `json:"detectors,omitempty"`
+	// Rules are the custom regexes
+	Rules []Rule `json:"rules,omitempty"`
+	// Blocklist are the words matched case-insensitively
+	Blocklist []string `json:"blocklist,omitempty"`
+	// BlocklistAction is the action of the blocklist, default is reject
+	BlocklistAction Action `json:"blocklist_action,omitempty"`
+}
+
+// Rule is a custom regex rule, the pattern uses the RE2 syntax
+type Rule struct {
+	Name        string `json:"name"`
+	Pattern     string `json:"pattern"`
+	Action      Action `json:"action,omitempty"`
+	Replacement string `json:"replacement,omitempty"`
+}
@@ -0,0 +1,249 @@
+// Package guardrails masks or rejects the sensitive content of the prompts
+// before the requests are sent to the upstream
+package guardrails
+
+import (
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bytedance/sonic"
+	"github.com/gin-gonic/gin"
+	"github.com/labring/aiproxy/core/common"
+	"github.com/labring/aiproxy/core/relay/adaptor"
+	"github.com/labring/aiproxy/core/relay/meta"
+	"github.com/labring/aiproxy/core/relay/mode"
+	relaymodel "github.com/labring/aiproxy/core/relay/model"
+	"github.com/labring/aiproxy/core/relay/plugin"
+	"github.com/labring/aiproxy/core/relay/plugin/noop"
+	"github.com/labring/aiproxy/core/relay/utils"
+	gcache "github.com/patrickmn/go-cache"
+)
+
+var _ plugin.Plugin = (*Guardrails)(nil)
+
+const guardrailsViolations = "guardrails_violations"
+
+// ErrorTypeGuardrails is the error type of the rejected requests
+const ErrorTypeGuardrails = "guardrails_violation"
+
+const (
+	scannerCacheTTL     = 10 * time.Minute
+	scannerCacheCleanup = 20 * time.Minute
+)
+
+// scanRoots are the top level keys that hold the prompts of each mode
+var scanRoots = map[mode.Mode][]string{
+	mode.ChatCompletions: {"messages"},
+	mode.Completions:     {"prompt"},
+	mode.Anthropic:       {"system", "messages"},
+	mode.Gemini:          {"systemInstruction", "contents"},
+	mode.Responses:       {"instructions", "input"},
+}
+
+// Guardrails scans the prompts with the built-in detectors, the custom regexes
+// and the blocklist, the matches are redacted, rejected or only audited
+type Guardrails struct {
+	noop.Noop
+	configCache utils.PluginConfigCache[Config]
+	scanners    *gcache.Cache
+}
+
+// NewGuardrailsPlugin creates a new guardrails plugin
+func NewGuardrailsPlugin() *Guardrails {
+	return &Guardrails{
+		scanners: gcache.New(scannerCacheTTL, scannerCacheCleanup),
+	}
+}
+
+// GetViolations returns the violations found in the request
+func GetViolations(meta *meta.Meta) []Violation {
+	v, ok := meta.Get(guardrailsViolations)
+	if !ok {
+		return nil
+	}
+
+	violations, _ := v.([]Violation)
+
+	return violations
+}
+
+// LogMetadata returns the violations of the request as log metadata
+func LogMetadata(meta *meta.Meta) map[string]string {
+	violations := GetViolations(meta)
+	if len(violations) == 0 {
+		return nil
+	}
+
+	action := ActionAudit
+	parts := make([]string, 0, len(violations))
+
+	for _, v := range violations {
+		switch {
+		case v.Action == ActionReject:
+			action = ActionReject
+		case v.Action == ActionRedact && action != ActionReject:
+			action = ActionRedact
+		}
+
+		parts = append(parts, v.Name+"="+strconv.Itoa(v.Count))
+	}
+
+	return map[string]string{
+		"guardrails_action":     string(action),
+		"guardrails_violations": strings.Join(parts, ","),
+	}
+}
+
+// getScanner returns the compiled scanner of the config, the scanners are
+// cached by the config so the regexes are not compiled for every request
+func (p *Guardrails) getScanner(config Config) (*scanner, error) {
+	key, err := sonic.MarshalString(config)
+	if err != nil {
+		return nil, err
+	}
+
+	if v, ok := p.scanners.Get(key); ok {
+		if s, ok := v.(*scanner); ok {
+			return s, nil
+		}
+	}
+
+	s, err := newScanner(config)
+	if err != nil {
+		return nil, err
+	}
+
+	p.scanners.SetDefault(key, s)
+
+	return s, nil
+}
+
+// ConvertRequest scans the request body before it is converted, the
+// redacted body is passed to the next plugins and the adaptor
+func (p *Guardrails) ConvertRequest(
+	meta *meta.Meta,
+	store adaptor.Store,
+	req *http.Request,
+	do adaptor.ConvertRequest,
+) (adaptor.ConvertResult, error) {
+	roots, ok := scanRoots[meta.Mode]
+	if !ok {
+		return do.ConvertRequest(meta, store, req)
+	}
+
+	config, err := p.configCache.Load(meta, PluginName, Config{})
+	if err != nil || !config.Enable {
+		return do.ConvertRequest(meta, store, req)
+	}
+
+	// an invalid config fails closed, the prompts must not leave unchecked
+	s, err := p.getScanner(config)
+	if err != nil {
+		return adaptor.ConvertResult{}, relaymodel.WrapperErrorWithMessage(
+			meta.Mode,
+			http.StatusInternalServerError,
+			"invalid guardrails config: "+err.Error(),
+			relaymodel.WithType(ErrorTypeGuardrails),
+		)
+	}
+
+	body, err := common.GetRequestBodyReusable(req)
+	if err != nil {
+		return adaptor.ConvertResult{}, err
+	}
+
+	// a body that can not be scanned fails closed like an invalid config
+	result, err := s.scanBody(body, roots)
+	if err != nil {
+		return adaptor.ConvertResult{}, relaymodel.WrapperErrorWithMessage(
+			meta.Mode,
+			http.StatusBadRequest,
+			"request can not be checked by guardrails: "+err.Error(),
+			relaymodel.WithType(ErrorTypeGuardrails),
+		)
+	}
+
+	if len(result.violations) > 0 {
+		meta.Set(guardrailsViolations, result.violations)
+	}
+
+	if result.rejected {
+		return adaptor.ConvertResult{}, relaymodel.WrapperErrorWithMessage(
+			meta.Mode,
+			http.StatusBadRequest,
+			"request rejected by guardrails: "+rejectedNames(result.violations),
+			relaymodel.WithType(ErrorTypeGuardrails),
+		)
+	}
+
+	if result.body == nil {
+		return do.ConvertRequest(meta, store, req)
+	}
+
+	common.SetRequestBody(req, result.body)
+	defer func() {
+		common.SetRequestBody(req, body)
+	}()
+
+	return do.ConvertRequest(meta, store, req)
+}
+
+// CheckToolResults scans the results of the mcp tool calls like the prompts,
+// they are appended to the request after it passed this plugin
+func (p *Guardrails) CheckToolResults(
+	_ *gin.Context,
+	meta *meta.Meta,
+	_ adaptor.Store,
+	outputs []string,
+) ([]string, error) {
+	config, err := p.configCache.Load(meta, PluginName, Config{})
+	if err != nil || !config.Enable {
+		return outputs, nil
+	}
+
+	s, err := p.getScanner(config)
+	if err != nil {
+		return nil, relaymodel.WrapperErrorWithMessage(
+			meta.Mode,
+			http.StatusInternalServerError,
+			"invalid guardrails config: "+err.Error(),
+			relaymodel.WithType(ErrorTypeGuardrails),
+		)
+	}
+
+	result := &scanResult{violations: slices.Clone(GetViolations(meta))}
+
+	checked := make([]string, len(outputs))
+	for i, output := range outputs {
+		checked[i], _ = s.scanText(output, result)
+	}
+
+	if len(result.violations) > 0 {
+		meta.Set(guardrailsViolations, result.violations)
+	}
+
+	if result.rejected {
+		return nil, relaymodel.WrapperErrorWithMessage(
+			meta.Mode,
+			http.StatusBadRequest,
+			"tool result rejected by guardrails: "+rejectedNames(result.violations),
+			relaymodel.WithType(ErrorTypeGuardrails),
+		)
+	}
+
+	return checked, nil
+}
+
+func rejectedNames(violations []Violation) string {
+	names := make([]string, 0, len(violations))
+	for _, v := range violations {
+		if v.Action == ActionReject {
+			names = append(names, v.Name)
+		}
+	}
+
+	return strings.Join(names, ", ")
+}
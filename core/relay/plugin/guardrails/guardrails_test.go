@@ -0,0 +1,330 @@
+package guardrails_test
+
+import (
+	"bytes"
+	"net/http"
+	"testing"
+
+	"github.com/bytedance/sonic"
+	"github.com/labring/aiproxy/core/common"
+	"github.com/labring/aiproxy/core/model"
+	"github.com/labring/aiproxy/core/relay/adaptor"
+	"github.com/labring/aiproxy/core/relay/meta"
+	"github.com/labring/aiproxy/core/relay/mode"
+	"github.com/labring/aiproxy/core/relay/plugin/guardrails"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type captureConvert struct {
+	body []byte
+}
+
+func (c *captureConvert) ConvertRequest(
+	_ *meta.Meta,
+	_ adaptor.Store,
+	req *http.Request,
+) (adaptor.ConvertResult, error) {
+	body, err := common.GetRequestBodyReusable(req)
+	if err != nil {
+		return adaptor.ConvertResult{}, err
+	}
+
+	c.body = bytes.Clone(body)
+
+	return adaptor.ConvertResult{}, nil
+}
+
+func newMeta(m mode.Mode, config map[string]any) *meta.Meta {
+	return meta.NewMeta(nil, m, "gpt-4o", model.ModelConfig{
+		Model: "gpt-4o",
+		Plugin: map[string]map[string]any{
+			guardrails.PluginName: config,
+		},
+	})
+}
+
+func convert(
+	t *testing.T,
+	m *meta.Meta,
+	body any,
+) (*captureConvert, error) {
+	t.Helper()
+
+	data, err := sonic.Marshal(body)
+	require.NoError(t, err)
+
+	return convertRaw(t, m, data)
+}
+
+func convertRaw(
+	t *testing.T,
+	m *meta.Meta,
+	data []byte,
+) (*captureConvert, error) {
+	t.Helper()
+
+	req, err := http.NewRequestWithContext(
+		t.Context(),
+		http.MethodPost,
+		"http://localhost/v1/chat/completions",
+		bytes.NewReader(data),
+	)
+	require.NoError(t, err)
+	req.Header.Set("Content-Type", "application/json")
+
+	capture := &captureConvert{}
+	_, err = guardrails.NewGuardrailsPlugin().ConvertRequest(m, nil, req, capture)
+
+	return capture, err
+}
+
+func TestRedactChatCompletions(t *testing.T) {
+	m := newMeta(mode.ChatCompletions, map[string]any{"enable": true})
+
+	capture, err := convert(t, m, map[string]any{
+		"model": "gpt-4o",
+		"messages": []map[string]any{
+			{"role": "system", "content": "mail admin@example.com for help"},
+			{"role": "user", "content": []map[string]any{
+				{"type": "text", "text": "my phone is 13812345678, key sk-abcdefghijklmnopqrstuvwxyz"},
+				{"type": "image_url", "image_url": map[string]any{"url": "https://example.com/a.png"}},
+			}},
+		},
+	})
+	require.NoError(t, err)
+
+	var got struct {
+		Model    string `json:"model"`
+		Messages []struct {
+			Content any `json:"content"`
+		} `json:"messages"`
+	}
+	require.NoError(t, sonic.Unmarshal(capture.body, &got))
+
+	assert.Equal(t, "gpt-4o", got.Model)
+	assert.Equal(t, "mail [REDACTED_EMAIL] for help", got.Messages[0].Content)
+
+	parts, ok := got.Messages[1].Content.([]any)
+	require.True(t, ok)
+	assert.Equal(
+		t,
+		"my phone is [REDACTED_PHONE], key [REDACTED_API_KEY]",
+		parts[0].(map[string]any)["text"],
+	)
+	assert.Equal(
+		t,
+		"https://example.com/a.png",
+		parts[1].(map[string]any)["image_url"].(map[string]any)["url"],
+	)
+
+	assert.Equal(t, map[string]string{
+		"guardrails_action":     "redact",
+		"guardrails_violations": "email=1,api_key=1,phone=1",
+	}, guardrails.LogMetadata(m))
+}
+
+func TestRejectBlocklistAnthropic(t *testing.T) {
+	m := newMeta(mode.Anthropic, map[string]any{
+		"enable":    true,
+		"blocklist": []string{"Project Phoenix"},
+	})
+
+	capture, err := convert(t, m, map[string]any{
+		"model":  "claude",
+		"system": "internal",
+		"messages": []map[string]any{
+			{"role": "user", "content": []map[string]any{
+				{"type": "text", "text": "tell me about project phoenix"},
+			}},
+		},
+	})
+	require.Error(t, err)
+	assert.Nil(t, capture.body)
+
+	relayErr, ok := err.(adaptor.Error)
+	require.True(t, ok)
+	assert.Equal(t, http.StatusBadRequest, relayErr.StatusCode())
+	assert.Equal(t, "reject", guardrails.LogMetadata(m)["guardrails_action"])
+}
+
+func TestAuditCustomRuleGemini(t *testing.T) {
+	m := newMeta(mode.Gemini, map[string]any{
+		"enable":    true,
+		"detectors": []string{guardrails.DetectorEmail},
+		"rules":     []map[string]any{{"name": "ticket", "pattern": `TICKET-\d+`, "action": "audit"}},
+	})
+
+	body := map[string]any{
+		"systemInstruction": map[string]any{
+			"parts": []map[string]any{{"text": "reply to a@b.io"}},
+		},
+		"contents": []map[string]any{
+			{"role": "user", "parts": []map[string]any{{"text": "see TICKET-42, call 13812345678"}}},
+		},
+	}
+
+	capture, err := convert(t, m, body)
+	require.NoError(t, err)
+
+	node, err := sonic.Get(capture.body, "systemInstruction", "parts", 0, "text")
+	require.NoError(t, err)
+	text, _ := node.String()
+	assert.Equal(t, "reply to [REDACTED_EMAIL]", text)
+
+	// the phone detector is disabled and the ticket rule only audits
+	node, err = sonic.Get(capture.body, "contents", 0, "parts", 0, "text")
+	require.NoError(t, err)
+	text, _ = node.String()
+	assert.Equal(t, "see TICKET-42, call 13812345678", text)
+
+	assert.Equal(t, []guardrails.Violation{
+		{Name: guardrails.DetectorEmail, Action: guardrails.ActionRedact, Count: 1},
+		{Name: "ticket", Action: guardrails.ActionAudit, Count: 1},
+	}, guardrails.GetViolations(m))
+}
+
+func TestRedactResponsesIDCard(t *testing.T) {
+	m := newMeta(mode.Responses, map[string]any{"enable": true})
+
+	capture, err := convert(t, m, map[string]any{
+		"model":        "gpt-4o",
+		"instructions": "be brief",
+		"input": []map[string]any{
+			{"role": "user", "content": []map[string]any{
+				// the second number fails the check code
+				{"type": "input_text", "text": "ids 11010519491231002X and 110105194912310021"},
+			}},
+		},
+	})
+	require.NoError(t, err)
+
+	node, err := sonic.Get(capture.body, "input", 0, "content", 0, "text")
+	require.NoError(t, err)
+	text, _ := node.String()
+	assert.Equal(t, "ids [REDACTED_ID_CARD] and 110105194912310021", text)
+}
+
+func TestDisabledAndInvalidConfig(t *testing.T) {
+	m := newMeta(mode.ChatCompletions, map[string]any{"enable": false})
+
+	body := map[string]any{
+		"messages": []map[string]any{{"role": "user", "content": "admin@example.com"}},
+	}
+
+	capture, err := convert(t, m, body)
+	require.NoError(t, err)
+	assert.Contains(t, string(capture.body), "admin@example.com")
+	assert.Nil(t, guardrails.LogMetadata(m))
+
+	m = newMeta(mode.ChatCompletions, map[string]any{
+		"enable": true,
+		"rules":  []map[string]any{{"name": "bad", "pattern": "("}},
+	})
+
+	_, err = convert(t, m, body)
+	require.Error(t, err)
+}
+
+func TestScanToolCallArguments(t *testing.T) {
+	m := newMeta(mode.ChatCompletions, map[string]any{
+		"enable":    true,
+		"blocklist": []string{"forbidden"},
+	})
+
+	_, err := convert(t, m, map[string]any{
+		"model": "gpt-4o",
+		"messages": []map[string]any{
+			{"role": "assistant", "tool_calls": []map[string]any{
+				{"id": "call_1", "type": "function", "function": map[string]any{
+					"name":      "search",
+					"arguments": `{"query":"forbidden topic"}`,
+				}},
+			}},
+		},
+	})
+	require.Error(t, err)
+
+	m = newMeta(mode.Anthropic, map[string]any{"enable": true})
+
+	capture, err := convert(t, m, map[string]any{
+		"model": "claude",
+		"messages": []map[string]any{
+			{"role": "assistant", "content": []map[string]any{
+				{"type": "tool_use", "id": "t1", "name": "send", "input": map[string]any{
+					"to": map[string]any{"address": "admin@example.com"},
+				}},
+			}},
+		},
+	})
+	require.NoError(t, err)
+	assert.NotContains(t, string(capture.body), "admin@example.com")
+	assert.Contains(t, string(capture.body), "[REDACTED_EMAIL]")
+}
+
+func TestScanGeminiFunctionResponse(t *testing.T) {
+	m := newMeta(mode.Gemini, map[string]any{"enable": true})
+
+	capture, err := convert(t, m, map[string]any{
+		"contents": []map[string]any{
+			{"role": "function", "parts": []map[string]any{
+				{"functionResponse": map[string]any{
+					"name": "lookup_user",
+					"response": map[string]any{
+						"user": map[string]any{"email": "admin@example.com"},
+					},
+				}},
+			}},
+		},
+	})
+	require.NoError(t, err)
+
+	node, err := sonic.Get(
+		capture.body,
+		"contents", 0, "parts", 0, "functionResponse", "response", "user", "email",
+	)
+	require.NoError(t, err)
+	text, _ := node.String()
+	assert.Equal(t, "[REDACTED_EMAIL]", text)
+}
+
+func TestCheckToolResults(t *testing.T) {
+	p := guardrails.NewGuardrailsPlugin()
+
+	m := newMeta(mode.ChatCompletions, map[string]any{
+		"enable":    true,
+		"blocklist": []string{"forbidden"},
+	})
+
+	outputs, err := p.CheckToolResults(nil, m, nil, []string{"owner admin@example.com", "ok"})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"owner [REDACTED_EMAIL]", "ok"}, outputs)
+
+	_, err = p.CheckToolResults(nil, m, nil, []string{"a forbidden topic"})
+	require.ErrorContains(t, err, "tool result rejected by guardrails")
+
+	assert.Equal(t, []guardrails.Violation{
+		{Name: guardrails.DetectorEmail, Action: guardrails.ActionRedact, Count: 1},
+		{Name: guardrails.BlocklistRuleName, Action: guardrails.ActionReject, Count: 1},
+	}, guardrails.GetViolations(m))
+}
+
+func TestScanFailsClosed(t *testing.T) {
+	m := newMeta(mode.ChatCompletions, map[string]any{"enable": true})
+
+	capture, err := convertRaw(t, m, []byte(`{"model":"gpt-4o","messages":[{"role":"user","content":`))
+	require.Error(t, err)
+	assert.Nil(t, capture.body)
+
+	content := any("admin@example.com")
+	for range 20 {
+		content = []any{map[string]any{"type": "text", "content": content}}
+	}
+
+	capture, err = convert(t, m, map[string]any{
+		"model":    "gpt-4o",
+		"messages": []map[string]any{{"role": "user", "content": content}},
+	})
+	require.Error(t, err)
+	assert.Nil(t, capture.body)
+}
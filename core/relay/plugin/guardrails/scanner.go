@@ -0,0 +1,435 @@
+package guardrails
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/bytedance/sonic/ast"
+	"github.com/labring/aiproxy/core/common"
+)
+
+// maxScanDepth limits the nesting of the scanned content, a deeper request is
+// rejected as it can not be checked
+const maxScanDepth = 16
+
+var errScanTooDeep = fmt.Errorf("content is nested deeper than %d levels", maxScanDepth)
+
+type builtinDetector struct {
+	pattern  *regexp.Regexp
+	validate func(match string) bool
+}
+
+var builtinDetectors = map[string]builtinDetector{
+	DetectorAPIKey: {
+		pattern: regexp.MustCompile(
+			`\b(?:sk-(?:ant-|proj-)?[A-Za-z0-9_\-]{20,}|AKIA[0-9A-Z]{16}|gh[pousr]_[A-Za-z0-9]{36,}|AIza[0-9A-Za-z_\-]{35}|xox[abprs]-[A-Za-z0-9\-]{10,})`,
+		),
+	},
+	DetectorIDCard: {
+		pattern: regexp.MustCompile(
+			`\b[1-9]\d{5}(?:18|19|20)\d{2}(?:0[1-9]|1[0-2])(?:0[1-9]|[12]\d|3[01])\d{3}[\dXx]\b|\b\d{3}-\d{2}-\d{4}\b`,
+		),
+		validate: validateIDCard,
+	},
+	DetectorEmail: {
+		pattern: regexp.MustCompile(
+			`[A-Za-z0-9._%+\-]+@[A-Za-z0-9\-]+(?:\.[A-Za-z0-9\-]+)*\.[A-Za-z]{2,}`,
+		),
+	},
+	DetectorPhone: {
+		pattern: regexp.MustCompile(
+			`(?:\+?\b86[\-\s]?)?\b1[3-9]\d{9}\b|\+\d{1,3}[\-\s]?\d{2,4}[\-\s]?\d{3,4}[\-\s]?\d{3,4}\b|\b\d{3}[\-.\s]\d{3}[\-.\s]\d{4}\b`,
+		),
+	},
+}
+
+// builtinDetectorOrder runs the api keys first as they can contain the other patterns
+var builtinDetectorOrder = []string{
+	DetectorAPIKey,
+	DetectorIDCard,
+	DetectorEmail,
+	DetectorPhone,
+}
+
+var idCardWeights = [17]int{7, 9, 10, 5, 8, 4, 2, 1, 6, 3, 7, 9, 10, 5, 8, 4, 2}
+
+const idCardCheckCodes = "10X98765432"
+
+// validateIDCard verifies the check code of the 18 digits resident id card numbers
+func validateIDCard(match string) bool {
+	if len(match) != 18 {
+		return true
+	}
+
+	sum := 0
+	for i, weight := range idCardWeights {
+		sum += int(match[i]-'0') * weight
+	}
+
+	return idCardCheckCodes[sum%11] == strings.ToUpper(match[17:])[0]
+}
+
+type detector struct {
+	name        string
+	pattern     *regexp.Regexp
+	validate    func(match string) bool
+	action      Action
+	replacement string
+}
+
+// Violation is the matches of a detector in a request
+type Violation struct {
+	Name   string `json:"name"`
+	Action Action `json:"action"`
+	Count  int    `json:"count"`
+}
+
+type scanner struct {
+	detectors []detector
+}
+
+func defaultReplacement(name string) string {
+	return "[REDACTED_" + strings.ToUpper(name) + "]"
+}
+
+func normalizeAction(action, defaultAction Action) (Action, error) {
+	switch action {
+	case "":
+		return defaultAction, nil
+	case ActionRedact, ActionReject, ActionAudit:
+		return action, nil
+	default:
+		return "", fmt.Errorf("unknown action: %s", action)
+	}
+}
+
+func newScanner(config Config) (*scanner, error) {
+	action, err := normalizeAction(config.Action, ActionRedact)
+	if err != nil {
+		return nil, err
+	}
+
+	enabled := config.Detectors
+	if len(enabled) == 0 {
+		enabled = builtinDetectorOrder
+	}
+
+	s := &scanner{}
+
+	for _, name := range builtinDetectorOrder {
+		if !slices.Contains(enabled, name) {
+			continue
+		}
+
+		builtin := builtinDetectors[name]
+		s.detectors = append(s.detectors, detector{
+			name:        name,
+			pattern:     builtin.pattern,
+			validate:    builtin.validate,
+			action:      action,
+			replacement: defaultReplacement(name),
+		})
+	}
+
+	for _, name := range enabled {
+		if _, ok := builtinDetectors[name]; !ok {
+			return nil, fmt.Errorf("unknown detector: %s", name)
+		}
+	}
+
+	for _, rule := range config.Rules {
+		if rule.Name == "" {
+			return nil, errors.New("rule name is required")
+		}
+
+		pattern, err := regexp.Compile(rule.Pattern)
+		if err != nil {
+			return nil, fmt.Errorf("rule %s: %w", rule.Name, err)
+		}
+
+		ruleAction, err := normalizeAction(rule.Action, action)
+		if err != nil {
+			return nil, fmt.Errorf("rule %s: %w", rule.Name, err)
+		}
+
+		replacement := rule.Replacement
+		if replacement == "" {
+			replacement = defaultReplacement(rule.Name)
+		}
+
+		s.detectors = append(s.detectors, detector{
+			name:        rule.Name,
+			pattern:     pattern,
+			action:      ruleAction,
+			replacement: replacement,
+		})
+	}
+
+	words := make([]string, 0, len(config.Blocklist))
+	for _, word := range config.Blocklist {
+		if word = strings.TrimSpace(word); word != "" {
+			words = append(words, regexp.QuoteMeta(word))
+		}
+	}
+
+	if len(words) > 0 {
+		blocklistAction, err := normalizeAction(config.BlocklistAction, ActionReject)
+		if err != nil {
+			return nil, fmt.Errorf("blocklist: %w", err)
+		}
+
+		s.detectors = append(s.detectors, detector{
+			name:        BlocklistRuleName,
+			pattern:     regexp.MustCompile(`(?i)(?:` + strings.Join(words, "|") + `)`),
+			action:      blocklistAction,
+			replacement: defaultReplacement(BlocklistRuleName),
+		})
+	}
+
+	return s, nil
+}
+
+// scanResult is the result of a scan, body is nil when nothing was redacted
+type scanResult struct {
+	body       []byte
+	violations []Violation
+	rejected   bool
+	modified   bool
+}
+
+func (r *scanResult) record(d *detector) {
+	if d.action == ActionReject {
+		r.rejected = true
+	}
+
+	for i := range r.violations {
+		if r.violations[i].Name == d.name {
+			r.violations[i].Count++
+			return
+		}
+	}
+
+	r.violations = append(r.violations, Violation{
+		Name:   d.name,
+		Action: d.action,
+		Count:  1,
+	})
+}
+
+func (s *scanner) scanText(text string, result *scanResult) (string, bool) {
+	changed := false
+
+	for i := range s.detectors {
+		d := &s.detectors[i]
+
+		text = d.pattern.ReplaceAllStringFunc(text, func(match string) string {
+			if d.validate != nil && !d.validate(match) {
+				return match
+			}
+
+			result.record(d)
+
+			if d.action != ActionRedact {
+				return match
+			}
+
+			changed = true
+
+			return d.replacement
+		})
+	}
+
+	return text, changed
+}
+
+// contentKeys are the keys of the text in the messages, parts and items of
+// the chat, anthropic, gemini and responses requests, including the tool
+// calls and their arguments
+var contentKeys = []string{
+	"content",
+	"text",
+	"parts",
+	"output",
+	"tool_calls",
+	"function",
+	"functionCall",
+	"functionResponse",
+	"arguments",
+}
+
+// argumentKeys are the keys of the tool call arguments objects of the
+// anthropic tool_use blocks and the gemini function calls and responses, all
+// their values are scanned as the keys are defined by the tools
+var argumentKeys = []string{"input", "args", "response"}
+
+// scanBody scans the text fields of the request, roots are the top level keys
+// that hold the prompts of the mode, an invalid or too deep body is an error
+func (s *scanner) scanBody(body []byte, roots []string) (*scanResult, error) {
+	node, err := common.GetJSONNodeNoCopy(body)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &scanResult{}
+
+	for _, key := range roots {
+		if err := s.scanField(&node, key, result, 0); err != nil {
+			return nil, err
+		}
+	}
+
+	if result.modified {
+		result.body, err = node.MarshalJSON()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return result, nil
+}
+
+func (s *scanner) scanField(parent *ast.Node, key string, result *scanResult, depth int) error {
+	return s.scanValue(parent, key, result, depth, false)
+}
+
+// scanValue scans the value of the key, all scans every string of the nested
+// objects instead of only the content keys
+func (s *scanner) scanValue(
+	parent *ast.Node,
+	key string,
+	result *scanResult,
+	depth int,
+	all bool,
+) error {
+	// a missing key is nil, an invalid value is an error node
+	node := parent.Get(key)
+	if node == nil {
+		return nil
+	}
+
+	if err := node.Check(); err != nil {
+		return err
+	}
+
+	if !node.Exists() {
+		return nil
+	}
+
+	switch node.TypeSafe() {
+	case ast.V_STRING:
+		text, err := node.String()
+		if err != nil {
+			return err
+		}
+
+		redacted, changed := s.scanText(text, result)
+		if !changed {
+			return nil
+		}
+
+		result.modified = true
+		_, err = parent.Set(key, ast.NewString(redacted))
+
+		return err
+	case ast.V_ARRAY:
+		return s.scanArray(node, result, depth+1, all)
+	case ast.V_OBJECT:
+		return s.scanObject(node, result, depth+1, all)
+	case ast.V_ERROR:
+		return node.Check()
+	default:
+		return nil
+	}
+}
+
+func (s *scanner) scanArray(node *ast.Node, result *scanResult, depth int, all bool) error {
+	if depth > maxScanDepth {
+		return errScanTooDeep
+	}
+
+	var scanErr error
+
+	err := node.ForEach(func(_ ast.Sequence, item *ast.Node) bool {
+		switch item.TypeSafe() {
+		case ast.V_STRING:
+			text, err := item.String()
+			if err != nil {
+				scanErr = err
+				return false
+			}
+
+			redacted, changed := s.scanText(text, result)
+			if changed {
+				result.modified = true
+				*item = ast.NewString(redacted)
+			}
+		case ast.V_ARRAY:
+			if all {
+				scanErr = s.scanArray(item, result, depth+1, all)
+			}
+		case ast.V_OBJECT:
+			scanErr = s.scanObject(item, result, depth+1, all)
+		case ast.V_ERROR:
+			scanErr = item.Check()
+		}
+
+		return scanErr == nil
+	})
+	if err != nil {
+		return err
+	}
+
+	return scanErr
+}
+
+func (s *scanner) scanObject(node *ast.Node, result *scanResult, depth int, all bool) error {
+	if depth > maxScanDepth {
+		return errScanTooDeep
+	}
+
+	if all {
+		keys, err := objectKeys(node)
+		if err != nil {
+			return err
+		}
+
+		for _, key := range keys {
+			if err := s.scanValue(node, key, result, depth, true); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	}
+
+	for _, key := range contentKeys {
+		if err := s.scanField(node, key, result, depth); err != nil {
+			return err
+		}
+	}
+
+	for _, key := range argumentKeys {
+		if err := s.scanValue(node, key, result, depth, true); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func objectKeys(node *ast.Node) ([]string, error) {
+	var keys []string
+
+	err := node.ForEach(func(path ast.Sequence, _ *ast.Node) bool {
+		if path.Key != nil {
+			keys = append(keys, *path.Key)
+		}
+
+		return true
+	})
+
+	return keys, err
+}
@@ -0,0 +1,319 @@
+package mcptools
+
+import (
+	"maps"
+
+	"github.com/gin-gonic/gin"
+	"github.com/labring/aiproxy/core/model"
+	"github.com/labring/aiproxy/core/relay/adaptor"
+	relaymodel "github.com/labring/aiproxy/core/relay/model"
+	"github.com/labring/aiproxy/core/relay/render"
+)
+
+// anthropicDialect is the format of the Anthropic messages
+type anthropicDialect struct{}
+
+func (anthropicDialect) prepare(request map[string]any, tools []toolDefinition) {
+	list, _ := request["tools"].([]any)
+	for _, tool := range tools {
+		list = append(list, map[string]any{
+			"name":         tool.Name,
+			"description":  tool.Description,
+			"input_schema": tool.Parameters,
+		})
+	}
+
+	request["tools"] = list
+}
+
+func anthropicContent(response map[string]any) []any {
+	content, _ := response["content"].([]any)
+	return content
+}
+
+func (anthropicDialect) toolCalls(response map[string]any) []toolCall {
+	var calls []toolCall
+
+	for _, v := range anthropicContent(response) {
+		block, _ := v.(map[string]any)
+		if block["type"] != "tool_use" {
+			continue
+		}
+
+		id, _ := block["id"].(string)
+		name, _ := block["name"].(string)
+
+		arguments := ""
+		if input, ok := block["input"]; ok && input != nil {
+			data, err := jsonAPI.Marshal(input)
+			if err == nil {
+				arguments = string(data)
+			}
+		}
+
+		calls = append(calls, toolCall{
+			ID:        id,
+			Name:      name,
+			Arguments: arguments,
+		})
+	}
+
+	return calls
+}
+
+func (anthropicDialect) appendResults(
+	request, response map[string]any,
+	calls []toolCall,
+	results []toolResult,
+) {
+	blocks := make([]any, 0, len(calls))
+	for i, call := range calls {
+		blocks = append(blocks, map[string]any{
+			"type":        "tool_result",
+			"tool_use_id": call.ID,
+			"content":     results[i].Output,
+			"is_error":    results[i].IsError,
+		})
+	}
+
+	messages, _ := request["messages"].([]any)
+	messages = append(messages,
+		map[string]any{
+			"role":    "assistant",
+			"content": anthropicContent(response),
+		},
+		map[string]any{
+			"role":    "user",
+			"content": blocks,
+		},
+	)
+
+	request["messages"] = messages
+}
+
+func (anthropicDialect) disableTools(request map[string]any) {
+	request["tool_choice"] = map[string]any{"type": "none"}
+}
+
+func (anthropicDialect) newOutput(
+	c *gin.Context,
+	servers []model.VirtualMCPServer,
+	stream bool,
+) output {
+	return &anthropicOutput{
+		c:       c,
+		servers: servers,
+		stream:  stream,
+	}
+}
+
+// anthropicOutput writes the tool calls of the rounds as the mcp_tool_use and
+// the mcp_tool_result blocks of the Anthropic mcp connector
+type anthropicOutput struct {
+	c       *gin.Context
+	servers []model.VirtualMCPServer
+	stream  bool
+	started bool
+	index   int
+	blocks  []any
+}
+
+// stepBlocks replaces the tool_use blocks of the turn by the mcp blocks
+func (o *anthropicOutput) stepBlocks(
+	response map[string]any,
+	calls []toolCall,
+	results []toolResult,
+) []any {
+	byID := resultsByID(calls, results)
+
+	content := anthropicContent(response)
+
+	blocks := make([]any, 0, len(content)+len(calls))
+	for _, v := range content {
+		block, _ := v.(map[string]any)
+		if block["type"] != "tool_use" {
+			blocks = append(blocks, v)
+			continue
+		}
+
+		id, _ := block["id"].(string)
+		name, _ := block["name"].(string)
+		result := byID[id]
+
+		blocks = append(blocks,
+			map[string]any{
+				"type":        "mcp_tool_use",
+				"id":          id,
+				"name":        name,
+				"server_name": serverName(o.servers, name),
+				"input":       block["input"],
+			},
+			map[string]any{
+				"type":        "mcp_tool_result",
+				"tool_use_id": id,
+				"is_error":    result.IsError,
+				"content": []any{
+					map[string]any{
+						"type": "text",
+						"text": result.Output,
+					},
+				},
+			},
+		)
+	}
+
+	return blocks
+}
+
+func (o *anthropicOutput) start(response map[string]any) {
+	if o.started {
+		return
+	}
+
+	o.started = true
+
+	startStream(o.c)
+
+	message := maps.Clone(response)
+
+	message["content"] = []any{}
+	message["stop_reason"] = nil
+	message["stop_sequence"] = nil
+
+	_ = render.ClaudeEventObjectData(o.c, "message_start", map[string]any{
+		"type":    "message_start",
+		"message": message,
+	})
+}
+
+func (o *anthropicOutput) event(event string, data map[string]any) {
+	data["type"] = event
+	_ = render.ClaudeEventObjectData(o.c, event, data)
+}
+
+// writeBlock writes a block as the start, the delta and the stop events
+func (o *anthropicOutput) writeBlock(v any) {
+	block, _ := v.(map[string]any)
+
+	index := o.index
+	o.index++
+
+	switch block["type"] {
+	case "text":
+		o.event("content_block_start", map[string]any{
+			"index":         index,
+			"content_block": map[string]any{"type": "text", "text": ""},
+		})
+		o.event("content_block_delta", map[string]any{
+			"index": index,
+			"delta": map[string]any{"type": "text_delta", "text": block["text"]},
+		})
+	case "thinking":
+		o.event("content_block_start", map[string]any{
+			"index":         index,
+			"content_block": map[string]any{"type": "thinking", "thinking": ""},
+		})
+		o.event("content_block_delta", map[string]any{
+			"index": index,
+			"delta": map[string]any{"type": "thinking_delta", "thinking": block["thinking"]},
+		})
+
+		if signature, ok := block["signature"].(string); ok && signature != "" {
+			o.event("content_block_delta", map[string]any{
+				"index": index,
+				"delta": map[string]any{"type": "signature_delta", "signature": signature},
+			})
+		}
+	case "tool_use", "mcp_tool_use":
+		start := maps.Clone(block)
+		start["input"] = map[string]any{}
+
+		o.event("content_block_start", map[string]any{
+			"index":         index,
+			"content_block": start,
+		})
+
+		input, err := jsonAPI.Marshal(block["input"])
+		if err == nil && block["input"] != nil {
+			o.event("content_block_delta", map[string]any{
+				"index": index,
+				"delta": map[string]any{"type": "input_json_delta", "partial_json": string(input)},
+			})
+		}
+	default:
+		o.event("content_block_start", map[string]any{
+			"index":         index,
+			"content_block": block,
+		})
+	}
+
+	o.event("content_block_stop", map[string]any{
+		"index": index,
+	})
+}
+
+func (o *anthropicOutput) step(response map[string]any, calls []toolCall, results []toolResult) {
+	blocks := o.stepBlocks(response, calls, results)
+	if !o.stream {
+		o.blocks = append(o.blocks, blocks...)
+		return
+	}
+
+	o.start(response)
+
+	for _, block := range blocks {
+		o.writeBlock(block)
+	}
+}
+
+func (o *anthropicOutput) finish(body []byte, response map[string]any, usage model.Usage) {
+	if !o.stream {
+		if len(o.blocks) == 0 {
+			writeJSON(o.c, body)
+			return
+		}
+
+		response["content"] = append(o.blocks, anthropicContent(response)...)
+		response["usage"] = relaymodel.ClaudeFromModelUsage(usage)
+
+		data, err := jsonAPI.Marshal(response)
+		if err != nil {
+			writeJSON(o.c, body)
+			return
+		}
+
+		writeJSON(o.c, data)
+
+		return
+	}
+
+	o.start(response)
+
+	for _, block := range anthropicContent(response) {
+		o.writeBlock(block)
+	}
+
+	o.event("message_delta", map[string]any{
+		"delta": map[string]any{
+			"stop_reason":   response["stop_reason"],
+			"stop_sequence": response["stop_sequence"],
+		},
+		"usage": relaymodel.ClaudeFromModelUsage(usage),
+	})
+	o.event("message_stop", map[string]any{})
+}
+
+func (o *anthropicOutput) fail(err adaptor.Error) bool {
+	if !o.stream || !o.started {
+		return false
+	}
+
+	data, marshalErr := err.MarshalJSON()
+	if marshalErr != nil {
+		return false
+	}
+
+	render.ClaudeEventData(o.c, "error", data)
+
+	return true
+}
@@ -0,0 +1,265 @@
+package mcptools
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/labring/aiproxy/core/model"
+	"github.com/labring/aiproxy/core/relay/adaptor"
+	"github.com/labring/aiproxy/core/relay/render"
+)
+
+// chatDialect is the format of the chat completions
+type chatDialect struct{}
+
+func (chatDialect) prepare(request map[string]any, tools []toolDefinition) {
+	list, _ := request["tools"].([]any)
+	for _, tool := range tools {
+		list = append(list, map[string]any{
+			"type": "function",
+			"function": map[string]any{
+				"name":        tool.Name,
+				"description": tool.Description,
+				"parameters":  tool.Parameters,
+			},
+		})
+	}
+
+	request["tools"] = list
+}
+
+func chatMessage(response map[string]any) map[string]any {
+	choices, _ := response["choices"].([]any)
+	if len(choices) == 0 {
+		return nil
+	}
+
+	choice, _ := choices[0].(map[string]any)
+	message, _ := choice["message"].(map[string]any)
+
+	return message
+}
+
+func chatFinishReason(response map[string]any) any {
+	choices, _ := response["choices"].([]any)
+	if len(choices) == 0 {
+		return nil
+	}
+
+	choice, _ := choices[0].(map[string]any)
+
+	return choice["finish_reason"]
+}
+
+func (chatDialect) toolCalls(response map[string]any) []toolCall {
+	list, _ := chatMessage(response)["tool_calls"].([]any)
+
+	calls := make([]toolCall, 0, len(list))
+	for _, v := range list {
+		call, _ := v.(map[string]any)
+		function, _ := call["function"].(map[string]any)
+
+		id, _ := call["id"].(string)
+		name, _ := function["name"].(string)
+		arguments, _ := function["arguments"].(string)
+
+		calls = append(calls, toolCall{
+			ID:        id,
+			Name:      name,
+			Arguments: arguments,
+		})
+	}
+
+	return calls
+}
+
+func (chatDialect) appendResults(
+	request, response map[string]any,
+	calls []toolCall,
+	results []toolResult,
+) {
+	message := chatMessage(response)
+
+	messages, _ := request["messages"].([]any)
+	messages = append(messages, map[string]any{
+		"role":       "assistant",
+		"content":    message["content"],
+		"tool_calls": message["tool_calls"],
+	})
+
+	for i, call := range calls {
+		messages = append(messages, map[string]any{
+			"role":         "tool",
+			"tool_call_id": call.ID,
+			"content":      results[i].Output,
+		})
+	}
+
+	request["messages"] = messages
+}
+
+func (chatDialect) disableTools(request map[string]any) {
+	request["tool_choice"] = "none"
+}
+
+func (chatDialect) newOutput(
+	c *gin.Context,
+	servers []model.VirtualMCPServer,
+	stream bool,
+) output {
+	return &chatOutput{
+		c:       c,
+		servers: servers,
+		stream:  stream,
+	}
+}
+
+// chatOutput writes the tool calls of the rounds as the mcp_tool_calls field
+// of the message or the delta
+type chatOutput struct {
+	c       *gin.Context
+	servers []model.VirtualMCPServer
+	stream  bool
+	started bool
+	id      any
+	created any
+	model   any
+	steps   []any
+}
+
+func (o *chatOutput) mcpToolCalls(calls []toolCall, results []toolResult) []any {
+	entries := make([]any, 0, len(calls))
+	for i, call := range calls {
+		entries = append(entries, map[string]any{
+			"id":        call.ID,
+			"server":    serverName(o.servers, call.Name),
+			"name":      call.Name,
+			"arguments": call.Arguments,
+			"output":    results[i].Output,
+			"is_error":  results[i].IsError,
+		})
+	}
+
+	return entries
+}
+
+func (o *chatOutput) start(response map[string]any) {
+	if o.started {
+		return
+	}
+
+	o.started = true
+	o.id = response["id"]
+	o.created = response["created"]
+	o.model = response["model"]
+
+	startStream(o.c)
+}
+
+func (o *chatOutput) chunk(delta map[string]any, finishReason any) map[string]any {
+	return map[string]any{
+		"id":      o.id,
+		"object":  "chat.completion.chunk",
+		"created": o.created,
+		"model":   o.model,
+		"choices": []any{
+			map[string]any{
+				"index":         0,
+				"delta":         delta,
+				"finish_reason": finishReason,
+			},
+		},
+	}
+}
+
+func (o *chatOutput) step(response map[string]any, calls []toolCall, results []toolResult) {
+	entries := o.mcpToolCalls(calls, results)
+	if !o.stream {
+		o.steps = append(o.steps, entries...)
+		return
+	}
+
+	o.start(response)
+
+	delta := map[string]any{
+		"role":           "assistant",
+		"mcp_tool_calls": entries,
+	}
+	if content, ok := chatMessage(response)["content"].(string); ok && content != "" {
+		delta["content"] = content
+	}
+
+	_ = render.OpenaiObjectData(o.c, o.chunk(delta, nil))
+}
+
+func (o *chatOutput) finish(body []byte, response map[string]any, usage model.Usage) {
+	message := chatMessage(response)
+
+	if !o.stream {
+		if len(o.steps) == 0 {
+			writeJSON(o.c, body)
+			return
+		}
+
+		if message != nil {
+			message["mcp_tool_calls"] = o.steps
+		}
+
+		response["usage"] = chatUsage(usage)
+
+		data, err := jsonAPI.Marshal(response)
+		if err != nil {
+			writeJSON(o.c, body)
+			return
+		}
+
+		writeJSON(o.c, data)
+
+		return
+	}
+
+	o.start(response)
+
+	delta := map[string]any{
+		"role": "assistant",
+	}
+	if content, ok := message["content"].(string); ok && content != "" {
+		delta["content"] = content
+	}
+
+	if reasoning, ok := message["reasoning_content"].(string); ok && reasoning != "" {
+		delta["reasoning_content"] = reasoning
+	}
+
+	if list, ok := message["tool_calls"].([]any); ok && len(list) > 0 {
+		for i, v := range list {
+			if call, ok := v.(map[string]any); ok {
+				call["index"] = i
+			}
+		}
+
+		delta["tool_calls"] = list
+	}
+
+	_ = render.OpenaiObjectData(o.c, o.chunk(delta, nil))
+
+	last := o.chunk(map[string]any{}, chatFinishReason(response))
+	last["usage"] = chatUsage(usage)
+	_ = render.OpenaiObjectData(o.c, last)
+
+	render.OpenaiDone(o.c)
+}
+
+func (o *chatOutput) fail(err adaptor.Error) bool {
+	if !o.stream || !o.started {
+		return false
+	}
+
+	data, marshalErr := err.MarshalJSON()
+	if marshalErr != nil {
+		return false
+	}
+
+	render.OpenaiBytesData(o.c, data)
+	render.OpenaiDone(o.c)
+
+	return true
+}
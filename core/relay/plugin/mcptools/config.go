@@ -0,0 +1,53 @@
+package mcptools
+
+import "github.com/labring/aiproxy/core/model"
+
+const PluginName = "mcp-tools"
+
+// OptionsKey is the request field attaching the mcp tools to the request
+const OptionsKey = "mcp_options"
+
+const (
+	defaultMaxIterations = 5
+	maxMaxIterations     = 20
+)
+
+type Config struct {
+	Enable bool `json:"enable"`
+	// MaxIterations is the max number of tool rounds of a request, the model
+	// is asked to answer without the tools after the last round
+	MaxIterations int `json:"max_iterations,omitempty"`
+	// Servers are attached to every request of the model
+	Servers []model.VirtualMCPServer `json:"servers,omitempty"`
+}
+
+func defaultConfig() Config {
+	return Config{
+		MaxIterations: defaultMaxIterations,
+	}
+}
+
+// Options are the mcp tools of a request
+type Options struct {
+	// Servers are the public and group mcps whose tools are attached, the
+	// tool names are namespaced the same way as the virtual mcps
+	Servers []model.VirtualMCPServer `json:"servers"`
+	// MaxIterations lowers the max number of tool rounds of the config
+	MaxIterations int `json:"max_iterations,omitempty"`
+}
+
+// maxIterations returns the max number of tool rounds of the request
+func maxIterations(config Config, options Options) int {
+	limit := config.MaxIterations
+	if limit <= 0 {
+		limit = defaultMaxIterations
+	}
+
+	limit = min(limit, maxMaxIterations)
+
+	if options.MaxIterations > 0 {
+		limit = min(limit, options.MaxIterations)
+	}
+
+	return limit
+}
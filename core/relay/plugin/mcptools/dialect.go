@@ -0,0 +1,106 @@
+package mcptools
+
+import (
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/labring/aiproxy/core/model"
+	"github.com/labring/aiproxy/core/relay/adaptor"
+	"github.com/labring/aiproxy/core/relay/mode"
+	relaymodel "github.com/labring/aiproxy/core/relay/model"
+	"github.com/labring/aiproxy/core/relay/render"
+)
+
+// dialect is the request and response format of a mode
+type dialect interface {
+	// prepare attaches the tools to the request
+	prepare(request map[string]any, tools []toolDefinition)
+	// toolCalls returns the tool calls of a turn
+	toolCalls(response map[string]any) []toolCall
+	// appendResults appends the turn and the tool results to the request
+	appendResults(
+		request, response map[string]any,
+		calls []toolCall,
+		results []toolResult,
+	)
+	// disableTools asks the model to answer without the tools
+	disableTools(request map[string]any)
+	newOutput(c *gin.Context, servers []model.VirtualMCPServer, stream bool) output
+}
+
+// output writes the tool rounds and the last turn to the client
+type output interface {
+	step(response map[string]any, calls []toolCall, results []toolResult)
+	// finish writes the last turn, body is the raw last turn
+	finish(body []byte, response map[string]any, usage model.Usage)
+	// fail ends a started stream with the error, it returns false when
+	// nothing is written and the error can still be the response
+	fail(err adaptor.Error) bool
+}
+
+var dialects = map[mode.Mode]dialect{
+	mode.ChatCompletions: chatDialect{},
+	mode.Anthropic:       anthropicDialect{},
+	mode.Responses:       responsesDialect{},
+}
+
+// serverName returns the namespace of the server exposing the tool
+func serverName(servers []model.VirtualMCPServer, tool string) string {
+	i, _, ok := model.RouteVirtualMCPTool(servers, tool)
+	if !ok {
+		return ""
+	}
+
+	return servers[i].GetNamespace()
+}
+
+func resultsByID(calls []toolCall, results []toolResult) map[string]toolResult {
+	byID := make(map[string]toolResult, len(calls))
+	for i, call := range calls {
+		byID[call.ID] = results[i]
+	}
+
+	return byID
+}
+
+func chatUsage(usage model.Usage) relaymodel.ChatUsage {
+	u := relaymodel.ChatUsage{
+		PromptTokens:     int64(usage.InputTokens),
+		CompletionTokens: int64(usage.OutputTokens),
+		TotalTokens:      int64(usage.TotalTokens),
+	}
+	if u.TotalTokens == 0 {
+		u.TotalTokens = u.PromptTokens + u.CompletionTokens
+	}
+
+	if usage.CachedTokens > 0 || usage.CacheCreationTokens > 0 {
+		u.PromptTokensDetails = &relaymodel.PromptTokensDetails{
+			CachedTokens:        int64(usage.CachedTokens),
+			CacheCreationTokens: int64(usage.CacheCreationTokens),
+		}
+	}
+
+	if usage.ReasoningTokens > 0 {
+		u.CompletionTokensDetails = &relaymodel.CompletionTokensDetails{
+			ReasoningTokens: int64(usage.ReasoningTokens),
+		}
+	}
+
+	return u
+}
+
+// startStream turns the response into a stream, the content length of the
+// first turn is dropped
+func startStream(c *gin.Context) {
+	c.Writer.Header().Del("Content-Length")
+	render.WriteSSEContentType(c.Writer)
+}
+
+// writeJSON writes a non stream response
+func writeJSON(c *gin.Context, body []byte) {
+	header := c.Writer.Header()
+	header.Set("Content-Type", "application/json")
+	header.Set("Content-Length", strconv.Itoa(len(body)))
+
+	_, _ = c.Writer.Write(body)
+}
@@ -0,0 +1,536 @@
+// Package mcptools attaches the tools of the public, group and embed mcps to
+// the chat, Anthropic and Responses requests, the tool calls of the model are
+// run against the mcp servers and fed back until the model finishes
+package mcptools
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strconv"
+
+	"github.com/bytedance/sonic"
+	"github.com/gin-gonic/gin"
+	"github.com/labring/aiproxy/core/common"
+	"github.com/labring/aiproxy/core/middleware"
+	"github.com/labring/aiproxy/core/model"
+	"github.com/labring/aiproxy/core/relay/adaptor"
+	"github.com/labring/aiproxy/core/relay/controller"
+	"github.com/labring/aiproxy/core/relay/meta"
+	relaymodel "github.com/labring/aiproxy/core/relay/model"
+	"github.com/labring/aiproxy/core/relay/plugin"
+	"github.com/labring/aiproxy/core/relay/plugin/noop"
+	"github.com/labring/aiproxy/core/relay/utils"
+	mcpservers "github.com/labring/aiproxy/mcp-servers"
+)
+
+var _ plugin.Plugin = (*MCPTools)(nil)
+
+// Constants for metadata keys
+const (
+	sessionKey = "mcp_tools_session"
+	callsKey   = "mcp_tool_calls"
+	roundsKey  = "mcp_tool_rounds"
+	stopKey    = "mcp_tool_stop"
+)
+
+// StopMaxIterations is the stop reason when the model still calls the tools
+// after the last round
+const StopMaxIterations = "max_iterations"
+
+// ErrorTypeMCPTools is the error type of the invalid mcp options
+const ErrorTypeMCPTools = "invalid_mcp_options"
+
+// jsonAPI keeps the numbers of the request as they are
+var jsonAPI = sonic.Config{UseNumber: true}.Froze()
+
+// NewServer connects the mcp servers of a request, the returned func closes
+// the connections
+type NewServer func(servers []model.VirtualMCPServer) (mcpservers.Server, func())
+
+// Turn sends the next turn of the tool loop to the model with the adaptor of
+// the request and returns the raw response of the turn
+type Turn func(
+	c *gin.Context,
+	meta *meta.Meta,
+	store adaptor.Store,
+	a adaptor.Adaptor,
+	body []byte,
+) ([]byte, model.Usage, error)
+
+// ResultChecker checks the tool results before they are sent to the model,
+// the plugins before this one only see the request of the first turn
+type ResultChecker interface {
+	// CheckToolResults returns the outputs to send, an error stops the
+	// request
+	CheckToolResults(
+		c *gin.Context,
+		meta *meta.Meta,
+		store adaptor.Store,
+		outputs []string,
+	) ([]string, error)
+}
+
+// MCPTools runs the tool calls of the model against the mcp servers
+type MCPTools struct {
+	noop.Noop
+	NewServer NewServer
+	// Turn is the channel of the request when it is nil
+	Turn        Turn
+	Checkers    []ResultChecker
+	configCache utils.PluginConfigCache[Config]
+}
+
+// NewMCPToolsPlugin creates a new mcp tools plugin, the checkers check the
+// tool results of every round in order
+func NewMCPToolsPlugin(newServer NewServer, checkers ...ResultChecker) plugin.Plugin {
+	return &MCPTools{
+		NewServer: newServer,
+		Checkers:  checkers,
+	}
+}
+
+var attachedConfigCache utils.PluginConfigCache[Config]
+
+// Attached reports whether the request attaches mcp tools by the config of the
+// model or the mcp options of the body, the plugins before this one use it as
+// the tools are only listed after them
+func Attached(meta *meta.Meta, body []byte) bool {
+	if _, ok := dialects[meta.Mode]; !ok {
+		return false
+	}
+
+	config, err := attachedConfigCache.Load(meta, PluginName, defaultConfig())
+	if err != nil || !config.Enable {
+		return false
+	}
+
+	if len(config.Servers) > 0 {
+		return true
+	}
+
+	node, err := sonic.Get(body, OptionsKey)
+
+	return err == nil && node.Exists()
+}
+
+// session is the tool loop of a request
+type session struct {
+	server  mcpservers.Server
+	servers []model.VirtualMCPServer
+	tools   map[string]struct{}
+	// request is the request sent to the model, the turns and the tool
+	// results are appended to it
+	request       map[string]any
+	stream        bool
+	maxIterations int
+	// adaptor is the adaptor wrapped by the plugin, the turns go through
+	// the plugins after this one
+	adaptor adaptor.Adaptor
+}
+
+// owns reports whether all the calls are the calls of the mcp tools
+func (s *session) owns(calls []toolCall) bool {
+	for _, call := range calls {
+		if _, ok := s.tools[call.Name]; !ok {
+			return false
+		}
+	}
+
+	return true
+}
+
+func getSession(meta *meta.Meta) (*session, bool) {
+	v, ok := meta.Get(sessionKey)
+	if !ok {
+		return nil, false
+	}
+
+	s, ok := v.(*session)
+
+	return s, ok
+}
+
+// LogMetadata returns the tool rounds of the request as log metadata
+func LogMetadata(meta *meta.Meta) map[string]string {
+	rounds := meta.GetInt(roundsKey)
+	if rounds == 0 {
+		return nil
+	}
+
+	metadata := map[string]string{
+		callsKey:  strconv.Itoa(meta.GetInt(callsKey)),
+		roundsKey: strconv.Itoa(rounds),
+	}
+	if stop := meta.GetString(stopKey); stop != "" {
+		metadata[stopKey] = stop
+	}
+
+	return metadata
+}
+
+func invalidOptionsError(meta *meta.Meta, message string) adaptor.Error {
+	return relaymodel.WrapperErrorWithMessage(
+		meta.Mode,
+		http.StatusBadRequest,
+		message,
+		relaymodel.WithType(ErrorTypeMCPTools),
+	)
+}
+
+// ConvertRequest attaches the mcp tools to the request, the model turns are
+// not streamed so that their tool calls can be run
+func (p *MCPTools) ConvertRequest(
+	meta *meta.Meta,
+	store adaptor.Store,
+	req *http.Request,
+	do adaptor.ConvertRequest,
+) (adaptor.ConvertResult, error) {
+	d, ok := dialects[meta.Mode]
+	if !ok {
+		return do.ConvertRequest(meta, store, req)
+	}
+
+	config, err := p.configCache.Load(meta, PluginName, defaultConfig())
+	if err != nil || !config.Enable {
+		return do.ConvertRequest(meta, store, req)
+	}
+
+	body, err := common.GetRequestBodyReusable(req)
+	if err != nil {
+		return adaptor.ConvertResult{}, err
+	}
+
+	var request map[string]any
+	if err := jsonAPI.Unmarshal(body, &request); err != nil {
+		// the adaptor reports the invalid json
+		return do.ConvertRequest(meta, store, req)
+	}
+
+	rawOptions, hasOptions := request[OptionsKey]
+	if !hasOptions && len(config.Servers) == 0 {
+		return do.ConvertRequest(meta, store, req)
+	}
+
+	var options Options
+	if hasOptions {
+		data, err := jsonAPI.Marshal(rawOptions)
+		if err != nil {
+			return adaptor.ConvertResult{}, err
+		}
+
+		if err := jsonAPI.Unmarshal(data, &options); err != nil {
+			return adaptor.ConvertResult{}, invalidOptionsError(meta, err.Error())
+		}
+
+		delete(request, OptionsKey)
+	}
+
+	// the embed mcps are only attached by the config, the request can not
+	// pick their init config
+	for _, server := range options.Servers {
+		if server.Type == model.VirtualMCPServerTypeEmbed {
+			return adaptor.ConvertResult{}, invalidOptionsError(
+				meta,
+				"embed mcp servers can only be configured by the model config",
+			)
+		}
+	}
+
+	servers := slices.Concat(config.Servers, options.Servers)
+	if err := model.ValidateVirtualMCPServers(servers); err != nil {
+		return adaptor.ConvertResult{}, invalidOptionsError(meta, err.Error())
+	}
+
+	if len(servers) > 0 && p.NewServer != nil {
+		s, err := p.newSession(req.Context(), servers, request, d)
+		if err != nil {
+			common.GetLoggerFromReq(req).Warnf("mcp-tools: list tools failed: %v", err)
+		} else if s != nil {
+			s.maxIterations = maxIterations(config, options)
+			s.adaptor, _ = do.(adaptor.Adaptor)
+			meta.Set(sessionKey, s)
+		}
+	}
+
+	converted, err := jsonAPI.Marshal(request)
+	if err != nil {
+		return adaptor.ConvertResult{}, err
+	}
+
+	common.SetRequestBody(req, converted)
+	defer common.SetRequestBody(req, body)
+
+	return do.ConvertRequest(meta, store, req)
+}
+
+// newSession attaches the tools of the servers to the request, it returns nil
+// when there are no tools
+func (p *MCPTools) newSession(
+	ctx context.Context,
+	servers []model.VirtualMCPServer,
+	request map[string]any,
+	d dialect,
+) (*session, error) {
+	server, closeServer := p.NewServer(servers)
+	// the connections are closed when the request is done
+	context.AfterFunc(ctx, closeServer)
+
+	tools, err := mcpservers.ListServerTools(ctx, server)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(tools) == 0 {
+		return nil, nil
+	}
+
+	definitions, err := toolDefinitions(tools)
+	if err != nil {
+		return nil, err
+	}
+
+	names := make(map[string]struct{}, len(tools))
+	for _, tool := range tools {
+		names[tool.Name] = struct{}{}
+	}
+
+	d.prepare(request, definitions)
+
+	// the turns are read as a whole, the stream of the client is rebuilt
+	// from them
+	stream, _ := request["stream"].(bool)
+	request["stream"] = false
+	delete(request, "stream_options")
+
+	return &session{
+		server:  server,
+		servers: servers,
+		tools:   names,
+		request: request,
+		stream:  stream,
+	}, nil
+}
+
+// captureWriter keeps the response of a turn instead of writing it
+type captureWriter struct {
+	gin.ResponseWriter
+	body bytes.Buffer
+}
+
+func (w *captureWriter) Write(b []byte) (int, error) {
+	return w.body.Write(b)
+}
+
+func (w *captureWriter) WriteString(s string) (int, error) {
+	return w.body.WriteString(s)
+}
+
+func (w *captureWriter) WriteHeaderNow() {}
+
+func (w *captureWriter) Flush() {}
+
+// DoResponse runs the tool calls of the model and sends the results back to
+// the model until it answers without the mcp tools
+func (p *MCPTools) DoResponse(
+	meta *meta.Meta,
+	store adaptor.Store,
+	c *gin.Context,
+	resp *http.Response,
+	do adaptor.DoResponse,
+) (adaptor.DoResponseResult, adaptor.Error) {
+	s, ok := getSession(meta)
+	if !ok {
+		return do.DoResponse(meta, store, c, resp)
+	}
+
+	capture := &captureWriter{ResponseWriter: c.Writer}
+	c.Writer = capture
+	result, respErr := do.DoResponse(meta, store, c, resp)
+	c.Writer = capture.ResponseWriter
+
+	if respErr != nil {
+		return result, respErr
+	}
+
+	usage, respErr := p.run(meta, store, c, s, capture.body.Bytes(), result.Usage)
+	result.Usage = usage
+
+	return result, respErr
+}
+
+func (p *MCPTools) run(
+	meta *meta.Meta,
+	store adaptor.Store,
+	c *gin.Context,
+	s *session,
+	body []byte,
+	usage model.Usage,
+) (model.Usage, adaptor.Error) {
+	d := dialects[meta.Mode]
+	out := d.newOutput(c, s.servers, s.stream)
+
+	turn := p.Turn
+	if turn == nil {
+		turn = runTurn
+	}
+
+	for round := 0; ; round++ {
+		var response map[string]any
+		if err := jsonAPI.Unmarshal(body, &response); err != nil {
+			// the turn is not a json object, it is sent as it is
+			_, _ = c.Writer.Write(body)
+			return usage, nil
+		}
+
+		calls := d.toolCalls(response)
+		if len(calls) == 0 || !s.owns(calls) {
+			out.finish(body, response, usage)
+			return usage, nil
+		}
+
+		if round >= s.maxIterations {
+			meta.Set(stopKey, StopMaxIterations)
+			out.finish(body, response, usage)
+
+			return usage, nil
+		}
+
+		results := callTools(c.Request.Context(), s.server, calls)
+
+		results, err := p.checkResults(c, meta, store, results)
+		if err != nil {
+			respErr := toAdaptorError(meta, err)
+			if out.fail(respErr) {
+				return usage, nil
+			}
+
+			return usage, respErr
+		}
+
+		meta.Set(roundsKey, round+1)
+		meta.Set(callsKey, meta.GetInt(callsKey)+len(calls))
+
+		out.step(response, calls, results)
+
+		d.appendResults(s.request, response, calls, results)
+
+		if round+1 >= s.maxIterations {
+			d.disableTools(s.request)
+		}
+
+		next, err := jsonAPI.Marshal(s.request)
+		if err != nil {
+			return usage, relaymodel.WrapperErrorWithMessage(
+				meta.Mode,
+				http.StatusInternalServerError,
+				err.Error(),
+			)
+		}
+
+		var turnUsage model.Usage
+
+		body, turnUsage, err = turn(c, meta, store, s.adaptor, next)
+		usage.Add(turnUsage)
+
+		if err != nil {
+			respErr := toAdaptorError(meta, err)
+			if out.fail(respErr) {
+				return usage, nil
+			}
+
+			return usage, respErr
+		}
+	}
+}
+
+// checkResults passes the outputs of the tool results through the checkers
+func (p *MCPTools) checkResults(
+	c *gin.Context,
+	meta *meta.Meta,
+	store adaptor.Store,
+	results []toolResult,
+) ([]toolResult, error) {
+	if len(p.Checkers) == 0 {
+		return results, nil
+	}
+
+	outputs := make([]string, len(results))
+	for i, result := range results {
+		outputs[i] = result.Output
+	}
+
+	for _, checker := range p.Checkers {
+		var err error
+
+		outputs, err = checker.CheckToolResults(c, meta, store, outputs)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	checked := slices.Clone(results)
+	for i := range checked {
+		checked[i].Output = outputs[i]
+	}
+
+	return checked, nil
+}
+
+func toAdaptorError(meta *meta.Meta, err error) adaptor.Error {
+	var respErr adaptor.Error
+	if errors.As(err, &respErr) {
+		return respErr
+	}
+
+	return relaymodel.WrapperErrorWithMessage(
+		meta.Mode,
+		http.StatusInternalServerError,
+		err.Error(),
+	)
+}
+
+// runTurn sends the next turn of the tool loop to the channel of the request
+func runTurn(
+	c *gin.Context,
+	m *meta.Meta,
+	store adaptor.Store,
+	a adaptor.Adaptor,
+	body []byte,
+) ([]byte, model.Usage, error) {
+	if a == nil {
+		return nil, model.Usage{}, fmt.Errorf("adaptor not found: %d", m.Channel.Type)
+	}
+
+	w := httptest.NewRecorder()
+	newc, _ := gin.CreateTestContext(w)
+	newc.Request = c.Request.Clone(c.Request.Context())
+	newc.Keys = maps.Clone(c.Keys)
+	common.SetRequestBody(newc.Request, body)
+	middleware.SetRequestID(newc, m.RequestID)
+
+	newMeta := meta.NewMeta(
+		nil,
+		m.Mode,
+		m.OriginModel,
+		m.ModelConfig,
+		meta.WithRequestID(m.RequestID),
+		meta.WithGroup(m.Group),
+		meta.WithToken(m.Token),
+		meta.WithEndpoint(m.Endpoint),
+	)
+	newMeta.CopyChannelFromMeta(m)
+	newMeta.RequestTimeout = m.RequestTimeout
+
+	result := controller.Handle(a, newc, newMeta, store)
+	if result.Error != nil {
+		return nil, result.Usage, result.Error
+	}
+
+	return w.Body.Bytes(), result.Usage, nil
+}
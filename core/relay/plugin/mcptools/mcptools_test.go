@@ -0,0 +1,678 @@
+package mcptools_test
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/bytedance/sonic"
+	"github.com/gin-gonic/gin"
+	"github.com/labring/aiproxy/core/common"
+	"github.com/labring/aiproxy/core/model"
+	"github.com/labring/aiproxy/core/relay/adaptor"
+	"github.com/labring/aiproxy/core/relay/meta"
+	"github.com/labring/aiproxy/core/relay/mode"
+	relaymodel "github.com/labring/aiproxy/core/relay/model"
+	"github.com/labring/aiproxy/core/relay/plugin/guardrails"
+	"github.com/labring/aiproxy/core/relay/plugin/mcptools"
+	mcpservers "github.com/labring/aiproxy/mcp-servers"
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type captureConvert struct {
+	body map[string]any
+}
+
+func (c *captureConvert) ConvertRequest(
+	_ *meta.Meta,
+	_ adaptor.Store,
+	req *http.Request,
+) (adaptor.ConvertResult, error) {
+	body, err := common.GetRequestBodyReusable(req)
+	if err != nil {
+		return adaptor.ConvertResult{}, err
+	}
+
+	c.body = nil
+
+	return adaptor.ConvertResult{}, sonic.Unmarshal(body, &c.body)
+}
+
+// innerAdaptor is the adaptor wrapped by the plugin
+type innerAdaptor struct {
+	adaptor.Adaptor
+	convert *captureConvert
+}
+
+func (a *innerAdaptor) ConvertRequest(
+	meta *meta.Meta,
+	store adaptor.Store,
+	req *http.Request,
+) (adaptor.ConvertResult, error) {
+	return a.convert.ConvertRequest(meta, store, req)
+}
+
+type doResponseFunc func(*meta.Meta, adaptor.Store, *gin.Context, *http.Response) (adaptor.DoResponseResult, adaptor.Error)
+
+func (f doResponseFunc) DoResponse(
+	meta *meta.Meta,
+	store adaptor.Store,
+	c *gin.Context,
+	resp *http.Response,
+) (adaptor.DoResponseResult, adaptor.Error) {
+	return f(meta, store, c, resp)
+}
+
+var turnUsage = model.Usage{InputTokens: 10, OutputTokens: 5, TotalTokens: 15}
+
+// fakeModel answers the turns of the tool loop in order and records the
+// requests of the turns
+type fakeModel struct {
+	turns    []map[string]any
+	requests []map[string]any
+	adaptors []adaptor.Adaptor
+}
+
+func (f *fakeModel) turn(
+	_ *gin.Context,
+	_ *meta.Meta,
+	_ adaptor.Store,
+	a adaptor.Adaptor,
+	body []byte,
+) ([]byte, model.Usage, error) {
+	var request map[string]any
+	if err := sonic.Unmarshal(body, &request); err != nil {
+		return nil, model.Usage{}, err
+	}
+
+	f.requests = append(f.requests, request)
+	f.adaptors = append(f.adaptors, a)
+
+	next := f.turns[0]
+	if len(f.turns) > 1 {
+		f.turns = f.turns[1:]
+	}
+
+	data, err := sonic.Marshal(next)
+
+	return data, turnUsage, err
+}
+
+// newWeatherServer is a mcp server whose tools are already namespaced the
+// way the virtual mcps do
+func newWeatherServer(t *testing.T) (*server.MCPServer, *int) {
+	t.Helper()
+
+	calls := 0
+
+	s := server.NewMCPServer("weather", "1.0.0", server.WithToolCapabilities(true))
+	s.AddTool(
+		mcp.NewTool("weather__forecast",
+			mcp.WithDescription("Get the forecast of a city"),
+			mcp.WithString("city", mcp.Required()),
+		),
+		func(_ context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+			calls++
+			return mcp.NewToolResultText("sunny in " + req.GetString("city", "")), nil
+		},
+	)
+
+	return s, &calls
+}
+
+func newPlugin(t *testing.T, f *fakeModel) (*mcptools.MCPTools, *int) {
+	t.Helper()
+
+	s, calls := newWeatherServer(t)
+
+	return &mcptools.MCPTools{
+		NewServer: func([]model.VirtualMCPServer) (mcpservers.Server, func()) {
+			return s, func() {}
+		},
+		Turn: f.turn,
+	}, calls
+}
+
+func newMeta(m mode.Mode, config map[string]any) *meta.Meta {
+	return meta.NewMeta(nil, m, "gpt-4o", model.ModelConfig{
+		Model: "gpt-4o",
+		Plugin: map[string]map[string]any{
+			mcptools.PluginName: config,
+		},
+	})
+}
+
+func weatherOptions() map[string]any {
+	return map[string]any{
+		"servers": []map[string]any{
+			{"type": "public", "id": "weather"},
+		},
+	}
+}
+
+type result struct {
+	w       *httptest.ResponseRecorder
+	convert *captureConvert
+	inner   adaptor.Adaptor
+	usage   model.Usage
+	err     adaptor.Error
+}
+
+// run converts the request and answers it with the first turn
+func run(
+	t *testing.T,
+	p *mcptools.MCPTools,
+	m *meta.Meta,
+	body map[string]any,
+	first map[string]any,
+) result {
+	t.Helper()
+
+	data, err := sonic.Marshal(body)
+	require.NoError(t, err)
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequestWithContext(
+		t.Context(),
+		http.MethodPost,
+		"/v1/chat/completions",
+		bytes.NewReader(data),
+	)
+	c.Request.Header.Set("Content-Type", "application/json")
+
+	capture := &captureConvert{}
+	inner := &innerAdaptor{convert: capture}
+	_, err = p.ConvertRequest(m, nil, c.Request, inner)
+	require.NoError(t, err)
+
+	firstData, err := sonic.Marshal(first)
+	require.NoError(t, err)
+
+	resp, respErr := p.DoResponse(m, nil, c, &http.Response{}, doResponseFunc(
+		func(_ *meta.Meta, _ adaptor.Store, c *gin.Context, _ *http.Response) (adaptor.DoResponseResult, adaptor.Error) {
+			c.Writer.Header().Set("Content-Type", "application/json")
+			_, _ = c.Writer.Write(firstData)
+			return adaptor.DoResponseResult{Usage: turnUsage}, nil
+		},
+	))
+
+	return result{w: w, convert: capture, inner: inner, usage: resp.Usage, err: respErr}
+}
+
+func chatTurn(content string, toolCalls ...map[string]any) map[string]any {
+	message := map[string]any{
+		"role":    "assistant",
+		"content": content,
+	}
+
+	finishReason := "stop"
+	if len(toolCalls) > 0 {
+		message["tool_calls"] = toolCalls
+		finishReason = "tool_calls"
+	}
+
+	return map[string]any{
+		"id":      "chatcmpl-1",
+		"object":  "chat.completion",
+		"created": 1,
+		"model":   "gpt-4o",
+		"choices": []map[string]any{
+			{"index": 0, "message": message, "finish_reason": finishReason},
+		},
+	}
+}
+
+func chatToolCall(id, name, arguments string) map[string]any {
+	return map[string]any{
+		"id":   id,
+		"type": "function",
+		"function": map[string]any{
+			"name":      name,
+			"arguments": arguments,
+		},
+	}
+}
+
+func chatBody(stream bool) map[string]any {
+	return map[string]any{
+		"model":       "gpt-4o",
+		"stream":      stream,
+		"mcp_options": weatherOptions(),
+		"messages": []map[string]any{
+			{"role": "user", "content": "weather of Paris?"},
+		},
+	}
+}
+
+func TestChatToolLoop(t *testing.T) {
+	f := &fakeModel{turns: []map[string]any{chatTurn("It is sunny in Paris.")}}
+	p, calls := newPlugin(t, f)
+
+	r := run(t, p, newMeta(mode.ChatCompletions, map[string]any{"enable": true}), chatBody(false),
+		chatTurn("", chatToolCall("call_1", "weather__forecast", `{"city":"Paris"}`)))
+	require.Nil(t, r.err)
+
+	// the tools are attached and the options are not sent to the model
+	assert.NotContains(t, r.convert.body, mcptools.OptionsKey)
+	assert.Equal(t, false, r.convert.body["stream"])
+
+	tools, _ := r.convert.body["tools"].([]any)
+	require.Len(t, tools, 1)
+	assert.Equal(t, "weather__forecast", tools[0].(map[string]any)["function"].(map[string]any)["name"])
+
+	// the tool result is sent back to the model
+	assert.Equal(t, 1, *calls)
+	require.Len(t, f.requests, 1)
+
+	// the turn goes through the adaptor wrapped by the plugin
+	assert.Same(t, r.inner, f.adaptors[0])
+
+	messages, _ := f.requests[0]["messages"].([]any)
+	require.Len(t, messages, 3)
+	assert.Equal(t, map[string]any{
+		"role":         "tool",
+		"tool_call_id": "call_1",
+		"content":      "sunny in Paris",
+	}, messages[2])
+
+	// both turns are billed
+	assert.Equal(t, model.ZeroNullInt64(30), r.usage.TotalTokens)
+
+	var resp struct {
+		Choices []struct {
+			Message struct {
+				Content      string `json:"content"`
+				MCPToolCalls []struct {
+					Server string `json:"server"`
+					Name   string `json:"name"`
+					Output string `json:"output"`
+				} `json:"mcp_tool_calls"`
+			} `json:"message"`
+		} `json:"choices"`
+		Usage relaymodel.ChatUsage `json:"usage"`
+	}
+	require.NoError(t, sonic.Unmarshal(r.w.Body.Bytes(), &resp))
+	require.Len(t, resp.Choices, 1)
+	assert.Equal(t, "It is sunny in Paris.", resp.Choices[0].Message.Content)
+	require.Len(t, resp.Choices[0].Message.MCPToolCalls, 1)
+	assert.Equal(t, "weather", resp.Choices[0].Message.MCPToolCalls[0].Server)
+	assert.Equal(t, "sunny in Paris", resp.Choices[0].Message.MCPToolCalls[0].Output)
+	assert.Equal(t, int64(30), resp.Usage.TotalTokens)
+}
+
+func TestChatToolLoopStream(t *testing.T) {
+	f := &fakeModel{turns: []map[string]any{chatTurn("It is sunny in Paris.")}}
+	p, _ := newPlugin(t, f)
+
+	m := newMeta(mode.ChatCompletions, map[string]any{"enable": true})
+	r := run(t, p, m, chatBody(true),
+		chatTurn("", chatToolCall("call_1", "weather__forecast", `{"city":"Paris"}`)))
+	require.Nil(t, r.err)
+
+	assert.Equal(t, "text/event-stream", r.w.Header().Get("Content-Type"))
+
+	body := r.w.Body.String()
+	assert.Contains(t, body, `"mcp_tool_calls"`)
+	assert.Contains(t, body, `"content":"It is sunny in Paris."`)
+	assert.Contains(t, body, `"finish_reason":"stop"`)
+	assert.True(t, strings.HasSuffix(body, "data: [DONE]\n\n"))
+
+	assert.Equal(t, map[string]string{
+		"mcp_tool_calls":  "1",
+		"mcp_tool_rounds": "1",
+	}, mcptools.LogMetadata(m))
+}
+
+func TestChatClientTools(t *testing.T) {
+	f := &fakeModel{}
+	p, calls := newPlugin(t, f)
+
+	first := chatTurn("", chatToolCall("call_1", "get_time", `{}`))
+	r := run(t, p, newMeta(mode.ChatCompletions, map[string]any{"enable": true}), chatBody(false), first)
+	require.Nil(t, r.err)
+
+	// the calls of the client tools are returned to the client
+	assert.Equal(t, 0, *calls)
+	assert.Empty(t, f.requests)
+
+	expected, err := sonic.Marshal(first)
+	require.NoError(t, err)
+	assert.Equal(t, string(expected), r.w.Body.String())
+}
+
+func TestMaxIterations(t *testing.T) {
+	call := chatTurn("", chatToolCall("call_1", "weather__forecast", `{"city":"Paris"}`))
+	f := &fakeModel{turns: []map[string]any{call}}
+	p, calls := newPlugin(t, f)
+
+	m := newMeta(mode.ChatCompletions, map[string]any{"enable": true, "max_iterations": 3})
+	body := chatBody(false)
+	body["mcp_options"].(map[string]any)["max_iterations"] = 2
+
+	r := run(t, p, m, body, call)
+	require.Nil(t, r.err)
+
+	// the options lower the max iterations of the config
+	assert.Equal(t, 2, *calls)
+	require.Len(t, f.requests, 2)
+	assert.NotContains(t, f.requests[0], "tool_choice")
+	assert.Equal(t, "none", f.requests[1]["tool_choice"])
+
+	assert.Equal(t, map[string]string{
+		"mcp_tool_calls":  "2",
+		"mcp_tool_rounds": "2",
+		"mcp_tool_stop":   mcptools.StopMaxIterations,
+	}, mcptools.LogMetadata(m))
+}
+
+type checkerFunc func(outputs []string) ([]string, error)
+
+func (f checkerFunc) CheckToolResults(
+	_ *gin.Context,
+	_ *meta.Meta,
+	_ adaptor.Store,
+	outputs []string,
+) ([]string, error) {
+	return f(outputs)
+}
+
+func TestCheckToolResults(t *testing.T) {
+	f := &fakeModel{turns: []map[string]any{chatTurn("Done.")}}
+	p, _ := newPlugin(t, f)
+	p.Checkers = []mcptools.ResultChecker{guardrails.NewGuardrailsPlugin()}
+
+	m := newMeta(mode.ChatCompletions, map[string]any{"enable": true})
+	m.ModelConfig.Plugin[guardrails.PluginName] = map[string]any{"enable": true}
+
+	r := run(t, p, m, chatBody(false),
+		chatTurn("", chatToolCall("call_1", "weather__forecast", `{"city":"admin@example.com"}`)))
+	require.Nil(t, r.err)
+
+	// the tool result is redacted before it is sent to the model and the client
+	messages, _ := f.requests[0]["messages"].([]any)
+	require.Len(t, messages, 3)
+	assert.Equal(t, "sunny in [REDACTED_EMAIL]", messages[2].(map[string]any)["content"])
+	assert.Contains(t, r.w.Body.String(), `"output":"sunny in [REDACTED_EMAIL]"`)
+	assert.Equal(t, []guardrails.Violation{
+		{Name: guardrails.DetectorEmail, Action: guardrails.ActionRedact, Count: 1},
+	}, guardrails.GetViolations(m))
+
+	// a blocked tool result stops the loop
+	f = &fakeModel{turns: []map[string]any{chatTurn("Done.")}}
+	p, _ = newPlugin(t, f)
+	p.Checkers = []mcptools.ResultChecker{checkerFunc(func([]string) ([]string, error) {
+		return nil, relaymodel.WrapperErrorWithMessage(
+			mode.ChatCompletions,
+			http.StatusBadRequest,
+			"tool_result flagged by moderation",
+		)
+	})}
+
+	r = run(t, p, newMeta(mode.ChatCompletions, map[string]any{"enable": true}), chatBody(false),
+		chatTurn("", chatToolCall("call_1", "weather__forecast", `{"city":"Paris"}`)))
+	require.NotNil(t, r.err)
+	assert.Equal(t, http.StatusBadRequest, r.err.StatusCode())
+	assert.Empty(t, f.requests)
+}
+
+func TestAttached(t *testing.T) {
+	body := []byte(`{"mcp_options":{"servers":[{"type":"public","id":"weather"}]}}`)
+
+	assert.True(t, mcptools.Attached(
+		newMeta(mode.ChatCompletions, map[string]any{"enable": true}),
+		body,
+	))
+	assert.False(t, mcptools.Attached(
+		newMeta(mode.ChatCompletions, map[string]any{"enable": true}),
+		[]byte(`{"messages":[]}`),
+	))
+	assert.False(t, mcptools.Attached(newMeta(mode.Embeddings, map[string]any{"enable": true}), body))
+
+	disabled := meta.NewMeta(nil, mode.ChatCompletions, "gpt-4o-disabled", model.ModelConfig{
+		Model: "gpt-4o-disabled",
+	})
+	assert.False(t, mcptools.Attached(disabled, body))
+
+	configured := meta.NewMeta(nil, mode.ChatCompletions, "gpt-4o-servers", model.ModelConfig{
+		Model: "gpt-4o-servers",
+		Plugin: map[string]map[string]any{
+			mcptools.PluginName: {
+				"enable":  true,
+				"servers": []map[string]any{{"type": "public", "id": "weather"}},
+			},
+		},
+	})
+	assert.True(t, mcptools.Attached(configured, []byte(`{}`)))
+}
+
+func TestAnthropicToolLoop(t *testing.T) {
+	final := map[string]any{
+		"id":          "msg_1",
+		"type":        "message",
+		"role":        "assistant",
+		"model":       "claude",
+		"stop_reason": "end_turn",
+		"content": []map[string]any{
+			{"type": "text", "text": "It is sunny in Paris."},
+		},
+	}
+	f := &fakeModel{turns: []map[string]any{final}}
+	p, _ := newPlugin(t, f)
+
+	first := map[string]any{
+		"id":          "msg_0",
+		"type":        "message",
+		"role":        "assistant",
+		"model":       "claude",
+		"stop_reason": "tool_use",
+		"content": []map[string]any{
+			{"type": "text", "text": "Let me check."},
+			{
+				"type":  "tool_use",
+				"id":    "toolu_1",
+				"name":  "weather__forecast",
+				"input": map[string]any{"city": "Paris"},
+			},
+		},
+	}
+
+	r := run(t, p, newMeta(mode.Anthropic, map[string]any{"enable": true}), map[string]any{
+		"model":       "claude",
+		"max_tokens":  1024,
+		"mcp_options": weatherOptions(),
+		"messages": []map[string]any{
+			{"role": "user", "content": "weather of Paris?"},
+		},
+	}, first)
+	require.Nil(t, r.err)
+
+	tools, _ := r.convert.body["tools"].([]any)
+	require.Len(t, tools, 1)
+	assert.Contains(t, tools[0], "input_schema")
+
+	require.Len(t, f.requests, 1)
+
+	messages, _ := f.requests[0]["messages"].([]any)
+	require.Len(t, messages, 3)
+	assert.Equal(t, map[string]any{
+		"role": "user",
+		"content": []any{
+			map[string]any{
+				"type":        "tool_result",
+				"tool_use_id": "toolu_1",
+				"content":     "sunny in Paris",
+				"is_error":    false,
+			},
+		},
+	}, messages[2])
+
+	var resp struct {
+		Content []map[string]any `json:"content"`
+	}
+	require.NoError(t, sonic.Unmarshal(r.w.Body.Bytes(), &resp))
+
+	types := make([]any, 0, len(resp.Content))
+	for _, block := range resp.Content {
+		types = append(types, block["type"])
+	}
+
+	assert.Equal(t, []any{"text", "mcp_tool_use", "mcp_tool_result", "text"}, types)
+	assert.Equal(t, "weather", resp.Content[1]["server_name"])
+}
+
+func TestResponsesToolLoopStream(t *testing.T) {
+	final := map[string]any{
+		"id":     "resp_2",
+		"object": "response",
+		"status": "completed",
+		"output": []map[string]any{
+			{
+				"type":   "message",
+				"id":     "msg_1",
+				"role":   "assistant",
+				"status": "completed",
+				"content": []map[string]any{
+					{"type": "output_text", "text": "It is sunny in Paris.", "annotations": []any{}},
+				},
+			},
+		},
+	}
+	f := &fakeModel{turns: []map[string]any{final}}
+	p, _ := newPlugin(t, f)
+
+	first := map[string]any{
+		"id":     "resp_1",
+		"object": "response",
+		"status": "completed",
+		"output": []map[string]any{
+			{
+				"type":      "function_call",
+				"id":        "fc_1",
+				"call_id":   "call_1",
+				"name":      "weather__forecast",
+				"arguments": `{"city":"Paris"}`,
+			},
+		},
+	}
+
+	r := run(t, p, newMeta(mode.Responses, map[string]any{"enable": true}), map[string]any{
+		"model":       "gpt-4o",
+		"stream":      true,
+		"mcp_options": weatherOptions(),
+		"input":       "weather of Paris?",
+	}, first)
+	require.Nil(t, r.err)
+
+	require.Len(t, f.requests, 1)
+
+	input, _ := f.requests[0]["input"].([]any)
+	require.Len(t, input, 3)
+	assert.Equal(t, map[string]any{
+		"type":    "function_call_output",
+		"call_id": "call_1",
+		"output":  "sunny in Paris",
+	}, input[2])
+
+	body := r.w.Body.String()
+	assert.Contains(t, body, "event: response.created")
+	assert.Contains(t, body, `"type":"mcp_call"`)
+	assert.Contains(t, body, `"server_label":"weather"`)
+	assert.Contains(t, body, `"delta":"It is sunny in Paris."`)
+	assert.Contains(t, body, "event: response.completed")
+	assert.Contains(t, body, `"id":"resp_1"`)
+}
+
+func TestWithoutServers(t *testing.T) {
+	f := &fakeModel{}
+	p, _ := newPlugin(t, f)
+
+	first := chatTurn("hi")
+	r := run(t, p, newMeta(mode.ChatCompletions, map[string]any{"enable": true}), map[string]any{
+		"model":  "gpt-4o",
+		"stream": true,
+		"messages": []map[string]any{
+			{"role": "user", "content": "hi"},
+		},
+	}, first)
+	require.Nil(t, r.err)
+
+	assert.Equal(t, true, r.convert.body["stream"])
+	assert.NotContains(t, r.convert.body, "tools")
+
+	expected, err := sonic.Marshal(first)
+	require.NoError(t, err)
+	assert.Equal(t, string(expected), r.w.Body.String())
+}
+
+func TestInvalidOptions(t *testing.T) {
+	p, _ := newPlugin(t, &fakeModel{})
+
+	body := chatBody(false)
+	body["mcp_options"] = map[string]any{
+		"servers": []map[string]any{
+			{"type": "public", "id": "weather"},
+			{"type": "group", "id": "weather"},
+		},
+	}
+
+	data, err := sonic.Marshal(body)
+	require.NoError(t, err)
+
+	req := httptest.NewRequestWithContext(
+		t.Context(),
+		http.MethodPost,
+		"/v1/chat/completions",
+		bytes.NewReader(data),
+	)
+
+	_, err = p.ConvertRequest(
+		newMeta(mode.ChatCompletions, map[string]any{"enable": true}),
+		nil,
+		req,
+		&captureConvert{},
+	)
+
+	var respErr adaptor.Error
+	require.ErrorAs(t, err, &respErr)
+	assert.Equal(t, http.StatusBadRequest, respErr.StatusCode())
+}
+
+func TestEmbedServerOptions(t *testing.T) {
+	p, _ := newPlugin(t, &fakeModel{})
+
+	body := chatBody(false)
+	body["mcp_options"] = map[string]any{
+		"servers": []map[string]any{
+			{"type": "embed", "id": "time"},
+		},
+	}
+
+	data, err := sonic.Marshal(body)
+	require.NoError(t, err)
+
+	req := httptest.NewRequestWithContext(
+		t.Context(),
+		http.MethodPost,
+		"/v1/chat/completions",
+		bytes.NewReader(data),
+	)
+
+	_, err = p.ConvertRequest(
+		newMeta(mode.ChatCompletions, map[string]any{"enable": true}),
+		nil,
+		req,
+		&captureConvert{},
+	)
+
+	// the embed mcps are only attached by the config
+	var respErr adaptor.Error
+	require.ErrorAs(t, err, &respErr)
+	assert.Equal(t, http.StatusBadRequest, respErr.StatusCode())
+}
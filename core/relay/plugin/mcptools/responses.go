@@ -0,0 +1,324 @@
+package mcptools
+
+import (
+	"maps"
+
+	"github.com/gin-gonic/gin"
+	"github.com/labring/aiproxy/core/model"
+	"github.com/labring/aiproxy/core/relay/adaptor"
+	"github.com/labring/aiproxy/core/relay/render"
+)
+
+// responsesDialect is the format of the Responses API
+type responsesDialect struct{}
+
+func (responsesDialect) prepare(request map[string]any, tools []toolDefinition) {
+	list, _ := request["tools"].([]any)
+	for _, tool := range tools {
+		list = append(list, map[string]any{
+			"type":        "function",
+			"name":        tool.Name,
+			"description": tool.Description,
+			"parameters":  tool.Parameters,
+		})
+	}
+
+	request["tools"] = list
+}
+
+func responsesOutput(response map[string]any) []any {
+	output, _ := response["output"].([]any)
+	return output
+}
+
+func (responsesDialect) toolCalls(response map[string]any) []toolCall {
+	var calls []toolCall
+
+	for _, v := range responsesOutput(response) {
+		item, _ := v.(map[string]any)
+		if item["type"] != "function_call" {
+			continue
+		}
+
+		id, _ := item["call_id"].(string)
+		name, _ := item["name"].(string)
+		arguments, _ := item["arguments"].(string)
+
+		calls = append(calls, toolCall{
+			ID:        id,
+			Name:      name,
+			Arguments: arguments,
+		})
+	}
+
+	return calls
+}
+
+func (responsesDialect) appendResults(
+	request, response map[string]any,
+	calls []toolCall,
+	results []toolResult,
+) {
+	var input []any
+
+	switch v := request["input"].(type) {
+	case string:
+		input = []any{
+			map[string]any{
+				"role":    "user",
+				"content": v,
+			},
+		}
+	case []any:
+		input = v
+	}
+
+	input = append(input, responsesOutput(response)...)
+	for i, call := range calls {
+		input = append(input, map[string]any{
+			"type":    "function_call_output",
+			"call_id": call.ID,
+			"output":  results[i].Output,
+		})
+	}
+
+	request["input"] = input
+}
+
+func (responsesDialect) disableTools(request map[string]any) {
+	request["tool_choice"] = "none"
+}
+
+func (responsesDialect) newOutput(
+	c *gin.Context,
+	servers []model.VirtualMCPServer,
+	stream bool,
+) output {
+	return &responsesOutputWriter{
+		c:       c,
+		servers: servers,
+		stream:  stream,
+	}
+}
+
+// responsesOutputWriter writes the tool calls of the rounds as the mcp_call
+// items of the Responses API
+type responsesOutputWriter struct {
+	c        *gin.Context
+	servers  []model.VirtualMCPServer
+	stream   bool
+	started  bool
+	sequence int
+	response map[string]any
+	items    []any
+}
+
+// stepItems replaces the function_call items of the turn by the mcp_call
+// items
+func (o *responsesOutputWriter) stepItems(
+	response map[string]any,
+	calls []toolCall,
+	results []toolResult,
+) []any {
+	byID := resultsByID(calls, results)
+
+	output := responsesOutput(response)
+
+	items := make([]any, 0, len(output))
+	for _, v := range output {
+		item, _ := v.(map[string]any)
+		if item["type"] != "function_call" {
+			items = append(items, v)
+			continue
+		}
+
+		callID, _ := item["call_id"].(string)
+		name, _ := item["name"].(string)
+		result := byID[callID]
+
+		id := item["id"]
+		if id == nil {
+			id = callID
+		}
+
+		call := map[string]any{
+			"type":         "mcp_call",
+			"id":           id,
+			"server_label": serverName(o.servers, name),
+			"name":         name,
+			"arguments":    item["arguments"],
+			"output":       result.Output,
+			"error":        nil,
+		}
+		if result.IsError {
+			call["output"] = nil
+			call["error"] = result.Output
+		}
+
+		items = append(items, call)
+	}
+
+	return items
+}
+
+func (o *responsesOutputWriter) event(event string, data map[string]any) {
+	data["type"] = event
+	data["sequence_number"] = o.sequence
+	o.sequence++
+
+	_ = render.ResponsesEventObjectData(o.c, event, data)
+}
+
+func (o *responsesOutputWriter) start(response map[string]any) {
+	if o.started {
+		return
+	}
+
+	o.started = true
+	o.response = response
+
+	startStream(o.c)
+
+	created := maps.Clone(response)
+	created["status"] = "in_progress"
+	created["output"] = []any{}
+	created["usage"] = nil
+
+	o.event("response.created", map[string]any{"response": created})
+	o.event("response.in_progress", map[string]any{"response": created})
+}
+
+// writeItem writes an output item as the added, the content and the done
+// events
+func (o *responsesOutputWriter) writeItem(v any) {
+	item, _ := v.(map[string]any)
+
+	index := len(o.items)
+	o.items = append(o.items, v)
+
+	added := item
+	content, _ := item["content"].([]any)
+
+	if item["type"] == "message" {
+		added = maps.Clone(item)
+		added["content"] = []any{}
+		added["status"] = "in_progress"
+	}
+
+	o.event("response.output_item.added", map[string]any{
+		"output_index": index,
+		"item":         added,
+	})
+
+	if item["type"] == "message" {
+		for j, p := range content {
+			part, _ := p.(map[string]any)
+			if part["type"] != "output_text" {
+				continue
+			}
+
+			o.event("response.content_part.added", map[string]any{
+				"item_id":       item["id"],
+				"output_index":  index,
+				"content_index": j,
+				"part": map[string]any{
+					"type":        "output_text",
+					"text":        "",
+					"annotations": []any{},
+				},
+			})
+			o.event("response.output_text.delta", map[string]any{
+				"item_id":       item["id"],
+				"output_index":  index,
+				"content_index": j,
+				"delta":         part["text"],
+			})
+			o.event("response.output_text.done", map[string]any{
+				"item_id":       item["id"],
+				"output_index":  index,
+				"content_index": j,
+				"text":          part["text"],
+			})
+			o.event("response.content_part.done", map[string]any{
+				"item_id":       item["id"],
+				"output_index":  index,
+				"content_index": j,
+				"part":          part,
+			})
+		}
+	}
+
+	o.event("response.output_item.done", map[string]any{
+		"output_index": index,
+		"item":         item,
+	})
+}
+
+func (o *responsesOutputWriter) step(
+	response map[string]any,
+	calls []toolCall,
+	results []toolResult,
+) {
+	items := o.stepItems(response, calls, results)
+	if !o.stream {
+		o.items = append(o.items, items...)
+		return
+	}
+
+	o.start(response)
+
+	for _, item := range items {
+		o.writeItem(item)
+	}
+}
+
+func (o *responsesOutputWriter) finish(body []byte, response map[string]any, usage model.Usage) {
+	if !o.stream {
+		if len(o.items) == 0 {
+			writeJSON(o.c, body)
+			return
+		}
+
+		response["output"] = append(o.items, responsesOutput(response)...)
+		response["usage"] = chatUsage(usage).ToResponseUsage()
+
+		data, err := jsonAPI.Marshal(response)
+		if err != nil {
+			writeJSON(o.c, body)
+			return
+		}
+
+		writeJSON(o.c, data)
+
+		return
+	}
+
+	o.start(response)
+
+	for _, item := range responsesOutput(response) {
+		o.writeItem(item)
+	}
+
+	completed := maps.Clone(response)
+	// the response of the first turn is the one the client has seen
+	completed["id"] = o.response["id"]
+	completed["output"] = o.items
+	completed["usage"] = chatUsage(usage).ToResponseUsage()
+
+	o.event("response.completed", map[string]any{"response": completed})
+}
+
+func (o *responsesOutputWriter) fail(err adaptor.Error) bool {
+	if !o.stream || !o.started {
+		return false
+	}
+
+	data, marshalErr := err.MarshalJSON()
+	if marshalErr != nil {
+		return false
+	}
+
+	render.ResponsesEventData(o.c, "error", data)
+
+	return true
+}
@@ -0,0 +1,165 @@
+package mcptools
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"sync"
+
+	"github.com/bytedance/sonic"
+	mcpservers "github.com/labring/aiproxy/mcp-servers"
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// toolDefinition is a mcp tool attached to the request
+type toolDefinition struct {
+	Name        string
+	Description string
+	Parameters  json.RawMessage
+}
+
+func toolDefinitions(tools []mcp.Tool) ([]toolDefinition, error) {
+	definitions := make([]toolDefinition, 0, len(tools))
+
+	for _, tool := range tools {
+		data, err := sonic.Marshal(tool)
+		if err != nil {
+			return nil, err
+		}
+
+		var schema struct {
+			InputSchema json.RawMessage `json:"inputSchema"`
+		}
+		if err := sonic.Unmarshal(data, &schema); err != nil {
+			return nil, err
+		}
+
+		parameters := schema.InputSchema
+		if len(parameters) == 0 || string(parameters) == "null" {
+			parameters = json.RawMessage(`{"type":"object","properties":{}}`)
+		}
+
+		definitions = append(definitions, toolDefinition{
+			Name:        tool.Name,
+			Description: tool.Description,
+			Parameters:  parameters,
+		})
+	}
+
+	return definitions, nil
+}
+
+// toolCall is a tool call of a model turn, the arguments are a json object
+type toolCall struct {
+	ID        string
+	Name      string
+	Arguments string
+}
+
+type toolResult struct {
+	Output  string
+	IsError bool
+}
+
+// callTools calls the tools of a turn concurrently
+func callTools(ctx context.Context, server mcpservers.Server, calls []toolCall) []toolResult {
+	results := make([]toolResult, len(calls))
+
+	var wg sync.WaitGroup
+	for i, call := range calls {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			results[i] = callTool(ctx, server, i+1, call)
+		}()
+	}
+
+	wg.Wait()
+
+	return results
+}
+
+func callTool(ctx context.Context, server mcpservers.Server, id int, call toolCall) toolResult {
+	arguments := json.RawMessage(call.Arguments)
+	if strings.TrimSpace(call.Arguments) == "" {
+		arguments = json.RawMessage(`{}`)
+	} else if !json.Valid(arguments) {
+		return toolResult{Output: "invalid tool arguments: " + call.Arguments, IsError: true}
+	}
+
+	message, err := sonic.Marshal(map[string]any{
+		"jsonrpc": mcp.JSONRPC_VERSION,
+		"id":      id,
+		"method":  string(mcp.MethodToolsCall),
+		"params": map[string]any{
+			"name":      call.Name,
+			"arguments": arguments,
+		},
+	})
+	if err != nil {
+		return toolResult{Output: err.Error(), IsError: true}
+	}
+
+	resp := server.HandleMessage(ctx, message)
+	if resp == nil {
+		return toolResult{Output: "no response from the mcp server", IsError: true}
+	}
+
+	data, err := sonic.Marshal(resp)
+	if err != nil {
+		return toolResult{Output: err.Error(), IsError: true}
+	}
+
+	var rpc struct {
+		Result *struct {
+			Content           []json.RawMessage `json:"content"`
+			StructuredContent json.RawMessage   `json:"structuredContent"`
+			IsError           bool              `json:"isError"`
+		} `json:"result"`
+		Error *struct {
+			Message string `json:"message"`
+		} `json:"error"`
+	}
+	if err := sonic.Unmarshal(data, &rpc); err != nil {
+		return toolResult{Output: err.Error(), IsError: true}
+	}
+
+	if rpc.Error != nil {
+		return toolResult{Output: rpc.Error.Message, IsError: true}
+	}
+
+	if rpc.Result == nil {
+		return toolResult{Output: "empty result from the mcp server", IsError: true}
+	}
+
+	return toolResult{
+		Output:  contentText(rpc.Result.Content, rpc.Result.StructuredContent),
+		IsError: rpc.Result.IsError,
+	}
+}
+
+// contentText joins the text contents, the other contents are kept as json
+func contentText(contents []json.RawMessage, structured json.RawMessage) string {
+	if len(contents) == 0 && len(structured) > 0 {
+		return string(structured)
+	}
+
+	parts := make([]string, 0, len(contents))
+
+	for _, content := range contents {
+		var text struct {
+			Type string `json:"type"`
+			Text string `json:"text"`
+		}
+		if err := sonic.Unmarshal(content, &text); err == nil && text.Type == "text" {
+			parts = append(parts, text.Text)
+			continue
+		}
+
+		parts = append(parts, string(content))
+	}
+
+	return strings.Join(parts, "\n")
+}
@@ -0,0 +1,56 @@
+package moderation
+
+const PluginName = "moderation"
+
+// Action is what the plugin does with the flagged content
+type Action string
+
+const (
+	// ActionBlock rejects the flagged prompt or replaces the flagged output with an error
+	ActionBlock Action = "block"
+	// ActionFlag only records the flagged content in the log metadata
+	ActionFlag Action = "flag"
+)
+
+const (
+	defaultStreamWindow  = 500
+	defaultStreamOverlap = 100
+	defaultMaxInputSize  = 8000
+)
+
+type Config struct {
+	Enable bool `json:"enable"`
+	// Model is the moderation model, it must be available in a channel
+	Model string `json:"model"`
+	// CheckPrompt checks the last user message before the request is sent,
+	// default is true
+	CheckPrompt bool `json:"check_prompt"`
+	// CheckOutput checks the completed output, streams are checked in windows
+	CheckOutput bool `json:"check_output"`
+	// Action is the action of the flagged content, default is block
+	Action Action `json:"action,omitempty"`
+	// Categories only count these categories as flagged, default is the
+	// flagged field of the moderation result
+	Categories []string `json:"categories,omitempty"`
+	// StreamWindow is the number of characters of each stream window, the
+	// events of a window are held until the window is checked
+	StreamWindow int `json:"stream_window,omitempty"`
+	// StreamOverlap is the number of characters of the previous window that
+	// are checked again with the next window
+	StreamOverlap int `json:"stream_overlap,omitempty"`
+	// MaxInputSize splits the long text into inputs of this number of characters
+	MaxInputSize int `json:"max_input_size,omitempty"`
+	// FailClosed blocks the content when the moderation call fails, the
+	// content passes by default
+	FailClosed bool `json:"fail_closed,omitempty"`
+}
+
+func defaultConfig() Config {
+	return Config{
+		CheckPrompt:   true,
+		Action:        ActionBlock,
+		StreamWindow:  defaultStreamWindow,
+		StreamOverlap: defaultStreamOverlap,
+		MaxInputSize:  defaultMaxInputSize,
+	}
+}
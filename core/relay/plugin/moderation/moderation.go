@@ -0,0 +1,559 @@
+// Package moderation checks the prompts and the outputs through a configured
+// moderation model, the flagged content is blocked or only flagged in the log
+package moderation
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/bytedance/sonic"
+	"github.com/gin-gonic/gin"
+	"github.com/labring/aiproxy/core/common"
+	"github.com/labring/aiproxy/core/common/balance"
+	"github.com/labring/aiproxy/core/common/consume"
+	"github.com/labring/aiproxy/core/middleware"
+	"github.com/labring/aiproxy/core/model"
+	"github.com/labring/aiproxy/core/relay/adaptor"
+	"github.com/labring/aiproxy/core/relay/adaptor/openai"
+	"github.com/labring/aiproxy/core/relay/adaptors"
+	"github.com/labring/aiproxy/core/relay/controller"
+	"github.com/labring/aiproxy/core/relay/meta"
+	"github.com/labring/aiproxy/core/relay/mode"
+	relaymodel "github.com/labring/aiproxy/core/relay/model"
+	"github.com/labring/aiproxy/core/relay/plugin"
+	"github.com/labring/aiproxy/core/relay/plugin/noop"
+	"github.com/labring/aiproxy/core/relay/utils"
+)
+
+var _ plugin.Plugin = (*Moderation)(nil)
+
+// Constants for metadata keys
+const (
+	moderationStatus     = "moderation_status"
+	moderationStage      = "moderation_stage"
+	moderationCategories = "moderation_categories"
+	// promptCheckedKey keeps the prompt result in the gin context so the
+	// retries do not check the prompt again
+	promptCheckedKey = "moderation_prompt_checked"
+	// promptKey keeps the prompt read when the request is converted
+	promptKey = "moderation_prompt"
+	// blockedOutputKey keeps the error that replaced the blocked output
+	blockedOutputKey = "moderation_blocked_output"
+)
+
+// Moderation stages
+const (
+	StagePrompt     = "prompt"
+	StageToolResult = "tool_result"
+	StageOutput     = "output"
+)
+
+// Moderation statuses
+const (
+	StatusPassed  = "passed"
+	StatusFlagged = "flagged"
+	StatusBlocked = "blocked"
+	StatusError   = "error"
+)
+
+// ErrorTypeModeration is the error type of the blocked content
+const ErrorTypeModeration = "moderation_flagged"
+
+// supportedModes are the modes whose prompts and outputs are checked
+var supportedModes = map[mode.Mode]struct{}{
+	mode.ChatCompletions: {},
+	mode.Completions:     {},
+	mode.Anthropic:       {},
+	mode.Gemini:          {},
+	mode.Responses:       {},
+}
+
+type GetChannel func(modelName string) (*model.Channel, error)
+
+// Moderate sends the inputs to the moderation model
+type Moderate func(
+	c *gin.Context,
+	m *meta.Meta,
+	store adaptor.Store,
+	modelName string,
+	inputs []string,
+) (*Response, error)
+
+// Response is the openai moderation response
+type Response struct {
+	Results []Result `json:"results"`
+}
+
+type Result struct {
+	Flagged    bool            `json:"flagged"`
+	Categories map[string]bool `json:"categories"`
+}
+
+// Moderation checks the content through the moderation model
+type Moderation struct {
+	noop.Noop
+	GetChannel  GetChannel
+	Moderate    Moderate
+	configCache utils.PluginConfigCache[Config]
+}
+
+// NewModerationPlugin creates a new moderation plugin
+func NewModerationPlugin(getChannel GetChannel) *Moderation {
+	return newModeration(getChannel)
+}
+
+func newModeration(getChannel GetChannel) *Moderation {
+	p := &Moderation{
+		GetChannel: getChannel,
+	}
+	p.Moderate = p.moderate
+
+	return p
+}
+
+// verdict is the result of a check
+type verdict struct {
+	stage      string
+	status     string
+	categories []string
+}
+
+// LogMetadata returns the moderation result of the request as log metadata
+func LogMetadata(meta *meta.Meta) map[string]string {
+	status := meta.GetString(moderationStatus)
+	if status == "" {
+		return nil
+	}
+
+	metadata := map[string]string{
+		moderationStatus: status,
+		moderationStage:  meta.GetString(moderationStage),
+	}
+	if categories := meta.GetString(moderationCategories); categories != "" {
+		metadata[moderationCategories] = categories
+	}
+
+	return metadata
+}
+
+// BlockedOutputError returns the error that replaced the blocked output, the
+// upstream response succeeded so the relay records the request with this error
+// instead of a success
+func BlockedOutputError(meta *meta.Meta) adaptor.Error {
+	v, ok := meta.Get(blockedOutputKey)
+	if !ok {
+		return nil
+	}
+
+	err, _ := v.(adaptor.Error)
+
+	return err
+}
+
+// withoutOutput removes the output of the usage, the suppressed output is not
+// billed while the prompt was still processed by the upstream
+func withoutOutput(usage model.Usage) model.Usage {
+	usage.TotalTokens -= usage.OutputTokens + usage.ImageOutputTokens + usage.AudioOutputTokens
+	usage.OutputTokens = 0
+	usage.ImageOutputTokens = 0
+	usage.AudioOutputTokens = 0
+	usage.ReasoningTokens = 0
+
+	return usage
+}
+
+// record keeps the most severe verdict of the request in meta
+func record(meta *meta.Meta, v verdict) {
+	if statusSeverity(v.status) < statusSeverity(meta.GetString(moderationStatus)) {
+		return
+	}
+
+	meta.Set(moderationStatus, v.status)
+	meta.Set(moderationStage, v.stage)
+	meta.Set(moderationCategories, strings.Join(v.categories, ","))
+}
+
+func statusSeverity(status string) int {
+	switch status {
+	case StatusBlocked:
+		return 4
+	case StatusFlagged:
+		return 3
+	case StatusError:
+		return 2
+	case StatusPassed:
+		return 1
+	default:
+		return 0
+	}
+}
+
+func (p *Moderation) loadConfig(meta *meta.Meta) (Config, bool) {
+	if _, ok := supportedModes[meta.Mode]; !ok {
+		return Config{}, false
+	}
+
+	config, err := p.configCache.Load(meta, PluginName, defaultConfig())
+	if err != nil || !config.Enable || config.Model == "" {
+		return Config{}, false
+	}
+
+	return config, true
+}
+
+// flaggedCategories returns the flagged categories of the response, only the
+// configured categories are counted when they are set
+func flaggedCategories(config Config, resp *Response) (bool, []string) {
+	flagged := false
+	categories := make([]string, 0)
+
+	for _, result := range resp.Results {
+		if len(config.Categories) == 0 && result.Flagged {
+			flagged = true
+		}
+
+		for category, hit := range result.Categories {
+			if !hit || slices.Contains(categories, category) {
+				continue
+			}
+
+			if len(config.Categories) > 0 {
+				if !slices.Contains(config.Categories, category) {
+					continue
+				}
+
+				flagged = true
+			}
+
+			categories = append(categories, category)
+		}
+	}
+
+	slices.Sort(categories)
+
+	return flagged, categories
+}
+
+// check moderates the text, the returned error is not nil when the content is
+// blocked
+func (p *Moderation) check(
+	c *gin.Context,
+	meta *meta.Meta,
+	store adaptor.Store,
+	config Config,
+	stage, text string,
+) (verdict, adaptor.Error) {
+	v := verdict{stage: stage, status: StatusPassed}
+
+	resp, err := p.Moderate(c, meta, store, config.Model, splitInput(text, config.MaxInputSize))
+	if err != nil {
+		common.GetLogger(c).Errorf("moderation %s failed: %v", stage, err)
+
+		v.status = StatusError
+		record(meta, v)
+
+		if config.FailClosed {
+			return v, relaymodel.WrapperErrorWithMessage(
+				meta.Mode,
+				http.StatusServiceUnavailable,
+				"moderation failed",
+				relaymodel.WithType(ErrorTypeModeration),
+			)
+		}
+
+		return v, nil
+	}
+
+	flagged, categories := flaggedCategories(config, resp)
+	v.categories = categories
+
+	if !flagged {
+		record(meta, v)
+		return v, nil
+	}
+
+	if config.Action == ActionFlag {
+		v.status = StatusFlagged
+		record(meta, v)
+
+		return v, nil
+	}
+
+	v.status = StatusBlocked
+	record(meta, v)
+
+	message := fmt.Sprintf("%s flagged by moderation", stage)
+	if len(categories) > 0 {
+		message += ": " + strings.Join(categories, ", ")
+	}
+
+	return v, relaymodel.WrapperErrorWithMessage(
+		meta.Mode,
+		http.StatusBadRequest,
+		message,
+		relaymodel.WithType(ErrorTypeModeration),
+	)
+}
+
+// ConvertRequest reads the last user message after the prompt and guardrails
+// plugins, the client body may still hold the redacted content and miss the
+// expanded prompts
+func (p *Moderation) ConvertRequest(
+	meta *meta.Meta,
+	store adaptor.Store,
+	req *http.Request,
+	do adaptor.ConvertRequest,
+) (adaptor.ConvertResult, error) {
+	config, ok := p.loadConfig(meta)
+	if !ok || !config.CheckPrompt {
+		return do.ConvertRequest(meta, store, req)
+	}
+
+	body, err := common.GetRequestBodyReusable(req)
+	if err != nil {
+		return adaptor.ConvertResult{}, err
+	}
+
+	meta.Set(promptKey, extractPrompt(body))
+
+	return do.ConvertRequest(meta, store, req)
+}
+
+// DoRequest checks the last user message before the request is sent
+func (p *Moderation) DoRequest(
+	meta *meta.Meta,
+	store adaptor.Store,
+	c *gin.Context,
+	req *http.Request,
+	do adaptor.DoRequest,
+) (*http.Response, error) {
+	config, ok := p.loadConfig(meta)
+	if !ok || !config.CheckPrompt {
+		return do.DoRequest(meta, store, c, req)
+	}
+
+	if v, ok := c.Get(promptCheckedKey); ok {
+		checked, _ := v.(verdict)
+		record(meta, checked)
+
+		return do.DoRequest(meta, store, c, req)
+	}
+
+	text := meta.GetString(promptKey)
+	if strings.TrimSpace(text) == "" {
+		return do.DoRequest(meta, store, c, req)
+	}
+
+	v, blockErr := p.check(c, meta, store, config, StagePrompt, text)
+	if blockErr != nil {
+		return nil, blockErr
+	}
+
+	c.Set(promptCheckedKey, v)
+
+	return do.DoRequest(meta, store, c, req)
+}
+
+// CheckToolResults checks the results of the mcp tool calls like the prompt,
+// they are sent to the model in the turns after the prompt was checked
+func (p *Moderation) CheckToolResults(
+	c *gin.Context,
+	meta *meta.Meta,
+	store adaptor.Store,
+	outputs []string,
+) ([]string, error) {
+	config, ok := p.loadConfig(meta)
+	if !ok || !config.CheckPrompt {
+		return outputs, nil
+	}
+
+	text := strings.Join(outputs, "\n")
+	if strings.TrimSpace(text) == "" {
+		return outputs, nil
+	}
+
+	if _, blockErr := p.check(c, meta, store, config, StageToolResult, text); blockErr != nil {
+		return nil, blockErr
+	}
+
+	return outputs, nil
+}
+
+// DoResponse checks the output, non-stream responses are held until they are
+// checked and streams are checked in windows, a blocked output is recorded
+// with its error and only the prompt is billed
+func (p *Moderation) DoResponse(
+	meta *meta.Meta,
+	store adaptor.Store,
+	c *gin.Context,
+	resp *http.Response,
+	do adaptor.DoResponse,
+) (adaptor.DoResponseResult, adaptor.Error) {
+	config, ok := p.loadConfig(meta)
+	if !ok || !config.CheckOutput {
+		return do.DoResponse(meta, store, c, resp)
+	}
+
+	rw := &responseWriter{
+		ResponseWriter: c.Writer,
+		plugin:         p,
+		c:              c,
+		meta:           meta,
+		store:          store,
+		config:         config,
+	}
+
+	c.Writer = rw
+	defer func() {
+		c.Writer = rw.ResponseWriter
+	}()
+
+	result, err := do.DoResponse(meta, store, c, resp)
+	if err != nil {
+		rw.discard()
+		return result, err
+	}
+
+	rw.finish()
+
+	if rw.blockErr != nil {
+		meta.Set(blockedOutputKey, rw.blockErr)
+		result.Usage = withoutOutput(result.Usage)
+	}
+
+	return result, nil
+}
+
+func (p *Moderation) moderate(
+	c *gin.Context,
+	m *meta.Meta,
+	store adaptor.Store,
+	modelName string,
+	inputs []string,
+) (*Response, error) {
+	if p.GetChannel == nil {
+		return nil, errors.New("moderation channel getter is not set")
+	}
+
+	channel, err := p.GetChannel(modelName)
+	if err != nil {
+		return nil, err
+	}
+
+	a, ok := adaptors.GetAdaptor(channel.Type)
+	if !ok {
+		return nil, errors.New("adaptor not found")
+	}
+
+	body, err := sonic.Marshal(map[string]any{
+		"model": modelName,
+		"input": inputs,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	modelConfig := model.ModelConfig{
+		Model: modelName,
+		Type:  mode.Moderations,
+	}
+	if caches := model.LoadModelCaches(); caches != nil && caches.ModelConfig != nil {
+		if mc, ok := caches.ModelConfig.GetModelConfig(modelName); ok {
+			modelConfig = mc
+		}
+	}
+
+	requestID := m.RequestID + "-moderation"
+
+	w := httptest.NewRecorder()
+	newc, _ := gin.CreateTestContext(w)
+	newc.Request = &http.Request{
+		URL:    &url.URL{},
+		Body:   io.NopCloser(bytes.NewReader(body)),
+		Header: make(http.Header),
+	}
+	newc.Request.Header.Set("Content-Type", "application/json")
+	middleware.SetRequestID(newc, requestID)
+
+	inputTokens := int64(0)
+	for _, input := range inputs {
+		inputTokens += openai.CountTokenText(input, modelName)
+	}
+
+	newMeta := meta.NewMeta(
+		channel,
+		mode.Moderations,
+		modelName,
+		modelConfig,
+		meta.WithRequestID(requestID),
+		meta.WithGroup(m.Group),
+		meta.WithToken(m.Token),
+		meta.WithRequestUsage(model.Usage{
+			InputTokens: model.ZeroNullInt64(inputTokens),
+			TotalTokens: model.ZeroNullInt64(inputTokens),
+		}),
+	)
+
+	result := controller.Handle(a, newc, newMeta, store)
+
+	// the moderation call is billed to the group of the request
+	consumeModeration(c, m, newMeta, result)
+
+	if result.Error != nil {
+		return nil, result.Error
+	}
+
+	var resp Response
+	if err := sonic.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		return nil, err
+	}
+
+	return &resp, nil
+}
+
+func consumeModeration(
+	c *gin.Context,
+	m *meta.Meta,
+	moderationMeta *meta.Meta,
+	result *controller.HandleResult,
+) {
+	code := http.StatusOK
+	content := ""
+
+	if result.Error != nil {
+		code = result.Error.StatusCode()
+		respBody, _ := result.Error.MarshalJSON()
+		content = string(respBody)
+	}
+
+	var consumer balance.PostGroupConsumer
+	if gbc := middleware.GetGroupBalanceConsumerFromContext(c); gbc != nil {
+		consumer = gbc.Consumer
+	}
+
+	consume.AsyncConsume(
+		consumer,
+		code,
+		time.Time{},
+		moderationMeta,
+		result.Usage,
+		result.UsageContext,
+		moderationMeta.ModelConfig.Price,
+		content,
+		c.ClientIP(),
+		0,
+		nil,
+		true,
+		map[string]string{"moderation_for": m.RequestID},
+		result.UpstreamID,
+		model.AsyncUsageStatusNone,
+	)
+}
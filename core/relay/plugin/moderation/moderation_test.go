@@ -0,0 +1,456 @@
+package moderation_test
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/bytedance/sonic"
+	"github.com/gin-gonic/gin"
+	"github.com/labring/aiproxy/core/model"
+	"github.com/labring/aiproxy/core/relay/adaptor"
+	"github.com/labring/aiproxy/core/relay/meta"
+	"github.com/labring/aiproxy/core/relay/mode"
+	"github.com/labring/aiproxy/core/relay/plugin/moderation"
+	"github.com/labring/aiproxy/core/relay/render"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type doRequestFunc func(*meta.Meta, adaptor.Store, *gin.Context, *http.Request) (*http.Response, error)
+
+func (f doRequestFunc) DoRequest(
+	meta *meta.Meta,
+	store adaptor.Store,
+	c *gin.Context,
+	req *http.Request,
+) (*http.Response, error) {
+	return f(meta, store, c, req)
+}
+
+type doResponseFunc func(*meta.Meta, adaptor.Store, *gin.Context, *http.Response) (adaptor.DoResponseResult, adaptor.Error)
+
+func (f doResponseFunc) DoResponse(
+	meta *meta.Meta,
+	store adaptor.Store,
+	c *gin.Context,
+	resp *http.Response,
+) (adaptor.DoResponseResult, adaptor.Error) {
+	return f(meta, store, c, resp)
+}
+
+// fakeModeration flags the inputs containing "attack" and records the inputs
+type fakeModeration struct {
+	inputs [][]string
+	err    error
+}
+
+func (f *fakeModeration) moderate(
+	_ *gin.Context,
+	_ *meta.Meta,
+	_ adaptor.Store,
+	_ string,
+	inputs []string,
+) (*moderation.Response, error) {
+	f.inputs = append(f.inputs, inputs)
+	if f.err != nil {
+		return nil, f.err
+	}
+
+	resp := &moderation.Response{}
+	for _, input := range inputs {
+		flagged := strings.Contains(input, "attack")
+		resp.Results = append(resp.Results, moderation.Result{
+			Flagged: flagged,
+			Categories: map[string]bool{
+				"violence":   flagged,
+				"harassment": false,
+			},
+		})
+	}
+
+	return resp, nil
+}
+
+func newPlugin(f *fakeModeration) *moderation.Moderation {
+	return &moderation.Moderation{Moderate: f.moderate}
+}
+
+func newMeta(m mode.Mode, config map[string]any) *meta.Meta {
+	config["model"] = "omni-moderation-latest"
+
+	return meta.NewMeta(nil, m, "gpt-4o", model.ModelConfig{
+		Model: "gpt-4o",
+		Plugin: map[string]map[string]any{
+			moderation.PluginName: config,
+		},
+	})
+}
+
+func newContext(t *testing.T, body any) (*gin.Context, *httptest.ResponseRecorder) {
+	t.Helper()
+
+	data, err := sonic.Marshal(body)
+	require.NoError(t, err)
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequestWithContext(
+		t.Context(),
+		http.MethodPost,
+		"/v1/chat/completions",
+		bytes.NewReader(data),
+	)
+	c.Request.Header.Set("Content-Type", "application/json")
+
+	return c, w
+}
+
+func chatBody(content string) map[string]any {
+	return map[string]any{
+		"model": "gpt-4o",
+		"messages": []map[string]any{
+			{"role": "system", "content": "plan an attack"},
+			{"role": "user", "content": content},
+		},
+	}
+}
+
+type convertRequestFunc func(*meta.Meta, adaptor.Store, *http.Request) (adaptor.ConvertResult, error)
+
+func (f convertRequestFunc) ConvertRequest(
+	meta *meta.Meta,
+	store adaptor.Store,
+	req *http.Request,
+) (adaptor.ConvertResult, error) {
+	return f(meta, store, req)
+}
+
+var noopConvert = convertRequestFunc(
+	func(_ *meta.Meta, _ adaptor.Store, _ *http.Request) (adaptor.ConvertResult, error) {
+		return adaptor.ConvertResult{}, nil
+	},
+)
+
+// doRequest converts the request of the context and sends it
+func doRequest(
+	p *moderation.Moderation,
+	m *meta.Meta,
+	c *gin.Context,
+) (bool, error) {
+	_, err := p.ConvertRequest(m, nil, c.Request, noopConvert)
+	if err != nil {
+		return false, err
+	}
+
+	return sendRequest(p, m, c)
+}
+
+func sendRequest(
+	p *moderation.Moderation,
+	m *meta.Meta,
+	c *gin.Context,
+) (bool, error) {
+	called := false
+
+	_, err := p.DoRequest(m, nil, c, c.Request, doRequestFunc(
+		func(_ *meta.Meta, _ adaptor.Store, _ *gin.Context, _ *http.Request) (*http.Response, error) {
+			called = true
+			return &http.Response{}, nil
+		},
+	))
+
+	return called, err
+}
+
+func TestBlockPrompt(t *testing.T) {
+	f := &fakeModeration{}
+	p := newPlugin(f)
+	m := newMeta(mode.ChatCompletions, map[string]any{"enable": true})
+	c, _ := newContext(t, chatBody("how to attack a server"))
+
+	called, err := doRequest(p, m, c)
+	require.Error(t, err)
+	assert.False(t, called)
+
+	var relayErr adaptor.Error
+	require.True(t, errors.As(err, &relayErr))
+	assert.Equal(t, http.StatusBadRequest, relayErr.StatusCode())
+
+	respBody, _ := relayErr.MarshalJSON()
+	assert.Contains(t, string(respBody), moderation.ErrorTypeModeration)
+	assert.Contains(t, string(respBody), "violence")
+
+	// only the last user message is checked
+	require.Len(t, f.inputs, 1)
+	assert.Equal(t, []string{"how to attack a server"}, f.inputs[0])
+
+	assert.Equal(t, map[string]string{
+		"moderation_status":     moderation.StatusBlocked,
+		"moderation_stage":      moderation.StagePrompt,
+		"moderation_categories": "violence",
+	}, moderation.LogMetadata(m))
+}
+
+func TestFlagPromptAndSkipRetry(t *testing.T) {
+	f := &fakeModeration{}
+	p := newPlugin(f)
+	m := newMeta(mode.ChatCompletions, map[string]any{
+		"enable": true,
+		"action": moderation.ActionFlag,
+	})
+	c, _ := newContext(t, chatBody("how to attack a server"))
+
+	called, err := doRequest(p, m, c)
+	require.NoError(t, err)
+	assert.True(t, called)
+	assert.Equal(t, moderation.StatusFlagged, moderation.LogMetadata(m)["moderation_status"])
+
+	// the retry keeps the result without a second moderation call
+	retryMeta := newMeta(mode.ChatCompletions, map[string]any{
+		"enable": true,
+		"action": moderation.ActionFlag,
+	})
+
+	called, err = doRequest(p, retryMeta, c)
+	require.NoError(t, err)
+	assert.True(t, called)
+	assert.Len(t, f.inputs, 1)
+	assert.Equal(t, moderation.LogMetadata(m), moderation.LogMetadata(retryMeta))
+}
+
+func TestCheckConvertedPrompt(t *testing.T) {
+	f := &fakeModeration{}
+	p := newPlugin(f)
+	m := newMeta(mode.ChatCompletions, map[string]any{"enable": true})
+	c, _ := newContext(t, chatBody("mail admin@example.com about the attack"))
+
+	// the outer plugins such as guardrails pass a rewritten body
+	data, err := sonic.Marshal(chatBody("mail [REDACTED_EMAIL] about the attack"))
+	require.NoError(t, err)
+
+	converted := httptest.NewRequestWithContext(
+		t.Context(),
+		http.MethodPost,
+		"/v1/chat/completions",
+		bytes.NewReader(data),
+	)
+
+	_, err = p.ConvertRequest(m, nil, converted, noopConvert)
+	require.NoError(t, err)
+
+	called, err := sendRequest(p, m, c)
+	require.Error(t, err)
+	assert.False(t, called)
+
+	require.Len(t, f.inputs, 1)
+	assert.Equal(t, []string{"mail [REDACTED_EMAIL] about the attack"}, f.inputs[0])
+}
+
+func TestCheckToolResults(t *testing.T) {
+	f := &fakeModeration{}
+	p := newPlugin(f)
+	m := newMeta(mode.ChatCompletions, map[string]any{"enable": true})
+	c, _ := newContext(t, chatBody("hello"))
+
+	outputs, err := p.CheckToolResults(c, m, nil, []string{"sunny", "in Paris"})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"sunny", "in Paris"}, outputs)
+
+	_, err = p.CheckToolResults(c, m, nil, []string{"plan the attack"})
+	require.ErrorContains(t, err, "tool_result flagged by moderation")
+
+	require.Len(t, f.inputs, 2)
+	assert.Equal(t, []string{"sunny\nin Paris"}, f.inputs[0])
+	assert.Equal(t, moderation.StageToolResult, moderation.LogMetadata(m)["moderation_stage"])
+}
+
+func TestPromptModerationFailure(t *testing.T) {
+	f := &fakeModeration{err: errors.New("upstream down")}
+
+	m := newMeta(mode.ChatCompletions, map[string]any{"enable": true})
+	c, _ := newContext(t, chatBody("hello"))
+
+	called, err := doRequest(newPlugin(f), m, c)
+	require.NoError(t, err)
+	assert.True(t, called)
+	assert.Equal(t, moderation.StatusError, moderation.LogMetadata(m)["moderation_status"])
+
+	m = newMeta(mode.ChatCompletions, map[string]any{
+		"enable":      true,
+		"fail_closed": true,
+	})
+	c, _ = newContext(t, chatBody("hello"))
+
+	called, err = doRequest(newPlugin(f), m, c)
+	require.Error(t, err)
+	assert.False(t, called)
+
+	var relayErr adaptor.Error
+	require.True(t, errors.As(err, &relayErr))
+	assert.Equal(t, http.StatusServiceUnavailable, relayErr.StatusCode())
+}
+
+func TestBlockOutput(t *testing.T) {
+	p := newPlugin(&fakeModeration{})
+	m := newMeta(mode.ChatCompletions, map[string]any{
+		"enable":       true,
+		"check_prompt": false,
+		"check_output": true,
+	})
+	c, w := newContext(t, chatBody("hello"))
+
+	upstreamBody := `{"choices":[{"index":0,"message":{"role":"assistant","content":"first attack the server"}}]}`
+
+	res, relayErr := p.DoResponse(m, nil, c, &http.Response{}, doResponseFunc(
+		func(_ *meta.Meta, _ adaptor.Store, c *gin.Context, _ *http.Response) (adaptor.DoResponseResult, adaptor.Error) {
+			c.Header("Content-Type", "application/json")
+			c.Header("Content-Length", fmt.Sprint(len(upstreamBody)))
+			c.Status(http.StatusOK)
+			_, _ = c.Writer.Write([]byte(upstreamBody))
+
+			return adaptor.DoResponseResult{
+				Usage: model.Usage{InputTokens: 10, OutputTokens: 5, TotalTokens: 15},
+			}, nil
+		},
+	))
+	require.Nil(t, relayErr)
+
+	// only the prompt is billed, the suppressed output is not
+	assert.Equal(t, model.ZeroNullInt64(10), res.Usage.TotalTokens)
+	assert.Equal(t, model.ZeroNullInt64(0), res.Usage.OutputTokens)
+
+	blockErr := moderation.BlockedOutputError(m)
+	require.NotNil(t, blockErr)
+	assert.Equal(t, http.StatusBadRequest, blockErr.StatusCode())
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.NotContains(t, w.Body.String(), "first attack")
+	assert.Contains(t, w.Body.String(), moderation.ErrorTypeModeration)
+	assert.Equal(t, fmt.Sprint(w.Body.Len()), w.Header().Get("Content-Length"))
+	assert.Equal(t, moderation.StageOutput, moderation.LogMetadata(m)["moderation_stage"])
+}
+
+func TestPassOutput(t *testing.T) {
+	p := newPlugin(&fakeModeration{})
+	m := newMeta(mode.ChatCompletions, map[string]any{
+		"enable":       true,
+		"check_output": true,
+	})
+	c, w := newContext(t, chatBody("hello"))
+
+	upstreamBody := `{"choices":[{"index":0,"message":{"role":"assistant","content":"hi there"}}]}`
+
+	_, relayErr := p.DoResponse(m, nil, c, &http.Response{}, doResponseFunc(
+		func(_ *meta.Meta, _ adaptor.Store, c *gin.Context, _ *http.Response) (adaptor.DoResponseResult, adaptor.Error) {
+			c.Header("Content-Type", "application/json")
+			_, _ = c.Writer.Write([]byte(upstreamBody))
+			return adaptor.DoResponseResult{}, nil
+		},
+	))
+	require.Nil(t, relayErr)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, upstreamBody, w.Body.String())
+	assert.Equal(t, moderation.StatusPassed, moderation.LogMetadata(m)["moderation_status"])
+	assert.Nil(t, moderation.BlockedOutputError(m))
+}
+
+func streamChunk(content string) map[string]any {
+	return map[string]any{
+		"object": "chat.completion.chunk",
+		"choices": []map[string]any{
+			{"index": 0, "delta": map[string]any{"content": content}},
+		},
+	}
+}
+
+func TestBlockStreamWindow(t *testing.T) {
+	f := &fakeModeration{}
+	p := newPlugin(f)
+	m := newMeta(mode.ChatCompletions, map[string]any{
+		"enable":         true,
+		"check_prompt":   false,
+		"check_output":   true,
+		"stream_window":  10,
+		"stream_overlap": 4,
+	})
+	c, w := newContext(t, chatBody("hello"))
+
+	res, relayErr := p.DoResponse(m, nil, c, &http.Response{}, doResponseFunc(
+		func(_ *meta.Meta, _ adaptor.Store, c *gin.Context, _ *http.Response) (adaptor.DoResponseResult, adaptor.Error) {
+			for _, content := range []string{"Sure, here ", "is the plan: at", "tack the host", " and more"} {
+				if err := render.OpenaiObjectData(c, streamChunk(content)); err != nil {
+					return adaptor.DoResponseResult{}, nil
+				}
+			}
+
+			render.OpenaiDone(c)
+
+			return adaptor.DoResponseResult{
+				Usage: model.Usage{InputTokens: 10, OutputTokens: 8, TotalTokens: 18},
+			}, nil
+		},
+	))
+	require.Nil(t, relayErr)
+
+	assert.Equal(t, model.ZeroNullInt64(10), res.Usage.TotalTokens)
+	assert.NotNil(t, moderation.BlockedOutputError(m))
+
+	out := w.Body.String()
+
+	// the windows before the block passed and were written
+	assert.Contains(t, out, "Sure, here ")
+	assert.Contains(t, out, "is the plan: at")
+	// the flagged window was held and replaced with an error event
+	assert.NotContains(t, out, "tack the host")
+	assert.NotContains(t, out, "and more")
+	assert.NotContains(t, out, "[DONE]")
+	assert.Contains(t, out, moderation.ErrorTypeModeration)
+
+	// the word split across the windows is caught by the overlap
+	assert.Equal(t, [][]string{
+		{"Sure, here "},
+		{"ere is the plan: at"},
+		{": attack the host"},
+	}, f.inputs)
+	assert.Equal(t, moderation.StatusBlocked, moderation.LogMetadata(m)["moderation_status"])
+}
+
+func TestPassStreamAnthropic(t *testing.T) {
+	p := newPlugin(&fakeModeration{})
+	m := newMeta(mode.Anthropic, map[string]any{
+		"enable":        true,
+		"check_prompt":  false,
+		"check_output":  true,
+		"stream_window": 5,
+	})
+	c, w := newContext(t, chatBody("hello"))
+
+	events := []string{
+		`{"type":"content_block_delta","index":0,"delta":{"type":"text_delta","text":"Hello"}}`,
+		`{"type":"content_block_delta","index":0,"delta":{"type":"text_delta","text":" world"}}`,
+		`{"type":"message_stop"}`,
+	}
+
+	_, relayErr := p.DoResponse(m, nil, c, &http.Response{}, doResponseFunc(
+		func(_ *meta.Meta, _ adaptor.Store, c *gin.Context, _ *http.Response) (adaptor.DoResponseResult, adaptor.Error) {
+			for _, event := range events {
+				render.ClaudeData(c, []byte(event))
+			}
+
+			return adaptor.DoResponseResult{}, nil
+		},
+	))
+	require.Nil(t, relayErr)
+
+	for _, event := range events {
+		assert.Contains(t, w.Body.String(), event)
+	}
+
+	assert.Equal(t, moderation.StatusPassed, moderation.LogMetadata(m)["moderation_status"])
+}
@@ -0,0 +1,217 @@
+package moderation
+
+import (
+	"bytes"
+	"slices"
+	"strings"
+
+	"github.com/bytedance/sonic"
+)
+
+// textOf returns the text of a content, the content can be a string or a list
+// of strings and parts with a text field
+func textOf(content any) string {
+	switch v := content.(type) {
+	case string:
+		return v
+	case []any:
+		texts := make([]string, 0, len(v))
+		for _, item := range v {
+			switch part := item.(type) {
+			case string:
+				texts = append(texts, part)
+			case map[string]any:
+				if text, ok := part["text"].(string); ok {
+					texts = append(texts, text)
+				}
+			}
+		}
+
+		return strings.Join(texts, "\n")
+	default:
+		return ""
+	}
+}
+
+type promptMessage struct {
+	Role    string `json:"role"`
+	Content any    `json:"content"`
+}
+
+type promptPart struct {
+	Text string `json:"text"`
+}
+
+type promptContent struct {
+	Role  string       `json:"role"`
+	Parts []promptPart `json:"parts"`
+}
+
+// promptRequest holds the prompts of the chat, completions, anthropic, gemini
+// and responses requests
+type promptRequest struct {
+	Messages []promptMessage `json:"messages"`
+	Prompt   any             `json:"prompt"`
+	Contents []promptContent `json:"contents"`
+	Input    any             `json:"input"`
+}
+
+// extractPrompt returns the text of the last user message of the request
+func extractPrompt(body []byte) string {
+	var req promptRequest
+	if err := sonic.Unmarshal(body, &req); err != nil {
+		return ""
+	}
+
+	for _, msg := range slices.Backward(req.Messages) {
+		if msg.Role == "user" {
+			return textOf(msg.Content)
+		}
+	}
+
+	for _, content := range slices.Backward(req.Contents) {
+		if content.Role == "" || content.Role == "user" {
+			texts := make([]string, 0, len(content.Parts))
+			for _, part := range content.Parts {
+				texts = append(texts, part.Text)
+			}
+
+			return strings.Join(texts, "\n")
+		}
+	}
+
+	if text := textOf(req.Prompt); text != "" {
+		return text
+	}
+
+	switch input := req.Input.(type) {
+	case string:
+		return input
+	case []any:
+		for _, item := range slices.Backward(input) {
+			msg, ok := item.(map[string]any)
+			if !ok || msg["role"] != "user" {
+				continue
+			}
+
+			return textOf(msg["content"])
+		}
+	}
+
+	return ""
+}
+
+type outputChoice struct {
+	Text  string `json:"text"`
+	Delta struct {
+		Content any `json:"content"`
+	} `json:"delta"`
+	Message struct {
+		Content any `json:"content"`
+	} `json:"message"`
+}
+
+type outputCandidate struct {
+	Content promptContent `json:"content"`
+}
+
+type outputItem struct {
+	Content []promptPart `json:"content"`
+}
+
+// outputResponse holds the output text of the responses and the stream events
+// of the chat, completions, anthropic, gemini and responses apis
+type outputResponse struct {
+	Type       string            `json:"type"`
+	Choices    []outputChoice    `json:"choices"`
+	Content    []promptPart      `json:"content"`
+	Delta      any               `json:"delta"`
+	Candidates []outputCandidate `json:"candidates"`
+	Output     []outputItem      `json:"output"`
+}
+
+// extractOutput returns the output text of a response or a stream event
+func extractOutput(data []byte) string {
+	var resp outputResponse
+	if err := sonic.Unmarshal(data, &resp); err != nil {
+		return ""
+	}
+
+	var sb strings.Builder
+
+	for _, choice := range resp.Choices {
+		sb.WriteString(choice.Text)
+		sb.WriteString(textOf(choice.Delta.Content))
+		sb.WriteString(textOf(choice.Message.Content))
+	}
+
+	for _, part := range resp.Content {
+		sb.WriteString(part.Text)
+	}
+
+	switch delta := resp.Delta.(type) {
+	case string:
+		// responses api stream events
+		if resp.Type == "response.output_text.delta" {
+			sb.WriteString(delta)
+		}
+	case map[string]any:
+		// anthropic content block deltas
+		if text, ok := delta["text"].(string); ok {
+			sb.WriteString(text)
+		}
+	}
+
+	for _, candidate := range resp.Candidates {
+		for _, part := range candidate.Content.Parts {
+			sb.WriteString(part.Text)
+		}
+	}
+
+	for _, item := range resp.Output {
+		for _, part := range item.Content {
+			sb.WriteString(part.Text)
+		}
+	}
+
+	return sb.String()
+}
+
+var dataPrefix = []byte("data:")
+
+// extractEventOutput returns the output text of a server-sent event
+func extractEventOutput(event []byte) string {
+	var sb strings.Builder
+
+	for line := range bytes.SplitSeq(event, []byte("\n")) {
+		data, ok := bytes.CutPrefix(bytes.TrimSpace(line), dataPrefix)
+		if !ok {
+			continue
+		}
+
+		data = bytes.TrimSpace(data)
+		if len(data) == 0 || data[0] != '{' {
+			continue
+		}
+
+		sb.WriteString(extractOutput(data))
+	}
+
+	return sb.String()
+}
+
+// splitInput splits the text into inputs of at most size characters
+func splitInput(text string, size int) []string {
+	runes := []rune(text)
+	if size <= 0 || len(runes) <= size {
+		return []string{text}
+	}
+
+	inputs := make([]string, 0, len(runes)/size+1)
+	for start := 0; start < len(runes); start += size {
+		end := min(start+size, len(runes))
+		inputs = append(inputs, string(runes[start:end]))
+	}
+
+	return inputs
+}
@@ -0,0 +1,234 @@
+package moderation
+
+import (
+	"bytes"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/gin-gonic/gin"
+	"github.com/labring/aiproxy/core/relay/adaptor"
+	"github.com/labring/aiproxy/core/relay/meta"
+	"github.com/labring/aiproxy/core/relay/mode"
+	"github.com/labring/aiproxy/core/relay/utils"
+)
+
+var eventSeparator = []byte("\n\n")
+
+// responseWriter holds the output until it is checked, non-stream bodies are
+// held until the response is done and stream events are held until their
+// window is checked
+type responseWriter struct {
+	gin.ResponseWriter
+	plugin *Moderation
+	c      *gin.Context
+	meta   *meta.Meta
+	store  adaptor.Store
+	config Config
+
+	decided bool
+	stream  bool
+	blocked bool
+	// blockErr is the error written instead of the blocked output
+	blockErr adaptor.Error
+
+	// body is the non-stream response body
+	body bytes.Buffer
+	// pending is the incomplete stream event
+	pending bytes.Buffer
+	// held are the complete stream events of the current window
+	held bytes.Buffer
+	// window is the output text of the held events
+	window    strings.Builder
+	windowLen int
+	// tail is the end of the previous window, it is checked again with the
+	// next window so the content across windows is not missed
+	tail string
+}
+
+func (rw *responseWriter) Write(b []byte) (int, error) {
+	if rw.blocked {
+		return len(b), nil
+	}
+
+	if !rw.decided {
+		rw.decided = true
+		rw.stream = utils.IsStreamResponseWithHeader(rw.Header())
+	}
+
+	if !rw.stream {
+		return rw.body.Write(b)
+	}
+
+	rw.pending.Write(b)
+
+	for {
+		event, rest, ok := bytes.Cut(rw.pending.Bytes(), eventSeparator)
+		if !ok {
+			break
+		}
+
+		rw.addEvent(append(bytes.Clone(event), eventSeparator...))
+
+		remaining := bytes.Clone(rest)
+		rw.pending.Reset()
+		rw.pending.Write(remaining)
+
+		if rw.blocked {
+			rw.pending.Reset()
+			break
+		}
+	}
+
+	return len(b), nil
+}
+
+func (rw *responseWriter) WriteString(s string) (int, error) {
+	return rw.Write([]byte(s))
+}
+
+// Flush is deferred until the held events are checked
+func (rw *responseWriter) Flush() {}
+
+func (rw *responseWriter) addEvent(event []byte) {
+	rw.held.Write(event)
+
+	text := extractEventOutput(event)
+	rw.window.WriteString(text)
+	rw.windowLen += utf8.RuneCountInString(text)
+
+	if rw.windowLen >= rw.config.StreamWindow {
+		rw.checkWindow()
+	}
+}
+
+// checkWindow checks the held window, the held events are written to the
+// client when they pass and replaced with an error event when they are blocked
+func (rw *responseWriter) checkWindow() {
+	if rw.windowLen == 0 {
+		rw.writeHeld()
+		return
+	}
+
+	text := rw.tail + rw.window.String()
+
+	_, blockErr := rw.plugin.check(rw.c, rw.meta, rw.store, rw.config, StageOutput, text)
+
+	rw.window.Reset()
+	rw.windowLen = 0
+
+	if overlap := rw.config.StreamOverlap; overlap > 0 {
+		runes := []rune(text)
+		rw.tail = string(runes[max(0, len(runes)-overlap):])
+	}
+
+	if blockErr != nil {
+		rw.blocked = true
+		rw.blockErr = blockErr
+		rw.held.Reset()
+		rw.writeErrorEvent(blockErr)
+
+		return
+	}
+
+	rw.writeHeld()
+}
+
+func (rw *responseWriter) writeHeld() {
+	if rw.held.Len() == 0 {
+		return
+	}
+
+	_, _ = rw.ResponseWriter.Write(rw.held.Bytes())
+	rw.held.Reset()
+	rw.ResponseWriter.Flush()
+}
+
+func (rw *responseWriter) writeErrorEvent(err adaptor.Error) {
+	data, _ := err.MarshalJSON()
+
+	var event bytes.Buffer
+	if rw.meta.Mode == mode.Anthropic {
+		event.WriteString("event: error\n")
+	}
+
+	event.WriteString("data: ")
+	event.Write(data)
+	event.Write(eventSeparator)
+
+	_, _ = rw.ResponseWriter.Write(event.Bytes())
+	rw.ResponseWriter.Flush()
+}
+
+// finish checks the rest of the output and writes it to the client
+func (rw *responseWriter) finish() {
+	if rw.blocked {
+		return
+	}
+
+	if rw.stream {
+		if rw.pending.Len() > 0 {
+			event := bytes.Clone(rw.pending.Bytes())
+			rw.pending.Reset()
+			rw.addEvent(event)
+
+			if rw.blocked {
+				return
+			}
+		}
+
+		rw.checkWindow()
+
+		return
+	}
+
+	if rw.body.Len() == 0 {
+		return
+	}
+
+	text := extractOutput(rw.body.Bytes())
+	if strings.TrimSpace(text) == "" {
+		rw.writeBody()
+		return
+	}
+
+	_, blockErr := rw.plugin.check(rw.c, rw.meta, rw.store, rw.config, StageOutput, text)
+	if blockErr == nil {
+		rw.writeBody()
+		return
+	}
+
+	rw.blocked = true
+	rw.blockErr = blockErr
+
+	data, _ := blockErr.MarshalJSON()
+	rw.Header().Set("Content-Type", "application/json")
+	rw.Header().Set("Content-Length", strconv.Itoa(len(data)))
+	rw.WriteHeader(blockErr.StatusCode())
+	_, _ = rw.ResponseWriter.Write(data)
+}
+
+func (rw *responseWriter) writeBody() {
+	_, _ = rw.ResponseWriter.Write(rw.body.Bytes())
+	rw.body.Reset()
+}
+
+// discard writes the held output unchecked, it is used when the response
+// failed and the output is not complete
+func (rw *responseWriter) discard() {
+	if rw.blocked {
+		return
+	}
+
+	rw.writeBody()
+
+	_, _ = rw.ResponseWriter.Write(rw.held.Bytes())
+	rw.held.Reset()
+
+	_, _ = rw.ResponseWriter.Write(rw.pending.Bytes())
+	rw.pending.Reset()
+
+	if rw.stream {
+		rw.ResponseWriter.Flush()
+	}
+}
@@ -59,6 +59,15 @@ func (m *GroupMonitor) DoResponse(
 			int64(result.Usage.TotalTokens),
 		)
 		UpdateGroupModelTokennameTokensRequest(c, count+overLimitCount, secondCount)
+
+		if meta.Token.TPM > 0 {
+			reqlimit.PushTokenTokensRequest(
+				context.Background(),
+				meta.Token.ID,
+				meta.Token.TPM,
+				int64(result.Usage.TotalTokens),
+			)
+		}
 	}
 
 	return result, relayErr
@@ -4,6 +4,7 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"io"
 	"net/http"
 	"strconv"
 	"time"
@@ -12,6 +13,7 @@ import (
 	"github.com/labring/aiproxy/core/common"
 	"github.com/labring/aiproxy/core/common/config"
 	"github.com/labring/aiproxy/core/common/conv"
+	"github.com/labring/aiproxy/core/common/metrics"
 	"github.com/labring/aiproxy/core/common/notify"
 	"github.com/labring/aiproxy/core/common/reqlimit"
 	"github.com/labring/aiproxy/core/monitor"
@@ -121,6 +123,31 @@ func (m *ChannelMonitor) DoRequest(
 	log.Data["req_cost"] = requestCost.String()
 
 	if err == nil {
+		// the upstream has sent the response header, so the request cost is the ttfb
+		metrics.ObserveUpstreamTTFB(metrics.RelayLabels{
+			Mode:    meta.Mode.String(),
+			Model:   meta.OriginModel,
+			Channel: meta.Channel.ID,
+			Group:   meta.Group.ID,
+		}, requestCost)
+
+		// the routing ttfb is measured to the first byte of the body, the header of a
+		// stream can be sent long before the first token, the errors are left out so
+		// the channels failing fast don't look fast
+		if resp != nil && resp.Body != nil &&
+			resp.StatusCode >= http.StatusOK && resp.StatusCode < http.StatusMultipleChoices {
+			resp.Body = &firstByteBody{
+				ReadCloser: resp.Body,
+				onFirstByte: func() {
+					monitor.AddChannelModelTTFB(
+						meta.OriginModel,
+						int64(meta.Channel.ID),
+						common.TruncateDuration(time.Since(requestAt)),
+					)
+				},
+			}
+		}
+
 		return resp, nil
 	}
 
@@ -140,6 +167,23 @@ func (m *ChannelMonitor) DoRequest(
 	return resp, err
 }
 
+// firstByteBody calls onFirstByte once the first byte of the body is read
+type firstByteBody struct {
+	io.ReadCloser
+	onFirstByte func()
+	read        bool
+}
+
+func (b *firstByteBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	if n > 0 && !b.read {
+		b.read = true
+		b.onFirstByte()
+	}
+
+	return n, err
+}
+
 func handleDoRequestError(meta *meta.Meta, c *gin.Context, err error, requestCost time.Duration) {
 	warnErrorRate := getChannelWarnErrorRate(meta)
 	maxErrorRate := getChannelMaxErrorRate(meta)
@@ -156,6 +200,10 @@ func handleDoRequestError(meta *meta.Meta, c *gin.Context, err error, requestCos
 		common.GetLogger(c).Errorf("add request failed: %+v", _err)
 	}
 
+	if banExecution {
+		metrics.IncChannelBans(meta.OriginModel, meta.Channel.ID)
+	}
+
 	switch {
 	case banExecution:
 		notifyChannelRequestIssue(
@@ -290,6 +338,10 @@ func handleAdaptorError(meta *meta.Meta, c *gin.Context, relayErr adaptor.Error)
 		common.GetLogger(c).Errorf("add request failed: %+v", err)
 	}
 
+	if banExecution {
+		metrics.IncChannelBans(meta.OriginModel, meta.Channel.ID)
+	}
+
 	switch {
 	case banExecution:
 		notifyChannelResponseIssue(c, meta, "autoBanned", "Auto Banned", relayErr, time.Minute*15)
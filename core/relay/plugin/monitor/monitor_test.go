@@ -3,8 +3,10 @@ package monitor
 
 import (
 	"context"
+	"io"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 	"time"
 
@@ -221,3 +223,92 @@ func TestChannelMonitorDoResponseRecordsResponseCostOnError(t *testing.T) {
 	require.NoError(t, err)
 	require.Greater(t, parsedCost, time.Duration(0))
 }
+
+type monitorDoRequestFunc func(
+	*relaymeta.Meta,
+	adaptor.Store,
+	*gin.Context,
+	*http.Request,
+) (*http.Response, error)
+
+func (fn monitorDoRequestFunc) DoRequest(
+	meta *relaymeta.Meta,
+	store adaptor.Store,
+	c *gin.Context,
+	req *http.Request,
+) (*http.Response, error) {
+	return fn(meta, store, c, req)
+}
+
+func TestChannelMonitorDoRequestMeasuresTTFBOfSuccesses(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	for _, tt := range []struct {
+		statusCode int
+		measured   bool
+	}{
+		{statusCode: http.StatusOK, measured: true},
+		{statusCode: http.StatusTooManyRequests, measured: false},
+		{statusCode: http.StatusInternalServerError, measured: false},
+	} {
+		recorder := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(recorder)
+		c.Request = httptest.NewRequestWithContext(context.Background(), http.MethodPost, "/", nil)
+		common.SetLogger(c.Request, common.NewLogger())
+
+		requestMeta := relaymeta.NewMeta(
+			&model.Channel{ID: 903, Type: model.ChannelTypeOpenAI},
+			mode.ChatCompletions,
+			"ttfb-status-test",
+			model.ModelConfig{},
+		)
+
+		resp, err := (&ChannelMonitor{}).DoRequest(
+			requestMeta,
+			nil,
+			c,
+			c.Request,
+			monitorDoRequestFunc(func(
+				*relaymeta.Meta,
+				adaptor.Store,
+				*gin.Context,
+				*http.Request,
+			) (*http.Response, error) {
+				return &http.Response{
+					StatusCode: tt.statusCode,
+					Body:       io.NopCloser(strings.NewReader("body")),
+				}, nil
+			}),
+		)
+		require.NoError(t, err)
+
+		_, measured := resp.Body.(*firstByteBody)
+		require.Equal(t, tt.measured, measured, tt.statusCode)
+	}
+}
+
+func TestFirstByteBodyCallsOnce(t *testing.T) {
+	calls := 0
+	body := &firstByteBody{
+		ReadCloser: io.NopCloser(strings.NewReader("hello")),
+		onFirstByte: func() {
+			calls++
+		},
+	}
+
+	buf := make([]byte, 2)
+
+	_, err := body.Read(buf[:0])
+	require.NoError(t, err)
+	require.Zero(t, calls)
+
+	for {
+		_, err := body.Read(buf)
+		if err != nil {
+			require.ErrorIs(t, err, io.EOF)
+			break
+		}
+	}
+
+	require.Equal(t, 1, calls)
+}
@@ -0,0 +1,88 @@
+package prompt
+
+import (
+	"errors"
+
+	"github.com/bytedance/sonic/ast"
+	"github.com/labring/aiproxy/core/relay/mode"
+)
+
+// expandPrompt adds the rendered prompt to the request as its system prompt,
+// it goes before the system prompt of the request
+func expandPrompt(m mode.Mode, node *ast.Node, text string) error {
+	switch m {
+	case mode.ChatCompletions:
+		return expandMessages(node, text)
+	case mode.Anthropic:
+		return expandSystem(node, "system", text)
+	case mode.Responses:
+		return expandSystem(node, "instructions", text)
+	default:
+		return nil
+	}
+}
+
+// expandMessages inserts the prompt as the first system message
+func expandMessages(node *ast.Node, text string) error {
+	message := ast.NewObject([]ast.Pair{
+		ast.NewPair("role", ast.NewString("system")),
+		ast.NewPair("content", ast.NewString(text)),
+	})
+
+	messages := node.Get("messages")
+	if !messages.Exists() || messages.TypeSafe() == ast.V_NULL {
+		_, err := node.Set("messages", ast.NewArray([]ast.Node{message}))
+		return err
+	}
+
+	items, err := messages.ArrayUseNode()
+	if err != nil {
+		return errors.New("messages must be an array")
+	}
+
+	_, err = node.Set("messages", ast.NewArray(append([]ast.Node{message}, items...)))
+
+	return err
+}
+
+// expandSystem prepends the prompt to a system field, the field can be a
+// string or a list of anthropic text blocks
+func expandSystem(node *ast.Node, key, text string) error {
+	system := node.Get(key)
+	if !system.Exists() || system.TypeSafe() == ast.V_NULL {
+		_, err := node.Set(key, ast.NewString(text))
+		return err
+	}
+
+	switch system.TypeSafe() {
+	case ast.V_STRING:
+		existing, err := system.String()
+		if err != nil {
+			return err
+		}
+
+		if existing != "" {
+			text += "\n\n" + existing
+		}
+
+		_, err = node.Set(key, ast.NewString(text))
+
+		return err
+	case ast.V_ARRAY:
+		items, err := system.ArrayUseNode()
+		if err != nil {
+			return err
+		}
+
+		block := ast.NewObject([]ast.Pair{
+			ast.NewPair("type", ast.NewString("text")),
+			ast.NewPair("text", ast.NewString(text)),
+		})
+
+		_, err = node.Set(key, ast.NewArray(append([]ast.Node{block}, items...)))
+
+		return err
+	default:
+		return errors.New(key + " must be a string or an array")
+	}
+}
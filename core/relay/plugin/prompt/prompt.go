@@ -0,0 +1,257 @@
+// Package prompt expands the prompts of the group prompt registry referenced
+// by the requests before they are converted
+package prompt
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/bytedance/sonic"
+	"github.com/bytedance/sonic/ast"
+	"github.com/labring/aiproxy/core/common"
+	"github.com/labring/aiproxy/core/model"
+	"github.com/labring/aiproxy/core/relay/adaptor"
+	"github.com/labring/aiproxy/core/relay/meta"
+	"github.com/labring/aiproxy/core/relay/mode"
+	relaymodel "github.com/labring/aiproxy/core/relay/model"
+	"github.com/labring/aiproxy/core/relay/plugin"
+	"github.com/labring/aiproxy/core/relay/plugin/noop"
+	"gorm.io/gorm"
+)
+
+var _ plugin.Plugin = (*Prompt)(nil)
+
+// Constants for metadata keys
+const (
+	promptIDKey      = "prompt_id"
+	promptVersionKey = "prompt_version"
+)
+
+// referenceKey is the request field referencing a registry prompt
+const referenceKey = "prompt"
+
+// ErrorTypePrompt is the error type of the invalid prompt references
+const ErrorTypePrompt = "invalid_prompt"
+
+// Reference references a version of a registry prompt, the latest version is
+// used when the version is not set
+type Reference struct {
+	ID        string         `json:"id"`
+	Version   any            `json:"version,omitempty"`
+	Variables map[string]any `json:"variables,omitempty"`
+}
+
+// Prompt expands the referenced registry prompts as the system prompt
+type Prompt struct {
+	noop.Noop
+}
+
+// NewPromptPlugin creates a new prompt plugin
+func NewPromptPlugin() plugin.Plugin {
+	return &Prompt{}
+}
+
+// LogMetadata returns the expanded prompt of the request as log metadata
+func LogMetadata(meta *meta.Meta) map[string]string {
+	id := meta.GetString(promptIDKey)
+	if id == "" {
+		return nil
+	}
+
+	return map[string]string{
+		promptIDKey:      id,
+		promptVersionKey: strconv.Itoa(meta.GetInt(promptVersionKey)),
+	}
+}
+
+func (p *Prompt) ConvertRequest(
+	meta *meta.Meta,
+	store adaptor.Store,
+	req *http.Request,
+	do adaptor.ConvertRequest,
+) (adaptor.ConvertResult, error) {
+	switch meta.Mode {
+	case mode.ChatCompletions, mode.Anthropic, mode.Responses:
+	default:
+		return do.ConvertRequest(meta, store, req)
+	}
+
+	body, err := common.GetRequestBodyReusable(req)
+	if err != nil {
+		return adaptor.ConvertResult{}, err
+	}
+
+	// the responses api has its own prompt references with the same field,
+	// they are sent to the upstream when they are not in the registry
+	expanded, err := expand(meta, body, meta.Mode == mode.Responses)
+	if err != nil {
+		return adaptor.ConvertResult{}, err
+	}
+
+	if expanded == nil {
+		return do.ConvertRequest(meta, store, req)
+	}
+
+	common.SetRequestBody(req, expanded)
+	defer func() {
+		common.SetRequestBody(req, body)
+	}()
+
+	return do.ConvertRequest(meta, store, req)
+}
+
+// ExpandEmulatedResponses expands the registry prompt referenced by a
+// responses request that is emulated through chat completions, the prompt
+// field is lost in the conversion so it is expanded into the instructions
+// first, and the references not in the registry are rejected as the chat
+// upstream can not resolve them
+func ExpandEmulatedResponses(meta *meta.Meta, body []byte) ([]byte, error) {
+	expanded, err := expand(meta, body, false)
+	if err != nil {
+		return nil, err
+	}
+
+	if expanded == nil {
+		return body, nil
+	}
+
+	return expanded, nil
+}
+
+// expand returns the body with the referenced prompt expanded, it is nil when
+// the body does not reference a registry prompt, passthrough keeps the
+// references that are not in the registry
+func expand(meta *meta.Meta, body []byte, passthrough bool) ([]byte, error) {
+	node, err := sonic.Get(body)
+	if err != nil {
+		// the adaptor reports the invalid json
+		return nil, nil
+	}
+
+	refNode := node.Get(referenceKey)
+	if !refNode.Exists() || refNode.TypeSafe() != ast.V_OBJECT {
+		return nil, nil
+	}
+
+	raw, err := refNode.Raw()
+	if err != nil {
+		return nil, err
+	}
+
+	var ref Reference
+	if err := sonic.UnmarshalString(raw, &ref); err != nil {
+		return nil, invalidPromptError(meta, err.Error())
+	}
+
+	if ref.ID == "" {
+		if passthrough {
+			return nil, nil
+		}
+
+		return nil, invalidPromptError(meta, "prompt id is empty")
+	}
+
+	version, err := parseVersion(ref.Version)
+	if err != nil {
+		return nil, invalidPromptError(meta, err.Error())
+	}
+
+	prompt, err := model.CacheGetPrompt(meta.Group.ID, ref.ID, version)
+	if err != nil {
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, relaymodel.WrapperErrorWithMessage(
+				meta.Mode,
+				http.StatusInternalServerError,
+				"load prompt failed: "+err.Error(),
+				relaymodel.WithType(ErrorTypePrompt),
+			)
+		}
+
+		if passthrough {
+			return nil, nil
+		}
+
+		return nil, invalidPromptError(
+			meta,
+			fmt.Sprintf("prompt %s not found", ref.ID),
+		)
+	}
+
+	text, err := prompt.Render(variableValues(ref.Variables))
+	if err != nil {
+		return nil, invalidPromptError(meta, err.Error())
+	}
+
+	if _, err := node.Unset(referenceKey); err != nil {
+		return nil, err
+	}
+
+	if err := expandPrompt(meta.Mode, &node, text); err != nil {
+		return nil, invalidPromptError(meta, err.Error())
+	}
+
+	expanded, err := node.MarshalJSON()
+	if err != nil {
+		return nil, err
+	}
+
+	meta.Set(promptIDKey, ref.ID)
+	meta.Set(promptVersionKey, prompt.Version)
+
+	return expanded, nil
+}
+
+func invalidPromptError(meta *meta.Meta, message string) adaptor.Error {
+	return relaymodel.WrapperErrorWithMessage(
+		meta.Mode,
+		http.StatusBadRequest,
+		message,
+		relaymodel.WithType(ErrorTypePrompt),
+	)
+}
+
+// variableValues converts the variables of the reference to strings
+func variableValues(variables map[string]any) map[string]string {
+	values := make(map[string]string, len(variables))
+	for name, value := range variables {
+		switch v := value.(type) {
+		case string:
+			values[name] = v
+		case nil:
+		default:
+			values[name] = fmt.Sprint(v)
+		}
+	}
+
+	return values
+}
+
+// parseVersion parses the version of the reference, it can be a number or a
+// numeric string, 0 and "latest" mean the latest version
+func parseVersion(version any) (int, error) {
+	switch v := version.(type) {
+	case nil:
+		return 0, nil
+	case float64:
+		if v < 0 || v != float64(int(v)) {
+			return 0, fmt.Errorf("invalid prompt version: %v", v)
+		}
+
+		return int(v), nil
+	case string:
+		if v == "" || v == "latest" {
+			return 0, nil
+		}
+
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			return 0, fmt.Errorf("invalid prompt version: %s", v)
+		}
+
+		return n, nil
+	default:
+		return 0, fmt.Errorf("invalid prompt version: %v", v)
+	}
+}
@@ -0,0 +1,272 @@
+package prompt_test
+
+import (
+	"bytes"
+	"errors"
+	"net/http"
+	"path/filepath"
+	"testing"
+
+	"github.com/bytedance/sonic"
+	"github.com/labring/aiproxy/core/common"
+	"github.com/labring/aiproxy/core/model"
+	"github.com/labring/aiproxy/core/relay/adaptor"
+	"github.com/labring/aiproxy/core/relay/meta"
+	"github.com/labring/aiproxy/core/relay/mode"
+	"github.com/labring/aiproxy/core/relay/plugin/prompt"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type captureConvert struct {
+	body map[string]any
+}
+
+func (c *captureConvert) ConvertRequest(
+	_ *meta.Meta,
+	_ adaptor.Store,
+	req *http.Request,
+) (adaptor.ConvertResult, error) {
+	body, err := common.GetRequestBodyReusable(req)
+	if err != nil {
+		return adaptor.ConvertResult{}, err
+	}
+
+	c.body = nil
+
+	return adaptor.ConvertResult{}, sonic.Unmarshal(body, &c.body)
+}
+
+func setupPromptDB(t *testing.T) {
+	t.Helper()
+
+	prevDB := model.DB
+	prevUsingSQLite := common.UsingSQLite
+
+	testDB, err := model.OpenSQLite(filepath.Join(t.TempDir(), "prompt.db"))
+	require.NoError(t, err)
+
+	model.DB = testDB
+	common.UsingSQLite = true
+	t.Cleanup(func() {
+		model.DB = prevDB
+		common.UsingSQLite = prevUsingSQLite
+	})
+
+	require.NoError(t, testDB.AutoMigrate(&model.Group{}, &model.Prompt{}))
+	require.NoError(t, testDB.Create(&model.Group{ID: "g1"}).Error)
+
+	require.NoError(t, model.CreatePrompt(&model.Prompt{
+		ID:      "support",
+		GroupID: "g1",
+		Content: "You are the support agent of {{product}}.",
+		Variables: []model.PromptVariable{
+			{Name: "product", Required: true},
+		},
+	}))
+	require.NoError(t, model.CreatePromptVersion(&model.Prompt{
+		ID:      "support",
+		GroupID: "g1",
+		Content: "You are the {{tone}} support agent of {{product}}.",
+		Variables: []model.PromptVariable{
+			{Name: "product", Required: true},
+			{Name: "tone", Default: "friendly"},
+		},
+	}))
+}
+
+func newMeta(m mode.Mode, group string) *meta.Meta {
+	return meta.NewMeta(
+		nil,
+		m,
+		"gpt-4o",
+		model.ModelConfig{Model: "gpt-4o"},
+		meta.WithGroup(model.GroupCache{ID: group}),
+	)
+}
+
+func convert(t *testing.T, m *meta.Meta, body any) (*captureConvert, []byte, error) {
+	t.Helper()
+
+	data, err := sonic.Marshal(body)
+	require.NoError(t, err)
+
+	req, err := http.NewRequestWithContext(
+		t.Context(),
+		http.MethodPost,
+		"http://localhost/v1/chat/completions",
+		bytes.NewReader(data),
+	)
+	require.NoError(t, err)
+	req.Header.Set("Content-Type", "application/json")
+
+	capture := &captureConvert{}
+	_, err = prompt.NewPromptPlugin().ConvertRequest(m, nil, req, capture)
+
+	restored, bodyErr := common.GetRequestBodyReusable(req)
+	require.NoError(t, bodyErr)
+
+	return capture, restored, err
+}
+
+func TestExpandChatCompletions(t *testing.T) {
+	setupPromptDB(t)
+
+	m := newMeta(mode.ChatCompletions, "g1")
+	capture, restored, err := convert(t, m, map[string]any{
+		"model": "gpt-4o",
+		"prompt": map[string]any{
+			"id":        "support",
+			"variables": map[string]any{"product": "AI Proxy"},
+		},
+		"messages": []map[string]any{
+			{"role": "user", "content": "hello"},
+		},
+	})
+	require.NoError(t, err)
+
+	assert.NotContains(t, capture.body, "prompt")
+	assert.Equal(t, []any{
+		map[string]any{
+			"role":    "system",
+			"content": "You are the friendly support agent of AI Proxy.",
+		},
+		map[string]any{"role": "user", "content": "hello"},
+	}, capture.body["messages"])
+
+	// the body of the request is restored for the retries
+	assert.Contains(t, string(restored), `"prompt"`)
+
+	assert.Equal(t, map[string]string{
+		"prompt_id":      "support",
+		"prompt_version": "2",
+	}, prompt.LogMetadata(m))
+}
+
+func TestExpandAnthropicVersion(t *testing.T) {
+	setupPromptDB(t)
+
+	m := newMeta(mode.Anthropic, "g1")
+	capture, _, err := convert(t, m, map[string]any{
+		"model": "claude-sonnet-4-5",
+		"prompt": map[string]any{
+			"id":        "support",
+			"version":   "1",
+			"variables": map[string]any{"product": "AI Proxy"},
+		},
+		"system": []map[string]any{
+			{"type": "text", "text": "Answer briefly."},
+		},
+		"messages": []map[string]any{
+			{"role": "user", "content": "hello"},
+		},
+	})
+	require.NoError(t, err)
+
+	assert.Equal(t, []any{
+		map[string]any{"type": "text", "text": "You are the support agent of AI Proxy."},
+		map[string]any{"type": "text", "text": "Answer briefly."},
+	}, capture.body["system"])
+	assert.Equal(t, "1", prompt.LogMetadata(m)["prompt_version"])
+}
+
+func TestExpandResponses(t *testing.T) {
+	setupPromptDB(t)
+
+	m := newMeta(mode.Responses, "g1")
+	capture, _, err := convert(t, m, map[string]any{
+		"model": "gpt-4o",
+		"prompt": map[string]any{
+			"id":        "support",
+			"version":   2,
+			"variables": map[string]any{"product": "AI Proxy", "tone": "formal"},
+		},
+		"instructions": "Answer briefly.",
+		"input":        "hello",
+	})
+	require.NoError(t, err)
+
+	assert.Equal(
+		t,
+		"You are the formal support agent of AI Proxy.\n\nAnswer briefly.",
+		capture.body["instructions"],
+	)
+
+	// the prompts not in the registry are left to the upstream
+	m = newMeta(mode.Responses, "g1")
+	capture, _, err = convert(t, m, map[string]any{
+		"model":  "gpt-4o",
+		"prompt": map[string]any{"id": "pmpt_123", "version": "2"},
+		"input":  "hello",
+	})
+	require.NoError(t, err)
+
+	assert.Equal(t, map[string]any{"id": "pmpt_123", "version": "2"}, capture.body["prompt"])
+	assert.Nil(t, prompt.LogMetadata(m))
+}
+
+func TestInvalidReferences(t *testing.T) {
+	setupPromptDB(t)
+
+	tests := []struct {
+		name  string
+		group string
+		ref   map[string]any
+	}{
+		{
+			name:  "missing variable",
+			group: "g1",
+			ref:   map[string]any{"id": "support"},
+		},
+		{
+			name:  "unknown version",
+			group: "g1",
+			ref: map[string]any{
+				"id":        "support",
+				"version":   3,
+				"variables": map[string]any{"product": "AI Proxy"},
+			},
+		},
+		{
+			name:  "other group",
+			group: "g2",
+			ref: map[string]any{
+				"id":        "support",
+				"variables": map[string]any{"product": "AI Proxy"},
+			},
+		},
+		{
+			name:  "invalid version",
+			group: "g1",
+			ref:   map[string]any{"id": "support", "version": "v2"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			capture, _, err := convert(t, newMeta(mode.ChatCompletions, tt.group), map[string]any{
+				"model":    "gpt-4o",
+				"prompt":   tt.ref,
+				"messages": []map[string]any{{"role": "user", "content": "hello"}},
+			})
+			require.Error(t, err)
+			assert.Nil(t, capture.body)
+
+			var relayErr adaptor.Error
+			require.True(t, errors.As(err, &relayErr))
+			assert.Equal(t, http.StatusBadRequest, relayErr.StatusCode())
+		})
+	}
+}
+
+func TestWithoutReference(t *testing.T) {
+	m := newMeta(mode.ChatCompletions, "g1")
+	capture, _, err := convert(t, m, map[string]any{
+		"model":    "gpt-4o",
+		"messages": []map[string]any{{"role": "user", "content": "hello"}},
+	})
+	require.NoError(t, err)
+
+	assert.Len(t, capture.body["messages"], 1)
+	assert.Nil(t, prompt.LogMetadata(m))
+}
@@ -0,0 +1,32 @@
+package semanticcache
+
+import "github.com/labring/aiproxy/core/relay/plugin/cache"
+
+const PluginName = "semantic-cache"
+
+const (
+	defaultTTL                 = 300
+	defaultSimilarityThreshold = 0.95
+	defaultMaxEntries          = 1000
+)
+
+// Config shares the fields of the cache plugin config
+type Config struct {
+	cache.Config
+
+	EmbeddingModel      string  `json:"embedding_model"`
+	SimilarityThreshold float64 `json:"similarity_threshold,omitempty"`
+	MaxEntries          int     `json:"max_entries,omitempty"`
+	// PerToken keeps the cached responses of the tokens of a group apart
+	PerToken bool `json:"per_token,omitempty"`
+}
+
+func defaultConfig() Config {
+	return Config{
+		Config: cache.Config{
+			TTL: defaultTTL,
+		},
+		SimilarityThreshold: defaultSimilarityThreshold,
+		MaxEntries:          defaultMaxEntries,
+	}
+}
@@ -0,0 +1,491 @@
+package semanticcache
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/bytedance/sonic"
+	"github.com/gin-gonic/gin"
+	"github.com/labring/aiproxy/core/common"
+	"github.com/labring/aiproxy/core/common/balance"
+	"github.com/labring/aiproxy/core/common/consume"
+	"github.com/labring/aiproxy/core/middleware"
+	"github.com/labring/aiproxy/core/model"
+	"github.com/labring/aiproxy/core/relay/adaptor"
+	"github.com/labring/aiproxy/core/relay/adaptors"
+	"github.com/labring/aiproxy/core/relay/controller"
+	"github.com/labring/aiproxy/core/relay/meta"
+	"github.com/labring/aiproxy/core/relay/mode"
+	relaymodel "github.com/labring/aiproxy/core/relay/model"
+	"github.com/labring/aiproxy/core/relay/plugin"
+	"github.com/labring/aiproxy/core/relay/plugin/cache"
+	"github.com/labring/aiproxy/core/relay/plugin/mcptools"
+	"github.com/labring/aiproxy/core/relay/plugin/noop"
+	"github.com/labring/aiproxy/core/relay/utils"
+	"github.com/redis/go-redis/v9"
+)
+
+// Constants for metadata keys
+const (
+	semanticCacheHit       = "semantic_cache_hit"
+	semanticCacheValue     = "semantic_cache_value"
+	semanticCachePending   = "semantic_cache_pending"
+	semanticCacheEmbedding = "semantic_cache_embedding"
+)
+
+var _ plugin.Plugin = (*SemanticCache)(nil)
+
+type GetChannel func(modelName string) (*model.Channel, error)
+
+// Embed returns the vector of the input through the embedding model
+type Embed func(m *meta.Meta, store adaptor.Store, modelName, input string) ([]float64, error)
+
+// SemanticCache returns the cached response of a similar request, the similarity is
+// measured by the embedding of the last user message among the requests of the same
+// group with the same context
+type SemanticCache struct {
+	noop.Noop
+	GetChannel  GetChannel
+	Embed       Embed
+	rdb         *redis.Client
+	items       *cache.Cache
+	configCache utils.PluginConfigCache[Config]
+}
+
+// NewSemanticCachePlugin creates a new semantic cache plugin
+func NewSemanticCachePlugin(rdb *redis.Client, getChannel GetChannel) plugin.Plugin {
+	return newSemanticCache(rdb, getChannel)
+}
+
+func newSemanticCache(rdb *redis.Client, getChannel GetChannel) *SemanticCache {
+	p := &SemanticCache{
+		GetChannel: getChannel,
+		rdb:        rdb,
+		items:      cache.NewCache(rdb),
+	}
+	p.Embed = p.embed
+
+	return p
+}
+
+// pending is the cache entry that will be stored after the upstream response
+type pending struct {
+	namespace string
+	entry     entry
+}
+
+// IsCacheHit reports whether the response of the request is replayed from the
+// semantic cache, such requests are not billed
+func IsCacheHit(meta *meta.Meta) bool {
+	return meta.GetBool(semanticCacheHit)
+}
+
+func getCacheItem(meta *meta.Meta) *cache.Item {
+	v, ok := meta.Get(semanticCacheValue)
+	if !ok {
+		return nil
+	}
+
+	item, ok := v.(*cache.Item)
+	if !ok {
+		panic(fmt.Sprintf("semantic cache item type not match: %T", v))
+	}
+
+	return item
+}
+
+func setCacheHit(meta *meta.Meta, item *cache.Item) {
+	meta.Set(semanticCacheHit, true)
+	meta.Set(semanticCacheValue, item)
+}
+
+func getPending(meta *meta.Meta) *pending {
+	v, ok := meta.Get(semanticCachePending)
+	if !ok {
+		return nil
+	}
+
+	p, ok := v.(*pending)
+	if !ok {
+		panic(fmt.Sprintf("semantic cache pending type not match: %T", v))
+	}
+
+	return p
+}
+
+func (p *SemanticCache) getConfig(meta *meta.Meta) (Config, error) {
+	return p.configCache.Load(meta, PluginName, defaultConfig())
+}
+
+type cacheMessage struct {
+	Role    string `json:"role"`
+	Content any    `json:"content"`
+}
+
+type cacheRequest struct {
+	Stream         bool              `json:"stream"`
+	Messages       []json.RawMessage `json:"messages"`
+	System         json.RawMessage   `json:"system"`
+	Tools          json.RawMessage   `json:"tools"`
+	ToolChoice     json.RawMessage   `json:"tool_choice"`
+	ResponseFormat json.RawMessage   `json:"response_format"`
+}
+
+// extractLastUserText returns the text and the index of the last user message, the
+// content can be a string or a list of parts in both the OpenAI and Anthropic formats
+func extractLastUserText(req *cacheRequest) (string, int) {
+	for i, raw := range slices.Backward(req.Messages) {
+		var msg cacheMessage
+		if err := sonic.Unmarshal(raw, &msg); err != nil || msg.Role != "user" {
+			continue
+		}
+
+		switch content := msg.Content.(type) {
+		case string:
+			return content, i
+		case []any:
+			texts := make([]string, 0, len(content))
+			for _, part := range content {
+				p, ok := part.(map[string]any)
+				if !ok || p["type"] != "text" {
+					continue
+				}
+
+				if text, ok := p["text"].(string); ok && text != "" {
+					texts = append(texts, text)
+				}
+			}
+
+			return strings.Join(texts, "\n"), i
+		default:
+			return "", i
+		}
+	}
+
+	return "", -1
+}
+
+// contextHash hashes everything the answer depends on besides the last user message,
+// the system prompt, the previous turns and the tools, only the requests with the same
+// context are compared by the embedding of their last user message
+func contextHash(req *cacheRequest, lastUser int) string {
+	h := sha256.New()
+
+	for _, raw := range [][]byte{req.System, req.Tools, req.ToolChoice, req.ResponseFormat} {
+		h.Write(raw)
+		h.Write([]byte{0})
+	}
+
+	for i, raw := range req.Messages {
+		if i == lastUser {
+			continue
+		}
+
+		h.Write(raw)
+		h.Write([]byte{0})
+	}
+
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// cacheNamespace keeps the vectors of different groups, models, response formats and
+// request contexts apart, the tokens of a group are also kept apart if configured
+func cacheNamespace(meta *meta.Meta, pluginConfig Config, stream bool, ctxHash string) string {
+	scope := meta.Group.ID
+	if pluginConfig.PerToken {
+		scope = fmt.Sprintf("%s:%d", scope, meta.Token.ID)
+	}
+
+	return fmt.Sprintf("%s:%s:%d:%t:%s", scope, meta.OriginModel, meta.Mode, stream, ctxHash)
+}
+
+func itemKey(namespace, query string) string {
+	hash := sha256.Sum256([]byte(query))
+	return "semantic:" + namespace + ":" + hex.EncodeToString(hash[:])
+}
+
+// ConvertRequest looks up a similar cached request before converting the request
+func (p *SemanticCache) ConvertRequest(
+	meta *meta.Meta,
+	store adaptor.Store,
+	req *http.Request,
+	do adaptor.ConvertRequest,
+) (adaptor.ConvertResult, error) {
+	if meta.Mode != mode.ChatCompletions && meta.Mode != mode.Anthropic {
+		return do.ConvertRequest(meta, store, req)
+	}
+
+	log := common.GetLoggerFromReq(req)
+
+	pluginConfig, err := p.getConfig(meta)
+	if err != nil {
+		log.Debugf("semantic-cache: skipping, config load error: %v", err)
+		return do.ConvertRequest(meta, store, req)
+	}
+
+	if !pluginConfig.Enable || pluginConfig.EmbeddingModel == "" {
+		return do.ConvertRequest(meta, store, req)
+	}
+
+	body, err := common.GetRequestBodyReusable(req)
+	if err != nil {
+		return adaptor.ConvertResult{}, err
+	}
+
+	// the answers of the mcp tool loops depend on the tool results
+	if mcptools.Attached(meta, body) {
+		return do.ConvertRequest(meta, store, req)
+	}
+
+	var cacheReq cacheRequest
+	if err := sonic.Unmarshal(body, &cacheReq); err != nil {
+		return do.ConvertRequest(meta, store, req)
+	}
+
+	query, lastUser := extractLastUserText(&cacheReq)
+	if query == "" {
+		return do.ConvertRequest(meta, store, req)
+	}
+
+	vector, err := p.Embed(meta, store, pluginConfig.EmbeddingModel, query)
+	if err != nil {
+		log.Warnf("semantic-cache: embedding failed: %v", err)
+		return do.ConvertRequest(meta, store, req)
+	}
+
+	namespace := cacheNamespace(
+		meta,
+		pluginConfig,
+		cacheReq.Stream,
+		contextHash(&cacheReq, lastUser),
+	)
+	ctx := req.Context()
+
+	entries := p.getEntries(ctx, namespace, pluginConfig.MaxEntries)
+	for _, e := range bestMatches(entries, vector, pluginConfig.SimilarityThreshold) {
+		if item, ok := p.items.GetItem(ctx, e.Key); ok {
+			setCacheHit(meta, item)
+			return adaptor.ConvertResult{}, nil
+		}
+	}
+
+	meta.Set(semanticCachePending, &pending{
+		namespace: namespace,
+		entry: entry{
+			Key:    itemKey(namespace, query),
+			Vector: vector,
+		},
+	})
+
+	return do.ConvertRequest(meta, store, req)
+}
+
+// DoRequest bills the embedding of the request and skips the upstream request on cache hit
+func (p *SemanticCache) DoRequest(
+	meta *meta.Meta,
+	store adaptor.Store,
+	ctx *gin.Context,
+	req *http.Request,
+	do adaptor.DoRequest,
+) (*http.Response, error) {
+	consumeEmbedding(ctx, meta)
+
+	if IsCacheHit(meta) {
+		return &http.Response{}, nil
+	}
+
+	return do.DoRequest(meta, store, ctx, req)
+}
+
+// DoResponse replays the cached response on hit, or stores the upstream response on miss
+func (p *SemanticCache) DoResponse(
+	meta *meta.Meta,
+	store adaptor.Store,
+	ctx *gin.Context,
+	resp *http.Response,
+	do adaptor.DoResponse,
+) (result adaptor.DoResponseResult, adapterErr adaptor.Error) {
+	pluginConfig, err := p.getConfig(meta)
+	if err != nil {
+		return do.DoResponse(meta, store, ctx, resp)
+	}
+
+	if IsCacheHit(meta) {
+		item := getCacheItem(meta)
+		if item == nil {
+			return do.DoResponse(meta, store, ctx, resp)
+		}
+
+		cache.WriteItem(ctx, &pluginConfig.Config, item)
+
+		return adaptor.DoResponseResult{Usage: item.Usage}, nil
+	}
+
+	pending := getPending(meta)
+	if pending == nil {
+		return do.DoResponse(meta, store, ctx, resp)
+	}
+
+	cache.WriteCacheHeader(ctx, &pluginConfig.Config, "miss")
+
+	finish := cache.CaptureResponse(ctx, pluginConfig.ItemMaxSize)
+	defer func() {
+		item := finish(adapterErr != nil, result.Usage)
+		if item == nil {
+			return
+		}
+
+		reqCtx := ctx.Request.Context()
+		ttl := time.Duration(pluginConfig.TTL) * time.Second
+
+		p.items.SetItem(reqCtx, pending.entry.Key, *item, ttl)
+		p.addEntry(reqCtx, pending.namespace, pending.entry, pluginConfig.MaxEntries, ttl)
+	}()
+
+	return do.DoResponse(meta, store, ctx, resp)
+}
+
+// embeddingCall is an embedding call waiting to be billed
+type embeddingCall struct {
+	meta   *meta.Meta
+	result *controller.HandleResult
+}
+
+// embed calls the embedding model through its channel, the call is billed in DoRequest where
+// the balance consumer of the group is at hand
+func (p *SemanticCache) embed(
+	m *meta.Meta,
+	store adaptor.Store,
+	modelName, input string,
+) ([]float64, error) {
+	if p.GetChannel == nil {
+		return nil, errors.New("embedding channel getter is not set")
+	}
+
+	channel, err := p.GetChannel(modelName)
+	if err != nil {
+		return nil, err
+	}
+
+	a, ok := adaptors.GetAdaptor(channel.Type)
+	if !ok {
+		return nil, errors.New("adaptor not found")
+	}
+
+	body, err := sonic.Marshal(map[string]any{
+		"model": modelName,
+		"input": input,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	modelConfig := model.ModelConfig{
+		Model: modelName,
+		Type:  mode.Embeddings,
+	}
+	if caches := model.LoadModelCaches(); caches != nil && caches.ModelConfig != nil {
+		if mc, ok := caches.ModelConfig.GetModelConfig(modelName); ok {
+			modelConfig = mc
+		}
+	}
+
+	requestID := m.RequestID + "-semantic-cache"
+
+	w := httptest.NewRecorder()
+	newc, _ := gin.CreateTestContext(w)
+	newc.Request = &http.Request{
+		URL:    &url.URL{},
+		Body:   io.NopCloser(bytes.NewReader(body)),
+		Header: make(http.Header),
+	}
+	newc.Request.Header.Set("Content-Type", "application/json")
+	middleware.SetRequestID(newc, requestID)
+
+	newMeta := meta.NewMeta(
+		channel,
+		mode.Embeddings,
+		modelName,
+		modelConfig,
+		meta.WithRequestID(requestID),
+		meta.WithGroup(m.Group),
+		meta.WithToken(m.Token),
+	)
+
+	result := controller.Handle(a, newc, newMeta, store)
+
+	m.Set(semanticCacheEmbedding, &embeddingCall{meta: newMeta, result: result})
+
+	if result.Error != nil {
+		return nil, result.Error
+	}
+
+	var embeddingResp relaymodel.EmbeddingResponse
+	if err := sonic.Unmarshal(w.Body.Bytes(), &embeddingResp); err != nil {
+		return nil, err
+	}
+
+	if len(embeddingResp.Data) == 0 || len(embeddingResp.Data[0].Embedding) == 0 {
+		return nil, errors.New("empty embedding")
+	}
+
+	return embeddingResp.Data[0].Embedding, nil
+}
+
+// consumeEmbedding bills the embedding call of the request to the group of the request
+func consumeEmbedding(c *gin.Context, m *meta.Meta) {
+	v, ok := m.Get(semanticCacheEmbedding)
+	if !ok {
+		return
+	}
+
+	m.Delete(semanticCacheEmbedding)
+
+	call, ok := v.(*embeddingCall)
+	if !ok {
+		return
+	}
+
+	code := http.StatusOK
+	content := ""
+
+	if call.result.Error != nil {
+		code = call.result.Error.StatusCode()
+		respBody, _ := call.result.Error.MarshalJSON()
+		content = string(respBody)
+	}
+
+	var consumer balance.PostGroupConsumer
+	if gbc := middleware.GetGroupBalanceConsumerFromContext(c); gbc != nil {
+		consumer = gbc.Consumer
+	}
+
+	consume.AsyncConsume(
+		consumer,
+		code,
+		time.Time{},
+		call.meta,
+		call.result.Usage,
+		call.result.UsageContext,
+		call.meta.ModelConfig.Price,
+		content,
+		c.ClientIP(),
+		0,
+		nil,
+		true,
+		map[string]string{"semantic_cache_for": m.RequestID},
+		call.result.UpstreamID,
+		model.AsyncUsageStatusNone,
+	)
+}
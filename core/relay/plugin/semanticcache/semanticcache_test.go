@@ -0,0 +1,400 @@
+//nolint:testpackage
+package semanticcache
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/labring/aiproxy/core/model"
+	"github.com/labring/aiproxy/core/relay/adaptor"
+	"github.com/labring/aiproxy/core/relay/meta"
+	"github.com/labring/aiproxy/core/relay/mode"
+	"github.com/labring/aiproxy/core/relay/plugin/mcptools"
+	"github.com/stretchr/testify/require"
+)
+
+type convertRequestFunc func(*meta.Meta, adaptor.Store, *http.Request) (adaptor.ConvertResult, error)
+
+func (f convertRequestFunc) ConvertRequest(
+	meta *meta.Meta,
+	store adaptor.Store,
+	req *http.Request,
+) (adaptor.ConvertResult, error) {
+	return f(meta, store, req)
+}
+
+type doResponseFunc func(*meta.Meta, adaptor.Store, *gin.Context, *http.Response) (adaptor.DoResponseResult, adaptor.Error)
+
+func (f doResponseFunc) DoResponse(
+	meta *meta.Meta,
+	store adaptor.Store,
+	c *gin.Context,
+	resp *http.Response,
+) (adaptor.DoResponseResult, adaptor.Error) {
+	return f(meta, store, c, resp)
+}
+
+// testEmbed maps the questions about the weather close to each other
+func testEmbed(_ *meta.Meta, _ adaptor.Store, _, input string) ([]float64, error) {
+	if strings.Contains(strings.ToLower(input), "weather") {
+		return []float64{1, 0.05, 0}, nil
+	}
+
+	return []float64{0, 0, 1}, nil
+}
+
+func newTestMeta(modelName string) *meta.Meta {
+	return meta.NewMeta(
+		nil,
+		mode.ChatCompletions,
+		modelName,
+		model.ModelConfig{
+			Model: modelName,
+			Plugin: map[string]map[string]any{
+				PluginName: {
+					"enable":               true,
+					"embedding_model":      "text-embedding-3-small",
+					"add_cache_hit_header": true,
+				},
+			},
+		},
+	)
+}
+
+type relayResult struct {
+	recorder      *httptest.ResponseRecorder
+	usage         model.Usage
+	upstreamCalls int
+}
+
+func relay(t *testing.T, p *SemanticCache, modelName, body, upstreamBody string) relayResult {
+	t.Helper()
+
+	return relayMeta(t, p, newTestMeta(modelName), body, upstreamBody)
+}
+
+func relayMeta(t *testing.T, p *SemanticCache, m *meta.Meta, body, upstreamBody string) relayResult {
+	t.Helper()
+
+	recorder := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(recorder)
+	c.Request = httptest.NewRequestWithContext(
+		t.Context(),
+		http.MethodPost,
+		"/v1/chat/completions",
+		strings.NewReader(body),
+	)
+
+	result := relayResult{recorder: recorder}
+
+	_, err := p.ConvertRequest(m, nil, c.Request, convertRequestFunc(
+		func(*meta.Meta, adaptor.Store, *http.Request) (adaptor.ConvertResult, error) {
+			result.upstreamCalls++
+			return adaptor.ConvertResult{}, nil
+		},
+	))
+	require.NoError(t, err)
+
+	var resp *http.Response
+	if IsCacheHit(m) {
+		resp, err = p.DoRequest(m, nil, c, c.Request, nil)
+		require.NoError(t, err)
+	}
+
+	res, relayErr := p.DoResponse(m, nil, c, resp, doResponseFunc(
+		func(_ *meta.Meta, _ adaptor.Store, c *gin.Context, _ *http.Response) (adaptor.DoResponseResult, adaptor.Error) {
+			c.Header("Content-Type", "application/json")
+			_, _ = c.Writer.Write([]byte(upstreamBody))
+
+			return adaptor.DoResponseResult{
+				Usage: model.Usage{InputTokens: 10, OutputTokens: 5, TotalTokens: 15},
+			}, nil
+		},
+	))
+	require.Nil(t, relayErr)
+
+	result.usage = res.Usage
+
+	return result
+}
+
+func TestSemanticCacheHitsSimilarQuestion(t *testing.T) {
+	t.Parallel()
+
+	p := newSemanticCache(nil, nil)
+	p.Embed = testEmbed
+
+	first := relay(
+		t,
+		p,
+		"semantic-hit-model",
+		`{"model":"semantic-hit-model","messages":[{"role":"user","content":"What is the weather today?"}]}`,
+		`{"id":"1","choices":[{"message":{"content":"sunny"}}]}`,
+	)
+	require.Equal(t, 1, first.upstreamCalls)
+	require.Equal(t, "miss", first.recorder.Header().Get("X-Aiproxy-Cache"))
+
+	second := relay(
+		t,
+		p,
+		"semantic-hit-model",
+		`{"model":"semantic-hit-model","messages":[{"role":"user","content":[{"type":"text","text":"How is the weather?"}]}]}`,
+		`{"id":"2"}`,
+	)
+	require.Equal(t, 0, second.upstreamCalls)
+	require.Equal(t, "hit", second.recorder.Header().Get("X-Aiproxy-Cache"))
+	require.JSONEq(t, `{"id":"1","choices":[{"message":{"content":"sunny"}}]}`, second.recorder.Body.String())
+	require.EqualValues(t, 15, second.usage.TotalTokens)
+
+	third := relay(
+		t,
+		p,
+		"semantic-hit-model",
+		`{"model":"semantic-hit-model","messages":[{"role":"user","content":"Tell me a joke"}]}`,
+		`{"id":"3"}`,
+	)
+	require.Equal(t, 1, third.upstreamCalls)
+	require.JSONEq(t, `{"id":"3"}`, third.recorder.Body.String())
+}
+
+func TestSemanticCacheSeparatesStreamResponses(t *testing.T) {
+	t.Parallel()
+
+	p := newSemanticCache(nil, nil)
+	p.Embed = testEmbed
+
+	streamBody := "data: {\"choices\":[{\"delta\":{\"content\":\"sunny\"}}]}\n\ndata: [DONE]\n\n"
+
+	first := relay(
+		t,
+		p,
+		"semantic-stream-model",
+		`{"stream":true,"messages":[{"role":"user","content":"weather?"}]}`,
+		streamBody,
+	)
+	require.Equal(t, 1, first.upstreamCalls)
+
+	nonStream := relay(
+		t,
+		p,
+		"semantic-stream-model",
+		`{"messages":[{"role":"user","content":"weather?"}]}`,
+		`{"id":"1"}`,
+	)
+	require.Equal(t, 1, nonStream.upstreamCalls)
+
+	stream := relay(
+		t,
+		p,
+		"semantic-stream-model",
+		`{"stream":true,"messages":[{"role":"user","content":"the weather"}]}`,
+		"",
+	)
+	require.Equal(t, 0, stream.upstreamCalls)
+	require.Equal(t, streamBody, stream.recorder.Body.String())
+}
+
+func TestSemanticCacheSkipsMCPTools(t *testing.T) {
+	t.Parallel()
+
+	p := newSemanticCache(nil, nil)
+	p.Embed = testEmbed
+
+	m := func(modelName string, config map[string]any) *meta.Meta {
+		m := newTestMeta(modelName)
+		m.ModelConfig.Plugin[mcptools.PluginName] = config
+
+		return m
+	}
+
+	// the answers depend on the tool results, they are neither read nor stored
+	body := `{"mcp_options":{"servers":[{"type":"public","id":"weather"}]},` +
+		`"messages":[{"role":"user","content":"weather?"}]}`
+
+	first := relayMeta(t, p, m("semantic-mcp-model", map[string]any{"enable": true}), body, `{"id":"1"}`)
+	require.Equal(t, 1, first.upstreamCalls)
+	require.Empty(t, first.recorder.Header().Get("X-Aiproxy-Cache"))
+
+	second := relayMeta(t, p, m("semantic-mcp-model", map[string]any{"enable": true}), body, `{"id":"2"}`)
+	require.Equal(t, 1, second.upstreamCalls)
+	require.JSONEq(t, `{"id":"2"}`, second.recorder.Body.String())
+
+	// the servers of the config attach the tools without the options
+	configured := m("semantic-mcp-config-model", map[string]any{
+		"enable":  true,
+		"servers": []map[string]any{{"type": "public", "id": "weather"}},
+	})
+
+	third := relayMeta(
+		t,
+		p,
+		configured,
+		`{"messages":[{"role":"user","content":"weather?"}]}`,
+		`{"id":"3"}`,
+	)
+	require.Equal(t, 1, third.upstreamCalls)
+	require.Empty(t, third.recorder.Header().Get("X-Aiproxy-Cache"))
+}
+
+func TestSemanticCacheSeparatesModels(t *testing.T) {
+	t.Parallel()
+
+	p := newSemanticCache(nil, nil)
+	p.Embed = testEmbed
+
+	body := `{"messages":[{"role":"user","content":"weather?"}]}`
+
+	first := relay(t, p, "semantic-model-a", body, `{"id":"a"}`)
+	require.Equal(t, 1, first.upstreamCalls)
+
+	second := relay(t, p, "semantic-model-b", body, `{"id":"b"}`)
+	require.Equal(t, 1, second.upstreamCalls)
+	require.JSONEq(t, `{"id":"b"}`, second.recorder.Body.String())
+}
+
+func TestSemanticCacheSeparatesGroupsAndTokens(t *testing.T) {
+	t.Parallel()
+
+	p := newSemanticCache(nil, nil)
+	p.Embed = testEmbed
+
+	body := `{"messages":[{"role":"user","content":"weather?"}]}`
+
+	newMeta := func(modelName, groupID string, tokenID int, perToken bool) *meta.Meta {
+		m := newTestMeta(modelName)
+		m.Group.ID = groupID
+		m.Token.ID = tokenID
+		m.ModelConfig.Plugin[PluginName]["per_token"] = perToken
+
+		return m
+	}
+
+	first := relayMeta(t, p, newMeta("semantic-group-model", "group-a", 1, false), body, `{"id":"a"}`)
+	require.Equal(t, 1, first.upstreamCalls)
+
+	otherGroup := relayMeta(t, p, newMeta("semantic-group-model", "group-b", 1, false), body, `{"id":"b"}`)
+	require.Equal(t, 1, otherGroup.upstreamCalls)
+
+	otherToken := relayMeta(t, p, newMeta("semantic-group-model", "group-a", 2, false), body, "")
+	require.Equal(t, 0, otherToken.upstreamCalls)
+	require.JSONEq(t, `{"id":"a"}`, otherToken.recorder.Body.String())
+
+	first = relayMeta(t, p, newMeta("semantic-token-model", "group-a", 1, true), body, `{"id":"c"}`)
+	require.Equal(t, 1, first.upstreamCalls)
+
+	otherToken = relayMeta(t, p, newMeta("semantic-token-model", "group-a", 2, true), body, `{"id":"d"}`)
+	require.Equal(t, 1, otherToken.upstreamCalls)
+
+	sameToken := relayMeta(t, p, newMeta("semantic-token-model", "group-a", 1, true), body, "")
+	require.Equal(t, 0, sameToken.upstreamCalls)
+	require.JSONEq(t, `{"id":"c"}`, sameToken.recorder.Body.String())
+}
+
+func TestSemanticCacheSeparatesContexts(t *testing.T) {
+	t.Parallel()
+
+	p := newSemanticCache(nil, nil)
+	p.Embed = testEmbed
+
+	first := relay(
+		t,
+		p,
+		"semantic-context-model",
+		`{"messages":[{"role":"system","content":"answer in english"},{"role":"user","content":"weather?"}]}`,
+		`{"id":"en"}`,
+	)
+	require.Equal(t, 1, first.upstreamCalls)
+
+	otherSystem := relay(
+		t,
+		p,
+		"semantic-context-model",
+		`{"messages":[{"role":"system","content":"answer in french"},{"role":"user","content":"weather?"}]}`,
+		`{"id":"fr"}`,
+	)
+	require.Equal(t, 1, otherSystem.upstreamCalls)
+
+	otherTurns := relay(
+		t,
+		p,
+		"semantic-context-model",
+		`{"messages":[{"role":"system","content":"answer in english"},{"role":"user","content":"hi"},{"role":"assistant","content":"hello"},{"role":"user","content":"weather?"}]}`,
+		`{"id":"turns"}`,
+	)
+	require.Equal(t, 1, otherTurns.upstreamCalls)
+
+	withTools := relay(
+		t,
+		p,
+		"semantic-context-model",
+		`{"messages":[{"role":"system","content":"answer in english"},{"role":"user","content":"weather?"}],"tools":[{"type":"function","function":{"name":"get_weather"}}]}`,
+		`{"id":"tools"}`,
+	)
+	require.Equal(t, 1, withTools.upstreamCalls)
+
+	sameContext := relay(
+		t,
+		p,
+		"semantic-context-model",
+		`{"messages":[{"role":"system","content":"answer in english"},{"role":"user","content":"the weather"}]}`,
+		"",
+	)
+	require.Equal(t, 0, sameContext.upstreamCalls)
+	require.JSONEq(t, `{"id":"en"}`, sameContext.recorder.Body.String())
+}
+
+func TestExtractLastUserText(t *testing.T) {
+	t.Parallel()
+
+	req := cacheRequest{
+		Messages: []json.RawMessage{
+			json.RawMessage(`{"role":"user","content":"first"}`),
+			json.RawMessage(`{"role":"user","content":[` +
+				`{"type":"image_url"},` +
+				`{"type":"text","text":"hello"},` +
+				`{"type":"text","text":"world"}]}`),
+			json.RawMessage(`{"role":"assistant","content":"answer"}`),
+		},
+	}
+
+	text, index := extractLastUserText(&req)
+	require.Equal(t, "hello\nworld", text)
+	require.Equal(t, 1, index)
+}
+
+func TestBestMatches(t *testing.T) {
+	t.Parallel()
+
+	entries := []entry{
+		{Key: "orthogonal", Vector: []float64{0, 1}},
+		{Key: "close", Vector: []float64{1, 0.2}},
+		{Key: "same", Vector: []float64{2, 0}},
+		{Key: "dimension", Vector: []float64{1, 0, 0}},
+	}
+
+	matches := bestMatches(entries, []float64{1, 0}, 0.9)
+	require.Len(t, matches, 2)
+	require.Equal(t, "same", matches[0].Key)
+	require.Equal(t, "close", matches[1].Key)
+}
+
+func TestConfigDecodesCacheFields(t *testing.T) {
+	t.Parallel()
+
+	m := newTestMeta("semantic-config-model")
+	m.ModelConfig.Plugin[PluginName]["ttl"] = 60
+	m.ModelConfig.Plugin[PluginName]["similarity_threshold"] = 0.8
+
+	cfg, err := (&SemanticCache{}).getConfig(m)
+	require.NoError(t, err)
+	require.True(t, cfg.Enable)
+	require.True(t, cfg.AddCacheHitHeader)
+	require.Equal(t, 60, cfg.TTL)
+	require.InDelta(t, 0.8, cfg.SimilarityThreshold, 1e-9)
+	require.Equal(t, defaultMaxEntries, cfg.MaxEntries)
+	require.Equal(t, "text-embedding-3-small", cfg.EmbeddingModel)
+}
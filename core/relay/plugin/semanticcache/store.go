@@ -0,0 +1,195 @@
+package semanticcache
+
+import (
+	"cmp"
+	"context"
+	"math"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/bytedance/sonic"
+	"github.com/labring/aiproxy/core/common"
+	gcache "github.com/patrickmn/go-cache"
+)
+
+const redisVectorPrefix = "semantic-cache:"
+
+// entry is a cached query vector, the response is stored in the cache plugin by key
+type entry struct {
+	Key    string    `json:"key"`
+	Vector []float64 `json:"vector"`
+}
+
+var (
+	// vectors holds the newest entries first for every namespace
+	vectors     = gcache.New(30*time.Second, 5*time.Minute)
+	vectorsLock sync.Mutex
+)
+
+func cosineSimilarity(a, b []float64) float64 {
+	if len(a) == 0 || len(a) != len(b) {
+		return 0
+	}
+
+	var dot, normA, normB float64
+	for i := range a {
+		dot += a[i] * b[i]
+		normA += a[i] * a[i]
+		normB += b[i] * b[i]
+	}
+
+	if normA == 0 || normB == 0 {
+		return 0
+	}
+
+	return dot / (math.Sqrt(normA) * math.Sqrt(normB))
+}
+
+// bestMatches returns the entries whose similarity reaches the threshold, the most
+// similar one first
+func bestMatches(entries []entry, vector []float64, threshold float64) []entry {
+	scores := make(map[string]float64)
+	matches := make([]entry, 0)
+
+	for _, e := range entries {
+		score := cosineSimilarity(vector, e.Vector)
+		if score < threshold {
+			continue
+		}
+
+		scores[e.Key] = score
+		matches = append(matches, e)
+	}
+
+	slices.SortStableFunc(matches, func(a, b entry) int {
+		return cmp.Compare(scores[b.Key], scores[a.Key])
+	})
+
+	return matches
+}
+
+func (p *SemanticCache) getFromRedis(
+	ctx context.Context,
+	namespace string,
+	maxEntries int,
+) ([]entry, error) {
+	if p.rdb == nil {
+		return nil, nil
+	}
+
+	values, err := p.rdb.LRange(
+		ctx,
+		common.RedisKey(redisVectorPrefix, namespace),
+		0,
+		int64(maxEntries)-1,
+	).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	entries := make([]entry, 0, len(values))
+	for _, v := range values {
+		var e entry
+		if err := sonic.UnmarshalString(v, &e); err != nil {
+			continue
+		}
+
+		entries = append(entries, e)
+	}
+
+	return entries, nil
+}
+
+func (p *SemanticCache) addToRedis(
+	ctx context.Context,
+	namespace string,
+	e entry,
+	maxEntries int,
+	ttl time.Duration,
+) error {
+	if p.rdb == nil {
+		return nil
+	}
+
+	data, err := sonic.Marshal(e)
+	if err != nil {
+		return err
+	}
+
+	key := common.RedisKey(redisVectorPrefix, namespace)
+
+	pipe := p.rdb.TxPipeline()
+	pipe.LPush(ctx, key, data)
+	pipe.LTrim(ctx, key, 0, int64(maxEntries)-1)
+
+	if ttl > 0 {
+		pipe.Expire(ctx, key, ttl)
+	}
+
+	_, err = pipe.Exec(ctx)
+
+	return err
+}
+
+// getEntries retrieves the vectors of a namespace (Redis or memory)
+func (p *SemanticCache) getEntries(
+	ctx context.Context,
+	namespace string,
+	maxEntries int,
+) []entry {
+	// Try Redis first if available
+	if p.rdb != nil {
+		entries, err := p.getFromRedis(ctx, namespace, maxEntries)
+		if err == nil && len(entries) > 0 {
+			return entries
+		}
+		// If Redis fails, fallback to memory cache
+	}
+
+	if v, ok := vectors.Get(namespace); ok {
+		if entries, ok := v.([]entry); ok {
+			return entries[:min(len(entries), maxEntries)]
+		}
+	}
+
+	return nil
+}
+
+// addEntry stores the vector of a namespace (Redis and/or memory)
+func (p *SemanticCache) addEntry(
+	ctx context.Context,
+	namespace string,
+	e entry,
+	maxEntries int,
+	ttl time.Duration,
+) {
+	if p.rdb != nil {
+		_ = p.addToRedis(ctx, namespace, e, maxEntries, ttl)
+	}
+
+	vectorsLock.Lock()
+	defer vectorsLock.Unlock()
+
+	var entries []entry
+	if v, ok := vectors.Get(namespace); ok {
+		entries, _ = v.([]entry)
+	}
+
+	newEntries := make([]entry, 0, min(len(entries)+1, maxEntries))
+	newEntries = append(newEntries, e)
+
+	for _, old := range entries {
+		if len(newEntries) >= maxEntries {
+			break
+		}
+
+		if old.Key == e.Key {
+			continue
+		}
+
+		newEntries = append(newEntries, old)
+	}
+
+	vectors.Set(namespace, newEntries, ttl)
+}
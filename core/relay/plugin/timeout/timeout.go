@@ -58,7 +58,8 @@ func (t *Timeout) ConvertRequest(
 	case mode.ResponsesGet,
 		mode.ResponsesDelete,
 		mode.ResponsesCancel,
-		mode.ResponsesInputItems:
+		mode.ResponsesInputItems,
+		mode.AnthropicCountTokens:
 		meta.RequestTimeout = time.Second * 30
 	case mode.ChatCompletions,
 		mode.Completions,
@@ -1,5 +1,9 @@
 package render
 
+// Responses renders an event of the Responses API stream, the events share the
+// `event:` and `data:` lines of the Anthropic stream
+type Responses = Anthropic
+
 var (
 	ResponsesData            = ClaudeData
 	ResponsesEventData       = ClaudeEventData
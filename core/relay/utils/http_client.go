@@ -11,6 +11,7 @@ import (
 	"strings"
 	"time"
 
+	"github.com/gorilla/websocket"
 	"github.com/patrickmn/go-cache"
 	xproxy "golang.org/x/net/proxy"
 )
@@ -211,3 +212,19 @@ func LoadHTTPClientWithTLSConfigE(
 
 	return client, nil
 }
+
+// LoadWebSocketDialer returns a websocket dialer with the same proxy and tls settings as
+// the http client of the channel
+func LoadWebSocketDialer(proxyURL string, skipTLSVerify bool) (*websocket.Dialer, error) {
+	transport, err := createTransport(0, proxyURL, skipTLSVerify)
+	if err != nil {
+		return nil, err
+	}
+
+	return &websocket.Dialer{
+		Proxy:            transport.Proxy,
+		NetDialContext:   transport.DialContext,
+		TLSClientConfig:  transport.TLSClientConfig,
+		HandshakeTimeout: websocket.DefaultDialer.HandshakeTimeout,
+	}, nil
+}
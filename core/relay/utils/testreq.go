@@ -104,6 +104,8 @@ func BuildRequest(modelConfig model.ModelConfig) (io.Reader, mode.Mode, error) {
 		return body, mode.Videos, nil
 	case mode.ParsePdf:
 		return nil, mode.Unknown, NewErrUnsupportedModelType("parse pdf")
+	case mode.Realtime:
+		return nil, mode.Unknown, NewErrUnsupportedModelType("realtime")
 	case mode.GeminiVideo:
 		body, err := BuildGeminiVideoRequest(modelConfig.Model)
 		if err != nil {
@@ -72,6 +72,7 @@ func SetAPIRouter(router *gin.Engine) {
 			groupRoute.POST("/:group/status", controller.UpdateGroupStatus)
 			groupRoute.POST("/:group/rpm_ratio", controller.UpdateGroupRPMRatio)
 			groupRoute.POST("/:group/tpm_ratio", controller.UpdateGroupTPMRatio)
+			groupRoute.GET("/:group/statement", controller.GetGroupStatement)
 
 			groupModelConfigsRoute := groupRoute.Group("/:group/model_configs")
 			{
@@ -94,6 +95,16 @@ func SetAPIRouter(router *gin.Engine) {
 				groupMcpRoute.GET("/", mcp.GetGroupPublicMCPs)
 				groupMcpRoute.GET("/:id", mcp.GetGroupPublicMCPByID)
 			}
+
+			groupWalletRoute := groupRoute.Group("/:group/wallet")
+			{
+				groupWalletRoute.GET("/", controller.GetGroupWallet)
+				groupWalletRoute.POST("/credit", controller.CreditGroupWallet)
+				groupWalletRoute.POST("/debit", controller.DebitGroupWallet)
+				groupWalletRoute.POST("/credit_limit", controller.UpdateGroupWalletCreditLimit)
+				groupWalletRoute.GET("/ledgers", controller.GetGroupWalletLedgers)
+				groupWalletRoute.GET("/topups", controller.GetGroupWalletTopUps)
+			}
 		}
 
 		optionRoute := apiRouter.Group("/option")
@@ -106,6 +117,13 @@ func SetAPIRouter(router *gin.Engine) {
 			optionRoute.POST("/batch", controller.UpdateOptions)
 		}
 
+		configRoute := apiRouter.Group("/config")
+		{
+			configRoute.GET("/plan", controller.PlanYAMLConfig)
+			configRoute.POST("/plan", controller.PlanYAMLConfig)
+			configRoute.POST("/apply", controller.ApplyYAMLConfig)
+		}
+
 		channelsRoute := apiRouter.Group("/channels")
 		{
 			channelsRoute.GET("/", controller.GetChannels)
@@ -151,6 +169,7 @@ func SetAPIRouter(router *gin.Engine) {
 			tokensRoute.PUT("/:id", controller.UpdateToken)
 			tokensRoute.POST("/:id/status", controller.UpdateTokenStatus)
 			tokensRoute.POST("/:id/name", controller.UpdateTokenName)
+			tokensRoute.POST("/:id/rotate", controller.RotateToken)
 			tokensRoute.DELETE("/:id", controller.DeleteToken)
 			tokensRoute.GET("/search", controller.SearchTokens)
 			tokensRoute.POST("/batch_delete", controller.DeleteTokens)
@@ -166,6 +185,7 @@ func SetAPIRouter(router *gin.Engine) {
 			tokenRoute.PUT("/:group/:id", controller.UpdateGroupToken)
 			tokenRoute.POST("/:group/:id/status", controller.UpdateGroupTokenStatus)
 			tokenRoute.POST("/:group/:id/name", controller.UpdateGroupTokenName)
+			tokenRoute.POST("/:group/:id/rotate", controller.RotateGroupToken)
 			tokenRoute.DELETE("/:group/:id", controller.DeleteGroupToken)
 		}
 
@@ -187,6 +207,19 @@ func SetAPIRouter(router *gin.Engine) {
 			logRoute.GET("/:group/detail/:log_id", controller.GetGroupLogDetail)
 		}
 
+		mcpLogsRoute := apiRouter.Group("/mcp_logs")
+		{
+			mcpLogsRoute.GET("/export", controller.ExportMCPLogs)
+			mcpLogsRoute.GET("/search", controller.SearchMCPLogs)
+			mcpLogsRoute.DELETE("/", controller.DeleteHistoryMCPLogs)
+		}
+
+		mcpLogRoute := apiRouter.Group("/mcp_log")
+		{
+			mcpLogRoute.GET("/:group/export", controller.ExportGroupMCPLogs)
+			mcpLogRoute.GET("/:group/search", controller.SearchGroupMCPLogs)
+		}
+
 		modelConfigsRoute := apiRouter.Group("/model_configs")
 		{
 			modelConfigsRoute.GET("/", controller.GetModelConfigs)
@@ -204,6 +237,22 @@ func SetAPIRouter(router *gin.Engine) {
 			modelConfigRoute.DELETE("/*model", controller.DeleteModelConfig)
 		}
 
+		routingRoute := apiRouter.Group("/routing")
+		{
+			routingRoute.GET("/dry_run", controller.RoutingDryRun)
+		}
+
+		promptsRoute := apiRouter.Group("/prompts")
+		{
+			promptsRoute.GET("/:group", controller.GetPrompts)
+			promptsRoute.POST("/:group", controller.CreatePrompt)
+			promptsRoute.GET("/:group/:id", controller.GetPrompt)
+			promptsRoute.PUT("/:group/:id", controller.UpdatePrompt)
+			promptsRoute.DELETE("/:group/:id", controller.DeletePrompt)
+			promptsRoute.GET("/:group/:id/versions", controller.GetPromptVersions)
+			promptsRoute.DELETE("/:group/:id/versions/:version", controller.DeletePromptVersion)
+		}
+
 		monitorRoute := apiRouter.Group("/monitor")
 		{
 			monitorRoute.GET("/", controller.GetAllChannelModelErrorRates)
@@ -218,6 +267,7 @@ func SetAPIRouter(router *gin.Engine) {
 			monitorRoute.POST("/batch_group_token_metrics", controller.BatchGetGroupTokenMetrics)
 			monitorRoute.GET("/models", controller.GetModelsErrorRate)
 			monitorRoute.GET("/banned_channels", controller.GetAllBannedModelChannels)
+			monitorRoute.GET("/ttfb", controller.GetModelChannelTTFB)
 			monitorRoute.GET("/:id", controller.GetChannelModelErrorRates)
 			monitorRoute.DELETE("/", controller.ClearAllModelErrors)
 			monitorRoute.DELETE("/:id", controller.ClearChannelAllModelErrors)
@@ -257,6 +307,16 @@ func SetAPIRouter(router *gin.Engine) {
 			groupMcpRoute.POST("/:group/:id/status", mcp.UpdateGroupMCPStatus)
 		}
 
+		virtualMcpRoute := apiRouter.Group("/mcp/virtual")
+		{
+			virtualMcpRoute.GET("/:group", mcp.GetVirtualMCPs)
+			virtualMcpRoute.GET("/:group/:id", mcp.GetVirtualMCPByID)
+			virtualMcpRoute.POST("/:group", mcp.CreateVirtualMCP)
+			virtualMcpRoute.PUT("/:group/:id", mcp.UpdateVirtualMCP)
+			virtualMcpRoute.DELETE("/:group/:id", mcp.DeleteVirtualMCP)
+			virtualMcpRoute.POST("/:group/:id/status", mcp.UpdateVirtualMCPStatus)
+		}
+
 		embedMcpRoute := apiRouter.Group("/embedmcp")
 		{
 			embedMcpRoute.GET("/", mcp.GetEmbedMCPs)
@@ -19,6 +19,11 @@ func SetMCPRouter(router *gin.Engine) {
 	mcpRoute.POST("/group/:id", mcp.GroupMCPStreamable)
 	mcpRoute.DELETE("/group/:id", mcp.GroupMCPStreamable)
 
+	mcpRoute.GET("/virtual/:id/sse", mcp.VirtualMCPSSEServer)
+	mcpRoute.GET("/virtual/:id", mcp.VirtualMCPStreamable)
+	mcpRoute.POST("/virtual/:id", mcp.VirtualMCPStreamable)
+	mcpRoute.DELETE("/virtual/:id", mcp.VirtualMCPStreamable)
+
 	router.GET("/sse", middleware.MCPAuth, mcp.HostMCPSSEServer)
 	router.POST("/message", mcp.MCPMessage)
 	router.GET("/mcp", middleware.MCPAuth, mcp.HostMCPStreamable)
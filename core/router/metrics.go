@@ -0,0 +1,19 @@
+package router
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/labring/aiproxy/core/common/config"
+	"github.com/labring/aiproxy/core/common/metrics"
+	"github.com/labring/aiproxy/core/middleware"
+)
+
+func SetMetricsRouter(router *gin.Engine) {
+	handler := gin.WrapH(metrics.Handler())
+
+	if config.DisableMetricsAuth {
+		router.GET("/metrics", handler)
+		return
+	}
+
+	router.GET("/metrics", middleware.AdminAuth, handler)
+}
@@ -103,6 +103,10 @@ func SetRelayRouter(router *gin.Engine) {
 			"/messages",
 			controller.Anthropic()...,
 		)
+		relayRouter.POST(
+			"/messages/count_tokens",
+			controller.AnthropicCountTokens()...,
+		)
 		relayRouter.POST(
 			"/images/edits",
 			controller.ImagesEdits()...,
@@ -201,11 +205,16 @@ func SetRelayRouter(router *gin.Engine) {
 		)
 
 		relayRouter.POST("/images/variations", controller.RelayNotImplemented)
-		relayRouter.GET("/files", controller.RelayNotImplemented)
-		relayRouter.POST("/files", controller.RelayNotImplemented)
-		relayRouter.DELETE("/files/:id", controller.RelayNotImplemented)
-		relayRouter.GET("/files/:id", controller.RelayNotImplemented)
-		relayRouter.GET("/files/:id/content", controller.RelayNotImplemented)
+		relayRouter.GET("/files", controller.ListFiles)
+		relayRouter.POST("/files", controller.CreateFile()...)
+		relayRouter.DELETE("/files/:id", controller.DeleteFile()...)
+		relayRouter.GET("/files/:id", controller.GetFile()...)
+		relayRouter.GET("/files/:id/content", controller.GetFileContent()...)
+		relayRouter.GET("/batches", controller.ListBatches)
+		relayRouter.POST("/batches", controller.CreateBatch()...)
+		relayRouter.GET("/batches/:id", controller.GetBatch()...)
+		relayRouter.POST("/batches/:id/cancel", controller.CancelBatch()...)
+		relayRouter.GET("/realtime", controller.Realtime()...)
 		relayRouter.POST("/fine_tuning/jobs", controller.RelayNotImplemented)
 		relayRouter.GET("/fine_tuning/jobs", controller.RelayNotImplemented)
 		relayRouter.GET("/fine_tuning/jobs/:id", controller.RelayNotImplemented)
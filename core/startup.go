@@ -18,6 +18,7 @@ import (
 	"github.com/labring/aiproxy/core/common/balance"
 	"github.com/labring/aiproxy/core/common/config"
 	"github.com/labring/aiproxy/core/common/conv"
+	"github.com/labring/aiproxy/core/common/env"
 	"github.com/labring/aiproxy/core/common/notify"
 	"github.com/labring/aiproxy/core/common/oncall"
 	"github.com/labring/aiproxy/core/common/pprof"
@@ -29,7 +30,9 @@ import (
 
 func initializeServices(pprofPort int) error {
 	initializePprof(pprofPort)
-	initializeNotifier()
+	if err := initializeNotifier(); err != nil {
+		return err
+	}
 
 	if err := common.InitRedisClient(); err != nil {
 		return err
@@ -65,7 +68,15 @@ func initializePprof(pprofPort int) {
 func initializeBalance() error {
 	sealosJwtKey := os.Getenv("SEALOS_JWT_KEY")
 	if sealosJwtKey == "" {
+		if env.Bool("BALANCE_WALLET_ENABLE", false) {
+			log.Info("BALANCE_WALLET_ENABLE is set, wallet balance will be enabled")
+			balance.InitWallet()
+
+			return nil
+		}
+
 		log.Info("SEALOS_JWT_KEY is not set, balance will not be enabled")
+
 		return nil
 	}
 
@@ -74,12 +85,25 @@ func initializeBalance() error {
 	return balance.InitSealos(sealosJwtKey, os.Getenv("SEALOS_ACCOUNT_URL"))
 }
 
-func initializeNotifier() {
-	feishuWh := os.Getenv("NOTIFY_FEISHU_WEBHOOK")
-	if feishuWh != "" {
-		notify.SetDefaultNotifier(notify.NewFeishuNotify(feishuWh))
-		log.Info("NOTIFY_FEISHU_WEBHOOK is set, notifier will be use feishu")
+func initializeNotifier() error {
+	routes, err := notify.RoutesFromEnv()
+	if err != nil {
+		return fmt.Errorf("invalid notify config: %w", err)
 	}
+
+	if len(routes) == 0 {
+		return nil
+	}
+
+	names := make([]string, 0, len(routes))
+	for _, route := range routes {
+		names = append(names, route.Sender.Name())
+	}
+
+	notify.SetDefaultNotifier(notify.NewRouteNotifier(routes...))
+	log.Infof("notifier will be use %s", strings.Join(names, ", "))
+
+	return nil
 }
 
 func initializeOptionAndCaches() error {
@@ -89,6 +113,15 @@ func initializeOptionAndCaches() error {
 		return err
 	}
 
+	if config.ConfigApplyOnStart {
+		plan, err := model.ApplyYAMLConfig(model.LoadYAMLConfig(), config.ConfigApplyPrune)
+		if err != nil {
+			return fmt.Errorf("apply config: %w", err)
+		}
+
+		log.Infof("applied %d changes from config", len(plan.Changes))
+	}
+
 	return model.InitModelConfigAndChannelCache()
 }
 
@@ -10,6 +10,7 @@ import (
 	"github.com/glebarez/sqlite"
 	"github.com/labring/aiproxy/core/common/balance"
 	"github.com/labring/aiproxy/core/model"
+	"github.com/labring/aiproxy/core/relay/mode"
 	"github.com/stretchr/testify/require"
 	"gorm.io/gorm"
 )
@@ -502,3 +503,57 @@ func TestMarkAsyncUsageFailedWritesLogMessage(t *testing.T) {
 	require.Equal(t, model.AsyncUsageStatusFailed, got.AsyncUsageStatus)
 	require.Equal(t, "upstream task failed", string(got.Content))
 }
+
+func TestCompleteAsyncModelUsageBillsEachModel(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	require.NoError(t, err)
+	require.NoError(t, db.AutoMigrate(&model.Log{}, &model.AsyncUsageInfo{}))
+
+	oldLogDB := model.LogDB
+	oldLoadModelConfig := loadAsyncUsageModelConfig
+	model.LogDB = db
+	loadAsyncUsageModelConfig = func(_, modelName string) (model.ModelConfig, bool) {
+		if modelName != "gpt-4o" {
+			return model.ModelConfig{}, false
+		}
+
+		return model.ModelConfig{
+			Model: modelName,
+			Price: model.Price{InputPrice: 10, InputPriceUnit: 1},
+		}, true
+	}
+
+	t.Cleanup(func() {
+		model.LogDB = oldLogDB
+		loadAsyncUsageModelConfig = oldLoadModelConfig
+	})
+
+	info := &model.AsyncUsageInfo{
+		RequestID:       "batch_models",
+		RequestAt:       time.Now(),
+		Status:          model.AsyncUsageStatusPending,
+		Mode:            int(mode.Batches),
+		Model:           "gpt-4o-mini",
+		Price:           model.Price{InputPrice: 1, InputPriceUnit: 1},
+		ProcessingToken: "claim-token",
+	}
+	require.NoError(t, model.CreateAsyncUsageInfo(info))
+
+	modelUsages := map[string]model.Usage{
+		"gpt-4o-mini": {InputTokens: 2, TotalTokens: 2},
+		"gpt-4o":      {InputTokens: 3, TotalTokens: 3},
+		// unknown models are billed at the price of the batch model
+		"unknown-model": {InputTokens: 4, TotalTokens: 4},
+	}
+
+	require.NoError(t, completeAsyncModelUsage(
+		context.Background(),
+		info,
+		model.Usage{InputTokens: 9, TotalTokens: 9},
+		model.UsageContext{},
+		modelUsages,
+	))
+	require.Equal(t, model.AsyncUsageStatusCompleted, info.Status)
+	require.Equal(t, model.ZeroNullInt64(9), info.Usage.InputTokens)
+	require.InDelta(t, 2+30+4, info.Amount.UsedAmount, 1e-9)
+}
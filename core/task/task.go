@@ -19,6 +19,7 @@ import (
 	"github.com/labring/aiproxy/core/common/consume"
 	"github.com/labring/aiproxy/core/common/conv"
 	"github.com/labring/aiproxy/core/common/ipblack"
+	"github.com/labring/aiproxy/core/common/metrics"
 	"github.com/labring/aiproxy/core/common/notify"
 	"github.com/labring/aiproxy/core/common/oncall"
 	"github.com/labring/aiproxy/core/common/trylock"
@@ -26,6 +27,7 @@ import (
 	"github.com/labring/aiproxy/core/model"
 	"github.com/labring/aiproxy/core/relay/adaptor"
 	"github.com/labring/aiproxy/core/relay/adaptors"
+	"github.com/labring/aiproxy/core/relay/mode"
 	log "github.com/sirupsen/logrus"
 	"gorm.io/gorm"
 )
@@ -233,6 +235,61 @@ func formatGroupUsageAlerts(alerts []model.GroupUsageAlertItem) string {
 	return result.String()
 }
 
+// DisableExpiredTokensTask disables the tokens whose expiration has passed
+func DisableExpiredTokensTask(ctx context.Context) {
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if !trylock.Lock("disableExpiredTokens", time.Minute) {
+				continue
+			}
+
+			disableExpiredTokens()
+		}
+	}
+}
+
+func disableExpiredTokens() {
+	tokens, err := model.DisableExpiredTokens()
+	if err != nil {
+		notify.ErrorThrottle(
+			"disableExpiredTokensError",
+			time.Minute*5,
+			"disable expired tokens failed",
+			err.Error(),
+		)
+
+		return
+	}
+
+	if len(tokens) == 0 {
+		return
+	}
+
+	notify.Info(
+		fmt.Sprintf("Disabled %d expired tokens", len(tokens)),
+		formatExpiredTokens(tokens),
+	)
+}
+
+func formatExpiredTokens(tokens []model.Token) string {
+	var result strings.Builder
+	for _, token := range tokens {
+		fmt.Fprintf(&result, "GroupID: %s | Token: %s[%d] | ExpiredAt: %s\n",
+			token.GroupID,
+			token.Name,
+			token.ID,
+			token.ExpiredAt.Format(time.RFC3339))
+	}
+
+	return result.String()
+}
+
 // CleanLogTask 清理日志任务
 func CleanLogTask(ctx context.Context) {
 	// the interval should not be too large to avoid cleaning too much at once
@@ -269,6 +326,8 @@ const (
 	asyncUsageBatchSize       = 50
 	asyncUsageConcurrency     = 10
 	asyncUsageMaxRetry        = 10
+	// batches take hours to finish, there is no need to poll them as often
+	asyncUsageBatchPollDelay = time.Minute
 )
 
 func AsyncUsagePollTask(ctx context.Context) {
@@ -280,6 +339,8 @@ func AsyncUsagePollTask(ctx context.Context) {
 		case <-ctx.Done():
 			return
 		case <-ticker.C:
+			updateAsyncUsagePendingMetric()
+
 			for {
 				fullBatch := processAsyncUsages(ctx)
 				if !fullBatch {
@@ -301,6 +362,16 @@ func AsyncUsagePollTask(ctx context.Context) {
 	}
 }
 
+func updateAsyncUsagePendingMetric() {
+	count, err := model.CountPendingAsyncUsages()
+	if err != nil {
+		log.Errorf("count pending async usages failed: %v", err)
+		return
+	}
+
+	metrics.SetAsyncUsagePending(count)
+}
+
 func processAsyncUsages(ctx context.Context) bool {
 	infos, err := model.GetPendingAsyncUsages(asyncUsageBatchSize)
 	if err != nil {
@@ -469,11 +540,30 @@ func processOneAsyncUsage(ctx context.Context, info *model.AsyncUsageInfo) {
 		return
 	}
 
-	usage, usageContext, completed, err := fetcher.FetchAsyncUsage(ctx, adaptor.AsyncUsageRequest{
+	var (
+		usage        model.Usage
+		usageContext model.UsageContext
+		modelUsages  map[string]model.Usage
+		completed    bool
+	)
+
+	request := adaptor.AsyncUsageRequest{
 		Channel: channel,
 		Info:    info,
 		Store:   controller.AdaptorStore,
-	})
+	}
+
+	// the requests of a batch may use several models, each billed at its own price
+	if modelFetcher, ok := a.(adaptor.AsyncModelUsageFetcher); ok &&
+		mode.Mode(info.Mode) == mode.Batches {
+		modelUsages, completed, err = modelFetcher.FetchAsyncModelUsage(ctx, request)
+		for _, modelUsage := range modelUsages {
+			usage.Add(modelUsage)
+		}
+	} else {
+		usage, usageContext, completed, err = fetcher.FetchAsyncUsage(ctx, request)
+	}
+
 	if err != nil {
 		if completed {
 			log.Debugf(
@@ -505,7 +595,7 @@ func processOneAsyncUsage(ctx context.Context, info *model.AsyncUsageInfo) {
 		return
 	}
 
-	if err := completeAsyncUsage(ctx, info, usage, usageContext); err != nil {
+	if err := completeAsyncModelUsage(ctx, info, usage, usageContext, modelUsages); err != nil {
 		log.Debugf(
 			"async usage poll: complete_error id=%d request_id=%s upstream_id=%s err=%v",
 			info.ID,
@@ -591,31 +681,101 @@ func completeAsyncUsage(
 	info *model.AsyncUsageInfo,
 	usage model.Usage,
 	usageContext model.UsageContext,
+) error {
+	return completeAsyncModelUsage(ctx, info, usage, usageContext, nil)
+}
+
+// loadAsyncUsageModelConfig returns the model config of a model used by the
+// requests of a batch with the group model config applied, it is replaced in tests
+var loadAsyncUsageModelConfig = func(groupID, modelName string) (model.ModelConfig, bool) {
+	modelCaches := model.LoadModelCaches()
+	if modelCaches.ModelConfig == nil {
+		return model.ModelConfig{}, false
+	}
+
+	mc, ok := modelCaches.ModelConfig.GetModelConfig(modelName)
+	if !ok {
+		return model.ModelConfig{}, false
+	}
+
+	if group, err := model.CacheGetGroup(groupID); err == nil {
+		if groupModelConfig, ok := group.ModelConfigs[modelName]; ok {
+			mc = mc.LoadFromGroupModelConfig(groupModelConfig)
+		}
+	}
+
+	return mc, true
+}
+
+// asyncUsageModelPrice returns the price of a model used by the requests of a
+// batch, the unknown models are billed at the price of the batch model
+func asyncUsageModelPrice(info *model.AsyncUsageInfo, modelName string) model.Price {
+	if modelName == "" || modelName == info.Model {
+		return info.Price
+	}
+
+	mc, ok := loadAsyncUsageModelConfig(info.GroupID, modelName)
+	if !ok {
+		log.Warnf(
+			"async usage model config not found, bill at the batch model price: id=%d model=%s",
+			info.ID,
+			modelName,
+		)
+
+		return info.Price
+	}
+
+	return mc.Price
+}
+
+// completeAsyncModelUsage settles the async usage, the usage of every model in
+// modelUsages is billed at the price of that model
+func completeAsyncModelUsage(
+	ctx context.Context,
+	info *model.AsyncUsageInfo,
+	usage model.Usage,
+	usageContext model.UsageContext,
+	modelUsages map[string]model.Usage,
 ) error {
 	usageContext = usageContext.WithFallback(info.UsageContext)
 
 	price := info.Price
+	options := model.PriceSelectionOptions{
+		DisableResolutionFuzzyMatch: info.DisableResolutionFuzzyMatch,
+		RequestAt:                   info.RequestAt,
+	}
 
 	amount := consume.CalculateAmountDetailWithOptions(
 		http.StatusOK,
 		usage,
 		usageContext,
 		price,
-		model.PriceSelectionOptions{
-			DisableResolutionFuzzyMatch: info.DisableResolutionFuzzyMatch,
-			RequestAt:                   info.RequestAt,
-		},
+		options,
 	)
 	selectedPrice := price.SelectConditionalPriceWithOptions(
 		usage,
 		usageContext,
-		model.PriceSelectionOptions{
-			DisableResolutionFuzzyMatch: info.DisableResolutionFuzzyMatch,
-			RequestAt:                   info.RequestAt,
-		},
+		options,
 	)
 	selectedPrice.ConditionalPrices = nil
 
+	modelAmounts := make(map[string]model.Amount, len(modelUsages))
+	if len(modelUsages) > 0 {
+		amount = model.Amount{}
+
+		for modelName, modelUsage := range modelUsages {
+			modelAmount := consume.CalculateAmountDetailWithOptions(
+				http.StatusOK,
+				modelUsage,
+				usageContext,
+				asyncUsageModelPrice(info, modelName),
+				options,
+			)
+			modelAmounts[modelName] = modelAmount
+			amount.Add(modelAmount)
+		}
+	}
+
 	if amount.UsedAmount > 0 && !info.BalanceConsumed {
 		charged, err := consumeAsyncUsageGroupBalance(ctx, info, amount.UsedAmount)
 		if err != nil {
@@ -666,19 +826,44 @@ func completeAsyncUsage(
 		}
 	}
 
-	model.BatchUpdateSummaryOnlyUsage(
-		time.Now(),
-		info.RequestAt,
-		info.GroupID,
-		info.ChannelID,
-		info.Model,
-		info.TokenID,
-		info.TokenName,
-		usage,
-		amount,
-		usageContext.ServiceTier,
-		model.IsClaudeLongContextSummary(info.Model, usage),
-	)
+	if len(modelUsages) == 0 {
+		model.BatchUpdateSummaryOnlyUsage(
+			time.Now(),
+			info.RequestAt,
+			info.GroupID,
+			info.ChannelID,
+			info.Model,
+			info.Mode,
+			info.TokenID,
+			info.TokenName,
+			usage,
+			amount,
+			usageContext.ServiceTier,
+			model.IsClaudeLongContextSummary(info.Model, usage),
+		)
+	}
+
+	for modelName, modelUsage := range modelUsages {
+		modelAmount := modelAmounts[modelName]
+		if modelName == "" {
+			modelName = info.Model
+		}
+
+		model.BatchUpdateSummaryOnlyUsage(
+			time.Now(),
+			info.RequestAt,
+			info.GroupID,
+			info.ChannelID,
+			modelName,
+			info.Mode,
+			info.TokenID,
+			info.TokenName,
+			modelUsage,
+			modelAmount,
+			usageContext.ServiceTier,
+			model.IsClaudeLongContextSummary(modelName, modelUsage),
+		)
+	}
 
 	info.Status = model.AsyncUsageStatusCompleted
 	info.Usage = usage
@@ -740,7 +925,7 @@ func scheduleAsyncUsageRetry(info *model.AsyncUsageInfo, err error) {
 
 func touchAsyncUsagePollCursor(info *model.AsyncUsageInfo) {
 	info.Error = ""
-	info.NextPollAt = time.Now().Add(model.AsyncUsageDefaultPollDelay)
+	info.NextPollAt = time.Now().Add(asyncUsagePendingPollDelay(info))
 
 	if err := model.TouchClaimedAsyncUsageInfo(info); err != nil {
 		notify.ErrorThrottle(
@@ -752,6 +937,14 @@ func touchAsyncUsagePollCursor(info *model.AsyncUsageInfo) {
 	}
 }
 
+func asyncUsagePendingPollDelay(info *model.AsyncUsageInfo) time.Duration {
+	if mode.Mode(info.Mode) == mode.Batches {
+		return asyncUsageBatchPollDelay
+	}
+
+	return model.AsyncUsageDefaultPollDelay
+}
+
 func consumeAsyncUsageGroupBalance(
 	ctx context.Context,
 	info *model.AsyncUsageInfo,
@@ -775,7 +968,11 @@ func consumeAsyncUsageGroupBalance(
 		return false, nil
 	}
 
-	_, err = consumer.PostGroupConsume(ctx, info.TokenName, amount)
+	_, err = consumer.PostGroupConsume(
+		balance.WithRequestID(ctx, info.RequestID),
+		info.TokenName,
+		amount,
+	)
 
 	return true, err
 }
@@ -871,6 +1068,8 @@ func checkRedisHealth() {
 	defer cancel()
 
 	_, err := common.RDB.Ping(ctx).Result()
+	metrics.SetRedisUp(err == nil)
+
 	if err != nil {
 		oncall.Alert(
 			KeyRedisConnection,
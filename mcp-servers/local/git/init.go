@@ -19,7 +19,7 @@ func init() {
 		mcpservers.NewMcp(
 			"git",
 			"Git",
-			model.PublicMCPTypeDocs,
+			model.PublicMCPTypeStdio,
 			mcpservers.WithNameCN("Git"),
 			mcpservers.WithTags([]string{"git"}),
 			mcpservers.WithGitHubURL(
@@ -31,6 +31,18 @@ func init() {
 			mcpservers.WithDescriptionCN(
 				"一个用于Git操作的Node.js MCP服务器。",
 			),
+			mcpservers.WithStdioConfig(model.MCPStdioConfig{
+				Command: "uvx",
+				Args:    []string{"mcp-server-git", "--repository", "${GIT_REPOSITORY}"},
+			}),
+			mcpservers.WithConfigTemplates(mcpservers.ConfigTemplates{
+				"GIT_REPOSITORY": {
+					Name:        "Repository",
+					Required:    mcpservers.ConfigRequiredTypeInitOnly,
+					Example:     "/data/repos/aiproxy",
+					Description: "The path of the git repository",
+				},
+			}),
 			mcpservers.WithReadme(readme),
 			mcpservers.WithReadmeCN(readmeCN),
 		),
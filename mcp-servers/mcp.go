@@ -236,6 +236,14 @@ func WithProxyConfigTemplates(proxyConfigTemplates ProxyConfigTemplates) McpConf
 	}
 }
 
+// WithStdioConfig sets the command of a stdio mcp, the config templates are
+// passed to the process as env
+func WithStdioConfig(stdioConfig model.MCPStdioConfig) McpConfig {
+	return func(e *McpServer) {
+		e.StdioConfig = &stdioConfig
+	}
+}
+
 func WithListToolsFunc(listTools ListToolsFunc) McpConfig {
 	return func(e *McpServer) {
 		e.listTools = listTools